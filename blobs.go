@@ -0,0 +1,146 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package gogather
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/enterprise-contract/go-gather/expand"
+)
+
+// blobsDir is the directory of a Workspace holding the contents of the files
+// gathered into it, see Workspace.Dedup.
+const blobsDir = ".blobs"
+
+// blobPath returns the path of the blob holding the contents of the regular
+// file e. Blobs are keyed by their permissions too, as the files linked to
+// them share them.
+func (w *Workspace) blobPath(e expand.ManifestEntry) string {
+	return filepath.Join(w.root, blobsDir, "sha256", fmt.Sprintf("%s-%04o", e.SHA256, e.Mode.Perm()))
+}
+
+// dedup replaces the regular files of entries, the manifest of the tree at
+// dst, with links to blobs holding the same contents, storing those not
+// stored yet. It returns the number of files that were stored already.
+func (w *Workspace) dedup(ctx context.Context, dst string, entries []expand.ManifestEntry) (int, error) {
+	if err := os.MkdirAll(filepath.Join(w.root, blobsDir, "sha256"), 0755); err != nil {
+		return 0, fmt.Errorf("failed to create blob store: %w", err)
+	}
+	var linked int
+	for _, e := range entries {
+		if err := ctx.Err(); err != nil {
+			return linked, err
+		}
+		if !e.Mode.IsRegular() {
+			continue
+		}
+		p := filepath.Join(dst, filepath.FromSlash(e.Path))
+		blob := w.blobPath(e)
+		err := os.Link(p, blob)
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return linked, fmt.Errorf("failed to store %s: %w", e.Path, err)
+		}
+		// The contents are stored already, by this gather or another one
+		if err := replaceWithLink(blob, p); err != nil {
+			return linked, fmt.Errorf("failed to link %s: %w", e.Path, err)
+		}
+		linked++
+	}
+	return linked, nil
+}
+
+// replaceWithLink replaces the file at p with a hard link to blob.
+func replaceWithLink(blob, p string) error {
+	if same, err := sameFile(blob, p); err != nil || same {
+		return err
+	}
+	tmp := filepath.Join(filepath.Dir(p), ".blob-"+filepath.Base(p))
+	if err := os.Link(blob, tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, p); err != nil {
+		return AppendErrors(Errors{err}, os.Remove(tmp)).Err()
+	}
+	return nil
+}
+
+func sameFile(a, b string) (bool, error) {
+	ai, err := os.Stat(a)
+	if err != nil {
+		return false, err
+	}
+	bi, err := os.Stat(b)
+	if err != nil {
+		return false, err
+	}
+	return os.SameFile(ai, bi), nil
+}
+
+// materializable reports whether the tree of r can be linked into place from
+// the blob store: its entries still match its digest, and are directories
+// and regular files whose contents are stored.
+func (w *Workspace) materializable(r *Record) bool {
+	if TreeDigest(r.Entries) != r.TreeDigest {
+		return false
+	}
+	for _, e := range r.Entries {
+		switch {
+		case e.Mode.IsDir():
+		case e.Mode.IsRegular():
+			if _, err := os.Lstat(w.blobPath(e)); err != nil {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// materialize links the tree of r into dst from the blob store.
+func (w *Workspace) materialize(ctx context.Context, r *Record, dst string) error {
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", dst, err)
+	}
+	for _, e := range r.Entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !filepath.IsLocal(filepath.FromSlash(e.Path)) {
+			return fmt.Errorf("invalid entry %s", e.Path)
+		}
+		p := filepath.Join(dst, filepath.FromSlash(e.Path))
+		if e.Mode.IsDir() {
+			if err := os.MkdirAll(p, e.Mode.Perm()); err != nil {
+				return fmt.Errorf("failed to create %s: %w", e.Path, err)
+			}
+			continue
+		}
+		if err := os.Link(w.blobPath(e), p); err != nil {
+			return fmt.Errorf("failed to link %s: %w", e.Path, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,439 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+
+	gogather "github.com/enterprise-contract/go-gather"
+	"github.com/enterprise-contract/go-gather/config"
+	"github.com/enterprise-contract/go-gather/gather"
+	"github.com/enterprise-contract/go-gather/gather/file"
+	"github.com/enterprise-contract/go-gather/gather/git"
+	ghttp "github.com/enterprise-contract/go-gather/gather/http"
+	"github.com/enterprise-contract/go-gather/gather/ipfs"
+	"github.com/enterprise-contract/go-gather/gather/oci"
+	"github.com/enterprise-contract/go-gather/gather/s3"
+	"github.com/enterprise-contract/go-gather/gather/svn"
+	"github.com/enterprise-contract/go-gather/gather/webdav"
+	"github.com/enterprise-contract/go-gather/reconcile"
+)
+
+const (
+	// defaultInterval is how often the sources are reconciled by default.
+	defaultInterval = time.Minute
+	// defaultRefresh is how often every source is gathered again by
+	// default.
+	defaultRefresh = 15 * time.Minute
+	// watchInterval is how often the sources file is checked for changes.
+	watchInterval = 2 * time.Second
+)
+
+const daemonUsage = `Usage: go-gather daemon --sources <file> [flags]
+
+Keeps the target directory in line with the sources listed in a YAML file:
+
+  target: /var/lib/policies
+  interval: 1m
+  refresh: 15m
+  sources:
+    - name: policy/release
+      uri: git::https://github.com/org/policy//release?ref=main
+    - name: data
+      uri: oci::quay.io/org/data:latest
+
+Every interval, and whenever the file changes, sources are gathered into
+the target when added or changed, trees that drifted from what was gathered
+are repaired, and the files of removed sources are pruned. Every refresh,
+every source is gathered again to pick up changes of branches and tags. Each
+tree is gathered aside and moved into place once complete, so readers never
+see a partial tree.
+
+The daemon serves /healthz, failing once a reconciliation failed, /readyz,
+failing until the target was first reconciled, and Prometheus metrics on
+/metrics.
+
+Flags:
+`
+
+// sourcesFile is the file listing the sources the daemon gathers.
+type sourcesFile struct {
+	// Target is the directory the sources are gathered into.
+	Target string `mapstructure:"target"`
+	// Interval is how often the sources are reconciled.
+	Interval time.Duration `mapstructure:"interval"`
+	// Refresh is how often every source is gathered again.
+	Refresh time.Duration `mapstructure:"refresh"`
+	// Sources are the sources gathered into the target.
+	Sources []reconcile.Source `mapstructure:"sources"`
+}
+
+// loadSources reads the sources file at path.
+func loadSources(path string) (*sourcesFile, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+	v.SetConfigType("yaml")
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("failed to read sources %s: %w", path, err)
+	}
+	var f sourcesFile
+	if err := v.Unmarshal(&f); err != nil {
+		return nil, fmt.Errorf("invalid sources %s: %w", path, err)
+	}
+	return &f, nil
+}
+
+// daemon reconciles a target directory with a sources file.
+type daemon struct {
+	// sources is the path of the sources file.
+	sources string
+	// target, interval and refresh override those of the sources file when
+	// set.
+	target   string
+	interval time.Duration
+	refresh  time.Duration
+	registry *gather.Registry
+
+	mu    sync.Mutex
+	stats daemonStats
+}
+
+// daemonStats is what the health and metrics endpoints report.
+type daemonStats struct {
+	syncs, failures int
+	// steps counts the steps applied by action.
+	steps            map[reconcile.Action]int
+	drifted, updated int
+	sources          int
+	lastSuccess      time.Time
+	lastErr          error
+}
+
+// settings returns the target, interval and refresh of the daemon, as set
+// by its flags, f or the defaults.
+func (d *daemon) settings(f *sourcesFile) (string, time.Duration, time.Duration) {
+	target, interval, refresh := d.target, d.interval, d.refresh
+	if f != nil {
+		if target == "" {
+			target = f.Target
+		}
+		if interval <= 0 {
+			interval = f.Interval
+		}
+		if refresh <= 0 {
+			refresh = f.Refresh
+		}
+	}
+	if interval <= 0 {
+		interval = defaultInterval
+	}
+	if refresh <= 0 {
+		refresh = defaultRefresh
+	}
+	return target, interval, refresh
+}
+
+// sync reconciles the target with the sources file once. With refresh,
+// every source is gathered again, not only those added, changed or
+// drifted.
+func (d *daemon) sync(ctx context.Context, refresh bool) (*sourcesFile, error) {
+	f, err := loadSources(d.sources)
+	var p *reconcile.Plan
+	if err == nil {
+		p, err = d.plan(ctx, f, refresh)
+	}
+	if err == nil && p.HasChanges() {
+		log.Printf("applying plan for %s:\n%s", p.Root, p)
+		err = reconcile.Apply(ctx, p, reconcile.Options{Registry: d.registry})
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.stats.syncs++
+	if p != nil {
+		d.record(p)
+	}
+	if f != nil {
+		d.stats.sources = len(f.Sources)
+	}
+	d.stats.lastErr = err
+	if err != nil {
+		d.stats.failures++
+		return f, err
+	}
+	d.stats.lastSuccess = time.Now()
+	return f, nil
+}
+
+// plan computes the steps reconciling the target of f.
+func (d *daemon) plan(ctx context.Context, f *sourcesFile, refresh bool) (*reconcile.Plan, error) {
+	target, _, _ := d.settings(f)
+	if target == "" {
+		return nil, errors.New("no target directory")
+	}
+	state, err := reconcile.ReadState(target)
+	if err != nil {
+		return nil, err
+	}
+	p, err := reconcile.Compute(ctx, f.Sources, state)
+	if err != nil {
+		return nil, err
+	}
+	if refresh {
+		// Repinning a tree to the source it was gathered from gathers it
+		// again, picking up changes of the branch or tag it names
+		for i := range p.Steps {
+			if p.Steps[i].Action == reconcile.Keep {
+				p.Steps[i].Action = reconcile.Repin
+			}
+		}
+	}
+	return p, nil
+}
+
+// record counts the steps of p, and the trees it changed, once applied.
+func (d *daemon) record(p *reconcile.Plan) {
+	if d.stats.steps == nil {
+		d.stats.steps = map[reconcile.Action]int{}
+	}
+	for _, s := range p.Steps {
+		d.stats.steps[s.Action]++
+		if s.Drift != nil {
+			d.stats.drifted++
+		}
+		if s.Action == reconcile.Keep || s.Action == reconcile.Delete {
+			continue
+		}
+		r, err := gogather.ReadRecord(filepath.Join(p.Root, filepath.FromSlash(s.Name)))
+		if err == nil && (s.Current == nil || r.TreeDigest != s.Current.TreeDigest) {
+			d.stats.updated++
+		}
+	}
+}
+
+// run reconciles the target every interval, every source being gathered
+// again every refresh, and whenever changed receives, until ctx is done.
+func (d *daemon) run(ctx context.Context, changed <-chan struct{}) {
+	var refreshed time.Time
+	for {
+		f, _ := loadSources(d.sources)
+		_, interval, every := d.settings(f)
+		refresh := refreshed.IsZero() || time.Since(refreshed) >= every
+		if _, err := d.sync(ctx, refresh); err != nil {
+			log.Printf("reconciliation failed: %v", err)
+		} else if refresh {
+			refreshed = time.Now()
+		}
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-changed:
+			log.Printf("%s changed", d.sources)
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// watch sends on the returned channel whenever the file at path changes,
+// checking it every interval until ctx is done.
+func watch(ctx context.Context, path string, interval time.Duration) <-chan struct{} {
+	changed := make(chan struct{}, 1)
+	stamp := func() string {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err.Error()
+		}
+		return fmt.Sprintf("%d %d", info.Size(), info.ModTime().UnixNano())
+	}
+	go func() {
+		last := stamp()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if s := stamp(); s != last {
+				last = s
+				select {
+				case changed <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+	return changed
+}
+
+// handler serves the health and metrics endpoints.
+func (d *daemon) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		d.mu.Lock()
+		err := d.stats.lastErr
+		d.mu.Unlock()
+		if err != nil {
+			http.Error(w, "reconciliation failed: "+err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, _ *http.Request) {
+		d.mu.Lock()
+		ready := !d.stats.lastSuccess.IsZero()
+		d.mu.Unlock()
+		if !ready {
+			http.Error(w, "not reconciled yet", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		fmt.Fprint(w, d.metrics())
+	})
+	return mux
+}
+
+// metrics renders the statistics of the daemon in the Prometheus text
+// format.
+func (d *daemon) metrics() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var b strings.Builder
+	metric := func(name, kind, help string, value any) {
+		fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n%s %v\n", name, help, name, kind, name, value)
+	}
+	metric("go_gather_daemon_syncs_total", "counter", "Reconciliations run.", d.stats.syncs)
+	metric("go_gather_daemon_sync_failures_total", "counter", "Reconciliations that failed.", d.stats.failures)
+	metric("go_gather_daemon_drifted_total", "counter", "Trees found to have drifted from what was gathered.", d.stats.drifted)
+	metric("go_gather_daemon_updated_total", "counter", "Trees whose contents changed when gathered.", d.stats.updated)
+	metric("go_gather_daemon_sources", "gauge", "Sources listed in the sources file.", d.stats.sources)
+	var last int64
+	if !d.stats.lastSuccess.IsZero() {
+		last = d.stats.lastSuccess.Unix()
+	}
+	metric("go_gather_daemon_last_success_timestamp_seconds", "gauge", "Time of the last successful reconciliation.", last)
+
+	fmt.Fprintf(&b, "# HELP go_gather_daemon_steps_total Steps applied, by action.\n# TYPE go_gather_daemon_steps_total counter\n")
+	actions := make([]string, 0, len(d.stats.steps))
+	for a := range d.stats.steps {
+		actions = append(actions, string(a))
+	}
+	sort.Strings(actions)
+	for _, a := range actions {
+		fmt.Fprintf(&b, "go_gather_daemon_steps_total{action=%q} %d\n", a, d.stats.steps[reconcile.Action(a)])
+	}
+	return b.String()
+}
+
+// newRegistry returns a registry of every gatherer the library ships,
+// configured by c. The HTTP and file gatherers come last, for the sources of
+// the others not to be taken for plain URLs or paths.
+func newRegistry(c *config.Config) (*gather.Registry, error) {
+	r := gather.NewRegistry()
+	gatherers := []gather.Gatherer{
+		&git.GitGatherer{},
+		&oci.OCIGatherer{},
+		&s3.S3Gatherer{},
+		&ipfs.IPFSGatherer{},
+		&svn.SVNGatherer{},
+		&webdav.WebDAVGatherer{},
+		&ghttp.HTTPGatherer{},
+		&file.FileGatherer{},
+	}
+	for _, g := range gatherers {
+		if err := c.Apply(g); err != nil {
+			return nil, err
+		}
+		r.RegisterGatherer(g)
+	}
+	return r, nil
+}
+
+// runDaemon runs the daemon subcommand with args until ctx is done.
+func runDaemon(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("daemon", flag.ContinueOnError)
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), daemonUsage)
+		flags.PrintDefaults()
+	}
+	sources := flags.String("sources", "", "the YAML `file` listing the sources")
+	target := flags.String("target", "", "the `directory` to gather into, overriding the target of the sources file")
+	interval := flags.Duration("interval", 0, "how often to reconcile, overriding the interval of the sources file (default 1m)")
+	refresh := flags.Duration("refresh", 0, "how often to gather every source again, overriding the refresh of the sources file (default 15m)")
+	listen := flags.String("listen", ":8080", "the `address` to serve the health and metrics endpoints on")
+	configPath := flags.String("config", "", "the go-gather configuration `file`, see the config package")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *sources == "" {
+		flags.Usage()
+		return errors.New("--sources is required")
+	}
+	if _, err := loadSources(*sources); err != nil {
+		return err
+	}
+
+	c, err := config.Load(*configPath)
+	if err != nil {
+		return err
+	}
+	registry, err := newRegistry(c)
+	if err != nil {
+		return err
+	}
+	d := &daemon{sources: *sources, target: *target, interval: *interval, refresh: *refresh, registry: registry}
+
+	ln, err := net.Listen("tcp", *listen)
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{Handler: d.handler(), ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("serving %s: %v", *listen, err)
+		}
+	}()
+	log.Printf("reconciling %s, serving health and metrics on %s", *sources, ln.Addr())
+
+	d.run(ctx, watch(ctx, *sources, watchInterval))
+
+	shutdown, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+	return srv.Shutdown(shutdown)
+}
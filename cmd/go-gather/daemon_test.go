@@ -0,0 +1,216 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/enterprise-contract/go-gather/config"
+)
+
+func writeSources(t *testing.T, path, target string, sources map[string]string) {
+	t.Helper()
+	var b strings.Builder
+	fmt.Fprintf(&b, "target: %s\nsources:\n", target)
+	for name, uri := range sources {
+		fmt.Fprintf(&b, "  - name: %s\n    uri: %s\n", name, uri)
+	}
+	if err := os.WriteFile(path, []byte(b.String()), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newTestDaemon(t *testing.T, sources string) *daemon {
+	t.Helper()
+	r, err := newRegistry(&config.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &daemon{sources: sources, registry: r}
+}
+
+func status(t *testing.T, h http.Handler, path string) (int, string) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	return rec.Code, rec.Body.String()
+}
+
+func TestDaemon_Sync(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "target")
+	sources := filepath.Join(dir, "sources.yaml")
+	writeFile(t, filepath.Join(dir, "a", "policy.rego"), "package a")
+	writeFile(t, filepath.Join(dir, "b", "data.json"), "{}")
+	writeSources(t, sources, target, map[string]string{
+		"a": filepath.Join(dir, "a"),
+		"b": filepath.Join(dir, "b"),
+	})
+
+	d := newTestDaemon(t, sources)
+	h := d.handler()
+	if code, _ := status(t, h, "/readyz"); code != http.StatusServiceUnavailable {
+		t.Fatalf("expected /readyz to fail before the first sync, got %d", code)
+	}
+
+	ctx := context.Background()
+	if _, err := d.sync(ctx, false); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	for _, p := range []string{"a/policy.rego", "b/data.json"} {
+		if _, err := os.Stat(filepath.Join(target, p)); err != nil {
+			t.Fatalf("expected %s to be gathered: %v", p, err)
+		}
+	}
+	if code, _ := status(t, h, "/readyz"); code != http.StatusOK {
+		t.Fatalf("expected /readyz to succeed, got %d", code)
+	}
+
+	// A change of a source is only picked up on refresh
+	writeFile(t, filepath.Join(dir, "a", "policy.rego"), "package a.v2")
+	if _, err := d.sync(ctx, false); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if b, _ := os.ReadFile(filepath.Join(target, "a", "policy.rego")); string(b) != "package a" {
+		t.Fatalf("expected the tree to be kept without refresh, got %q", b)
+	}
+	if _, err := d.sync(ctx, true); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if b, _ := os.ReadFile(filepath.Join(target, "a", "policy.rego")); string(b) != "package a.v2" {
+		t.Fatalf("expected the tree to be refreshed, got %q", b)
+	}
+
+	// Removing a source prunes its tree
+	writeSources(t, sources, target, map[string]string{"a": filepath.Join(dir, "a")})
+	if _, err := d.sync(ctx, false); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(target, "b")); !os.IsNotExist(err) {
+		t.Fatalf("expected b to be pruned, got %v", err)
+	}
+
+	_, m := status(t, h, "/metrics")
+	for _, want := range []string{
+		"go_gather_daemon_syncs_total 4\n",
+		"go_gather_daemon_sync_failures_total 0\n",
+		"go_gather_daemon_updated_total 3\n",
+		"go_gather_daemon_sources 1\n",
+		`go_gather_daemon_steps_total{action="delete"} 1`,
+	} {
+		if !strings.Contains(m, want) {
+			t.Errorf("expected metrics to contain %q, got:\n%s", want, m)
+		}
+	}
+
+	// A broken sources file fails the health check, not readiness
+	writeFile(t, sources, "sources: [")
+	if _, err := d.sync(ctx, false); err == nil {
+		t.Fatal("expected sync to fail")
+	}
+	if code, _ := status(t, h, "/healthz"); code != http.StatusServiceUnavailable {
+		t.Fatalf("expected /healthz to fail, got %d", code)
+	}
+	if code, _ := status(t, h, "/readyz"); code != http.StatusOK {
+		t.Fatalf("expected /readyz to succeed, got %d", code)
+	}
+}
+
+func TestDaemon_Settings(t *testing.T) {
+	d := &daemon{interval: time.Second}
+	target, interval, refresh := d.settings(&sourcesFile{Target: "/t", Interval: time.Hour, Refresh: time.Minute})
+	if target != "/t" || interval != time.Second || refresh != time.Minute {
+		t.Fatalf("unexpected settings %q %v %v", target, interval, refresh)
+	}
+	_, interval, refresh = d.settings(nil)
+	if interval != time.Second || refresh != defaultRefresh {
+		t.Fatalf("unexpected defaults %v %v", interval, refresh)
+	}
+}
+
+func TestNewRegistry(t *testing.T) {
+	r, err := newRegistry(&config.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for uri, want := range map[string]string{
+		"git::https://github.com/org/repo":  "*git.GitGatherer",
+		"oci::quay.io/org/policy:latest":    "*oci.OCIGatherer",
+		"s3://bucket/policy.tar.gz":         "*s3.S3Gatherer",
+		"ipfs://bafybeigdyrzt5sfp7udm7hu76": "*ipfs.IPFSGatherer",
+		"svn::https://example.com/repo":     "*svn.SVNGatherer",
+		"webdav::https://example.com/dav":   "*webdav.WebDAVGatherer",
+		"https://example.com/policy.rego":   "*http.HTTPGatherer",
+		"/tmp/policy":                       "*file.FileGatherer",
+	} {
+		g, err := r.GetGatherer(uri)
+		if err != nil {
+			t.Errorf("no gatherer for %s: %v", uri, err)
+			continue
+		}
+		if got := fmt.Sprintf("%T", g); got != want {
+			t.Errorf("gatherer of %s = %s, want %s", uri, got, want)
+		}
+	}
+}
+
+func TestWatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sources.yaml")
+	writeFile(t, path, "sources: []")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changed := watch(ctx, path, 10*time.Millisecond)
+
+	time.Sleep(30 * time.Millisecond)
+	writeFile(t, path, "sources: [] # changed")
+	select {
+	case <-changed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected a change to be reported")
+	}
+}
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+	if code := run(ctx, nil); code != 2 {
+		t.Fatalf("expected exit code 2 without a command, got %d", code)
+	}
+	if code := run(ctx, []string{"nope"}); code != 2 {
+		t.Fatalf("expected exit code 2 for an unknown command, got %d", code)
+	}
+	if code := run(ctx, []string{"daemon"}); code != 1 {
+		t.Fatalf("expected exit code 1 without --sources, got %d", code)
+	}
+}
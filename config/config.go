@@ -0,0 +1,292 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package config loads the defaults of the gatherers and expanders from a
+// configuration file and the environment, so that the library and the tools
+// built on it share one place to configure proxies, caches, credentials,
+// mirrors and limits. Options set on a gatherer or expander always take
+// precedence: the configuration only fills in the options left unset.
+//
+// The file is YAML, by default $XDG_CONFIG_HOME/go-gather/config.yaml, e.g.
+//
+//	proxy: http://proxy.example.com:3128
+//	rate_limit: 10485760
+//	cache_dir: /var/cache/go-gather
+//	credentials:
+//	  quay.io:
+//	    username: robot
+//	    password_env: QUAY_TOKEN
+//	mirrors:
+//	  docker.io:
+//	    - https://mirror.example.com
+//	limits:
+//	  max_file_size: 1073741824
+//	  max_files: 10000
+//
+// Every scalar setting can be overridden by an environment variable named
+// after it, e.g. GO_GATHER_PROXY or GO_GATHER_LIMITS_MAX_FILES, which takes
+// precedence over the file.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/viper"
+
+	"github.com/enterprise-contract/go-gather/expand/bzip2"
+	"github.com/enterprise-contract/go-gather/expand/tar"
+	"github.com/enterprise-contract/go-gather/expand/zip"
+	"github.com/enterprise-contract/go-gather/gather/git"
+	ghttp "github.com/enterprise-contract/go-gather/gather/http"
+	"github.com/enterprise-contract/go-gather/gather/ipfs"
+	"github.com/enterprise-contract/go-gather/gather/oci"
+	"github.com/enterprise-contract/go-gather/gather/webdav"
+	"github.com/enterprise-contract/go-gather/internal/proxy"
+)
+
+const (
+	// EnvConfig names the configuration file to load instead of the
+	// default one.
+	EnvConfig = "GO_GATHER_CONFIG"
+	// EnvPrefix prefixes the environment variables overriding settings.
+	EnvPrefix = "GO_GATHER"
+)
+
+// Config holds the defaults of the gatherers and expanders.
+type Config struct {
+	// Proxy is the URL of the proxy the HTTP, WebDAV, IPFS, git and OCI
+	// gatherers send their requests through.
+	Proxy string `mapstructure:"proxy"`
+	// RateLimit bounds the bandwidth of the HTTP, git and OCI gathers, in
+	// bytes per second.
+	RateLimit int64 `mapstructure:"rate_limit"`
+	// CacheDir is a directory gatherers keep caches in, e.g. the git
+	// gatherer keeps its mirrors in the git subdirectory.
+	CacheDir string `mapstructure:"cache_dir"`
+	// Credentials maps hosts to the credentials to authenticate with, see
+	// Credential.
+	Credentials map[string]CredentialRef `mapstructure:"credentials"`
+	// Mirrors maps OCI registries to their mirrors, as in
+	// oci.OCIGatherer.Mirrors.
+	Mirrors map[string][]string `mapstructure:"mirrors"`
+	// Limits bound what archives may expand to.
+	Limits Limits `mapstructure:"limits"`
+}
+
+// CredentialRef refers to credentials kept outside the configuration, in
+// environment variables or files, so that the file holds no secrets.
+type CredentialRef struct {
+	Username     string `mapstructure:"username"`
+	PasswordEnv  string `mapstructure:"password_env"`
+	PasswordFile string `mapstructure:"password_file"`
+	// TokenEnv and TokenFile hold a bearer token, for registries accepting
+	// one.
+	TokenEnv  string `mapstructure:"token_env"`
+	TokenFile string `mapstructure:"token_file"`
+}
+
+// Credential is a CredentialRef with the secrets it refers to read.
+type Credential struct {
+	Username string
+	Password string
+	Token    string
+}
+
+// Limits bound what archives may expand to. Zero leaves a limit unset.
+type Limits struct {
+	// MaxFileSize is the size in bytes an archive may expand to.
+	MaxFileSize int64 `mapstructure:"max_file_size"`
+	// MaxFiles is the number of files an archive may hold.
+	MaxFiles int `mapstructure:"max_files"`
+}
+
+// settings are the keys that can be overridden from the environment.
+var settings = []string{"proxy", "rate_limit", "cache_dir", "limits::max_file_size", "limits::max_files"}
+
+// DefaultPath returns the path of the default configuration file,
+// go-gather/config.yaml in $XDG_CONFIG_HOME, or in ~/.config when it is not
+// set.
+func DefaultPath() (string, error) {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to find the configuration directory: %w", err)
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "go-gather", "config.yaml"), nil
+}
+
+// Load reads the configuration file at path and the environment. An empty
+// path loads the file named by EnvConfig, or the default file, which need
+// not exist.
+func Load(path string) (*Config, error) {
+	optional := false
+	if path == "" {
+		path = os.Getenv(EnvConfig)
+	}
+	if path == "" {
+		var err error
+		if path, err = DefaultPath(); err != nil {
+			return nil, err
+		}
+		optional = true
+	}
+
+	// Registries and hosts contain dots, so keys are delimited otherwise
+	v := viper.NewWithOptions(viper.KeyDelimiter("::"))
+	v.SetConfigFile(path)
+	v.SetConfigType("yaml")
+	v.SetEnvPrefix(EnvPrefix)
+	v.SetEnvKeyReplacer(strings.NewReplacer("::", "_"))
+	for _, key := range settings {
+		if err := v.BindEnv(key); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := v.ReadInConfig(); err != nil {
+		if !optional || !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("failed to read configuration %s: %w", path, err)
+		}
+	}
+
+	var c Config
+	if err := v.Unmarshal(&c); err != nil {
+		return nil, fmt.Errorf("invalid configuration %s: %w", path, err)
+	}
+	if c.Proxy != "" {
+		if _, err := proxy.Parse(c.Proxy); err != nil {
+			return nil, err
+		}
+	}
+	return &c, nil
+}
+
+// Credential returns the credentials configured for host, reading the
+// environment variables and files they refer to, and whether there are any.
+func (c *Config) Credential(host string) (Credential, bool, error) {
+	ref, ok := c.Credentials[host]
+	if !ok {
+		return Credential{}, false, nil
+	}
+	password, err := secret(ref.PasswordEnv, ref.PasswordFile)
+	if err != nil {
+		return Credential{}, false, fmt.Errorf("password for %s: %w", host, err)
+	}
+	token, err := secret(ref.TokenEnv, ref.TokenFile)
+	if err != nil {
+		return Credential{}, false, fmt.Errorf("token for %s: %w", host, err)
+	}
+	return Credential{Username: ref.Username, Password: password, Token: token}, true, nil
+}
+
+// secret reads the environment variable env, or the file named file.
+func secret(env, file string) (string, error) {
+	switch {
+	case env != "":
+		v, ok := os.LookupEnv(env)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", env)
+		}
+		return v, nil
+	case file != "":
+		b, err := os.ReadFile(file)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(b)), nil
+	}
+	return "", nil
+}
+
+// Apply fills in the options of the gatherer or expander v that are unset
+// with the configured defaults; values of other types are left alone.
+// Credentials are not applied as they depend on the host of each source, see
+// Credential.
+func (c *Config) Apply(v any) error {
+	switch v := v.(type) {
+	case *ghttp.HTTPGatherer:
+		if v.RateLimit == 0 {
+			v.RateLimit = c.RateLimit
+		}
+		return c.applyClient(&v.Client)
+	case *webdav.WebDAVGatherer:
+		return c.applyClient(&v.Client)
+	case *ipfs.IPFSGatherer:
+		return c.applyClient(&v.Client)
+	case *git.GitGatherer:
+		if v.CacheDir == "" && c.CacheDir != "" {
+			v.CacheDir = filepath.Join(c.CacheDir, "git")
+		}
+		if v.Proxy == "" {
+			v.Proxy = c.Proxy
+		}
+		if v.RateLimit == 0 {
+			v.RateLimit = c.RateLimit
+		}
+	case *oci.OCIGatherer:
+		if v.Mirrors == nil {
+			v.Mirrors = c.Mirrors
+		}
+		if v.Proxy == "" {
+			v.Proxy = c.Proxy
+		}
+		if v.RateLimit == 0 {
+			v.RateLimit = c.RateLimit
+		}
+	case *tar.TarExpander:
+		if v.FileSizeLimit == 0 {
+			v.FileSizeLimit = c.Limits.MaxFileSize
+		}
+		if v.FilesLimit == 0 {
+			v.FilesLimit = c.Limits.MaxFiles
+		}
+	case *zip.ZipExpander:
+		if v.FileSizeLimit == 0 {
+			v.FileSizeLimit = c.Limits.MaxFileSize
+		}
+		if v.FilesLimit == 0 {
+			v.FilesLimit = c.Limits.MaxFiles
+		}
+	case *bzip2.Bzip2Expander:
+		if v.FileSizeLimit == 0 {
+			v.FileSizeLimit = c.Limits.MaxFileSize
+		}
+	}
+	return nil
+}
+
+// applyClient sends the requests of client through the proxy, unless it has
+// a transport of its own.
+func (c *Config) applyClient(client *http.Client) error {
+	if c.Proxy == "" || client.Transport != nil {
+		return nil
+	}
+	transport, err := proxy.Transport(http.DefaultTransport, c.Proxy)
+	if err != nil {
+		return err
+	}
+	client.Transport = transport
+	return nil
+}
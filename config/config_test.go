@@ -0,0 +1,182 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package config
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/enterprise-contract/go-gather/expand/tar"
+	"github.com/enterprise-contract/go-gather/gather/git"
+	ghttp "github.com/enterprise-contract/go-gather/gather/http"
+	"github.com/enterprise-contract/go-gather/gather/oci"
+)
+
+const testConfig = `
+proxy: http://proxy.example.com:3128
+rate_limit: 1048576
+cache_dir: /var/cache/go-gather
+credentials:
+  quay.io:
+    username: robot
+    password_env: TEST_QUAY_PASSWORD
+  registry.example.com:
+    token_file: token
+mirrors:
+  docker.io:
+    - https://mirror.example.com
+limits:
+  max_file_size: 1024
+  max_files: 10
+`
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	c, err := Load(writeConfig(t, testConfig))
+	require.NoError(t, err)
+	assert.Equal(t, &Config{
+		Proxy:     "http://proxy.example.com:3128",
+		RateLimit: 1048576,
+		CacheDir:  "/var/cache/go-gather",
+		Credentials: map[string]CredentialRef{
+			"quay.io":              {Username: "robot", PasswordEnv: "TEST_QUAY_PASSWORD"},
+			"registry.example.com": {TokenFile: "token"},
+		},
+		Mirrors: map[string][]string{"docker.io": {"https://mirror.example.com"}},
+		Limits:  Limits{MaxFileSize: 1024, MaxFiles: 10},
+	}, c)
+}
+
+func TestLoad_Environment(t *testing.T) {
+	path := writeConfig(t, testConfig)
+	t.Setenv("GO_GATHER_PROXY", "http://other.example.com")
+	t.Setenv("GO_GATHER_LIMITS_MAX_FILES", "20")
+	c, err := Load(path)
+	require.NoError(t, err)
+	assert.Equal(t, "http://other.example.com", c.Proxy)
+	assert.Equal(t, 20, c.Limits.MaxFiles)
+	assert.Equal(t, int64(1024), c.Limits.MaxFileSize)
+
+	// The file can be named by the environment too
+	t.Setenv(EnvConfig, path)
+	c, err = Load("")
+	require.NoError(t, err)
+	assert.Equal(t, "/var/cache/go-gather", c.CacheDir)
+}
+
+func TestLoad_Missing(t *testing.T) {
+	// The default file is optional
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv(EnvConfig, "")
+	c, err := Load("")
+	require.NoError(t, err)
+	assert.Equal(t, &Config{}, c)
+
+	// A file named explicitly is not
+	_, err = Load(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.Error(t, err)
+}
+
+func TestDefaultPath(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", "/config")
+	path, err := DefaultPath()
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join("/config", "go-gather", "config.yaml"), path)
+}
+
+func TestConfig_Credential(t *testing.T) {
+	dir := t.TempDir()
+	token := filepath.Join(dir, "token")
+	require.NoError(t, os.WriteFile(token, []byte("s3cr3t\n"), 0o600))
+	c := &Config{Credentials: map[string]CredentialRef{
+		"quay.io":              {Username: "robot", PasswordEnv: "TEST_QUAY_PASSWORD"},
+		"registry.example.com": {TokenFile: token},
+		"unset.example.com":    {PasswordEnv: "TEST_UNSET_PASSWORD"},
+	}}
+	t.Setenv("TEST_QUAY_PASSWORD", "hunter2")
+
+	cred, ok, err := c.Credential("quay.io")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, Credential{Username: "robot", Password: "hunter2"}, cred)
+
+	cred, ok, err = c.Credential("registry.example.com")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, Credential{Token: "s3cr3t"}, cred)
+
+	_, ok, err = c.Credential("other.example.com")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	_, _, err = c.Credential("unset.example.com")
+	assert.ErrorContains(t, err, "TEST_UNSET_PASSWORD")
+}
+
+func TestConfig_Apply(t *testing.T) {
+	c := &Config{
+		Proxy:     "http://proxy.example.com:3128",
+		RateLimit: 1048576,
+		CacheDir:  "/cache",
+		Mirrors:   map[string][]string{"docker.io": {"mirror.example.com"}},
+		Limits:    Limits{MaxFileSize: 1024, MaxFiles: 10},
+	}
+
+	h := &ghttp.HTTPGatherer{}
+	require.NoError(t, c.Apply(h))
+	transport, ok := h.Client.Transport.(*http.Transport)
+	require.True(t, ok)
+	req, _ := http.NewRequest(http.MethodGet, "https://example.com", nil)
+	proxy, err := transport.Proxy(req)
+	require.NoError(t, err)
+	assert.Equal(t, "http://proxy.example.com:3128", proxy.String())
+	assert.Equal(t, c.RateLimit, h.RateLimit)
+
+	g := &git.GitGatherer{}
+	require.NoError(t, c.Apply(g))
+	assert.Equal(t, filepath.Join("/cache", "git"), g.CacheDir)
+	assert.Equal(t, c.Proxy, g.Proxy)
+	assert.Equal(t, c.RateLimit, g.RateLimit)
+
+	o := &oci.OCIGatherer{}
+	require.NoError(t, c.Apply(o))
+	assert.Equal(t, c.Mirrors, o.Mirrors)
+	assert.Equal(t, c.Proxy, o.Proxy)
+	assert.Equal(t, c.RateLimit, o.RateLimit)
+
+	// Options set programmatically take precedence
+	own := &http.Transport{}
+	h = &ghttp.HTTPGatherer{Client: http.Client{Transport: own}}
+	require.NoError(t, c.Apply(h))
+	assert.Same(t, own, h.Client.Transport)
+
+	x := &tar.TarExpander{FilesLimit: 5}
+	require.NoError(t, c.Apply(x))
+	assert.Equal(t, int64(1024), x.FileSizeLimit)
+	assert.Equal(t, 5, x.FilesLimit)
+}
@@ -0,0 +1,116 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package gogather
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// ConflictPolicy is what Gather does with a destination that exists
+// already, see WithConflictPolicy. An empty directory is not taken to
+// exist.
+type ConflictPolicy string
+
+const (
+	// ConflictFail fails the gather, before gathering, with an error
+	// matching ErrDestinationExists.
+	ConflictFail ConflictPolicy = "fail"
+	// ConflictOverwrite replaces the destination with what was gathered,
+	// once it was gathered, so that a failed gather leaves it as it was.
+	ConflictOverwrite ConflictPolicy = "overwrite"
+	// ConflictMerge adds what was gathered to the destination, replacing
+	// the files gathered again and keeping the others.
+	ConflictMerge ConflictPolicy = "merge"
+	// ConflictSkipIfExists leaves the destination as it is, without
+	// gathering the source.
+	ConflictSkipIfExists ConflictPolicy = "skip"
+)
+
+// Validate returns an error if p is not one of the policies, or empty.
+func (p ConflictPolicy) Validate() error {
+	switch p {
+	case "", ConflictFail, ConflictOverwrite, ConflictMerge, ConflictSkipIfExists:
+		return nil
+	}
+	return fmt.Errorf("unknown conflict policy %q, expected one of fail, overwrite, merge and skip", p)
+}
+
+// occupied reports whether something other than an empty directory is at
+// destination.
+func occupied(destination string) (bool, error) {
+	info, err := os.Lstat(destination)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to inspect %s: %w", destination, err)
+	}
+	if !info.IsDir() {
+		return true, nil
+	}
+	d, err := os.Open(destination)
+	if err != nil {
+		return false, fmt.Errorf("failed to inspect %s: %w", destination, err)
+	}
+	defer d.Close()
+	if _, err := d.Readdirnames(1); err == io.EOF {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("failed to inspect %s: %w", destination, err)
+	}
+	return true, nil
+}
+
+// replace moves the file or directory at from to destination, replacing
+// what is there. What was there is moved aside into staging first, and
+// back should the move fail.
+func replace(from, destination, staging string) error {
+	old := filepath.Join(staging, ".replaced")
+	if err := os.Rename(destination, old); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to move %s aside: %w", destination, err)
+	}
+	if err := os.Rename(from, destination); err != nil {
+		err = fmt.Errorf("failed to move into %s: %w", destination, err)
+		if _, statErr := os.Lstat(old); statErr == nil {
+			err = AppendErrors(Errors{err}, os.Rename(old, destination)).Err()
+		}
+		return err
+	}
+	return nil
+}
+
+// SkippedMetadata is the metadata Gather returns for a gather skipped for
+// its destination existing, see ConflictSkipIfExists.
+type SkippedMetadata struct {
+	// URI is the source that was not gathered.
+	URI string
+	// Path is the destination that existed.
+	Path string
+}
+
+func (s *SkippedMetadata) Get() interface{} {
+	return s
+}
+
+func (s SkippedMetadata) GetPinnedURL(u string) (string, error) {
+	return "", fmt.Errorf("%s was not gathered, %s exists already", u, s.Path)
+}
@@ -0,0 +1,46 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package gogather
+
+import (
+	"github.com/enterprise-contract/go-gather/gather"
+	"github.com/enterprise-contract/go-gather/internal/multierr"
+)
+
+// The causes of failures callers can branch on with errors.Is, whatever
+// gathered the source. See the gather package for what each stands for.
+var (
+	ErrUnsupportedScheme  = gather.ErrUnsupportedScheme
+	ErrDestinationExists  = gather.ErrDestinationExists
+	ErrSizeLimitExceeded  = gather.ErrSizeLimitExceeded
+	ErrAuthRequired       = gather.ErrAuthRequired
+	ErrVerificationFailed = gather.ErrVerificationFailed
+)
+
+// Errors is a list of errors reported together. Operations that carry on
+// past individual failures, such as layout verification or the cleanup
+// after a failed gather, return it. errors.Is and errors.As match every
+// error in the list, and the message lists them in order:
+//
+//	2 errors occurred: first failure; second failure
+type Errors = multierr.Errors
+
+// AppendErrors returns errs with the non-nil errors of more appended,
+// flattening any Errors among them.
+func AppendErrors(errs Errors, more ...error) Errors {
+	return multierr.Append(errs, more...)
+}
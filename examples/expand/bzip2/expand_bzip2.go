@@ -46,7 +46,7 @@ func main() {
 	b := &bzip2.Bzip2Expander{}
 
 	// Expand the bzip2 compressed file to the destination directory
-	err := b.Expand(context.Background(), filepath.Join(src, "test.bz2"), dst, 0600)
+	_, err := b.Expand(context.Background(), filepath.Join(src, "test.bz2"), dst, 0600)
 	if err != nil {
 		panic(err)
 	}
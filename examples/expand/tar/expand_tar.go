@@ -49,7 +49,7 @@ func main() {
 
 	// Expand the gzip compressed file to the destination directory
 
-	err := t.Expand(context.Background(), src, dst, 0600)
+	_, err := t.Expand(context.Background(), src, dst, 0600)
 	if err != nil {
 		panic(err)
 	}
@@ -46,7 +46,7 @@ func main() {
 	z := &zipExpander.ZipExpander{}
 
 	// Expand the zip compressed file to the destination directory
-	err := z.Expand(context.Background(), src, dst, 0600)
+	_, err := z.Expand(context.Background(), src, dst, 0600)
 	if err != nil {
 		panic(err)
 	}
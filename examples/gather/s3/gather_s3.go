@@ -0,0 +1,59 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package main
+
+import (
+	"context"
+	"os"
+
+	"github.com/enterprise-contract/go-gather/gather/s3"
+)
+
+func main() {
+	// -------------------------------------------------------------------------
+	// The following code shows how to gather every object under an S3 prefix
+	// to a destination directory using the s3 gatherer. Credentials are read
+	// from the standard AWS chain (AWS_PROFILE, AWS_ACCESS_KEY_ID, etc).
+	// -------------------------------------------------------------------------
+
+	// Set the source URI to the bucket prefix
+	src := "s3://my-bucket/policies/"
+
+	// Create a temporary directory to act as our destination directory
+	dst, err := os.MkdirTemp("", "s3_gather_example_dst_")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dst)
+
+	g := &s3.S3Gatherer{}
+
+	// Gather the objects under the prefix to the destination directory
+	m, err := g.Gather(context.Background(), src, dst)
+	if err != nil {
+		panic(err)
+	}
+
+	// Do a type assertion for ease of use
+	metadata := m.(*s3.S3Metadata)
+
+	// Print the metadata
+	println("Destination Path: ", metadata.Path)
+	println("Objects", metadata.Objects)
+	println("Size", metadata.Size)
+	println("Timestamp", metadata.Timestamp)
+}
@@ -24,63 +24,105 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
 
 	"github.com/enterprise-contract/go-gather/expand"
+	"github.com/enterprise-contract/go-gather/faults"
+	"github.com/enterprise-contract/go-gather/fserrors"
 	"github.com/enterprise-contract/go-gather/internal/helpers"
+	"github.com/enterprise-contract/go-gather/internal/tracing"
+	"github.com/enterprise-contract/go-gather/metadata"
 )
 
 var pathExpanderFunc = helpers.ExpandPath
 
 type Bzip2Expander struct {
 	FileSizeLimit int64
+	// MemoryGuard, if set, is reserved the memory each expansion buffers,
+	// throttling expansions running in parallel.
+	MemoryGuard *expand.MemoryGuard
 }
 
-func (b *Bzip2Expander) Expand(ctx context.Context, src, dst string, umask os.FileMode) error {
-	src, err := pathExpanderFunc(src)
+// decoderMemory is the memory reserved from a MemoryGuard for the state of
+// the decoder, which holds a block of up to 900k words, besides the copy
+// buffer.
+const decoderMemory = 4 * 1024 * 1024
+
+func (b *Bzip2Expander) Expand(ctx context.Context, src, dst string, umask os.FileMode) (out *expand.Manifest, err error) {
+	ctx, span := tracing.Start(ctx, "expand", attribute.String("expand.format", "bzip2"), attribute.String("expand.source", src))
+	defer func() {
+		if out != nil {
+			span.SetAttributes(attribute.Int("files", out.Stats.Entries), attribute.Int64("bytes", out.Stats.Bytes))
+		}
+		tracing.End(span, err)
+	}()
+
+	defer func() { err = fserrors.Classify(err) }()
+
+	src, err = pathExpanderFunc(src)
 	if err != nil {
-		return fmt.Errorf("failed to expand source path: %w", err)
+		return nil, fmt.Errorf("failed to expand source path: %w", err)
 	}
 	dst, err = pathExpanderFunc(dst)
 	if err != nil {
-		return fmt.Errorf("failed to expand destination path: %w", err)
+		return nil, fmt.Errorf("failed to expand destination path: %w", err)
 	}
 
 	input, err := os.Open(src)
 	if err != nil {
-		return fmt.Errorf("failed to open bzip2 file %q: %w", src, err)
+		return nil, fmt.Errorf("failed to open bzip2 file %q: %w", src, err)
 	}
 	defer input.Close()
 
-	bzipReader := bzip2.NewReader(input)
+	release, err := b.MemoryGuard.Reserve(ctx, expand.BufferSize+decoderMemory)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	start := time.Now()
+
+	bzipReader := bzip2.NewReader(helpers.NewContextReader(ctx, input))
 
 	// Ensure the parent directory of dst exists
 	if err := os.MkdirAll(dst, umask); err != nil {
-		return fmt.Errorf("failed to create directory %q: %w", filepath.Dir(dst), err)
+		return nil, fmt.Errorf("failed to create directory %q: %w", filepath.Dir(dst), err)
 	}
 
 	baseName := strings.TrimSuffix(filepath.Base(src), filepath.Ext(src))
+	if err := expand.SandboxFromContext(ctx).Require(metadata.SecurityTraceFromContext(ctx), baseName, false); err != nil {
+		return nil, err
+	}
 
 	fpath := filepath.Join(dst, baseName)
 	// Create or truncate the output file
 	outFile, err := os.OpenFile(fpath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
 	if err != nil {
-		return fmt.Errorf("failed to create file %q: %w", dst, err)
+		return nil, fmt.Errorf("failed to create file %q: %w", dst, err)
 	}
 	defer outFile.Close()
+	w, sum := expand.Hasher(faults.Writer(faults.FromContext(ctx), baseName, outFile))
 
-	const bufferSize = 32 * 1024 // 32 KB
-	buffer := make([]byte, bufferSize)
+	buffer := make([]byte, expand.BufferSize)
+	manifest := expand.NewManifest(dst)
+
+	if b.FileSizeLimit > 0 {
+		metadata.RecordCheck(ctx, metadata.SecurityCheck{Check: "size-limit", Subject: src, Outcome: metadata.CheckApplied, Detail: fmt.Sprintf("%d bytes", b.FileSizeLimit)})
+	}
 
 	// Track total decompressed size to avoid decompression bombs.
 	var totalBytes int64
 	for {
 		n, err := bzipReader.Read(buffer)
 		if n > 0 {
+			manifest.Stats.Buffered(n)
 			if totalBytes+int64(n) > b.FileSizeLimit && b.FileSizeLimit > 0 {
-				return fmt.Errorf("decompressed file exceeds size limit of %d bytes", b.FileSizeLimit)
+				metadata.RecordCheck(ctx, metadata.SecurityCheck{Check: "size-limit", Subject: src, Outcome: metadata.CheckRejected, Detail: fmt.Sprintf("decompressed size exceeds %d", b.FileSizeLimit)})
+				return nil, fmt.Errorf("%w: decompressed file exceeds size limit of %d bytes", expand.ErrSizeLimitExceeded, b.FileSizeLimit)
 			}
-			if _, writeErr := outFile.Write(buffer[:n]); writeErr != nil {
-				return fmt.Errorf("failed to write decompressed data: %w", writeErr)
+			if _, writeErr := w.Write(buffer[:n]); writeErr != nil {
+				return nil, fmt.Errorf("failed to write decompressed data: %w", writeErr)
 			}
 			totalBytes += int64(n)
 		}
@@ -88,18 +130,30 @@ func (b *Bzip2Expander) Expand(ctx context.Context, src, dst string, umask os.Fi
 			break
 		}
 		if err != nil {
-			return fmt.Errorf("error during decompression: %w", err)
+			return nil, fmt.Errorf("error during decompression: %w", err)
 		}
 	}
 
-	return nil
+	manifest.AddFile(fpath, totalBytes, 0644, sum)
+	manifest.Finish(time.Since(start))
+	return manifest, nil
+}
+
+// WithLimits returns a copy of b that enforces the file size of l. A bzip2
+// stream holds a single file, so l.Files does not apply.
+func (b *Bzip2Expander) WithLimits(l expand.Limits) expand.Expander {
+	c := *b
+	if l.FileSize != 0 {
+		c.FileSizeLimit = l.FileSize
+	}
+	return &c
 }
 
 // Matcher checks if the extension matches supported formats.
 func (b *Bzip2Expander) Matcher(extension string) bool {
-	return (strings.Contains(extension, "bz2") || strings.Contains(extension, "bzip2")) && !strings.Contains(extension, "tar")
+	return expand.HasExtension(extension, "bz2", "bzip2") && !expand.HasExtension(extension, "tar.bz2")
 }
 
 func init() {
-	expand.RegisterExpander(&Bzip2Expander{})
+	expand.RegisterFormat("bzip2", &Bzip2Expander{}, expand.DefaultPriority)
 }
@@ -19,12 +19,14 @@ package bzip2
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
 
+	"github.com/enterprise-contract/go-gather/expand"
 	"github.com/enterprise-contract/go-gather/internal/helpers"
 )
 
@@ -52,7 +54,11 @@ func TestBzip2Expander_Matcher(t *testing.T) {
 		{"tar.bz2 false", "archive.tar.bz2", false},
 		{"zip false", "file.zip", false},
 		{"bzip2-tar substring false", "something-bzip2.tar", false},
-		{"bzip2 random substring true", "something-bzip2", true},
+		{"bzip2 random substring false", "something-bzip2", false},
+		{"bzip2 format name", "bzip2", true},
+		{"bz2 inside name false", "notes.bz2.txt", false},
+		{"bz2 with query", "https://example.com/data.bz2?sig=abc", true},
+		{"upper case", "FILE.BZ2", true},
 	}
 
 	for _, tc := range tests {
@@ -76,10 +82,13 @@ func TestBzip2Expander_Expand(t *testing.T) {
 		bz2Path := createBzip2Fixture(t)
 		dstDir := t.TempDir()
 
-		err := expander.Expand(ctx, bz2Path, dstDir, 0o755)
+		m, err := expander.Expand(ctx, bz2Path, dstDir, 0o755)
 		if err != nil {
 			t.Fatalf("Expand returned error, want=nil got=%v", err)
 		}
+		if len(m.Entries) != 1 || m.Entries[0].Size != int64(len("Hello Bzip2!")) {
+			t.Errorf("unexpected manifest entries: %+v", m.Entries)
+		}
 
 		expectedOutputFileName := strings.TrimSuffix(filepath.Base(bz2Path), filepath.Ext(bz2Path))
 		outFile := filepath.Join(dstDir, expectedOutputFileName)
@@ -119,7 +128,7 @@ func TestBzip2Expander_Expand(t *testing.T) {
 		invalidSrc := "~invalid_src"
 		dstDir := t.TempDir()
 
-		err := expander.Expand(ctx, invalidSrc, dstDir, 0o755)
+		_, err := expander.Expand(ctx, invalidSrc, dstDir, 0o755)
 		if err == nil {
 			t.Fatal("expected Expand to fail due to pathExpanderFunc error for source, got nil")
 		}
@@ -146,7 +155,7 @@ func TestBzip2Expander_Expand(t *testing.T) {
 		bz2Path := createBzip2Fixture(t)
 		invalidDst := "invalid_dst"
 
-		err := expander.Expand(ctx, bz2Path, filepath.Join(dst, invalidDst), 0o755)
+		_, err := expander.Expand(ctx, bz2Path, filepath.Join(dst, invalidDst), 0o755)
 		if err == nil {
 			t.Fatal("expected Expand to fail due to pathExpanderFunc error for destination, got nil")
 		}
@@ -162,7 +171,7 @@ func TestBzip2Expander_Expand(t *testing.T) {
 		nonExistentSrc := filepath.Join(t.TempDir(), "nonexistent.bz2")
 		dstDir := t.TempDir()
 
-		err := expander.Expand(ctx, nonExistentSrc, dstDir, 0o755)
+		_, err := expander.Expand(ctx, nonExistentSrc, dstDir, 0o755)
 		if err == nil {
 			t.Fatal("expected Expand to fail due to non-existent source file, got nil")
 		}
@@ -182,7 +191,7 @@ func TestBzip2Expander_Expand(t *testing.T) {
 			t.Fatalf("failed to create read-only directory: %v", err)
 		}
 
-		err := expander.Expand(ctx, bz2Path, readOnlyDir, 0o755)
+		_, err := expander.Expand(ctx, bz2Path, readOnlyDir, 0o755)
 		if err == nil {
 			t.Fatal("expected Expand to fail due to inability to create files in read-only directory, got nil")
 		}
@@ -201,13 +210,16 @@ func TestBzip2Expander_Expand(t *testing.T) {
 		bz2Path := createBzip2Fixture(t)
 		dstDir := t.TempDir()
 
-		err := smallExpander.Expand(ctx, bz2Path, dstDir, 0o755)
+		_, err := smallExpander.Expand(ctx, bz2Path, dstDir, 0o755)
 		if err == nil {
 			t.Fatal("expected Expand to fail due to size limit exceeded, got nil")
 		}
 		if !strings.Contains(err.Error(), "exceeds size limit") {
 			t.Errorf("unexpected error message: %v", err)
 		}
+		if !errors.Is(err, expand.ErrSizeLimitExceeded) {
+			t.Errorf("expected expand.ErrSizeLimitExceeded, got %v", err)
+		}
 	})
 
 	// Negative Test: Corrupt bzip2 data
@@ -223,7 +235,7 @@ func TestBzip2Expander_Expand(t *testing.T) {
 
 		dstDir := t.TempDir()
 
-		err := expander.Expand(ctx, corruptBZ2Path, dstDir, 0o755)
+		_, err := expander.Expand(ctx, corruptBZ2Path, dstDir, 0o755)
 		if err == nil {
 			t.Fatal("expected Expand to fail due to corrupt bzip2 data, got nil")
 		}
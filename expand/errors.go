@@ -0,0 +1,114 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package expand
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/enterprise-contract/go-gather/internal/multierr"
+)
+
+// ErrSizeLimitExceeded is matched by the errors of expansions stopped as
+// what they extract grew larger than allowed.
+var ErrSizeLimitExceeded = errors.New("size limit exceeded")
+
+// ErrIntegrity is matched, using errors.Is, by every IntegrityError.
+var ErrIntegrity = errors.New("integrity check failed")
+
+// IntegrityError reports archive content that does not match the checksum
+// recorded for it, such as a zip entry CRC-32 or a gzip trailer.
+type IntegrityError struct {
+	// Entry is the archive entry that failed the check. It is empty for
+	// checks covering a whole stream, such as a gzip trailer.
+	Entry string
+	// Check names the checksum algorithm, e.g. "crc32".
+	Check string
+	// Expected and Actual are the hex encoded checksums when known.
+	Expected string
+	Actual   string
+	Err      error
+}
+
+func (e *IntegrityError) Error() string {
+	subject := "gzip trailer"
+	if e.Entry != "" {
+		subject = fmt.Sprintf("entry %q", e.Entry)
+	}
+	if e.Expected != "" || e.Actual != "" {
+		return fmt.Sprintf("%s mismatch for %s: expected %s, got %s", e.Check, subject, e.Expected, e.Actual)
+	}
+	return fmt.Sprintf("%s mismatch for %s", e.Check, subject)
+}
+
+func (e *IntegrityError) Is(target error) bool {
+	return target == ErrIntegrity
+}
+
+func (e *IntegrityError) Unwrap() error {
+	return e.Err
+}
+
+// EntryError is a failure to extract a single archive entry.
+type EntryError struct {
+	// Entry is the name of the entry as recorded in the archive.
+	Entry string
+	Err   error
+}
+
+func (e *EntryError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Entry, e.Err)
+}
+
+func (e *EntryError) Unwrap() error {
+	return e.Err
+}
+
+// EntryErrors collects the entries that failed during an expansion run with
+// ContinueOnError set. It is returned alongside the manifest of the entries
+// that were extracted successfully.
+type EntryErrors []*EntryError
+
+func (e EntryErrors) Error() string {
+	return multierr.Format(fmt.Sprintf("%d entries failed to extract", len(e)), e)
+}
+
+func (e EntryErrors) Unwrap() []error {
+	errs := make([]error, 0, len(e))
+	for _, err := range e {
+		errs = append(errs, err)
+	}
+	return errs
+}
+
+// Collect records err against entry when continueOnError is set and returns
+// nil so extraction can move on. Otherwise it returns err unchanged.
+func (e *EntryErrors) Collect(entry string, err error, continueOnError bool) error {
+	if err == nil || !continueOnError {
+		return err
+	}
+	*e = append(*e, &EntryError{Entry: entry, Err: err})
+	return nil
+}
+
+// Err returns the collected errors, or nil if no entry failed.
+func (e EntryErrors) Err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
@@ -0,0 +1,59 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package expand
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEntryErrors_Collect(t *testing.T) {
+	var errs EntryErrors
+	boom := errors.New("boom")
+
+	assert.Equal(t, boom, errs.Collect("a.txt", boom, false))
+	assert.Nil(t, errs.Err())
+
+	assert.NoError(t, errs.Collect("a.txt", boom, true))
+	assert.NoError(t, errs.Collect("b.txt", os.ErrPermission, true))
+	assert.NoError(t, errs.Collect("c.txt", nil, true))
+
+	err := errs.Err()
+	assert.Error(t, err)
+	assert.Len(t, errs, 2)
+	assert.Equal(t, "2 entries failed to extract: a.txt: boom; b.txt: permission denied", err.Error())
+	assert.ErrorIs(t, err, boom)
+	assert.ErrorIs(t, err, os.ErrPermission)
+
+	var entryErr *EntryError
+	assert.True(t, errors.As(err, &entryErr))
+	assert.Equal(t, "a.txt", entryErr.Entry)
+}
+
+func TestIntegrityError(t *testing.T) {
+	err := error(&IntegrityError{Entry: "a.txt", Check: "crc32", Expected: "0000002a", Actual: "00000000", Err: os.ErrInvalid})
+	assert.Equal(t, `crc32 mismatch for entry "a.txt": expected 0000002a, got 00000000`, err.Error())
+	assert.ErrorIs(t, err, ErrIntegrity)
+	assert.ErrorIs(t, err, os.ErrInvalid)
+
+	err = &IntegrityError{Check: "crc32"}
+	assert.Equal(t, "crc32 mismatch for gzip trailer", err.Error())
+	assert.ErrorIs(t, err, ErrIntegrity)
+}
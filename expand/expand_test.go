@@ -22,6 +22,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
 )
 
@@ -30,9 +31,9 @@ type mockExpander struct {
 	keyword string
 }
 
-func (m *mockExpander) Expand(ctx context.Context, source, destination string, umask os.FileMode) error {
+func (m *mockExpander) Expand(ctx context.Context, source, destination string, umask os.FileMode) (*Manifest, error) {
 	// no-op
-	return nil
+	return NewManifest(destination), nil
 }
 
 func (m *mockExpander) Matcher(extension string) bool {
@@ -42,7 +43,7 @@ func (m *mockExpander) Matcher(extension string) bool {
 // TestRegisterAndGetExpander ensures we can register and retrieve an expander via GetExpander.
 func TestRegisterAndGetExpander(t *testing.T) {
 	oldExpanders := expanders
-	expanders = nil
+	expanders = NewRegistry()
 	defer func() { expanders = oldExpanders }()
 
 	mockFoo := &mockExpander{keyword: "foo"}
@@ -63,6 +64,134 @@ func TestRegisterAndGetExpander(t *testing.T) {
 	}
 }
 
+// TestGetExpander_Priority ensures a higher priority expander takes precedence
+// over one registered earlier, and that equal priorities keep registration order.
+func TestGetExpander_Priority(t *testing.T) {
+	oldExpanders := expanders
+	expanders = NewRegistry()
+	defer func() { expanders = oldExpanders }()
+
+	builtin := &mockExpander{keyword: "foo"}
+	second := &mockExpander{keyword: "foo"}
+	custom := &mockExpander{keyword: "foo"}
+
+	RegisterFormat("foo", builtin, DefaultPriority)
+	RegisterExpander(second)
+	if got := GetExpander("my.foo"); got != builtin {
+		t.Errorf("expected builtin, got %#v", got)
+	}
+
+	RegisterFormat("foo", custom, DefaultPriority+10)
+	if got := GetExpander("my.foo"); got != custom {
+		t.Errorf("expected custom, got %#v", got)
+	}
+	if got := GetExpanderByFormat("foo"); got != custom {
+		t.Errorf("expected custom by format, got %#v", got)
+	}
+}
+
+// TestGetExpanderByFormat ensures lookups by format name ignore Matcher and
+// expanders registered without a format.
+func TestGetExpanderByFormat(t *testing.T) {
+	oldExpanders := expanders
+	expanders = NewRegistry()
+	defer func() { expanders = oldExpanders }()
+
+	unnamed := &mockExpander{keyword: "foo"}
+	named := &mockExpander{keyword: "bar"}
+	RegisterExpander(unnamed)
+	RegisterFormat("foo", named, DefaultPriority)
+
+	if got := GetExpanderByFormat("foo"); got != named {
+		t.Errorf("expected named, got %#v", got)
+	}
+	if got := GetExpanderByFormat(""); got != nil {
+		t.Errorf("expected nil for empty format, got %#v", got)
+	}
+	if got := GetExpanderByFormat("zip"); got != nil {
+		t.Errorf("expected nil, got %#v", got)
+	}
+}
+
+// TestReplaceExpander ensures a registered format can be swapped out and that
+// replacing an unknown format registers it.
+func TestReplaceExpander(t *testing.T) {
+	oldExpanders := expanders
+	expanders = NewRegistry()
+	defer func() { expanders = oldExpanders }()
+
+	builtin := &mockExpander{keyword: "foo"}
+	replacement := &mockExpander{keyword: "foo"}
+	RegisterFormat("foo", builtin, DefaultPriority)
+
+	if previous := ReplaceExpander("foo", replacement); previous != builtin {
+		t.Errorf("expected builtin to be returned, got %#v", previous)
+	}
+	if got := GetExpander("my.foo"); got != replacement {
+		t.Errorf("expected replacement, got %#v", got)
+	}
+	if got := GetExpanderByFormat("foo"); got != replacement {
+		t.Errorf("expected replacement by format, got %#v", got)
+	}
+
+	added := &mockExpander{keyword: "bar"}
+	if previous := ReplaceExpander("bar", added); previous != nil {
+		t.Errorf("expected nil, got %#v", previous)
+	}
+	if got := GetExpanderByFormat("bar"); got != added {
+		t.Errorf("expected added, got %#v", got)
+	}
+}
+
+// TestDeregister ensures expanders can be removed by identity and by format.
+func TestDeregister(t *testing.T) {
+	r := NewRegistry()
+	foo := &mockExpander{keyword: "foo"}
+	bar := &mockExpander{keyword: "bar"}
+	r.RegisterExpander(foo)
+	r.RegisterFormat("bar", bar, DefaultPriority)
+
+	if !r.DeregisterExpander(foo) {
+		t.Error("expected foo to be deregistered")
+	}
+	if r.DeregisterExpander(foo) {
+		t.Error("expected foo to be gone already")
+	}
+	if got := r.GetExpander("my.foo"); got != nil {
+		t.Errorf("expected nil, got %#v", got)
+	}
+
+	if !r.DeregisterFormat("bar") {
+		t.Error("expected bar to be deregistered")
+	}
+	if got := r.GetExpanderByFormat("bar"); got != nil {
+		t.Errorf("expected nil, got %#v", got)
+	}
+}
+
+// TestRegistryConcurrentUse exercises the registry from many goroutines; run
+// with -race to detect unsynchronized access.
+func TestRegistryConcurrentUse(t *testing.T) {
+	r := NewRegistry()
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			e := &mockExpander{keyword: "foo"}
+			r.RegisterFormat("foo", e, i)
+			r.ReplaceExpander("foo", e)
+			r.DeregisterExpander(e)
+		}()
+		go func() {
+			defer wg.Done()
+			_ = r.GetExpander("my.foo")
+			_ = r.GetExpanderByFormat("foo")
+		}()
+	}
+	wg.Wait()
+}
+
 // TestIsCompressedFile checks that known magic numbers are correctly recognized.
 func TestIsCompressedFile(t *testing.T) {
 	tests := []struct {
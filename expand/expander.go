@@ -23,30 +23,213 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"sort"
+	"sync"
 )
 
 /* package expander provides an interface for expanders to implement. Expanders are used to expand compressed files. */
 
+// Expander extracts archives of the formats it matches. Implementations must
+// be safe for concurrent use: a registered instance serves every gather of
+// the process, so Expand keeps its state in the call and never writes to the
+// expander. Settings for a particular expansion are applied to a copy, see
+// HiddenExcluder and Limiter, and an instance must not be modified once
+// registered.
 type Expander interface {
-	Expand(ctx context.Context, source string, destination string, umask os.FileMode) error
+	// Expand extracts source into destination and returns a manifest of
+	// every file and directory written.
+	Expand(ctx context.Context, source string, destination string, umask os.FileMode) (*Manifest, error)
 	Matcher(extension string) bool
 }
 
-var expanders []Expander
+// Lister is implemented by expanders that can enumerate the entries of an
+// archive without extracting it. Entries are listed as Expand would record
+// them in its manifest.
+type Lister interface {
+	List(ctx context.Context, source string) ([]ManifestEntry, error)
+}
+
+// ErrEntryNotFound is returned by ExtractEntry when the archive has no file
+// of the given name.
+var ErrEntryNotFound = errors.New("entry not found in archive")
+
+// EntryExtractor is implemented by expanders that can extract a single file
+// of an archive without extracting the rest. The name is matched against the
+// paths Expand would record in its manifest.
+type EntryExtractor interface {
+	// ExtractEntry writes the contents of the file name in the archive
+	// source to w and returns the number of bytes written.
+	ExtractEntry(ctx context.Context, source, name string, w io.Writer) (int64, error)
+}
+
+// DefaultPriority is the priority of expanders registered through
+// RegisterExpander. The built-in expanders use it as well, so any expander
+// registered with a higher priority takes precedence over them.
+const DefaultPriority = 0
+
+// registration is an expander together with the format it handles and the
+// priority it was registered with.
+type registration struct {
+	format   string
+	priority int
+	expander Expander
+}
+
+// Registry holds a set of expanders. It is safe for concurrent use. The
+// package-level functions operate on a process-wide registry that the
+// built-in expanders add themselves to; a separate Registry allows tests and
+// embedders to work with an isolated set.
+type Registry struct {
+	mu sync.RWMutex
+	// expanders is kept ordered by descending priority. Expanders of equal
+	// priority stay in registration order.
+	expanders []registration
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+var expanders = NewRegistry()
 
 type ExpandOptions struct{}
 
-func GetExpander(extension string) Expander {
-	for _, expander := range expanders {
-		if expander.Matcher(extension) {
-			return expander
+// GetExpander returns the highest priority expander whose Matcher accepts
+// extension, or nil if there is none.
+func (r *Registry) GetExpander(extension string) Expander {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, reg := range r.expanders {
+		if reg.expander.Matcher(extension) {
+			return reg.expander
 		}
 	}
 	return nil
 }
 
+// GetExpanderByFormat returns the highest priority expander registered for
+// the named format, e.g. "tar" or "zip", or nil if there is none.
+func (r *Registry) GetExpanderByFormat(format string) Expander {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, reg := range r.expanders {
+		if reg.format != "" && reg.format == format {
+			return reg.expander
+		}
+	}
+	return nil
+}
+
+// RegisterExpander registers e with DefaultPriority and no format name.
+func (r *Registry) RegisterExpander(e Expander) {
+	r.RegisterFormat("", e, DefaultPriority)
+}
+
+// RegisterFormat registers e as an expander for format with the given
+// priority. Lookups consult expanders with a higher priority first.
+func (r *Registry) RegisterFormat(format string, e Expander, priority int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.add(registration{format: format, priority: priority, expander: e})
+}
+
+// ReplaceExpander swaps every expander registered for format with e, keeping
+// their priorities, and returns the one GetExpanderByFormat returned before.
+// If no expander is registered for format, e is registered with
+// DefaultPriority and nil is returned.
+func (r *Registry) ReplaceExpander(format string, e Expander) Expander {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var previous Expander
+	for i, reg := range r.expanders {
+		if reg.format != "" && reg.format == format {
+			if previous == nil {
+				previous = reg.expander
+			}
+			r.expanders[i].expander = e
+		}
+	}
+	if previous == nil {
+		r.add(registration{format: format, priority: DefaultPriority, expander: e})
+	}
+	return previous
+}
+
+// DeregisterExpander removes every registration of e and reports whether
+// there were any.
+func (r *Registry) DeregisterExpander(e Expander) bool {
+	return r.remove(func(reg registration) bool { return reg.expander == e })
+}
+
+// DeregisterFormat removes every expander registered for format and reports
+// whether there were any.
+func (r *Registry) DeregisterFormat(format string) bool {
+	return r.remove(func(reg registration) bool { return reg.format != "" && reg.format == format })
+}
+
+// add inserts reg keeping the expanders ordered by priority. The caller must
+// hold the write lock.
+func (r *Registry) add(reg registration) {
+	r.expanders = append(r.expanders, reg)
+	sort.SliceStable(r.expanders, func(i, j int) bool {
+		return r.expanders[i].priority > r.expanders[j].priority
+	})
+}
+
+func (r *Registry) remove(match func(registration) bool) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	kept := r.expanders[:0:0]
+	for _, reg := range r.expanders {
+		if !match(reg) {
+			kept = append(kept, reg)
+		}
+	}
+	removed := len(kept) != len(r.expanders)
+	r.expanders = kept
+	return removed
+}
+
+// GetExpander returns the highest priority expander in the default registry
+// whose Matcher accepts extension, or nil if there is none.
+func GetExpander(extension string) Expander {
+	return expanders.GetExpander(extension)
+}
+
+// GetExpanderByFormat returns the highest priority expander in the default
+// registry registered for the named format, or nil if there is none.
+func GetExpanderByFormat(format string) Expander {
+	return expanders.GetExpanderByFormat(format)
+}
+
+// RegisterExpander adds e to the default registry with DefaultPriority and no
+// format name.
 func RegisterExpander(e Expander) {
-	expanders = append(expanders, e)
+	expanders.RegisterExpander(e)
+}
+
+// RegisterFormat adds e to the default registry as an expander for format
+// with the given priority.
+func RegisterFormat(format string, e Expander, priority int) {
+	expanders.RegisterFormat(format, e, priority)
+}
+
+// ReplaceExpander swaps the expanders registered for format in the default
+// registry with e. See Registry.ReplaceExpander.
+func ReplaceExpander(format string, e Expander) Expander {
+	return expanders.ReplaceExpander(format, e)
+}
+
+// DeregisterExpander removes e from the default registry.
+func DeregisterExpander(e Expander) bool {
+	return expanders.DeregisterExpander(e)
+}
+
+// DeregisterFormat removes the expanders registered for format from the
+// default registry.
+func DeregisterFormat(format string) bool {
+	return expanders.DeregisterFormat(format)
 }
 
 // Known magic numbers for common compressed file formats
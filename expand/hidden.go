@@ -0,0 +1,76 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package expand
+
+import (
+	"path"
+	"slices"
+	"strings"
+)
+
+// HiddenFiles selects hidden files and directories, those whose names start
+// with a dot, to leave out of a gather or an extraction. Everything below an
+// excluded directory is left out with it. The zero value keeps everything.
+type HiddenFiles struct {
+	// All leaves out every hidden file and directory.
+	All bool
+	// Names leaves out the files and directories with one of these names
+	// wherever they are in the tree, e.g. ".git" and ".github".
+	Names []string
+}
+
+// ExcludeGitFiles leaves out git metadata and GitHub configuration, which
+// policy consumers rarely want copied into their workspaces.
+var ExcludeGitFiles = HiddenFiles{Names: []string{".git", ".github"}}
+
+// IsZero reports whether h keeps everything.
+func (h HiddenFiles) IsZero() bool {
+	return !h.All && len(h.Names) == 0
+}
+
+// Excludes reports whether the slash-separated path p, relative to the root
+// of the tree, is left out, either itself or as part of an excluded
+// directory.
+func (h HiddenFiles) Excludes(p string) bool {
+	if h.IsZero() {
+		return false
+	}
+	for _, name := range strings.Split(path.Clean(p), "/") {
+		if h.excludesName(name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h HiddenFiles) excludesName(name string) bool {
+	if name == "." || name == ".." {
+		return false
+	}
+	if h.All && strings.HasPrefix(name, ".") {
+		return true
+	}
+	return slices.Contains(h.Names, name)
+}
+
+// HiddenExcluder is implemented by expanders that can leave hidden files out
+// of what they extract.
+type HiddenExcluder interface {
+	// WithHiddenFiles returns a copy of the expander that leaves out the
+	// hidden files selected by h.
+	WithHiddenFiles(h HiddenFiles) Expander
+}
@@ -0,0 +1,46 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package expand
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHiddenFiles_Excludes(t *testing.T) {
+	tests := []struct {
+		name   string
+		hidden HiddenFiles
+		path   string
+		want   bool
+	}{
+		{"zero value keeps everything", HiddenFiles{}, ".git/config", false},
+		{"all hidden file", HiddenFiles{All: true}, ".env", true},
+		{"all hidden directory contents", HiddenFiles{All: true}, "policy/.cache/data.json", true},
+		{"all regular file", HiddenFiles{All: true}, "policy/main.rego", false},
+		{"all leading dot segment", HiddenFiles{All: true}, "./policy/main.rego", false},
+		{"named directory", ExcludeGitFiles, ".git/config", true},
+		{"named nested directory", ExcludeGitFiles, "sub/.github/workflows/ci.yaml", true},
+		{"unnamed hidden file", ExcludeGitFiles, ".gitignore", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.hidden.Excludes(tt.path))
+		})
+	}
+}
@@ -0,0 +1,79 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build go1.23
+
+package expand
+
+import (
+	"context"
+	"fmt"
+	"iter"
+)
+
+// EntryStreamer is implemented by expanders that can stream the entries of
+// an archive, as Lister would list them, one at a time. Stopping the
+// iteration early stops reading the archive.
+type EntryStreamer interface {
+	Entries(ctx context.Context, source string) iter.Seq2[ManifestEntry, error]
+}
+
+// EntrySeq returns an iterator over the entries walk calls its function
+// with. An error returned by walk is yielded last, with a zero entry, unless
+// the iteration was stopped before.
+func EntrySeq(walk func(fn func(ManifestEntry) bool) error) iter.Seq2[ManifestEntry, error] {
+	return func(yield func(ManifestEntry, error) bool) {
+		stopped := false
+		err := walk(func(e ManifestEntry) bool {
+			stopped = !yield(e, nil)
+			return !stopped
+		})
+		if err != nil && !stopped {
+			yield(ManifestEntry{}, err)
+		}
+	}
+}
+
+// Entries returns an iterator over the entries of the archive source, read
+// with e. An expander that cannot stream entries but can list them has its
+// listing iterated over.
+func Entries(ctx context.Context, e Expander, source string) iter.Seq2[ManifestEntry, error] {
+	switch e := e.(type) {
+	case EntryStreamer:
+		return e.Entries(ctx, source)
+	case Lister:
+		return EntrySeq(func(fn func(ManifestEntry) bool) error {
+			entries, err := e.List(ctx, source)
+			for _, entry := range entries {
+				if !fn(entry) {
+					break
+				}
+			}
+			return err
+		})
+	}
+	return func(yield func(ManifestEntry, error) bool) {
+		yield(ManifestEntry{}, fmt.Errorf("cannot list the entries of %s: %T is not a Lister", source, e))
+	}
+}
+
+// DirEntries returns an iterator over the tree under root, such as a
+// gathered repository, yielding the entries ScanDir would list.
+func DirEntries(ctx context.Context, root string) iter.Seq2[ManifestEntry, error] {
+	return EntrySeq(func(fn func(ManifestEntry) bool) error {
+		return walkDir(ctx, root, fn)
+	})
+}
@@ -0,0 +1,120 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build go1.23
+
+package expand
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestEntrySeq(t *testing.T) {
+	boom := errors.New("boom")
+	walk := func(fn func(ManifestEntry) bool) error {
+		for _, p := range []string{"a", "b", "c"} {
+			if !fn(ManifestEntry{Path: p}) {
+				return nil
+			}
+		}
+		return boom
+	}
+
+	var paths []string
+	var gotErr error
+	for e, err := range EntrySeq(walk) {
+		if err != nil {
+			gotErr = err
+			continue
+		}
+		paths = append(paths, e.Path)
+	}
+	if len(paths) != 3 || !errors.Is(gotErr, boom) {
+		t.Errorf("expected 3 entries and the walk error, got %v, %v", paths, gotErr)
+	}
+
+	// The error of a walk stopped early is not yielded after the stop
+	paths = nil
+	for e, err := range EntrySeq(func(fn func(ManifestEntry) bool) error {
+		fn(ManifestEntry{Path: "a"})
+		return boom
+	}) {
+		if err != nil {
+			t.Fatalf("unexpected error after stopping: %v", err)
+		}
+		paths = append(paths, e.Path)
+		break
+	}
+	if len(paths) != 1 {
+		t.Errorf("expected 1 entry, got %v", paths)
+	}
+}
+
+type listOnly struct{ *mockExpander }
+
+func (listOnly) List(ctx context.Context, source string) ([]ManifestEntry, error) {
+	return []ManifestEntry{{Path: "a"}, {Path: "b"}}, nil
+}
+
+func TestEntries(t *testing.T) {
+	var paths []string
+	for e, err := range Entries(context.Background(), listOnly{&mockExpander{}}, "archive") {
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		paths = append(paths, e.Path)
+	}
+	if len(paths) != 2 {
+		t.Errorf("expected the listing to be iterated over, got %v", paths)
+	}
+
+	for _, err := range Entries(context.Background(), &mockExpander{}, "archive") {
+		if err == nil {
+			t.Error("expected an error for an expander that cannot list entries")
+		}
+	}
+}
+
+func TestDirEntries(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "dir"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "dir", "a.txt"), []byte("a"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	m, err := ScanDir(context.Background(), root)
+	if err != nil {
+		t.Fatalf("ScanDir returned an error: %v", err)
+	}
+	var i int
+	for e, err := range DirEntries(context.Background(), root) {
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if e != m.Entries[i] {
+			t.Errorf("entry %d: expected %+v, got %+v", i, m.Entries[i], e)
+		}
+		i++
+	}
+	if i != len(m.Entries) {
+		t.Errorf("expected %d entries, got %d", len(m.Entries), i)
+	}
+}
@@ -0,0 +1,40 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package expand
+
+// Limits bounds what a single expansion may extract. Zero fields leave the
+// corresponding limit unset.
+type Limits struct {
+	// FileSize is the largest size, in bytes, of any extracted file.
+	FileSize int64
+	// Files is the largest number of files extracted.
+	Files int
+}
+
+// IsZero reports whether l sets no limit.
+func (l Limits) IsZero() bool {
+	return l.FileSize == 0 && l.Files == 0
+}
+
+// Limiter is implemented by expanders that enforce Limits. Expanders shared
+// through a Registry must not be mutated while in use, so limits for a
+// particular gather are applied to a copy.
+type Limiter interface {
+	// WithLimits returns a copy of the expander that enforces l. Zero fields
+	// of l keep the limits of the expander.
+	WithLimits(l Limits) Expander
+}
@@ -0,0 +1,251 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package expand
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/enterprise-contract/go-gather/internal/helpers"
+	"github.com/enterprise-contract/go-gather/metadata"
+)
+
+// Manifest lists everything an expansion wrote to disk so callers can verify
+// and audit the result.
+type Manifest struct {
+	// Root is the destination directory the entries are relative to.
+	Root    string
+	Entries []ManifestEntry
+	// Streamed is set when the expansion ran in streaming mode, which
+	// leaves Entries and Skipped empty so that memory use does not grow
+	// with the size of the archive. The entries are only counted in Stats.
+	Streamed bool
+	// Salvage is set when the archive was extracted in salvage mode.
+	Salvage *SalvageReport
+	// Warnings describes changes made to the archive's contents while
+	// extracting them, such as entry names being normalized.
+	Warnings []string
+	// Skipped lists the entries of the archive that were left out, and why.
+	Skipped []metadata.SkippedEntry
+	// Stats describes the work done by the expansion.
+	Stats Stats
+}
+
+// SalvageReport summarizes an extraction of a damaged archive.
+type SalvageReport struct {
+	// Recovered is the number of entries extracted intact.
+	Recovered int
+	// Skipped is the number of entries, or damaged regions where entry
+	// boundaries could not be determined, that had to be passed over.
+	Skipped int
+}
+
+// ManifestEntry describes a single extracted file or directory.
+type ManifestEntry struct {
+	// Path is the slash-separated path of the entry relative to Root.
+	Path string      `json:"path"`
+	Size int64       `json:"size,omitempty"`
+	Mode os.FileMode `json:"mode"`
+	// SHA256 is the hex encoded digest of the file contents. It is empty for
+	// directories.
+	SHA256 string `json:"sha256,omitempty"`
+	// Target is the slash-separated target of a symbolic link. It is empty
+	// for other entries.
+	Target string `json:"target,omitempty"`
+}
+
+// NewManifest returns an empty manifest for entries extracted under root.
+func NewManifest(root string) *Manifest {
+	return &Manifest{Root: root}
+}
+
+// ScanDir returns a manifest of the tree already on disk under root, listing
+// directories, regular files and symbolic links, with their targets, in
+// lexical order.
+func ScanDir(ctx context.Context, root string) (*Manifest, error) {
+	m := NewManifest(root)
+	err := walkDir(ctx, root, func(e ManifestEntry) bool {
+		m.add(e)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// walkDir calls fn with each entry ScanDir lists, in order, until fn
+// returns false.
+func walkDir(ctx context.Context, root string, fn func(ManifestEntry) bool) error {
+	m := NewManifest(root)
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path == root {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		e := ManifestEntry{Path: m.rel(path), Mode: info.Mode()}
+		switch {
+		case info.Mode().IsRegular():
+			e.Size = info.Size()
+			if e.SHA256, err = fileSHA256(ctx, path); err != nil {
+				return err
+			}
+		case info.Mode()&fs.ModeSymlink != 0:
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			e.Target = filepath.ToSlash(target)
+		}
+		if !fn(e) {
+			return filepath.SkipAll
+		}
+		return nil
+	})
+}
+
+// NewStreamingManifest returns a manifest for entries extracted under root
+// in streaming mode, which counts the entries rather than listing them.
+func NewStreamingManifest(root string) *Manifest {
+	return &Manifest{Root: root, Streamed: true}
+}
+
+// AddDir records a directory created at path.
+func (m *Manifest) AddDir(path string, mode os.FileMode) {
+	m.add(ManifestEntry{
+		Path: m.rel(path),
+		Mode: mode | os.ModeDir,
+	})
+}
+
+// AddFile records a regular file written at path. The digest is normally
+// obtained from a Hasher wrapping the file's writer.
+func (m *Manifest) AddFile(path string, size int64, mode os.FileMode, sum hash.Hash) {
+	m.add(ManifestEntry{
+		Path:   m.rel(path),
+		Size:   size,
+		Mode:   mode,
+		SHA256: hex.EncodeToString(sum.Sum(nil)),
+	})
+}
+
+// add counts e in Stats, listing it unless the manifest is streamed.
+func (m *Manifest) add(e ManifestEntry) {
+	m.Stats.Entries++
+	m.Stats.Bytes += e.Size
+	if !m.Streamed {
+		m.Entries = append(m.Entries, e)
+	}
+}
+
+// AddSkipped records that the entry at the slash-separated path name was
+// left out for reason, one of the metadata.Skip constants.
+func (m *Manifest) AddSkipped(name, reason, detail string) {
+	m.Stats.Skipped++
+	if !m.Streamed {
+		m.Skipped = append(m.Skipped, metadata.SkippedEntry{Path: name, Reason: reason, Detail: detail})
+	}
+}
+
+// AddWarning records a warning about the extraction.
+func (m *Manifest) AddWarning(format string, args ...interface{}) {
+	m.Warnings = append(m.Warnings, fmt.Sprintf(format, args...))
+}
+
+// Verify re-reads every file in the manifest and checks its size and digest
+// against the recorded values.
+func (m *Manifest) Verify() error {
+	for _, e := range m.Entries {
+		path := filepath.Join(m.Root, filepath.FromSlash(e.Path))
+		info, err := os.Lstat(path)
+		if err != nil {
+			return fmt.Errorf("failed to stat %q: %w", e.Path, err)
+		}
+		if e.Mode.IsDir() {
+			if !info.IsDir() {
+				return fmt.Errorf("%q is no longer a directory", e.Path)
+			}
+			continue
+		}
+		if e.Mode&fs.ModeSymlink != 0 {
+			if info.Mode()&fs.ModeSymlink == 0 {
+				return fmt.Errorf("%q is no longer a symbolic link", e.Path)
+			}
+			target, err := os.Readlink(path)
+			if err != nil {
+				return fmt.Errorf("failed to read link %q: %w", e.Path, err)
+			}
+			if filepath.ToSlash(target) != e.Target {
+				return fmt.Errorf("%q target mismatch: expected %s, got %s", e.Path, e.Target, filepath.ToSlash(target))
+			}
+			continue
+		}
+		if info.Size() != e.Size {
+			return fmt.Errorf("%q size mismatch: expected %d, got %d", e.Path, e.Size, info.Size())
+		}
+		sum, err := fileSHA256(context.Background(), path)
+		if err != nil {
+			return err
+		}
+		if sum != e.SHA256 {
+			return fmt.Errorf("%q digest mismatch: expected %s, got %s", e.Path, e.SHA256, sum)
+		}
+	}
+	return nil
+}
+
+// Hasher returns a writer that writes to w while computing the SHA-256
+// digest of everything written, along with the running hash.
+func Hasher(w io.Writer) (io.Writer, hash.Hash) {
+	h := sha256.New()
+	return io.MultiWriter(w, h), h
+}
+
+func (m *Manifest) rel(path string) string {
+	rel, err := filepath.Rel(m.Root, path)
+	if err != nil {
+		rel = path
+	}
+	return filepath.ToSlash(rel)
+}
+
+func fileSHA256(ctx context.Context, path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open %q: %w", path, err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, helpers.NewContextReader(ctx, f)); err != nil {
+		return "", fmt.Errorf("failed to read %q: %w", path, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,123 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package expand
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeRecorded writes content to path through a Hasher and records it in m.
+func writeRecorded(t *testing.T, m *Manifest, path, content string) {
+	t.Helper()
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	w, sum := Hasher(f)
+	n, err := w.Write([]byte(content))
+	require.NoError(t, err)
+	m.AddFile(path, int64(n), 0644, sum)
+}
+
+func TestManifest_AddAndVerify(t *testing.T) {
+	root := t.TempDir()
+	m := NewManifest(root)
+
+	dir := filepath.Join(root, "sub")
+	require.NoError(t, os.Mkdir(dir, 0755))
+	m.AddDir(dir, 0755)
+	writeRecorded(t, m, filepath.Join(dir, "file.txt"), "hello")
+
+	want := sha256.Sum256([]byte("hello"))
+	require.Len(t, m.Entries, 2)
+	assert.Equal(t, "sub", m.Entries[0].Path)
+	assert.True(t, m.Entries[0].Mode.IsDir())
+	assert.Equal(t, "sub/file.txt", m.Entries[1].Path)
+	assert.Equal(t, int64(5), m.Entries[1].Size)
+	assert.Equal(t, os.FileMode(0644), m.Entries[1].Mode)
+	assert.Equal(t, hex.EncodeToString(want[:]), m.Entries[1].SHA256)
+
+	assert.NoError(t, m.Verify())
+}
+
+func TestManifest_VerifyDetectsTampering(t *testing.T) {
+	root := t.TempDir()
+	m := NewManifest(root)
+	path := filepath.Join(root, "file.txt")
+	writeRecorded(t, m, path, "hello")
+
+	require.NoError(t, os.WriteFile(path, []byte("HELLO"), 0644))
+	err := m.Verify()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "digest mismatch")
+
+	require.NoError(t, os.WriteFile(path, []byte("hi"), 0644))
+	err = m.Verify()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "size mismatch")
+
+	require.NoError(t, os.Remove(path))
+	assert.Error(t, m.Verify())
+}
+
+func TestScanDir(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(root, "sub"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "sub", "file.txt"), []byte("hello"), 0644))
+
+	m, err := ScanDir(context.Background(), root)
+	require.NoError(t, err)
+	require.Len(t, m.Entries, 2)
+	assert.Equal(t, "sub", m.Entries[0].Path)
+	assert.True(t, m.Entries[0].Mode.IsDir())
+	assert.Equal(t, "sub/file.txt", m.Entries[1].Path)
+	assert.Equal(t, int64(5), m.Entries[1].Size)
+	require.NoError(t, m.Verify())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = ScanDir(ctx, root)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestScanDir_Symlink(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "file.txt"), []byte("hello"), 0644))
+	require.NoError(t, os.Symlink("file.txt", filepath.Join(root, "link")))
+
+	m, err := ScanDir(context.Background(), root)
+	require.NoError(t, err)
+	require.Len(t, m.Entries, 2)
+	assert.Equal(t, "link", m.Entries[1].Path)
+	assert.Equal(t, "file.txt", m.Entries[1].Target)
+	require.NoError(t, m.Verify())
+
+	// A link pointing elsewhere no longer verifies
+	require.NoError(t, os.Remove(filepath.Join(root, "link")))
+	require.NoError(t, os.Symlink("../evil.rego", filepath.Join(root, "link")))
+	err = m.Verify()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "target mismatch")
+}
@@ -0,0 +1,48 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package expand
+
+import (
+	"path"
+	"strings"
+)
+
+// BaseName returns the lower-cased final path element of name with any URL
+// query string or fragment removed, e.g. "https://host/Bundle.TGZ?sig=abc"
+// becomes "bundle.tgz".
+func BaseName(name string) string {
+	if i := strings.IndexAny(name, "?#"); i >= 0 {
+		name = name[:i]
+	}
+	name = strings.ReplaceAll(name, "\\", "/")
+	return strings.ToLower(path.Base(name))
+}
+
+// HasExtension reports whether the base name of name ends with one of the
+// given extension chains (without the leading dot, e.g. "tar.gz"), or is
+// exactly one of them. The latter allows expanders to be looked up by format
+// name as well as by file name.
+func HasExtension(name string, extensions ...string) bool {
+	base := BaseName(name)
+	for _, ext := range extensions {
+		ext = strings.ToLower(ext)
+		if base == ext || strings.HasSuffix(base, "."+ext) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,65 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package expand
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBaseName(t *testing.T) {
+	testCases := []struct {
+		name string
+		want string
+	}{
+		{"archive.tar.gz", "archive.tar.gz"},
+		{"/tmp/dir/Archive.TGZ", "archive.tgz"},
+		{"https://host/path/bundle.tgz?sig=abc", "bundle.tgz"},
+		{"https://host/path/bundle.zip#policy.rego", "bundle.zip"},
+		{`C:\downloads\bundle.zip`, "bundle.zip"},
+		{"tar", "tar"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, BaseName(tc.name))
+		})
+	}
+}
+
+func TestHasExtension(t *testing.T) {
+	testCases := []struct {
+		name       string
+		extensions []string
+		want       bool
+	}{
+		{"archive.tar.gz", []string{"tar.gz"}, true},
+		{"archive.tar.gz", []string{"gz"}, true},
+		{"archive.tar.gz", []string{"tar"}, false},
+		{"tarball-notes.txt", []string{"tar"}, false},
+		{"bundle.tgz?sig=abc", []string{"tgz"}, true},
+		{"/srv/tar/readme.md", []string{"tar"}, false},
+		{"tar", []string{"tar"}, true},
+		{"ARCHIVE.ZIP", []string{"zip"}, true},
+		{"mytar.gz", []string{"tar.gz"}, false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, HasExtension(tc.name, tc.extensions...))
+		})
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package expand
+
+import (
+	"fmt"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Normalization selects how expanders handle entry names that are not in
+// Unicode Normalization Form C. Archives created on macOS commonly store
+// names decomposed (NFD), which Linux treats as different from the composed
+// names other tools produce, so the same name can end up written twice.
+type Normalization int
+
+const (
+	// KeepNames writes entry names exactly as stored in the archive.
+	KeepNames Normalization = iota
+	// NormalizeNFC converts entry names to NFC before writing them. Every
+	// name that changes is reported in the manifest's Warnings.
+	NormalizeNFC
+	// RejectMixed fails the expansion when the archive mixes composed and
+	// decomposed names, or holds two entries whose names differ only in
+	// their normalization.
+	RejectMixed
+)
+
+// NameNormalizer applies a Normalization to the entry names of a single
+// archive.
+type NameNormalizer struct {
+	mode Normalization
+	// names maps the NFC form of each name seen to the name as stored.
+	names map[string]string
+	// composed and decomposed are the first names seen that are only valid
+	// in NFC and NFD respectively, so mixing can be reported.
+	composed, decomposed string
+}
+
+// NewNameNormalizer returns a normalizer for one archive.
+func NewNameNormalizer(mode Normalization) *NameNormalizer {
+	return &NameNormalizer{mode: mode, names: map[string]string{}}
+}
+
+// Normalize returns the name an entry stored as name should be written
+// under, recording a warning in m for every name that is changed or
+// collides with an earlier entry.
+func (n *NameNormalizer) Normalize(m *Manifest, name string) (string, error) {
+	if n == nil || n.mode == KeepNames {
+		return name, nil
+	}
+
+	nfc := norm.NFC.String(name)
+	previous, seen := n.names[nfc]
+	n.names[nfc] = name
+	collides := seen && previous != name
+
+	switch n.mode {
+	case NormalizeNFC:
+		if nfc != name {
+			m.AddWarning("normalized entry name %q to NFC", name)
+		}
+		if collides {
+			m.AddWarning("entry %q replaces %q, which has the same name once normalized", name, previous)
+		}
+		return nfc, nil
+	case RejectMixed:
+		if collides {
+			return "", fmt.Errorf("entries %q and %q differ only in their Unicode normalization", previous, name)
+		}
+		isNFC, isNFD := norm.NFC.IsNormalString(name), norm.NFD.IsNormalString(name)
+		if isNFC && !isNFD && n.composed == "" {
+			n.composed = name
+		}
+		if isNFD && !isNFC && n.decomposed == "" {
+			n.decomposed = name
+		}
+		if n.composed != "" && n.decomposed != "" {
+			return "", fmt.Errorf("archive mixes composed (%q) and decomposed (%q) Unicode names", n.composed, n.decomposed)
+		}
+		return name, nil
+	default:
+		return "", fmt.Errorf("unknown normalization %d", n.mode)
+	}
+}
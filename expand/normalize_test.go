@@ -0,0 +1,92 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package expand
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	composed   = "caf\u00e9.rego"  // é as a single code point
+	decomposed = "cafe\u0301.rego" // e followed by a combining acute accent
+)
+
+func TestNameNormalizer_KeepNames(t *testing.T) {
+	m := NewManifest("")
+	n := NewNameNormalizer(KeepNames)
+	for _, name := range []string{decomposed, composed} {
+		got, err := n.Normalize(m, name)
+		require.NoError(t, err)
+		assert.Equal(t, name, got)
+	}
+	assert.Empty(t, m.Warnings)
+}
+
+func TestNameNormalizer_NormalizeNFC(t *testing.T) {
+	m := NewManifest("")
+	n := NewNameNormalizer(NormalizeNFC)
+
+	got, err := n.Normalize(m, "dir/"+decomposed)
+	require.NoError(t, err)
+	assert.Equal(t, "dir/"+composed, got)
+
+	got, err = n.Normalize(m, "plain.rego")
+	require.NoError(t, err)
+	assert.Equal(t, "plain.rego", got)
+
+	got, err = n.Normalize(m, "dir/"+composed)
+	require.NoError(t, err)
+	assert.Equal(t, "dir/"+composed, got)
+
+	require.Len(t, m.Warnings, 2)
+	assert.Contains(t, m.Warnings[0], "normalized entry name")
+	assert.Contains(t, m.Warnings[1], "same name once normalized")
+}
+
+func TestNameNormalizer_RejectMixed(t *testing.T) {
+	testCases := []struct {
+		name    string
+		names   []string
+		wantErr string
+	}{
+		{"all composed", []string{composed, "plain.rego"}, ""},
+		{"all decomposed", []string{decomposed, "plain.rego"}, ""},
+		{"mixed", []string{composed, "na\u0303o.rego"}, "mixes composed"},
+		{"collision", []string{decomposed, composed}, "differ only in their Unicode normalization"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			n := NewNameNormalizer(RejectMixed)
+			var err error
+			for _, name := range tc.names {
+				var got string
+				if got, err = n.Normalize(NewManifest(""), name); err != nil {
+					break
+				}
+				assert.Equal(t, name, got)
+			}
+			if tc.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tc.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package expand
+
+import "github.com/enterprise-contract/go-gather/internal/helpers"
+
+// PathFilter selects the paths of a tree to copy by patterns written like
+// the lines of a .gitignore file, e.g. to leave node_modules directories or
+// test fixtures out of a large source tree:
+//
+//   - a pattern without a slash, such as "*.rego", matches names at any
+//     depth, while one with a slash, such as "/build" or "lib/*.rego", is
+//     relative to the root of the tree
+//   - a trailing slash, as in "testdata/", matches directories only
+//   - "**" matches any number of directories, as in "policy/**/*.rego"
+//   - a leading "!" negates the pattern, as in "!keep.log"
+//   - empty patterns and those starting with "#" are ignored
+//
+// The last pattern matching a path decides, and what is decided for a
+// directory holds for everything below it that is not matched itself. The
+// zero value selects every path.
+type PathFilter struct {
+	// Include selects the files to copy, every file when empty.
+	// Directories are descended into whether or not they match, as they
+	// may hold files that do.
+	Include []string
+	// Exclude leaves out the files and directories matching it, together
+	// with everything below the directories.
+	Exclude []string
+}
+
+// IsZero reports whether p selects every path.
+func (p PathFilter) IsZero() bool {
+	return helpers.PathFilter(p).IsZero()
+}
+
+// Validate returns an error if any pattern of p is malformed.
+func (p PathFilter) Validate() error {
+	return helpers.PathFilter(p).Validate()
+}
+
+// Excludes reports whether the file or, with dir, the directory at the
+// slash-separated path rel, relative to the root of the tree, is left out.
+func (p PathFilter) Excludes(rel string, dir bool) bool {
+	return helpers.PathFilter(p).Excludes(rel, dir)
+}
@@ -0,0 +1,181 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package expand
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/enterprise-contract/go-gather/metadata"
+)
+
+// ErrOutsideSandbox is returned when a gather or an extraction would write
+// outside the paths allowed by a Sandbox.
+var ErrOutsideSandbox = errors.New("write outside the sandbox")
+
+// Sandbox restricts the writes made below a destination to an allowlist of
+// path prefixes. It defends against misconfigured subpath selections that
+// would otherwise spread content across the whole destination.
+type Sandbox struct {
+	// Allow lists the slash-separated paths, relative to the destination,
+	// that may be written to. A path allows itself and everything below it.
+	Allow []string
+	// Skip leaves entries outside the allowlist out, with a warning, instead
+	// of failing.
+	Skip bool
+}
+
+type sandboxKey struct{}
+
+// WithSandbox returns a context that restricts the writes of the gatherers
+// and expanders it is passed to with s.
+func WithSandbox(ctx context.Context, s Sandbox) context.Context {
+	return context.WithValue(ctx, sandboxKey{}, &s)
+}
+
+// WithoutSandbox returns a context that lifts the sandbox of ctx, for
+// writes to staging areas that are checked when copied to the destination.
+func WithoutSandbox(ctx context.Context) context.Context {
+	return context.WithValue(ctx, sandboxKey{}, (*Sandbox)(nil))
+}
+
+// SandboxFromContext returns the sandbox carried by ctx, or nil.
+func SandboxFromContext(ctx context.Context) *Sandbox {
+	s, _ := ctx.Value(sandboxKey{}).(*Sandbox)
+	return s
+}
+
+// Permits reports whether the slash-separated path rel, relative to the
+// destination, may be written. Directories leading to an allowed path are
+// permitted so that it can be reached.
+func (s *Sandbox) Permits(rel string, dir bool) bool {
+	if s == nil {
+		return true
+	}
+	rel = path.Clean(strings.TrimPrefix(rel, "/"))
+	for _, a := range s.Allow {
+		a = path.Clean(strings.TrimPrefix(a, "/"))
+		if a == "." || rel == a || strings.HasPrefix(rel, a+"/") {
+			return true
+		}
+		if dir && (rel == "." || strings.HasPrefix(a, rel+"/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// Check decides whether rel may be written, recording a rejection to trace.
+// It returns false without an error when the path is outside the sandbox and
+// s.Skip is set, so the caller leaves it out, and ErrOutsideSandbox when it
+// is not. A nil *Sandbox permits everything.
+func (s *Sandbox) Check(trace *metadata.SecurityTrace, rel string, dir bool) (bool, error) {
+	if s.Permits(rel, dir) {
+		return true, nil
+	}
+	trace.Record(metadata.SecurityCheck{Check: "write-sandbox", Subject: rel, Outcome: metadata.CheckRejected, Detail: "outside " + strings.Join(s.Allow, ", ")})
+	if s.Skip {
+		return false, nil
+	}
+	return false, fmt.Errorf("%w: %s", ErrOutsideSandbox, rel)
+}
+
+// Require is Check for a write that cannot be left out, such as the only
+// file of a gather: it fails even when s.Skip is set.
+func (s *Sandbox) Require(trace *metadata.SecurityTrace, rel string, dir bool) error {
+	ok, err := s.Check(trace, rel, dir)
+	if !ok && err == nil {
+		err = fmt.Errorf("%w: %s", ErrOutsideSandbox, rel)
+	}
+	return err
+}
+
+// CopyFilter selects the paths of a tree copied to a destination, leaving
+// out hidden files, paths not selected by Paths, symbolic links in
+// SymlinkSkip mode and anything outside a sandbox, and records what it left
+// out. Its Skip method is the skip
+// function of a directory copy.
+type CopyFilter struct {
+	// Root is the directory being copied.
+	Root   string
+	Hidden HiddenFiles
+	// Paths selects the paths copied by include and exclude patterns.
+	Paths PathFilter
+	// Symlinks is how the copy handles symbolic links, which are left out
+	// and recorded in SymlinkSkip mode.
+	Symlinks SymlinkMode
+	Sandbox  *Sandbox
+	// Trace receives sandbox rejections, it may be nil.
+	Trace *metadata.SecurityTrace
+	// Skipped lists the paths left out, relative to Root.
+	Skipped []metadata.SkippedEntry
+
+	err error
+}
+
+// NewCopyFilter returns a filter for copying root that leaves out the
+// hidden files selected by hidden and applies the sandbox carried by ctx.
+func NewCopyFilter(ctx context.Context, root string, hidden HiddenFiles) *CopyFilter {
+	return &CopyFilter{
+		Root:    root,
+		Hidden:  hidden,
+		Sandbox: SandboxFromContext(ctx),
+		Trace:   metadata.SecurityTraceFromContext(ctx),
+	}
+}
+
+// Skip reports whether the slash-separated path rel is left out. Once a
+// path is rejected by the sandbox everything else is skipped, and Err
+// returns the rejection.
+func (f *CopyFilter) Skip(rel string) bool {
+	if f.err != nil {
+		return true
+	}
+	if f.Hidden.Excludes(rel) {
+		f.Skipped = append(f.Skipped, metadata.SkippedEntry{Path: rel, Reason: metadata.SkipHidden})
+		return true
+	}
+	info, err := os.Lstat(filepath.Join(f.Root, filepath.FromSlash(rel)))
+	dir := err == nil && info.IsDir()
+	if f.Symlinks == SymlinkSkip && err == nil && info.Mode()&os.ModeSymlink != 0 {
+		f.Skipped = append(f.Skipped, metadata.SkippedEntry{Path: rel, Reason: metadata.SkipSymlink})
+		return true
+	}
+	if f.Paths.Excludes(rel, dir) {
+		f.Skipped = append(f.Skipped, metadata.SkippedEntry{Path: rel, Reason: metadata.SkipFiltered})
+		return true
+	}
+	ok, err := f.Sandbox.Check(f.Trace, rel, dir)
+	if err != nil {
+		f.err = err
+		return true
+	}
+	if !ok {
+		f.Skipped = append(f.Skipped, metadata.SkippedEntry{Path: rel, Reason: metadata.SkipSandbox})
+	}
+	return !ok
+}
+
+// Err returns the sandbox rejection that stopped the copy, if any.
+func (f *CopyFilter) Err() error {
+	return f.err
+}
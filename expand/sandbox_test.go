@@ -0,0 +1,115 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package expand
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/enterprise-contract/go-gather/metadata"
+)
+
+func TestSandbox_Permits(t *testing.T) {
+	sandbox := &Sandbox{Allow: []string{"policy/lib", "/data/"}}
+	tests := []struct {
+		name string
+		path string
+		dir  bool
+		want bool
+	}{
+		{"allowed path", "policy/lib", true, true},
+		{"below allowed path", "policy/lib/main.rego", false, true},
+		{"second allowed path", "data/config.json", false, true},
+		{"directory leading to allowed path", "policy", true, true},
+		{"file named like a leading directory", "policy", false, false},
+		{"sibling with common prefix", "policy/library/main.rego", false, false},
+		{"outside", "README.md", false, false},
+		{"escaping", "policy/lib/../../secret", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, sandbox.Permits(tt.path, tt.dir))
+		})
+	}
+
+	var none *Sandbox
+	assert.True(t, none.Permits("anything", false))
+	assert.True(t, (&Sandbox{Allow: []string{"."}}).Permits("anything", false))
+}
+
+func TestSandbox_Check(t *testing.T) {
+	_, trace := metadata.WithSecurityTrace(context.Background())
+
+	ok, err := (&Sandbox{Allow: []string{"policy"}}).Check(trace, "policy/main.rego", false)
+	assert.True(t, ok)
+	assert.NoError(t, err)
+
+	ok, err = (&Sandbox{Allow: []string{"policy"}}).Check(trace, "README.md", false)
+	assert.False(t, ok)
+	assert.ErrorIs(t, err, ErrOutsideSandbox)
+
+	ok, err = (&Sandbox{Allow: []string{"policy"}, Skip: true}).Check(trace, "README.md", false)
+	assert.False(t, ok)
+	assert.NoError(t, err)
+
+	checks := trace.Checks()
+	require.Len(t, checks, 2)
+	assert.Equal(t, metadata.SecurityCheck{Check: "write-sandbox", Subject: "README.md", Outcome: metadata.CheckRejected, Detail: "outside policy"}, checks[0])
+}
+
+func TestSandbox_Context(t *testing.T) {
+	ctx := context.Background()
+	assert.Nil(t, SandboxFromContext(ctx))
+
+	ctx = WithSandbox(ctx, Sandbox{Allow: []string{"policy"}})
+	assert.Equal(t, []string{"policy"}, SandboxFromContext(ctx).Allow)
+	assert.Nil(t, SandboxFromContext(WithoutSandbox(ctx)))
+}
+
+func TestCopyFilter(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "policy"), 0755))
+
+	ctx := WithSandbox(context.Background(), Sandbox{Allow: []string{"policy/main.rego", "README.md"}, Skip: true})
+	filter := NewCopyFilter(ctx, root, ExcludeGitFiles)
+	assert.True(t, filter.Skip(".git"))
+	assert.False(t, filter.Skip("policy"))
+	assert.False(t, filter.Skip("policy/main.rego"))
+	assert.True(t, filter.Skip("policy/lib.rego"))
+	assert.False(t, filter.Skip("README.md"))
+	assert.NoError(t, filter.Err())
+	assert.Equal(t, []metadata.SkippedEntry{
+		{Path: ".git", Reason: metadata.SkipHidden},
+		{Path: "policy/lib.rego", Reason: metadata.SkipSandbox},
+	}, filter.Skipped)
+
+	ctx = WithSandbox(context.Background(), Sandbox{Allow: []string{"policy/main.rego"}})
+	filter = NewCopyFilter(ctx, root, HiddenFiles{})
+	assert.True(t, filter.Skip("README.md"))
+	assert.ErrorIs(t, filter.Err(), ErrOutsideSandbox)
+	assert.True(t, filter.Skip("policy/main.rego"), "expected everything to be skipped after a rejection")
+	assert.Empty(t, filter.Skipped)
+
+	filter = NewCopyFilter(context.Background(), root, HiddenFiles{})
+	assert.False(t, filter.Skip("README.md"))
+	assert.NoError(t, filter.Err())
+}
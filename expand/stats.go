@@ -0,0 +1,159 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package expand
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/enterprise-contract/go-gather/internal/logging"
+)
+
+// BufferSize is the size of the buffer entry contents are copied through.
+const BufferSize = 32 * 1024
+
+// Stats describes the work done by an expansion.
+type Stats struct {
+	// Entries is the number of files and directories extracted.
+	Entries int
+	// Bytes is the total size of the files extracted.
+	Bytes int64
+	// Skipped is the number of entries left out.
+	Skipped int
+	// PeakBuffered is the largest amount of entry data held in memory at
+	// once while copying it to disk.
+	PeakBuffered int64
+	// Duration is how long the expansion took.
+	Duration time.Duration
+}
+
+// Throughput returns the rate files were extracted at in bytes per second.
+func (s Stats) Throughput() float64 {
+	if s.Duration <= 0 {
+		return 0
+	}
+	return float64(s.Bytes) / s.Duration.Seconds()
+}
+
+// Buffered records that n bytes of entry data are held in memory.
+func (s *Stats) Buffered(n int) {
+	if int64(n) > s.PeakBuffered {
+		s.PeakBuffered = int64(n)
+	}
+}
+
+// Copy copies src to dst through buf, recording the amount buffered.
+func (s *Stats) Copy(dst io.Writer, src io.Reader, buf []byte) (int64, error) {
+	var written int64
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			s.Buffered(n)
+			w, werr := dst.Write(buf[:n])
+			written += int64(w)
+			if werr != nil {
+				return written, werr
+			}
+			if w != n {
+				return written, io.ErrShortWrite
+			}
+		}
+		if err == io.EOF {
+			return written, nil
+		}
+		if err != nil {
+			return written, err
+		}
+	}
+}
+
+// Finish records in the manifest's Stats that the expansion took elapsed.
+// The entries are counted as they are added.
+func (m *Manifest) Finish(elapsed time.Duration) {
+	m.Stats.Duration = elapsed
+	logging.Logger().Debug("expanded archive", "root", m.Root, "entries", m.Stats.Entries, "bytes", m.Stats.Bytes, "skipped", m.Stats.Skipped, "duration", elapsed)
+}
+
+// MemoryGuard is a soft memory budget shared by expansions running in
+// parallel. Each expansion reserves an estimate of the memory it buffers
+// before extracting anything, waiting while the budget is taken, so parallel
+// extractions are throttled rather than exceed it. An expansion needing more
+// than the whole budget is let through once nothing else holds a
+// reservation. A nil MemoryGuard imposes no limit.
+type MemoryGuard struct {
+	budget int64
+
+	mu    sync.Mutex
+	used  int64
+	freed chan struct{}
+}
+
+// NewMemoryGuard returns a MemoryGuard with a budget of the given bytes.
+func NewMemoryGuard(budget int64) *MemoryGuard {
+	return &MemoryGuard{budget: budget}
+}
+
+// Reserve waits until n bytes of the budget are available and takes them,
+// returning a function that gives them back. It returns the context's error
+// if ctx is done first.
+func (g *MemoryGuard) Reserve(ctx context.Context, n int64) (release func(), err error) {
+	if g == nil {
+		return func() {}, nil
+	}
+	for {
+		g.mu.Lock()
+		if g.used == 0 || g.used+n <= g.budget {
+			g.used += n
+			g.mu.Unlock()
+			var once sync.Once
+			return func() { once.Do(func() { g.release(n) }) }, nil
+		}
+		if g.freed == nil {
+			g.freed = make(chan struct{})
+		}
+		freed := g.freed
+		g.mu.Unlock()
+
+		select {
+		case <-freed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// InUse returns the number of bytes currently reserved.
+func (g *MemoryGuard) InUse() int64 {
+	if g == nil {
+		return 0
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.used
+}
+
+func (g *MemoryGuard) release(n int64) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.used -= n
+	if g.freed != nil {
+		close(g.freed)
+		g.freed = nil
+	}
+}
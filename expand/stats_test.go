@@ -0,0 +1,111 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package expand
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStats_Copy(t *testing.T) {
+	var s Stats
+	var out bytes.Buffer
+	n, err := s.Copy(&out, strings.NewReader(strings.Repeat("x", 100)), make([]byte, 16))
+	require.NoError(t, err)
+	assert.Equal(t, int64(100), n)
+	assert.Equal(t, 100, out.Len())
+	assert.Equal(t, int64(16), s.PeakBuffered)
+}
+
+func TestManifest_Finish(t *testing.T) {
+	m := NewManifest("/dst")
+	m.AddDir("/dst/dir", 0755)
+	m.AddFile("/dst/dir/a", 300, 0644, sha256.New())
+	m.AddFile("/dst/b", 700, 0644, sha256.New())
+	m.Finish(2 * time.Second)
+
+	assert.Equal(t, 3, m.Stats.Entries)
+	assert.Equal(t, int64(1000), m.Stats.Bytes)
+	assert.Equal(t, 2*time.Second, m.Stats.Duration)
+	assert.InDelta(t, 500.0, m.Stats.Throughput(), 0.001)
+	assert.Zero(t, Stats{Bytes: 10}.Throughput())
+}
+
+func TestMemoryGuard_Nil(t *testing.T) {
+	var g *MemoryGuard
+	release, err := g.Reserve(context.Background(), 1<<40)
+	require.NoError(t, err)
+	release()
+	assert.Zero(t, g.InUse())
+}
+
+func TestMemoryGuard_Throttles(t *testing.T) {
+	g := NewMemoryGuard(100)
+	ctx := context.Background()
+
+	first, err := g.Reserve(ctx, 60)
+	require.NoError(t, err)
+	assert.Equal(t, int64(60), g.InUse())
+
+	reserved := make(chan func())
+	go func() {
+		release, err := g.Reserve(ctx, 60)
+		assert.NoError(t, err)
+		reserved <- release
+	}()
+
+	select {
+	case <-reserved:
+		t.Fatal("reservation over budget was not held back")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	first()
+	first() // releasing twice gives the memory back once
+	second := <-reserved
+	assert.Equal(t, int64(60), g.InUse())
+	second()
+	assert.Zero(t, g.InUse())
+}
+
+func TestMemoryGuard_Oversize(t *testing.T) {
+	g := NewMemoryGuard(10)
+	release, err := g.Reserve(context.Background(), 50)
+	require.NoError(t, err, "a reservation larger than the budget is let through when nothing else holds one")
+	assert.Equal(t, int64(50), g.InUse())
+	release()
+}
+
+func TestMemoryGuard_Cancelled(t *testing.T) {
+	g := NewMemoryGuard(10)
+	release, err := g.Reserve(context.Background(), 10)
+	require.NoError(t, err)
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = g.Reserve(ctx, 5)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, int64(10), g.InUse())
+}
@@ -0,0 +1,38 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package expand
+
+import "github.com/enterprise-contract/go-gather/internal/helpers"
+
+// SymlinkMode is how copying a directory handles symbolic links.
+type SymlinkMode string
+
+const (
+	// SymlinkPreserve recreates links with the same target. It is the
+	// default, used when the mode is empty.
+	SymlinkPreserve SymlinkMode = "preserve"
+	// SymlinkFollow copies the files and directories links point at in
+	// their place.
+	SymlinkFollow SymlinkMode = "follow"
+	// SymlinkSkip leaves links out.
+	SymlinkSkip SymlinkMode = "skip"
+)
+
+// Validate returns an error if m is not one of the modes, or empty.
+func (m SymlinkMode) Validate() error {
+	return helpers.SymlinkMode(m).Validate()
+}
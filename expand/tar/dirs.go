@@ -0,0 +1,137 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package tar
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// dirSpillThreshold is the number of directories whose attributes are held
+// in memory before they are spilled to a temporary file.
+var dirSpillThreshold = 4096
+
+// dirRecordSize is the size of a spilled dirAttr without its path: the
+// length of the path, the mode, and both timestamps as seconds and
+// nanoseconds, so that any time a tar header holds survives.
+const dirRecordSize = 4 + 4 + 2*(8+4)
+
+// dirAttr holds the permissions and timestamps of an extracted directory.
+type dirAttr struct {
+	path         string
+	mode         os.FileMode
+	aTime, mTime time.Time
+}
+
+// dirAttrs records the attributes of the directories extracted, to be
+// applied once all of their contents have been written. Past
+// dirSpillThreshold directories they are spilled to a temporary file, so an
+// archive with millions of directories is extracted in constant memory.
+type dirAttrs struct {
+	mem   []dirAttr
+	spill *os.File
+	w     *bufio.Writer
+}
+
+// add records the attributes of a directory.
+func (d *dirAttrs) add(a dirAttr) error {
+	if len(d.mem) < dirSpillThreshold {
+		d.mem = append(d.mem, a)
+		return nil
+	}
+	if d.spill == nil {
+		f, err := os.CreateTemp("", "tar-dirs-")
+		if err != nil {
+			return fmt.Errorf("failed to spill directory attributes: %w", err)
+		}
+		d.spill, d.w = f, bufio.NewWriter(f)
+	}
+	var rec [dirRecordSize]byte
+	binary.LittleEndian.PutUint32(rec[0:], uint32(len(a.path)))
+	binary.LittleEndian.PutUint32(rec[4:], uint32(a.mode))
+	binary.LittleEndian.PutUint64(rec[8:], uint64(a.aTime.Unix()))
+	binary.LittleEndian.PutUint32(rec[16:], uint32(a.aTime.Nanosecond()))
+	binary.LittleEndian.PutUint64(rec[20:], uint64(a.mTime.Unix()))
+	binary.LittleEndian.PutUint32(rec[28:], uint32(a.mTime.Nanosecond()))
+	if _, err := d.w.Write(rec[:]); err != nil {
+		return fmt.Errorf("failed to spill directory attributes: %w", err)
+	}
+	if _, err := d.w.WriteString(a.path); err != nil {
+		return fmt.Errorf("failed to spill directory attributes: %w", err)
+	}
+	return nil
+}
+
+// each calls fn with the attributes of every directory, in the order they
+// were added, stopping at the first error fn returns.
+func (d *dirAttrs) each(fn func(dirAttr) error) error {
+	for _, a := range d.mem {
+		if err := fn(a); err != nil {
+			return err
+		}
+	}
+	if d.spill == nil {
+		return nil
+	}
+	if err := d.w.Flush(); err != nil {
+		return fmt.Errorf("failed to spill directory attributes: %w", err)
+	}
+	if _, err := d.spill.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to read spilled directory attributes: %w", err)
+	}
+	r := bufio.NewReader(d.spill)
+	var rec [dirRecordSize]byte
+	var path []byte
+	for {
+		if _, err := io.ReadFull(r, rec[:]); errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("failed to read spilled directory attributes: %w", err)
+		}
+		n := binary.LittleEndian.Uint32(rec[0:])
+		if cap(path) < int(n) {
+			path = make([]byte, n)
+		}
+		path = path[:n]
+		if _, err := io.ReadFull(r, path); err != nil {
+			return fmt.Errorf("failed to read spilled directory attributes: %w", err)
+		}
+		a := dirAttr{
+			path:  string(path),
+			mode:  os.FileMode(binary.LittleEndian.Uint32(rec[4:])),
+			aTime: time.Unix(int64(binary.LittleEndian.Uint64(rec[8:])), int64(binary.LittleEndian.Uint32(rec[16:]))),
+			mTime: time.Unix(int64(binary.LittleEndian.Uint64(rec[20:])), int64(binary.LittleEndian.Uint32(rec[28:]))),
+		}
+		if err := fn(a); err != nil {
+			return err
+		}
+	}
+}
+
+// close removes the spill file, if any.
+func (d *dirAttrs) close() {
+	if d.spill != nil {
+		d.spill.Close()
+		os.Remove(d.spill.Name())
+		d.spill = nil
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package tar
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestDirAttrs_Spill(t *testing.T) {
+	old := dirSpillThreshold
+	dirSpillThreshold = 2
+	defer func() { dirSpillThreshold = old }()
+
+	var want []dirAttr
+	for i, ts := range []time.Time{
+		time.Unix(1700000000, 123),
+		time.Date(1, 1, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(3000, 1, 1, 0, 0, 0, 5, time.UTC),
+		time.Unix(0, 0),
+		time.Unix(42, 999999999),
+	} {
+		want = append(want, dirAttr{
+			path:  "/dst/" + string(rune('a'+i)) + "/nested",
+			mode:  os.ModeDir | os.FileMode(0700+i),
+			aTime: ts,
+			mTime: ts.Add(time.Hour),
+		})
+	}
+
+	var d dirAttrs
+	for _, a := range want {
+		if err := d.add(a); err != nil {
+			t.Fatalf("add returned an error: %v", err)
+		}
+	}
+	if len(d.mem) != 2 || d.spill == nil {
+		t.Fatalf("expected 2 directories in memory and the rest spilled, got %d in memory", len(d.mem))
+	}
+	spill := d.spill.Name()
+
+	var got []dirAttr
+	if err := d.each(func(a dirAttr) error {
+		got = append(got, a)
+		return nil
+	}); err != nil {
+		t.Fatalf("each returned an error: %v", err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d directories, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].path != want[i].path || got[i].mode != want[i].mode || !got[i].aTime.Equal(want[i].aTime) || !got[i].mTime.Equal(want[i].mTime) {
+			t.Errorf("directory %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+
+	d.close()
+	if _, err := os.Stat(spill); !os.IsNotExist(err) {
+		t.Errorf("expected the spill file to be removed, got %v", err)
+	}
+}
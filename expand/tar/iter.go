@@ -0,0 +1,34 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build go1.23
+
+package tar
+
+import (
+	"context"
+	"iter"
+
+	"github.com/enterprise-contract/go-gather/expand"
+)
+
+// Entries returns an iterator over the entries List returns, reading the
+// tarball at src only as far as the iteration goes.
+func (t *TarExpander) Entries(ctx context.Context, src string) iter.Seq2[expand.ManifestEntry, error] {
+	return expand.EntrySeq(func(fn func(expand.ManifestEntry) bool) error {
+		return t.walk(ctx, src, fn)
+	})
+}
@@ -0,0 +1,77 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build go1.23
+
+package tar
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestTarExpander_Entries(t *testing.T) {
+	srcFile := filepath.Join(t.TempDir(), "test.tar")
+	err := createMultiTarFile(srcFile, []tarTestEntry{
+		{name: "a.txt", content: "a"},
+		{name: "dir/b.txt", content: "bb"},
+		{name: "dir/c.txt", content: "ccc"},
+	})
+	if err != nil {
+		t.Fatalf("failed to create tar file: %v", err)
+	}
+	tarExpander := &TarExpander{}
+	entries, err := tarExpander.List(context.Background(), srcFile)
+	if err != nil {
+		t.Fatalf("List returned an unexpected error: %v", err)
+	}
+
+	var i int
+	for e, err := range tarExpander.Entries(context.Background(), srcFile) {
+		if err != nil {
+			t.Fatalf("Entries yielded an unexpected error: %v", err)
+		}
+		if e != entries[i] {
+			t.Errorf("entry %d: expected %+v, got %+v", i, entries[i], e)
+		}
+		i++
+	}
+	if i != len(entries) {
+		t.Errorf("expected %d entries, got %d", len(entries), i)
+	}
+
+	// Stopping early stops reading
+	i = 0
+	for range tarExpander.Entries(context.Background(), srcFile) {
+		i++
+		break
+	}
+	if i != 1 {
+		t.Errorf("expected the iteration to stop after 1 entry, got %d", i)
+	}
+
+	var errs int
+	for _, err := range tarExpander.Entries(context.Background(), filepath.Join(t.TempDir(), "missing.tar")) {
+		if err == nil {
+			t.Error("expected only an error for a missing tarball")
+		}
+		errs++
+	}
+	if errs != 1 {
+		t.Errorf("expected 1 error, got %d", errs)
+	}
+}
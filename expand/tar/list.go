@@ -0,0 +1,190 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package tar
+
+import (
+	"archive/tar"
+	"compress/bzip2"
+	"compress/gzip"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/enterprise-contract/go-gather/expand"
+	"github.com/enterprise-contract/go-gather/internal/helpers"
+)
+
+// List reads the tarball at src and returns the entries Expand would write,
+// with the size and digest of every file, without writing anything.
+func (t *TarExpander) List(ctx context.Context, src string) ([]expand.ManifestEntry, error) {
+	var entries []expand.ManifestEntry
+	err := t.walk(ctx, src, func(e expand.ManifestEntry) bool {
+		entries = append(entries, e)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// walk reads the tarball at src and calls fn with each entry List returns,
+// in order, until fn returns false.
+func (t *TarExpander) walk(ctx context.Context, src string, fn func(expand.ManifestEntry) bool) error {
+	tarReader, closeTarball, err := openTarball(ctx, src)
+	if err != nil {
+		return err
+	}
+	defer closeTarball()
+
+	normalizer := expand.NewNameNormalizer(t.Normalization)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error reading tar header: %w", err)
+		}
+		if header.Typeflag == tar.TypeXGlobalHeader || header.Typeflag == tar.TypeXHeader {
+			continue
+		}
+
+		name, err := entryName(normalizer, header.Name)
+		if err != nil {
+			return err
+		}
+		if t.Hidden.Excludes(name) {
+			continue
+		}
+
+		fileInfo := header.FileInfo()
+		if fileInfo.IsDir() {
+			if !fn(expand.ManifestEntry{Path: name, Mode: fileInfo.Mode() | os.ModeDir}) {
+				return nil
+			}
+			continue
+		}
+		w, sum := expand.Hasher(io.Discard)
+		size, err := io.Copy(w, tarReader)
+		if err != nil {
+			return fmt.Errorf("error reading file (%s): %w", header.Name, err)
+		}
+		e := expand.ManifestEntry{
+			Path:   name,
+			Size:   size,
+			Mode:   fileInfo.Mode(),
+			SHA256: hex.EncodeToString(sum.Sum(nil)),
+		}
+		if !fn(e) {
+			return nil
+		}
+	}
+}
+
+// ExtractEntry writes the contents of the file name in the tarball at src to
+// w, reading the tarball only up to that file. It returns
+// expand.ErrEntryNotFound if there is no such file.
+func (t *TarExpander) ExtractEntry(ctx context.Context, src, name string, w io.Writer) (int64, error) {
+	tarReader, closeTarball, err := openTarball(ctx, src)
+	if err != nil {
+		return 0, err
+	}
+	defer closeTarball()
+
+	want := path.Clean(strings.TrimPrefix(name, "/"))
+	normalizer := expand.NewNameNormalizer(t.Normalization)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return 0, fmt.Errorf("%w: %s", expand.ErrEntryNotFound, name)
+		}
+		if err != nil {
+			return 0, fmt.Errorf("error reading tar header: %w", err)
+		}
+		if header.Typeflag == tar.TypeXGlobalHeader || header.Typeflag == tar.TypeXHeader {
+			continue
+		}
+		got, err := entryName(normalizer, header.Name)
+		if err != nil {
+			return 0, err
+		}
+		if got != want || t.Hidden.Excludes(got) {
+			continue
+		}
+		if !header.FileInfo().Mode().IsRegular() {
+			return 0, fmt.Errorf("%s is not a regular file", name)
+		}
+		if t.FileSizeLimit > 0 && header.Size > t.FileSizeLimit {
+			return 0, fmt.Errorf("%w: tar file size exceeds the %d limit: %d", expand.ErrSizeLimitExceeded, t.FileSizeLimit, header.Size)
+		}
+		n, err := io.Copy(w, tarReader)
+		if err != nil {
+			return n, fmt.Errorf("error reading file (%s): %w", header.Name, err)
+		}
+		return n, nil
+	}
+}
+
+// openTarball opens the tarball at src, decompressing it according to its
+// extension. The returned function closes it.
+func openTarball(ctx context.Context, src string) (*tar.Reader, func(), error) {
+	src, err := pathExpanderFunc(src)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to expand source path: %w", err)
+	}
+	file, err := os.Open(src)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open source file: %s", src)
+	}
+
+	var input io.Reader = helpers.NewContextReader(ctx, file)
+	closeAll := func() { file.Close() }
+	if expand.HasExtension(src, gzipExtensions...) {
+		gzr, err := gzip.NewReader(input)
+		if err != nil {
+			file.Close()
+			return nil, nil, fmt.Errorf("failed to create gzip reader: %w", err)
+		}
+		input = gzr
+		closeAll = func() {
+			gzr.Close()
+			file.Close()
+		}
+	} else if expand.HasExtension(src, bzip2Extensions...) {
+		input = bzip2.NewReader(input)
+	}
+	return tar.NewReader(input), closeAll, nil
+}
+
+// entryName returns the path Expand records for the entry named name,
+// rejecting names that would be written outside of the destination.
+func entryName(normalizer *expand.NameNormalizer, name string) (string, error) {
+	normalized, err := normalizer.Normalize(expand.NewManifest(""), name)
+	if err != nil {
+		return "", err
+	}
+	normalized = path.Clean(normalized)
+	if normalized == "." || normalized == ".." || strings.HasPrefix(normalized, "../") || path.IsAbs(normalized) {
+		return "", fmt.Errorf("illegal file path: %s", name)
+	}
+	return normalized, nil
+}
@@ -0,0 +1,188 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package tar
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/enterprise-contract/go-gather/expand"
+)
+
+const blockSize = 512
+
+// errDamagedMember is returned, once per damaged member, by a
+// gzipSalvageReader. Reads after it continue with the next decodable member.
+var errDamagedMember = errors.New("damaged gzip member")
+
+// gzipSalvageReader decompresses a stream of gzip members, skipping over any
+// member that fails to decode by scanning forward to the next gzip header.
+// Data inside a damaged deflate stream cannot be resynchronized, so everything
+// between the point of damage and the next member is lost.
+type gzipSalvageReader struct {
+	r  *bufio.Reader
+	zr *gzip.Reader
+	// strict fails on trailer checksum mismatches instead of ignoring them.
+	strict bool
+}
+
+func newGzipSalvageReader(r io.Reader, strict bool) *gzipSalvageReader {
+	return &gzipSalvageReader{r: bufio.NewReader(r), strict: strict}
+}
+
+func (s *gzipSalvageReader) Read(p []byte) (int, error) {
+	for {
+		if s.zr == nil {
+			if err := s.nextMember(); err != nil {
+				return 0, err
+			}
+		}
+		n, err := s.zr.Read(p)
+		switch {
+		case err == nil:
+			return n, nil
+		case errors.Is(err, gzip.ErrChecksum) && s.strict:
+			return n, &expand.IntegrityError{Check: "crc32", Err: err}
+		case err == io.EOF || errors.Is(err, gzip.ErrChecksum):
+			// The member ended. Its data has already been handed out, so
+			// outside strict mode a bad trailer checksum is tolerated.
+			s.zr = nil
+			if n > 0 {
+				return n, nil
+			}
+		default:
+			s.zr = nil
+			return n, errDamagedMember
+		}
+	}
+}
+
+// nextMember positions the reader at the next decodable gzip member. It
+// returns io.EOF when the input holds no further members.
+func (s *gzipSalvageReader) nextMember() error {
+	for {
+		magic, _ := s.r.Peek(3)
+		if len(magic) < 3 {
+			return io.EOF
+		}
+		if magic[0] == 0x1f && magic[1] == 0x8b && magic[2] == 0x08 {
+			// bufio.Reader implements io.ByteReader, so the gzip reader
+			// consumes exactly one member and nothing beyond it.
+			zr, err := gzip.NewReader(s.r)
+			if err == nil {
+				zr.Multistream(false)
+				s.zr = zr
+				return nil
+			}
+			continue
+		}
+		if _, err := s.r.Discard(1); err != nil {
+			return io.EOF
+		}
+	}
+}
+
+// blockReader counts the bytes consumed from a tar stream so that, after a
+// failure, scanning for the next header can resume on a block boundary.
+type blockReader struct {
+	r io.Reader
+	n int64
+}
+
+func (b *blockReader) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	b.n += int64(n)
+	if errors.Is(err, errDamagedMember) {
+		// The next gzip member starts a fresh run of blocks.
+		b.n = 0
+	}
+	return n, err
+}
+
+// resync skips to the next block holding a valid tar header and returns a
+// reader starting at that header. It returns io.EOF if none is found.
+func (b *blockReader) resync() (*blockReader, error) {
+	if rem := b.n % blockSize; rem != 0 {
+		if _, err := io.CopyN(io.Discard, b, blockSize-rem); err != nil && !errors.Is(err, errDamagedMember) {
+			return nil, io.EOF
+		}
+	}
+	block := make([]byte, blockSize)
+	for {
+		if _, err := io.ReadFull(b, block); err != nil {
+			if errors.Is(err, errDamagedMember) {
+				continue
+			}
+			return nil, io.EOF
+		}
+		if isTarHeader(block) {
+			return &blockReader{r: io.MultiReader(bytes.NewReader(block), b)}, nil
+		}
+	}
+}
+
+// isTarHeader reports whether block is a tar header with a valid checksum.
+func isTarHeader(block []byte) bool {
+	if len(block) != blockSize || block[0] == 0 {
+		return false
+	}
+	field := strings.Trim(string(block[148:156]), " \x00")
+	want, err := strconv.ParseInt(field, 8, 64)
+	if err != nil {
+		return false
+	}
+	var sum int64
+	for i, c := range block {
+		if i >= 148 && i < 156 {
+			c = ' '
+		}
+		sum += int64(c)
+	}
+	return sum == want
+}
+
+// streamError marks a failure reading the archive stream, as opposed to
+// writing the extracted content.
+type streamError struct {
+	err error
+}
+
+func (e *streamError) Error() string {
+	return e.err.Error()
+}
+
+func (e *streamError) Unwrap() error {
+	return e.err
+}
+
+// streamErrorReader tags read errors other than io.EOF as stream errors.
+type streamErrorReader struct {
+	r io.Reader
+}
+
+func (s streamErrorReader) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	if err != nil && err != io.EOF {
+		err = &streamError{err: err}
+	}
+	return n, err
+}
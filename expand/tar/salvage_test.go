@@ -0,0 +1,201 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package tar
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/enterprise-contract/go-gather/expand"
+)
+
+// entrySize is the size each salvageTar entry occupies in the tar stream:
+// one header block and one data block.
+const entrySize = 2 * blockSize
+
+// salvageTar returns an uncompressed tar stream holding a.txt, b.txt and
+// c.txt, each occupying exactly entrySize bytes.
+func salvageTar(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		content := strings.Repeat(name[:1], 100)
+		hdr := &tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Format: tar.FormatUSTAR}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatalf("failed to write header: %v", err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatalf("failed to write content: %v", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("failed to close tar writer: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func gzipMember(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		t.Fatalf("failed to compress: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("failed to close gzip writer: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func expandSalvage(t *testing.T, name string, archive []byte) (string, *TarExpander) {
+	t.Helper()
+	tempDir := t.TempDir()
+	src := filepath.Join(tempDir, name)
+	if err := os.WriteFile(src, archive, 0644); err != nil {
+		t.Fatalf("failed to write archive: %v", err)
+	}
+	return src, &TarExpander{Salvage: true}
+}
+
+func assertSalvaged(t *testing.T, dst string, present, missing []string) {
+	t.Helper()
+	for _, name := range present {
+		if _, err := os.Stat(filepath.Join(dst, name)); err != nil {
+			t.Errorf("expected %s to be recovered: %v", name, err)
+		}
+	}
+	for _, name := range missing {
+		if _, err := os.Stat(filepath.Join(dst, name)); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be skipped, got err=%v", name, err)
+		}
+	}
+}
+
+func TestTarExpander_Salvage_CorruptTarHeader(t *testing.T) {
+	archive := salvageTar(t)
+	// Break the checksum of b.txt's header.
+	archive[entrySize+148] ^= 0x01
+
+	src, e := expandSalvage(t, "damaged.tar", archive)
+	dst := filepath.Join(t.TempDir(), "out")
+
+	if _, err := (&TarExpander{}).Expand(context.Background(), src, dst, 0); err == nil {
+		t.Fatal("expected Expand to fail without Salvage")
+	}
+
+	m, err := e.Expand(context.Background(), src, dst, 0)
+	if err != nil {
+		t.Fatalf("Expand returned an unexpected error: %v", err)
+	}
+	if m.Salvage == nil || m.Salvage.Recovered != 2 || m.Salvage.Skipped != 1 {
+		t.Fatalf("unexpected salvage report: %+v", m.Salvage)
+	}
+	assertSalvaged(t, dst, []string{"a.txt", "c.txt"}, []string{"b.txt"})
+}
+
+func TestTarExpander_Salvage_DamagedGzipMember(t *testing.T) {
+	archive := salvageTar(t)
+
+	// Compress each entry as its own gzip member and make the second one
+	// undecodable by giving its first deflate block a reserved type.
+	a := gzipMember(t, archive[:entrySize])
+	b := gzipMember(t, archive[entrySize:2*entrySize])
+	c := gzipMember(t, archive[2*entrySize:])
+	b[10] = 0xff
+
+	var buf bytes.Buffer
+	buf.Write(a)
+	buf.Write(b)
+	buf.Write(c)
+
+	src, e := expandSalvage(t, "damaged.tar.gz", buf.Bytes())
+	dst := filepath.Join(t.TempDir(), "out")
+
+	if _, err := (&TarExpander{}).Expand(context.Background(), src, dst, 0); err == nil {
+		t.Fatal("expected Expand to fail without Salvage")
+	}
+
+	m, err := e.Expand(context.Background(), src, dst, 0)
+	if err != nil {
+		t.Fatalf("Expand returned an unexpected error: %v", err)
+	}
+	if m.Salvage == nil || m.Salvage.Recovered != 2 || m.Salvage.Skipped != 1 {
+		t.Fatalf("unexpected salvage report: %+v", m.Salvage)
+	}
+	assertSalvaged(t, dst, []string{"a.txt", "c.txt"}, []string{"b.txt"})
+}
+
+func TestTarExpander_Salvage_IntactArchive(t *testing.T) {
+	src, e := expandSalvage(t, "intact.tar.gz", gzipMember(t, salvageTar(t)))
+	dst := filepath.Join(t.TempDir(), "out")
+
+	m, err := e.Expand(context.Background(), src, dst, 0)
+	if err != nil {
+		t.Fatalf("Expand returned an unexpected error: %v", err)
+	}
+	if m.Salvage == nil || m.Salvage.Recovered != 3 || m.Salvage.Skipped != 0 {
+		t.Fatalf("unexpected salvage report: %+v", m.Salvage)
+	}
+}
+
+func TestIsTarHeader(t *testing.T) {
+	archive := salvageTar(t)
+	if !isTarHeader(archive[:blockSize]) {
+		t.Error("expected first block to be a tar header")
+	}
+	if isTarHeader(archive[blockSize : 2*blockSize]) {
+		t.Error("expected data block not to be a tar header")
+	}
+	if isTarHeader(make([]byte, blockSize)) {
+		t.Error("expected zero block not to be a tar header")
+	}
+}
+
+func TestTarExpander_GzipTrailerChecksum(t *testing.T) {
+	archive := gzipMember(t, salvageTar(t))
+	// The trailer ends with the CRC-32 followed by the uncompressed size.
+	archive[len(archive)-8] ^= 0xff
+
+	tempDir := t.TempDir()
+	src := filepath.Join(tempDir, "bad-trailer.tar.gz")
+	if err := os.WriteFile(src, archive, 0644); err != nil {
+		t.Fatalf("failed to write archive: %v", err)
+	}
+	ctx := context.Background()
+
+	_, err := (&TarExpander{}).Expand(ctx, src, filepath.Join(tempDir, "plain"), 0)
+	if !errors.Is(err, expand.ErrIntegrity) {
+		t.Fatalf("expected integrity error, got %v", err)
+	}
+
+	if _, err := (&TarExpander{Salvage: true}).Expand(ctx, src, filepath.Join(tempDir, "salvage"), 0); err != nil {
+		t.Fatalf("expected salvage to tolerate trailer mismatch, got %v", err)
+	}
+
+	_, err = (&TarExpander{Salvage: true, StrictCRC: true}).Expand(ctx, src, filepath.Join(tempDir, "strict"), 0)
+	if !errors.Is(err, expand.ErrIntegrity) {
+		t.Fatalf("expected integrity error in strict salvage mode, got %v", err)
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package tar
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/enterprise-contract/go-gather/internal/soak"
+)
+
+// TestUntar_Soak extracts a synthetic tarball of multi-gigabyte files and a
+// directory for every 4 KiB of them, e.g. a million directories for 4 GiB,
+// checking it runs in constant memory and with a bounded number of open
+// files. The archive is generated as it is read, so only the extracted
+// files take up disk space.
+func TestUntar_Soak(t *testing.T) {
+	size := soak.Size(t)
+	dirs := int(size / 4096)
+	const fileSize = 256 << 20
+
+	pr, pw := io.Pipe()
+	go func() {
+		tw := tar.NewWriter(pw)
+		mTime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+		err := func() error {
+			for i := 0; i < dirs; i++ {
+				name := fmt.Sprintf("d%04d/%04d/", i/1000, i%1000)
+				if i%1000 == 0 {
+					if err := tw.WriteHeader(&tar.Header{Name: name[:6], Typeflag: tar.TypeDir, Mode: 0755, ModTime: mTime}); err != nil {
+						return err
+					}
+				}
+				if err := tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeDir, Mode: 0755, ModTime: mTime}); err != nil {
+					return err
+				}
+			}
+			zeros := make([]byte, 1<<20)
+			for written := int64(0); written < size; written += fileSize {
+				if err := tw.WriteHeader(&tar.Header{Name: fmt.Sprintf("file%d", written/fileSize), Mode: 0644, Size: fileSize}); err != nil {
+					return err
+				}
+				for n := 0; n < fileSize; n += len(zeros) {
+					if _, err := tw.Write(zeros); err != nil {
+						return err
+					}
+				}
+			}
+			return tw.Close()
+		}()
+		pw.CloseWithError(err)
+	}()
+
+	sampler := soak.Start(100 * time.Millisecond)
+	m, err := untar(pr, t.TempDir(), "soak.tar", options{streaming: true})
+	sampler.Stop()
+	if err != nil {
+		t.Fatalf("untar returned an error: %v", err)
+	}
+	if m.Stats.Bytes < size {
+		t.Errorf("extracted %d bytes, want at least %d", m.Stats.Bytes, size)
+	}
+	sampler.Check(t, 64<<20, 4)
+}
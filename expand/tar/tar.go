@@ -20,6 +20,7 @@ import (
 	"compress/bzip2"
 	"compress/gzip"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -28,9 +29,14 @@ import (
 	"time"
 
 	"github.com/google/safearchive/tar"
+	"go.opentelemetry.io/otel/attribute"
 
 	"github.com/enterprise-contract/go-gather/expand"
+	"github.com/enterprise-contract/go-gather/faults"
+	"github.com/enterprise-contract/go-gather/fserrors"
 	"github.com/enterprise-contract/go-gather/internal/helpers"
+	"github.com/enterprise-contract/go-gather/internal/tracing"
+	"github.com/enterprise-contract/go-gather/metadata"
 )
 
 var (
@@ -40,88 +46,297 @@ var (
 	untarFunc        = untar
 )
 
+// Extensions of compressed tarballs, determining the decompressor used.
+var (
+	gzipExtensions  = []string{"tar.gz", "tgz"}
+	bzip2Extensions = []string{"tar.bz2", "tbz2", "tbz"}
+)
+
 type TarExpander struct {
 	FileSizeLimit int64
 	FilesLimit    int
+	// ContinueOnError keeps extracting when an individual entry fails,
+	// returning the manifest of what was extracted together with an
+	// expand.EntryErrors listing the entries that failed. Errors reading the
+	// archive stream itself and limit violations still abort the expansion.
+	ContinueOnError bool
+	// Salvage extracts as much as possible from a damaged archive. Damaged
+	// gzip members are skipped by scanning for the next member header, and
+	// unreadable tar blocks are skipped by scanning for the next valid tar
+	// header. Entries caught in a damaged region are dropped. The outcome is
+	// reported in the manifest's Salvage field.
+	Salvage bool
+	// StrictCRC makes Salvage fail when a gzip member's trailer checksum does
+	// not match, rather than keeping the data it decoded. Without Salvage a
+	// mismatch always fails the expansion.
+	StrictCRC bool
+	// Normalization selects how entry names that are not in Unicode NFC are
+	// handled. By default they are written as stored.
+	Normalization expand.Normalization
+	// Hidden selects hidden files and directories to leave out.
+	Hidden expand.HiddenFiles
+	// MemoryGuard, if set, is reserved the memory each expansion buffers,
+	// throttling expansions running in parallel.
+	MemoryGuard *expand.MemoryGuard
+	// Streaming extracts in constant memory however many entries the
+	// archive holds, by counting the entries in the manifest rather than
+	// listing them, see expand.Manifest.Streamed. Normalization other than
+	// expand.KeepNames still remembers every name.
+	Streaming bool
 }
 
-func (t *TarExpander) Expand(ctx context.Context, src, dst string, umask os.FileMode) error {
+// Memory reserved from a MemoryGuard for the decompressor state, besides the
+// copy buffer. The bzip2 decoder holds a block of up to 900k words.
+const (
+	gzipMemory  = 64 * 1024
+	bzip2Memory = 4 * 1024 * 1024
+)
+
+// memoryEstimate returns the memory an expansion of src buffers.
+func memoryEstimate(src string) int64 {
+	switch {
+	case expand.HasExtension(src, gzipExtensions...):
+		return expand.BufferSize + gzipMemory
+	case expand.HasExtension(src, bzip2Extensions...):
+		return expand.BufferSize + bzip2Memory
+	default:
+		return expand.BufferSize
+	}
+}
 
-	src, err := pathExpanderFunc(src)
+// options carries the settings of a TarExpander into the extraction helpers.
+type options struct {
+	fileSizeLimit   int64
+	filesLimit      int
+	continueOnError bool
+	salvage         bool
+	strictCRC       bool
+	normalization   expand.Normalization
+	hidden          expand.HiddenFiles
+	streaming       bool
+	// sandbox restricts the entries written, it may be nil.
+	sandbox *expand.Sandbox
+	// faults injects failures in tests, it may be nil.
+	faults faults.Hook
+	// trace receives the security checks performed, it may be nil.
+	trace *metadata.SecurityTrace
+}
+
+// errIllegalPath is returned for entries that would be written outside of
+// the destination.
+var errIllegalPath = errors.New("illegal file path")
+
+func (t *TarExpander) options() options {
+	return options{
+		fileSizeLimit:   t.FileSizeLimit,
+		filesLimit:      t.FilesLimit,
+		continueOnError: t.ContinueOnError,
+		salvage:         t.Salvage,
+		strictCRC:       t.StrictCRC,
+		normalization:   t.Normalization,
+		hidden:          t.Hidden,
+		streaming:       t.Streaming,
+	}
+}
+
+// WithHiddenFiles returns a copy of t that leaves out the hidden files
+// selected by h.
+func (t *TarExpander) WithHiddenFiles(h expand.HiddenFiles) expand.Expander {
+	c := *t
+	c.Hidden = h
+	return &c
+}
+
+// WithLimits returns a copy of t that enforces l.
+func (t *TarExpander) WithLimits(l expand.Limits) expand.Expander {
+	c := *t
+	if l.FileSize != 0 {
+		c.FileSizeLimit = l.FileSize
+	}
+	if l.Files != 0 {
+		c.FilesLimit = l.Files
+	}
+	return &c
+}
+
+func (t *TarExpander) Expand(ctx context.Context, src, dst string, umask os.FileMode) (out *expand.Manifest, err error) {
+	ctx, span := tracing.Start(ctx, "expand", attribute.String("expand.format", "tar"), attribute.String("expand.source", src))
+	defer func() {
+		if out != nil {
+			span.SetAttributes(attribute.Int("files", out.Stats.Entries), attribute.Int64("bytes", out.Stats.Bytes))
+		}
+		tracing.End(span, err)
+	}()
+
+	defer func() { err = fserrors.Classify(err) }()
+
+	src, err = pathExpanderFunc(src)
 	if err != nil {
-		return fmt.Errorf("failed to expand source path: %w", err)
+		return nil, fmt.Errorf("failed to expand source path: %w", err)
 	}
 	dst, err = pathExpanderFunc(dst)
 	if err != nil {
-		return fmt.Errorf("failed to expand destination path: %w", err)
+		return nil, fmt.Errorf("failed to expand destination path: %w", err)
+	}
+
+	file, err := os.Open(src)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open source file: %s", src)
 	}
+	defer file.Close()
+	// Reading through the context makes extraction stop once it is cancelled
+	input := helpers.NewContextReader(ctx, file)
 
-	input, err := os.Open(src)
+	release, err := t.MemoryGuard.Reserve(ctx, memoryEstimate(src))
 	if err != nil {
-		return fmt.Errorf("failed to open source file: %s", src)
+		return nil, err
 	}
-	defer input.Close()
+	defer release()
+
+	start := time.Now()
+	var m *expand.Manifest
+	defer func() {
+		if m != nil {
+			m.Finish(time.Since(start))
+		}
+	}()
+
+	opts := t.options()
+	opts.trace = metadata.SecurityTraceFromContext(ctx)
+	opts.sandbox = expand.SandboxFromContext(ctx)
+	opts.faults = faults.FromContext(ctx)
+	defer func() {
+		if errors.Is(err, expand.ErrIntegrity) {
+			opts.trace.Record(metadata.SecurityCheck{Check: "crc32", Subject: src, Outcome: metadata.CheckRejected, Detail: err.Error()})
+		}
+	}()
 
-	if strings.Contains(src, "tar.gz") || strings.Contains(src, "tgz") {
-		if err = extractTarGzFunc(input, dst, t.FileSizeLimit, t.FilesLimit); err != nil {
-			return fmt.Errorf("failed to extract tar.gz file: %s", err)
+	// The manifest is returned even on error when ContinueOnError is set, so
+	// callers can see what was extracted alongside what failed.
+	if expand.HasExtension(src, gzipExtensions...) {
+		if m, err = extractTarGzFunc(input, dst, opts); err != nil {
+			return m, fmt.Errorf("failed to extract tar.gz file: %w", err)
 		}
-	} else if strings.Contains(src, "tar.bz2") || strings.Contains(src, "tbz2") {
-		if err = extractTarBzFunc(input, dst, src, t.FileSizeLimit, t.FilesLimit); err != nil {
-			return fmt.Errorf("failed to extract tar.bz2 file: %s", err)
+		if !opts.salvage {
+			opts.trace.Record(metadata.SecurityCheck{Check: "crc32", Subject: src, Outcome: metadata.CheckPassed, Detail: "gzip trailer checksum verified"})
+		}
+	} else if expand.HasExtension(src, bzip2Extensions...) {
+		if m, err = extractTarBzFunc(input, dst, src, opts); err != nil {
+			return m, fmt.Errorf("failed to extract tar.bz2 file: %w", err)
 		}
 	} else {
-		if err = untarFunc(input, dst, src, t.FileSizeLimit, t.FilesLimit); err != nil {
-			return fmt.Errorf("failed to untar file: %s", err)
+		if m, err = untarFunc(input, dst, src, opts); err != nil {
+			return m, fmt.Errorf("failed to untar file: %w", err)
 		}
 	}
 
-	if err != nil {
-		return fmt.Errorf("failed to get destination directory size: %s", dst)
+	// Salvage mode treats read failures as damage, so make sure a
+	// cancellation is not reported as a successful partial extraction
+	if err := ctx.Err(); err != nil {
+		return m, err
 	}
 
-	return nil
+	return m, nil
 }
 
+// Matcher reports whether fileName, a file name, URL or the "tar" format
+// name, ends in one of the supported tarball extensions.
 func (t *TarExpander) Matcher(fileName string) bool {
-	extensions := []string{"tar", "tgz", "tbz2"}
-	for _, ext := range extensions {
-		if strings.Contains(fileName, ext) {
-			return true
-		}
-	}
-	return false
+	return expand.HasExtension(fileName, "tar") ||
+		expand.HasExtension(fileName, gzipExtensions...) ||
+		expand.HasExtension(fileName, bzip2Extensions...)
 }
 
 // extractTarBz is a helper function that extracts a tarball compressed with bzip2 to a destination directory
-func extractTarBz(input io.Reader, dst, src string, fileSizeLimit int64, filesLimit int) error {
+func extractTarBz(input io.Reader, dst, src string, opts options) (*expand.Manifest, error) {
 	bzr := bzip2.NewReader(input)
-	return untar(bzr, dst, src, fileSizeLimit, filesLimit)
+	return untar(bzr, dst, src, opts)
 }
 
 // extractTarGz is a helper function that extracts a tarball compressed with gzip to a destination directory
-func extractTarGz(input io.Reader, dst string, fileSizeLimit int64, filesLimit int) error {
-	gzr, err := gzip.NewReader(input)
+func extractTarGz(input io.Reader, dst string, opts options) (*expand.Manifest, error) {
+	var zr io.Reader
+	if opts.salvage {
+		zr = newGzipSalvageReader(input, opts.strictCRC)
+	} else {
+		gzr, err := gzip.NewReader(input)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create gzip reader: %s", err)
+		}
+		defer gzr.Close()
+		zr = gzipChecksumReader{gzr}
+	}
+
+	m, err := untar(zr, dst, "", opts)
 	if err != nil {
-		return fmt.Errorf("failed to create gzip reader: %s", err)
+		return m, err
 	}
-	defer gzr.Close()
 
-	return untar(gzr, dst, "", fileSizeLimit, filesLimit)
+	// The tar reader stops at the end-of-archive marker, so read through
+	// any remaining padding to have the gzip trailer verified.
+	for {
+		_, err := io.Copy(io.Discard, zr)
+		if err == nil {
+			return m, nil
+		}
+		if !errors.Is(err, errDamagedMember) {
+			return nil, err
+		}
+	}
+}
+
+// gzipChecksumReader reports gzip trailer checksum failures as
+// expand.IntegrityError.
+type gzipChecksumReader struct {
+	r io.Reader
+}
+
+func (g gzipChecksumReader) Read(p []byte) (int, error) {
+	n, err := g.r.Read(p)
+	if errors.Is(err, gzip.ErrChecksum) {
+		err = &expand.IntegrityError{Check: "crc32", Err: err}
+	}
+	return n, err
 }
 
 // untar is a helper function that untars a tarball to a destination directory based on the provided options.
-func untar(input io.Reader, dst, src string, fileSizeLimit int64, filesLimit int) error {
+func untar(input io.Reader, dst, src string, opts options) (*expand.Manifest, error) {
+	manifest := expand.NewManifest(dst)
+	if opts.streaming {
+		manifest = expand.NewStreamingManifest(dst)
+	}
+
+	// In salvage mode the stream position is tracked so a damaged region can
+	// be skipped by resynchronizing on the next valid header.
+	var br *blockReader
+	if opts.salvage {
+		br = &blockReader{r: input}
+		input = br
+		manifest.Salvage = &expand.SalvageReport{}
+	}
 	tarReader := tar.NewReader(input)
 
-	seenDirs := map[string]*tar.Header{}
+	// Directory attributes are applied once their contents are written
+	var dirs dirAttrs
+	defer dirs.close()
 	now := time.Now()
+	buf := make([]byte, expand.BufferSize)
+	normalizer := expand.NewNameNormalizer(opts.normalization)
 
 	var (
 		totalFileSize int64
 		filesCount    int
+		sanitized     int
+		entryErrs     expand.EntryErrors
 	)
 
+	if opts.fileSizeLimit > 0 {
+		opts.trace.Record(metadata.SecurityCheck{Check: "size-limit", Subject: src, Outcome: metadata.CheckApplied, Detail: fmt.Sprintf("%d bytes", opts.fileSizeLimit)})
+	}
+	if opts.filesLimit > 0 {
+		opts.trace.Record(metadata.SecurityCheck{Check: "file-count-limit", Subject: src, Outcome: metadata.CheckApplied, Detail: fmt.Sprintf("%d files", opts.filesLimit)})
+	}
+
 	// Initialize a counter for headers processed
 	headerCount := 0
 
@@ -129,21 +344,30 @@ func untar(input io.Reader, dst, src string, fileSizeLimit int64, filesLimit int
 		header, err := tarReader.Next()
 		if err == io.EOF {
 			if headerCount == 0 {
-				return fmt.Errorf("tar file is empty: %s", src)
+				return nil, fmt.Errorf("tar file is empty: %s", src)
 			}
 			break
 		}
 		if err != nil {
-			return fmt.Errorf("error reading tar header: %w", err)
+			if !opts.salvage || errors.Is(err, expand.ErrIntegrity) {
+				return nil, fmt.Errorf("error reading tar header: %w", err)
+			}
+			manifest.Salvage.Skipped++
+			if br, err = br.resync(); err != nil {
+				break
+			}
+			tarReader = tar.NewReader(br)
+			continue
 		}
 
 		headerCount++
 
 		// Validate the file count limit
-		if filesLimit > 0 {
+		if opts.filesLimit > 0 {
 			filesCount++
-			if filesCount > filesLimit {
-				return fmt.Errorf("tar file contains more files than the %d allowed: %d", filesLimit, filesCount)
+			if filesCount > opts.filesLimit {
+				opts.trace.Record(metadata.SecurityCheck{Check: "file-count-limit", Subject: src, Outcome: metadata.CheckRejected, Detail: fmt.Sprintf("more than %d files", opts.filesLimit)})
+				return nil, fmt.Errorf("tar file contains more files than the %d allowed: %d", opts.filesLimit, filesCount)
 			}
 		}
 
@@ -152,10 +376,18 @@ func untar(input io.Reader, dst, src string, fileSizeLimit int64, filesLimit int
 			continue
 		}
 
-		// Construct the file path safely to prevent Zip Slip
-		fPath := filepath.Join(dst, header.Name) // #nosec G305 we're checking the path below
-		if !strings.HasPrefix(filepath.Clean(fPath), filepath.Clean(dst)+string(os.PathSeparator)) {
-			return fmt.Errorf("illegal file path: %s", fPath)
+		if header.Name, err = normalizer.Normalize(manifest, header.Name); err != nil {
+			return nil, err
+		}
+		if opts.hidden.Excludes(header.Name) {
+			manifest.AddSkipped(header.Name, metadata.SkipHidden, "")
+			continue
+		}
+		if ok, err := opts.sandbox.Check(opts.trace, header.Name, header.Typeflag == tar.TypeDir); err != nil {
+			return nil, err
+		} else if !ok {
+			manifest.AddSkipped(header.Name, metadata.SkipSandbox, "")
+			continue
 		}
 
 		fileInfo := header.FileInfo()
@@ -163,78 +395,146 @@ func untar(input io.Reader, dst, src string, fileSizeLimit int64, filesLimit int
 			totalFileSize += fileInfo.Size()
 
 			// Enforce file size limit
-			if fileSizeLimit > 0 && totalFileSize > fileSizeLimit {
-				return fmt.Errorf("tar file size exceeds the %d limit: %d", fileSizeLimit, totalFileSize)
+			if opts.fileSizeLimit > 0 && totalFileSize > opts.fileSizeLimit {
+				opts.trace.Record(metadata.SecurityCheck{Check: "size-limit", Subject: src, Outcome: metadata.CheckRejected, Detail: fmt.Sprintf("%d bytes exceeds %d", totalFileSize, opts.fileSizeLimit)})
+				return nil, fmt.Errorf("%w: tar file size exceeds the %d limit: %d", expand.ErrSizeLimitExceeded, opts.fileSizeLimit, totalFileSize)
 			}
 		}
 
-		if fileInfo.IsDir() {
-			// Create directories and store their headers for later permission/timestamp adjustment
-			if err := os.MkdirAll(fPath, 0755); err != nil { // Use a reasonable default, e.g., 0755
-				return fmt.Errorf("failed to create directory (%s): %w", fPath, err)
+		err = faults.Check(opts.faults, faults.Entry, header.Name, 0)
+		if err == nil {
+			err = extractEntry(tarReader, header, dst, now, manifest, &dirs, buf, opts.faults)
+		}
+		if errors.Is(err, errIllegalPath) {
+			opts.trace.Record(metadata.SecurityCheck{Check: "path-sanitization", Subject: header.Name, Outcome: metadata.CheckRejected, Detail: "entry escapes the destination"})
+		} else {
+			sanitized++
+		}
+		var se *streamError
+		if opts.salvage && errors.As(err, &se) && !errors.Is(err, expand.ErrIntegrity) {
+			manifest.Salvage.Skipped++
+			manifest.AddSkipped(header.Name, metadata.SkipFailed, err.Error())
+			if br, err = br.resync(); err != nil {
+				break
 			}
-			seenDirs[fPath] = header
+			tarReader = tar.NewReader(br)
 			continue
 		}
-
-		// Ensure the parent directory exists
-		destPath := filepath.Dir(fPath)
-		if _, err := os.Stat(destPath); os.IsNotExist(err) {
-			if err := os.MkdirAll(destPath, 0755); err != nil { // Use a reasonable default
-				return fmt.Errorf("failed to create directory (%s): %w", destPath, err)
-			}
+		if err := entryErrs.Collect(header.Name, err, opts.continueOnError); err != nil {
+			return nil, err
 		}
-		// Extract the file
-
-		// Create the file with header.Mode permissions
-		outFile, err := os.OpenFile(fPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, header.FileInfo().Mode())
 		if err != nil {
-			return fmt.Errorf("error creating file (%s): %w", fPath, err)
+			manifest.AddSkipped(header.Name, metadata.SkipFailed, err.Error())
 		}
+	}
 
-		// Copy file content
-		if _, err := io.Copy(outFile, tarReader); err != nil {
-			outFile.Close()
-			return fmt.Errorf("error extracting file (%s): %w", fPath, err)
-		}
-		outFile.Close()
+	// Adjust directory permissions and timestamps
+	err := dirs.each(func(a dirAttr) error {
+		name, _ := filepath.Rel(dst, a.path)
+		return entryErrs.Collect(filepath.ToSlash(name), setDirAttributes(a), opts.continueOnError)
+	})
+	if err != nil {
+		return nil, err
+	}
 
-		// Set file times
-		aTime, mTime := now, now
-		if !header.AccessTime.IsZero() {
-			aTime = header.AccessTime
-		}
-		if !header.ModTime.IsZero() {
-			mTime = header.ModTime
-		}
-		if err := os.Chtimes(fPath, aTime, mTime); err != nil {
-			return fmt.Errorf("failed to change file times (%s): %w", fPath, err)
-		}
+	opts.trace.Record(metadata.SecurityCheck{Check: "path-sanitization", Subject: src, Outcome: metadata.CheckPassed, Detail: fmt.Sprintf("%d entries confined to the destination", sanitized)})
+
+	if manifest.Salvage != nil {
+		manifest.Salvage.Recovered = manifest.Stats.Entries
+	}
+	if err := entryErrs.Err(); err != nil {
+		return manifest, err
 	}
+	return manifest, nil
+}
 
-	// Adjust directory permissions and timestamps
-	for path, dirHeader := range seenDirs {
-		// Set permissions
-		if err := os.Chmod(path, dirHeader.FileInfo().Mode()); err != nil {
-			return fmt.Errorf("failed to change directory permissions (%s): %w", path, err)
-		}
+// extractEntry writes a single tar entry below dst, recording it in the
+// manifest. Directories are remembered in dirs so their permissions and
+// timestamps can be applied once all of their contents have been written.
+func extractEntry(tarReader *tar.Reader, header *tar.Header, dst string, now time.Time, manifest *expand.Manifest, dirs *dirAttrs, buf []byte, hook faults.Hook) error {
+	// Construct the file path safely to prevent Zip Slip
+	fPath := filepath.Join(dst, header.Name) // #nosec G305 we're checking the path below
+	if !strings.HasPrefix(filepath.Clean(fPath), filepath.Clean(dst)+string(os.PathSeparator)) {
+		return fmt.Errorf("%w: %s", errIllegalPath, fPath)
+	}
 
-		// Set timestamps
-		aTime, mTime := now, now
-		if !dirHeader.AccessTime.IsZero() {
-			aTime = dirHeader.AccessTime
+	fileInfo := header.FileInfo()
+	if fileInfo.IsDir() {
+		// Create directories and store their headers for later permission/timestamp adjustment
+		if err := os.MkdirAll(fPath, 0755); err != nil { // Use a reasonable default, e.g., 0755
+			return fmt.Errorf("failed to create directory (%s): %w", fPath, err)
 		}
-		if !dirHeader.ModTime.IsZero() {
-			mTime = dirHeader.ModTime
+		aTime, mTime := entryTimes(header, now)
+		if err := dirs.add(dirAttr{path: fPath, mode: fileInfo.Mode(), aTime: aTime, mTime: mTime}); err != nil {
+			return err
 		}
-		if err := os.Chtimes(path, aTime, mTime); err != nil {
-			return fmt.Errorf("failed to change directory times (%s): %w", path, err)
+		manifest.AddDir(fPath, fileInfo.Mode())
+		return nil
+	}
+
+	// Ensure the parent directory exists
+	destPath := filepath.Dir(fPath)
+	if _, err := os.Stat(destPath); os.IsNotExist(err) {
+		if err := os.MkdirAll(destPath, 0755); err != nil { // Use a reasonable default
+			return fmt.Errorf("failed to create directory (%s): %w", destPath, err)
 		}
 	}
+	// Extract the file
+
+	// Create the file with header.Mode permissions
+	outFile, err := os.OpenFile(fPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, fileInfo.Mode())
+	if err != nil {
+		return fmt.Errorf("error creating file (%s): %w", fPath, err)
+	}
+
+	// Copy file content, hashing it for the manifest. A partially written
+	// file is removed so it is never mistaken for a complete one.
+	w, sum := expand.Hasher(faults.Writer(hook, header.Name, outFile))
+	written, err := manifest.Stats.Copy(w, streamErrorReader{tarReader}, buf)
+	if err != nil {
+		outFile.Close()
+		os.Remove(fPath)
+		return fmt.Errorf("error extracting file (%s): %w", fPath, err)
+	}
+	outFile.Close()
+	manifest.AddFile(fPath, written, fileInfo.Mode(), sum)
+
+	// Set file times
+	aTime, mTime := entryTimes(header, now)
+	if err := os.Chtimes(fPath, aTime, mTime); err != nil {
+		return fmt.Errorf("failed to change file times (%s): %w", fPath, err)
+	}
+	return nil
+}
+
+// entryTimes returns the access and modification times of header, now for
+// those it does not record.
+func entryTimes(header *tar.Header, now time.Time) (aTime, mTime time.Time) {
+	aTime, mTime = now, now
+	if !header.AccessTime.IsZero() {
+		aTime = header.AccessTime
+	}
+	if !header.ModTime.IsZero() {
+		mTime = header.ModTime
+	}
+	return aTime, mTime
+}
+
+// setDirAttributes applies the permissions and timestamps recorded for a
+// directory.
+func setDirAttributes(a dirAttr) error {
+	// Set permissions
+	if err := os.Chmod(a.path, a.mode); err != nil {
+		return fmt.Errorf("failed to change directory permissions (%s): %w", a.path, err)
+	}
 
+	// Set timestamps
+	if err := os.Chtimes(a.path, a.aTime, a.mTime); err != nil {
+		return fmt.Errorf("failed to change directory times (%s): %w", a.path, err)
+	}
 	return nil
 }
 
 func init() {
-	expand.RegisterExpander(&TarExpander{})
+	expand.RegisterFormat("tar", &TarExpander{}, expand.DefaultPriority)
 }
@@ -21,13 +21,22 @@ import (
 	"bytes"
 	"compress/gzip"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	bzip2 "github.com/dsnet/compress/bzip2"
+
+	"github.com/enterprise-contract/go-gather/expand"
+	"github.com/enterprise-contract/go-gather/faults"
+	"github.com/enterprise-contract/go-gather/metadata"
 )
 
 // TestTarExpander_Matcher tests the Matcher method for different file names.
@@ -59,6 +68,46 @@ func TestTarExpander_Matcher(t *testing.T) {
 			fileName: "archive.zip",
 			want:     false,
 		},
+		{
+			name:     "tar substring",
+			fileName: "tarball-notes.txt",
+			want:     false,
+		},
+		{
+			name:     "tgz with query string",
+			fileName: "https://example.com/bundle.tgz?sig=abc",
+			want:     true,
+		},
+		{
+			name:     "tar.gz with fragment",
+			fileName: "bundle.tar.gz#policy",
+			want:     true,
+		},
+		{
+			name:     "upper case tar.bz2",
+			fileName: "ARCHIVE.TAR.BZ2",
+			want:     true,
+		},
+		{
+			name:     "tar inside name",
+			fileName: "backup.tar.bak",
+			want:     false,
+		},
+		{
+			name:     "gz without tar",
+			fileName: "file.gz",
+			want:     false,
+		},
+		{
+			name:     "tar directory",
+			fileName: "/srv/tar/readme.md",
+			want:     false,
+		},
+		{
+			name:     "tar format name",
+			fileName: "tar",
+			want:     true,
+		},
 	}
 
 	for _, tc := range testCases {
@@ -85,7 +134,7 @@ func TestTarExpander_Expand_Tar(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	err = tarExpander.Expand(ctx, srcFile, dstDir, 0)
+	_, err = tarExpander.Expand(ctx, srcFile, dstDir, 0)
 	if err != nil {
 		t.Fatalf("Expand returned an unexpected error: %v", err)
 	}
@@ -110,7 +159,7 @@ func TestTarExpander_Expand_TarGz(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	err = tarExpander.Expand(ctx, srcFile, dstDir, 0)
+	_, err = tarExpander.Expand(ctx, srcFile, dstDir, 0)
 	if err != nil {
 		t.Fatalf("Expand returned an unexpected error: %v", err)
 	}
@@ -135,7 +184,7 @@ func TestTarExpander_Expand_TarBz2(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	err = tarExpander.Expand(ctx, srcFile, dstDir, 0)
+	_, err = tarExpander.Expand(ctx, srcFile, dstDir, 0)
 	if err != nil {
 		t.Fatalf("Expand returned an unexpected error: %v", err)
 	}
@@ -146,6 +195,455 @@ func TestTarExpander_Expand_TarBz2(t *testing.T) {
 	}
 }
 
+// TestTarExpander_Expand_Manifest checks the returned manifest describes the extracted file.
+func TestTarExpander_Expand_Manifest(t *testing.T) {
+	tarExpander := &TarExpander{}
+
+	tempDir := t.TempDir()
+	srcFile := filepath.Join(tempDir, "test.tar")
+	dstDir := filepath.Join(tempDir, "output")
+
+	if err := createTarFile(srcFile, "hello.txt", "Hello, world!"); err != nil {
+		t.Fatalf("failed to create tar file: %v", err)
+	}
+
+	m, err := tarExpander.Expand(context.Background(), srcFile, dstDir, 0)
+	if err != nil {
+		t.Fatalf("Expand returned an unexpected error: %v", err)
+	}
+	if len(m.Entries) != 1 {
+		t.Fatalf("expected 1 manifest entry, got %d", len(m.Entries))
+	}
+	e := m.Entries[0]
+	if e.Path != "hello.txt" || e.Size != int64(len("Hello, world!")) || e.SHA256 == "" {
+		t.Errorf("unexpected manifest entry: %+v", e)
+	}
+	if err := m.Verify(); err != nil {
+		t.Errorf("manifest verification failed: %v", err)
+	}
+}
+
+// TestTarExpander_Expand_Stats checks the manifest reports the expansion's
+// stats and the memory reserved from the guard is given back.
+func TestTarExpander_Expand_Stats(t *testing.T) {
+	guard := expand.NewMemoryGuard(1 << 20)
+	tarExpander := &TarExpander{MemoryGuard: guard}
+
+	tempDir := t.TempDir()
+	srcFile := filepath.Join(tempDir, "test.tar.gz")
+	dstDir := filepath.Join(tempDir, "output")
+
+	if err := createTarGzFile(srcFile, "hello.txt", "Hello, world!"); err != nil {
+		t.Fatalf("failed to create tar file: %v", err)
+	}
+
+	m, err := tarExpander.Expand(context.Background(), srcFile, dstDir, 0)
+	if err != nil {
+		t.Fatalf("Expand returned an unexpected error: %v", err)
+	}
+	s := m.Stats
+	if s.Entries != 1 || s.Bytes != int64(len("Hello, world!")) {
+		t.Errorf("unexpected stats: %+v", s)
+	}
+	if s.PeakBuffered <= 0 || s.PeakBuffered > expand.BufferSize {
+		t.Errorf("expected peak buffered within (0, %d], got %d", expand.BufferSize, s.PeakBuffered)
+	}
+	if s.Duration <= 0 {
+		t.Errorf("expected a positive duration, got %v", s.Duration)
+	}
+	if n := guard.InUse(); n != 0 {
+		t.Errorf("expected the guard to be released, %d bytes still reserved", n)
+	}
+}
+
+// TestTarExpander_Expand_Streaming checks streaming mode counts entries
+// rather than listing them, and still applies the attributes of directories
+// spilled to disk.
+func TestTarExpander_Expand_Streaming(t *testing.T) {
+	old := dirSpillThreshold
+	dirSpillThreshold = 4
+	defer func() { dirSpillThreshold = old }()
+
+	srcFile := filepath.Join(t.TempDir(), "dirs.tar")
+	f, err := os.Create(srcFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mTime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	tw := tar.NewWriter(f)
+	for i := 0; i < 10; i++ {
+		dir := fmt.Sprintf("dir%d/", i)
+		if err := tw.WriteHeader(&tar.Header{Name: dir, Typeflag: tar.TypeDir, Mode: 0750, ModTime: mTime}); err != nil {
+			t.Fatal(err)
+		}
+		if err := tw.WriteHeader(&tar.Header{Name: dir + "file", Mode: 0600, Size: 2}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte("hi")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: ".hidden", Mode: 0600}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	dstDir := t.TempDir()
+	m, err := (&TarExpander{Streaming: true, Hidden: expand.HiddenFiles{All: true}}).Expand(context.Background(), srcFile, dstDir, 0)
+	if err != nil {
+		t.Fatalf("Expand returned an unexpected error: %v", err)
+	}
+	if !m.Streamed || len(m.Entries) != 0 || len(m.Skipped) != 0 {
+		t.Errorf("expected a streamed manifest without entries, got %+v", m)
+	}
+	if m.Stats.Entries != 20 || m.Stats.Bytes != 20 || m.Stats.Skipped != 1 {
+		t.Errorf("unexpected stats: %+v", m.Stats)
+	}
+	for i := 0; i < 10; i++ {
+		info, err := os.Stat(filepath.Join(dstDir, fmt.Sprintf("dir%d", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != 0750 || !info.ModTime().Equal(mTime) {
+			t.Errorf("dir%d: got mode %v and mtime %v", i, info.Mode(), info.ModTime())
+		}
+	}
+}
+
+func TestTarExpander_ExtractEntry(t *testing.T) {
+	tarExpander := &TarExpander{}
+
+	srcFile := filepath.Join(t.TempDir(), "test.tar.gz")
+	if err := createTarGzFile(srcFile, "greeting.txt", "Hello from tar.gz!"); err != nil {
+		t.Fatalf("failed to create tar file: %v", err)
+	}
+
+	var out bytes.Buffer
+	n, err := tarExpander.ExtractEntry(context.Background(), srcFile, "greeting.txt", &out)
+	if err != nil {
+		t.Fatalf("ExtractEntry returned an unexpected error: %v", err)
+	}
+	if n != int64(out.Len()) || out.String() != "Hello from tar.gz!" {
+		t.Errorf("unexpected entry contents %q (%d bytes)", out.String(), n)
+	}
+
+	if _, err := tarExpander.ExtractEntry(context.Background(), srcFile, "missing.txt", io.Discard); !errors.Is(err, expand.ErrEntryNotFound) {
+		t.Errorf("expected ErrEntryNotFound, got %v", err)
+	}
+}
+
+// TestTarExpander_List checks the listing matches the manifest Expand
+// produces, without writing to disk.
+func TestTarExpander_List(t *testing.T) {
+	tarExpander := &TarExpander{}
+
+	tempDir := t.TempDir()
+	srcFile := filepath.Join(tempDir, "test.tar")
+	dstDir := filepath.Join(tempDir, "output")
+
+	err := createMultiTarFile(srcFile, []tarTestEntry{
+		{name: "a.txt", content: "a"},
+		{name: "dir/b.txt", content: "bb"},
+	})
+	if err != nil {
+		t.Fatalf("failed to create tar file: %v", err)
+	}
+
+	entries, err := tarExpander.List(context.Background(), srcFile)
+	if err != nil {
+		t.Fatalf("List returned an unexpected error: %v", err)
+	}
+	if _, err := os.Stat(dstDir); !os.IsNotExist(err) {
+		t.Fatalf("List wrote to disk")
+	}
+
+	m, err := tarExpander.Expand(context.Background(), srcFile, dstDir, 0)
+	if err != nil {
+		t.Fatalf("Expand returned an unexpected error: %v", err)
+	}
+	if len(entries) != len(m.Entries) {
+		t.Fatalf("expected %d entries, got %d", len(m.Entries), len(entries))
+	}
+	for i, e := range entries {
+		want := m.Entries[i]
+		if e.Path != want.Path || e.Size != want.Size || e.SHA256 != want.SHA256 {
+			t.Errorf("entry %d: expected %+v, got %+v", i, want, e)
+		}
+	}
+}
+
+// TestTarExpander_Expand_SecurityTrace checks the protections applied are
+// recorded to the trace carried by the context.
+func TestTarExpander_Expand_SecurityTrace(t *testing.T) {
+	tempDir := t.TempDir()
+	srcFile := filepath.Join(tempDir, "test.tar")
+
+	err := createMultiTarFile(srcFile, []tarTestEntry{
+		{name: "a.txt", content: "a"},
+		{name: "dir/b.txt", content: "b"},
+	})
+	if err != nil {
+		t.Fatalf("failed to create tar file: %v", err)
+	}
+
+	testCases := []struct {
+		name     string
+		expander *TarExpander
+		wantErr  bool
+		want     []metadata.SecurityCheck
+	}{
+		{
+			name:     "within limits",
+			expander: &TarExpander{FileSizeLimit: 1024, FilesLimit: 10},
+			want: []metadata.SecurityCheck{
+				{Check: "size-limit", Subject: srcFile, Outcome: metadata.CheckApplied, Detail: "1024 bytes"},
+				{Check: "file-count-limit", Subject: srcFile, Outcome: metadata.CheckApplied, Detail: "10 files"},
+				{Check: "path-sanitization", Subject: srcFile, Outcome: metadata.CheckPassed, Detail: "2 entries confined to the destination"},
+			},
+		},
+		{
+			name:     "file count exceeded",
+			expander: &TarExpander{FilesLimit: 1},
+			wantErr:  true,
+			want: []metadata.SecurityCheck{
+				{Check: "file-count-limit", Subject: srcFile, Outcome: metadata.CheckApplied, Detail: "1 files"},
+				{Check: "file-count-limit", Subject: srcFile, Outcome: metadata.CheckRejected, Detail: "more than 1 files"},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ctx, trace := metadata.WithSecurityTrace(context.Background())
+			_, err := tc.expander.Expand(ctx, srcFile, t.TempDir(), 0)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("Expand returned error %v, want error: %v", err, tc.wantErr)
+			}
+			got := trace.Checks()
+			if len(got) != len(tc.want) {
+				t.Fatalf("expected %d checks, got %+v", len(tc.want), got)
+			}
+			for i := range tc.want {
+				if got[i] != tc.want[i] {
+					t.Errorf("check %d: expected %+v, got %+v", i, tc.want[i], got[i])
+				}
+			}
+		})
+	}
+}
+
+// TestTarExpander_Expand_Normalization checks decomposed entry names are
+// written in NFC and reported when requested.
+func TestTarExpander_Expand_Normalization(t *testing.T) {
+	tempDir := t.TempDir()
+	srcFile := filepath.Join(tempDir, "test.tar")
+	dstDir := filepath.Join(tempDir, "output")
+
+	err := createMultiTarFile(srcFile, []tarTestEntry{{name: "cafe\u0301.rego", content: "package cafe"}})
+	if err != nil {
+		t.Fatalf("failed to create tar file: %v", err)
+	}
+
+	tarExpander := &TarExpander{Normalization: expand.NormalizeNFC}
+	m, err := tarExpander.Expand(context.Background(), srcFile, dstDir, 0)
+	if err != nil {
+		t.Fatalf("Expand returned an unexpected error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dstDir, "caf\u00e9.rego")); err != nil {
+		t.Errorf("expected the NFC name to be written: %v", err)
+	}
+	if len(m.Warnings) != 1 || !strings.Contains(m.Warnings[0], "normalized") {
+		t.Errorf("expected a normalization warning, got %v", m.Warnings)
+	}
+
+	entries, err := tarExpander.List(context.Background(), srcFile)
+	if err != nil {
+		t.Fatalf("List returned an unexpected error: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Path != "caf\u00e9.rego" {
+		t.Errorf("expected List to report the NFC name, got %+v", entries)
+	}
+}
+
+func TestTarExpander_Expand_Hidden(t *testing.T) {
+	tempDir := t.TempDir()
+	srcFile := filepath.Join(tempDir, "test.tar")
+	dstDir := filepath.Join(tempDir, "output")
+
+	err := createMultiTarFile(srcFile, []tarTestEntry{
+		{name: ".git/config", content: "[core]"},
+		{name: "policy/.github/ci.yaml", content: "on: push"},
+		{name: "policy/.hidden", content: "kept"},
+		{name: "policy/main.rego", content: "package main"},
+	})
+	if err != nil {
+		t.Fatalf("failed to create tar file: %v", err)
+	}
+
+	tarExpander := (&TarExpander{}).WithHiddenFiles(expand.ExcludeGitFiles).(*TarExpander)
+	m, err := tarExpander.Expand(context.Background(), srcFile, dstDir, 0)
+	if err != nil {
+		t.Fatalf("Expand returned an unexpected error: %v", err)
+	}
+	for _, name := range []string{".git", "policy/.github"} {
+		if _, err := os.Stat(filepath.Join(dstDir, name)); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be left out, got %v", name, err)
+		}
+	}
+	var paths []string
+	for _, e := range m.Entries {
+		if !e.Mode.IsDir() {
+			paths = append(paths, e.Path)
+		}
+	}
+	if strings.Join(paths, ",") != "policy/.hidden,policy/main.rego" {
+		t.Errorf("unexpected files extracted: %v", paths)
+	}
+	var skipped []string
+	for _, s := range m.Skipped {
+		if s.Reason == metadata.SkipHidden {
+			skipped = append(skipped, s.Path)
+		}
+	}
+	if strings.Join(skipped, ",") != ".git/config,policy/.github/ci.yaml" {
+		t.Errorf("unexpected hidden files reported as skipped: %+v", m.Skipped)
+	}
+
+	entries, err := tarExpander.List(context.Background(), srcFile)
+	if err != nil {
+		t.Fatalf("List returned an unexpected error: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("expected List to leave out hidden files, got %+v", entries)
+	}
+}
+
+func TestTarExpander_Expand_Sandbox(t *testing.T) {
+	tempDir := t.TempDir()
+	srcFile := filepath.Join(tempDir, "test.tar")
+
+	err := createMultiTarFile(srcFile, []tarTestEntry{
+		{name: "policy/main.rego", content: "package main"},
+		{name: "README.md", content: "# bundle"},
+	})
+	if err != nil {
+		t.Fatalf("failed to create tar file: %v", err)
+	}
+
+	ctx := expand.WithSandbox(context.Background(), expand.Sandbox{Allow: []string{"policy"}})
+	_, err = (&TarExpander{}).Expand(ctx, srcFile, filepath.Join(tempDir, "strict"), 0)
+	if !errors.Is(err, expand.ErrOutsideSandbox) {
+		t.Fatalf("expected ErrOutsideSandbox, got %v", err)
+	}
+
+	dstDir := filepath.Join(tempDir, "skip")
+	ctx = expand.WithSandbox(context.Background(), expand.Sandbox{Allow: []string{"policy"}, Skip: true})
+	m, err := (&TarExpander{}).Expand(ctx, srcFile, dstDir, 0)
+	if err != nil {
+		t.Fatalf("Expand returned an unexpected error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dstDir, "policy", "main.rego")); err != nil {
+		t.Errorf("expected policy/main.rego to be extracted: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dstDir, "README.md")); !os.IsNotExist(err) {
+		t.Errorf("expected README.md to be left out, got %v", err)
+	}
+	want := []metadata.SkippedEntry{{Path: "README.md", Reason: metadata.SkipSandbox}}
+	if !reflect.DeepEqual(m.Skipped, want) {
+		t.Errorf("expected README.md to be reported as skipped, got %+v", m.Skipped)
+	}
+}
+
+// TestTarExpander_Expand_InjectedFaults checks injected failures are
+// handled like real ones: the failing entry is removed and reported.
+func TestTarExpander_Expand_InjectedFaults(t *testing.T) {
+	tempDir := t.TempDir()
+	srcFile := filepath.Join(tempDir, "test.tar")
+	err := createMultiTarFile(srcFile, []tarTestEntry{
+		{name: "a.txt", content: "first file"},
+		{name: "b.txt", content: "second file"},
+	})
+	if err != nil {
+		t.Fatalf("failed to create tar file: %v", err)
+	}
+
+	for name, hook := range map[string]faults.Hook{
+		"on entry":    faults.OnEntry("b.txt"),
+		"after bytes": faults.AfterBytes(4),
+	} {
+		t.Run(name, func(t *testing.T) {
+			dstDir := filepath.Join(t.TempDir(), "output")
+			ctx := faults.WithHook(context.Background(), hook)
+			m, err := (&TarExpander{ContinueOnError: true}).Expand(ctx, srcFile, dstDir, 0)
+			if !errors.Is(err, faults.ErrInjected) {
+				t.Fatalf("expected an injected fault, got %v", err)
+			}
+			for _, s := range m.Skipped {
+				if s.Reason != metadata.SkipFailed {
+					t.Errorf("unexpected skipped entry: %+v", s)
+				}
+				if _, err := os.Stat(filepath.Join(dstDir, s.Path)); !os.IsNotExist(err) {
+					t.Errorf("expected the failed entry %s to be removed, got %v", s.Path, err)
+				}
+			}
+			if len(m.Skipped) == 0 {
+				t.Error("expected the failed entries to be reported as skipped")
+			}
+		})
+	}
+}
+
+// TestTarExpander_Expand_ContinueOnError checks failing entries are collected
+// while the remaining entries are still extracted.
+func TestTarExpander_Expand_ContinueOnError(t *testing.T) {
+	tempDir := t.TempDir()
+	srcFile := filepath.Join(tempDir, "partial.tar")
+	dstDir := filepath.Join(tempDir, "output")
+
+	err := createMultiTarFile(srcFile, []tarTestEntry{
+		{"good.txt", "good"},
+		{"blocked/inner.txt", "cannot be written"},
+		{"after.txt", "after"},
+	})
+	if err != nil {
+		t.Fatalf("failed to create tar file: %v", err)
+	}
+
+	// A regular file where a directory is needed makes one entry fail.
+	if err := os.MkdirAll(dstDir, 0755); err != nil {
+		t.Fatalf("failed to create output directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dstDir, "blocked"), nil, 0644); err != nil {
+		t.Fatalf("failed to create blocking file: %v", err)
+	}
+
+	ctx := context.Background()
+	if _, err := (&TarExpander{}).Expand(ctx, srcFile, dstDir, 0); err == nil {
+		t.Fatal("expected Expand to fail without ContinueOnError")
+	}
+
+	m, err := (&TarExpander{ContinueOnError: true}).Expand(ctx, srcFile, dstDir, 0)
+	var entryErrs expand.EntryErrors
+	if !errors.As(err, &entryErrs) {
+		t.Fatalf("expected expand.EntryErrors, got %v", err)
+	}
+	if len(entryErrs) != 1 || entryErrs[0].Entry != "blocked/inner.txt" {
+		t.Errorf("unexpected entry errors: %v", entryErrs)
+	}
+	if m == nil || len(m.Entries) != 2 {
+		t.Fatalf("expected manifest with 2 entries, got %+v", m)
+	}
+	if len(m.Skipped) != 1 || m.Skipped[0].Path != "blocked/inner.txt" || m.Skipped[0].Reason != metadata.SkipFailed {
+		t.Errorf("expected blocked/inner.txt to be reported as failed, got %+v", m.Skipped)
+	}
+	if _, err := os.Stat(filepath.Join(dstDir, "after.txt")); err != nil {
+		t.Errorf("expected after.txt to be extracted: %v", err)
+	}
+}
+
 // TestTarExpander_Expand_InvalidSource checks behavior when the source file doesn't exist.
 func TestTarExpander_Expand_InvalidSource(t *testing.T) {
 	tarExpander := &TarExpander{}
@@ -155,13 +653,78 @@ func TestTarExpander_Expand_InvalidSource(t *testing.T) {
 	dstDir := filepath.Join(tempDir, "output")
 
 	ctx := context.Background()
-	err := tarExpander.Expand(ctx, nonExistentSrc, dstDir, 0)
+	_, err := tarExpander.Expand(ctx, nonExistentSrc, dstDir, 0)
 	if err == nil {
 		t.Fatalf("expected error when source file does not exist")
 	}
 }
 
+// TestTarExpander_Expand_Cancelled ensures a cancelled context stops the
+// extraction, including in salvage mode where read errors are otherwise
+// treated as damage.
+func TestTarExpander_Expand_Cancelled(t *testing.T) {
+	for _, salvage := range []bool{false, true} {
+		tarExpander := &TarExpander{Salvage: salvage}
+
+		tempDir := t.TempDir()
+		srcFile := filepath.Join(tempDir, "test.tar")
+		dstDir := filepath.Join(tempDir, "output")
+
+		if err := createTarFile(srcFile, "hello.txt", "Hello, world!"); err != nil {
+			t.Fatalf("failed to create tar file: %v", err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := tarExpander.Expand(ctx, srcFile, dstDir, 0)
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("salvage=%v: expected context.Canceled, got %v", salvage, err)
+		}
+		if _, err := os.Stat(filepath.Join(dstDir, "hello.txt")); !os.IsNotExist(err) {
+			t.Errorf("salvage=%v: expected nothing to be extracted, stat returned %v", salvage, err)
+		}
+	}
+}
+
 // createTarFile creates a simple .tar with one file.
+// TestTarExpander_Expand_Concurrent shares one expander between parallel
+// expansions that apply different limits through WithLimits.
+func TestTarExpander_Expand_Concurrent(t *testing.T) {
+	tempDir := t.TempDir()
+	srcFile := filepath.Join(tempDir, "test.tar.gz")
+	if err := createTarGzFile(srcFile, "file.txt", "more than ten bytes"); err != nil {
+		t.Fatalf("failed to create tar.gz file: %v", err)
+	}
+
+	shared := &TarExpander{FilesLimit: 10}
+	var wg sync.WaitGroup
+	errs := make([]error, 8)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var e expand.Expander = shared
+			if i%2 == 1 {
+				e = shared.WithLimits(expand.Limits{FileSize: 10})
+			}
+			_, errs[i] = e.Expand(context.Background(), srcFile, filepath.Join(tempDir, fmt.Sprint(i)), 0)
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if i%2 == 0 && err != nil {
+			t.Errorf("expansion %d without a size limit failed: %v", i, err)
+		}
+		if i%2 == 1 && err == nil {
+			t.Errorf("expansion %d with a size limit succeeded", i)
+		}
+	}
+	if shared.FileSizeLimit != 0 || shared.FilesLimit != 10 {
+		t.Errorf("shared expander was modified: %+v", shared)
+	}
+}
+
 func createTarFile(filePath string, fileName string, content string) error {
 	f, err := os.Create(filePath)
 	if err != nil {
@@ -252,3 +815,36 @@ func createTarBz2File(filePath, fileName, content string) error {
 
 	return nil
 }
+
+// tarTestEntry is a regular file to be written into a test tarball.
+type tarTestEntry struct {
+	name    string
+	content string
+}
+
+// createMultiTarFile creates a .tar file containing the given regular files.
+func createMultiTarFile(filePath string, entries []tarTestEntry) error {
+	f, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	tw := tar.NewWriter(f)
+	defer tw.Close()
+
+	for _, e := range entries {
+		hdr := &tar.Header{
+			Name: e.name,
+			Mode: 0600,
+			Size: int64(len(e.content)),
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := tw.Write([]byte(e.content)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,152 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package zip
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/google/safearchive/zip"
+
+	"github.com/enterprise-contract/go-gather/expand"
+	"github.com/enterprise-contract/go-gather/internal/helpers"
+)
+
+// List reads the ZIP archive at src and returns the entries Expand would
+// write, with the size and digest of every file, without writing anything.
+func (z *ZipExpander) List(ctx context.Context, src string) ([]expand.ManifestEntry, error) {
+	var entries []expand.ManifestEntry
+	err := z.walk(ctx, src, func(e expand.ManifestEntry) bool {
+		entries = append(entries, e)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// walk reads the ZIP archive at src and calls fn with each entry List
+// returns, in order, until fn returns false.
+func (z *ZipExpander) walk(ctx context.Context, src string, fn func(expand.ManifestEntry) bool) error {
+	src, err := pathExpanderFunc(src)
+	if err != nil {
+		return fmt.Errorf("failed to expand source path: %w", err)
+	}
+	archive, err := zip.OpenReader(src)
+	if err != nil {
+		return fmt.Errorf("failed to open zip file %q: %w", src, err)
+	}
+	defer archive.Close()
+
+	normalizer := expand.NewNameNormalizer(z.Normalization)
+	for _, f := range archive.File {
+		name, err := normalizer.Normalize(expand.NewManifest(""), f.Name)
+		if err != nil {
+			return err
+		}
+		name = strings.TrimSuffix(path.Clean(name), "/")
+		if z.Hidden.Excludes(name) {
+			continue
+		}
+		if f.FileInfo().IsDir() {
+			if !fn(expand.ManifestEntry{Path: name, Mode: f.Mode() | os.ModeDir}) {
+				return nil
+			}
+			continue
+		}
+
+		r, err := f.Open()
+		if err != nil {
+			return fmt.Errorf("failed to open source file %q: %w", f.Name, err)
+		}
+		w, sum := expand.Hasher(io.Discard)
+		size, err := io.Copy(w, helpers.NewContextReader(ctx, r))
+		r.Close()
+		if err != nil {
+			return fmt.Errorf("error reading file %q: %w", f.Name, err)
+		}
+		e := expand.ManifestEntry{
+			Path:   name,
+			Size:   size,
+			Mode:   f.Mode(),
+			SHA256: hex.EncodeToString(sum.Sum(nil)),
+		}
+		if !fn(e) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// ExtractEntry writes the contents of the file name in the ZIP archive at src
+// to w. It returns expand.ErrEntryNotFound if there is no such file.
+func (z *ZipExpander) ExtractEntry(ctx context.Context, src, name string, w io.Writer) (int64, error) {
+	src, err := pathExpanderFunc(src)
+	if err != nil {
+		return 0, fmt.Errorf("failed to expand source path: %w", err)
+	}
+	archive, err := zip.OpenReader(src)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open zip file %q: %w", src, err)
+	}
+	defer archive.Close()
+
+	want := path.Clean(strings.TrimPrefix(name, "/"))
+	normalizer := expand.NewNameNormalizer(z.Normalization)
+	for _, f := range archive.File {
+		got, err := normalizer.Normalize(expand.NewManifest(""), f.Name)
+		if err != nil {
+			return 0, err
+		}
+		got = strings.TrimSuffix(path.Clean(got), "/")
+		if got != want || z.Hidden.Excludes(got) {
+			continue
+		}
+		if !f.Mode().IsRegular() {
+			return 0, fmt.Errorf("%s is not a regular file", name)
+		}
+		if z.FileSizeLimit > 0 && f.FileInfo().Size() > z.FileSizeLimit {
+			return 0, fmt.Errorf("%w: file %q exceeds size limit of %d bytes", expand.ErrSizeLimitExceeded, f.Name, z.FileSizeLimit)
+		}
+
+		r, err := f.Open()
+		if err != nil {
+			return 0, fmt.Errorf("failed to open source file %q: %w", f.Name, err)
+		}
+		defer r.Close()
+		var input io.Reader = helpers.NewContextReader(ctx, r)
+		if z.FileSizeLimit > 0 {
+			// The declared size is not to be trusted
+			input = io.LimitReader(input, z.FileSizeLimit+1)
+		}
+		n, err := io.Copy(w, input)
+		if err != nil {
+			return n, fmt.Errorf("error reading file %q: %w", f.Name, err)
+		}
+		if z.FileSizeLimit > 0 && n > z.FileSizeLimit {
+			return n, fmt.Errorf("%w: extracted file %q exceeds size limit of %d bytes", expand.ErrSizeLimitExceeded, f.Name, z.FileSizeLimit)
+		}
+		return n, nil
+	}
+	return 0, fmt.Errorf("%w: %s", expand.ErrEntryNotFound, name)
+}
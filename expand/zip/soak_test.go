@@ -0,0 +1,78 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package zip
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/enterprise-contract/go-gather/internal/soak"
+)
+
+// TestZipExpander_Expand_Soak extracts a synthetic multi-gigabyte zip,
+// checking memory use does not grow with the size of its entries and the
+// number of open files stays bounded.
+func TestZipExpander_Expand_Soak(t *testing.T) {
+	size := soak.Size(t)
+	const fileSize = 256 << 20
+
+	src := filepath.Join(t.TempDir(), "soak.zip")
+	f, err := os.Create(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	for i := 0; i < 10000; i++ {
+		if _, err := zw.Create(fmt.Sprintf("d%04d/", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	zeros := make([]byte, 1<<20)
+	for written := int64(0); written < size; written += fileSize {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: fmt.Sprintf("file%d", written/fileSize), Method: zip.Store})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for n := 0; n < fileSize; n += len(zeros) {
+			if _, err := w.Write(zeros); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	sampler := soak.Start(100 * time.Millisecond)
+	m, err := (&ZipExpander{Streaming: true}).Expand(context.Background(), src, t.TempDir(), 0755)
+	sampler.Stop()
+	if err != nil {
+		t.Fatalf("Expand returned an error: %v", err)
+	}
+	if m.Stats.Bytes < size {
+		t.Errorf("extracted %d bytes, want at least %d", m.Stats.Bytes, size)
+	}
+	sampler.Check(t, 64<<20, 4)
+}
@@ -18,94 +18,231 @@ package zip
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"hash/crc32"
 	"io"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/google/safearchive/zip"
+	"go.opentelemetry.io/otel/attribute"
 
 	"github.com/enterprise-contract/go-gather/expand"
+	"github.com/enterprise-contract/go-gather/faults"
+	"github.com/enterprise-contract/go-gather/fserrors"
 	"github.com/enterprise-contract/go-gather/internal/helpers"
+	"github.com/enterprise-contract/go-gather/internal/tracing"
+	"github.com/enterprise-contract/go-gather/metadata"
 )
 
 var pathExpanderFunc = helpers.ExpandPath
 
+// errIllegalPath is returned for entries that would be written outside of
+// the destination.
+var errIllegalPath = errors.New("illegal file path")
+
 // ZipExpander provides functionality to extract ZIP archives.
 type ZipExpander struct {
 	FileSizeLimit int64
 	FilesLimit    int
+	// ContinueOnError keeps extracting when an individual entry fails,
+	// returning the manifest of what was extracted together with an
+	// expand.EntryErrors listing the entries that failed. Entries declaring
+	// a size above FileSizeLimit still abort the expansion.
+	ContinueOnError bool
+	// StrictCRC also verifies entries that record a CRC-32 of zero. Such
+	// entries are otherwise extracted unchecked, as there is no checksum to
+	// compare against.
+	StrictCRC bool
+	// Normalization selects how entry names that are not in Unicode NFC are
+	// handled. By default they are written as stored.
+	Normalization expand.Normalization
+	// Hidden selects hidden files and directories to leave out.
+	Hidden expand.HiddenFiles
+	// MemoryGuard, if set, is reserved the memory each expansion buffers,
+	// throttling expansions running in parallel.
+	MemoryGuard *expand.MemoryGuard
+	// Streaming counts the entries in the manifest rather than listing
+	// them, see expand.Manifest.Streamed. The central directory of the
+	// archive is still read into memory up front, as the zip format
+	// requires, so memory use grows with the number of entries but not
+	// with their size.
+	Streaming bool
+}
+
+// flateMemory is the memory reserved from a MemoryGuard for the state of the
+// decompressor, besides the copy buffer.
+const flateMemory = 64 * 1024
+
+// WithHiddenFiles returns a copy of z that leaves out the hidden files
+// selected by h.
+func (z *ZipExpander) WithHiddenFiles(h expand.HiddenFiles) expand.Expander {
+	c := *z
+	c.Hidden = h
+	return &c
+}
+
+// WithLimits returns a copy of z that enforces l.
+func (z *ZipExpander) WithLimits(l expand.Limits) expand.Expander {
+	c := *z
+	if l.FileSize != 0 {
+		c.FileSizeLimit = l.FileSize
+	}
+	if l.Files != 0 {
+		c.FilesLimit = l.Files
+	}
+	return &c
 }
 
 // Expand extracts a ZIP file to the specified destination directory.
 // It handles tilde expansion, enforces file size limits, and ensures secure extraction.
-func (z *ZipExpander) Expand(ctx context.Context, src, dst string, umask os.FileMode) error {
-	src, err := pathExpanderFunc(src)
+// The returned manifest lists every extracted file and directory.
+func (z *ZipExpander) Expand(ctx context.Context, src, dst string, umask os.FileMode) (out *expand.Manifest, err error) {
+	ctx, span := tracing.Start(ctx, "expand", attribute.String("expand.format", "zip"), attribute.String("expand.source", src))
+	defer func() {
+		if out != nil {
+			span.SetAttributes(attribute.Int("files", out.Stats.Entries), attribute.Int64("bytes", out.Stats.Bytes))
+		}
+		tracing.End(span, err)
+	}()
+
+	defer func() { err = fserrors.Classify(err) }()
+
+	src, err = pathExpanderFunc(src)
 	if err != nil {
-		return fmt.Errorf("failed to expand source path: %w", err)
+		return nil, fmt.Errorf("failed to expand source path: %w", err)
 	}
 
 	dst, err = pathExpanderFunc(dst)
 	if err != nil {
-		return fmt.Errorf("failed to expand destination path: %w", err)
+		return nil, fmt.Errorf("failed to expand destination path: %w", err)
 	}
 
 	// Open the ZIP archive
 	archive, err := zip.OpenReader(src)
 	if err != nil {
-		return fmt.Errorf("failed to open zip file %q: %w", src, err)
+		return nil, fmt.Errorf("failed to open zip file %q: %w", src, err)
 	}
 	defer archive.Close()
 
+	release, err := z.MemoryGuard.Reserve(ctx, expand.BufferSize+flateMemory)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	start := time.Now()
+	manifest := expand.NewManifest(dst)
+	if z.Streaming {
+		manifest = expand.NewStreamingManifest(dst)
+	}
+	defer func() { manifest.Finish(time.Since(start)) }()
+
 	// Prepare a buffer for copying file contents
-	const bufferSize = 32 * 1024 // 32 KB
-	buffer := make([]byte, bufferSize)
+	buffer := make([]byte, expand.BufferSize)
+
+	if z.FileSizeLimit > 0 {
+		metadata.RecordCheck(ctx, metadata.SecurityCheck{Check: "size-limit", Subject: src, Outcome: metadata.CheckApplied, Detail: fmt.Sprintf("%d bytes per file", z.FileSizeLimit)})
+	}
 
 	// Iterate over files in the archive
+	var entryErrs expand.EntryErrors
+	var sanitized, verified int
+	normalizer := expand.NewNameNormalizer(z.Normalization)
+	sandbox := expand.SandboxFromContext(ctx)
 	for _, f := range archive.File {
-		// Enforce file size limit if set
-		if z.FileSizeLimit > 0 && f.FileInfo().Size() > z.FileSizeLimit {
-			return fmt.Errorf("file %q exceeds size limit of %d bytes", f.Name, z.FileSizeLimit)
+		if err := ctx.Err(); err != nil {
+			return nil, err
 		}
 
-		// Construct full file path. safearchive prevents Zip Slip.
-		filePath := filepath.Join(dst, f.Name) // nolint:gosec
-
-		if !strings.HasPrefix(filePath, filepath.Clean(dst)+string(os.PathSeparator)) {
-			return fmt.Errorf("illegal file path: %s", filePath)
+		if f.Name, err = normalizer.Normalize(manifest, f.Name); err != nil {
+			return nil, err
 		}
-
-		// Handle directories
-		if f.FileInfo().IsDir() {
-			if err := os.MkdirAll(filePath, umask); err != nil {
-				return fmt.Errorf("failed to create directory %q: %w", filePath, err)
-			}
+		if z.Hidden.Excludes(f.Name) {
+			manifest.AddSkipped(f.Name, metadata.SkipHidden, "")
+			continue
+		}
+		if ok, err := sandbox.Check(metadata.SecurityTraceFromContext(ctx), f.Name, f.FileInfo().IsDir()); err != nil {
+			return nil, err
+		} else if !ok {
+			manifest.AddSkipped(f.Name, metadata.SkipSandbox, "")
 			continue
 		}
 
-		// Ensure destination directory exists
-		if err := os.MkdirAll(filepath.Dir(filePath), umask); err != nil {
-			return fmt.Errorf("failed to create directory %q: %w", filepath.Dir(filePath), err)
+		// Enforce file size limit if set
+		if z.FileSizeLimit > 0 && f.FileInfo().Size() > z.FileSizeLimit {
+			metadata.RecordCheck(ctx, metadata.SecurityCheck{Check: "size-limit", Subject: f.Name, Outcome: metadata.CheckRejected, Detail: fmt.Sprintf("declared size %d exceeds %d", f.FileInfo().Size(), z.FileSizeLimit)})
+			return nil, fmt.Errorf("%w: file %q exceeds size limit of %d bytes", expand.ErrSizeLimitExceeded, f.Name, z.FileSizeLimit)
 		}
 
-		// Extract the file
-		if err := z.extractFile(f, filePath, buffer); err != nil {
-			return err
+		err := faults.Check(faults.FromContext(ctx), faults.Entry, f.Name, 0)
+		if err == nil {
+			err = z.extractEntry(ctx, f, dst, umask, buffer, manifest)
+		}
+		if !errors.Is(err, errIllegalPath) {
+			sanitized++
+		}
+		if err == nil && !f.FileInfo().IsDir() && (f.CRC32 != 0 || z.StrictCRC) {
+			verified++
+		}
+		if err := entryErrs.Collect(f.Name, err, z.ContinueOnError); err != nil {
+			return nil, err
+		}
+		if err != nil {
+			manifest.AddSkipped(f.Name, metadata.SkipFailed, err.Error())
 		}
 	}
 
-	return nil
+	metadata.RecordCheck(ctx, metadata.SecurityCheck{Check: "path-sanitization", Subject: src, Outcome: metadata.CheckPassed, Detail: fmt.Sprintf("%d entries confined to the destination", sanitized)})
+	metadata.RecordCheck(ctx, metadata.SecurityCheck{Check: "crc32", Subject: src, Outcome: metadata.CheckPassed, Detail: fmt.Sprintf("%d files verified", verified)})
+
+	if err := entryErrs.Err(); err != nil {
+		return manifest, err
+	}
+	return manifest, nil
 }
 
-// extractFile handles the extraction of a single file from the ZIP archive.
-func (z *ZipExpander) extractFile(f *zip.File, filePath string, buffer []byte) error {
+// extractEntry extracts a single file or directory from the archive below dst.
+func (z *ZipExpander) extractEntry(ctx context.Context, f *zip.File, dst string, umask os.FileMode, buffer []byte, manifest *expand.Manifest) error {
+	// Construct full file path. safearchive prevents Zip Slip.
+	filePath := filepath.Join(dst, f.Name) // nolint:gosec
+
+	if !strings.HasPrefix(filePath, filepath.Clean(dst)+string(os.PathSeparator)) {
+		metadata.RecordCheck(ctx, metadata.SecurityCheck{Check: "path-sanitization", Subject: f.Name, Outcome: metadata.CheckRejected, Detail: "entry escapes the destination"})
+		return fmt.Errorf("%w: %s", errIllegalPath, filePath)
+	}
+
+	// Handle directories
+	if f.FileInfo().IsDir() {
+		if err := os.MkdirAll(filePath, umask); err != nil {
+			return fmt.Errorf("failed to create directory %q: %w", filePath, err)
+		}
+		manifest.AddDir(filePath, f.Mode())
+		return nil
+	}
+
+	// Ensure destination directory exists
+	if err := os.MkdirAll(filepath.Dir(filePath), umask); err != nil {
+		return fmt.Errorf("failed to create directory %q: %w", filepath.Dir(filePath), err)
+	}
+
+	// Extract the file
+	return z.extractFile(ctx, f, filePath, buffer, manifest)
+}
+
+// extractFile handles the extraction of a single file from the ZIP archive,
+// recording it in the manifest once fully written.
+func (z *ZipExpander) extractFile(ctx context.Context, f *zip.File, filePath string, buffer []byte, manifest *expand.Manifest) error {
 	// Open the source file within the archive
 	srcFile, err := f.Open()
 	if err != nil {
 		return fmt.Errorf("failed to open source file %q: %w", f.Name, err)
 	}
 	defer srcFile.Close()
+	src := helpers.NewContextReader(ctx, srcFile)
 
 	// Open the destination file
 	dstFile, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, f.Mode())
@@ -113,36 +250,62 @@ func (z *ZipExpander) extractFile(f *zip.File, filePath string, buffer []byte) e
 		return fmt.Errorf("failed to create file %q: %w", filePath, err)
 	}
 	defer dstFile.Close()
+	w, sum := expand.Hasher(faults.Writer(faults.FromContext(ctx), f.Name, dstFile))
+	crc := crc32.NewIEEE()
+	w = io.MultiWriter(w, crc)
 
 	// Enforce file size limit during copy
 	var totalBytes int64
 	for {
-		n, err := srcFile.Read(buffer)
+		n, err := src.Read(buffer)
 		if n > 0 {
+			manifest.Stats.Buffered(n)
 			totalBytes += int64(n)
 			if z.FileSizeLimit > 0 && totalBytes > z.FileSizeLimit {
-				return fmt.Errorf("extracted file %q exceeds size limit of %d bytes", f.Name, z.FileSizeLimit)
+				metadata.RecordCheck(ctx, metadata.SecurityCheck{Check: "size-limit", Subject: f.Name, Outcome: metadata.CheckRejected, Detail: fmt.Sprintf("extracted size exceeds %d", z.FileSizeLimit)})
+				return fmt.Errorf("%w: extracted file %q exceeds size limit of %d bytes", expand.ErrSizeLimitExceeded, f.Name, z.FileSizeLimit)
 			}
-			if _, writeErr := dstFile.Write(buffer[:n]); writeErr != nil {
+			if _, writeErr := w.Write(buffer[:n]); writeErr != nil {
 				return fmt.Errorf("failed to write to file %q: %w", filePath, writeErr)
 			}
 		}
 		if err == io.EOF {
 			break
 		}
+		if errors.Is(err, zip.ErrChecksum) {
+			return crcError(ctx, f, crc.Sum32(), err)
+		}
 		if err != nil {
 			return fmt.Errorf("error reading file %q: %w", f.Name, err)
 		}
 	}
 
+	// The zip reader only verifies entries with a non-zero CRC-32
+	if z.StrictCRC && f.CRC32 == 0 && crc.Sum32() != 0 {
+		return crcError(ctx, f, crc.Sum32(), zip.ErrChecksum)
+	}
+
+	manifest.AddFile(filePath, totalBytes, f.Mode(), sum)
 	return nil
 }
 
+// crcError reports a CRC-32 mismatch for a zip entry.
+func crcError(ctx context.Context, f *zip.File, actual uint32, err error) error {
+	metadata.RecordCheck(ctx, metadata.SecurityCheck{Check: "crc32", Subject: f.Name, Outcome: metadata.CheckRejected, Detail: fmt.Sprintf("expected %08x, got %08x", f.CRC32, actual)})
+	return &expand.IntegrityError{
+		Entry:    f.Name,
+		Check:    "crc32",
+		Expected: fmt.Sprintf("%08x", f.CRC32),
+		Actual:   fmt.Sprintf("%08x", actual),
+		Err:      err,
+	}
+}
+
 // Matcher checks if the extension matches supported formats.
 func (z *ZipExpander) Matcher(extension string) bool {
-	return strings.Contains(extension, "zip")
+	return expand.HasExtension(extension, "zip")
 }
 
 func init() {
-	expand.RegisterExpander(&ZipExpander{})
+	expand.RegisterFormat("zip", &ZipExpander{}, expand.DefaultPriority)
 }
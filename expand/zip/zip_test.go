@@ -18,14 +18,22 @@ package zip_test
 
 import (
 	"archive/zip"
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"hash/crc32"
 	"io"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
 
+	"github.com/enterprise-contract/go-gather/expand"
 	customzip "github.com/enterprise-contract/go-gather/expand/zip"
+	"github.com/enterprise-contract/go-gather/metadata"
 )
 
 // TestZipExpander_Matcher verifies that the Matcher function correctly identifies .zip files.
@@ -39,6 +47,11 @@ func TestZipExpander_Matcher(t *testing.T) {
 	}{
 		{"zip extension", "archive.zip", true},
 		{"no zip extension", "archive.tar", false},
+		{"zip substring", "zipcode.txt", false},
+		{"zip in directory", "/srv/zip/readme.md", false},
+		{"zip with query", "https://example.com/bundle.zip?sig=abc", true},
+		{"zip with fragment", "bundle.zip#policy", true},
+		{"zip format name", "zip", true},
 	}
 
 	for _, tc := range testCases {
@@ -66,7 +79,7 @@ func TestZipExpander_Expand_SimpleZip(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	if err := z.Expand(ctx, srcZip, dstDir, 0755); err != nil {
+	if _, err := z.Expand(ctx, srcZip, dstDir, 0755); err != nil {
 		t.Fatalf("Expand returned an unexpected error: %v", err)
 	}
 
@@ -96,9 +109,16 @@ func TestZipExpander_Expand_WithDirectories(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	if err := z.Expand(ctx, srcZip, dstDir, 0755); err != nil {
+	m, err := z.Expand(ctx, srcZip, dstDir, 0755)
+	if err != nil {
 		t.Fatalf("Expand returned an unexpected error: %v", err)
 	}
+	if len(m.Entries) != len(files) {
+		t.Errorf("expected %d manifest entries, got %d", len(files), len(m.Entries))
+	}
+	if err := m.Verify(); err != nil {
+		t.Errorf("manifest verification failed: %v", err)
+	}
 
 	checkPaths := []string{
 		filepath.Join(dstDir, "folder1"),
@@ -113,6 +133,139 @@ func TestZipExpander_Expand_WithDirectories(t *testing.T) {
 	}
 }
 
+// TestZipExpander_List checks entries are listed with their digests and
+// nothing is extracted.
+func TestZipExpander_List(t *testing.T) {
+	z := &customzip.ZipExpander{}
+
+	tempDir := t.TempDir()
+	srcZip := filepath.Join(tempDir, "test.zip")
+
+	files := []zipTestFile{
+		{Name: "folder1/", IsDir: true},
+		{Name: "folder1/nested.txt", Content: "Nested content"},
+	}
+	if err := createZipFile(srcZip, files); err != nil {
+		t.Fatalf("failed to create zip file: %v", err)
+	}
+
+	entries, err := z.List(context.Background(), srcZip)
+	if err != nil {
+		t.Fatalf("List returned an unexpected error: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+	if entries[0].Path != "folder1" || !entries[0].Mode.IsDir() {
+		t.Errorf("unexpected directory entry: %+v", entries[0])
+	}
+	sum := sha256.Sum256([]byte("Nested content"))
+	if e := entries[1]; e.Path != "folder1/nested.txt" || e.Size != 14 || e.SHA256 != hex.EncodeToString(sum[:]) {
+		t.Errorf("unexpected file entry: %+v", e)
+	}
+}
+
+func TestZipExpander_ExtractEntry(t *testing.T) {
+	z := &customzip.ZipExpander{}
+
+	srcZip := filepath.Join(t.TempDir(), "test.zip")
+	files := []zipTestFile{
+		{Name: "folder1/", IsDir: true},
+		{Name: "folder1/nested.txt", Content: "Nested content"},
+		{Name: "other.txt", Content: "Other content"},
+	}
+	if err := createZipFile(srcZip, files); err != nil {
+		t.Fatalf("failed to create zip file: %v", err)
+	}
+
+	var out bytes.Buffer
+	n, err := z.ExtractEntry(context.Background(), srcZip, "/folder1/nested.txt", &out)
+	if err != nil {
+		t.Fatalf("ExtractEntry returned an unexpected error: %v", err)
+	}
+	if n != 14 || out.String() != "Nested content" {
+		t.Errorf("unexpected entry contents %q (%d bytes)", out.String(), n)
+	}
+
+	if _, err := z.ExtractEntry(context.Background(), srcZip, "missing.txt", io.Discard); !errors.Is(err, expand.ErrEntryNotFound) {
+		t.Errorf("expected ErrEntryNotFound, got %v", err)
+	}
+	if _, err := z.ExtractEntry(context.Background(), srcZip, "folder1", io.Discard); err == nil {
+		t.Error("expected an error extracting a directory")
+	}
+}
+
+func TestZipExpander_Expand_Hidden(t *testing.T) {
+	tempDir := t.TempDir()
+	srcZip := filepath.Join(tempDir, "test.zip")
+	dstDir := filepath.Join(tempDir, "output")
+
+	files := []zipTestFile{
+		{Name: ".env", Content: "SECRET=1"},
+		{Name: "folder1/", IsDir: true},
+		{Name: "folder1/.cache/", IsDir: true},
+		{Name: "folder1/.cache/data", Content: "cached"},
+		{Name: "folder1/nested.txt", Content: "Nested content"},
+	}
+	if err := createZipFile(srcZip, files); err != nil {
+		t.Fatalf("failed to create zip file: %v", err)
+	}
+
+	z := &customzip.ZipExpander{Hidden: expand.HiddenFiles{All: true}}
+	m, err := z.Expand(context.Background(), srcZip, dstDir, 0)
+	if err != nil {
+		t.Fatalf("Expand returned an unexpected error: %v", err)
+	}
+	if len(m.Entries) != 2 {
+		t.Errorf("expected only folder1 and its visible file, got %+v", m.Entries)
+	}
+	for _, name := range []string{".env", "folder1/.cache"} {
+		if _, err := os.Stat(filepath.Join(dstDir, name)); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be left out, got %v", name, err)
+		}
+	}
+
+	entries, err := z.List(context.Background(), srcZip)
+	if err != nil {
+		t.Fatalf("List returned an unexpected error: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Errorf("expected List to leave out hidden files, got %+v", entries)
+	}
+}
+
+// TestZipExpander_Expand_SecurityTrace checks the protections applied are
+// recorded to the trace carried by the context.
+func TestZipExpander_Expand_SecurityTrace(t *testing.T) {
+	z := &customzip.ZipExpander{FileSizeLimit: 1024}
+
+	tempDir := t.TempDir()
+	srcZip := filepath.Join(tempDir, "test.zip")
+	if err := createZipFile(srcZip, []zipTestFile{{Name: "a.txt", Content: "a"}}); err != nil {
+		t.Fatalf("failed to create zip file: %v", err)
+	}
+
+	ctx, trace := metadata.WithSecurityTrace(context.Background())
+	if _, err := z.Expand(ctx, srcZip, filepath.Join(tempDir, "output"), 0755); err != nil {
+		t.Fatalf("Expand returned an unexpected error: %v", err)
+	}
+
+	want := []metadata.SecurityCheck{
+		{Check: "size-limit", Subject: srcZip, Outcome: metadata.CheckApplied, Detail: "1024 bytes per file"},
+		{Check: "path-sanitization", Subject: srcZip, Outcome: metadata.CheckPassed, Detail: "1 entries confined to the destination"},
+		{Check: "crc32", Subject: srcZip, Outcome: metadata.CheckPassed, Detail: "1 files verified"},
+	}
+	got := trace.Checks()
+	if len(got) != len(want) {
+		t.Fatalf("expected %d checks, got %+v", len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("check %d: expected %+v, got %+v", i, want[i], got[i])
+		}
+	}
+}
+
 // TestZipExpander_Expand_SizeLimit checks that an error is raised if a file exceeds the size limit.
 func TestZipExpander_Expand_SizeLimit(t *testing.T) {
 	z := &customzip.ZipExpander{
@@ -131,12 +284,53 @@ func TestZipExpander_Expand_SizeLimit(t *testing.T) {
 	}
 
 	ctx := context.Background()
-	err := z.Expand(ctx, srcZip, dstDir, 0755)
+	_, err := z.Expand(ctx, srcZip, dstDir, 0755)
 	if err == nil {
 		t.Fatalf("expected an error due to file size limit exceeded, but got nil")
 	}
 }
 
+// TestZipExpander_Expand_Concurrent shares one expander between parallel
+// expansions that apply different limits through WithLimits.
+func TestZipExpander_Expand_Concurrent(t *testing.T) {
+	tempDir := t.TempDir()
+	srcZip := filepath.Join(tempDir, "test.zip")
+	if err := createZipFile(srcZip, []zipTestFile{
+		{Name: "a.txt", Content: "more than ten bytes"},
+		{Name: "b.txt", Content: "small"},
+	}); err != nil {
+		t.Fatalf("failed to create zip file: %v", err)
+	}
+
+	shared := &customzip.ZipExpander{}
+	var wg sync.WaitGroup
+	errs := make([]error, 8)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var e expand.Expander = shared
+			if i%2 == 1 {
+				e = shared.WithLimits(expand.Limits{FileSize: 10})
+			}
+			_, errs[i] = e.Expand(context.Background(), srcZip, filepath.Join(tempDir, fmt.Sprint(i)), 0755)
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if i%2 == 0 && err != nil {
+			t.Errorf("expansion %d without a size limit failed: %v", i, err)
+		}
+		if i%2 == 1 && err == nil {
+			t.Errorf("expansion %d with a size limit succeeded", i)
+		}
+	}
+	if shared.FileSizeLimit != 0 {
+		t.Errorf("shared expander was modified: %+v", shared)
+	}
+}
+
 // TestZipExpander_Expand_InvalidSource checks that an error is returned if the source file does not exist.
 func TestZipExpander_Expand_InvalidSource(t *testing.T) {
 	z := &customzip.ZipExpander{}
@@ -146,12 +340,130 @@ func TestZipExpander_Expand_InvalidSource(t *testing.T) {
 	dstDir := filepath.Join(tempDir, "output")
 
 	ctx := context.Background()
-	err := z.Expand(ctx, nonExistentZip, dstDir, 0755)
+	_, err := z.Expand(ctx, nonExistentZip, dstDir, 0755)
 	if err == nil {
 		t.Fatalf("expected error when source file doesn't exist")
 	}
 }
 
+// TestZipExpander_Expand_ContinueOnError checks failing entries are collected
+// while the remaining entries are still extracted.
+func TestZipExpander_Expand_ContinueOnError(t *testing.T) {
+	tempDir := t.TempDir()
+	srcZip := filepath.Join(tempDir, "partial.zip")
+	dstDir := filepath.Join(tempDir, "output")
+
+	if err := createZipFile(srcZip, []zipTestFile{
+		{Name: "good.txt", Content: "good"},
+		{Name: "blocked/inner.txt", Content: "cannot be written"},
+		{Name: "after.txt", Content: "after"},
+	}); err != nil {
+		t.Fatalf("failed to create zip file: %v", err)
+	}
+
+	// A regular file where a directory is needed makes one entry fail.
+	if err := os.MkdirAll(dstDir, 0755); err != nil {
+		t.Fatalf("failed to create output directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dstDir, "blocked"), nil, 0644); err != nil {
+		t.Fatalf("failed to create blocking file: %v", err)
+	}
+
+	ctx := context.Background()
+	if _, err := (&customzip.ZipExpander{}).Expand(ctx, srcZip, dstDir, 0755); err == nil {
+		t.Fatal("expected Expand to fail without ContinueOnError")
+	}
+
+	z := &customzip.ZipExpander{ContinueOnError: true}
+	m, err := z.Expand(ctx, srcZip, dstDir, 0755)
+	var entryErrs expand.EntryErrors
+	if !errors.As(err, &entryErrs) {
+		t.Fatalf("expected expand.EntryErrors, got %v", err)
+	}
+	if len(entryErrs) != 1 || entryErrs[0].Entry != "blocked/inner.txt" {
+		t.Errorf("unexpected entry errors: %v", entryErrs)
+	}
+	if m == nil || len(m.Entries) != 2 {
+		t.Fatalf("expected manifest with 2 entries, got %+v", m)
+	}
+	if _, err := os.Stat(filepath.Join(dstDir, "after.txt")); err != nil {
+		t.Errorf("expected after.txt to be extracted: %v", err)
+	}
+}
+
+// createStoredZip creates a zip holding a single uncompressed entry whose
+// recorded CRC-32 is crc, returning the archive bytes.
+func createStoredZip(t *testing.T, name, content string, crc uint32) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.CreateRaw(&zip.FileHeader{
+		Name:               name,
+		Method:             zip.Store,
+		CRC32:              crc,
+		CompressedSize64:   uint64(len(content)),
+		UncompressedSize64: uint64(len(content)),
+	})
+	if err != nil {
+		t.Fatalf("failed to create entry: %v", err)
+	}
+	if _, err := io.WriteString(w, content); err != nil {
+		t.Fatalf("failed to write entry: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("failed to close zip writer: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// TestZipExpander_Expand_CRCMismatch checks a corrupted entry is reported as
+// an integrity error.
+func TestZipExpander_Expand_CRCMismatch(t *testing.T) {
+	content := "integrity matters"
+	archive := createStoredZip(t, "data.txt", content, crc32.ChecksumIEEE([]byte(content)))
+	// Corrupt the stored content without touching the recorded CRC-32.
+	i := bytes.Index(archive, []byte(content))
+	archive[i] ^= 0x20
+
+	tempDir := t.TempDir()
+	srcZip := filepath.Join(tempDir, "corrupt.zip")
+	if err := os.WriteFile(srcZip, archive, 0644); err != nil {
+		t.Fatalf("failed to write zip: %v", err)
+	}
+
+	_, err := (&customzip.ZipExpander{}).Expand(context.Background(), srcZip, filepath.Join(tempDir, "out"), 0755)
+	if !errors.Is(err, expand.ErrIntegrity) {
+		t.Fatalf("expected integrity error, got %v", err)
+	}
+	var integrityErr *expand.IntegrityError
+	if !errors.As(err, &integrityErr) {
+		t.Fatalf("expected *expand.IntegrityError, got %T", err)
+	}
+	if integrityErr.Entry != "data.txt" || integrityErr.Expected != fmt.Sprintf("%08x", crc32.ChecksumIEEE([]byte(content))) {
+		t.Errorf("unexpected integrity error: %+v", integrityErr)
+	}
+}
+
+// TestZipExpander_Expand_StrictCRC checks entries without a recorded CRC-32
+// are only rejected in strict mode.
+func TestZipExpander_Expand_StrictCRC(t *testing.T) {
+	tempDir := t.TempDir()
+	srcZip := filepath.Join(tempDir, "nocrc.zip")
+	if err := os.WriteFile(srcZip, createStoredZip(t, "data.txt", "unchecked", 0), 0644); err != nil {
+		t.Fatalf("failed to write zip: %v", err)
+	}
+
+	ctx := context.Background()
+	if _, err := (&customzip.ZipExpander{}).Expand(ctx, srcZip, filepath.Join(tempDir, "lenient"), 0755); err != nil {
+		t.Fatalf("expected lenient extraction to succeed, got %v", err)
+	}
+
+	_, err := (&customzip.ZipExpander{StrictCRC: true}).Expand(ctx, srcZip, filepath.Join(tempDir, "strict"), 0755)
+	if !errors.Is(err, expand.ErrIntegrity) {
+		t.Fatalf("expected integrity error in strict mode, got %v", err)
+	}
+}
+
 // zipTestFile is a simple struct for creating in-test ZIP files.
 type zipTestFile struct {
 	Name    string
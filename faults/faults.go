@@ -0,0 +1,162 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package faults injects failures at defined points of a gather or an
+// extraction, so that callers can test their retry and cleanup logic
+// against realistic partial failures. It is meant for tests: nothing is
+// injected unless a Hook is attached to the context of the operation.
+package faults
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sync"
+)
+
+// Point is a place where a failure can be injected.
+type Point string
+
+const (
+	// Write is reached after every write to a destination file, with the
+	// number of bytes written to it so far.
+	Write Point = "write"
+	// Entry is reached before an archive entry, or a file of a copied
+	// tree, is written.
+	Entry Point = "entry"
+	// Rename is reached before a temporary file is renamed into place.
+	Rename Point = "rename"
+)
+
+// ErrInjected is wrapped by the errors of the hooks in this package.
+var ErrInjected = errors.New("injected fault")
+
+// Hook decides whether an operation fails at a fault point.
+type Hook interface {
+	// Fault is called at p for subject, the entry name or the path being
+	// written, and n, the bytes written so far at Write and zero otherwise.
+	// A non-nil error is returned by the operation, which cleans up as it
+	// would after a real failure.
+	Fault(p Point, subject string, n int64) error
+}
+
+// HookFunc adapts a function to a Hook.
+type HookFunc func(p Point, subject string, n int64) error
+
+func (f HookFunc) Fault(p Point, subject string, n int64) error {
+	return f(p, subject, n)
+}
+
+type hookKey struct{}
+
+// WithHook returns a context that injects the failures h decides on into
+// the gatherers and expanders it is passed to.
+func WithHook(ctx context.Context, h Hook) context.Context {
+	return context.WithValue(ctx, hookKey{}, h)
+}
+
+// FromContext returns the hook carried by ctx, or nil.
+func FromContext(ctx context.Context) Hook {
+	h, _ := ctx.Value(hookKey{}).(Hook)
+	return h
+}
+
+// Check calls h at p, returning nil when h is nil.
+func Check(h Hook, p Point, subject string, n int64) error {
+	if h == nil {
+		return nil
+	}
+	return h.Fault(p, subject, n)
+}
+
+// Writer returns w checking h at Write after every write to it, or w
+// itself when h is nil. A write that fails has still reached w, as it
+// would with a failing disk.
+func Writer(h Hook, subject string, w io.Writer) io.Writer {
+	if h == nil {
+		return w
+	}
+	return &writer{w: w, h: h, subject: subject}
+}
+
+type writer struct {
+	w       io.Writer
+	h       Hook
+	subject string
+	n       int64
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	if err != nil {
+		return n, err
+	}
+	return n, w.h.Fault(Write, w.subject, w.n)
+}
+
+// AfterBytes fails every write that takes a destination file to n bytes or
+// more.
+func AfterBytes(n int64) Hook {
+	return HookFunc(func(p Point, subject string, written int64) error {
+		if p == Write && written >= n {
+			return fmt.Errorf("%w: %s after %d bytes", ErrInjected, subject, written)
+		}
+		return nil
+	})
+}
+
+// OnEntry fails the entry, or copied file, at the slash-separated path
+// name before it is written.
+func OnEntry(name string) Hook {
+	name = path.Clean(name)
+	return HookFunc(func(p Point, subject string, _ int64) error {
+		if p == Entry && path.Clean(subject) == name {
+			return fmt.Errorf("%w: entry %s", ErrInjected, subject)
+		}
+		return nil
+	})
+}
+
+// OnRename fails every rename of a temporary file into place.
+func OnRename() Hook {
+	return HookFunc(func(p Point, subject string, _ int64) error {
+		if p == Rename {
+			return fmt.Errorf("%w: rename to %s", ErrInjected, subject)
+		}
+		return nil
+	})
+}
+
+// Once lets h inject a single failure, after which operations succeed, as
+// a transient failure that a retry recovers from. It is safe for
+// concurrent use.
+func Once(h Hook) Hook {
+	var mu sync.Mutex
+	var fired bool
+	return HookFunc(func(p Point, subject string, n int64) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if fired {
+			return nil
+		}
+		err := h.Fault(p, subject, n)
+		fired = err != nil
+		return err
+	})
+}
@@ -0,0 +1,63 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package faults
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestContext(t *testing.T) {
+	ctx := context.Background()
+	assert.Nil(t, FromContext(ctx))
+	assert.NoError(t, Check(FromContext(ctx), Rename, "file", 0))
+
+	ctx = WithHook(ctx, OnRename())
+	assert.ErrorIs(t, Check(FromContext(ctx), Rename, "file", 0), ErrInjected)
+	assert.NoError(t, Check(FromContext(ctx), Entry, "file", 0))
+}
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+	assert.Same(t, &buf, Writer(nil, "file", &buf))
+
+	w := Writer(AfterBytes(6), "file", &buf)
+	_, err := w.Write([]byte("abc"))
+	require.NoError(t, err)
+	n, err := w.Write([]byte("defg"))
+	assert.ErrorIs(t, err, ErrInjected)
+	assert.Equal(t, 4, n)
+	assert.Equal(t, "abcdefg", buf.String(), "expected the failing write to reach the file")
+}
+
+func TestOnEntry(t *testing.T) {
+	h := OnEntry("policy/main.rego")
+	assert.ErrorIs(t, h.Fault(Entry, "./policy/main.rego", 0), ErrInjected)
+	assert.NoError(t, h.Fault(Entry, "policy/lib.rego", 0))
+	assert.NoError(t, h.Fault(Write, "policy/main.rego", 10))
+}
+
+func TestOnce(t *testing.T) {
+	h := Once(AfterBytes(1))
+	assert.NoError(t, h.Fault(Entry, "a", 0))
+	assert.ErrorIs(t, h.Fault(Write, "a", 1), ErrInjected)
+	assert.NoError(t, h.Fault(Write, "a", 2))
+}
@@ -0,0 +1,164 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package fserrors turns the file system errors users most often run into
+// when gathering, such as a full disk or a read-only destination, into typed
+// errors naming the offending path and suggesting a fix.
+package fserrors
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+// Kind classifies a file system error.
+type Kind int
+
+const (
+	// NoSpace means the file system has no space left (ENOSPC).
+	NoSpace Kind = iota + 1
+	// QuotaExceeded means the user's disk quota is exhausted (EDQUOT).
+	QuotaExceeded
+	// ReadOnly means the file system is mounted read-only (EROFS).
+	ReadOnly
+	// PermissionDenied means the user may not access the path (EACCES, EPERM).
+	PermissionDenied
+)
+
+// Sentinel errors matching a *Error of the corresponding Kind via errors.Is.
+var (
+	ErrNoSpace          = errors.New("no space left on device")
+	ErrQuotaExceeded    = errors.New("disk quota exceeded")
+	ErrReadOnly         = errors.New("read-only file system")
+	ErrPermissionDenied = errors.New("permission denied")
+)
+
+func (k Kind) String() string {
+	switch k {
+	case NoSpace:
+		return ErrNoSpace.Error()
+	case QuotaExceeded:
+		return ErrQuotaExceeded.Error()
+	case ReadOnly:
+		return ErrReadOnly.Error()
+	case PermissionDenied:
+		return ErrPermissionDenied.Error()
+	default:
+		return "unknown"
+	}
+}
+
+func (k Kind) sentinel() error {
+	switch k {
+	case NoSpace:
+		return ErrNoSpace
+	case QuotaExceeded:
+		return ErrQuotaExceeded
+	case ReadOnly:
+		return ErrReadOnly
+	case PermissionDenied:
+		return ErrPermissionDenied
+	default:
+		return nil
+	}
+}
+
+// Error is a classified file system error.
+type Error struct {
+	Kind Kind
+	// Path is the file or directory the failing operation was applied to, if
+	// known.
+	Path string
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%v (hint: %s)", e.Err, e.Hint())
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is the sentinel error for e's Kind.
+func (e *Error) Is(target error) bool {
+	return target != nil && target == e.Kind.sentinel()
+}
+
+// Hint suggests how to resolve the error.
+func (e *Error) Hint() string {
+	where := "the destination"
+	if e.Path != "" {
+		where = fmt.Sprintf("%q", e.Path)
+	}
+	switch e.Kind {
+	case NoSpace:
+		return fmt.Sprintf("free up space on the file system holding %s or gather to a different location", where)
+	case QuotaExceeded:
+		return fmt.Sprintf("remove files owned by the current user or ask an administrator to raise the disk quota for %s", where)
+	case ReadOnly:
+		return fmt.Sprintf("%s is on a read-only file system, gather to a writable location instead", where)
+	case PermissionDenied:
+		return fmt.Sprintf("check that the current user has permission to access %s and its parent directory", where)
+	default:
+		return "check the file system holding " + where
+	}
+}
+
+// Classify returns err as an *Error if it is, or wraps, one of the file
+// system errors this package knows about. Symbolic link loops reported by the
+// operating system are returned as a *SymlinkLoopError. Other errors,
+// including nil, are returned unchanged.
+//
+// Gatherers and expanders call Classify from a deferred function on their
+// named error result, so that a full disk, a read-only destination or a
+// missing permission surfaces to the user as an actionable error whichever
+// step of the gather hit it. Classify is idempotent: errors it has already
+// classified are returned as they are.
+func Classify(err error) error {
+	if err == nil {
+		return nil
+	}
+	var classified *Error
+	if errors.As(err, &classified) || errors.Is(err, ErrSymlinkLoop) {
+		return err
+	}
+	if isSymlinkLoop(err) {
+		return &SymlinkLoopError{Path: pathOf(err), Err: err}
+	}
+	kind := kindOf(err)
+	if kind == 0 && errors.Is(err, fs.ErrPermission) {
+		kind = PermissionDenied
+	}
+	if kind == 0 {
+		return err
+	}
+	return &Error{Kind: kind, Path: pathOf(err), Err: err}
+}
+
+func pathOf(err error) string {
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		return pathErr.Path
+	}
+	var linkErr *os.LinkError
+	if errors.As(err, &linkErr) {
+		return linkErr.New
+	}
+	return ""
+}
@@ -0,0 +1,113 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package fserrors
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassify(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses unix errno values")
+	}
+	testCases := []struct {
+		name     string
+		errno    syscall.Errno
+		kind     Kind
+		sentinel error
+	}{
+		{"disk full", syscall.ENOSPC, NoSpace, ErrNoSpace},
+		{"quota", syscall.EDQUOT, QuotaExceeded, ErrQuotaExceeded},
+		{"read-only", syscall.EROFS, ReadOnly, ErrReadOnly},
+		{"access denied", syscall.EACCES, PermissionDenied, ErrPermissionDenied},
+		{"not permitted", syscall.EPERM, PermissionDenied, ErrPermissionDenied},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cause := &fs.PathError{Op: "write", Path: "/dst/file.txt", Err: tc.errno}
+			err := Classify(fmt.Errorf("failed to write to file: %w", cause))
+
+			var classified *Error
+			require.True(t, errors.As(err, &classified))
+			assert.Equal(t, tc.kind, classified.Kind)
+			assert.Equal(t, "/dst/file.txt", classified.Path)
+			assert.ErrorIs(t, err, tc.sentinel)
+			assert.ErrorIs(t, err, tc.errno)
+			assert.Contains(t, err.Error(), "failed to write to file")
+			assert.Contains(t, err.Error(), "hint: ")
+			assert.Contains(t, classified.Hint(), "/dst/file.txt")
+		})
+	}
+}
+
+func TestClassify_Unchanged(t *testing.T) {
+	assert.Nil(t, Classify(nil))
+
+	plain := errors.New("boom")
+	assert.Same(t, plain, Classify(plain))
+
+	notFound := &fs.PathError{Op: "open", Path: "/x", Err: fs.ErrNotExist}
+	assert.Same(t, notFound, Classify(notFound))
+
+	// Classifying twice does not wrap again
+	once := Classify(&fs.PathError{Op: "write", Path: "/x", Err: syscall.ENOSPC})
+	assert.Same(t, once, Classify(once))
+}
+
+func TestClassify_RealPermissionError(t *testing.T) {
+	if runtime.GOOS == "windows" || os.Geteuid() == 0 {
+		t.Skip("permissions are not enforced")
+	}
+	dir := t.TempDir()
+	require.NoError(t, os.Chmod(dir, 0500))
+	defer os.Chmod(dir, 0700) //nolint:errcheck
+
+	_, err := os.Create(filepath.Join(dir, "file.txt"))
+	err = Classify(err)
+	assert.ErrorIs(t, err, ErrPermissionDenied)
+	assert.ErrorIs(t, err, fs.ErrPermission)
+}
+
+func TestClassify_SymlinkLoop(t *testing.T) {
+	dir := t.TempDir()
+	link := filepath.Join(dir, "loop")
+	if err := os.Symlink("loop", link); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+
+	_, err := os.Stat(link)
+	require.Error(t, err)
+	err = Classify(err)
+
+	assert.ErrorIs(t, err, ErrSymlinkLoop)
+	var loopErr *SymlinkLoopError
+	require.ErrorAs(t, err, &loopErr)
+	assert.Equal(t, link, loopErr.Path)
+
+	// Classifying again leaves the error as it is
+	assert.Same(t, loopErr, Classify(err))
+}
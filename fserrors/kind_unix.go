@@ -0,0 +1,41 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !windows
+
+package fserrors
+
+import (
+	"errors"
+	"syscall"
+)
+
+func kindOf(err error) Kind {
+	switch {
+	case errors.Is(err, syscall.ENOSPC):
+		return NoSpace
+	case errors.Is(err, syscall.EDQUOT):
+		return QuotaExceeded
+	case errors.Is(err, syscall.EROFS):
+		return ReadOnly
+	default:
+		return 0
+	}
+}
+
+func isSymlinkLoop(err error) bool {
+	return errors.Is(err, syscall.ELOOP)
+}
@@ -0,0 +1,51 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build windows
+
+package fserrors
+
+import (
+	"errors"
+	"syscall"
+)
+
+// Windows system error codes, see
+// https://learn.microsoft.com/windows/win32/debug/system-error-codes.
+const (
+	errorWriteProtect      syscall.Errno = 19
+	errorHandleDiskFull    syscall.Errno = 39
+	errorDiskFull          syscall.Errno = 112
+	errorDiskQuotaExceeded syscall.Errno = 1295
+	errorCantResolveName   syscall.Errno = 1921
+)
+
+func kindOf(err error) Kind {
+	switch {
+	case errors.Is(err, errorDiskFull), errors.Is(err, errorHandleDiskFull):
+		return NoSpace
+	case errors.Is(err, errorDiskQuotaExceeded):
+		return QuotaExceeded
+	case errors.Is(err, errorWriteProtect):
+		return ReadOnly
+	default:
+		return 0
+	}
+}
+
+func isSymlinkLoop(err error) bool {
+	return errors.Is(err, errorCantResolveName)
+}
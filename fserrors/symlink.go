@@ -0,0 +1,73 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package fserrors
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrSymlinkLoop is matched via errors.Is by a *SymlinkLoopError.
+var ErrSymlinkLoop = errors.New("too many levels of symbolic links")
+
+// ErrSymlinkEscapes is returned when a symbolic link being copied resolves
+// outside the tree it is copied from.
+var ErrSymlinkEscapes = errors.New("symbolic link points outside the source tree")
+
+// SymlinkLoopError is returned when resolving a path runs into a cycle of
+// symbolic links, or has to follow more links than allowed.
+type SymlinkLoopError struct {
+	// Path is the path being resolved.
+	Path string
+	// Chain lists the links followed, in order, up to the point resolution
+	// was abandoned. It is empty when the operating system reported the
+	// loop.
+	Chain []string
+	// MaxDepth is the limit on links followed that was exceeded. It is zero
+	// when a cycle was detected.
+	MaxDepth int
+	// Err is the underlying operating system error, if any.
+	Err error
+}
+
+func (e *SymlinkLoopError) Error() string {
+	var msg string
+	switch {
+	case e.MaxDepth > 0:
+		msg = fmt.Sprintf("resolving %q followed more than %d symbolic links", e.Path, e.MaxDepth)
+	case len(e.Chain) > 0:
+		msg = fmt.Sprintf("symbolic link cycle resolving %q", e.Path)
+	case e.Err != nil:
+		msg = e.Err.Error()
+	default:
+		msg = fmt.Sprintf("resolving %q: %v", e.Path, ErrSymlinkLoop)
+	}
+	if len(e.Chain) > 0 {
+		msg += ": " + strings.Join(e.Chain, " -> ")
+	}
+	return msg
+}
+
+func (e *SymlinkLoopError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is ErrSymlinkLoop.
+func (e *SymlinkLoopError) Is(target error) bool {
+	return target == ErrSymlinkLoop
+}
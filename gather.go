@@ -0,0 +1,227 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package gogather
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/enterprise-contract/go-gather/expand"
+	"github.com/enterprise-contract/go-gather/gather"
+	"github.com/enterprise-contract/go-gather/internal/helpers"
+	"github.com/enterprise-contract/go-gather/internal/metrics"
+	"github.com/enterprise-contract/go-gather/internal/tracing"
+	"github.com/enterprise-contract/go-gather/metadata"
+	// The built-in gatherers register themselves with the default registry
+	_ "github.com/enterprise-contract/go-gather/registry"
+)
+
+// Gather gathers source into destination with the gatherer accepting it,
+// picked from the default registry, which holds the built-in gatherers, or
+// the one set WithRegistry, configured by opts. A source naming an alias is
+// gathered as the URI the alias stands for, and a source a detector of the
+// registry recognizes as the URI it rewrites it to. It returns the metadata the
+// gatherer returned.
+//
+// Sources are written as for go-getter: a "//" subdirectory of the source
+// is all that is gathered into destination, a "checksum" query parameter,
+// as "type:hex", is verified, and an "archive" query parameter either has
+// the file gathered extracted, by its extension when "true" or by the one
+// given, e.g. "tar.gz", or has archives kept as they are when "false".
+// Gatherers honouring a part themselves are left to it, e.g. the Git
+// gatherer checks out a subdirectory and takes "ref" and "depth" query
+// parameters.
+//
+// The source is gathered into a staging directory next to destination and
+// moved into place only once it was gathered, extracted and checked, so that
+// a failed or cancelled gather leaves destination as it was. A directory
+// that exists there is merged with what was gathered in a copy, which then
+// takes its place, and gatherers implementing gather.StateKeeper gather
+// into a copy of it, to find what an earlier gather left. Metadata
+// implementing metadata.Relocator then describes destination rather than
+// the staging directory.
+func Gather(ctx context.Context, source, destination string, opts ...Option) (_ metadata.Metadata, err error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	// Without a tracer provider, the gather is traced only within a trace
+	// of the caller
+	var span trace.Span
+	if o.tracer != nil {
+		ctx, span = o.tracer.Tracer(tracing.Scope).Start(ctx, "gather", trace.WithAttributes(tracing.Source(source)...))
+	} else {
+		ctx, span = tracing.Start(ctx, "gather", tracing.Source(source)...)
+	}
+	defer func() { tracing.End(span, err) }()
+
+	if o.digest != "" {
+		if err := validateDigest(o.digest); err != nil {
+			return nil, err
+		}
+	}
+	if err := o.conflict.Validate(); err != nil {
+		return nil, err
+	}
+	// The gather is staged next to the expanded destination, and the
+	// trailing separator, which ExpandPath drops, kept for the gatherer
+	expanded, err := helpers.ExpandPath(destination)
+	if err != nil {
+		return nil, fmt.Errorf("failed to expand destination path: %w", err)
+	}
+	if strings.HasSuffix(destination, "/") || strings.HasSuffix(destination, string(filepath.Separator)) {
+		expanded = strings.TrimRight(expanded, "/"+string(filepath.Separator)) + string(filepath.Separator)
+	}
+	destination = expanded
+
+	var g gather.Gatherer
+	if o.registry != nil {
+		source, _ = o.registry.ExpandAlias(source)
+		source, _ = o.registry.Detect(source)
+		g, err = o.registry.GetGatherer(source)
+	} else {
+		source, _ = gather.ExpandAlias(source)
+		source, _ = gather.Detect(source)
+		g, err = gather.GetGatherer(source)
+	}
+	// Sources no gatherer accepts are recorded as failed gathers too
+	if o.metrics != nil {
+		var rec *metrics.Gather
+		ctx, rec = metrics.Start(ctx, o.metrics, tracing.SourceType(source))
+		defer func() { rec.Done(err) }()
+	}
+	if err != nil {
+		return nil, err
+	}
+	span.SetAttributes(attribute.String("gatherer", fmt.Sprintf("%T", g)))
+	if g, err = o.configure(g, source); err != nil {
+		return nil, err
+	}
+
+	if o.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, o.timeout)
+		defer cancel()
+	}
+	var taken bool
+	if o.conflict != "" {
+		if taken, err = occupied(destination); err != nil {
+			return nil, err
+		}
+	}
+	switch {
+	case taken && o.conflict == ConflictFail:
+		return nil, fmt.Errorf("%w: %s", ErrDestinationExists, destination)
+	case taken && o.conflict == ConflictSkipIfExists:
+		span.SetAttributes(attribute.Bool("skipped", true))
+		return &SkippedMetadata{URI: source, Path: destination}, nil
+	}
+
+	g, source, parts, err := splitGetterSyntax(g, source)
+	if err != nil {
+		return nil, err
+	}
+	return o.gatherStaged(ctx, g, source, destination, parts, taken && o.conflict == ConflictOverwrite)
+}
+
+// check checks what was gathered into path against the size limit
+// and the expected digest, if any.
+func (o *options) check(ctx context.Context, path string) error {
+	if o.maxSize > 0 {
+		size, err := helpers.GetDirectorySizeContext(ctx, path)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to measure %s: %w", path, err)
+		}
+		if size > o.maxSize {
+			return fmt.Errorf("%w: gathered %d bytes, more than the limit of %d", ErrSizeLimitExceeded, size, o.maxSize)
+		}
+	}
+	if o.digest != "" {
+		algorithm, _, _ := strings.Cut(o.digest, ":")
+		got, err := digest(ctx, path, algorithm)
+		if err != nil {
+			return err
+		}
+		if got != o.digest {
+			return fmt.Errorf("%w: gathered digest %s, expected %s", ErrVerificationFailed, got, o.digest)
+		}
+	}
+	return nil
+}
+
+// digestHashes are the algorithms files can be digested with.
+var digestHashes = map[string]func() hash.Hash{
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// validateDigest returns an error if d, as set by WithExpectedDigest, does
+// not name a supported algorithm and a digest of its size in hex.
+func validateDigest(d string) error {
+	algorithm, value, _ := strings.Cut(d, ":")
+	h, ok := digestHashes[algorithm]
+	if !ok {
+		return fmt.Errorf("unsupported digest algorithm %q, expected sha256 or sha512", algorithm)
+	}
+	if b, err := hex.DecodeString(value); err != nil || len(b) != h().Size() {
+		return fmt.Errorf("invalid %s digest %q", algorithm, value)
+	}
+	return nil
+}
+
+// digest returns the digest of path as "algorithm:hex": that of the file
+// itself, or the tree digest of a directory, which only sha256 is
+// supported for.
+func digest(ctx context.Context, path, algorithm string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to digest %s: %w", path, err)
+	}
+	if info.IsDir() {
+		if algorithm != "sha256" {
+			return "", fmt.Errorf("directories can only be verified with a sha256 digest, not %s", algorithm)
+		}
+		m, err := expand.ScanDir(ctx, path)
+		if err != nil {
+			return "", fmt.Errorf("failed to list %s: %w", path, err)
+		}
+		return TreeDigest(m.Entries), nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to digest %s: %w", path, err)
+	}
+	defer f.Close()
+	h := digestHashes[algorithm]()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("failed to digest %s: %w", path, err)
+	}
+	return algorithm + ":" + hex.EncodeToString(h.Sum(nil)), nil
+}
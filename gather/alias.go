@@ -0,0 +1,166 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/enterprise-contract/go-gather/metadata"
+)
+
+// aliasName matches the names aliases can be given, which cannot be mistaken
+// for a URI, a path or a registry reference.
+var aliasName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// SetAliases replaces the aliases of the registry. Each alias is a short name
+// standing for a source URI, e.g. "ec-policies" for
+// "oci::quay.io/enterprise-contract/ec-release-policy:latest", so that
+// configurations can refer to stable names. A source naming an alias, either
+// alone or followed by a "//" subdirectory, a "?" query or a "#" fragment,
+// is expanded before it is classified. Expansion is not recursive.
+func (r *Registry) SetAliases(aliases map[string]string) error {
+	copied := make(map[string]string, len(aliases))
+	for name, uri := range aliases {
+		if !aliasName.MatchString(name) {
+			return fmt.Errorf("invalid alias name %q", name)
+		}
+		if uri == "" {
+			return fmt.Errorf("alias %q has no URI", name)
+		}
+		copied[name] = uri
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.aliases = copied
+	r.invalidate()
+	return nil
+}
+
+// Aliases returns a copy of the aliases of the registry.
+func (r *Registry) Aliases() map[string]string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	aliases := make(map[string]string, len(r.aliases))
+	for name, uri := range r.aliases {
+		aliases[name] = uri
+	}
+	return aliases
+}
+
+// ExpandAlias returns uri with the alias it names expanded, and whether it
+// named one.
+func (r *Registry) ExpandAlias(uri string) (string, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.expandAlias(uri)
+}
+
+// expandAlias is ExpandAlias for callers holding the lock.
+func (r *Registry) expandAlias(uri string) (string, bool) {
+	name, rest := uri, ""
+	if i := strings.IndexAny(uri, "/?#"); i >= 0 {
+		name, rest = uri[:i], uri[i:]
+		if rest[0] == '/' && !strings.HasPrefix(rest, "//") {
+			return uri, false
+		}
+	}
+	target, ok := r.aliases[name]
+	if !ok {
+		return uri, false
+	}
+	return target + rest, true
+}
+
+// aliasGatherer gathers sources naming an alias, or rewritten by a
+// detector, with the gatherer of the URI they resolve to.
+type aliasGatherer struct {
+	Gatherer
+	registry *Registry
+}
+
+func (a *aliasGatherer) Gather(ctx context.Context, src, dst string) (metadata.Metadata, error) {
+	src = a.registry.resolve(src)
+	m, err := a.Gatherer.Gather(ctx, src, dst)
+	if m == nil {
+		return m, err
+	}
+	return &aliasMetadata{Metadata: m, registry: a.registry}, err
+}
+
+// aliasMetadata pins sources naming an alias, or rewritten by a detector,
+// as the URI they resolve to. Get returns the metadata of the gatherer that
+// gathered it, and the optional interfaces of the metadata package are
+// forwarded to it, reporting nothing where it does not implement them.
+type aliasMetadata struct {
+	metadata.Metadata
+	registry *Registry
+}
+
+func (a *aliasMetadata) GetPinnedURL(u string) (string, error) {
+	return a.Metadata.GetPinnedURL(a.registry.resolve(u))
+}
+
+func (a *aliasMetadata) Relocate(from, to string) {
+	if r, ok := a.Metadata.(metadata.Relocator); ok {
+		r.Relocate(from, to)
+	}
+}
+
+func (a *aliasMetadata) GetSummary() metadata.Summary {
+	return metadata.Summarize(a.Metadata)
+}
+
+func (a *aliasMetadata) GetSecurityChecks() []metadata.SecurityCheck {
+	if c, ok := a.Metadata.(metadata.SecurityChecker); ok {
+		return c.GetSecurityChecks()
+	}
+	return nil
+}
+
+func (a *aliasMetadata) GetSkipped() []metadata.SkippedEntry {
+	if s, ok := a.Metadata.(metadata.SkipReporter); ok {
+		return s.GetSkipped()
+	}
+	return nil
+}
+
+func (a *aliasMetadata) GetSizeReport() *metadata.SizeReport {
+	if r, ok := a.Metadata.(metadata.SizeReporter); ok {
+		return r.GetSizeReport()
+	}
+	return nil
+}
+
+// SetAliases replaces the aliases of the default registry. See
+// Registry.SetAliases.
+func SetAliases(aliases map[string]string) error {
+	return gatherers.SetAliases(aliases)
+}
+
+// Aliases returns a copy of the aliases of the default registry.
+func Aliases() map[string]string {
+	return gatherers.Aliases()
+}
+
+// ExpandAlias returns uri with the alias of the default registry it names
+// expanded, and whether it named one.
+func ExpandAlias(uri string) (string, bool) {
+	return gatherers.ExpandAlias(uri)
+}
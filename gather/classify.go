@@ -0,0 +1,105 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"container/list"
+	"sync"
+)
+
+// classifyCache is a least recently used cache of the gatherers that
+// sources were classified to. It has its own lock as lookups reorder it
+// while the registry is only read locked.
+type classifyCache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type classified struct {
+	uri      string
+	gatherer Gatherer
+}
+
+func newClassifyCache(size int) *classifyCache {
+	return &classifyCache{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[string]*list.Element, size),
+	}
+}
+
+func (c *classifyCache) get(uri string) (Gatherer, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[uri]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(*classified).gatherer, true
+}
+
+func (c *classifyCache) put(uri string, g Gatherer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[uri]; ok {
+		e.Value.(*classified).gatherer = g
+		c.order.MoveToFront(e)
+		return
+	}
+	c.entries[uri] = c.order.PushFront(&classified{uri: uri, gatherer: g})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*classified).uri)
+	}
+}
+
+func (c *classifyCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// SetClassifyCacheSize makes GetGatherer remember the gatherers of the size
+// most recently classified sources, which pays off when the same sources are
+// classified over and over. The cache is emptied whenever gatherers or
+// aliases change. A size of zero or less, the default, disables caching.
+func (r *Registry) SetClassifyCacheSize(size int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cache = nil
+	if size > 0 {
+		r.cache = newClassifyCache(size)
+	}
+}
+
+// invalidate empties the classification cache. The caller holds the write
+// lock.
+func (r *Registry) invalidate() {
+	if r.cache != nil {
+		r.cache = newClassifyCache(r.cache.size)
+	}
+}
+
+// SetClassifyCacheSize sets the classification cache size of the default
+// registry.
+func SetClassifyCacheSize(size int) {
+	gatherers.SetClassifyCacheSize(size)
+}
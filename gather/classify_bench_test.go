@@ -0,0 +1,64 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package gather_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/enterprise-contract/go-gather/gather"
+	"github.com/enterprise-contract/go-gather/gather/file"
+	"github.com/enterprise-contract/go-gather/gather/git"
+	"github.com/enterprise-contract/go-gather/gather/http"
+	"github.com/enterprise-contract/go-gather/gather/oci"
+	"github.com/enterprise-contract/go-gather/gather/s3"
+)
+
+// BenchmarkRegistry_GetGatherer classifies a mix of sources repeatedly, the
+// way a policy configuration listing many sources is, with and without the
+// classification cache.
+func BenchmarkRegistry_GetGatherer(b *testing.B) {
+	var sources []string
+	for i := range 100 {
+		sources = append(sources,
+			fmt.Sprintf("https://example.com/policy-%d.tar.gz", i),
+			fmt.Sprintf("github.com/org/repo-%d//policy", i),
+			fmt.Sprintf("./policy/%d", i),
+		)
+	}
+
+	for _, size := range []int{0, len(sources)} {
+		b.Run(fmt.Sprintf("cache=%d", size), func(b *testing.B) {
+			// The OCI gatherer is consulted before the git and HTTP ones so
+			// that its registry patterns run for every source
+			r := gather.NewRegistry()
+			r.RegisterGatherer(&s3.S3Gatherer{})
+			r.RegisterGatherer(&oci.OCIGatherer{})
+			r.RegisterGatherer(&git.GitGatherer{})
+			r.RegisterGatherer(&http.HTTPGatherer{})
+			r.RegisterGatherer(&file.FileGatherer{})
+			r.SetClassifyCacheSize(size)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := r.GetGatherer(sources[i%len(sources)]); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type countingGatherer struct {
+	TestGatherer
+	calls int
+}
+
+func (c *countingGatherer) Matcher(uri string) bool {
+	c.calls++
+	return c.TestGatherer.Matcher(uri)
+}
+
+func TestRegistryClassifyCache(t *testing.T) {
+	r := NewRegistry()
+	g := &countingGatherer{}
+	r.RegisterGatherer(g)
+	r.SetClassifyCacheSize(2)
+
+	for range 3 {
+		got, err := r.GetGatherer("test://a")
+		assert.NoError(t, err)
+		assert.Same(t, g, got)
+	}
+	assert.Equal(t, 1, g.calls)
+
+	// Errors are not cached
+	for range 2 {
+		_, err := r.GetGatherer("other://a")
+		assert.Error(t, err)
+	}
+	assert.Equal(t, 3, g.calls)
+
+	// The least recently used source is evicted
+	_, _ = r.GetGatherer("test://b")
+	_, _ = r.GetGatherer("test://a")
+	_, _ = r.GetGatherer("test://c")
+	assert.Equal(t, 2, r.cache.len())
+	calls := g.calls
+	_, _ = r.GetGatherer("test://a")
+	assert.Equal(t, calls, g.calls)
+	_, _ = r.GetGatherer("test://b")
+	assert.Equal(t, calls+1, g.calls)
+
+	// Changing gatherers or aliases empties the cache
+	r.RegisterGatherer(&TestGathererA{})
+	assert.Equal(t, 0, r.cache.len())
+	_, _ = r.GetGatherer("test://a")
+	assert.NoError(t, r.SetAliases(map[string]string{"a": "testA://a"}))
+	assert.Equal(t, 0, r.cache.len())
+	got, err := r.GetGatherer("a")
+	assert.NoError(t, err)
+	assert.IsType(t, &aliasGatherer{}, got)
+
+	r.SetClassifyCacheSize(0)
+	calls = g.calls
+	_, _ = r.GetGatherer("test://a")
+	_, _ = r.GetGatherer("test://a")
+	assert.Equal(t, calls+2, g.calls)
+}
@@ -0,0 +1,99 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import "strings"
+
+// Detector rewrites the sources it recognizes into a form a gatherer
+// accepts, as go-getter detectors do, and reports whether it recognized
+// src. Detectors teach the registry about hosts its gatherers cannot tell
+// apart by the source alone, e.g. that "git.corp.example/org/repo" is a Git
+// repository to gather as "git::git.corp.example/org/repo".
+type Detector func(src string) (string, bool)
+
+// HostDetector returns a Detector forcing the sources on host to the
+// gatherer forced, e.g. "git" or "oci", by prefixing them with "forced::".
+// Sources with or without a scheme are recognized, and sources forcing a
+// gatherer already are left as they are.
+func HostDetector(host, forced string) Detector {
+	return func(src string) (string, bool) {
+		if i := strings.Index(src, "::"); i > 0 && !strings.ContainsAny(src[:i], "/?#") {
+			return src, false
+		}
+		rest := src
+		if i := strings.Index(rest, "://"); i >= 0 {
+			rest = rest[i+3:]
+		}
+		if i := strings.IndexAny(rest, "/?#"); i >= 0 {
+			rest = rest[:i]
+		}
+		if !strings.EqualFold(rest, host) {
+			return src, false
+		}
+		return forced + "::" + src, true
+	}
+}
+
+// RegisterDetector appends d to the detectors of the registry, which are
+// consulted in registration order, after aliases are expanded and before
+// the gatherers are. The first detector recognizing a source rewrites it,
+// and the gatherer accepting the rewritten source gathers it.
+func (r *Registry) RegisterDetector(d Detector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.detectors = append(r.detectors, d)
+	r.invalidate()
+}
+
+// Detect returns uri as rewritten by the first detector of the registry
+// recognizing it, and whether one did.
+func (r *Registry) Detect(uri string) (string, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.detect(uri)
+}
+
+// detect is Detect for callers holding the lock.
+func (r *Registry) detect(uri string) (string, bool) {
+	for _, d := range r.detectors {
+		if detected, ok := d(uri); ok {
+			return detected, true
+		}
+	}
+	return uri, false
+}
+
+// resolve returns uri with the alias it names expanded, as rewritten by a
+// detector.
+func (r *Registry) resolve(uri string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	uri, _ = r.expandAlias(uri)
+	uri, _ = r.detect(uri)
+	return uri
+}
+
+// RegisterDetector adds d to the default registry.
+func RegisterDetector(d Detector) {
+	gatherers.RegisterDetector(d)
+}
+
+// Detect returns uri as rewritten by the first detector of the default
+// registry recognizing it, and whether one did.
+func Detect(uri string) (string, bool) {
+	return gatherers.Detect(uri)
+}
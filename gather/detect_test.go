@@ -0,0 +1,82 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHostDetector(t *testing.T) {
+	d := HostDetector("registry.corp.example", "oci")
+	for src, want := range map[string]string{
+		"registry.corp.example/policy:v1":         "oci::registry.corp.example/policy:v1",
+		"https://registry.corp.example/policy:v1": "oci::https://registry.corp.example/policy:v1",
+		"REGISTRY.corp.example/policy":            "oci::REGISTRY.corp.example/policy",
+	} {
+		got, ok := d(src)
+		assert.True(t, ok, src)
+		assert.Equal(t, want, got, src)
+	}
+	for _, src := range []string{
+		"registry.corp.example.evil.com/policy",
+		"other.example/registry.corp.example/policy",
+		"git::registry.corp.example/policy",
+	} {
+		got, ok := d(src)
+		assert.False(t, ok, src)
+		assert.Equal(t, src, got, src)
+	}
+}
+
+func TestRegistryDetectors(t *testing.T) {
+	r := NewRegistry()
+	g := &recordingGatherer{}
+	r.RegisterGatherer(g)
+
+	_, err := r.GetGatherer("registry.corp.example/policy:v1")
+	assert.ErrorIs(t, err, ErrUnsupportedScheme)
+
+	r.RegisterDetector(HostDetector("registry.corp.example", "oci"))
+	// Detectors are consulted in registration order
+	r.RegisterDetector(func(src string) (string, bool) {
+		return "oci::unreachable", strings.HasPrefix(src, "registry.corp.example/")
+	})
+	got, ok := r.Detect("registry.corp.example/policy:v1")
+	assert.True(t, ok)
+	assert.Equal(t, "oci::registry.corp.example/policy:v1", got)
+
+	gatherer, err := r.GetGatherer("registry.corp.example/policy:v1")
+	assert.NoError(t, err)
+	m, err := gatherer.Gather(context.Background(), "registry.corp.example/policy:v1", "/dst")
+	assert.NoError(t, err)
+	assert.Equal(t, "oci::registry.corp.example/policy:v1", g.src)
+	pinned, err := m.GetPinnedURL("registry.corp.example/policy:v1")
+	assert.NoError(t, err)
+	assert.Equal(t, "oci::registry.corp.example/policy:v1@pinned", pinned)
+
+	// Aliases are expanded before detection
+	assert.NoError(t, r.SetAliases(map[string]string{"policy": "registry.corp.example/policy:v2"}))
+	gatherer, err = r.GetGatherer("policy")
+	assert.NoError(t, err)
+	_, err = gatherer.Gather(context.Background(), "policy", "/dst")
+	assert.NoError(t, err)
+	assert.Equal(t, "oci::registry.corp.example/policy:v2", g.src)
+}
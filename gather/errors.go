@@ -0,0 +1,77 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/enterprise-contract/go-gather/expand"
+)
+
+// The sentinel errors below are matched, using errors.Is, by the errors of
+// every gatherer failing for the reason they name, so that callers can
+// branch on the cause of a failure whatever gathered the source.
+var (
+	// ErrUnsupportedScheme is matched by every UnsupportedSchemeError.
+	ErrUnsupportedScheme = errors.New("unsupported source")
+	// ErrDestinationExists is matched when gathering into a destination
+	// that is taken already.
+	ErrDestinationExists = errors.New("destination exists")
+	// ErrSizeLimitExceeded is matched when what a source holds, or expands
+	// to, is larger than allowed.
+	ErrSizeLimitExceeded = expand.ErrSizeLimitExceeded
+	// ErrAuthRequired is matched when the server of a source refuses the
+	// gatherer for want of credentials, or of valid ones.
+	ErrAuthRequired = errors.New("authentication required")
+	// ErrVerificationFailed is matched when what was gathered does not
+	// match the checksum, digest or signature it was expected to.
+	ErrVerificationFailed = errors.New("verification failed")
+)
+
+// UnsupportedSchemeError reports a source no gatherer accepts.
+type UnsupportedSchemeError struct {
+	URI string
+}
+
+func (e *UnsupportedSchemeError) Error() string {
+	return fmt.Sprintf("no gatherer found for URI: %s", e.URI)
+}
+
+func (e *UnsupportedSchemeError) Is(target error) bool {
+	return target == ErrUnsupportedScheme
+}
+
+// NewError returns an error with the message msg that errors.Is matches
+// with kind too, one of the sentinel errors of this package, for gatherers
+// to declare sentinel errors of their own that are a kind of it.
+func NewError(msg string, kind error) error {
+	return &kindError{msg: msg, kind: kind}
+}
+
+type kindError struct {
+	msg  string
+	kind error
+}
+
+func (e *kindError) Error() string {
+	return e.msg
+}
+
+func (e *kindError) Is(target error) bool {
+	return target == e.kind
+}
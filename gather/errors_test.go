@@ -0,0 +1,36 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewError(t *testing.T) {
+	errMismatch := NewError("digest mismatch", ErrVerificationFailed)
+	err := fmt.Errorf("pull: %w", errMismatch)
+
+	assert.EqualError(t, err, "pull: digest mismatch")
+	assert.ErrorIs(t, err, errMismatch)
+	assert.ErrorIs(t, err, ErrVerificationFailed)
+	assert.False(t, errors.Is(err, ErrAuthRequired))
+	assert.False(t, errors.Is(ErrVerificationFailed, errMismatch))
+}
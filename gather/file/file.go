@@ -22,10 +22,12 @@ import (
 	"io"
 	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/enterprise-contract/go-gather/expand"
+	"github.com/enterprise-contract/go-gather/fserrors"
 	"github.com/enterprise-contract/go-gather/gather"
 	"github.com/enterprise-contract/go-gather/internal/helpers"
 	"github.com/enterprise-contract/go-gather/metadata"
@@ -33,6 +35,55 @@ import (
 
 type FileGatherer struct {
 	FSMetadata
+	// Hidden selects hidden files and directories to leave out when copying
+	// a directory or extracting an archive.
+	Hidden expand.HiddenFiles
+	// Include and Exclude select the files copied from a directory, or
+	// matching a glob source, by patterns written like the lines of a
+	// .gitignore file, e.g. Exclude: []string{"node_modules/", "testdata/"}.
+	// See expand.PathFilter.
+	Include []string
+	Exclude []string
+	// Symlinks is how symbolic links are copied from a directory, by
+	// default recreated with the same target.
+	Symlinks expand.SymlinkMode
+	// AllowEscapingSymlinks copies symbolic links resolving outside the
+	// source directory, which otherwise fail the gather with
+	// fserrors.ErrSymlinkEscapes, as they could otherwise expose files
+	// from elsewhere on the host.
+	AllowEscapingSymlinks bool
+	// Link is how the files of a directory, or matching a glob source, are
+	// copied, by default byte by byte. Hard links and reflinks make large
+	// local gathers nearly instantaneous when the source and destination
+	// are on the same file system, files being copied otherwise.
+	Link LinkMode
+	// Limits bounds what extracting an archive may write, overriding the
+	// limits of the registered expander for this gatherer only.
+	Limits expand.Limits
+	// KeepArchives copies archives as they are rather than extracting
+	// them, as a go-getter "archive=false" query parameter asks for.
+	KeepArchives bool
+}
+
+// LinkMode is how the file gatherer copies the contents of files.
+type LinkMode string
+
+const (
+	// LinkCopy copies the contents of files, the default.
+	LinkCopy LinkMode = "copy"
+	// LinkHard hard links the gathered files to the source files, so they
+	// share their contents: a change to either shows in the other, which
+	// makes it suitable for read-only consumers only.
+	LinkHard LinkMode = "hardlink"
+	// LinkReflink clones the source files, so the gathered files share
+	// their contents until either is changed, with the FICLONE ioctl on
+	// Linux, e.g. on Btrfs or XFS, and clonefile on macOS APFS volumes.
+	LinkReflink LinkMode = "reflink"
+)
+
+// Validate returns an error if m is not one of the modes, or empty.
+func (m LinkMode) Validate() error {
+	return helpers.LinkMode(m).Validate()
 }
 
 type FSMetadata struct {
@@ -40,6 +91,16 @@ type FSMetadata struct {
 	Path      string
 	Size      int64
 	Timestamp string
+	// SecurityChecks records the protections applied while expanding an
+	// archive.
+	SecurityChecks []metadata.SecurityCheck
+	// Skipped lists the files of a directory or an archive that were left
+	// out, and why.
+	Skipped []metadata.SkippedEntry
+	// Sizes reports the sizes of the files gathered.
+	Sizes *metadata.SizeReport
+	// Matched is the number of files matching a glob source.
+	Matched int
 }
 
 type FileSaver struct {
@@ -47,6 +108,9 @@ type FileSaver struct {
 }
 
 func (f *FileGatherer) Matcher(uri string) bool {
+	if helpers.IsWindowsPath(uri) {
+		return true
+	}
 	prefixes := []string{"file://", "file::", "/", "./", "../"}
 	for _, prefix := range prefixes {
 		if strings.HasPrefix(uri, prefix) {
@@ -56,18 +120,32 @@ func (f *FileGatherer) Matcher(uri string) bool {
 	return false
 }
 
-func (f *FileGatherer) Gather(ctx context.Context, src, dst string) (metadata.Metadata, error) {
+// copyOptions returns the options copying a directory with filter.
+func (f *FileGatherer) copyOptions(filter *expand.CopyFilter) helpers.CopyOptions {
+	return helpers.CopyOptions{
+		Skip:                  filter.Skip,
+		Symlinks:              helpers.SymlinkMode(f.Symlinks),
+		AllowEscapingSymlinks: f.AllowEscapingSymlinks,
+		Link:                  helpers.LinkMode(f.Link),
+	}
+}
+
+func (f *FileGatherer) Gather(ctx context.Context, src, dst string) (_ metadata.Metadata, err error) {
+	defer func() { err = fserrors.Classify(err) }()
+
 	select {
 	case <-ctx.Done():
 		return nil, ctx.Err()
 	default:
 	}
+	f.URI = src
 
 	for _, prefix := range []string{"file://", "file::"} {
 		src = strings.TrimPrefix(src, prefix)
 		dst = strings.TrimPrefix(dst, prefix)
 	}
-	src, err := helpers.ExpandPath(src)
+	src, dst = helpers.LocalPath(src), helpers.LocalPath(dst)
+	src, err = helpers.ExpandPath(src)
 	if err != nil {
 		return nil, fmt.Errorf("failed to expand source path: %w", err)
 	}
@@ -76,25 +154,53 @@ func (f *FileGatherer) Gather(ctx context.Context, src, dst string) (metadata.Me
 		return nil, fmt.Errorf("failed to expand destination path: %w", err)
 	}
 
+	paths := expand.PathFilter{Include: f.Include, Exclude: f.Exclude}
+	if err := paths.Validate(); err != nil {
+		return nil, err
+	}
+	if err := f.Symlinks.Validate(); err != nil {
+		return nil, err
+	}
+	if err := f.Link.Validate(); err != nil {
+		return nil, err
+	}
+
 	sInfo, err := os.Stat(src)
 	if err != nil {
+		// A path that does not exist may be a glob, such as
+		// "./policies/**/*.rego", selecting the files to copy
+		if base, pattern, ok := splitGlob(src); ok && os.IsNotExist(err) {
+			return f.gatherGlob(ctx, src, base, pattern, dst)
+		}
 		if os.IsNotExist(err) {
 			return nil, fmt.Errorf("source file does not exist: %w", err)
 		}
 		return nil, fmt.Errorf("failed to get file info: %w", err)
 	}
 
+	sandbox := expand.SandboxFromContext(ctx)
 	if sInfo.IsDir() {
-		if err := helpers.CopyDir(src, dst); err != nil {
+		filter := expand.NewCopyFilter(ctx, src, f.Hidden)
+		filter.Paths = paths
+		filter.Symlinks = f.Symlinks
+		if err := helpers.CopyDirOptionsContext(ctx, src, dst, f.copyOptions(filter)); err != nil {
 			return nil, fmt.Errorf("failed to copy directory: %w", err)
 		}
-		dirSize, err := helpers.GetDirectorySize(dst)
+		if err := filter.Err(); err != nil {
+			return nil, err
+		}
+		dirSize, err := helpers.GetDirectorySizeContext(ctx, dst)
 		if err != nil {
 			return nil, err
 		}
 		f.Path = dst
 		f.Size = dirSize
-		f.Timestamp = time.Now().String()
+		if f.Sizes, err = metadata.ScanSizes(ctx, dst, metadata.LargestFiles); err != nil {
+			return nil, fmt.Errorf("failed to report sizes: %w", err)
+		}
+		f.Timestamp = time.Now().Format(time.RFC3339)
+		f.Skipped = filter.Skipped
+		f.Matched = 0
 		return &f.FSMetadata, nil
 	}
 
@@ -108,34 +214,91 @@ func (f *FileGatherer) Gather(ctx context.Context, src, dst string) (metadata.Me
 		return nil, err
 	}
 
-	if compressedFile || isTarFile {
+	if !f.KeepArchives && (compressedFile || isTarFile) {
 		e, err := getExpander(src)
 		if err != nil {
 			return nil, err
 		}
-		err = e.Expand(ctx, src, dst, 0755)
+		if excluder, ok := e.(expand.HiddenExcluder); ok && !f.Hidden.IsZero() {
+			e = excluder.WithHiddenFiles(f.Hidden)
+		}
+		if limiter, ok := e.(expand.Limiter); ok && !f.Limits.IsZero() {
+			e = limiter.WithLimits(f.Limits)
+		}
+		ctx, trace := metadata.WithSecurityTrace(ctx)
+		manifest, err := e.Expand(ctx, src, dst, 0755)
 		if err != nil {
 			return nil, err
 		}
-		dirSize, err := helpers.GetDirectorySize(dst)
+		dirSize, err := helpers.GetDirectorySizeContext(ctx, dst)
 		if err != nil {
 			return nil, err
 		}
 		f.Path = dst
 		f.Size = dirSize
-		f.Timestamp = time.Now().String()
+		if f.Sizes, err = metadata.ScanSizes(ctx, dst, metadata.LargestFiles); err != nil {
+			return nil, fmt.Errorf("failed to report sizes: %w", err)
+		}
+		f.Timestamp = time.Now().Format(time.RFC3339)
+		f.SecurityChecks = trace.Checks()
+		f.Skipped = manifest.Skipped
+		f.Matched = 0
 		return &f.FSMetadata, nil
 	}
 
+	// A single file is written to dst itself, so only an allowlist covering
+	// the whole destination permits it
+	if err := sandbox.Require(metadata.SecurityTraceFromContext(ctx), ".", false); err != nil {
+		return nil, err
+	}
+
 	// TODO: Figure out how to make this flexible for different types of destinations
 	fsaver := FileSaver{}
-	return fsaver.save(ctx, src, dst, false)
+	m, err := fsaver.save(ctx, src, dst, false)
+	if err != nil {
+		return nil, err
+	}
+	fsaver.URI = f.URI
+	return m, nil
 }
 
 func (f *FSMetadata) Get() interface{} {
 	return f
 }
 
+// Relocate updates Path for what was gathered having moved from from to
+// to.
+func (f *FSMetadata) Relocate(from, to string) {
+	f.Path = metadata.RelocatePath(f.Path, from, to)
+}
+
+// GetSecurityChecks returns the security checks performed during the gather.
+func (f FSMetadata) GetSecurityChecks() []metadata.SecurityCheck {
+	return f.SecurityChecks
+}
+
+// GetSkipped returns the entries the gather left out.
+func (f FSMetadata) GetSkipped() []metadata.SkippedEntry {
+	return f.Skipped
+}
+
+// GetSizeReport returns the sizes of the files gathered.
+func (f FSMetadata) GetSizeReport() *metadata.SizeReport {
+	return f.Sizes
+}
+
+// GetSummary returns the summary of the copy, which has no revision.
+func (f FSMetadata) GetSummary() metadata.Summary {
+	s := metadata.NewSummary("file", f.URI, f.Path, f.Timestamp, f.Sizes)
+	if f.Sizes == nil {
+		s.Bytes = f.Size
+	}
+	if f.Matched > 0 {
+		s.Detail("matched", strconv.Itoa(f.Matched))
+	}
+	return s
+}
+
 func (f FSMetadata) GetPinnedURL(u string) (string, error) {
 	if len(u) == 0 {
 		return "", fmt.Errorf("empty file path")
@@ -188,12 +351,21 @@ func (f *FileSaver) save(ctx context.Context, source string, destination string,
 	}
 	defer srcFile.Close()
 
-	writtenSize, err := io.Copy(dstFile, srcFile)
+	// A fresh copy keeps the holes of sparse files, appending fills them
+	var writtenSize int64
+	if append {
+		writtenSize, err = io.Copy(dstFile, helpers.NewContextReader(ctx, srcFile))
+	} else {
+		writtenSize, err = helpers.CopySparseContext(ctx, dstFile, srcFile)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to write to file: %w", err)
 	}
 	f.Path = dst.Path
 	f.Size = writtenSize
+	if f.Sizes, err = metadata.ScanSizes(ctx, dst.Path, metadata.LargestFiles); err != nil {
+		return nil, fmt.Errorf("failed to report sizes: %w", err)
+	}
 	f.Timestamp = time.Now().Format(time.RFC3339)
 
 	return &f.FSMetadata, nil
@@ -204,18 +376,20 @@ func getExpander(src string) (expand.Expander, error) {
 		format     string
 		extensions []string
 	}{
-		{"tar", []string{"tar", "tar.gz", "tgz", "tar.bz2", "tbz2"}},
+		{"tar", []string{"tar", "tar.gz", "tgz", "tar.bz2", "tbz2", "tbz"}},
 		{"bzip2", []string{"bz2"}},
 		{"gzip", []string{"gzip", "gz"}},
 		{"zip", []string{"zip"}},
 	}
 
 	for _, entry := range orderedFormats {
-		for _, extension := range entry.extensions {
-			if strings.HasSuffix(src, "."+extension) {
-				return expand.GetExpander(entry.format), nil
-			}
+		if !expand.HasExtension(src, entry.extensions...) {
+			continue
+		}
+		if e := expand.GetExpanderByFormat(entry.format); e != nil {
+			return e, nil
 		}
+		break
 	}
 	return nil, fmt.Errorf("compressed file found, but no expander available")
 }
@@ -20,6 +20,7 @@ import (
 	"archive/zip"
 	"bytes"
 	"context"
+	"errors"
 	"io"
 	"os"
 	"path/filepath"
@@ -28,6 +29,9 @@ import (
 
 	"github.com/enterprise-contract/go-gather/expand"
 	_ "github.com/enterprise-contract/go-gather/expand/zip" // Register zip expander
+	"github.com/enterprise-contract/go-gather/faults"
+	"github.com/enterprise-contract/go-gather/fserrors"
+	"github.com/enterprise-contract/go-gather/metadata"
 )
 
 func TestFileGatherer_Matcher(t *testing.T) {
@@ -43,6 +47,11 @@ func TestFileGatherer_Matcher(t *testing.T) {
 		{"absolute path", "/etc/hosts", true},
 		{"relative path dot", "./myfile", true},
 		{"relative path dotdot", "../myfile", true},
+		{"windows drive", `C:\policy`, true},
+		{"windows drive forward slash", "C:/policy", true},
+		{"windows relative path", `.\policy`, true},
+		{"unc share", `\\server\share\policy`, true},
+		{"long path", `\\?\C:\policy`, true},
 		{"no match", "http://example.com/file.txt", false},
 	}
 
@@ -142,6 +151,224 @@ func TestFileGatherer_Gather_Directory(t *testing.T) {
 	}
 }
 
+func TestFileGatherer_Gather_DirectoryHidden(t *testing.T) {
+	srcDir := t.TempDir()
+	dstDir := filepath.Join(t.TempDir(), "dest_dir")
+	for _, name := range []string{"policy.rego", ".git/config", ".gitignore"} {
+		p := filepath.Join(srcDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatalf("failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(p, []byte(name), 0600); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+
+	fg := &FileGatherer{Hidden: expand.HiddenFiles{Names: []string{".git"}}}
+	m, err := fg.Gather(context.Background(), srcDir, dstDir)
+	if err != nil {
+		t.Fatalf("Gather returned an unexpected error: %v", err)
+	}
+	skipped := m.(metadata.SkipReporter).GetSkipped()
+	if len(skipped) != 1 || skipped[0] != (metadata.SkippedEntry{Path: ".git", Reason: metadata.SkipHidden}) {
+		t.Errorf("expected .git to be reported as skipped, got %+v", skipped)
+	}
+	sizes := m.(metadata.SizeReporter).GetSizeReport()
+	if sizes == nil || sizes.Files != 2 || sizes.Bytes != int64(len("policy.rego")+len(".gitignore")) || sizes.Largest[0].Path != "policy.rego" {
+		t.Errorf("unexpected size report: %+v", sizes)
+	}
+	for name, want := range map[string]bool{"policy.rego": true, ".gitignore": true, ".git": false} {
+		_, err := os.Stat(filepath.Join(dstDir, name))
+		if got := err == nil; got != want {
+			t.Errorf("expected %s to exist=%v, stat returned %v", name, want, err)
+		}
+	}
+}
+
+func TestFileGatherer_Gather_DirectoryPatterns(t *testing.T) {
+	srcDir := t.TempDir()
+	dstDir := filepath.Join(t.TempDir(), "dest_dir")
+	for _, name := range []string{"policy.rego", "policy_test.rego", "lib/util.rego", "lib/README.md", "node_modules/x/x.rego", "testdata/fixture.rego"} {
+		p := filepath.Join(srcDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatalf("failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(p, []byte(name), 0600); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+
+	fg := &FileGatherer{
+		Include: []string{"*.rego", "!*_test.rego"},
+		Exclude: []string{"node_modules/", "/testdata"},
+	}
+	m, err := fg.Gather(context.Background(), srcDir, dstDir)
+	if err != nil {
+		t.Fatalf("Gather returned an unexpected error: %v", err)
+	}
+	want := []metadata.SkippedEntry{
+		{Path: "lib/README.md", Reason: metadata.SkipFiltered},
+		{Path: "node_modules", Reason: metadata.SkipFiltered},
+		{Path: "policy_test.rego", Reason: metadata.SkipFiltered},
+		{Path: "testdata", Reason: metadata.SkipFiltered},
+	}
+	skipped := m.(metadata.SkipReporter).GetSkipped()
+	if len(skipped) != len(want) {
+		t.Fatalf("expected %v to be skipped, got %+v", want, skipped)
+	}
+	for i := range want {
+		if skipped[i] != want[i] {
+			t.Errorf("expected %v to be skipped, got %+v", want, skipped)
+		}
+	}
+	for name, want := range map[string]bool{"policy.rego": true, "lib/util.rego": true, "lib/README.md": false, "node_modules": false, "testdata": false} {
+		_, err := os.Stat(filepath.Join(dstDir, filepath.FromSlash(name)))
+		if got := err == nil; got != want {
+			t.Errorf("expected %s to exist=%v, stat returned %v", name, want, err)
+		}
+	}
+
+	fg = &FileGatherer{Exclude: []string{"[bad"}}
+	if _, err := fg.Gather(context.Background(), srcDir, filepath.Join(t.TempDir(), "dest_dir")); err == nil {
+		t.Error("expected a malformed pattern to be rejected")
+	}
+}
+
+func TestFileGatherer_Gather_DirectorySymlinks(t *testing.T) {
+	srcDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(srcDir, "policy.rego"), []byte("package main"), 0600); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	outside := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(outside, []byte("secret"), 0600); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	if err := os.Symlink("policy.rego", filepath.Join(srcDir, "link.rego")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+	if err := os.Symlink(outside, filepath.Join(srcDir, "escape")); err != nil {
+		t.Fatalf("failed to create symlink: %v", err)
+	}
+	ctx := context.Background()
+
+	// Links leading out of the source are rejected by default
+	_, err := (&FileGatherer{}).Gather(ctx, srcDir, filepath.Join(t.TempDir(), "dst"))
+	if !errors.Is(err, fserrors.ErrSymlinkEscapes) {
+		t.Errorf("expected the escaping link to be rejected, got %v", err)
+	}
+
+	dstDir := filepath.Join(t.TempDir(), "dst")
+	m, err := (&FileGatherer{Symlinks: expand.SymlinkSkip}).Gather(ctx, srcDir, dstDir)
+	if err != nil {
+		t.Fatalf("Gather returned an unexpected error: %v", err)
+	}
+	skipped := m.(metadata.SkipReporter).GetSkipped()
+	if len(skipped) != 2 || skipped[0] != (metadata.SkippedEntry{Path: "escape", Reason: metadata.SkipSymlink}) || skipped[1].Path != "link.rego" {
+		t.Errorf("expected the links to be reported as skipped, got %+v", skipped)
+	}
+
+	dstDir = filepath.Join(t.TempDir(), "dst")
+	if _, err := (&FileGatherer{Symlinks: expand.SymlinkFollow, AllowEscapingSymlinks: true}).Gather(ctx, srcDir, dstDir); err != nil {
+		t.Fatalf("Gather returned an unexpected error: %v", err)
+	}
+	if b, err := os.ReadFile(filepath.Join(dstDir, "escape")); err != nil || string(b) != "secret" {
+		t.Errorf("expected the link to be followed, got %q, %v", b, err)
+	}
+	if info, err := os.Lstat(filepath.Join(dstDir, "link.rego")); err != nil || !info.Mode().IsRegular() {
+		t.Errorf("expected a copy of the file in place of the link, got %v, %v", info, err)
+	}
+
+	if _, err := (&FileGatherer{Symlinks: "bogus"}).Gather(ctx, srcDir, filepath.Join(t.TempDir(), "dst")); err == nil {
+		t.Error("expected an unknown symlink mode to be rejected")
+	}
+}
+
+func TestFileGatherer_Gather_DirectoryLink(t *testing.T) {
+	srcDir := t.TempDir()
+	src := filepath.Join(srcDir, "sub", "policy.rego")
+	if err := os.MkdirAll(filepath.Dir(src), 0755); err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(src, []byte("package main"), 0600); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	srcInfo, err := os.Stat(src)
+	if err != nil {
+		t.Fatalf("failed to stat file: %v", err)
+	}
+
+	for _, mode := range []LinkMode{LinkHard, LinkReflink} {
+		dstDir := filepath.Join(t.TempDir(), "dst")
+		if _, err := (&FileGatherer{Link: mode}).Gather(context.Background(), srcDir, dstDir); err != nil {
+			t.Fatalf("Gather returned an unexpected error: %v", err)
+		}
+		dst := filepath.Join(dstDir, "sub", "policy.rego")
+		if b, err := os.ReadFile(dst); err != nil || string(b) != "package main" {
+			t.Errorf("expected %s mode to gather the file, got %q, %v", mode, b, err)
+		}
+		dstInfo, err := os.Stat(dst)
+		if err != nil {
+			t.Fatalf("failed to stat file: %v", err)
+		}
+		if got := os.SameFile(srcInfo, dstInfo); got != (mode == LinkHard) {
+			t.Errorf("expected %s mode to share the file=%v, got %v", mode, mode == LinkHard, got)
+		}
+	}
+
+	if _, err := (&FileGatherer{Link: "symlink"}).Gather(context.Background(), srcDir, filepath.Join(t.TempDir(), "dst")); err == nil {
+		t.Error("expected an unknown link mode to be rejected")
+	}
+}
+
+func TestFileGatherer_Gather_DirectorySandbox(t *testing.T) {
+	srcDir := t.TempDir()
+	for _, name := range []string{"policy/main.rego", "README.md"} {
+		p := filepath.Join(srcDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatalf("failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(p, []byte(name), 0600); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+
+	ctx := expand.WithSandbox(context.Background(), expand.Sandbox{Allow: []string{"policy"}})
+	if _, err := (&FileGatherer{}).Gather(ctx, srcDir, filepath.Join(t.TempDir(), "dest_dir")); !errors.Is(err, expand.ErrOutsideSandbox) {
+		t.Fatalf("expected ErrOutsideSandbox, got %v", err)
+	}
+
+	dstDir := filepath.Join(t.TempDir(), "dest_dir")
+	ctx = expand.WithSandbox(context.Background(), expand.Sandbox{Allow: []string{"policy"}, Skip: true})
+	if _, err := (&FileGatherer{}).Gather(ctx, srcDir, dstDir); err != nil {
+		t.Fatalf("Gather returned an unexpected error: %v", err)
+	}
+	for name, want := range map[string]bool{"policy/main.rego": true, "README.md": false} {
+		_, err := os.Stat(filepath.Join(dstDir, filepath.FromSlash(name)))
+		if got := err == nil; got != want {
+			t.Errorf("expected %s to exist=%v, stat returned %v", name, want, err)
+		}
+	}
+}
+
+func TestFileGatherer_Gather_DirectoryInjectedFault(t *testing.T) {
+	srcDir := t.TempDir()
+	for _, name := range []string{"a.rego", "sub/b.rego"} {
+		p := filepath.Join(srcDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatalf("failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(p, []byte(name), 0600); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+
+	ctx := faults.WithHook(context.Background(), faults.OnEntry("sub/b.rego"))
+	_, err := (&FileGatherer{}).Gather(ctx, srcDir, filepath.Join(t.TempDir(), "dest_dir"))
+	if !errors.Is(err, faults.ErrInjected) {
+		t.Fatalf("expected an injected fault, got %v", err)
+	}
+}
+
 func TestFileGatherer_Gather_NotExist(t *testing.T) {
 	fg := &FileGatherer{}
 
@@ -223,6 +450,52 @@ func TestFileGatherer_Gather_Compressed(t *testing.T) {
 	}
 }
 
+func TestFileGatherer_Gather_SecurityChecks(t *testing.T) {
+	fg := &FileGatherer{}
+
+	tempDir := t.TempDir()
+	srcZip := filepath.Join(tempDir, "test.zip")
+	if err := createZipFile(srcZip, "hello.txt", "Hello Zip"); err != nil {
+		t.Fatalf("failed to create test zip file: %v", err)
+	}
+
+	meta, err := fg.Gather(context.Background(), srcZip, filepath.Join(tempDir, "extracted"))
+	if err != nil {
+		t.Fatalf("Gather returned an unexpected error: %v", err)
+	}
+
+	checker, ok := meta.(metadata.SecurityChecker)
+	if !ok {
+		t.Fatalf("expected %T to implement metadata.SecurityChecker", meta)
+	}
+	checks := map[string]string{}
+	for _, c := range checker.GetSecurityChecks() {
+		checks[c.Check] = c.Outcome
+	}
+	if checks["path-sanitization"] != metadata.CheckPassed || checks["crc32"] != metadata.CheckPassed {
+		t.Errorf("expected path sanitization and CRC checks to pass, got %+v", checker.GetSecurityChecks())
+	}
+}
+
+func TestFileGatherer_Gather_Limits(t *testing.T) {
+	tempDir := t.TempDir()
+	srcZip := filepath.Join(tempDir, "test.zip")
+	if err := createZipFile(srcZip, "hello.txt", "Hello Zip"); err != nil {
+		t.Fatalf("failed to create test zip file: %v", err)
+	}
+
+	fg := &FileGatherer{Limits: expand.Limits{FileSize: 4}}
+	if _, err := fg.Gather(context.Background(), srcZip, filepath.Join(tempDir, "limited")); err == nil {
+		t.Fatal("expected Gather to fail on the size limit")
+	}
+
+	// The limit applies to a copy, the registered expander is left as is.
+	fg = &FileGatherer{}
+	if _, err := fg.Gather(context.Background(), srcZip, filepath.Join(tempDir, "extracted")); err != nil {
+		t.Fatalf("Gather returned an unexpected error: %v", err)
+	}
+}
+
 func createZipFile(zipPath, fileName, content string) error {
 	out, err := os.Create(zipPath)
 	if err != nil {
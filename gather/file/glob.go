@@ -0,0 +1,139 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package file
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/enterprise-contract/go-gather/expand"
+	"github.com/enterprise-contract/go-gather/faults"
+	"github.com/enterprise-contract/go-gather/internal/helpers"
+	"github.com/enterprise-contract/go-gather/metadata"
+)
+
+// splitGlob splits src into the directory to walk, the longest leading
+// path without glob metacharacters, and the slash-separated pattern the
+// paths below it are matched against. It reports false when src has no
+// metacharacters.
+func splitGlob(src string) (string, string, bool) {
+	if !strings.ContainsAny(src, "*?[") {
+		return "", "", false
+	}
+	segments := strings.Split(filepath.ToSlash(src), "/")
+	for i, s := range segments {
+		if strings.ContainsAny(s, "*?[") {
+			base := strings.Join(segments[:i], "/")
+			if base == "" && i > 0 {
+				base = "/"
+			} else if base == "" {
+				base = "."
+			}
+			return filepath.FromSlash(base), strings.Join(segments[i:], "/"), true
+		}
+	}
+	return "", "", false
+}
+
+// gatherGlob copies the files below base whose paths relative to it match
+// pattern to the same paths below dst.
+func (f *FileGatherer) gatherGlob(ctx context.Context, src, base, pattern, dst string) (metadata.Metadata, error) {
+	if err := helpers.ValidateGlob(pattern); err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(base)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file info: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", base)
+	}
+
+	filter := expand.NewCopyFilter(ctx, base, f.Hidden)
+	filter.Paths = expand.PathFilter{Include: f.Include, Exclude: f.Exclude}
+	filter.Symlinks = f.Symlinks
+	var matched int
+	err = filepath.WalkDir(base, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if p == base {
+			return nil
+		}
+		rel, err := filepath.Rel(base, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if d.IsDir() {
+			if !helpers.MayMatchGlob(pattern, rel) || filter.Skip(rel) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !helpers.MatchGlob(pattern, rel) || filter.Skip(rel) {
+			return nil
+		}
+
+		target := filepath.Join(dst, filepath.FromSlash(rel))
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return fmt.Errorf("failed to create directory: %w", err)
+		}
+		if d.Type()&os.ModeSymlink != 0 {
+			err = helpers.CopySymlinkContext(ctx, base, p, target, rel, f.copyOptions(filter))
+		} else {
+			if err := faults.Check(faults.FromContext(ctx), faults.Entry, rel, 0); err != nil {
+				return err
+			}
+			err = helpers.CopyFileLinkContext(ctx, p, target, helpers.LinkMode(f.Link))
+		}
+		if err != nil {
+			return err
+		}
+		matched++
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to copy files matching %s: %w", src, err)
+	}
+	if err := filter.Err(); err != nil {
+		return nil, err
+	}
+	if matched == 0 {
+		return nil, fmt.Errorf("no files match %s", src)
+	}
+
+	f.Path = dst
+	if f.Size, err = helpers.GetDirectorySizeContext(ctx, dst); err != nil {
+		return nil, err
+	}
+	if f.Sizes, err = metadata.ScanSizes(ctx, dst, metadata.LargestFiles); err != nil {
+		return nil, fmt.Errorf("failed to report sizes: %w", err)
+	}
+	f.Timestamp = time.Now().Format(time.RFC3339)
+	f.Skipped = filter.Skipped
+	f.Matched = matched
+	return &f.FSMetadata, nil
+}
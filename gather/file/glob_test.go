@@ -0,0 +1,135 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package file
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/enterprise-contract/go-gather/expand"
+)
+
+func TestSplitGlob(t *testing.T) {
+	tests := []struct {
+		src     string
+		base    string
+		pattern string
+		ok      bool
+	}{
+		{"policies/**/*.rego", "policies", "**/*.rego", true},
+		{"/abs/dir/*.json", "/abs/dir", "*.json", true},
+		{"*.rego", ".", "*.rego", true},
+		{"/*", "/", "*", true},
+		{"a/b[0-9]/c", "a", "b[0-9]/c", true},
+		{"plain/path", "", "", false},
+	}
+	for _, tt := range tests {
+		base, pattern, ok := splitGlob(tt.src)
+		if base != filepath.FromSlash(tt.base) || pattern != tt.pattern || ok != tt.ok {
+			t.Errorf("splitGlob(%q) = %q, %q, %v, want %q, %q, %v", tt.src, base, pattern, ok, tt.base, tt.pattern, tt.ok)
+		}
+	}
+}
+
+func writeTree(t *testing.T, root string, names ...string) {
+	t.Helper()
+	for _, name := range names {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatalf("failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(p, []byte(name), 0600); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+}
+
+func TestFileGatherer_Gather_Glob(t *testing.T) {
+	srcDir := t.TempDir()
+	writeTree(t, srcDir, "main.rego", "README.md", "lib/util.rego", "lib/data.json", "lib/deep/more.rego", ".git/hooks/x.rego")
+	dstDir := filepath.Join(t.TempDir(), "dest_dir")
+
+	fg := &FileGatherer{Hidden: expand.HiddenFiles{Names: []string{".git"}}}
+	m, err := fg.Gather(context.Background(), filepath.Join(srcDir, "**", "*.rego"), dstDir)
+	if err != nil {
+		t.Fatalf("Gather returned an unexpected error: %v", err)
+	}
+	fsMeta := m.(*FSMetadata)
+	if fsMeta.Path != dstDir || fsMeta.Matched != 3 {
+		t.Errorf("unexpected metadata: %+v", fsMeta)
+	}
+	if fsMeta.Sizes == nil || fsMeta.Sizes.Files != 3 {
+		t.Errorf("unexpected size report: %+v", fsMeta.Sizes)
+	}
+	for name, want := range map[string]bool{
+		"main.rego":          true,
+		"lib/util.rego":      true,
+		"lib/deep/more.rego": true,
+		"README.md":          false,
+		"lib/data.json":      false,
+		".git":               false,
+	} {
+		_, err := os.Stat(filepath.Join(dstDir, filepath.FromSlash(name)))
+		if got := err == nil; got != want {
+			t.Errorf("expected %s to exist=%v, stat returned %v", name, want, err)
+		}
+	}
+}
+
+func TestFileGatherer_Gather_GlobSingleLevel(t *testing.T) {
+	srcDir := t.TempDir()
+	writeTree(t, srcDir, "a.json", "b.json", "c.yaml", "sub/d.json")
+	dstDir := filepath.Join(t.TempDir(), "dest_dir")
+
+	fg := &FileGatherer{}
+	m, err := fg.Gather(context.Background(), "file://"+filepath.Join(srcDir, "*.json"), dstDir)
+	if err != nil {
+		t.Fatalf("Gather returned an unexpected error: %v", err)
+	}
+	if got := m.(*FSMetadata).Matched; got != 2 {
+		t.Errorf("expected 2 matches, got %d", got)
+	}
+	entries, err := os.ReadDir(dstDir)
+	if err != nil {
+		t.Fatalf("failed to read destination: %v", err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if strings.Join(names, ",") != "a.json,b.json" {
+		t.Errorf("unexpected destination contents: %v", names)
+	}
+}
+
+func TestFileGatherer_Gather_GlobErrors(t *testing.T) {
+	srcDir := t.TempDir()
+	writeTree(t, srcDir, "a.json")
+
+	fg := &FileGatherer{}
+	_, err := fg.Gather(context.Background(), filepath.Join(srcDir, "*.rego"), filepath.Join(t.TempDir(), "dst"))
+	if err == nil || !strings.Contains(err.Error(), "no files match") {
+		t.Errorf("expected no match error, got %v", err)
+	}
+	_, err = fg.Gather(context.Background(), filepath.Join(srcDir, "[a.json"), filepath.Join(t.TempDir(), "dst"))
+	if err == nil {
+		t.Error("expected an error for a malformed pattern")
+	}
+}
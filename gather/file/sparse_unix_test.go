@@ -0,0 +1,93 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build linux || darwin || freebsd
+
+package file
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+// TestFileGatherer_Gather_Sparse checks that holes in sparse files survive
+// gathering a single file and a directory.
+func TestFileGatherer_Gather_Sparse(t *testing.T) {
+	tempDir := t.TempDir()
+	srcDir := filepath.Join(tempDir, "src")
+	if err := os.Mkdir(srcDir, 0755); err != nil {
+		t.Fatalf("failed to create source dir: %v", err)
+	}
+	srcFile := filepath.Join(srcDir, "disk.img")
+
+	const size = 64 << 20
+	f, err := os.Create(srcFile)
+	if err != nil {
+		t.Fatalf("failed to create source file: %v", err)
+	}
+	if _, err := f.WriteAt([]byte("data"), size/2); err != nil {
+		t.Fatalf("failed to write source file: %v", err)
+	}
+	if err := f.Truncate(size); err != nil {
+		t.Fatalf("failed to extend source file: %v", err)
+	}
+	f.Close()
+
+	if allocated(t, srcFile) >= size {
+		t.Skip("file system does not support sparse files")
+	}
+
+	ctx := context.Background()
+	single := filepath.Join(tempDir, "single.img")
+	meta, err := (&FileGatherer{}).Gather(ctx, srcFile, single)
+	if err != nil {
+		t.Fatalf("Gather returned an unexpected error: %v", err)
+	}
+	if got := meta.(*FSMetadata).Size; got != size {
+		t.Errorf("expected metadata size=%d, got %d", size, got)
+	}
+
+	dir := filepath.Join(tempDir, "dst")
+	if _, err := (&FileGatherer{}).Gather(ctx, srcDir, dir); err != nil {
+		t.Fatalf("Gather returned an unexpected error: %v", err)
+	}
+
+	for _, p := range []string{single, filepath.Join(dir, "disk.img")} {
+		info, err := os.Stat(p)
+		if err != nil {
+			t.Fatalf("failed to stat %s: %v", p, err)
+		}
+		if info.Size() != size {
+			t.Errorf("expected %s to be %d bytes, got %d", p, size, info.Size())
+		}
+		if got := allocated(t, p); got >= size/2 {
+			t.Errorf("expected %s to stay sparse, %d bytes allocated", p, got)
+		}
+	}
+}
+
+// allocated returns the number of bytes allocated on disk for path.
+func allocated(t *testing.T, path string) int64 {
+	t.Helper()
+	var st syscall.Stat_t
+	if err := syscall.Stat(path, &st); err != nil {
+		t.Fatalf("failed to stat %q: %v", path, err)
+	}
+	return int64(st.Blocks) * 512
+}
@@ -19,6 +19,7 @@ package gather
 import (
 	"context"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -105,4 +106,172 @@ func TestGetGathererError(t *testing.T) {
 	_, err := GetGatherer("invalid://")
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "no gatherer found for URI: invalid://")
+	assert.ErrorIs(t, err, ErrUnsupportedScheme)
+	var unsupported *UnsupportedSchemeError
+	if assert.ErrorAs(t, err, &unsupported) {
+		assert.Equal(t, "invalid://", unsupported.URI)
+	}
+}
+
+func TestDeregisterGatherer(t *testing.T) {
+	g := &TestGathererA{}
+	r := NewRegistry()
+	r.RegisterGatherer(g)
+
+	assert.True(t, r.DeregisterGatherer(g))
+	assert.False(t, r.DeregisterGatherer(g))
+
+	_, err := r.GetGatherer("testA://")
+	assert.Error(t, err)
+}
+
+func TestNewRegistryIsIsolated(t *testing.T) {
+	r := NewRegistry()
+	r.RegisterGatherer(&TestGathererB{})
+
+	_, err := r.GetGatherer("test://")
+	assert.Error(t, err)
+
+	g, err := r.GetGatherer("testB://")
+	assert.NoError(t, err)
+	assert.IsType(t, &TestGathererB{}, g)
+}
+
+// fallbackGatherer accepts "testB://" sources only as a fallback.
+type fallbackGatherer struct{ TestGatherer }
+
+func (f *fallbackGatherer) FallbackMatcher(uri string) bool {
+	return strings.HasPrefix(uri, "testB://")
+}
+
+func TestRegistryFallback(t *testing.T) {
+	r := NewRegistry()
+	fallback := &fallbackGatherer{}
+	r.RegisterGatherer(fallback)
+
+	g, err := r.GetGatherer("testB://")
+	assert.NoError(t, err)
+	assert.Same(t, fallback, g)
+
+	// A gatherer whose Matcher accepts the source comes first, whatever
+	// the registration order
+	r.RegisterGatherer(&TestGathererB{})
+	g, err = r.GetGatherer("testB://")
+	assert.NoError(t, err)
+	assert.IsType(t, &TestGathererB{}, g)
+}
+
+func TestRegistryConcurrentUse(t *testing.T) {
+	r := NewRegistry()
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			g := &TestGathererA{}
+			r.RegisterGatherer(g)
+			r.DeregisterGatherer(g)
+		}()
+		go func() {
+			defer wg.Done()
+			_, _ = r.GetGatherer("testA://")
+		}()
+	}
+	wg.Wait()
+}
+
+// recordingGatherer records the source it gathers and pins it by suffixing
+// "@pinned".
+type recordingGatherer struct {
+	src string
+}
+
+type recordingMetadata struct{}
+
+func (recordingMetadata) Get() interface{} { return "recorded" }
+
+func (recordingMetadata) GetPinnedURL(u string) (string, error) { return u + "@pinned", nil }
+
+func (g *recordingGatherer) Gather(ctx context.Context, src, dst string) (metadata.Metadata, error) {
+	g.src = src
+	return recordingMetadata{}, nil
+}
+
+func (g *recordingGatherer) Matcher(uri string) bool {
+	return strings.HasPrefix(uri, "oci::")
+}
+
+func TestRegistryAliases(t *testing.T) {
+	r := NewRegistry()
+	g := &recordingGatherer{}
+	r.RegisterGatherer(g)
+	assert.NoError(t, r.SetAliases(map[string]string{"ec-policies": "oci::quay.io/ec/policy:latest"}))
+
+	for uri, want := range map[string]string{
+		"ec-policies":        "oci::quay.io/ec/policy:latest",
+		"ec-policies//sub":   "oci::quay.io/ec/policy:latest//sub",
+		"ec-policies?x=1":    "oci::quay.io/ec/policy:latest?x=1",
+		"ec-policies/sub":    "ec-policies/sub",
+		"other":              "other",
+		"oci::quay.io/other": "oci::quay.io/other",
+	} {
+		got, _ := r.ExpandAlias(uri)
+		assert.Equal(t, want, got, uri)
+	}
+
+	gatherer, err := r.GetGatherer("ec-policies")
+	assert.NoError(t, err)
+	m, err := gatherer.Gather(context.Background(), "ec-policies", "/dst")
+	assert.NoError(t, err)
+	assert.Equal(t, "oci::quay.io/ec/policy:latest", g.src)
+	assert.Equal(t, "recorded", m.Get())
+	pinned, err := m.GetPinnedURL("ec-policies")
+	assert.NoError(t, err)
+	assert.Equal(t, "oci::quay.io/ec/policy:latest@pinned", pinned)
+
+	_, err = r.GetGatherer("unknown-alias")
+	assert.Error(t, err)
+
+	aliases := r.Aliases()
+	aliases["changed"] = "oci::x"
+	assert.NotContains(t, r.Aliases(), "changed")
+
+	assert.Error(t, r.SetAliases(map[string]string{"oci::x": "oci::y"}))
+	assert.Error(t, r.SetAliases(map[string]string{"empty": ""}))
+}
+
+func TestInterpolator(t *testing.T) {
+	env := map[string]string{"REGISTRY": "quay.io", "TAG": "v1", "EMPTY": "", "SECRET": "x"}
+	i := Interpolator{
+		Allowed: []string{"REGISTRY", "TAG", "EMPTY", "MISSING"},
+		Lookup: func(name string) (string, bool) {
+			v, ok := env[name]
+			return v, ok
+		},
+	}
+
+	for src, want := range map[string]string{
+		"oci::${REGISTRY}/org/policy:${TAG}": "oci::quay.io/org/policy:v1",
+		"git::host/repo?ref=x${EMPTY}":       "git::host/repo?ref=x",
+		"http://host/$path/$${TAG}":          "http://host/$path/${TAG}",
+		"no variables":                       "no variables",
+	} {
+		got, err := i.Expand(src)
+		assert.NoError(t, err, src)
+		assert.Equal(t, want, got, src)
+	}
+
+	_, err := i.Expand("oci::${SECRET}")
+	assert.ErrorIs(t, err, ErrVariableNotAllowed)
+	_, err = i.Expand("oci::${MISSING}")
+	assert.ErrorIs(t, err, ErrVariableUnset)
+	_, err = i.Expand("oci::${TAG")
+	assert.Error(t, err)
+	_, err = i.Expand("oci::${not-a-name}")
+	assert.Error(t, err)
+
+	t.Setenv("GATHER_TEST_VAR", "from-env")
+	got, err := Interpolator{Allowed: []string{"GATHER_TEST_VAR"}}.Expand("${GATHER_TEST_VAR}")
+	assert.NoError(t, err)
+	assert.Equal(t, "from-env", got)
 }
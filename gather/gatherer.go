@@ -19,7 +19,9 @@ package gather
 import (
 	"context"
 	"fmt"
+	"sync"
 
+	"github.com/enterprise-contract/go-gather/internal/logging"
 	"github.com/enterprise-contract/go-gather/metadata"
 )
 
@@ -28,17 +30,142 @@ type Gatherer interface {
 	Matcher(uri string) bool
 }
 
-var gatherers []Gatherer
+// FallbackMatcher is implemented by gatherers that can gather sources their
+// Matcher leaves to more specific gatherers, when none of those is
+// registered. The HTTP gatherer, for one, leaves the HTTPS endpoints of
+// object stores to the gatherers of the stores, and gathers them as plain
+// downloads otherwise.
+type FallbackMatcher interface {
+	// FallbackMatcher reports whether the gatherer accepts uri when no
+	// Matcher of the registry does.
+	FallbackMatcher(uri string) bool
+}
 
-func GetGatherer(uri string) (Gatherer, error) {
-	for _, gatherer := range gatherers {
-		if gatherer.Matcher(uri) {
+// StateKeeper is implemented by gatherers keeping state across gathers
+// into the same destination: in what an earlier gather left there, such as
+// the repository the git gatherer updates in place, or in files next to it,
+// such as the validators and partial downloads of the HTTP gatherer.
+// gogather.Gather, which gathers into a staging directory, seeds it with a
+// copy of the destination and carries these files into it and back.
+type StateKeeper interface {
+	// KeepsState reports whether the gatherer keeps state for gathers of
+	// src into dst.
+	KeepsState(src, dst string) bool
+	// StateFiles returns the names of the files next to dst the gatherer
+	// keeps state in: those recording what was gathered, kept once a
+	// gather succeeds, and those recording a gather that did not finish,
+	// kept whatever its outcome.
+	StateFiles(dst string) (gathered, unfinished []string)
+}
+
+// Registry holds a set of gatherers, consulted in registration order. It is
+// safe for concurrent use. The package-level functions operate on a
+// process-wide registry that the built-in gatherers add themselves to; a
+// separate Registry allows tests and embedders to work with an isolated set.
+type Registry struct {
+	mu        sync.RWMutex
+	gatherers []Gatherer
+	// aliases maps short names to the source URIs they stand for.
+	aliases map[string]string
+	// detectors rewrite the sources they recognize, see Detector.
+	detectors []Detector
+	// cache, when set, remembers the gatherers of recently classified
+	// sources.
+	cache *classifyCache
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+var gatherers = NewRegistry()
+
+// GetGatherer returns the first registered gatherer whose Matcher accepts uri.
+// If uri names an alias the gatherer matching its expansion is returned,
+// wrapped to gather the expansion instead.
+func (r *Registry) GetGatherer(uri string) (Gatherer, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.cache != nil {
+		if gatherer, ok := r.cache.get(uri); ok {
+			return gatherer, nil
+		}
+	}
+	gatherer, err := r.classify(uri)
+	if err != nil {
+		return nil, err
+	}
+	if r.cache != nil {
+		r.cache.put(uri, gatherer)
+	}
+	return gatherer, nil
+}
+
+// classify is GetGatherer without the cache, for callers holding the lock.
+// Gatherers accepting uri only as a fallback, see FallbackMatcher, are
+// consulted once no Matcher accepts it.
+func (r *Registry) classify(uri string) (Gatherer, error) {
+	expanded, aliased := r.expandAlias(uri)
+	expanded, detected := r.detect(expanded)
+	match := func(gatherer Gatherer) bool { return gatherer.Matcher(expanded) }
+	fallback := func(gatherer Gatherer) bool {
+		f, ok := gatherer.(FallbackMatcher)
+		return ok && f.FallbackMatcher(expanded)
+	}
+	for _, matches := range []func(Gatherer) bool{match, fallback} {
+		for _, gatherer := range r.gatherers {
+			if !matches(gatherer) {
+				continue
+			}
+			logging.Logger().Debug("classified source", logging.Source(uri), "gatherer", fmt.Sprintf("%T", gatherer), "alias", aliased, "detected", detected)
+			if aliased || detected {
+				return &aliasGatherer{Gatherer: gatherer, registry: r}, nil
+			}
 			return gatherer, nil
 		}
 	}
-	return nil, fmt.Errorf("no gatherer found for URI: %s", uri)
+	logging.Logger().Debug("no gatherer accepts source", logging.Source(uri))
+	return nil, &UnsupportedSchemeError{URI: uri}
+}
+
+// RegisterGatherer appends g to the registry.
+func (r *Registry) RegisterGatherer(g Gatherer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.gatherers = append(r.gatherers, g)
+	r.invalidate()
+}
+
+// DeregisterGatherer removes every registration of g and reports whether
+// there were any.
+func (r *Registry) DeregisterGatherer(g Gatherer) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	kept := r.gatherers[:0:0]
+	for _, gatherer := range r.gatherers {
+		if gatherer != g {
+			kept = append(kept, gatherer)
+		}
+	}
+	removed := len(kept) != len(r.gatherers)
+	r.gatherers = kept
+	r.invalidate()
+	return removed
 }
 
+// GetGatherer returns the first gatherer in the default registry whose
+// Matcher accepts uri.
+func GetGatherer(uri string) (Gatherer, error) {
+	return gatherers.GetGatherer(uri)
+}
+
+// RegisterGatherer adds g to the default registry.
 func RegisterGatherer(g Gatherer) {
-	gatherers = append(gatherers, g)
+	gatherers.RegisterGatherer(g)
+}
+
+// DeregisterGatherer removes g from the default registry.
+func DeregisterGatherer(g Gatherer) bool {
+	return gatherers.DeregisterGatherer(g)
 }
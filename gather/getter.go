@@ -0,0 +1,104 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Parts of the go-getter syntax of sources that gatherers may honour
+// themselves, see GetterSyntaxHandler.
+const (
+	// GetterSubdir is a "//" subdirectory of the source, e.g.
+	// "git::https://example.com/repo.git//policy".
+	GetterSubdir = "subdir"
+	// GetterChecksum is a "checksum" query parameter, e.g.
+	// "https://example.com/policy.rego?checksum=sha256:<hex>".
+	GetterChecksum = "checksum"
+)
+
+// GetterSyntaxHandler is implemented by gatherers that honour parts of the
+// go-getter syntax of their sources themselves. gogather.Gather honours the
+// parts the gatherer of a source leaves to it around the gather.
+type GetterSyntaxHandler interface {
+	// HandlesGetterSyntax reports whether the gatherer honours part, one
+	// of GetterSubdir and GetterChecksum.
+	HandlesGetterSyntax(part string) bool
+}
+
+// SplitSubdir splits the "//" subdirectory off src as go-getter does,
+// returning src without it and the subdirectory, empty if there is none.
+// The "//" of a scheme, such as "https://", does not start a subdirectory,
+// and a query or fragment stays with the source, so that
+// "https://example.com/policy.tar.gz//main?archive=tar.gz" is split into
+// "https://example.com/policy.tar.gz?archive=tar.gz" and "main".
+func SplitSubdir(src string) (string, string) {
+	// A forced gatherer, as in "git::", is left out of the search
+	var forced string
+	if i := strings.Index(src, "::"); i > 0 && !strings.ContainsAny(src[:i], "/?#") {
+		forced, src = src[:i+2], src[i+2:]
+	}
+	start := 0
+	if i := strings.Index(src, "://"); i >= 0 {
+		start = i + 3
+	}
+	rest, trailer := src, ""
+	if i := strings.IndexAny(src[start:], "?#"); i >= 0 {
+		rest, trailer = src[:start+i], src[start+i:]
+	}
+	i := strings.Index(rest[start:], "//")
+	if i < 0 {
+		return forced + src, ""
+	}
+	return forced + rest[:start+i] + trailer, rest[start+i+2:]
+}
+
+// SplitParam removes the query parameter key from src, leaving its other
+// parameters and fragment in place, and returns its value and whether it
+// was there.
+func SplitParam(src, key string) (string, string, bool) {
+	base, query, ok := strings.Cut(src, "?")
+	if !ok {
+		return src, "", false
+	}
+	query, fragment, hasFragment := strings.Cut(query, "#")
+	var value string
+	var found bool
+	var kept []string
+	for _, p := range strings.Split(query, "&") {
+		k, v, _ := strings.Cut(p, "=")
+		if k == key {
+			value, found = v, true
+			if unescaped, err := url.QueryUnescape(v); err == nil {
+				value = unescaped
+			}
+			continue
+		}
+		kept = append(kept, p)
+	}
+	if !found {
+		return src, "", false
+	}
+	if len(kept) > 0 {
+		base += "?" + strings.Join(kept, "&")
+	}
+	if hasFragment {
+		base += "#" + fragment
+	}
+	return base, value, true
+}
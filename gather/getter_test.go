@@ -0,0 +1,73 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitSubdir(t *testing.T) {
+	tests := []struct {
+		src    string
+		want   string
+		subdir string
+	}{
+		{"https://example.com/policy.tar.gz", "https://example.com/policy.tar.gz", ""},
+		{"https://example.com/policy.tar.gz//main", "https://example.com/policy.tar.gz", "main"},
+		{"https://example.com/policy.tar.gz//main/lib?archive=tar.gz", "https://example.com/policy.tar.gz?archive=tar.gz", "main/lib"},
+		{"https://example.com/policy.zip//main#entry", "https://example.com/policy.zip#entry", "main"},
+		{"https://example.com/policy.zip?x=a//b", "https://example.com/policy.zip?x=a//b", ""},
+		{"git::https://example.com/repo.git//policy?ref=main", "git::https://example.com/repo.git?ref=main", "policy"},
+		{"oci::registry.example.com/policy:v1//main", "oci::registry.example.com/policy:v1", "main"},
+		{"file::/tmp/policy.tar//main", "file::/tmp/policy.tar", "main"},
+		{"file:///tmp/policy.tar//main", "file:///tmp/policy.tar", "main"},
+		{"/tmp/policy", "/tmp/policy", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			src, subdir := SplitSubdir(tt.src)
+			assert.Equal(t, tt.want, src)
+			assert.Equal(t, tt.subdir, subdir)
+		})
+	}
+}
+
+func TestSplitParam(t *testing.T) {
+	tests := []struct {
+		src   string
+		want  string
+		value string
+		found bool
+	}{
+		{"https://example.com/p.tgz", "https://example.com/p.tgz", "", false},
+		{"https://example.com/p.tgz?ref=v1", "https://example.com/p.tgz?ref=v1", "", false},
+		{"https://example.com/p.tgz?archive=false", "https://example.com/p.tgz", "false", true},
+		{"https://example.com/p.tgz?ref=v1&archive=tar.gz&depth=1", "https://example.com/p.tgz?ref=v1&depth=1", "tar.gz", true},
+		{"https://example.com/p.zip?archive=zip#entry", "https://example.com/p.zip#entry", "zip", true},
+		{"https://example.com/p?archive=tar%2Egz", "https://example.com/p", "tar.gz", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			src, value, found := SplitParam(tt.src, "archive")
+			assert.Equal(t, tt.want, src)
+			assert.Equal(t, tt.value, value)
+			assert.Equal(t, tt.found, found)
+		})
+	}
+}
@@ -0,0 +1,277 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package git
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+
+	"github.com/enterprise-contract/go-gather/expand"
+	gtar "github.com/enterprise-contract/go-gather/expand/tar"
+	"github.com/enterprise-contract/go-gather/internal/helpers"
+	"github.com/enterprise-contract/go-gather/metadata"
+)
+
+// GitCommand is the git binary run for "git archive --remote" in archive
+// mode.
+var GitCommand = "git"
+
+// githubAPI is the GitHub API snapshots of github.com repositories are
+// downloaded from.
+var githubAPI = "https://api.github.com"
+
+// errArchiveUnsupported is returned by archive for sources it cannot take a
+// snapshot of, which are cloned instead.
+var errArchiveUnsupported = errors.New("archive mode is not supported for the source")
+
+// archive downloads a snapshot of ref, or the default branch, of the
+// repository src without cloning it and writes its files, or those below
+// subdir, to dst. Repositories on GitHub and GitLab are downloaded with their
+// tarball APIs; SSH and local ones with "git archive --remote". It returns
+// the commit archived, or an empty string if the snapshot does not record
+// it.
+func (g *GitGatherer) archive(ctx context.Context, src, ref, subdir, dst string, auth transport.AuthMethod, client *http.Client) (string, []metadata.SkippedEntry, error) {
+	u, err := url.Parse(src)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to parse URL: %w", err)
+	}
+
+	tmpDir, err := os.MkdirTemp("", "git-archive-")
+	if err != nil {
+		return "", nil, fmt.Errorf("error creating temporary directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// Snapshots from the APIs have every file below a single directory named
+	// after the repository and commit, "git archive" has none
+	var snapshot string
+	var prefixed bool
+	if api := archiveURL(u, ref); api != "" {
+		snapshot = filepath.Join(tmpDir, "snapshot.tar.gz")
+		prefixed = true
+		err = download(ctx, client, api, snapshot, auth)
+	} else if isSSHSource(src) || u.Scheme == "file" {
+		snapshot = filepath.Join(tmpDir, "snapshot.tar")
+		err = g.gitArchive(ctx, u, ref, snapshot)
+	} else {
+		return "", nil, errArchiveUnsupported
+	}
+	if err != nil {
+		return "", nil, err
+	}
+
+	commit, err := archiveCommit(snapshot)
+	if err != nil {
+		return "", nil, err
+	}
+
+	root := filepath.Join(tmpDir, "files")
+	if _, err := (&gtar.TarExpander{}).Expand(expand.WithoutSandbox(ctx), snapshot, root, 0); err != nil {
+		return "", nil, fmt.Errorf("error extracting snapshot: %w", err)
+	}
+	if prefixed {
+		entries, err := os.ReadDir(root)
+		if err != nil {
+			return "", nil, fmt.Errorf("error reading snapshot: %w", err)
+		}
+		if len(entries) != 1 || !entries[0].IsDir() {
+			return "", nil, fmt.Errorf("unexpected layout of the snapshot of %s", src)
+		}
+		root = filepath.Join(root, entries[0].Name())
+	}
+	if subdir != "" {
+		root = filepath.Join(root, filepath.FromSlash(subdir))
+		if info, err := os.Stat(root); err != nil || !info.IsDir() {
+			return "", nil, fmt.Errorf("path %s does not exist in the repository", subdir)
+		}
+	}
+
+	filter := expand.NewCopyFilter(ctx, root, g.Hidden)
+	if err := helpers.CopyDirFilterContext(ctx, root, dst, filter.Skip); err != nil {
+		return "", nil, fmt.Errorf("error copying directory: %w", err)
+	}
+	if err := filter.Err(); err != nil {
+		return "", nil, err
+	}
+	return commit, filter.Skipped, nil
+}
+
+// archiveURL returns the API URL of the tarball of ref of the repository at
+// u, or an empty string if its host has no such API.
+func archiveURL(u *url.URL, ref string) string {
+	if u.Scheme != "https" {
+		return ""
+	}
+	repo := strings.TrimSuffix(strings.Trim(u.Path, "/"), ".git")
+	switch host := u.Hostname(); {
+	case host == "github.com":
+		if strings.Count(repo, "/") != 1 {
+			return ""
+		}
+		api := githubAPI + "/repos/" + repo + "/tarball"
+		if ref != "" {
+			api += "/" + url.PathEscape(ref)
+		}
+		return api
+	case isGitLab(host):
+		api := "https://" + u.Host + "/api/v4/projects/" + url.PathEscape(repo) + "/repository/archive.tar.gz"
+		if ref != "" {
+			api += "?sha=" + url.QueryEscape(ref)
+		}
+		return api
+	default:
+		return ""
+	}
+}
+
+// download writes the response to a GET of api with client to the file at
+// dst, sending the token in auth, if any, as a bearer token.
+func download(ctx context.Context, client *http.Client, api, dst string, auth transport.AuthMethod) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, api, nil)
+	if err != nil {
+		return fmt.Errorf("error creating request: %w", err)
+	}
+	if basic, ok := auth.(*githttp.BasicAuth); ok && basic.Password != "" {
+		req.Header.Set("Authorization", "Bearer "+basic.Password)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error downloading snapshot: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("error downloading snapshot from %s: %s", api, resp.Status)
+	}
+
+	f, err := os.Create(dst)
+	if err != nil {
+		return fmt.Errorf("error creating snapshot file: %w", err)
+	}
+	if _, err := io.Copy(f, resp.Body); err != nil {
+		f.Close()
+		return fmt.Errorf("error downloading snapshot: %w", err)
+	}
+	return f.Close()
+}
+
+// gitArchive writes a tar snapshot of ref of the repository at u to dst
+// with "git archive --remote". SSH sources are authenticated with the key
+// and known_hosts files in the gatherer's SSH options, or by ssh itself;
+// keys with a passphrase have to be added to the SSH agent.
+func (g *GitGatherer) gitArchive(ctx context.Context, u *url.URL, ref, dst string) error {
+	if ref == "" {
+		ref = "HEAD"
+	}
+	remote := *u
+	cmd := exec.CommandContext(ctx, GitCommand)
+	if u.Scheme == "ssh" {
+		opts := g.SSH.withEnv()
+		if opts.User != "" {
+			remote.User = url.User(opts.User)
+		}
+		cmd.Env = append(os.Environ(), "GIT_SSH_COMMAND="+sshCommand(opts))
+	}
+	// "--" keeps a ref starting with "-" from being read as an option
+	cmd.Args = append(cmd.Args, "archive", "--format=tar", "--remote="+remote.String(), "--", ref)
+
+	f, err := os.Create(dst)
+	if err != nil {
+		return fmt.Errorf("error creating snapshot file: %w", err)
+	}
+	defer f.Close()
+	var stderr bytes.Buffer
+	cmd.Stdout = f
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			return fmt.Errorf("the %q command is required for archive mode: %w", GitCommand, err)
+		}
+		return fmt.Errorf("git archive of %s failed: %w: %s", u.Redacted(), err, strings.TrimSpace(stderr.String()))
+	}
+	return f.Close()
+}
+
+// sshCommand returns the ssh command line git runs for the SSH options o.
+func sshCommand(o SSHOptions) string {
+	args := []string{"ssh", "-o", "BatchMode=yes"}
+	if o.KeyPath != "" {
+		args = append(args, "-i", shellQuote(o.KeyPath), "-o", "IdentitiesOnly=yes")
+	}
+	switch {
+	case o.InsecureIgnoreHostKey:
+		args = append(args, "-o", "StrictHostKeyChecking=no", "-o", "UserKnownHostsFile=/dev/null")
+	case len(o.KnownHostsFiles) > 0:
+		files := make([]string, len(o.KnownHostsFiles))
+		for i, f := range o.KnownHostsFiles {
+			files[i] = shellQuote(f)
+		}
+		args = append(args, "-o", shellQuote("UserKnownHostsFile="+strings.Join(files, " ")))
+	}
+	return strings.Join(args, " ")
+}
+
+// shellQuote quotes s for the shell git runs GIT_SSH_COMMAND with.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// archiveCommit returns the commit recorded in the pax global header "git
+// archive" writes to the snapshot at path, gzip compressed if its name says
+// so, or an empty string if there is none.
+func archiveCommit(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("error opening snapshot: %w", err)
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return "", fmt.Errorf("error reading snapshot: %w", err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+	header, err := tar.NewReader(r).Next()
+	if errors.Is(err, io.EOF) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("error reading snapshot: %w", err)
+	}
+	if header.Typeflag != tar.TypeXGlobalHeader {
+		return "", nil
+	}
+	return header.PAXRecords["comment"], nil
+}
@@ -0,0 +1,195 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package git
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+)
+
+func TestArchiveURL(t *testing.T) {
+	testCases := []struct {
+		src  string
+		ref  string
+		want string
+	}{
+		{"https://github.com/org/repo.git", "", "https://api.github.com/repos/org/repo/tarball"},
+		{"https://github.com/org/repo.git", "release/v1", "https://api.github.com/repos/org/repo/tarball/release%2Fv1"},
+		{"https://gitlab.com/group/sub/repo.git", "main", "https://gitlab.com/api/v4/projects/group%2Fsub%2Frepo/repository/archive.tar.gz?sha=main"},
+		{"https://gitlab.example.com/group/repo.git", "", "https://gitlab.example.com/api/v4/projects/group%2Frepo/repository/archive.tar.gz"},
+		{"https://bitbucket.org/org/repo.git", "main", ""},
+		{"ssh://git@github.com/org/repo.git", "main", ""},
+	}
+	for _, tc := range testCases {
+		u, err := url.Parse(tc.src)
+		if err != nil {
+			t.Fatalf("failed to parse %s: %v", tc.src, err)
+		}
+		if got := archiveURL(u, tc.ref); got != tc.want {
+			t.Errorf("archiveURL(%s, %q) = %q, want %q", tc.src, tc.ref, got, tc.want)
+		}
+	}
+}
+
+func TestSSHCommand(t *testing.T) {
+	got := sshCommand(SSHOptions{KeyPath: "/keys/it's", KnownHostsFiles: []string{"/a", "/b"}})
+	want := `ssh -o BatchMode=yes -i '/keys/it'\''s' -o IdentitiesOnly=yes -o 'UserKnownHostsFile='\''/a'\'' '\''/b'\'''`
+	if got != want {
+		t.Errorf("unexpected ssh command:\n got %s\nwant %s", got, want)
+	}
+}
+
+func TestGitGatherer_Gather_ArchiveLocal(t *testing.T) {
+	if _, err := exec.LookPath(GitCommand); err != nil {
+		t.Skipf("%s is not installed", GitCommand)
+	}
+	repoDir := t.TempDir()
+	initRefsRepo(t, repoDir)
+	repo, err := git.PlainOpen(repoDir)
+	if err != nil {
+		t.Fatalf("failed to open repo: %v", err)
+	}
+	tag, err := repo.ResolveRevision(plumbing.Revision("v1^{commit}"))
+	if err != nil {
+		t.Fatalf("failed to resolve tag: %v", err)
+	}
+
+	testCases := []struct {
+		ref    string
+		want   string
+		commit string
+	}{
+		{"", "default", ""},
+		{"feature", "feature", ""},
+		{"v1", "tagged", tag.String()},
+	}
+	for _, tc := range testCases {
+		dst := t.TempDir()
+		gg := GitGatherer{Archive: true}
+		m, err := gg.Gather(context.Background(), "git::"+repoDir+"?ref="+tc.ref, dst)
+		if err != nil {
+			t.Fatalf("Gather(%q) returned an unexpected error: %v", tc.ref, err)
+		}
+		got, err := os.ReadFile(filepath.Join(dst, "README.md"))
+		if err != nil || string(got) != tc.want {
+			t.Errorf("ref %q: expected README.md to contain %q, got %q (%v)", tc.ref, tc.want, got, err)
+		}
+		if _, err := os.Stat(filepath.Join(dst, ".git")); !os.IsNotExist(err) {
+			t.Errorf("ref %q: expected no repository in the destination", tc.ref)
+		}
+		gm := m.Get().(*GitMetadata)
+		if !gm.Archived || gm.LatestCommit == "" || (tc.commit != "" && gm.LatestCommit != tc.commit) {
+			t.Errorf("ref %q: unexpected metadata: %+v", tc.ref, gm)
+		}
+	}
+}
+
+// writeSnapshot writes a gzip compressed tarball like those of the GitHub
+// API, recording commit and holding files below prefix.
+func writeSnapshot(t *testing.T, w http.ResponseWriter, commit, prefix string, files map[string]string) {
+	t.Helper()
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	headers := []*tar.Header{
+		{Typeflag: tar.TypeXGlobalHeader, Name: "pax_global_header", PAXRecords: map[string]string{"comment": commit}},
+		{Typeflag: tar.TypeDir, Name: prefix + "/", Mode: 0755},
+	}
+	for _, h := range headers {
+		if err := tw.WriteHeader(h); err != nil {
+			t.Errorf("failed to write header: %v", err)
+		}
+	}
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeReg, Name: prefix + "/" + name, Mode: 0644, Size: int64(len(content))}); err != nil {
+			t.Errorf("failed to write header: %v", err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Errorf("failed to write file: %v", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Errorf("failed to close tar: %v", err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Errorf("failed to close gzip: %v", err)
+	}
+}
+
+func TestGitGatherer_Gather_ArchiveGitHub(t *testing.T) {
+	clearTokenEnv(t)
+	const commit = "0123456789abcdef0123456789abcdef01234567"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repos/org/repo/tarball/v1" {
+			http.NotFound(w, r)
+			return
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer s3cret" {
+			t.Errorf("unexpected Authorization header %q", got)
+		}
+		writeSnapshot(t, w, commit, "org-repo-0123456", map[string]string{
+			"README.md":      "readme",
+			"policy/a.rego":  "package a",
+			"policy/.hidden": "hidden",
+		})
+	}))
+	defer srv.Close()
+	orig := githubAPI
+	githubAPI = srv.URL
+	defer func() { githubAPI = orig }()
+
+	dst := t.TempDir()
+	gg := GitGatherer{Archive: true, Credentials: Credentials{Password: "s3cret"}}
+	gg.Hidden.All = true
+	m, err := gg.Gather(context.Background(), "https://github.com/org/repo//policy?ref=v1", dst)
+	if err != nil {
+		t.Fatalf("Gather returned an unexpected error: %v", err)
+	}
+	if got, err := os.ReadFile(filepath.Join(dst, "a.rego")); err != nil || string(got) != "package a" {
+		t.Errorf("expected a.rego to be gathered, got %q (%v)", got, err)
+	}
+	for _, name := range []string{".hidden", "README.md"} {
+		if _, err := os.Stat(filepath.Join(dst, name)); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be left out", name)
+		}
+	}
+	gm := m.Get().(*GitMetadata)
+	if !gm.Archived || gm.LatestCommit != commit || gm.Ref != "v1" {
+		t.Errorf("unexpected metadata: %+v", gm)
+	}
+
+	if _, err := gg.Gather(context.Background(), "https://github.com/org/repo?ref=missing", t.TempDir()); err == nil {
+		t.Error("expected an error for a missing ref")
+	}
+}
+
+func TestGitGatherer_Gather_ArchiveUnsupportedOptions(t *testing.T) {
+	gg := GitGatherer{Archive: true, Submodules: true}
+	if _, err := gg.Gather(context.Background(), "git::"+t.TempDir(), t.TempDir()); err == nil {
+		t.Error("expected an error combining archive mode with submodules")
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package git
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/go-git/go-git/v5"
+
+	"github.com/enterprise-contract/go-gather/internal/multierr"
+)
+
+// mirrorLocks serializes the updates of each mirror within the process.
+var mirrorLocks sync.Map
+
+// mirrorPath returns the path of the mirror of src in the cache at dir.
+func mirrorPath(dir, src string) string {
+	sum := sha256.Sum256([]byte(src))
+	return filepath.Join(dir, hex.EncodeToString(sum[:])+".git")
+}
+
+// syncMirror brings the bare mirror of the repository opts.URL in the cache
+// at dir up to date, cloning it if it is not cached yet, and returns its path
+// and whether it was already cached.
+func syncMirror(ctx context.Context, dir string, opts *git.CloneOptions) (string, bool, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", false, fmt.Errorf("error creating cache directory: %w", err)
+	}
+	path := mirrorPath(dir, opts.URL)
+	mu, _ := mirrorLocks.LoadOrStore(path, &sync.Mutex{})
+	mu.(*sync.Mutex).Lock()
+	defer mu.(*sync.Mutex).Unlock()
+
+	r, err := git.PlainOpen(path)
+	if errors.Is(err, git.ErrRepositoryNotExists) {
+		_, err = git.PlainCloneContext(ctx, path, true, &git.CloneOptions{
+			URL:             opts.URL,
+			Auth:            opts.Auth,
+			InsecureSkipTLS: opts.InsecureSkipTLS,
+			ProxyOptions:    opts.ProxyOptions,
+			Mirror:          true,
+		})
+		if err != nil {
+			err = fmt.Errorf("error mirroring repository: %w", err)
+			return "", false, multierr.Append(multierr.Errors{err}, os.RemoveAll(path)).Err()
+		}
+		return path, false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("error opening cached repository: %w", err)
+	}
+
+	err = r.FetchContext(ctx, &git.FetchOptions{
+		Auth:            opts.Auth,
+		InsecureSkipTLS: opts.InsecureSkipTLS,
+		ProxyOptions:    opts.ProxyOptions,
+		Force:           true,
+		Prune:           true,
+	})
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return "", false, fmt.Errorf("error updating cached repository: %w", err)
+	}
+	return path, true, nil
+}
@@ -0,0 +1,121 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package git
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+
+	"github.com/enterprise-contract/go-gather/gather"
+)
+
+// Environment variables consulted for HTTPS credentials the gatherer leaves
+// unset. Host specific tokens are only sent to their own host.
+const (
+	// EnvGitUsername is the user name sent with a token or password.
+	EnvGitUsername = "GIT_USERNAME"
+	// EnvGitToken is a token or password sent to any host.
+	EnvGitToken = "GIT_TOKEN"
+	// EnvGitHubToken is a token sent to github.com.
+	EnvGitHubToken = "GITHUB_TOKEN"
+	// EnvGitLabToken is a token sent to gitlab.com and hosts named gitlab.*.
+	EnvGitLabToken = "GITLAB_TOKEN"
+)
+
+// Credentials authenticate https:// sources with HTTP basic auth.
+type Credentials struct {
+	// Username defaults to the name the host expects alongside a token,
+	// e.g. "x-access-token" on GitHub and "oauth2" on GitLab.
+	Username string
+	// Password is a password or personal access token.
+	Password string
+}
+
+// httpAuth returns the authentication method for the HTTPS URL src, or nil
+// to clone anonymously, or with the credentials in src itself.
+func (g *GitGatherer) httpAuth(src string) (transport.AuthMethod, error) {
+	u, err := url.Parse(src)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse URL: %w", err)
+	}
+	creds := g.Credentials
+	if creds.Password == "" {
+		if _, ok := u.User.Password(); ok {
+			return nil, nil
+		}
+		creds.Password = tokenFromEnv(u.Hostname())
+	}
+	if creds.Password == "" {
+		return nil, nil
+	}
+	if creds.Username == "" {
+		creds.Username = os.Getenv(EnvGitUsername)
+	}
+	if creds.Username == "" {
+		creds.Username = tokenUsername(u.Hostname())
+	}
+	return &http.BasicAuth{Username: creds.Username, Password: creds.Password}, nil
+}
+
+// tokenFromEnv returns the token to send to host from the environment.
+func tokenFromEnv(host string) string {
+	var token string
+	switch {
+	case host == "github.com":
+		token = os.Getenv(EnvGitHubToken)
+	case isGitLab(host):
+		token = os.Getenv(EnvGitLabToken)
+	}
+	if token == "" {
+		token = os.Getenv(EnvGitToken)
+	}
+	return token
+}
+
+// authError returns err matching gather.ErrAuthRequired too when the
+// server refused the credentials sent, or asked for some.
+func authError(err error) error {
+	if errors.Is(err, transport.ErrAuthenticationRequired) || errors.Is(err, transport.ErrAuthorizationFailed) {
+		return fmt.Errorf("%w: %w", gather.ErrAuthRequired, err)
+	}
+	return err
+}
+
+// tokenUsername returns the user name host expects a token to be sent with.
+// Hosts that ignore it are sent "git".
+func tokenUsername(host string) string {
+	switch {
+	case host == "github.com":
+		return "x-access-token"
+	case isGitLab(host):
+		return "oauth2"
+	case host == "bitbucket.org":
+		return "x-token-auth"
+	default:
+		return "git"
+	}
+}
+
+func isGitLab(host string) bool {
+	return host == "gitlab.com" || strings.HasPrefix(host, "gitlab.")
+}
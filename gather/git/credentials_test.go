@@ -0,0 +1,115 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	nethttp "net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/http"
+
+	"github.com/enterprise-contract/go-gather/gather"
+)
+
+func clearTokenEnv(t *testing.T) {
+	for _, env := range []string{EnvGitUsername, EnvGitToken, EnvGitHubToken, EnvGitLabToken} {
+		t.Setenv(env, "")
+	}
+}
+
+func TestGitGatherer_httpAuth(t *testing.T) {
+	tests := []struct {
+		name  string
+		creds Credentials
+		env   map[string]string
+		src   string
+		want  *http.BasicAuth
+	}{
+		{"anonymous", Credentials{}, nil, "https://github.com/org/repo.git", nil},
+		{"option", Credentials{Username: "me", Password: "pw"}, map[string]string{EnvGitToken: "env"}, "https://example.com/org/repo.git", &http.BasicAuth{Username: "me", Password: "pw"}},
+		{"option token", Credentials{Password: "tok"}, nil, "https://gitlab.com/org/repo.git", &http.BasicAuth{Username: "oauth2", Password: "tok"}},
+		{"github token", Credentials{}, map[string]string{EnvGitHubToken: "gh"}, "https://github.com/org/repo.git", &http.BasicAuth{Username: "x-access-token", Password: "gh"}},
+		{"github token not sent elsewhere", Credentials{}, map[string]string{EnvGitHubToken: "gh"}, "https://example.com/org/repo.git", nil},
+		{"gitlab token", Credentials{}, map[string]string{EnvGitLabToken: "gl"}, "https://gitlab.example.com/org/repo.git", &http.BasicAuth{Username: "oauth2", Password: "gl"}},
+		{"generic token", Credentials{}, map[string]string{EnvGitToken: "t", EnvGitUsername: "bot"}, "https://example.com/org/repo.git", &http.BasicAuth{Username: "bot", Password: "t"}},
+		{"credentials in URL", Credentials{}, map[string]string{EnvGitToken: "t"}, "https://me:pw@example.com/org/repo.git", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clearTokenEnv(t)
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			g := &GitGatherer{Credentials: tt.creds}
+			auth, err := g.httpAuth(tt.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.want == nil {
+				if auth != nil {
+					t.Errorf("expected no auth method, got %v", auth)
+				}
+				return
+			}
+			got, ok := auth.(*http.BasicAuth)
+			if !ok || *got != *tt.want {
+				t.Errorf("expected %v, got %v", tt.want, auth)
+			}
+		})
+	}
+}
+
+func TestGitGatherer_Gather_SendsCredentials(t *testing.T) {
+	clearTokenEnv(t)
+	var authorized bool
+	srv := httptest.NewTLSServer(nethttp.HandlerFunc(func(w nethttp.ResponseWriter, r *nethttp.Request) {
+		user, pass, ok := r.BasicAuth()
+		authorized = ok && user == "me" && pass == "secret"
+		w.WriteHeader(nethttp.StatusNotFound)
+	}))
+	defer srv.Close()
+	t.Setenv("GIT_SSL_NO_VERIFY", "true")
+
+	g := &GitGatherer{Credentials: Credentials{Username: "me", Password: "secret"}}
+	src := strings.TrimPrefix(srv.URL, "https://") + "/org/repo.git"
+	if _, err := g.Gather(context.Background(), src, t.TempDir()); err == nil {
+		t.Fatal("expected an error from a server without the repository")
+	}
+	if !authorized {
+		t.Error("expected the credentials to be sent to the server")
+	}
+}
+
+func TestAuthError(t *testing.T) {
+	for _, err := range []error{transport.ErrAuthenticationRequired, transport.ErrAuthorizationFailed} {
+		if got := authError(fmt.Errorf("clone: %w", err)); !errors.Is(got, gather.ErrAuthRequired) || !errors.Is(got, err) {
+			t.Errorf("expected %v to match gather.ErrAuthRequired, got %v", err, got)
+		}
+	}
+	if err := authError(transport.ErrRepositoryNotFound); errors.Is(err, gather.ErrAuthRequired) {
+		t.Errorf("expected a missing repository not to ask for authentication, got %v", err)
+	}
+	if authError(nil) != nil {
+		t.Error("expected no error")
+	}
+}
@@ -18,36 +18,140 @@ package git
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"io"
+	"io/fs"
+	"net/http"
 	"net/url"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	giturls "github.com/chainguard-dev/git-urls"
+	"github.com/go-git/go-billy/v5/util"
 	"github.com/go-git/go-git/v5"
 	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
 	"github.com/go-git/go-git/v5/plumbing/transport"
 	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	"go.opentelemetry.io/otel/attribute"
 
+	"github.com/enterprise-contract/go-gather/expand"
+	"github.com/enterprise-contract/go-gather/fserrors"
 	"github.com/enterprise-contract/go-gather/gather"
+	"github.com/enterprise-contract/go-gather/internal/helpers"
+	"github.com/enterprise-contract/go-gather/internal/logging"
+	"github.com/enterprise-contract/go-gather/internal/metrics"
+	"github.com/enterprise-contract/go-gather/internal/proxy"
+	"github.com/enterprise-contract/go-gather/internal/ratelimit"
+	"github.com/enterprise-contract/go-gather/internal/tracing"
 	"github.com/enterprise-contract/go-gather/metadata"
 )
 
+// DefaultDepth is the number of commits fetched when neither the gatherer's
+// Depth nor a depth query parameter says otherwise. Only the checked out
+// files are needed, so the history is not fetched.
+const DefaultDepth = 1
+
 type GitGatherer struct {
 	GitMetadata
 	Authenticator SSHAuthenticator
+	// Depth limits the number of commits fetched. Zero uses DefaultDepth and
+	// a negative value fetches the full history. A depth query parameter in
+	// the source URI, e.g. "?depth=10", takes precedence; "?depth=0" fetches
+	// the full history.
+	Depth int
+	// Submodules recursively initializes and checks out the submodules of
+	// the repository at the commits it records. When a subdirectory is
+	// gathered only the submodules within it are fetched.
+	Submodules bool
+	// SSH configures authentication for git@host:org/repo and ssh:// sources.
+	SSH SSHOptions
+	// LFS replaces Git LFS pointer files with the objects they point to,
+	// fetched from the LFS server of https:// sources or the LFS store of
+	// local repositories.
+	LFS bool
+	// Hidden selects hidden files and directories to leave out of the
+	// destination. Leaving out ".git" removes the repository, so later
+	// gathers into the same destination clone it again.
+	Hidden expand.HiddenFiles
+	// Signatures lists the keys trusted to sign the gathered commit, or the
+	// annotated tag requested. When set, gathering fails with
+	// ErrSignatureVerification unless it is signed by one of them.
+	Signatures SignatureVerification
+	// CacheDir is a directory where bare mirrors of the repositories
+	// gathered are kept. Each gather fetches into the mirror and clones from
+	// it, which is much faster for repositories gathered repeatedly.
+	// Gathers sharing a cache directory must be in the same process.
+	CacheDir string
+	// Credentials authenticate https:// sources. Without them a token is
+	// taken from the environment, see EnvGitToken.
+	Credentials Credentials
+	// Archive downloads a snapshot of the ref instead of cloning, which is
+	// much faster for repositories with a large history. Repositories on
+	// GitHub and GitLab are downloaded with their tarball APIs, SSH and
+	// local ones with "git archive --remote", which the server has to
+	// allow. Other sources are cloned as usual. The snapshot has no
+	// repository, so later gathers into the same destination download it
+	// again. It cannot be combined with Submodules or Signatures.
+	Archive bool
+	// Proxy is the URL of a proxy to reach the repository through, e.g.
+	// "http://proxy.example.com:3128", in place of the one of the
+	// HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables. It also
+	// applies to SSH sources, for a "socks5://" proxy, and to LFS objects
+	// and archive snapshots. Submodules, and archives taken with "git
+	// archive", are reached through the proxy of the environment only.
+	Proxy string
+	// RateLimit bounds the bandwidth of the gather, in bytes per second,
+	// for repositories cloned over HTTP(S), and LFS objects and archive
+	// snapshots. Clones over SSH and from local repositories are not
+	// throttled, nor are they when zero.
+	RateLimit int64
+	// InsecureSkipTLS accepts any certificate HTTPS servers present, as
+	// setting GIT_SSL_NO_VERIFY=true does.
+	InsecureSkipTLS bool
 }
 
 type GitMetadata struct {
-	Path         string
-	CommitHash   string
-	Author       string
-	Timestamp    string
+	// URI is the source as given to Gather.
+	URI        string
+	Path       string
+	CommitHash string
+	Author     string
+	Timestamp  string
+	// Ref is the branch, tag or commit requested with the ref query
+	// parameter, empty if the default branch was cloned.
+	Ref          string
 	LatestCommit string
+	// SubmoduleCommits maps the path of every submodule checked out,
+	// relative to the repository root, to its commit.
+	SubmoduleCommits map[string]string
+	// Updated reports whether a checkout left in the destination by an
+	// earlier gather was fetched and reset instead of cloning again.
+	Updated bool
+	// LFSObjects is the number of Git LFS objects fetched.
+	LFSObjects int
+	// Cached reports whether the repository was cloned from a mirror that
+	// was already in the cache, rather than one mirrored for this gather.
+	Cached bool
+	// Signed describes the commit or tag whose signature was verified, and
+	// SignedBy the key ID or fingerprint of the key that signed it.
+	Signed   string
+	SignedBy string
+	// Archived reports whether a snapshot was downloaded in archive mode
+	// rather than the repository cloned. CommitHash and LatestCommit are
+	// empty when the snapshot does not record its commit, and Author is
+	// always empty.
+	Archived bool
+	// Skipped lists the files of the repository that were left out, and
+	// why.
+	Skipped []metadata.SkippedEntry
+	// Sizes reports the sizes of the files gathered.
+	Sizes *metadata.SizeReport
 }
 
 // SSHAuthenticator represents an interface for authenticating SSH connections.
@@ -70,66 +174,213 @@ func (g *GitGatherer) Matcher(uri string) bool {
 	return false
 }
 
-func (g *GitGatherer) Gather(ctx context.Context, src, dst string) (metadata.Metadata, error) {
+// HandlesGetterSyntax reports that the gatherer checks out the "//"
+// subdirectory of a repository itself.
+func (g *GitGatherer) HandlesGetterSyntax(part string) bool {
+	return part == gather.GetterSubdir
+}
+
+// KeepsState reports whether a gather of src leaves a repository in dst,
+// which later gathers update in place. Archive snapshots and subdirectories
+// of a repository leave none.
+func (g *GitGatherer) KeepsState(src, dst string) bool {
+	_, _, subdir, _, err := processUrl(src)
+	return err == nil && subdir == "" && !g.Archive
+}
+
+// StateFiles returns no files, as the repository is kept in the destination
+// itself.
+func (g *GitGatherer) StateFiles(dst string) (gathered, unfinished []string) {
+	return nil, nil
+}
+
+func (g *GitGatherer) Gather(ctx context.Context, src, dst string) (_ metadata.Metadata, err error) {
+	ctx, span := tracing.Start(ctx, "git.clone", tracing.Source(src)...)
+	defer func() { tracing.End(span, err) }()
+
+	defer func() { err = fserrors.Classify(authError(err)) }()
+
 	select {
 	case <-ctx.Done():
 		return nil, ctx.Err()
 	default:
 	}
+	g.URI = src
 	// Process our provided source URL to get the source URL, ref, subdir, and depth
 	src, ref, subdir, depth, err := processUrl(src)
 	if err != nil {
 		return nil, fmt.Errorf("failed to process URL: %w", err)
 	}
+	if subdir != "" {
+		subdir = path.Clean(strings.Trim(subdir, "/"))
+		if subdir == "." || subdir == ".." || strings.HasPrefix(subdir, "../") {
+			return nil, fmt.Errorf("illegal subdirectory: %s", subdir)
+		}
+	}
 
 	// Initialize the clone options for the git repository
 	cloneOpts := &git.CloneOptions{
 		URL:             src,
-		InsecureSkipTLS: os.Getenv("GIT_SSL_NO_VERIFY") == "true",
+		InsecureSkipTLS: g.InsecureSkipTLS || os.Getenv("GIT_SSL_NO_VERIFY") == "true",
+		ProxyOptions:    transport.ProxyOptions{URL: g.Proxy},
+	}
+	if g.Proxy != "" {
+		if _, err := proxy.Parse(g.Proxy); err != nil {
+			return nil, err
+		}
+	}
+	switch {
+	case isSSHSource(src) && g.Archive:
+		// Archives of SSH sources are taken by git, which runs ssh itself
+	case isSSHSource(src):
+		if cloneOpts.Auth, err = g.sshAuth(src); err != nil {
+			return nil, err
+		}
+	case strings.HasPrefix(src, "https://"):
+		if cloneOpts.Auth, err = g.httpAuth(src); err != nil {
+			return nil, err
+		}
+	}
+
+	// Submodules and LFS objects are fetched from their own servers, with
+	// the credentials for the source, even when it is cloned from the cache
+	auth := cloneOpts.Auth
+
+	// LFS objects and archive snapshots are downloaded over HTTPS
+	limiter := ratelimit.New(g.RateLimit)
+	client, err := httpClient(cloneOpts.InsecureSkipTLS, g.Proxy, limiter)
+	if err != nil {
+		return nil, err
 	}
 
-	// If we have a ref and it isn't a hash, set the reference name in the clone options
-	if len(ref) > 0 && !plumbing.IsHash(ref) {
-		cloneOpts.ReferenceName = plumbing.ReferenceName(ref)
+	// Clones and fetches over HTTP(S) are throttled by the limiter they
+	// carry on their context
+	if limiter != nil {
+		throttleProtocols()
+		ctx = ratelimit.WithLimiter(ctx, limiter)
 	}
 
-	if depth != "" {
-		cloneOpts.Depth, err = strconv.Atoi(depth)
+	if g.Archive {
+		m, err := g.gatherArchive(ctx, src, ref, subdir, dst, auth, client)
+		if !errors.Is(err, errArchiveUnsupported) {
+			return m, err
+		}
+	}
+
+	// With a cache, the repository is cloned from a local mirror that is
+	// kept up to date with a fetch
+	var cached bool
+	if g.CacheDir != "" {
+		mirror, hit, err := syncMirror(ctx, g.CacheDir, cloneOpts)
 		if err != nil {
-			return nil, fmt.Errorf("failed to parse depth: %w", err)
+			return nil, err
+		}
+		cached = hit
+		cloneOpts.URL = mirror
+		cloneOpts.Auth = nil
+	}
+
+	// A commit can only be checked out once the history containing it has
+	// been fetched, so a depth is only honoured for branches and tags
+	if !plumbing.IsHash(ref) {
+		cloneOpts.Depth, err = g.depth(depth)
+		if err != nil {
+			return nil, err
 		}
 	}
 
 	// Initialize the git repository and worktree
-	r := &git.Repository{}
-	w := &git.Worktree{}
+	var r *git.Repository
+	var w *git.Worktree
 
-	// tmpDir is used to clone the repository if a subdir is specified
+	// tmpDir is used to clone the repository if a subdir is specified, or
+	// if a sandbox restricts what may be written to dst
 	var tmpDir string
+	sandbox := expand.SandboxFromContext(ctx)
+	staged := subdir != "" || sandbox != nil
+	var skipped []metadata.SkippedEntry
 
-	if subdir != "" {
+	cloneDir := dst
+	if staged {
 		tmpDir, err = os.MkdirTemp("", "git-repo-")
 		if err != nil {
 			return nil, fmt.Errorf("error creating temporary directory: %w", err)
 		}
 		defer os.RemoveAll(tmpDir)
+		cloneDir = tmpDir
+	}
+	if subdir != "" {
+		// Only the subdirectory is checked out, using a sparse checkout
+		cloneOpts.NoCheckout = true
+	}
 
-		r, err = git.PlainCloneContext(ctx, tmpDir, false, cloneOpts)
+	// The signature of the commit, or tag, is verified before any of its
+	// files are written
+	var signed, signedBy string
+	verify := func(h plumbing.Hash) (err error) {
+		if !g.Signatures.Enabled() {
+			return nil
+		}
+		signed, signedBy, err = verifySignature(r, ref, h, g.Signatures)
 		if err != nil {
-			return nil, fmt.Errorf("error cloning repository: %w", err)
+			metadata.RecordCheck(ctx, metadata.SecurityCheck{Check: "signature", Subject: h.String(), Outcome: metadata.CheckRejected, Detail: err.Error()})
+			return err
+		}
+		metadata.RecordCheck(ctx, metadata.SecurityCheck{Check: "signature", Subject: h.String(), Outcome: metadata.CheckPassed, Detail: signed + " signed by " + signedBy})
+		return nil
+	}
+	if g.Signatures.Enabled() {
+		cloneOpts.NoCheckout = true
+	}
+
+	// A checkout of the same repository left in dst by an earlier gather is
+	// updated in place, which is much cheaper than cloning it again
+	var updated bool
+	if !staged {
+		if r, err = openCheckout(dst, cloneOpts.URL); err != nil {
+			return nil, err
+		}
+	}
+	if r != nil {
+		err = update(ctx, r, cloneOpts, ref, verify)
+		switch {
+		case errors.Is(err, errCommitNotFetched):
+			// The commit lies beyond what the shallow checkout can
+			// fetch, so it is replaced by a fresh clone
+			if err := removeContents(dst); err != nil {
+				return nil, fmt.Errorf("error removing existing checkout: %w", err)
+			}
+			r = nil
+		case errors.Is(err, ErrSignatureVerification):
+			return nil, err
+		case err != nil:
+			return nil, fmt.Errorf("error updating repository: %w", err)
+		default:
+			updated = true
 		}
-	} else {
-		r, err = git.PlainCloneContext(ctx, dst, false, cloneOpts)
+	}
+	if r == nil {
+		r, err = clone(ctx, cloneDir, cloneOpts, ref)
 		if err != nil {
 			return nil, fmt.Errorf("error cloning repository: %w", err)
 		}
 	}
 
-	if ref != "" {
-		h, err := r.ResolveRevision(plumbing.Revision(ref))
+	// Branches and tags are checked out by the clone itself, commits, and
+	// subdirectories or signed commits of any ref, have to be checked out
+	// afterwards
+	if !updated && (plumbing.IsHash(ref) || cloneOpts.NoCheckout) {
+		rev := plumbing.Revision(plumbing.HEAD)
+		if plumbing.IsHash(ref) {
+			rev = plumbing.Revision(ref)
+		}
+		h, err := r.ResolveRevision(rev)
 		if err != nil {
 			return nil, fmt.Errorf("error resolving ref: %w", err)
 		}
+		if err := verify(*h); err != nil {
+			return nil, err
+		}
 		w, err = r.Worktree()
 		if err != nil {
 			return nil, fmt.Errorf("error getting worktree: %w", err)
@@ -137,139 +388,354 @@ func (g *GitGatherer) Gather(ctx context.Context, src, dst string) (metadata.Met
 		checkoutOpts := &git.CheckoutOptions{
 			Hash: *h,
 		}
+		if subdir != "" {
+			checkoutOpts.SparseCheckoutDirectories = []string{subdir}
+		}
 		err = w.Checkout(checkoutOpts)
 		if err != nil {
 			return nil, fmt.Errorf("error checking out ref: %w", err)
 		}
 	}
 
-	if subdir != "" {
-		w, err = r.Worktree()
-		if err != nil {
-			return nil, fmt.Errorf("error getting worktree: %w", err)
+	var submodules map[string]string
+	if g.Submodules {
+		if submodules, err = updateSubmodules(ctx, r, subdir, auth); err != nil {
+			return nil, err
 		}
-		_, err = w.Filesystem.Stat(subdir)
-		if err != nil {
-			return nil, fmt.Errorf("path %s does not exist in the repository", subdir)
+	}
+
+	if staged {
+		root := tmpDir
+		if subdir != "" {
+			info, err := w.Filesystem.Stat(subdir)
+			if err != nil || !info.IsDir() {
+				return nil, fmt.Errorf("path %s does not exist in the repository", subdir)
+			}
+			root = filepath.Join(tmpDir, filepath.FromSlash(subdir))
 		}
-		path := filepath.Join(tmpDir, subdir)
-		err = copyDir(path, dst)
+		filter := expand.NewCopyFilter(ctx, root, g.Hidden)
+		err = helpers.CopyDirFilterContext(ctx, root, dst, filter.Skip)
 		if err != nil {
 			return nil, fmt.Errorf("error copying directory: %w", err)
 		}
+		if err := filter.Err(); err != nil {
+			return nil, err
+		}
+		skipped = filter.Skipped
+	}
+
+	var lfsObjects int
+	if g.LFS {
+		lfsObjects, err = smudgeLFS(ctx, dst, src, auth, client)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	head, err := r.Head()
 	if err != nil {
 		return nil, fmt.Errorf("determining the HEAD reference: %w", err)
 	}
+	commit, err := r.CommitObject(head.Hash())
+	if err != nil {
+		return nil, fmt.Errorf("error reading the HEAD commit: %w", err)
+	}
 
-	m := &GitMetadata{
-		LatestCommit: head.Hash().String(),
+	// Hidden files are removed last, as they may include the repository
+	if !staged {
+		if skipped, err = removeHidden(dst, g.Hidden); err != nil {
+			return nil, err
+		}
 	}
-	return m, nil
-}
 
-func (g *GitMetadata) Get() interface{} {
-	return g
+	g.Path = dst
+	g.Ref = ref
+	g.CommitHash = head.Hash().String()
+	g.LatestCommit = head.Hash().String()
+	g.Author = commit.Author.String()
+	g.SubmoduleCommits = submodules
+	g.Updated = updated
+	g.Cached = cached
+	g.LFSObjects = lfsObjects
+	g.Signed = signed
+	g.SignedBy = signedBy
+	g.Archived = false
+	g.Skipped = skipped
+	if g.Sizes, err = metadata.ScanSizes(ctx, dst, metadata.LargestFiles); err != nil {
+		return nil, fmt.Errorf("failed to report sizes: %w", err)
+	}
+	g.Timestamp = time.Now().Format(time.RFC3339)
+	logging.Debug(ctx, "cloned repository", logging.Source(src), "commit", g.CommitHash, "cached", cached, "updated", updated, "files", g.Sizes.Files, "bytes", g.Sizes.Bytes)
+	tracing.Annotate(ctx, attribute.String("git.commit", g.CommitHash), attribute.Bool("git.cached", cached), attribute.Int("files", g.Sizes.Files), attribute.Int64("bytes", g.Sizes.Bytes))
+	if cached {
+		metrics.CacheHit(ctx)
+	}
+	metrics.Transferred(ctx, g.Sizes.Bytes)
+	return &g.GitMetadata, nil
 }
 
-func (g GitMetadata) GetPinnedURL(u string) (string, error) {
-	if len(u) == 0 {
-		return "", fmt.Errorf("empty URL")
+// gatherArchive gathers src in archive mode, returning errArchiveUnsupported
+// if it has to be cloned instead.
+func (g *GitGatherer) gatherArchive(ctx context.Context, src, ref, subdir, dst string, auth transport.AuthMethod, client *http.Client) (metadata.Metadata, error) {
+	if g.Submodules || g.Signatures.Enabled() {
+		return nil, errors.New("archive mode cannot be combined with submodules or signature verification")
 	}
-	if g.LatestCommit == "" {
-		return "", fmt.Errorf("latest commit not set")
-	}
-	for _, scheme := range []string{"git::", "git://", "https://"} {
-		u = strings.TrimPrefix(u, scheme)
+	commit, skipped, err := g.archive(ctx, src, ref, subdir, dst, auth, client)
+	if err != nil {
+		return nil, err
 	}
-	if strings.HasPrefix(u, "git@") {
-		u = strings.Replace(strings.Split(u, "git@")[1], ":", "/", 1)
+
+	var lfsObjects int
+	if g.LFS {
+		if lfsObjects, err = smudgeLFS(ctx, dst, src, auth, client); err != nil {
+			return nil, err
+		}
 	}
-	return "git::" + strings.SplitN(u, "?ref=", 2)[0] + "?ref=" + g.LatestCommit, nil
-}
 
-// NewSSHAgentAuth returns an AuthMethod that uses the SSH agent for authentication.
-// It uses the specified user as the username for authentication.
-func (r *RealSSHAuthenticator) NewSSHAgentAuth(user string) (transport.AuthMethod, error) {
-	return ssh.NewSSHAgentAuth(user)
+	g.Path = dst
+	g.Ref = ref
+	g.CommitHash = commit
+	g.LatestCommit = commit
+	g.Author = ""
+	g.SubmoduleCommits = nil
+	g.Updated = false
+	g.Cached = false
+	g.LFSObjects = lfsObjects
+	g.Signed = ""
+	g.SignedBy = ""
+	g.Archived = true
+	g.Skipped = skipped
+	if g.Sizes, err = metadata.ScanSizes(ctx, dst, metadata.LargestFiles); err != nil {
+		return nil, fmt.Errorf("failed to report sizes: %w", err)
+	}
+	g.Timestamp = time.Now().Format(time.RFC3339)
+	logging.Debug(ctx, "downloaded repository archive", logging.Source(src), "commit", commit, "files", g.Sizes.Files, "bytes", g.Sizes.Bytes)
+	tracing.Annotate(ctx, attribute.String("git.commit", commit), attribute.Bool("git.archive", true), attribute.Int("files", g.Sizes.Files), attribute.Int64("bytes", g.Sizes.Bytes))
+	metrics.Transferred(ctx, g.Sizes.Bytes)
+	return &g.GitMetadata, nil
 }
 
-// copyDir copies the contents of the src directory to dst directory
-func copyDir(src string, dst string) error {
-	src = filepath.Clean(src)
-	dst = filepath.Clean(dst)
-
-	srcInfo, err := os.Stat(src)
+// removeHidden removes the hidden files and directories selected by h from
+// the tree at root, returning what it removed.
+func removeHidden(root string, h expand.HiddenFiles) ([]metadata.SkippedEntry, error) {
+	if h.IsZero() {
+		return nil, nil
+	}
+	var removed []metadata.SkippedEntry
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || p == root {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		if !h.Excludes(filepath.ToSlash(rel)) {
+			return nil
+		}
+		if err := os.RemoveAll(p); err != nil {
+			return err
+		}
+		removed = append(removed, metadata.SkippedEntry{Path: filepath.ToSlash(rel), Reason: metadata.SkipHidden})
+		if d.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	})
 	if err != nil {
-		return fmt.Errorf("error getting source directory info: %w", err)
+		return nil, fmt.Errorf("error removing hidden files: %w", err)
 	}
+	return removed, nil
+}
 
-	if !srcInfo.IsDir() {
-		return fmt.Errorf("%s is not a directory", src)
+// updateSubmodules initializes and checks out the submodules of r, and their
+// submodules in turn, returning the commit checked out for each by path. If
+// subdir is set only submodules below it are updated.
+func updateSubmodules(ctx context.Context, r *git.Repository, subdir string, auth transport.AuthMethod) (map[string]string, error) {
+	w, err := r.Worktree()
+	if err != nil {
+		return nil, fmt.Errorf("error getting worktree: %w", err)
 	}
-
-	_, err = os.Stat(dst)
+	if subdir != "" {
+		// A sparse checkout leaves out .gitmodules, which submodules are
+		// read from
+		if err := restoreGitmodules(r, w); err != nil {
+			return nil, err
+		}
+	}
+	subs, err := w.Submodules()
 	if err != nil {
-		if os.IsNotExist(err) {
-			err = os.MkdirAll(dst, srcInfo.Mode())
-			if err != nil {
-				return err
-			}
-		} else {
-			return err
+		return nil, fmt.Errorf("error reading submodules: %w", err)
+	}
+
+	checkedOut := map[string]string{}
+	for _, sub := range subs {
+		subPath := sub.Config().Path
+		if subdir != "" && !strings.HasPrefix(subPath+"/", subdir+"/") {
+			continue
+		}
+		// The recorded commit need not be the tip of a branch, so the full
+		// history of submodules is fetched
+		err := sub.UpdateContext(ctx, &git.SubmoduleUpdateOptions{
+			Init:              true,
+			Auth:              auth,
+			RecurseSubmodules: git.DefaultSubmoduleRecursionDepth,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error updating submodule %s: %w", subPath, err)
+		}
+		status, err := sub.Status()
+		if err != nil {
+			return nil, fmt.Errorf("error reading status of submodule %s: %w", subPath, err)
 		}
+		checkedOut[subPath] = status.Current.String()
 	}
+	return checkedOut, nil
+}
 
-	entries, err := os.ReadDir(src)
+// restoreGitmodules writes the .gitmodules file of the HEAD commit, if it
+// has one, to the worktree.
+func restoreGitmodules(r *git.Repository, w *git.Worktree) error {
+	head, err := r.Head()
 	if err != nil {
-		return err
+		return fmt.Errorf("determining the HEAD reference: %w", err)
 	}
+	commit, err := r.CommitObject(head.Hash())
+	if err != nil {
+		return fmt.Errorf("error reading the HEAD commit: %w", err)
+	}
+	file, err := commit.File(".gitmodules")
+	if errors.Is(err, object.ErrFileNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error reading .gitmodules: %w", err)
+	}
+	contents, err := file.Contents()
+	if err != nil {
+		return fmt.Errorf("error reading .gitmodules: %w", err)
+	}
+	return util.WriteFile(w.Filesystem, ".gitmodules", []byte(contents), 0644)
+}
 
-	for _, entry := range entries {
-		srcPath := filepath.Join(src, entry.Name())
-		dstPath := filepath.Join(dst, entry.Name())
-
-		if entry.IsDir() {
-			err = copyDir(srcPath, dstPath)
-			if err != nil {
-				return err
-			}
-		} else {
-			err = copyFile(srcPath, dstPath)
-			if err != nil {
-				return err
-			}
+// depth returns the clone depth to use given the value of the depth query
+// parameter, with zero meaning the full history.
+func (g *GitGatherer) depth(param string) (int, error) {
+	if param != "" {
+		d, err := strconv.Atoi(param)
+		if err != nil || d < 0 {
+			return 0, fmt.Errorf("failed to parse depth: invalid depth %q", param)
 		}
+		return d, nil
+	}
+	switch {
+	case g.Depth < 0:
+		return 0, nil
+	case g.Depth == 0:
+		return DefaultDepth, nil
+	default:
+		return g.Depth, nil
 	}
-	return nil
 }
 
-// copyFile copies a file from src to dst
-func copyFile(src string, dst string) error {
-	srcFile, err := os.Open(src)
-	if err != nil {
-		return err
+// clone clones the repository into dir with the ref checked out. A full
+// reference name, such as "refs/heads/main", is used as is. A short name is
+// tried as a branch and then as a tag. Commit hashes are left to the caller,
+// the default branch is cloned for them.
+func clone(ctx context.Context, dir string, opts *git.CloneOptions, ref string) (*git.Repository, error) {
+	if ref == "" || plumbing.IsHash(ref) {
+		return git.PlainCloneContext(ctx, dir, false, opts)
 	}
-	defer srcFile.Close()
 
-	dstFile, err := os.Create(dst)
-	if err != nil {
-		return err
+	names := []plumbing.ReferenceName{plumbing.ReferenceName(ref)}
+	if !strings.HasPrefix(ref, "refs/") {
+		names = []plumbing.ReferenceName{plumbing.NewBranchReferenceName(ref), plumbing.NewTagReferenceName(ref)}
 	}
-	defer dstFile.Close()
 
-	_, err = io.Copy(dstFile, srcFile)
-	if err != nil {
-		return err
+	var err error
+	for _, name := range names {
+		opts.ReferenceName = name
+		var r *git.Repository
+		r, err = git.PlainCloneContext(ctx, dir, false, opts)
+		if !errors.Is(err, plumbing.ErrReferenceNotFound) {
+			return r, err
+		}
 	}
+	return nil, err
+}
+
+func (g *GitMetadata) Get() interface{} {
+	return g
+}
 
-	srcInfo, err := os.Stat(src)
+// Relocate updates Path for what was gathered having moved from from to
+// to.
+func (g *GitMetadata) Relocate(from, to string) {
+	g.Path = metadata.RelocatePath(g.Path, from, to)
+}
+
+// GetSkipped returns the files of the repository the gather left out.
+func (g GitMetadata) GetSkipped() []metadata.SkippedEntry {
+	return g.Skipped
+}
+
+// GetSizeReport returns the sizes of the files gathered.
+func (g GitMetadata) GetSizeReport() *metadata.SizeReport {
+	return g.Sizes
+}
+
+// GetSummary returns the summary of the clone, pinned to its commit.
+func (g GitMetadata) GetSummary() metadata.Summary {
+	s := metadata.NewSummary("git", g.URI, g.Path, g.Timestamp, g.Sizes)
+	s.Revision = g.CommitHash
+	s.Detail("ref", g.Ref)
+	s.Detail("author", g.Author)
+	s.Detail("signed_by", g.SignedBy)
+	if g.Archived {
+		s.Detail("archived", "true")
+	}
+	if g.Cached {
+		s.Detail("cached", "true")
+	}
+	return s
+}
+
+func (g GitMetadata) GetPinnedURL(u string) (string, error) {
+	if len(u) == 0 {
+		return "", fmt.Errorf("empty URL")
+	}
+	if g.LatestCommit == "" {
+		return "", fmt.Errorf("latest commit not set")
+	}
+	for _, scheme := range []string{"git::", "git://", "https://"} {
+		u = strings.TrimPrefix(u, scheme)
+	}
+	if strings.HasPrefix(u, "git@") {
+		u = strings.Replace(strings.Split(u, "git@")[1], ":", "/", 1)
+	}
+	// Replace the requested ref, wherever it appears in the query, with the
+	// commit that was gathered, keeping any subdirectory it selected
+	base, query, _ := strings.Cut(u, "?")
+	q, err := url.ParseQuery(query)
 	if err != nil {
-		return err
+		return "", fmt.Errorf("failed to parse query: %w", err)
+	}
+	ref := g.LatestCommit
+	if _, subdir, ok := strings.Cut(q.Get("ref"), "//"); ok {
+		ref += "//" + subdir
+	}
+	q.Del("ref")
+	pinned := "git::" + base + "?ref=" + ref
+	if len(q) > 0 {
+		pinned += "&" + q.Encode()
 	}
-	return os.Chmod(dst, srcInfo.Mode())
+	return pinned, nil
+}
+
+// NewSSHAgentAuth returns an AuthMethod that uses the SSH agent for authentication.
+// It uses the specified user as the username for authentication.
+func (r *RealSSHAuthenticator) NewSSHAgentAuth(user string) (transport.AuthMethod, error) {
+	return ssh.NewSSHAgentAuth(user)
 }
 
 // extractKeyFromQuery extracts the value of the specified key from the query parameters and extracts a subdir, if present.
@@ -285,22 +751,30 @@ func extractKeyFromQuery(q url.Values, key string, subdir *string) string {
 	return value
 }
 
+// filePathPattern matches sources that are local file paths, including
+// Windows drive, UNC and backslash-relative paths.
+var filePathPattern = regexp.MustCompile(`^(\./|\../|\.\\|\.\.\\|/|[a-zA-Z]:[\\/]|\\\\|~\/).*`)
+
 func processUrl(rawSource string) (src, ref, subdir, depth string, err error) {
+	// SSH sources, either "git@host:org/repo" or "ssh://", keep their form
+	// and are turned into ssh:// URLs by the parser below
+	rawSource = strings.TrimPrefix(rawSource, "git::")
+	isSSH := isSSHSource(rawSource)
+
 	// Remove any prefixes we normally see from the source URL.
-	terms := []string{"git@", "git://", "git::", "https://", "file://", "file::"}
-	for _, prefix := range terms{
-		rawSource = strings.TrimPrefix(rawSource, prefix)
+	if !isSSH {
+		terms := []string{"git://", "https://", "file://", "file::"}
+		for _, prefix := range terms {
+			rawSource = strings.TrimPrefix(rawSource, prefix)
+		}
 	}
 	src = rawSource
 
-	// Regular expression for file paths
-	filePathPattern := regexp.MustCompile(`^(\./|\../|/|[a-zA-Z]:\\|~\/).*`)
-
-	if filePathPattern.MatchString(src) {
+	if !isSSH && filePathPattern.MatchString(src) {
 		src = "file://" + src
 	}
 
-	if !strings.HasPrefix(src, "git@") && !strings.HasPrefix(src, "file://") {
+	if !isSSH && !strings.HasPrefix(src, "file://") {
 		src = "https://" + src
 	}
 
@@ -19,14 +19,24 @@ package git
 import (
 	"context"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
 	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport/client"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+
+	"github.com/enterprise-contract/go-gather/expand"
 )
 
 func TestGitGatherer_Matcher(t *testing.T) {
@@ -70,6 +80,60 @@ func TestGitGatherer_Gather_CanceledContext(t *testing.T) {
 	}
 }
 
+func TestGitGatherer_Gather_Proxy(t *testing.T) {
+	var mu sync.Mutex
+	var hosts []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hosts = append(hosts, r.Host)
+		mu.Unlock()
+		http.NotFound(w, r)
+	}))
+	defer proxy.Close()
+
+	// The proxy refuses to tunnel to the repository
+	g := &GitGatherer{Proxy: proxy.URL}
+	if _, err := g.Gather(context.Background(), "git.invalid/org/repo.git", t.TempDir()); err == nil {
+		t.Fatal("expected an error for a repository the proxy does not reach")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(hosts) == 0 || hosts[0] != "git.invalid:443" {
+		t.Errorf("expected the repository to be reached through the proxy, got %v", hosts)
+	}
+
+	g = &GitGatherer{Proxy: "ftp://proxy.example.com"}
+	if _, err := g.Gather(context.Background(), "git.invalid/org/repo.git", t.TempDir()); err == nil || !strings.Contains(err.Error(), "invalid proxy") {
+		t.Errorf("expected an invalid proxy error, got %v", err)
+	}
+}
+
+func TestGitGatherer_Gather_RateLimit(t *testing.T) {
+	var mu sync.Mutex
+	var hosts []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hosts = append(hosts, r.Host)
+		mu.Unlock()
+		http.NotFound(w, r)
+	}))
+	defer proxy.Close()
+
+	// The throttled clients go-git is given still honour the proxy
+	g := &GitGatherer{Proxy: proxy.URL, RateLimit: 1 << 20}
+	if _, err := g.Gather(context.Background(), "git.invalid/org/repo.git", t.TempDir()); err == nil {
+		t.Fatal("expected an error for a repository the proxy does not reach")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(hosts) == 0 || hosts[0] != "git.invalid:443" {
+		t.Errorf("expected the repository to be reached through the proxy, got %v", hosts)
+	}
+	if client.Protocols["https"] == githttp.DefaultClient {
+		t.Error("expected a throttled client for the https protocol")
+	}
+}
+
 func TestGitGatherer_Gather_InvalidRef(t *testing.T) {
 	gg := GitGatherer{}
 	sourceDir := t.TempDir()
@@ -123,3 +187,595 @@ func initLocalGitRepo(t *testing.T, repoDir string) (string, string) {
 
 	return repoDir, commit.String()
 }
+
+// initRefsRepo creates a repository whose default branch, "feature" branch,
+// "v1" tag and first commit each have different contents in README.md, and
+// returns the hash of the first commit.
+func initRefsRepo(t *testing.T, repoDir string) string {
+	t.Helper()
+
+	_, first := initLocalGitRepo(t, repoDir)
+	repo, err := git.PlainOpen(repoDir)
+	if err != nil {
+		t.Fatalf("failed to open repo: %v", err)
+	}
+	w, err := repo.Worktree()
+	if err != nil {
+		t.Fatalf("failed to get worktree: %v", err)
+	}
+
+	commit := func(content string) plumbing.Hash {
+		if err := os.WriteFile(filepath.Join(repoDir, "README.md"), []byte(content), 0600); err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+		if _, err := w.Add("README.md"); err != nil {
+			t.Fatalf("failed to add file: %v", err)
+		}
+		h, err := w.Commit(content, &git.CommitOptions{
+			Author: &object.Signature{Name: "Tester", Email: "tester@example.com", When: time.Now()},
+		})
+		if err != nil {
+			t.Fatalf("failed to commit: %v", err)
+		}
+		return h
+	}
+
+	tagged := commit("tagged")
+	if _, err := repo.CreateTag("v1", tagged, &git.CreateTagOptions{
+		Tagger:  &object.Signature{Name: "Tester", Email: "tester@example.com", When: time.Now()},
+		Message: "v1",
+	}); err != nil {
+		t.Fatalf("failed to tag: %v", err)
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		t.Fatalf("failed to read HEAD: %v", err)
+	}
+	if err := w.Checkout(&git.CheckoutOptions{Branch: plumbing.NewBranchReferenceName("feature"), Create: true}); err != nil {
+		t.Fatalf("failed to create branch: %v", err)
+	}
+	commit("feature")
+	if err := w.Checkout(&git.CheckoutOptions{Branch: head.Name()}); err != nil {
+		t.Fatalf("failed to switch back: %v", err)
+	}
+	commit("default")
+
+	return first
+}
+
+func TestGitGatherer_Gather_Ref(t *testing.T) {
+	repoDir := t.TempDir()
+	first := initRefsRepo(t, repoDir)
+
+	testCases := []struct {
+		name string
+		ref  string
+		want string
+	}{
+		{"default branch", "", "default"},
+		{"branch", "feature", "feature"},
+		{"full reference name", "refs/heads/feature", "feature"},
+		{"tag", "v1", "tagged"},
+		{"commit", first, "# Test Repo\n"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			src := "git::" + repoDir
+			if tc.ref != "" {
+				src += "?ref=" + tc.ref
+			}
+			dst := t.TempDir()
+
+			gg := GitGatherer{}
+			m, err := gg.Gather(context.Background(), src, dst)
+			if err != nil {
+				t.Fatalf("Gather returned an unexpected error: %v", err)
+			}
+			got, err := os.ReadFile(filepath.Join(dst, "README.md"))
+			if err != nil {
+				t.Fatalf("failed to read gathered file: %v", err)
+			}
+			if string(got) != tc.want {
+				t.Errorf("expected README.md to contain %q, got %q", tc.want, got)
+			}
+
+			gm := m.Get().(*GitMetadata)
+			if gm.Ref != tc.ref {
+				t.Errorf("expected metadata ref %q, got %q", tc.ref, gm.Ref)
+			}
+			if gm.Path != dst || gm.LatestCommit == "" || gm.CommitHash != gm.LatestCommit {
+				t.Errorf("unexpected metadata: %+v", gm)
+			}
+			if tc.ref == first && gm.LatestCommit != first {
+				t.Errorf("expected commit %s, got %s", first, gm.LatestCommit)
+			}
+		})
+	}
+}
+
+func TestGitMetadata_GetSummary(t *testing.T) {
+	m := GitMetadata{URI: "git::github.com/org/repo?ref=main", Path: "/tmp/repo", CommitHash: "abc123", Ref: "main", Cached: true}
+	s := m.GetSummary()
+	if s.Type != "git" || s.URI != m.URI || s.Path != m.Path || s.Revision != "abc123" {
+		t.Errorf("unexpected summary: %+v", s)
+	}
+	if want := map[string]string{"ref": "main", "cached": "true"}; !reflect.DeepEqual(s.Details, want) {
+		t.Errorf("Details = %v, want %v", s.Details, want)
+	}
+}
+
+func TestGitMetadata_GetPinnedURL(t *testing.T) {
+	m := GitMetadata{LatestCommit: "abc123"}
+
+	testCases := []struct {
+		name string
+		uri  string
+		want string
+	}{
+		{"no ref", "git::github.com/org/repo", "git::github.com/org/repo?ref=abc123"},
+		{"ref", "git::github.com/org/repo?ref=main", "git::github.com/org/repo?ref=abc123"},
+		{"ref after other parameters", "https://github.com/org/repo?depth=1&ref=v1", "git::github.com/org/repo?ref=abc123&depth=1"},
+		{"ref with subdir", "git::github.com/org/repo?ref=main//policy", "git::github.com/org/repo?ref=abc123//policy"},
+		{"ssh", "git@github.com:org/repo.git?ref=main", "git::github.com/org/repo.git?ref=abc123"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := m.GetPinnedURL(tc.uri)
+			if err != nil {
+				t.Fatalf("GetPinnedURL returned an unexpected error: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("GetPinnedURL(%q) = %q, want %q", tc.uri, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestGitGatherer_Gather_Depth(t *testing.T) {
+	repoDir := t.TempDir()
+	initRefsRepo(t, repoDir)
+
+	testCases := []struct {
+		name    string
+		depth   int
+		query   string
+		shallow bool
+	}{
+		{"default", 0, "", true},
+		{"option", 2, "", true},
+		{"full history option", -1, "", false},
+		{"query overrides option", -1, "?depth=1", true},
+		{"full history query", 0, "?depth=0", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dst := t.TempDir()
+			gg := GitGatherer{Depth: tc.depth}
+			if _, err := gg.Gather(context.Background(), "git::"+repoDir+tc.query, dst); err != nil {
+				t.Fatalf("Gather returned an unexpected error: %v", err)
+			}
+
+			repo, err := git.PlainOpen(dst)
+			if err != nil {
+				t.Fatalf("failed to open clone: %v", err)
+			}
+			shallow, err := repo.Storer.Shallow()
+			if err != nil {
+				t.Fatalf("failed to read shallow commits: %v", err)
+			}
+			if got := len(shallow) > 0; got != tc.shallow {
+				t.Errorf("expected shallow clone: %v, got shallow commits %v", tc.shallow, shallow)
+			}
+		})
+	}
+}
+
+func TestGitGatherer_Gather_InvalidDepth(t *testing.T) {
+	gg := GitGatherer{}
+	_, err := gg.Gather(context.Background(), "git::"+t.TempDir()+"?depth=-1", t.TempDir())
+	if err == nil || !strings.Contains(err.Error(), "invalid depth") {
+		t.Errorf("expected an invalid depth error, got %v", err)
+	}
+}
+
+func TestGitGatherer_Gather_Subdir(t *testing.T) {
+	repoDir := t.TempDir()
+	initLocalGitRepo(t, repoDir)
+
+	repo, err := git.PlainOpen(repoDir)
+	if err != nil {
+		t.Fatalf("failed to open repo: %v", err)
+	}
+	w, err := repo.Worktree()
+	if err != nil {
+		t.Fatalf("failed to get worktree: %v", err)
+	}
+	for name, content := range map[string]string{
+		"policies/lib/lib.rego":  "package lib",
+		"policies/main.rego":     "package main",
+		"policies/library.rego":  "package library",
+		"docs/policies/README":   "docs",
+		"policies/lib/data.json": "{}",
+	} {
+		path := filepath.Join(repoDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Add(name); err != nil {
+			t.Fatalf("failed to add %s: %v", name, err)
+		}
+	}
+	if _, err := w.Commit("Add policies", &git.CommitOptions{
+		Author: &object.Signature{Name: "Tester", Email: "tester@example.com", When: time.Now()},
+	}); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+
+	testCases := []struct {
+		name string
+		src  string
+	}{
+		{"path", "git::" + repoDir + "//policies/lib"},
+		{"ref", "git::" + repoDir + "?ref=master//policies/lib"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dst := t.TempDir()
+			gg := GitGatherer{}
+			if _, err := gg.Gather(context.Background(), tc.src, dst); err != nil {
+				t.Fatalf("Gather returned an unexpected error: %v", err)
+			}
+
+			var got []string
+			err := filepath.WalkDir(dst, func(path string, d os.DirEntry, err error) error {
+				if err != nil || d.IsDir() {
+					return err
+				}
+				rel, _ := filepath.Rel(dst, path)
+				got = append(got, filepath.ToSlash(rel))
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := []string{"data.json", "lib.rego"}
+			if strings.Join(got, ",") != strings.Join(want, ",") {
+				t.Errorf("expected only %v in the destination, got %v", want, got)
+			}
+		})
+	}
+}
+
+func TestGitGatherer_Gather_SubdirErrors(t *testing.T) {
+	repoDir := t.TempDir()
+	initLocalGitRepo(t, repoDir)
+
+	testCases := []struct {
+		name    string
+		subdir  string
+		wantErr string
+	}{
+		{"missing", "nope", "does not exist in the repository"},
+		{"file", "README.md", "does not exist in the repository"},
+		{"escaping", "a/../../..", "illegal subdirectory"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			gg := GitGatherer{}
+			_, err := gg.Gather(context.Background(), "git::"+repoDir+"?ref=master//"+tc.subdir, t.TempDir())
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("expected an error containing %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+// initSubmoduleRepo creates a repository with the repository at subDir added
+// as a submodule at libs/shared.
+func initSubmoduleRepo(t *testing.T, repoDir, subDir string) {
+	t.Helper()
+
+	initLocalGitRepo(t, repoDir)
+	repo, err := git.PlainOpen(repoDir)
+	if err != nil {
+		t.Fatalf("failed to open repo: %v", err)
+	}
+	sub, err := git.PlainOpen(subDir)
+	if err != nil {
+		t.Fatalf("failed to open submodule repo: %v", err)
+	}
+	subHead, err := sub.Head()
+	if err != nil {
+		t.Fatalf("failed to read submodule HEAD: %v", err)
+	}
+
+	gitmodules := fmt.Sprintf("[submodule \"shared\"]\n\tpath = libs/shared\n\turl = %s\n", subDir)
+	if err := os.WriteFile(filepath.Join(repoDir, ".gitmodules"), []byte(gitmodules), 0600); err != nil {
+		t.Fatalf("failed to write .gitmodules: %v", err)
+	}
+	w, err := repo.Worktree()
+	if err != nil {
+		t.Fatalf("failed to get worktree: %v", err)
+	}
+	if _, err := w.Add(".gitmodules"); err != nil {
+		t.Fatalf("failed to add .gitmodules: %v", err)
+	}
+
+	// Record the submodule commit as a gitlink in the index
+	idx, err := repo.Storer.Index()
+	if err != nil {
+		t.Fatalf("failed to read index: %v", err)
+	}
+	e := idx.Add("libs/shared")
+	e.Hash = subHead.Hash()
+	e.Mode = filemode.Submodule
+	if err := repo.Storer.SetIndex(idx); err != nil {
+		t.Fatalf("failed to write index: %v", err)
+	}
+
+	if _, err := w.Commit("Add submodule", &git.CommitOptions{
+		Author: &object.Signature{Name: "Tester", Email: "tester@example.com", When: time.Now()},
+	}); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+}
+
+func TestGitGatherer_Gather_Submodules(t *testing.T) {
+	subDir := t.TempDir()
+	_, subCommit := initLocalGitRepo(t, subDir)
+	repoDir := t.TempDir()
+	initSubmoduleRepo(t, repoDir, subDir)
+
+	testCases := []struct {
+		name       string
+		submodules bool
+		want       bool
+	}{
+		{"disabled", false, false},
+		{"enabled", true, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dst := t.TempDir()
+			gg := GitGatherer{Submodules: tc.submodules}
+			m, err := gg.Gather(context.Background(), "git::"+repoDir, dst)
+			if err != nil {
+				t.Fatalf("Gather returned an unexpected error: %v", err)
+			}
+
+			_, err = os.Stat(filepath.Join(dst, "libs", "shared", "README.md"))
+			if got := err == nil; got != tc.want {
+				t.Errorf("expected submodule contents present: %v, got %v", tc.want, got)
+			}
+			commits := m.(*GitMetadata).SubmoduleCommits
+			if tc.want && commits["libs/shared"] != subCommit {
+				t.Errorf("expected submodule commit %s, got %v", subCommit, commits)
+			}
+		})
+	}
+
+	// Only submodules below a gathered subdirectory are fetched
+	dst := t.TempDir()
+	gg := GitGatherer{Submodules: true}
+	m, err := gg.Gather(context.Background(), "git::"+repoDir+"//libs", dst)
+	if err != nil {
+		t.Fatalf("Gather returned an unexpected error: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "shared", "README.md")); err != nil {
+		t.Errorf("expected submodule contents in the subdirectory: %v", err)
+	}
+	if len(m.(*GitMetadata).SubmoduleCommits) != 1 {
+		t.Errorf("unexpected submodule commits: %v", m.(*GitMetadata).SubmoduleCommits)
+	}
+}
+
+func TestGitGatherer_Gather_Update(t *testing.T) {
+	repoDir := t.TempDir()
+	first := initRefsRepo(t, repoDir)
+	src := "git::" + repoDir
+	dst := t.TempDir()
+
+	gg := GitGatherer{}
+	m, err := gg.Gather(context.Background(), src, dst)
+	if err != nil {
+		t.Fatalf("Gather returned an unexpected error: %v", err)
+	}
+	if m.Get().(*GitMetadata).Updated {
+		t.Error("expected the first gather to clone")
+	}
+	if err := os.WriteFile(filepath.Join(dst, "stale.txt"), []byte("stale"), 0600); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	// A new commit on the default branch is picked up by the next gather
+	repo, err := git.PlainOpen(repoDir)
+	if err != nil {
+		t.Fatalf("failed to open repo: %v", err)
+	}
+	w, err := repo.Worktree()
+	if err != nil {
+		t.Fatalf("failed to get worktree: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(repoDir, "README.md"), []byte("updated"), 0600); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	if _, err := w.Add("README.md"); err != nil {
+		t.Fatalf("failed to add file: %v", err)
+	}
+	if _, err := w.Commit("updated", &git.CommitOptions{
+		Author: &object.Signature{Name: "Tester", Email: "tester@example.com", When: time.Now()},
+	}); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+
+	// The first commit is behind the boundary of the shallow checkout, so it
+	// is cloned again, with its full history
+	testCases := []struct {
+		name    string
+		ref     string
+		want    string
+		updated bool
+	}{
+		{"default branch", "", "updated", true},
+		{"branch", "feature", "feature", true},
+		{"tag", "v1", "tagged", true},
+		{"commit beyond shallow boundary", first, "# Test Repo\n", false},
+		{"same commit", first, "# Test Repo\n", true},
+		{"full reference name", "refs/heads/feature", "feature", true},
+		{"back to default branch", "", "updated", true},
+	}
+
+	for _, tc := range testCases {
+		src := src
+		if tc.ref != "" {
+			src += "?ref=" + tc.ref
+		}
+		m, err := gg.Gather(context.Background(), src, dst)
+		if err != nil {
+			t.Fatalf("%s: Gather returned an unexpected error: %v", tc.name, err)
+		}
+		got, err := os.ReadFile(filepath.Join(dst, "README.md"))
+		if err != nil {
+			t.Fatalf("%s: failed to read gathered file: %v", tc.name, err)
+		}
+		if string(got) != tc.want {
+			t.Errorf("%s: expected README.md to contain %q, got %q", tc.name, tc.want, got)
+		}
+		gm := m.Get().(*GitMetadata)
+		if gm.Updated != tc.updated {
+			t.Errorf("%s: expected Updated=%v, got %v", tc.name, tc.updated, gm.Updated)
+		}
+		if tc.ref == first && gm.LatestCommit != first {
+			t.Errorf("%s: expected commit %s, got %s", tc.name, first, gm.LatestCommit)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(dst, "stale.txt")); !os.IsNotExist(err) {
+		t.Errorf("expected untracked files to be removed, got %v", err)
+	}
+}
+
+func TestGitGatherer_Gather_Hidden(t *testing.T) {
+	repoDir := t.TempDir()
+	initLocalGitRepo(t, repoDir)
+	repo, err := git.PlainOpen(repoDir)
+	if err != nil {
+		t.Fatalf("failed to open repo: %v", err)
+	}
+	w, err := repo.Worktree()
+	if err != nil {
+		t.Fatalf("failed to get worktree: %v", err)
+	}
+	for _, name := range []string{".github/workflows/ci.yaml", "policy/.github/CODEOWNERS", "policy/main.rego", "policy/.regal.yaml"} {
+		p := filepath.Join(repoDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatalf("failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(p, []byte(name), 0600); err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+		if _, err := w.Add(name); err != nil {
+			t.Fatalf("failed to add file: %v", err)
+		}
+	}
+	if _, err := w.Commit("hidden", &git.CommitOptions{
+		Author: &object.Signature{Name: "Tester", Email: "tester@example.com", When: time.Now()},
+	}); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+
+	exists := func(dst, name string) bool {
+		_, err := os.Stat(filepath.Join(dst, filepath.FromSlash(name)))
+		return err == nil
+	}
+
+	dst := t.TempDir()
+	gg := GitGatherer{Hidden: expand.ExcludeGitFiles}
+	m, err := gg.Gather(context.Background(), "git::"+repoDir, dst)
+	if err != nil {
+		t.Fatalf("Gather returned an unexpected error: %v", err)
+	}
+	if m.Get().(*GitMetadata).LatestCommit == "" {
+		t.Error("expected the commit to be recorded before the repository is removed")
+	}
+	for name, want := range map[string]bool{".git": false, ".github": false, "policy/.github": false, "policy/main.rego": true, "policy/.regal.yaml": true} {
+		if got := exists(dst, name); got != want {
+			t.Errorf("expected %s to exist=%v", name, want)
+		}
+	}
+
+	dst = t.TempDir()
+	gg = GitGatherer{Hidden: expand.HiddenFiles{All: true}}
+	if _, err := gg.Gather(context.Background(), "git::"+repoDir+"//policy", dst); err != nil {
+		t.Fatalf("Gather returned an unexpected error: %v", err)
+	}
+	for name, want := range map[string]bool{".github": false, ".regal.yaml": false, "main.rego": true} {
+		if got := exists(dst, name); got != want {
+			t.Errorf("subdir: expected %s to exist=%v", name, want)
+		}
+	}
+}
+
+func TestGitGatherer_Gather_Cache(t *testing.T) {
+	repoDir := t.TempDir()
+	initRefsRepo(t, repoDir)
+	cacheDir := t.TempDir()
+	src := "git::" + repoDir
+
+	gg := GitGatherer{CacheDir: cacheDir}
+	m, err := gg.Gather(context.Background(), src, t.TempDir())
+	if err != nil {
+		t.Fatalf("Gather returned an unexpected error: %v", err)
+	}
+	if m.Get().(*GitMetadata).Cached {
+		t.Error("expected the first gather to mirror the repository")
+	}
+	mirrors, err := os.ReadDir(cacheDir)
+	if err != nil || len(mirrors) != 1 {
+		t.Fatalf("expected one mirror in the cache, got %v (%v)", mirrors, err)
+	}
+
+	// Later gathers fetch new commits into the mirror
+	commitFile(t, repoDir, "README.md", "cached", nil)
+	for _, ref := range []string{"", "feature"} {
+		dst := t.TempDir()
+		q := ""
+		if ref != "" {
+			q = "?ref=" + ref
+		}
+		m, err := gg.Gather(context.Background(), src+q, dst)
+		if err != nil {
+			t.Fatalf("Gather returned an unexpected error: %v", err)
+		}
+		if !m.Get().(*GitMetadata).Cached {
+			t.Errorf("%q: expected the cached mirror to be used", ref)
+		}
+		want := map[string]string{"": "cached", "feature": "feature"}[ref]
+		if got, _ := os.ReadFile(filepath.Join(dst, "README.md")); string(got) != want {
+			t.Errorf("%q: expected README.md to contain %q, got %q", ref, want, got)
+		}
+	}
+	if mirrors, _ := os.ReadDir(cacheDir); len(mirrors) != 1 {
+		t.Errorf("expected the mirror to be reused, got %v", mirrors)
+	}
+}
+
+func TestFilePathPattern(t *testing.T) {
+	for _, src := range []string{"./repo", "../repo", "/repo", `.\repo`, `..\repo`, `C:\repo`, "C:/repo", `\\server\share\repo`, "~/repo"} {
+		if !filePathPattern.MatchString(src) {
+			t.Errorf("expected %q to be a local path", src)
+		}
+	}
+	for _, src := range []string{"github.com/org/repo", "git@github.com:org/repo.git", "https://github.com/org/repo"} {
+		if filePathPattern.MatchString(src) {
+			t.Errorf("expected %q not to be a local path", src)
+		}
+	}
+}
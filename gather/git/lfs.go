@@ -0,0 +1,364 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+
+	"github.com/enterprise-contract/go-gather/faults"
+	"github.com/enterprise-contract/go-gather/internal/proxy"
+	"github.com/enterprise-contract/go-gather/internal/ratelimit"
+)
+
+// lfsPointerPrefix starts every Git LFS pointer file.
+const lfsPointerPrefix = "version https://git-lfs.github.com/spec/v1\n"
+
+// lfsMaxPointerSize bounds the size of files read to check whether they are
+// pointers, real pointers are around 130 bytes.
+const lfsMaxPointerSize = 1024
+
+// lfsMediaType is the media type of Git LFS batch API requests and responses.
+const lfsMediaType = "application/vnd.git-lfs+json"
+
+var lfsOID = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// lfsPointer is a pointer file checked out in place of a Git LFS object.
+type lfsPointer struct {
+	path string
+	oid  string
+	size int64
+}
+
+// lfsAction is the download action the batch API returns for an object.
+type lfsAction struct {
+	Href   string            `json:"href"`
+	Header map[string]string `json:"header"`
+}
+
+// smudgeLFS replaces the Git LFS pointer files under root with the objects
+// they point to, fetched from the LFS server of the repository at remote, and
+// returns the number of objects fetched.
+func smudgeLFS(ctx context.Context, root, remote string, auth transport.AuthMethod, client *http.Client) (int, error) {
+	pointers, err := findLFSPointers(root)
+	if err != nil || len(pointers) == 0 {
+		return 0, err
+	}
+
+	u, err := url.Parse(remote)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse URL: %w", err)
+	}
+	var open func(p lfsPointer) (io.ReadCloser, error)
+	switch u.Scheme {
+	case "file":
+		open = func(p lfsPointer) (io.ReadCloser, error) {
+			return openLocalLFSObject(u.Path, p.oid)
+		}
+	case "http", "https":
+		actions, err := lfsBatch(ctx, client, lfsEndpoint(u), auth, pointers)
+		if err != nil {
+			return 0, err
+		}
+		open = func(p lfsPointer) (io.ReadCloser, error) {
+			return lfsDownload(ctx, client, actions[p.oid])
+		}
+	default:
+		return 0, fmt.Errorf("git LFS objects can only be fetched for https and file sources, not %s", u.Scheme)
+	}
+
+	for _, p := range pointers {
+		if err := replaceLFSPointer(p, open, faults.FromContext(ctx)); err != nil {
+			return 0, err
+		}
+	}
+	return len(pointers), nil
+}
+
+// httpClient returns the client HTTPS servers are requested with, which skips
+// verifying their certificates if insecure is set, sends its requests
+// through the proxy at proxyURL, if any, and is throttled by l, if not nil.
+func httpClient(insecure bool, proxyURL string, l *ratelimit.Limiter) (*http.Client, error) {
+	client := &http.Client{}
+	if insecure {
+		t := http.DefaultTransport.(*http.Transport).Clone()
+		t.TLSClientConfig = &tls.Config{InsecureSkipVerify: true} // #nosec G402 -- opted into with InsecureSkipTLS or GIT_SSL_NO_VERIFY
+		client.Transport = t
+	}
+	if proxyURL != "" {
+		base := client.Transport
+		if base == nil {
+			base = http.DefaultTransport
+		}
+		t, err := proxy.Transport(base, proxyURL)
+		if err != nil {
+			return nil, err
+		}
+		client.Transport = t
+	}
+	if l != nil {
+		base := client.Transport
+		if base == nil {
+			base = http.DefaultTransport
+		}
+		client.Transport = ratelimit.Transport(base, l)
+	}
+	return client, nil
+}
+
+// findLFSPointers returns the pointer files under root, skipping the .git
+// directories and files of the repository and its submodules.
+func findLFSPointers(root string) ([]lfsPointer, error) {
+	var pointers []lfsPointer
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Name() == ".git" {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.Size() > lfsMaxPointerSize {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		if oid, size, ok := parseLFSPointer(data); ok {
+			pointers = append(pointers, lfsPointer{path: path, oid: oid, size: size})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error looking for git LFS pointers: %w", err)
+	}
+	return pointers, nil
+}
+
+// parseLFSPointer returns the object ID and size recorded in a pointer file.
+func parseLFSPointer(data []byte) (oid string, size int64, ok bool) {
+	if !bytes.HasPrefix(data, []byte(lfsPointerPrefix)) {
+		return "", 0, false
+	}
+	size = -1
+	s := bufio.NewScanner(bytes.NewReader(data))
+	for s.Scan() {
+		key, value, _ := strings.Cut(s.Text(), " ")
+		switch key {
+		case "oid":
+			oid = strings.TrimPrefix(value, "sha256:")
+		case "size":
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return "", 0, false
+			}
+			size = n
+		}
+	}
+	if !lfsOID.MatchString(oid) || size < 0 {
+		return "", 0, false
+	}
+	return oid, size, true
+}
+
+// lfsEndpoint returns the LFS server URL of the repository at u, following
+// the Git LFS convention of appending ".git/info/lfs".
+func lfsEndpoint(u *url.URL) string {
+	e := *u
+	e.RawQuery = ""
+	e.Fragment = ""
+	if !strings.HasSuffix(e.Path, ".git") {
+		e.Path += ".git"
+	}
+	e.Path += "/info/lfs"
+	return e.String()
+}
+
+// lfsBatch requests download actions for the pointers from the batch API at
+// endpoint, keyed by object ID.
+func lfsBatch(ctx context.Context, client *http.Client, endpoint string, auth transport.AuthMethod, pointers []lfsPointer) (map[string]lfsAction, error) {
+	type object struct {
+		OID     string `json:"oid"`
+		Size    int64  `json:"size"`
+		Actions struct {
+			Download *lfsAction `json:"download"`
+		} `json:"actions"`
+		Error *struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	var req struct {
+		Operation string   `json:"operation"`
+		Transfers []string `json:"transfers"`
+		Objects   []object `json:"objects"`
+	}
+	req.Operation = "download"
+	req.Transfers = []string{"basic"}
+	seen := map[string]bool{}
+	for _, p := range pointers {
+		if !seen[p.oid] {
+			seen[p.oid] = true
+			req.Objects = append(req.Objects, object{OID: p.oid, Size: p.size})
+		}
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding git LFS batch request: %w", err)
+	}
+
+	r, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint+"/objects/batch", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("error creating git LFS batch request: %w", err)
+	}
+	r.Header.Set("Accept", lfsMediaType)
+	r.Header.Set("Content-Type", lfsMediaType)
+	if basic, ok := auth.(*githttp.BasicAuth); ok {
+		r.SetBasicAuth(basic.Username, basic.Password)
+	}
+	resp, err := client.Do(r)
+	if err != nil {
+		return nil, fmt.Errorf("error requesting git LFS objects: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error requesting git LFS objects: %s", resp.Status)
+	}
+
+	var res struct {
+		Objects []object `json:"objects"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, fmt.Errorf("error decoding git LFS batch response: %w", err)
+	}
+	actions := map[string]lfsAction{}
+	for _, o := range res.Objects {
+		switch {
+		case o.Error != nil:
+			return nil, fmt.Errorf("git LFS object %s: %s", o.OID, o.Error.Message)
+		case o.Actions.Download == nil:
+			return nil, fmt.Errorf("git LFS object %s: no download action", o.OID)
+		}
+		actions[o.OID] = *o.Actions.Download
+	}
+	for oid := range seen {
+		if _, ok := actions[oid]; !ok {
+			return nil, fmt.Errorf("git LFS object %s: missing from the batch response", oid)
+		}
+	}
+	return actions, nil
+}
+
+// lfsDownload starts downloading an object with the action the batch API
+// returned for it.
+func lfsDownload(ctx context.Context, client *http.Client, action lfsAction) (io.ReadCloser, error) {
+	r, err := http.NewRequestWithContext(ctx, http.MethodGet, action.Href, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range action.Header {
+		r.Header.Set(k, v)
+	}
+	resp, err := client.Do(r)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, errors.New(resp.Status)
+	}
+	return resp.Body, nil
+}
+
+// openLocalLFSObject opens an object in the LFS store of the repository at
+// repoPath, which may be bare.
+func openLocalLFSObject(repoPath, oid string) (io.ReadCloser, error) {
+	rel := filepath.Join("lfs", "objects", oid[0:2], oid[2:4], oid)
+	f, err := os.Open(filepath.Join(repoPath, ".git", rel))
+	if errors.Is(err, fs.ErrNotExist) {
+		f, err = os.Open(filepath.Join(repoPath, rel))
+	}
+	return f, err
+}
+
+// replaceLFSPointer overwrites the pointer file p with the object read from
+// open, after checking its size and digest. hook injects failures in tests.
+func replaceLFSPointer(p lfsPointer, open func(lfsPointer) (io.ReadCloser, error), hook faults.Hook) error {
+	rc, err := open(p)
+	if err != nil {
+		return fmt.Errorf("error fetching git LFS object %s: %w", p.oid, err)
+	}
+	defer rc.Close()
+
+	info, err := os.Stat(p.path)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(p.path), ".lfs-")
+	if err != nil {
+		return fmt.Errorf("error creating temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(faults.Writer(hook, p.path, tmp), h), io.LimitReader(rc, p.size+1))
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("error fetching git LFS object %s: %w", p.oid, err)
+	}
+	if n != p.size || hex.EncodeToString(h.Sum(nil)) != p.oid {
+		return fmt.Errorf("git LFS object %s does not match its pointer", p.oid)
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode().Perm()); err != nil {
+		return err
+	}
+	if err := faults.Check(hook, faults.Rename, p.path, 0); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), p.path)
+}
@@ -0,0 +1,201 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package git
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+)
+
+// lfsObject returns the object ID of content and a pointer file for it.
+func lfsObject(content string) (string, string) {
+	sum := sha256.Sum256([]byte(content))
+	oid := hex.EncodeToString(sum[:])
+	return oid, fmt.Sprintf("%soid sha256:%s\nsize %d\n", lfsPointerPrefix, oid, len(content))
+}
+
+func TestParseLFSPointer(t *testing.T) {
+	oid, pointer := lfsObject("binary data")
+	tests := []struct {
+		name string
+		data string
+		ok   bool
+	}{
+		{"pointer", pointer, true},
+		{"regular file", "package main\n", false},
+		{"bad oid", lfsPointerPrefix + "oid sha256:xyz\nsize 3\n", false},
+		{"missing size", lfsPointerPrefix + "oid sha256:" + oid + "\n", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotOID, size, ok := parseLFSPointer([]byte(tt.data))
+			if ok != tt.ok {
+				t.Fatalf("expected ok=%v, got %v", tt.ok, ok)
+			}
+			if ok && (gotOID != oid || size != int64(len("binary data"))) {
+				t.Errorf("unexpected pointer %s %d", gotOID, size)
+			}
+		})
+	}
+}
+
+func TestGitGatherer_Gather_LFS(t *testing.T) {
+	repoDir := t.TempDir()
+	initLocalGitRepo(t, repoDir)
+	repo, err := git.PlainOpen(repoDir)
+	if err != nil {
+		t.Fatalf("failed to open repo: %v", err)
+	}
+	w, err := repo.Worktree()
+	if err != nil {
+		t.Fatalf("failed to get worktree: %v", err)
+	}
+
+	content := "large binary content"
+	oid, pointer := lfsObject(content)
+	if err := os.WriteFile(filepath.Join(repoDir, "data.bin"), []byte(pointer), 0600); err != nil {
+		t.Fatalf("failed to write pointer: %v", err)
+	}
+	if _, err := w.Add("data.bin"); err != nil {
+		t.Fatalf("failed to add pointer: %v", err)
+	}
+	if _, err := w.Commit("lfs", &git.CommitOptions{
+		Author: &object.Signature{Name: "Tester", Email: "tester@example.com", When: time.Now()},
+	}); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+	objectPath := filepath.Join(repoDir, ".git", "lfs", "objects", oid[0:2], oid[2:4], oid)
+	if err := os.MkdirAll(filepath.Dir(objectPath), 0755); err != nil {
+		t.Fatalf("failed to create LFS store: %v", err)
+	}
+	if err := os.WriteFile(objectPath, []byte(content), 0600); err != nil {
+		t.Fatalf("failed to write LFS object: %v", err)
+	}
+
+	dst := t.TempDir()
+	gg := GitGatherer{}
+	if _, err := gg.Gather(context.Background(), "git::"+repoDir, dst); err != nil {
+		t.Fatalf("Gather returned an unexpected error: %v", err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(dst, "data.bin")); string(got) != pointer {
+		t.Errorf("expected the pointer without LFS, got %q", got)
+	}
+
+	dst = t.TempDir()
+	gg = GitGatherer{LFS: true}
+	m, err := gg.Gather(context.Background(), "git::"+repoDir, dst)
+	if err != nil {
+		t.Fatalf("Gather returned an unexpected error: %v", err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(dst, "data.bin")); string(got) != content {
+		t.Errorf("expected the LFS object, got %q", got)
+	}
+	if n := m.Get().(*GitMetadata).LFSObjects; n != 1 {
+		t.Errorf("expected 1 LFS object, got %d", n)
+	}
+
+	// An object that does not match its pointer is rejected
+	if err := os.WriteFile(objectPath, []byte("tampered"), 0600); err != nil {
+		t.Fatalf("failed to write LFS object: %v", err)
+	}
+	if _, err := gg.Gather(context.Background(), "git::"+repoDir, t.TempDir()); err == nil {
+		t.Error("expected an error for a mismatched LFS object")
+	}
+}
+
+func TestSmudgeLFS_Batch(t *testing.T) {
+	content := "large binary content"
+	oid, pointer := lfsObject(content)
+
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/org/repo.git/info/lfs/objects/batch":
+			if user, pass, _ := r.BasicAuth(); user != "me" || pass != "secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			if r.Header.Get("Accept") != lfsMediaType {
+				w.WriteHeader(http.StatusNotAcceptable)
+				return
+			}
+			var req struct {
+				Objects []struct {
+					OID string `json:"oid"`
+				} `json:"objects"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Objects) != 1 {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.Header().Set("Content-Type", lfsMediaType)
+			fmt.Fprintf(w, `{"objects":[{"oid":%q,"size":%d,"actions":{"download":{"href":%q,"header":{"X-Token":"t"}}}}]}`,
+				oid, len(content), srv.URL+"/objects/"+oid)
+		case "/objects/" + oid:
+			if r.Header.Get("X-Token") != "t" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			fmt.Fprint(w, content)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	root := t.TempDir()
+	for _, name := range []string{"a.bin", "b.bin"} {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(pointer), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	auth := &githttp.BasicAuth{Username: "me", Password: "secret"}
+	n, err := smudgeLFS(context.Background(), root, srv.URL+"/org/repo", auth, &http.Client{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("expected 2 objects, got %d", n)
+	}
+	for _, name := range []string{"a.bin", "b.bin"} {
+		got, err := os.ReadFile(filepath.Join(root, name))
+		if err != nil || string(got) != content {
+			t.Errorf("%s: expected the LFS object, got %q (%v)", name, got, err)
+		}
+	}
+
+	if err := os.WriteFile(filepath.Join(root, "a.bin"), []byte(pointer), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := smudgeLFS(context.Background(), root, srv.URL+"/org/repo", nil, &http.Client{}); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("expected an unauthorized error, got %v", err)
+	}
+}
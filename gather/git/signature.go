@@ -0,0 +1,235 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package git
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	gossh "golang.org/x/crypto/ssh"
+
+	"github.com/enterprise-contract/go-gather/gather"
+)
+
+// ErrSignatureVerification is returned when the checked out commit or tag is
+// unsigned or not signed by one of the trusted keys.
+var ErrSignatureVerification = gather.NewError("signature verification failed", gather.ErrVerificationFailed)
+
+// SignatureVerification lists the keys trusted to sign the gathered commit,
+// or the annotated tag requested with the ref query parameter. Verification
+// is required as soon as any key is given.
+type SignatureVerification struct {
+	// PGPKeyRing is an armored OpenPGP key ring.
+	PGPKeyRing string
+	// SSHAllowedKeys are SSH public keys in authorized_keys format, one per
+	// line, e.g. the contents of an ~/.ssh/id_ed25519.pub file.
+	SSHAllowedKeys string
+}
+
+// Enabled reports whether any trusted key is configured.
+func (v SignatureVerification) Enabled() bool {
+	return v.PGPKeyRing != "" || v.SSHAllowedKeys != ""
+}
+
+// verifySignature checks the annotated tag named by ref, or the commit h if
+// ref does not name one, is signed by a key trusted by v. It returns a
+// description of the object verified and the key that signed it.
+func verifySignature(r *git.Repository, ref string, h plumbing.Hash, v SignatureVerification) (signed, key string, err error) {
+	if tag := annotatedTag(r, ref); tag != nil && tag.Target == h {
+		key, err = v.verify(tag.PGPSignature, tag.EncodeWithoutSignature)
+		if err != nil {
+			return "", "", fmt.Errorf("%w: tag %s: %w", ErrSignatureVerification, tag.Name, err)
+		}
+		return "tag " + tag.Name, key, nil
+	}
+
+	commit, err := r.CommitObject(h)
+	if err != nil {
+		return "", "", fmt.Errorf("error reading commit %s: %w", h, err)
+	}
+	key, err = v.verify(commit.PGPSignature, commit.EncodeWithoutSignature)
+	if err != nil {
+		return "", "", fmt.Errorf("%w: commit %s: %w", ErrSignatureVerification, commit.Hash, err)
+	}
+	return "commit " + commit.Hash.String(), key, nil
+}
+
+// annotatedTag returns the annotated tag named by ref, if it names one.
+func annotatedTag(r *git.Repository, ref string) *object.Tag {
+	name := plumbing.ReferenceName(ref)
+	if !name.IsTag() {
+		name = plumbing.NewTagReferenceName(ref)
+	}
+	tagRef, err := r.Reference(name, true)
+	if err != nil {
+		return nil
+	}
+	tag, err := r.TagObject(tagRef.Hash())
+	if err != nil {
+		return nil
+	}
+	return tag
+}
+
+// verify checks signature is a signature by a trusted key over the object
+// written by encode, and returns the key's ID or fingerprint.
+func (v SignatureVerification) verify(signature string, encode func(plumbing.EncodedObject) error) (string, error) {
+	if signature == "" {
+		return "", errors.New("not signed")
+	}
+	obj := &plumbing.MemoryObject{}
+	if err := encode(obj); err != nil {
+		return "", err
+	}
+	rd, err := obj.Reader()
+	if err != nil {
+		return "", err
+	}
+	message, err := io.ReadAll(rd)
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case strings.HasPrefix(signature, "-----BEGIN SSH SIGNATURE-----"):
+		if v.SSHAllowedKeys == "" {
+			return "", errors.New("signed with an SSH key, but no SSH keys are trusted")
+		}
+		keys, err := parseAllowedKeys(v.SSHAllowedKeys)
+		if err != nil {
+			return "", err
+		}
+		pub, err := verifySSHSignature(signature, message, keys)
+		if err != nil {
+			return "", err
+		}
+		return gossh.FingerprintSHA256(pub), nil
+	case strings.HasPrefix(signature, "-----BEGIN PGP SIGNATURE-----"):
+		if v.PGPKeyRing == "" {
+			return "", errors.New("signed with an OpenPGP key, but no OpenPGP keys are trusted")
+		}
+		keyring, err := openpgp.ReadArmoredKeyRing(strings.NewReader(v.PGPKeyRing))
+		if err != nil {
+			return "", fmt.Errorf("failed to parse trusted OpenPGP keys: %w", err)
+		}
+		entity, err := openpgp.CheckArmoredDetachedSignature(keyring, bytes.NewReader(message), strings.NewReader(signature), nil)
+		if err != nil {
+			return "", fmt.Errorf("invalid OpenPGP signature: %w", err)
+		}
+		return entity.PrimaryKey.KeyIdString(), nil
+	default:
+		return "", errors.New("unsupported signature format")
+	}
+}
+
+// parseAllowedKeys parses SSH public keys in authorized_keys format.
+func parseAllowedKeys(data string) ([]gossh.PublicKey, error) {
+	var keys []gossh.PublicKey
+	rest := []byte(data)
+	for len(bytes.TrimSpace(rest)) > 0 {
+		key, _, _, r, err := gossh.ParseAuthorizedKey(rest)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse trusted SSH keys: %w", err)
+		}
+		keys = append(keys, key)
+		rest = r
+	}
+	return keys, nil
+}
+
+// sshSignatureNamespace is the namespace git signs commits and tags in.
+const sshSignatureNamespace = "git"
+
+// sshSignatureMagic starts both SSH signatures and the data they sign.
+const sshSignatureMagic = "SSHSIG"
+
+// verifySSHSignature verifies an armored SSH signature, in the format of
+// ssh-keygen -Y sign, over message, made by one of keys, which it returns.
+func verifySSHSignature(armored string, message []byte, keys []gossh.PublicKey) (gossh.PublicKey, error) {
+	block, _ := pem.Decode([]byte(armored))
+	if block == nil || block.Type != "SSH SIGNATURE" || !bytes.HasPrefix(block.Bytes, []byte(sshSignatureMagic)) {
+		return nil, errors.New("malformed SSH signature")
+	}
+	var sig struct {
+		Version       uint32
+		PublicKey     []byte
+		Namespace     string
+		Reserved      string
+		HashAlgorithm string
+		Signature     []byte
+	}
+	if err := gossh.Unmarshal(block.Bytes[len(sshSignatureMagic):], &sig); err != nil {
+		return nil, fmt.Errorf("malformed SSH signature: %w", err)
+	}
+	if sig.Version != 1 {
+		return nil, fmt.Errorf("unsupported SSH signature version %d", sig.Version)
+	}
+	if sig.Namespace != sshSignatureNamespace {
+		return nil, fmt.Errorf("SSH signature is for namespace %q, not %q", sig.Namespace, sshSignatureNamespace)
+	}
+	pub, err := gossh.ParsePublicKey(sig.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("malformed SSH signature key: %w", err)
+	}
+	trusted := false
+	for _, k := range keys {
+		if bytes.Equal(k.Marshal(), pub.Marshal()) {
+			trusted = true
+			break
+		}
+	}
+	if !trusted {
+		return nil, fmt.Errorf("signed by untrusted key %s", gossh.FingerprintSHA256(pub))
+	}
+
+	var h hash.Hash
+	switch sig.HashAlgorithm {
+	case "sha256":
+		h = sha256.New()
+	case "sha512":
+		h = sha512.New()
+	default:
+		return nil, fmt.Errorf("unsupported SSH signature hash %q", sig.HashAlgorithm)
+	}
+	h.Write(message)
+	signed := append([]byte(sshSignatureMagic), gossh.Marshal(struct {
+		Namespace     string
+		Reserved      string
+		HashAlgorithm string
+		Hash          []byte
+	}{sig.Namespace, sig.Reserved, sig.HashAlgorithm, h.Sum(nil)})...)
+
+	var s gossh.Signature
+	if err := gossh.Unmarshal(sig.Signature, &s); err != nil {
+		return nil, fmt.Errorf("malformed SSH signature: %w", err)
+	}
+	if err := pub.Verify(signed, &s); err != nil {
+		return nil, fmt.Errorf("invalid SSH signature: %w", err)
+	}
+	return pub, nil
+}
@@ -0,0 +1,213 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package git
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/pem"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// sshSigner signs git objects the way ssh-keygen -Y sign does.
+type sshSigner struct {
+	signer gossh.Signer
+}
+
+func newSSHSigner(t *testing.T) *sshSigner {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := gossh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &sshSigner{signer: signer}
+}
+
+func (s *sshSigner) authorizedKey() string {
+	return string(gossh.MarshalAuthorizedKey(s.signer.PublicKey()))
+}
+
+func (s *sshSigner) Sign(message io.Reader) ([]byte, error) {
+	h := sha512.New()
+	if _, err := io.Copy(h, message); err != nil {
+		return nil, err
+	}
+	signed := append([]byte(sshSignatureMagic), gossh.Marshal(struct {
+		Namespace, Reserved, HashAlgorithm string
+		Hash                               []byte
+	}{sshSignatureNamespace, "", "sha512", h.Sum(nil)})...)
+	sig, err := s.signer.Sign(rand.Reader, signed)
+	if err != nil {
+		return nil, err
+	}
+	blob := append([]byte(sshSignatureMagic), gossh.Marshal(struct {
+		Version                            uint32
+		PublicKey                          []byte
+		Namespace, Reserved, HashAlgorithm string
+		Signature                          []byte
+	}{1, s.signer.PublicKey().Marshal(), sshSignatureNamespace, "", "sha512", gossh.Marshal(sig)})...)
+	return pem.EncodeToMemory(&pem.Block{Type: "SSH SIGNATURE", Bytes: blob}), nil
+}
+
+// commitFile commits a file to the repository at repoDir, signed by signer
+// unless it is nil.
+func commitFile(t *testing.T, repoDir, name, content string, signer git.Signer) {
+	t.Helper()
+	repo, err := git.PlainOpen(repoDir)
+	if err != nil {
+		t.Fatalf("failed to open repo: %v", err)
+	}
+	w, err := repo.Worktree()
+	if err != nil {
+		t.Fatalf("failed to get worktree: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(repoDir, name), []byte(content), 0600); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	if _, err := w.Add(name); err != nil {
+		t.Fatalf("failed to add file: %v", err)
+	}
+	if _, err := w.Commit(content, &git.CommitOptions{
+		Author: &object.Signature{Name: "Tester", Email: "tester@example.com", When: time.Now()},
+		Signer: signer,
+	}); err != nil {
+		t.Fatalf("failed to commit: %v", err)
+	}
+}
+
+func TestGitGatherer_Gather_SSHSignedCommit(t *testing.T) {
+	repoDir := t.TempDir()
+	initLocalGitRepo(t, repoDir)
+	signer := newSSHSigner(t)
+	commitFile(t, repoDir, "policy.rego", "package signed", signer)
+
+	gg := GitGatherer{Signatures: SignatureVerification{SSHAllowedKeys: signer.authorizedKey()}}
+	dst := t.TempDir()
+	m, err := gg.Gather(context.Background(), "git::"+repoDir, dst)
+	if err != nil {
+		t.Fatalf("Gather returned an unexpected error: %v", err)
+	}
+	gm := m.Get().(*GitMetadata)
+	if gm.Signed != "commit "+gm.LatestCommit {
+		t.Errorf("expected the commit to be verified, got %q", gm.Signed)
+	}
+	if gm.SignedBy != gossh.FingerprintSHA256(signer.signer.PublicKey()) {
+		t.Errorf("unexpected signer %q", gm.SignedBy)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "policy.rego")); err != nil {
+		t.Errorf("expected the verified commit to be checked out: %v", err)
+	}
+
+	// A commit signed by another key is rejected before it is checked out
+	other := newSSHSigner(t)
+	gg = GitGatherer{Signatures: SignatureVerification{SSHAllowedKeys: other.authorizedKey()}}
+	dst = t.TempDir()
+	_, err = gg.Gather(context.Background(), "git::"+repoDir, dst)
+	if !errors.Is(err, ErrSignatureVerification) || !strings.Contains(err.Error(), "untrusted key") {
+		t.Fatalf("expected a signature verification error, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "policy.rego")); !os.IsNotExist(err) {
+		t.Errorf("expected nothing to be checked out, stat returned %v", err)
+	}
+
+	// An existing checkout is not updated to an unsigned commit
+	gg = GitGatherer{}
+	dst = t.TempDir()
+	if _, err := gg.Gather(context.Background(), "git::"+repoDir, dst); err != nil {
+		t.Fatalf("Gather returned an unexpected error: %v", err)
+	}
+	commitFile(t, repoDir, "policy.rego", "package unsigned", nil)
+	gg = GitGatherer{Signatures: SignatureVerification{SSHAllowedKeys: signer.authorizedKey()}}
+	_, err = gg.Gather(context.Background(), "git::"+repoDir, dst)
+	if !errors.Is(err, ErrSignatureVerification) || !strings.Contains(err.Error(), "not signed") {
+		t.Fatalf("expected a signature verification error, got %v", err)
+	}
+	if got, _ := os.ReadFile(filepath.Join(dst, "policy.rego")); string(got) != "package signed" {
+		t.Errorf("expected the checkout to be left as it was, got %q", got)
+	}
+}
+
+func TestGitGatherer_Gather_PGPSignedTag(t *testing.T) {
+	repoDir := t.TempDir()
+	initLocalGitRepo(t, repoDir)
+	commitFile(t, repoDir, "policy.rego", "package tagged", nil)
+
+	entity, err := openpgp.NewEntity("Tester", "", "tester@example.com", nil)
+	if err != nil {
+		t.Fatalf("failed to create key: %v", err)
+	}
+	repo, err := git.PlainOpen(repoDir)
+	if err != nil {
+		t.Fatalf("failed to open repo: %v", err)
+	}
+	head, err := repo.Head()
+	if err != nil {
+		t.Fatalf("failed to read HEAD: %v", err)
+	}
+	if _, err := repo.CreateTag("v1", head.Hash(), &git.CreateTagOptions{
+		Tagger:  &object.Signature{Name: "Tester", Email: "tester@example.com", When: time.Now()},
+		Message: "v1",
+		SignKey: entity,
+	}); err != nil {
+		t.Fatalf("failed to tag: %v", err)
+	}
+
+	var keyring bytes.Buffer
+	aw, err := armor.Encode(&keyring, openpgp.PublicKeyType, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := entity.Serialize(aw); err != nil {
+		t.Fatal(err)
+	}
+	aw.Close()
+
+	gg := GitGatherer{Signatures: SignatureVerification{PGPKeyRing: keyring.String()}}
+	m, err := gg.Gather(context.Background(), "git::"+repoDir+"?ref=v1", t.TempDir())
+	if err != nil {
+		t.Fatalf("Gather returned an unexpected error: %v", err)
+	}
+	gm := m.Get().(*GitMetadata)
+	if gm.Signed != "tag v1" || gm.SignedBy != entity.PrimaryKey.KeyIdString() {
+		t.Errorf("unexpected verification result %q by %q", gm.Signed, gm.SignedBy)
+	}
+
+	// The branch head is the same, but the commit itself is unsigned
+	_, err = gg.Gather(context.Background(), "git::"+repoDir, t.TempDir())
+	if !errors.Is(err, ErrSignatureVerification) {
+		t.Errorf("expected a signature verification error, got %v", err)
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package git
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// Environment variables consulted for SSH options the gatherer leaves unset.
+const (
+	// EnvSSHKeyPath names the private key file to authenticate with.
+	EnvSSHKeyPath = "GIT_SSH_KEY_PATH"
+	// EnvSSHKeyPassphrase holds the passphrase of the private key.
+	EnvSSHKeyPassphrase = "GIT_SSH_KEY_PASSPHRASE"
+	// EnvSSHKnownHosts lists known_hosts files, separated by the OS path
+	// list separator. It is the variable go-git itself reads.
+	EnvSSHKnownHosts = "SSH_KNOWN_HOSTS"
+	// EnvSSHInsecureIgnoreHostKey disables host key verification when "true".
+	EnvSSHInsecureIgnoreHostKey = "GIT_SSH_INSECURE_IGNORE_HOST_KEY"
+)
+
+// SSHOptions configures how git@host:org/repo and ssh:// sources are
+// authenticated. Fields left empty fall back to the environment variables
+// above. Without a private key the SSH agent is used.
+type SSHOptions struct {
+	// User overrides the user in the source, which defaults to "git".
+	User string
+	// KeyPath is the path to a private key, used instead of the SSH agent.
+	KeyPath string
+	// KeyPassphrase decrypts the private key at KeyPath.
+	KeyPassphrase string
+	// KnownHostsFiles are the known_hosts files host keys are verified
+	// against. By default those of the user and system are used.
+	KnownHostsFiles []string
+	// InsecureIgnoreHostKey accepts any host key. Use only for testing.
+	InsecureIgnoreHostKey bool
+}
+
+// isSSHSource reports whether src is an SSH URL, in either the scp-like
+// "git@host:org/repo" form or the "ssh://" form.
+func isSSHSource(src string) bool {
+	return strings.HasPrefix(src, "git@") || strings.HasPrefix(src, "ssh://")
+}
+
+// withEnv returns a copy of o with unset fields taken from the environment.
+func (o SSHOptions) withEnv() SSHOptions {
+	if o.KeyPath == "" {
+		o.KeyPath = os.Getenv(EnvSSHKeyPath)
+	}
+	if o.KeyPassphrase == "" {
+		o.KeyPassphrase = os.Getenv(EnvSSHKeyPassphrase)
+	}
+	if len(o.KnownHostsFiles) == 0 {
+		if files := os.Getenv(EnvSSHKnownHosts); files != "" {
+			o.KnownHostsFiles = filepath.SplitList(files)
+		}
+	}
+	if !o.InsecureIgnoreHostKey {
+		o.InsecureIgnoreHostKey = os.Getenv(EnvSSHInsecureIgnoreHostKey) == "true"
+	}
+	return o
+}
+
+// sshAuth returns the authentication method for the SSH URL src, using a
+// private key if one is configured and the SSH agent otherwise.
+func (g *GitGatherer) sshAuth(src string) (transport.AuthMethod, error) {
+	u, err := url.Parse(src)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse URL: %w", err)
+	}
+	opts := g.SSH.withEnv()
+	user := opts.User
+	if user == "" {
+		user = u.User.Username()
+	}
+	if user == "" {
+		user = "git"
+	}
+
+	var callback gossh.HostKeyCallback
+	switch {
+	case opts.InsecureIgnoreHostKey:
+		callback = gossh.InsecureIgnoreHostKey()
+	case len(opts.KnownHostsFiles) > 0:
+		if callback, err = ssh.NewKnownHostsCallback(opts.KnownHostsFiles...); err != nil {
+			return nil, fmt.Errorf("error reading known_hosts: %w", err)
+		}
+	}
+
+	if opts.KeyPath != "" {
+		keys, err := ssh.NewPublicKeysFromFile(user, opts.KeyPath, opts.KeyPassphrase)
+		if err != nil {
+			return nil, fmt.Errorf("error reading SSH key %s: %w", opts.KeyPath, err)
+		}
+		keys.HostKeyCallback = callback
+		return keys, nil
+	}
+
+	authenticator := g.Authenticator
+	if authenticator == nil {
+		authenticator = &RealSSHAuthenticator{}
+	}
+	auth, err := authenticator.NewSSHAgentAuth(user)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to the SSH agent: %w", err)
+	}
+	if agent, ok := auth.(*ssh.PublicKeysCallback); ok && callback != nil {
+		agent.HostKeyCallback = callback
+	}
+	return auth, nil
+}
@@ -0,0 +1,189 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package git
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
+	gossh "golang.org/x/crypto/ssh"
+)
+
+type fakeAgentAuthenticator struct {
+	user string
+	err  error
+}
+
+func (f *fakeAgentAuthenticator) NewSSHAgentAuth(user string) (transport.AuthMethod, error) {
+	f.user = user
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &ssh.PublicKeysCallback{User: user}, nil
+}
+
+// writeKey writes a new ed25519 private key, encrypted with passphrase if it
+// is not empty, and returns its path.
+func writeKey(t *testing.T, passphrase string) string {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var block *pem.Block
+	if passphrase == "" {
+		block, err = gossh.MarshalPrivateKey(priv, "")
+	} else {
+		block, err = gossh.MarshalPrivateKeyWithPassphrase(priv, "", []byte(passphrase))
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPath := filepath.Join(t.TempDir(), "id_ed25519")
+	if err := os.WriteFile(keyPath, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return keyPath
+}
+
+func clearSSHEnv(t *testing.T) {
+	for _, env := range []string{EnvSSHKeyPath, EnvSSHKeyPassphrase, EnvSSHKnownHosts, EnvSSHInsecureIgnoreHostKey} {
+		t.Setenv(env, "")
+	}
+}
+
+func TestProcessUrl_SSH(t *testing.T) {
+	tests := []struct {
+		src, url, ref, subdir string
+	}{
+		{"git@github.com:org/repo.git", "ssh://git@github.com/org/repo.git", "", ""},
+		{"git::git@github.com:org/repo.git?ref=main", "ssh://git@github.com/org/repo.git", "main", ""},
+		{"git@github.com:org/repo//policy?ref=v1", "ssh://git@github.com/org/repo.git", "v1", "policy"},
+		{"ssh://git@example.com:2222/org/repo.git", "ssh://git@example.com:2222/org/repo.git", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			u, ref, subdir, _, err := processUrl(tt.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if u != tt.url || ref != tt.ref || subdir != tt.subdir {
+				t.Errorf("processUrl(%q) = %q, %q, %q, want %q, %q, %q", tt.src, u, ref, subdir, tt.url, tt.ref, tt.subdir)
+			}
+		})
+	}
+}
+
+func TestGitGatherer_sshAuth_Key(t *testing.T) {
+	clearSSHEnv(t)
+	keyPath := writeKey(t, "secret")
+	knownHosts := filepath.Join(t.TempDir(), "known_hosts")
+	if err := os.WriteFile(knownHosts, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	g := &GitGatherer{SSH: SSHOptions{
+		KeyPath:         keyPath,
+		KeyPassphrase:   "secret",
+		KnownHostsFiles: []string{knownHosts},
+	}}
+	auth, err := g.sshAuth("ssh://deploy@example.com/org/repo.git")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, ok := auth.(*ssh.PublicKeys)
+	if !ok {
+		t.Fatalf("expected *ssh.PublicKeys, got %T", auth)
+	}
+	if keys.User != "deploy" {
+		t.Errorf("expected user deploy, got %s", keys.User)
+	}
+	if keys.HostKeyCallback == nil {
+		t.Error("expected a known_hosts host key callback")
+	}
+
+	g.SSH.KeyPassphrase = "wrong"
+	if _, err := g.sshAuth("ssh://git@example.com/org/repo.git"); err == nil {
+		t.Error("expected an error for a wrong passphrase")
+	}
+
+	g.SSH = SSHOptions{KeyPath: keyPath, KnownHostsFiles: []string{filepath.Join(t.TempDir(), "missing")}}
+	if _, err := g.sshAuth("ssh://git@example.com/org/repo.git"); err == nil {
+		t.Error("expected an error for a missing known_hosts file")
+	}
+}
+
+func TestGitGatherer_sshAuth_Env(t *testing.T) {
+	clearSSHEnv(t)
+	t.Setenv(EnvSSHKeyPath, writeKey(t, "from-env"))
+	t.Setenv(EnvSSHKeyPassphrase, "from-env")
+	t.Setenv(EnvSSHInsecureIgnoreHostKey, "true")
+
+	g := &GitGatherer{SSH: SSHOptions{User: "ci"}}
+	auth, err := g.sshAuth("ssh://git@example.com/org/repo.git")
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys, ok := auth.(*ssh.PublicKeys)
+	if !ok {
+		t.Fatalf("expected *ssh.PublicKeys, got %T", auth)
+	}
+	if keys.User != "ci" {
+		t.Errorf("expected user ci, got %s", keys.User)
+	}
+	if keys.HostKeyCallback == nil {
+		t.Error("expected host key verification to be disabled")
+	}
+}
+
+func TestGitGatherer_sshAuth_Agent(t *testing.T) {
+	clearSSHEnv(t)
+	agent := &fakeAgentAuthenticator{}
+	g := &GitGatherer{Authenticator: agent, SSH: SSHOptions{InsecureIgnoreHostKey: true}}
+
+	auth, err := g.sshAuth("ssh://git@example.com/org/repo.git")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if agent.user != "git" {
+		t.Errorf("expected the agent to be asked for user git, got %s", agent.user)
+	}
+	if cb, ok := auth.(*ssh.PublicKeysCallback); !ok || cb.HostKeyCallback == nil {
+		t.Errorf("expected an agent auth method with a host key callback, got %#v", auth)
+	}
+
+	agent.err = errors.New("no agent")
+	if _, err := g.sshAuth("ssh://git@example.com/org/repo.git"); err == nil {
+		t.Error("expected an error without an SSH agent")
+	}
+}
+
+func TestGitGatherer_Gather_SSHKeyError(t *testing.T) {
+	clearSSHEnv(t)
+	g := &GitGatherer{SSH: SSHOptions{KeyPath: filepath.Join(t.TempDir(), "missing")}}
+	if _, err := g.Gather(context.Background(), "git@github.com:org/repo.git", t.TempDir()); err == nil {
+		t.Error("expected an error for a missing SSH key")
+	}
+}
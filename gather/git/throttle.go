@@ -0,0 +1,52 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package git
+
+import (
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/go-git/go-git/v5/plumbing/transport/client"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+
+	"github.com/enterprise-contract/go-gather/internal/ratelimit"
+)
+
+var throttleOnce sync.Once
+
+// throttleProtocols installs go-git clients for the http and https protocols
+// whose connections are throttled by the ratelimit.Limiter of the context of
+// the clone or fetch. go-git only takes its clients from a global registry,
+// and needs them to have an *http.Transport, so the throttling is applied to
+// the connections it dials rather than by wrapping the transport. As each
+// connection is throttled for the gather it was dialed for, connections are
+// not kept alive.
+func throttleProtocols() {
+	throttleOnce.Do(func() {
+		t := http.DefaultTransport.(*http.Transport).Clone()
+		dial := t.DialContext
+		if dial == nil {
+			dial = (&net.Dialer{}).DialContext
+		}
+		t.DialContext = ratelimit.Dialer(dial)
+		t.DisableKeepAlives = true
+		c := githttp.NewClient(&http.Client{Transport: t})
+		client.InstallProtocol("http", c)
+		client.InstallProtocol("https", c)
+	})
+}
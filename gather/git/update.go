@@ -0,0 +1,184 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package git
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+
+	"github.com/enterprise-contract/go-gather/internal/multierr"
+)
+
+// errCommitNotFetched is returned by update when the requested commit could
+// not be fetched into the existing checkout, which then has to be replaced by
+// a fresh clone.
+var errCommitNotFetched = errors.New("commit not reachable from the existing checkout")
+
+// openCheckout opens the repository left in dst by an earlier gather of src.
+// It returns nil if dst holds no repository or one cloned from elsewhere.
+func openCheckout(dst, src string) (*git.Repository, error) {
+	r, err := git.PlainOpen(dst)
+	if errors.Is(err, git.ErrRepositoryNotExists) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error opening existing repository: %w", err)
+	}
+	remote, err := r.Remote(git.DefaultRemoteName)
+	if err != nil {
+		return nil, nil
+	}
+	if urls := remote.Config().URLs; len(urls) == 0 || urls[0] != src {
+		return nil, nil
+	}
+	return r, nil
+}
+
+// update fetches ref into the existing repository r and, once check accepts
+// the fetched commit, hard resets its worktree to it, leaving HEAD detached
+// at that commit. Files not tracked at that commit are removed.
+func update(ctx context.Context, r *git.Repository, opts *git.CloneOptions, ref string, check func(plumbing.Hash) error) error {
+	h, err := fetch(ctx, r, opts, ref)
+	if err != nil {
+		return err
+	}
+	// Annotated tags point at a tag object rather than the commit
+	if tag, err := r.TagObject(h); err == nil {
+		commit, err := tag.Commit()
+		if err != nil {
+			return fmt.Errorf("error resolving tag: %w", err)
+		}
+		h = commit.Hash
+	}
+	if _, err := r.CommitObject(h); err != nil {
+		return fmt.Errorf("error resolving ref: %w", err)
+	}
+	if err := check(h); err != nil {
+		return err
+	}
+	if err := r.Storer.SetReference(plumbing.NewHashReference(plumbing.HEAD, h)); err != nil {
+		return fmt.Errorf("error updating HEAD: %w", err)
+	}
+	w, err := r.Worktree()
+	if err != nil {
+		return fmt.Errorf("error getting worktree: %w", err)
+	}
+	if err := w.Reset(&git.ResetOptions{Commit: h, Mode: git.HardReset}); err != nil {
+		return fmt.Errorf("error resetting worktree: %w", err)
+	}
+	if err := w.Clean(&git.CleanOptions{Dir: true}); err != nil {
+		return fmt.Errorf("error removing untracked files: %w", err)
+	}
+	return nil
+}
+
+// fetch fetches ref from the origin remote of r and returns the commit it
+// points at. Like clone, a short name is tried as a branch and then as a
+// tag, and the remote HEAD is fetched if ref is empty.
+func fetch(ctx context.Context, r *git.Repository, opts *git.CloneOptions, ref string) (plumbing.Hash, error) {
+	fetchOpts := &git.FetchOptions{
+		RemoteName:      git.DefaultRemoteName,
+		Depth:           opts.Depth,
+		Auth:            opts.Auth,
+		InsecureSkipTLS: opts.InsecureSkipTLS,
+		ProxyOptions:    opts.ProxyOptions,
+		Tags:            git.NoTags,
+		Force:           true,
+	}
+
+	// Each candidate is fetched into the local reference named by its
+	// destination
+	var specs []config.RefSpec
+	switch {
+	case ref == "":
+		specs = []config.RefSpec{"+HEAD:refs/remotes/origin/HEAD"}
+	case plumbing.IsHash(ref):
+		h := plumbing.NewHash(ref)
+		return h, fetchCommit(ctx, r, fetchOpts, h)
+	case strings.HasPrefix(ref, "refs/"):
+		specs = []config.RefSpec{config.RefSpec("+" + ref + ":" + ref)}
+	default:
+		specs = []config.RefSpec{
+			config.RefSpec("+refs/heads/" + ref + ":refs/remotes/origin/" + ref),
+			config.RefSpec("+refs/tags/" + ref + ":refs/tags/" + ref),
+		}
+	}
+
+	var err error
+	for _, spec := range specs {
+		fetchOpts.RefSpecs = []config.RefSpec{spec}
+		err = r.FetchContext(ctx, fetchOpts)
+		if errors.Is(err, git.NoMatchingRefSpecError{}) {
+			continue
+		}
+		if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+			return plumbing.ZeroHash, fmt.Errorf("error fetching repository: %w", err)
+		}
+		local, err := r.Reference(spec.Dst(""), true)
+		if err != nil {
+			return plumbing.ZeroHash, fmt.Errorf("error resolving ref: %w", err)
+		}
+		return local.Hash(), nil
+	}
+	return plumbing.ZeroHash, fmt.Errorf("error fetching repository: %w", err)
+}
+
+// fetchCommit fetches the commit h unless r already has it. Servers that
+// cannot serve a commit by its hash are asked for every branch instead, which
+// cannot reach commits behind the boundary of a shallow clone.
+func fetchCommit(ctx context.Context, r *git.Repository, opts *git.FetchOptions, h plumbing.Hash) error {
+	if _, err := r.CommitObject(h); err == nil {
+		return nil
+	}
+	opts.Depth = 1
+	opts.RefSpecs = []config.RefSpec{config.RefSpec(h.String() + ":refs/gather/" + h.String())}
+	err := r.FetchContext(ctx, opts)
+	if errors.Is(err, git.ErrExactSHA1NotSupported) {
+		opts.Depth = 0
+		opts.RefSpecs = []config.RefSpec{"+refs/heads/*:refs/remotes/origin/*"}
+		err = r.FetchContext(ctx, opts)
+	}
+	if err != nil && !errors.Is(err, git.NoErrAlreadyUpToDate) {
+		return fmt.Errorf("error fetching repository: %w", err)
+	}
+	if _, err := r.CommitObject(h); err != nil {
+		return errCommitNotFetched
+	}
+	return nil
+}
+
+// removeContents removes everything in dir, leaving dir itself in place.
+// It carries on past entries that cannot be removed and reports them all.
+func removeContents(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	var errs multierr.Errors
+	for _, e := range entries {
+		errs = multierr.Append(errs, os.RemoveAll(filepath.Join(dir, e.Name())))
+	}
+	return errs.Err()
+}
@@ -0,0 +1,213 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package http
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/md5"  // nolint:gosec
+	"crypto/sha1" // nolint:gosec
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/enterprise-contract/go-gather/gather"
+	"github.com/enterprise-contract/go-gather/metadata"
+)
+
+// ErrChecksumMismatch is returned when the downloaded file does not match
+// the checksum given in the source URL.
+var ErrChecksumMismatch = gather.NewError("checksum mismatch", gather.ErrVerificationFailed)
+
+// checksumHashes are the hash types a checksum can name, as go-getter does.
+var checksumHashes = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// checksum is an expected digest of a download.
+type checksum struct {
+	kind  string
+	value []byte
+}
+
+// String returns the checksum in the "type:hex" form of the query parameter.
+func (c *checksum) String() string {
+	return c.kind + ":" + hex.EncodeToString(c.value)
+}
+
+// splitChecksum removes the "checksum" query parameter from u, leaving the
+// other parameters in place, and returns its value.
+func splitChecksum(u *url.URL) (string, bool, error) {
+	if u.RawQuery == "" {
+		return "", false, nil
+	}
+	var value string
+	var found bool
+	var kept []string
+	for _, p := range strings.Split(u.RawQuery, "&") {
+		k, v, _ := strings.Cut(p, "=")
+		if k != "checksum" {
+			kept = append(kept, p)
+			continue
+		}
+		var err error
+		if value, err = url.QueryUnescape(v); err != nil {
+			return "", false, fmt.Errorf("invalid checksum parameter: %w", err)
+		}
+		found = true
+	}
+	u.RawQuery = strings.Join(kept, "&")
+	return value, found, nil
+}
+
+// parseChecksum parses the value of a "checksum" query parameter: either
+// "type:hex", a bare hex digest whose type is told by its length, or
+// "file:url" naming a checksum file listing the digest of name.
+func parseChecksum(ctx context.Context, client *http.Client, header http.Header, value, name string) (*checksum, error) {
+	kind, digest, ok := strings.Cut(value, ":")
+	if !ok {
+		kind, digest = "", value
+	}
+	if kind == "file" {
+		var err error
+		if digest, err = fetchChecksum(ctx, client, header, digest, name); err != nil {
+			return nil, err
+		}
+		kind = ""
+	}
+	b, err := hex.DecodeString(digest)
+	if err != nil {
+		return nil, fmt.Errorf("invalid checksum %q: %w", value, err)
+	}
+	if kind == "" {
+		if kind = checksumKind(len(b)); kind == "" {
+			return nil, fmt.Errorf("invalid checksum %q: unknown digest length", value)
+		}
+	}
+	newHash, ok := checksumHashes[kind]
+	if !ok {
+		return nil, fmt.Errorf("invalid checksum %q: unsupported type %q", value, kind)
+	}
+	if len(b) != newHash().Size() {
+		return nil, fmt.Errorf("invalid checksum %q: %s digests are %d bytes", value, kind, newHash().Size())
+	}
+	return &checksum{kind: kind, value: b}, nil
+}
+
+// checksumKind returns the hash type producing digests of size bytes.
+func checksumKind(size int) string {
+	for kind, newHash := range checksumHashes {
+		if newHash().Size() == size {
+			return kind
+		}
+	}
+	return ""
+}
+
+// fetchChecksum downloads the checksum file at rawURL and returns the digest
+// it lists for name. Both the GNU "digest  name" and the BSD
+// "SHA256 (name) = digest" formats are understood, and a file holding a
+// single bare digest applies to any name.
+func fetchChecksum(ctx context.Context, client *http.Client, header http.Header, rawURL, name string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", rawURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create checksum file request: %w", err)
+	}
+	req.Header = header.Clone()
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to download checksum file: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to download checksum file: received response code %d", resp.StatusCode)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	var lines int
+	var bare string
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines++
+		if before, digest, ok := strings.Cut(line, ") = "); ok {
+			if _, file, ok := strings.Cut(before, " ("); ok && path.Base(file) == name {
+				return strings.TrimSpace(digest), nil
+			}
+			continue
+		}
+		fields := strings.Fields(line)
+		switch {
+		case len(fields) == 1:
+			bare = fields[0]
+		case len(fields) == 2 && path.Base(strings.TrimPrefix(fields[1], "*")) == name:
+			return fields[0], nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", fmt.Errorf("failed to read checksum file: %w", err)
+	}
+	if lines == 1 && bare != "" {
+		return bare, nil
+	}
+	return "", fmt.Errorf("checksum file %s lists no checksum for %s", rawURL, name)
+}
+
+// check verifies the download at p against c, recording the outcome in the
+// security trace of ctx.
+func (c *checksum) check(ctx context.Context, p string) error {
+	err := c.verify(p)
+	switch {
+	case errors.Is(err, ErrChecksumMismatch):
+		metadata.RecordCheck(ctx, metadata.SecurityCheck{Check: "checksum", Subject: p, Outcome: metadata.CheckRejected, Detail: err.Error()})
+	case err == nil:
+		metadata.RecordCheck(ctx, metadata.SecurityCheck{Check: "checksum", Subject: p, Outcome: metadata.CheckPassed, Detail: c.String()})
+	}
+	return err
+}
+
+// verify checks that the file at p matches c.
+func (c *checksum) verify(p string) error {
+	f, err := os.Open(p)
+	if err != nil {
+		return fmt.Errorf("failed to open download to verify checksum: %w", err)
+	}
+	defer f.Close()
+	h := checksumHashes[c.kind]()
+	if _, err := io.Copy(h, f); err != nil {
+		return fmt.Errorf("failed to read download to verify checksum: %w", err)
+	}
+	if got := h.Sum(nil); !bytes.Equal(got, c.value) {
+		return fmt.Errorf("%w: expected %s, got %s:%x", ErrChecksumMismatch, c, c.kind, got)
+	}
+	return nil
+}
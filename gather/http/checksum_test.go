@@ -0,0 +1,155 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package http
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/enterprise-contract/go-gather/gather"
+)
+
+func checksumServer(t *testing.T, content string, sums map[string]string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Has("checksum") {
+			t.Errorf("checksum parameter sent to the server: %s", r.URL)
+		}
+		if s, ok := sums[r.URL.Path]; ok {
+			_, _ = w.Write([]byte(s))
+			return
+		}
+		_, _ = w.Write([]byte(content))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestHTTPGatherer_Gather_Checksum(t *testing.T) {
+	content := "package main"
+	sha256sum := sha256.Sum256([]byte(content))
+	sha512sum := sha512.Sum512([]byte(content))
+	digest := hex.EncodeToString(sha256sum[:])
+	server := checksumServer(t, content, map[string]string{
+		"/SHA256SUMS":         "0000000000000000000000000000000000000000000000000000000000000000  other.rego\n" + digest + " *policy.rego\n",
+		"/BSDSUMS":            "SHA256 (policy.rego) = " + digest + "\n",
+		"/policy.rego.sha256": digest + "\n",
+	})
+
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{"typed", "checksum=sha256:" + digest, "sha256:" + digest},
+		{"bare", "checksum=" + hex.EncodeToString(sha512sum[:]), "sha512:" + hex.EncodeToString(sha512sum[:])},
+		{"other parameters kept", "a=1&checksum=sha256:" + digest + "&b=2", "sha256:" + digest},
+		{"checksum file", "checksum=file:" + server.URL + "/SHA256SUMS", "sha256:" + digest},
+		{"bsd checksum file", "checksum=file:" + server.URL + "/BSDSUMS", "sha256:" + digest},
+		{"single digest file", "checksum=file:" + server.URL + "/policy.rego.sha256", "sha256:" + digest},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewHTTPGatherer()
+			dst := filepath.Join(t.TempDir(), "policy.rego")
+			m, err := g.Gather(context.Background(), "http::"+server.URL+"/policy.rego?"+tc.query, dst)
+			if err != nil {
+				t.Fatalf("Gather returned unexpected error: %v", err)
+			}
+			if got := m.(*HTTPMetadata).Checksum; got != tc.want {
+				t.Errorf("expected checksum %s, got %s", tc.want, got)
+			}
+			if b, err := os.ReadFile(dst); err != nil || string(b) != content {
+				t.Errorf("expected %q at the destination, got %q (%v)", content, b, err)
+			}
+		})
+	}
+}
+
+func TestHTTPGatherer_Gather_ChecksumMismatch(t *testing.T) {
+	server := checksumServer(t, "package main", nil)
+
+	g := NewHTTPGatherer()
+	dst := filepath.Join(t.TempDir(), "policy.rego")
+	_, err := g.Gather(context.Background(), server.URL+"/policy.rego?checksum=sha256:"+strings.Repeat("0", 64), dst)
+	if !errors.Is(err, ErrChecksumMismatch) || !errors.Is(err, gather.ErrVerificationFailed) {
+		t.Fatalf("expected ErrChecksumMismatch, got %v", err)
+	}
+	if _, err := os.Stat(dst); !os.IsNotExist(err) {
+		t.Errorf("expected the destination to be removed, got %v", err)
+	}
+}
+
+func TestHTTPGatherer_Gather_ChecksumArchiveEntry(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	w, err := zw.Create("policy.rego")
+	if err != nil {
+		t.Fatalf("failed to create zip entry: %v", err)
+	}
+	if _, err := w.Write([]byte("package main")); err != nil {
+		t.Fatalf("failed to write zip entry: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("failed to close zip: %v", err)
+	}
+	sum := sha256.Sum256(buf.Bytes())
+	server := checksumServer(t, buf.String(), nil)
+
+	g := NewHTTPGatherer()
+	dst := filepath.Join(t.TempDir(), "policy.rego")
+	if _, err := g.Gather(context.Background(), server.URL+"/bundle.zip?checksum=sha256:"+hex.EncodeToString(sum[:])+"#policy.rego", dst); err != nil {
+		t.Fatalf("Gather returned unexpected error: %v", err)
+	}
+
+	dst = filepath.Join(t.TempDir(), "policy.rego")
+	_, err = g.Gather(context.Background(), server.URL+"/bundle.zip?checksum=md5:"+strings.Repeat("0", 32)+"#policy.rego", dst)
+	if !errors.Is(err, ErrChecksumMismatch) {
+		t.Fatalf("expected ErrChecksumMismatch, got %v", err)
+	}
+	if _, err := os.Stat(dst); !os.IsNotExist(err) {
+		t.Errorf("expected no entry to be extracted, got %v", err)
+	}
+}
+
+func TestHTTPGatherer_Gather_InvalidChecksum(t *testing.T) {
+	server := checksumServer(t, "package main", map[string]string{"/SHA256SUMS": "abcd  other.rego\n"})
+
+	for _, query := range []string{
+		"checksum=sha256:xyz",
+		"checksum=crc32:00000000",
+		"checksum=sha256:" + strings.Repeat("0", 32),
+		"checksum=" + strings.Repeat("0", 10),
+		"checksum=file:" + server.URL + "/SHA256SUMS",
+	} {
+		g := NewHTTPGatherer()
+		if _, err := g.Gather(context.Background(), server.URL+"/policy.rego?"+query, filepath.Join(t.TempDir(), "policy.rego")); err == nil {
+			t.Errorf("expected %s to be rejected", query)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package http
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/enterprise-contract/go-gather/faults"
+	"github.com/enterprise-contract/go-gather/internal/multierr"
+)
+
+// defaultChunkMinSize is the size from which files are downloaded in chunks
+// by default.
+const defaultChunkMinSize = 16 << 20
+
+// ChunkOptions configure downloading large files in several ranged requests
+// sent in parallel, which is usually faster than a single stream from CDNs
+// and object storage. Only servers accepting byte ranges, as announced in
+// their response to a HEAD request, are downloaded from in chunks. Other
+// files are downloaded in a single stream.
+type ChunkOptions struct {
+	// Count is the number of chunks downloaded in parallel. Files are
+	// downloaded in chunks only when it is 2 or more.
+	Count int
+	// MinSize is the size from which files are downloaded in chunks. It
+	// defaults to 16 MiB.
+	MinSize int64
+}
+
+func (c ChunkOptions) enabled() bool {
+	return c.Count > 1
+}
+
+// chunkSize returns the size of the chunks a file of size bytes is
+// downloaded in, the last one being smaller.
+func (c ChunkOptions) chunkSize(size int64) int64 {
+	return (size + int64(c.Count) - 1) / int64(c.Count)
+}
+
+// chunks returns the number of chunks a file of size bytes is downloaded
+// in, fewer than Count for a file of fewer bytes.
+func (c ChunkOptions) chunks(size int64) int {
+	chunk := c.chunkSize(size)
+	return int((size + chunk - 1) / chunk)
+}
+
+// probe sends a HEAD request for req and returns the size of the resource,
+// its validators, and whether it is to be downloaded in chunks.
+func (c ChunkOptions) probe(client *http.Client, req *http.Request) (int64, partialState, bool) {
+	head := req.Clone(req.Context())
+	head.Method = http.MethodHead
+	resp, err := client.Do(head)
+	if err != nil {
+		return 0, partialState{}, false
+	}
+	resp.Body.Close()
+	minSize := c.MinSize
+	if minSize <= 0 {
+		minSize = defaultChunkMinSize
+	}
+	if resp.StatusCode != http.StatusOK || resp.ContentLength < minSize || !strings.EqualFold(resp.Header.Get("Accept-Ranges"), "bytes") {
+		return 0, partialState{}, false
+	}
+	s := partialState{ETag: resp.Header.Get("ETag"), LastModified: resp.Header.Get("Last-Modified")}
+	return resp.ContentLength, s, true
+}
+
+// download downloads the size bytes of the resource requested by req to dst
+// in chunks, in parallel, through a temporary file renamed into place once
+// every chunk is complete. When the resource has a validator the chunks are
+// requested with If-Range, so that a resource changing midway fails the
+// download instead of mixing versions. It reports whether an error is worth
+// retrying.
+func (c ChunkOptions) download(ctx context.Context, client *http.Client, req *http.Request, dst string, size int64, validator string) (bool, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".*.tmp")
+	if err != nil {
+		return false, fmt.Errorf("failed to create destination file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if err := tmp.Truncate(size); err != nil {
+		tmp.Close()
+		return false, fmt.Errorf("failed to write to destination file: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+		retry    bool
+	)
+	fail := func(r bool, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if firstErr == nil {
+			firstErr, retry = err, r
+			cancel()
+		}
+	}
+
+	hook := faults.FromContext(ctx)
+	chunk := c.chunkSize(size)
+	for start := int64(0); start < size; start += chunk {
+		end := min(start+chunk, size) - 1
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if r, err := fetchChunk(ctx, client, req, validator, start, end, faults.Writer(hook, dst, io.NewOffsetWriter(tmp, start))); err != nil {
+				fail(r, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if firstErr != nil {
+		tmp.Close()
+		return retry, firstErr
+	}
+	if err := tmp.Close(); err != nil {
+		return false, fmt.Errorf("failed to write to destination file: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return false, fmt.Errorf("failed to set destination file mode: %w", err)
+	}
+	if err := faults.Check(hook, faults.Rename, dst, 0); err != nil {
+		return false, fmt.Errorf("failed to move download into place: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), dst); err != nil {
+		return false, fmt.Errorf("failed to move download into place: %w", err)
+	}
+	return false, nil
+}
+
+// fetchChunk writes the bytes from start to end, inclusive, of the resource
+// requested by req to w. It reports whether an error is worth retrying.
+func fetchChunk(ctx context.Context, client *http.Client, req *http.Request, validator string, start, end int64, w io.Writer) (bool, error) {
+	r := req.Clone(ctx)
+	r.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+	if validator != "" {
+		r.Header.Set("If-Range", validator)
+	}
+	resp, err := client.Do(r)
+	if err != nil {
+		return true, fmt.Errorf("failed to download from URL: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// A full response means the resource changed since it was probed
+	if resp.StatusCode != http.StatusPartialContent {
+		return true, fmt.Errorf("failed to download bytes %d-%d: received response code %d", start, end, resp.StatusCode)
+	}
+	if got, err := contentRangeStart(resp.Header.Get("Content-Range")); err != nil || got != start {
+		return true, fmt.Errorf("failed to download bytes %d-%d: %w", start, end, multierr.Append(multierr.Errors{errRangeMismatch}, err))
+	}
+
+	body := &bodyReader{r: resp.Body}
+	want := end - start + 1
+	n, err := io.Copy(w, io.LimitReader(body, want))
+	if err == nil && n < want {
+		body.err = io.ErrUnexpectedEOF
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return body.err != nil, fmt.Errorf("failed to write to destination file: %w", err)
+	}
+	return false, nil
+}
@@ -0,0 +1,146 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package http
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// rangeServer serves content supporting ranges, counting the requests by
+// method and the ranges asked for.
+type rangeServer struct {
+	mu      sync.Mutex
+	content []byte
+	etag    string
+	heads   int
+	ranges  []string
+}
+
+func (s *rangeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	if r.Method == http.MethodHead {
+		s.heads++
+	} else {
+		s.ranges = append(s.ranges, r.Header.Get("Range"))
+	}
+	content, etag := s.content, s.etag
+	s.mu.Unlock()
+	w.Header().Set("ETag", etag)
+	http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+}
+
+func TestHTTPGatherer_Gather_Parallel(t *testing.T) {
+	content := []byte(strings.Repeat("0123456789", 1001))
+
+	t.Run("chunks", func(t *testing.T) {
+		s := &rangeServer{content: content, etag: `"v1"`}
+		server := httptest.NewServer(s)
+		defer server.Close()
+
+		g := NewHTTPGatherer()
+		g.Parallel = ChunkOptions{Count: 4, MinSize: 1024}
+		dest := filepath.Join(t.TempDir(), "file.bin")
+		meta, err := g.Gather(context.Background(), server.URL+"/file.bin", dest)
+		if err != nil {
+			t.Fatalf("Gather returned unexpected error: %v", err)
+		}
+		got, err := os.ReadFile(dest)
+		if err != nil || !bytes.Equal(got, content) {
+			t.Fatalf("expected the complete content, got %d bytes, %v", len(got), err)
+		}
+		m := meta.(*HTTPMetadata)
+		if m.Chunks != 4 || m.Size != int64(len(content)) {
+			t.Errorf("expected 4 chunks of %d bytes, got %+v", len(content), m)
+		}
+		if s.heads != 1 || len(s.ranges) != 4 {
+			t.Errorf("expected a HEAD request and 4 ranged requests, got %d and %q", s.heads, s.ranges)
+		}
+		for _, r := range s.ranges {
+			if !strings.HasPrefix(r, "bytes=") {
+				t.Errorf("expected a ranged request, got %q", r)
+			}
+		}
+	})
+
+	t.Run("small file", func(t *testing.T) {
+		s := &rangeServer{content: content}
+		server := httptest.NewServer(s)
+		defer server.Close()
+
+		g := NewHTTPGatherer()
+		g.Parallel = ChunkOptions{Count: 4}
+		meta, err := g.Gather(context.Background(), server.URL+"/file.bin", filepath.Join(t.TempDir(), "file.bin"))
+		if err != nil {
+			t.Fatalf("Gather returned unexpected error: %v", err)
+		}
+		if m := meta.(*HTTPMetadata); m.Chunks != 0 || len(s.ranges) != 1 || s.ranges[0] != "" {
+			t.Errorf("expected a single stream below the default minimum size, got %+v, %q", m, s.ranges)
+		}
+	})
+
+	t.Run("no ranges", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write(content)
+		}))
+		defer server.Close()
+
+		g := NewHTTPGatherer()
+		g.Parallel = ChunkOptions{Count: 4, MinSize: 1024}
+		dest := filepath.Join(t.TempDir(), "file.bin")
+		meta, err := g.Gather(context.Background(), server.URL+"/file.bin", dest)
+		if err != nil {
+			t.Fatalf("Gather returned unexpected error: %v", err)
+		}
+		got, _ := os.ReadFile(dest)
+		if m := meta.(*HTTPMetadata); m.Chunks != 0 || !bytes.Equal(got, content) {
+			t.Errorf("expected a single stream from a server without ranges, got %+v", m)
+		}
+	})
+
+	t.Run("changed", func(t *testing.T) {
+		s := &rangeServer{content: content, etag: `"v1"`}
+		// The resource changes once it has been probed
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			s.ServeHTTP(w, r)
+			if r.Method == http.MethodHead {
+				s.mu.Lock()
+				s.etag = `"v2"`
+				s.mu.Unlock()
+			}
+		}))
+		defer server.Close()
+
+		g := NewHTTPGatherer()
+		g.Parallel = ChunkOptions{Count: 4, MinSize: 1024}
+		dest := filepath.Join(t.TempDir(), "file.bin")
+		if _, err := g.Gather(context.Background(), server.URL+"/file.bin", dest); err == nil || !strings.Contains(err.Error(), "received response code 200") {
+			t.Errorf("expected the download to fail when the resource changes, got %v", err)
+		}
+		if entries, _ := os.ReadDir(filepath.Dir(dest)); len(entries) != 0 {
+			t.Errorf("expected nothing to be left behind, got %v", entries)
+		}
+	})
+}
@@ -0,0 +1,74 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// validatorsPath returns the path of the file recording the validators of
+// the resource downloaded to dst.
+func validatorsPath(dst string) string {
+	return filepath.Join(filepath.Dir(dst), "."+filepath.Base(dst)+".cache.json")
+}
+
+// conditionalRequest returns req asking for url only if it changed since it
+// was downloaded to dst, and whether it does. A destination that is missing
+// or was downloaded from elsewhere is requested unconditionally.
+func conditionalRequest(req *http.Request, url, dst string) (*http.Request, bool) {
+	b, err := os.ReadFile(validatorsPath(dst))
+	if err != nil {
+		return req, false
+	}
+	var s partialState
+	if err := json.Unmarshal(b, &s); err != nil || s.URL != url || (s.ETag == "" && s.LastModified == "") {
+		return req, false
+	}
+	if fi, err := os.Stat(dst); err != nil || !fi.Mode().IsRegular() {
+		return req, false
+	}
+	req = req.Clone(req.Context())
+	if s.ETag != "" {
+		req.Header.Set("If-None-Match", s.ETag)
+	}
+	if s.LastModified != "" {
+		req.Header.Set("If-Modified-Since", s.LastModified)
+	}
+	return req, true
+}
+
+// saveValidators records the validators s of the resource at url
+// downloaded to dst, for conditionalRequest. A resource without any is
+// forgotten.
+func saveValidators(s partialState, url, dst string) error {
+	p := validatorsPath(dst)
+	if s.ETag == "" && s.LastModified == "" {
+		if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	s.URL = url
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(p, b, 0600)
+}
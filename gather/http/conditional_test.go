@@ -0,0 +1,139 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHTTPGatherer_Gather_Conditional(t *testing.T) {
+	etag, content := `"v1"`, "package main"
+	var requests []http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Header.Clone())
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		_, _ = w.Write([]byte(content))
+	}))
+	defer server.Close()
+
+	dst := filepath.Join(t.TempDir(), "policy.rego")
+	gather := func() *HTTPMetadata {
+		t.Helper()
+		g := NewHTTPGatherer()
+		g.Conditional = true
+		m, err := g.Gather(context.Background(), server.URL+"/policy.rego", dst)
+		if err != nil {
+			t.Fatalf("Gather returned unexpected error: %v", err)
+		}
+		return m.(*HTTPMetadata)
+	}
+
+	if m := gather(); m.NotModified || m.ResponseCode != http.StatusOK {
+		t.Fatalf("expected the first gather to download, got %+v", m)
+	}
+	if _, err := os.Stat(validatorsPath(dst)); err != nil {
+		t.Fatalf("expected the validators to be recorded: %v", err)
+	}
+
+	m := gather()
+	if !m.NotModified || m.ResponseCode != http.StatusNotModified || m.Size != int64(len(content)) {
+		t.Errorf("expected the second gather to keep the destination, got %+v", m)
+	}
+	if got := requests[1].Get("If-None-Match"); got != etag {
+		t.Errorf("expected If-None-Match %s, got %q", etag, got)
+	}
+
+	etag, content = `"v2"`, "package changed"
+	if m := gather(); m.NotModified {
+		t.Errorf("expected a changed resource to be downloaded, got %+v", m)
+	}
+	if b, err := os.ReadFile(dst); err != nil || string(b) != content {
+		t.Errorf("expected %q at the destination, got %q (%v)", content, b, err)
+	}
+
+	// The validators of another URL do not apply
+	g := NewHTTPGatherer()
+	g.Conditional = true
+	if _, err := g.Gather(context.Background(), server.URL+"/other/policy.rego", dst); err != nil {
+		t.Fatalf("Gather returned unexpected error: %v", err)
+	}
+	if got := requests[len(requests)-1].Get("If-None-Match"); got != "" {
+		t.Errorf("expected an unconditional request for another URL, got If-None-Match %q", got)
+	}
+}
+
+func TestHTTPGatherer_Gather_ConditionalLastModified(t *testing.T) {
+	modified := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "policy.rego", modified, strings.NewReader("package main"))
+	}))
+	defer server.Close()
+
+	dst := filepath.Join(t.TempDir(), "policy.rego")
+	for i, want := range []bool{false, true} {
+		g := NewHTTPGatherer()
+		g.Conditional = true
+		m, err := g.Gather(context.Background(), server.URL+"/policy.rego", dst)
+		if err != nil {
+			t.Fatalf("Gather returned unexpected error: %v", err)
+		}
+		if got := m.(*HTTPMetadata).NotModified; got != want {
+			t.Errorf("gather %d: expected NotModified %v, got %v", i, want, got)
+		}
+	}
+
+	// A destination removed in between is downloaded again
+	if err := os.Remove(dst); err != nil {
+		t.Fatal(err)
+	}
+	g := NewHTTPGatherer()
+	g.Conditional = true
+	m, err := g.Gather(context.Background(), server.URL+"/policy.rego", dst)
+	if err != nil {
+		t.Fatalf("Gather returned unexpected error: %v", err)
+	}
+	if m.(*HTTPMetadata).NotModified {
+		t.Error("expected a missing destination to be downloaded")
+	}
+}
+
+func TestHTTPGatherer_Gather_NotConditional(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		_, _ = w.Write([]byte("package main"))
+	}))
+	defer server.Close()
+
+	dst := filepath.Join(t.TempDir(), "policy.rego")
+	if _, err := NewHTTPGatherer().Gather(context.Background(), server.URL+"/policy.rego", dst); err != nil {
+		t.Fatalf("Gather returned unexpected error: %v", err)
+	}
+	if _, err := os.Stat(validatorsPath(dst)); !os.IsNotExist(err) {
+		t.Errorf("expected no validators to be recorded, got %v", err)
+	}
+}
@@ -0,0 +1,369 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package http
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/enterprise-contract/go-gather/expand"
+	"github.com/enterprise-contract/go-gather/internal/helpers"
+	"github.com/enterprise-contract/go-gather/metadata"
+)
+
+// DirOptions configure gathering a directory from an HTTP server listing
+// it, in place of tools like "wget --recursive".
+type DirOptions struct {
+	// Recursive gathers the source as a directory: the files in its
+	// listing are downloaded below the destination, and its subdirectories
+	// are gathered in turn. Listings are autoindex pages as served by nginx
+	// or Apache, or JSON listings as served by nginx with autoindex_format
+	// json or by Caddy. Links leading out of the directory are not
+	// followed.
+	Recursive bool
+	// MaxDepth limits how deep subdirectories are gathered: 1 gathers the
+	// files of the source directory only. Zero sets no limit.
+	MaxDepth int
+	// Include selects the files to download, by patterns as understood by
+	// path.Match matched against their slash-separated paths relative to
+	// the source directory, or against their names for patterns without a
+	// slash. Every file is selected by default.
+	Include []string
+	// Exclude leaves out the files and directories matching any of these
+	// patterns, written like those of Include.
+	Exclude []string
+	// Delay is waited between the requests sent to the server, to be
+	// polite to it.
+	Delay time.Duration
+}
+
+// matches reports whether the slash-separated path rel matches any of the
+// patterns.
+func matches(patterns []string, rel string) bool {
+	for _, p := range patterns {
+		name := rel
+		if !strings.Contains(p, "/") {
+			name = path.Base(rel)
+		}
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// selects reports whether the file or directory at rel is gathered.
+func (o DirOptions) selects(rel string, dir bool) bool {
+	if matches(o.Exclude, rel) {
+		return false
+	}
+	return dir || len(o.Include) == 0 || matches(o.Include, rel)
+}
+
+// dirEntry is a file or a directory in a listing.
+type dirEntry struct {
+	name string
+	dir  bool
+	// size and modified are zero when the listing does not tell them.
+	size     int64
+	modified time.Time
+}
+
+// hrefPattern matches the targets of the links of an index page.
+var hrefPattern = regexp.MustCompile(`(?i)<a\s[^>]*?href\s*=\s*["']([^"']+)["']`)
+
+// parseIndex returns the entries an index page of the directory at dirURL
+// links to, leaving out the links to sort the page, to parent directories
+// and to anything but the direct children of the directory.
+func parseIndex(page []byte, dirURL *url.URL) []dirEntry {
+	var entries []dirEntry
+	seen := map[string]bool{}
+	for _, m := range hrefPattern.FindAllSubmatch(page, -1) {
+		href := strings.ReplaceAll(string(m[1]), "&amp;", "&")
+		if strings.ContainsAny(href, "?#") {
+			continue
+		}
+		ref, err := url.Parse(href)
+		if err != nil {
+			continue
+		}
+		u := dirURL.ResolveReference(ref)
+		if u.Scheme != dirURL.Scheme || u.Host != dirURL.Host {
+			continue
+		}
+		rest, ok := strings.CutPrefix(u.Path, dirURL.Path)
+		if !ok {
+			continue
+		}
+		name, dir := strings.CutSuffix(rest, "/")
+		if !validName(name) || seen[name] {
+			continue
+		}
+		seen[name] = true
+		entries = append(entries, dirEntry{name: name, dir: dir})
+	}
+	return entries
+}
+
+// jsonEntry is an entry of a JSON listing, as served by nginx or Caddy.
+type jsonEntry struct {
+	Name string `json:"name"`
+	// Type is "file" or "directory" in nginx listings.
+	Type string `json:"type"`
+	// IsDir is set for directories in Caddy listings.
+	IsDir bool  `json:"is_dir"`
+	Size  int64 `json:"size"`
+	// MTime is when nginx saw the entry modified, ModTime when Caddy did.
+	MTime   string `json:"mtime"`
+	ModTime string `json:"mod_time"`
+}
+
+// parseJSONListing returns the entries of a JSON listing.
+func parseJSONListing(data []byte) ([]dirEntry, error) {
+	var listing []jsonEntry
+	if err := json.Unmarshal(data, &listing); err != nil {
+		return nil, fmt.Errorf("failed to decode directory listing: %w", err)
+	}
+	var entries []dirEntry
+	for _, e := range listing {
+		name, slash := strings.CutSuffix(e.Name, "/")
+		if !validName(name) {
+			continue
+		}
+		entry := dirEntry{name: name, dir: slash || e.IsDir || e.Type == "directory", size: e.Size}
+		for _, v := range []string{e.MTime, e.ModTime} {
+			if t, err := http.ParseTime(v); err == nil {
+				entry.modified = t
+			} else if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+				entry.modified = t
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// validName reports whether name names an entry of the directory itself.
+func validName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, `/\`)
+}
+
+// upToDate reports whether the file at p is what the listing shows for e:
+// of the same size and modified no earlier. Listings without sizes and
+// times never are.
+func upToDate(p string, e dirEntry) bool {
+	if e.size <= 0 || e.modified.IsZero() {
+		return false
+	}
+	fi, err := os.Stat(p)
+	return err == nil && fi.Mode().IsRegular() && fi.Size() == e.size && !fi.ModTime().Before(e.modified)
+}
+
+// errNotListing is returned for a directory served as something else than
+// a listing.
+var errNotListing = errors.New("not a directory listing")
+
+// pacer spaces the requests to a server by a delay.
+type pacer struct {
+	delay time.Duration
+	last  time.Time
+}
+
+// wait returns once the delay has passed since the last request.
+func (p *pacer) wait(ctx context.Context) error {
+	if p.delay > 0 && !p.last.IsZero() {
+		t := time.NewTimer(time.Until(p.last.Add(p.delay)))
+		defer t.Stop()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+	p.last = time.Now()
+	return nil
+}
+
+// list returns the entries of the listing of the directory at dirURL.
+func (h *HTTPGatherer) list(ctx context.Context, client *http.Client, p *pacer, dirURL *url.URL) ([]dirEntry, error) {
+	var data []byte
+	var contentType string
+	_, err := h.Retry.do(ctx, func() (bool, time.Duration, error) {
+		if err := p.wait(ctx); err != nil {
+			return false, 0, err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, dirURL.String(), nil)
+		if err != nil {
+			return false, 0, fmt.Errorf("failed to create HTTP request: %w", err)
+		}
+		h.setHeaders(ctx, req.Header)
+		if req.Header.Get("Accept") == "" {
+			req.Header.Set("Accept", "application/json, text/html;q=0.9")
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return !forbidden(err), 0, fmt.Errorf("failed to list %s: %w", dirURL.Redacted(), err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return h.Retry.retryable(resp.StatusCode), retryAfter(resp), fmt.Errorf("failed to list %s: %w", dirURL.Redacted(), statusError(resp.StatusCode))
+		}
+		body := &bodyReader{r: resp.Body}
+		if data, err = io.ReadAll(body); err != nil {
+			return body.err != nil, 0, fmt.Errorf("failed to list %s: %w", dirURL.Redacted(), err)
+		}
+		contentType = resp.Header.Get("Content-Type")
+		return false, 0, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case strings.Contains(contentType, "json") || bytes.HasPrefix(trimmed, []byte("[")):
+		return parseJSONListing(trimmed)
+	case strings.Contains(contentType, "html"):
+		return parseIndex(data, dirURL), nil
+	default:
+		return nil, fmt.Errorf("%s: %w (content type %q)", dirURL.Redacted(), errNotListing, contentType)
+	}
+}
+
+// gatherDir gathers the directory listed at src to the directory dst, see
+// DirOptions.
+func (h *HTTPGatherer) gatherDir(ctx context.Context, rawSource string, src *url.URL, dst string) (metadata.Metadata, error) {
+	if src.Fragment != "" || src.Query().Has("checksum") {
+		return nil, errors.New("archive entries and checksums cannot be gathered from a directory")
+	}
+	dst, err := helpers.ExpandPath(dst)
+	if err != nil {
+		return nil, fmt.Errorf("failed to expand destination path: %w", err)
+	}
+	client, err := h.client()
+	if err != nil {
+		return nil, err
+	}
+	root := *src
+	if !strings.HasSuffix(root.Path, "/") {
+		root.Path += "/"
+		root.RawPath = ""
+	}
+
+	// Each file is downloaded like a single one, with the options of h,
+	// the sandbox being checked here against its path in the tree. Only
+	// the directory itself is resolved, the files listed in it are not
+	file := *h
+	file.Directory = DirOptions{}
+	file.Resolver = nil
+	fileCtx := expand.WithoutSandbox(ctx)
+	sandbox := expand.SandboxFromContext(ctx)
+	trace := metadata.SecurityTraceFromContext(ctx)
+
+	opts := h.Directory
+	p := &pacer{delay: opts.Delay}
+	var skipped []metadata.SkippedEntry
+	var files int
+	var size int64
+
+	type pending struct {
+		url   *url.URL
+		rel   string
+		depth int
+	}
+	queue := []pending{{url: &root, rel: ".", depth: 1}}
+	visited := map[string]bool{root.String(): true}
+	for len(queue) > 0 {
+		d := queue[0]
+		queue = queue[1:]
+		entries, err := h.list(ctx, &client, p, d.url)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			rel := path.Join(d.rel, e.name)
+			u := d.url.ResolveReference(&url.URL{Path: e.name})
+			if e.dir {
+				u.Path += "/"
+			}
+			if !opts.selects(rel, e.dir) {
+				skipped = append(skipped, metadata.SkippedEntry{Path: rel, Reason: metadata.SkipFiltered})
+				continue
+			}
+			if ok, err := sandbox.Check(trace, rel, e.dir); err != nil {
+				return nil, err
+			} else if !ok {
+				skipped = append(skipped, metadata.SkippedEntry{Path: rel, Reason: metadata.SkipSandbox})
+				continue
+			}
+			if e.dir {
+				if (opts.MaxDepth == 0 || d.depth < opts.MaxDepth) && !visited[u.String()] {
+					visited[u.String()] = true
+					queue = append(queue, pending{url: u, rel: rel, depth: d.depth + 1})
+				}
+				continue
+			}
+
+			// Files left by an interrupted gather are not downloaded again
+			target := filepath.Join(dst, filepath.FromSlash(rel))
+			if upToDate(target, e) {
+				files++
+				size += e.size
+				continue
+			}
+			if err := p.wait(ctx); err != nil {
+				return nil, err
+			}
+			f := file
+			m, err := f.Gather(fileCtx, u.String(), filepath.Dir(target)+string(filepath.Separator))
+			if err != nil {
+				return nil, fmt.Errorf("failed to gather %s: %w", rel, err)
+			}
+			files++
+			size += m.(*HTTPMetadata).Size
+		}
+	}
+
+	h.HTTPMetadata = HTTPMetadata{
+		URI:          rawSource,
+		Path:         dst,
+		ResponseCode: http.StatusOK,
+		Files:        files,
+		Skipped:      skipped,
+		Size:         size,
+	}
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create destination directory: %w", err)
+	}
+	if h.Sizes, err = metadata.ScanSizes(ctx, dst, metadata.LargestFiles); err != nil {
+		return nil, fmt.Errorf("failed to report sizes: %w", err)
+	}
+	h.Timestamp = time.Now().Format(time.RFC3339)
+	return &h.HTTPMetadata, nil
+}
@@ -0,0 +1,363 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/enterprise-contract/go-gather/expand"
+	"github.com/enterprise-contract/go-gather/metadata"
+)
+
+// writeTree writes files, keyed by slash-separated path, below root.
+func writeTree(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// treeFiles returns the files below root, keyed by slash-separated path.
+func treeFiles(t *testing.T, root string) map[string]string {
+	t.Helper()
+	files := map[string]string{}
+	err := filepath.WalkDir(root, func(p string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(root, p)
+		files[filepath.ToSlash(rel)] = string(b)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+var policyTree = map[string]string{
+	"main.rego":             "package main",
+	"README.md":             "# policies",
+	"lib/util.rego":         "package lib",
+	"lib/deep/nested.rego":  "package nested",
+	"vendor/ignored.rego":   "package vendor",
+	"data/config.json":      "{}",
+	"data/LICENSE":          "Apache-2.0",
+	"lib/deep/more/x.rego":  "package more",
+	"lib/deep/more/y.json":  "[]",
+	"lib/deep/more/z.yaml":  "z: 1",
+	"lib/deep/more/README":  "more",
+	"lib/deep/more/.hidden": "hidden",
+}
+
+func TestHTTPGatherer_Gather_DirectoryIndex(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, policyTree)
+	server := httptest.NewServer(http.FileServer(http.Dir(root)))
+	defer server.Close()
+
+	g := NewHTTPGatherer()
+	g.Directory = DirOptions{Recursive: true}
+	dst := filepath.Join(t.TempDir(), "policy")
+	m, err := g.Gather(context.Background(), server.URL+"/", dst)
+	if err != nil {
+		t.Fatalf("Gather returned unexpected error: %v", err)
+	}
+	if got := treeFiles(t, dst); !reflect.DeepEqual(got, policyTree) {
+		t.Errorf("unexpected files gathered: %v", got)
+	}
+	meta := m.(*HTTPMetadata)
+	if meta.Files != len(policyTree) || meta.Path != dst {
+		t.Errorf("unexpected metadata: %+v", meta)
+	}
+}
+
+func TestHTTPGatherer_Gather_DirectoryResolvedOnce(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, policyTree)
+	server := httptest.NewServer(http.FileServer(http.Dir(root)))
+	defer server.Close()
+
+	var resolved []string
+	g := NewHTTPGatherer()
+	g.Directory = DirOptions{Recursive: true}
+	g.Resolver = ResolverFunc(func(ctx context.Context, client *http.Client, header http.Header, src *url.URL) (*url.URL, error) {
+		resolved = append(resolved, src.String())
+		return nil, nil
+	})
+	dst := filepath.Join(t.TempDir(), "policy")
+	if _, err := g.Gather(context.Background(), server.URL+"/", dst); err != nil {
+		t.Fatalf("Gather returned unexpected error: %v", err)
+	}
+	if want := []string{server.URL + "/"}; !reflect.DeepEqual(resolved, want) {
+		t.Errorf("expected only %v to be resolved, got %v", want, resolved)
+	}
+	if got := treeFiles(t, dst); !reflect.DeepEqual(got, policyTree) {
+		t.Errorf("unexpected files gathered: %v", got)
+	}
+}
+
+func TestHTTPGatherer_Gather_DirectoryOptions(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, policyTree)
+	server := httptest.NewServer(http.FileServer(http.Dir(root)))
+	defer server.Close()
+
+	g := NewHTTPGatherer()
+	g.Directory = DirOptions{
+		Recursive: true,
+		MaxDepth:  2,
+		Include:   []string{"*.rego", "data/*"},
+		Exclude:   []string{"vendor"},
+	}
+	dst := t.TempDir()
+	m, err := g.Gather(context.Background(), server.URL+"/", dst)
+	if err != nil {
+		t.Fatalf("Gather returned unexpected error: %v", err)
+	}
+	want := map[string]string{
+		"main.rego":        "package main",
+		"lib/util.rego":    "package lib",
+		"data/config.json": "{}",
+		"data/LICENSE":     "Apache-2.0",
+	}
+	if got := treeFiles(t, dst); !reflect.DeepEqual(got, want) {
+		t.Errorf("unexpected files gathered: %v", got)
+	}
+	var skipped []string
+	for _, s := range m.(*HTTPMetadata).Skipped {
+		if s.Reason != metadata.SkipFiltered {
+			t.Errorf("unexpected skip reason: %+v", s)
+		}
+		skipped = append(skipped, s.Path)
+	}
+	sort.Strings(skipped)
+	if strings.Join(skipped, ",") != "README.md,vendor" {
+		t.Errorf("unexpected entries skipped: %v", skipped)
+	}
+}
+
+func TestHTTPGatherer_Gather_DirectorySandbox(t *testing.T) {
+	root := t.TempDir()
+	writeTree(t, root, policyTree)
+	server := httptest.NewServer(http.FileServer(http.Dir(root)))
+	defer server.Close()
+
+	g := NewHTTPGatherer()
+	g.Directory = DirOptions{Recursive: true}
+	dst := t.TempDir()
+	ctx := expand.WithSandbox(context.Background(), expand.Sandbox{Allow: []string{"lib/deep"}, Skip: true})
+	if _, err := g.Gather(ctx, server.URL+"/", dst); err != nil {
+		t.Fatalf("Gather returned unexpected error: %v", err)
+	}
+	for name := range treeFiles(t, dst) {
+		if !strings.HasPrefix(name, "lib/deep/") {
+			t.Errorf("expected %s to be left out by the sandbox", name)
+		}
+	}
+}
+
+// jsonListing serves the files of tree, and nginx style JSON listings of its
+// directories, counting the requests for each path.
+type jsonListing struct {
+	mu       sync.Mutex
+	tree     map[string]string
+	modified time.Time
+	requests map[string]int
+}
+
+func (l *jsonListing) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	l.mu.Lock()
+	l.requests[r.URL.Path]++
+	l.mu.Unlock()
+	p := strings.TrimPrefix(r.URL.Path, "/")
+	if content, ok := l.tree[p]; ok {
+		_, _ = w.Write([]byte(content))
+		return
+	}
+	if p != "" && !strings.HasSuffix(p, "/") {
+		http.NotFound(w, r)
+		return
+	}
+	var entries []map[string]any
+	seen := map[string]bool{}
+	for name, content := range l.tree {
+		rest, ok := strings.CutPrefix(name, p)
+		if !ok {
+			continue
+		}
+		mtime := l.modified.Format(http.TimeFormat)
+		if dir, _, ok := strings.Cut(rest, "/"); ok {
+			if !seen[dir] {
+				seen[dir] = true
+				entries = append(entries, map[string]any{"name": dir, "type": "directory", "mtime": mtime})
+			}
+			continue
+		}
+		entries = append(entries, map[string]any{"name": rest, "type": "file", "size": len(content), "mtime": mtime})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(entries)
+}
+
+func TestHTTPGatherer_Gather_DirectoryJSON(t *testing.T) {
+	listing := &jsonListing{tree: policyTree, modified: time.Now().Add(-time.Hour), requests: map[string]int{}}
+	server := httptest.NewServer(listing)
+	defer server.Close()
+
+	g := NewHTTPGatherer()
+	g.Directory = DirOptions{Recursive: true, Delay: time.Millisecond}
+	dst := t.TempDir()
+	if _, err := g.Gather(context.Background(), server.URL+"/", dst); err != nil {
+		t.Fatalf("Gather returned unexpected error: %v", err)
+	}
+	if got := treeFiles(t, dst); !reflect.DeepEqual(got, policyTree) {
+		t.Errorf("unexpected files gathered: %v", got)
+	}
+
+	// A gather resumed after an interruption downloads only what is missing
+	// or changed
+	if err := os.Remove(filepath.Join(dst, "lib", "util.rego")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dst, "main.rego"), []byte("package old"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	listing.requests = map[string]int{}
+	m, err := g.Gather(context.Background(), server.URL+"/", dst)
+	if err != nil {
+		t.Fatalf("Gather returned unexpected error: %v", err)
+	}
+	if got := treeFiles(t, dst); !reflect.DeepEqual(got, policyTree) {
+		t.Errorf("unexpected files gathered: %v", got)
+	}
+	for p := range listing.requests {
+		if !strings.HasSuffix(p, "/") && p != "/lib/util.rego" && p != "/main.rego" {
+			t.Errorf("unexpected download of %s", p)
+		}
+	}
+	if files := m.(*HTTPMetadata).Files; files != len(policyTree) {
+		t.Errorf("expected %d files, got %d", len(policyTree), files)
+	}
+}
+
+func TestHTTPGatherer_Gather_DirectoryNotListing(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		_, _ = w.Write([]byte("data"))
+	}))
+	defer server.Close()
+
+	g := NewHTTPGatherer()
+	g.Directory = DirOptions{Recursive: true}
+	if _, err := g.Gather(context.Background(), server.URL+"/file.bin", t.TempDir()); err == nil || !strings.Contains(err.Error(), errNotListing.Error()) {
+		t.Errorf("expected a not a listing error, got %v", err)
+	}
+}
+
+func TestParseIndex(t *testing.T) {
+	dir, _ := url.Parse("https://example.com/pub/policy/")
+	page := `<html><body><h1>Index of /pub/policy</h1>
+<a href="?C=N;O=D">Name</a> <a href="?C=M;O=A">Last modified</a>
+<a href="/pub/">Parent Directory</a>
+<a href="../">../</a>
+<a href="main.rego">main.rego</a>
+<A HREF='lib/'>lib/</A>
+<a href="/pub/policy/data/">data/</a>
+<a href="https://example.com/pub/policy/abs.rego">abs.rego</a>
+<a href="https://other.example.com/pub/policy/x.rego">x.rego</a>
+<a href="lib/util.rego">nested</a>
+<a href="my%20file.txt">my file.txt</a>
+<a href="main.rego">main.rego again</a>
+</body></html>`
+	var got []string
+	for _, e := range parseIndex([]byte(page), dir) {
+		name := e.name
+		if e.dir {
+			name += "/"
+		}
+		got = append(got, name)
+	}
+	want := []string{"main.rego", "lib/", "data/", "abs.rego", "my file.txt"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseIndex() = %v, want %v", got, want)
+	}
+}
+
+func TestParseJSONListing(t *testing.T) {
+	caddy := `[{"name":"lib/","size":4096,"url":"./lib/","mod_time":"2024-01-02T03:04:05Z","is_dir":true},
+{"name":"main.rego","size":12,"url":"./main.rego","mod_time":"2024-01-02T03:04:05Z","is_dir":false},
+{"name":"../escape","size":1,"is_dir":false}]`
+	entries, err := parseJSONListing([]byte(caddy))
+	if err != nil {
+		t.Fatalf("parseJSONListing returned an error: %v", err)
+	}
+	modified := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	want := []dirEntry{
+		{name: "lib", dir: true, size: 4096, modified: modified},
+		{name: "main.rego", size: 12, modified: modified},
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("parseJSONListing() = %+v, want %+v", entries, want)
+	}
+
+	if _, err := parseJSONListing([]byte("{}")); err == nil {
+		t.Error("expected an error for a listing that is not an array")
+	}
+}
+
+func TestPacer(t *testing.T) {
+	p := &pacer{delay: 20 * time.Millisecond}
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := p.wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("expected requests to be spaced by the delay, took %v", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	p = &pacer{delay: time.Hour, last: time.Now()}
+	if err := p.wait(ctx); err != context.Canceled {
+		t.Errorf("expected a cancelled wait, got %v", err)
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package http
+
+import (
+	"context"
+	"net/http"
+)
+
+type headersKey struct{}
+
+// WithHeaders returns a context adding headers to the requests of the HTTP
+// gathers it is passed to, on top of those of the gatherer, for callers
+// sharing a gatherer across sources that need different headers. Headers
+// set on ctx already are kept unless headers sets them again.
+func WithHeaders(ctx context.Context, headers http.Header) context.Context {
+	merged := HeadersFromContext(ctx).Clone()
+	if merged == nil {
+		merged = http.Header{}
+	}
+	setHeaders(merged, headers)
+	return context.WithValue(ctx, headersKey{}, merged)
+}
+
+// HeadersFromContext returns the headers carried by ctx, or nil.
+func HeadersFromContext(ctx context.Context) http.Header {
+	h, _ := ctx.Value(headersKey{}).(http.Header)
+	return h
+}
+
+// setHeaders sets every header of from on to, replacing the values of
+// headers to already has.
+func setHeaders(to, from http.Header) {
+	for name, values := range from {
+		to.Del(name)
+		for _, v := range values {
+			to.Add(name, v)
+		}
+	}
+}
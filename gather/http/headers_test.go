@@ -0,0 +1,73 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestHTTPGatherer_Gather_Headers(t *testing.T) {
+	var got http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		_, _ = w.Write([]byte("data"))
+	}))
+	defer server.Close()
+
+	g := NewHTTPGatherer()
+	g.Headers = http.Header{
+		"Accept":          {"application/octet-stream"},
+		"User-Agent":      {"policy-fetcher"},
+		"X-Jfrog-Art-Api": {"gatherer"},
+	}
+	g.BearerToken = "s3cr3t"
+	ctx := WithHeaders(context.Background(), http.Header{"X-Jfrog-Art-Api": {"context"}})
+	ctx = WithHeaders(ctx, http.Header{"X-Request-Id": {"42"}})
+	if _, err := g.Gather(ctx, server.URL+"/file.txt", filepath.Join(t.TempDir(), "file.txt")); err != nil {
+		t.Fatalf("Gather returned unexpected error: %v", err)
+	}
+
+	for name, want := range map[string]string{
+		"Accept":          "application/octet-stream",
+		"User-Agent":      "policy-fetcher",
+		"Authorization":   "Bearer s3cr3t",
+		"X-Jfrog-Art-Api": "context",
+		"X-Request-Id":    "42",
+	} {
+		if values := got.Values(name); len(values) != 1 || values[0] != want {
+			t.Errorf("expected header %s: %s, got %q", name, want, values)
+		}
+	}
+}
+
+func TestWithHeaders(t *testing.T) {
+	if h := HeadersFromContext(context.Background()); h != nil {
+		t.Errorf("expected no headers, got %v", h)
+	}
+	parent := WithHeaders(context.Background(), http.Header{"A": {"1"}, "B": {"1"}})
+	child := WithHeaders(parent, http.Header{"B": {"2", "3"}})
+	if h := HeadersFromContext(parent); h.Get("B") != "1" {
+		t.Errorf("expected the parent headers to be left alone, got %v", h)
+	}
+	if h := HeadersFromContext(child); h.Get("A") != "1" || len(h.Values("B")) != 2 {
+		t.Errorf("expected the headers to be merged, got %v", h)
+	}
+}
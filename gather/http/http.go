@@ -23,12 +23,27 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/enterprise-contract/go-gather/expand"
+	"github.com/enterprise-contract/go-gather/faults"
+	"github.com/enterprise-contract/go-gather/fserrors"
 	"github.com/enterprise-contract/go-gather/gather"
+	"github.com/enterprise-contract/go-gather/internal/cloud"
 	"github.com/enterprise-contract/go-gather/internal/helpers"
+	"github.com/enterprise-contract/go-gather/internal/logging"
+	"github.com/enterprise-contract/go-gather/internal/metrics"
+	"github.com/enterprise-contract/go-gather/internal/multierr"
+	"github.com/enterprise-contract/go-gather/internal/provider"
+	"github.com/enterprise-contract/go-gather/internal/proxy"
+	"github.com/enterprise-contract/go-gather/internal/ratelimit"
+	"github.com/enterprise-contract/go-gather/internal/tracing"
 	"github.com/enterprise-contract/go-gather/metadata"
 )
 
@@ -37,14 +52,92 @@ var Transport http.RoundTripper = http.DefaultTransport
 type HTTPGatherer struct {
 	HTTPMetadata
 	Client http.Client
+	// Headers are sent with every request, e.g. "Accept" or an API token
+	// header such as "X-JFrog-Art-Api", replacing the default ones of the
+	// same name. See also WithHeaders. Headers other than Authorization and
+	// Cookie are also sent to the hosts the requests are redirected to.
+	Headers http.Header
+	// BearerToken, when set, is sent in the Authorization header, e.g. a
+	// GitHub token to download private release assets.
+	BearerToken string
+	// Proxy is the URL of a proxy to send the requests through, e.g.
+	// "http://proxy.example.com:3128", in place of the one of the
+	// HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables.
+	Proxy string
+	// TLS trusts additional certificate authorities and presents a client
+	// certificate, without disabling certificate verification.
+	TLS TLSOptions
+	// Redirects limits the redirects followed and the hosts requested. By
+	// default up to 10 redirects are followed, to any host.
+	Redirects RedirectPolicy
+	// RateLimit bounds the bandwidth of the downloads, in bytes per second.
+	// The chunks of a parallel download share it. Downloads are not
+	// throttled when zero.
+	RateLimit int64
+	// Resolver resolves sources naming a symbolic version, such as
+	// "latest", to the artifact to download, see PointerFile and
+	// JSONIndex. Sources are downloaded as they are when nil.
+	Resolver Resolver
+	// Retry retries downloads failing for transient reasons, such as a
+	// connection reset or a 503 response. Downloads are not retried by
+	// default.
+	Retry RetryPolicy
+	// Resume keeps the part of a download that was transferred before it
+	// broke off, in a hidden ".partial" file next to the destination, and
+	// asks for the rest with a Range request when the download is retried
+	// or gathered again. A resource that changed in between, or a server not
+	// supporting ranges, restarts the download. Resources without an ETag
+	// or Last-Modified header are never resumed. Archive entries selected
+	// with a fragment are not resumed either.
+	Resume bool
+	// Parallel downloads large files in several ranged requests sent in
+	// parallel. Files downloaded in chunks are not resumed.
+	Parallel ChunkOptions
+	// Conditional records the ETag and Last-Modified headers of a download
+	// in a hidden ".cache.json" file next to the destination, and gathering
+	// the same URL to the same destination again sends them back in
+	// If-None-Match and If-Modified-Since headers. When the server answers
+	// 304 Not Modified the destination is kept as it is.
+	Conditional bool
+	// Directory gathers a whole directory from servers listing it.
+	Directory DirOptions
 }
 
 type HTTPMetadata struct {
-	URI          string
-	Path         string
+	URI  string
+	Path string
+	// Entry is the archive entry selected by the fragment of the URI, if
+	// any, in which case Size is the size of the entry.
+	Entry        string
 	ResponseCode int
-	Size         int64
-	Timestamp    string
+	// Attempts is the number of times the download was attempted, see
+	// HTTPGatherer.Retry.
+	Attempts int
+	// ResumedFrom is the offset the download was resumed from, see
+	// HTTPGatherer.Resume.
+	ResumedFrom int64
+	// Chunks is the number of chunks the file was downloaded in, in
+	// parallel, zero when it was downloaded in a single stream. See
+	// HTTPGatherer.Parallel.
+	Chunks int
+	// NotModified reports that the server found the destination up to
+	// date, see HTTPGatherer.Conditional.
+	NotModified bool
+	// Resolved is the URL downloaded in place of URI, when Resolver
+	// resolved it.
+	Resolved string
+	// Checksum is the checksum the download was verified against, given
+	// with a "checksum" query parameter, in the form "sha256:<hex>".
+	Checksum  string
+	Size      int64
+	Timestamp string
+	// Files is the number of files gathered from a directory, see
+	// HTTPGatherer.Directory. Skipped lists the files and directories of
+	// its listings that were left out, and why.
+	Files   int
+	Skipped []metadata.SkippedEntry
+	// Sizes reports the sizes of the files gathered.
+	Sizes *metadata.SizeReport
 }
 
 func NewHTTPGatherer() *HTTPGatherer {
@@ -53,14 +146,22 @@ func NewHTTPGatherer() *HTTPGatherer {
 	}
 }
 
-func (h *HTTPGatherer) Gather(ctx context.Context, rawSource, dst string) (metadata.Metadata, error) {
+func (h *HTTPGatherer) Gather(ctx context.Context, rawSource, dst string) (_ metadata.Metadata, err error) {
+	ctx, span := tracing.Start(ctx, "http.download", tracing.Source(rawSource)...)
+	defer func() { tracing.End(span, err) }()
+
+	defer func() { err = fserrors.Classify(err) }()
+
 	select {
 	case <-ctx.Done():
 		return nil, ctx.Err()
 	default:
 	}
 
-	src, err := url.Parse(rawSource)
+	// A go-getter style "http::" prefix forces this gatherer
+	source := strings.TrimPrefix(rawSource, "http::")
+
+	src, err := url.Parse(source)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse source URI: %w", err)
 	}
@@ -70,6 +171,28 @@ func (h *HTTPGatherer) Gather(ctx context.Context, rawSource, dst string) (metad
 		return nil, fmt.Errorf("no source scheme provided")
 	}
 
+	// A symbolic version, such as "latest", is resolved to the artifact
+	// it stands for before anything else
+	var resolved string
+	if h.Resolver != nil {
+		u, err := h.resolve(ctx, src)
+		if err != nil {
+			return nil, err
+		}
+		if u != nil {
+			src, source, resolved = u, u.String(), u.String()
+		}
+	}
+
+	if h.Directory.Recursive {
+		m, err := h.gatherDir(ctx, rawSource, src, dst)
+		if err != nil {
+			return nil, err
+		}
+		h.Resolved = resolved
+		return m, nil
+	}
+
 	// Check if the source filename is provided
 	if src.Path == "" {
 		return nil, fmt.Errorf("specify a path to a file to download")
@@ -78,6 +201,30 @@ func (h *HTTPGatherer) Gather(ctx context.Context, rawSource, dst string) (metad
 	// Get the source filename
 	sourceFileName := filepath.Base(src.Path)
 
+	// A "checksum" query parameter, as understood by go-getter, is verified
+	// rather than sent
+	requestURL := source
+	wantChecksum, verifyChecksum, err := splitChecksum(src)
+	if err != nil {
+		return nil, err
+	}
+	if verifyChecksum {
+		requestURL = src.String()
+	}
+
+	// A fragment names the single entry of an archive to write to the
+	// destination, e.g. "https://example.com/bundle.zip#policy.rego"
+	entry := src.Fragment
+	var extractor expand.EntryExtractor
+	if entry != "" {
+		var ok bool
+		if extractor, ok = expand.GetExpander(sourceFileName).(expand.EntryExtractor); !ok {
+			return nil, fmt.Errorf("cannot select entry %q: no expander able to extract single entries of %s", entry, sourceFileName)
+		}
+		requestURL = strings.TrimSuffix(requestURL, "#"+src.EscapedFragment())
+		sourceFileName = path.Base(entry)
+	}
+
 	// Expand the destination path
 	dst, err = helpers.ExpandPath(dst)
 	if err != nil {
@@ -86,66 +233,344 @@ func (h *HTTPGatherer) Gather(ctx context.Context, rawSource, dst string) (metad
 
 	// Check if the destination has a trailing slash.
 	// If it does, append the source filename to the destination path.
+	// rel is the path written relative to the destination given.
+	rel := "."
 	if strings.HasSuffix(dst, "/") {
 		dst = filepath.Join(dst, sourceFileName)
+		rel = sourceFileName
 	} else {
 		// If it doesn't, append the source filename to the destination path.
 		if filepath.Ext(dst) == "" {
 			dst = filepath.Join(dst, "/", sourceFileName)
+			rel = sourceFileName
 		}
 	}
 
+	// A sandbox that leaves the file out fails the gather before anything
+	// is downloaded
+	if err := expand.SandboxFromContext(ctx).Require(metadata.SecurityTraceFromContext(ctx), rel, false); err != nil {
+		return nil, err
+	}
+
 	// Create a new HTTP request
-	req, err := http.NewRequestWithContext(ctx, "GET", rawSource, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", requestURL, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
 	}
 
-	// Set the User-Agent header
-	req.Header.Set("User-Agent", "Go-Gather")
-
-	// Set the transport
-	h.Client.Transport = Transport
-
-	// Perform the HTTP request
-	resp, err := h.Client.Do(req)
+	h.setHeaders(ctx, req.Header)
+	client, err := h.client()
 	if err != nil {
-		return nil, fmt.Errorf("failed to download from URL: %w", err)
+		return nil, err
 	}
-	defer resp.Body.Close()
 
-	// Check if the response code is "ok"
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("received non-200 response code: %d", resp.StatusCode)
+	var sum *checksum
+	if verifyChecksum {
+		if sum, err = parseChecksum(ctx, &client, req.Header, wantChecksum, filepath.Base(src.Path)); err != nil {
+			return nil, err
+		}
 	}
 
-	// Create the destination file
-	err = os.MkdirAll(filepath.Dir(dst), 0755)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create destination directory: %w", err)
+	// A destination downloaded before is only downloaded again when the
+	// resource changed
+	var conditional, notModified bool
+	if h.Conditional {
+		req, conditional = conditionalRequest(req, requestURL, dst)
 	}
-	outFile, err := os.Create(dst)
+
+	// Perform the HTTP request, retrying transient failures as configured
+	var responseCode int
+	var bytesWritten, resumedFrom int64
+	var chunks int
+	var validators partialState
+	resume := h.Resume && extractor == nil
+	attempts, err := h.Retry.do(ctx, func() (bool, time.Duration, error) {
+		attemptReq, offset := req, int64(0)
+		if resume {
+			attemptReq, offset = resumeRequest(req, requestURL, dst)
+		}
+
+		// Large files are downloaded in chunks when the server allows it
+		if h.Parallel.enabled() && extractor == nil && offset == 0 {
+			if size, probed, ok := h.Parallel.probe(&client, req); ok {
+				if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+					return false, 0, fmt.Errorf("failed to create destination directory: %w", err)
+				}
+				if retry, err := h.Parallel.download(ctx, &client, req, dst, size, probed.validator()); err != nil {
+					return retry, 0, err
+				}
+				responseCode, bytesWritten, resumedFrom = http.StatusPartialContent, size, 0
+				chunks, notModified, validators = h.Parallel.chunks(size), false, probed
+				return false, 0, nil
+			}
+		}
+
+		resp, err := client.Do(attemptReq)
+		if err != nil {
+			return !forbidden(err), 0, fmt.Errorf("failed to download from URL: %w", err)
+		}
+		defer resp.Body.Close()
+
+		// The destination is up to date
+		if conditional && resp.StatusCode == http.StatusNotModified {
+			fi, err := os.Stat(dst)
+			if err != nil {
+				return false, 0, fmt.Errorf("failed to read destination file: %w", err)
+			}
+			responseCode, bytesWritten, resumedFrom, chunks, notModified = resp.StatusCode, fi.Size(), 0, 0, true
+			return false, 0, nil
+		}
+
+		// What was downloaded before is complete or no longer there
+		if offset > 0 && resp.StatusCode == http.StatusRequestedRangeNotSatisfiable {
+			removePartial(dst)
+			return true, 0, fmt.Errorf("failed to resume download at byte %d: received response code %d", offset, resp.StatusCode)
+		}
+
+		// Check if the response code is "ok"
+		if resp.StatusCode != http.StatusOK && (offset == 0 || resp.StatusCode != http.StatusPartialContent) {
+			return h.Retry.retryable(resp.StatusCode), retryAfter(resp), statusError(resp.StatusCode)
+		}
+
+		// Create the destination directory
+		err = os.MkdirAll(filepath.Dir(dst), 0755)
+		if err != nil {
+			return false, 0, fmt.Errorf("failed to create destination directory: %w", err)
+		}
+
+		// Only a transfer broken off is retried, not a failure to write it
+		body := &bodyReader{r: resp.Body}
+		var n int64
+		if resume {
+			n, offset, err = writeResumable(ctx, resp, body, requestURL, dst, offset)
+		} else if extractor != nil {
+			n, err = writeEntry(ctx, body, extractor, filepath.Base(src.Path), entry, dst, sum)
+		} else {
+			n, err = writeFile(ctx, body, dst)
+		}
+		if err != nil {
+			return body.err != nil, 0, err
+		}
+		responseCode, bytesWritten, resumedFrom, chunks, notModified = resp.StatusCode, n, offset, 0, false
+		validators = partialState{ETag: resp.Header.Get("ETag"), LastModified: resp.Header.Get("Last-Modified")}
+		return false, 0, nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to create destination file: %w", err)
+		return nil, err
 	}
-	defer outFile.Close()
 
-	bytesWritten, err := io.Copy(outFile, resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to write to destination file: %w", err)
+	// A file is verified once downloaded, and removed if it does not match.
+	// The archive an entry is selected from was verified by writeEntry
+	if sum != nil && extractor == nil {
+		if err := sum.check(ctx, dst); err != nil {
+			return nil, multierr.Append(multierr.Errors{err}, os.Remove(dst)).Err()
+		}
+	}
+
+	if h.Conditional && !notModified {
+		if err := saveValidators(validators, requestURL, dst); err != nil {
+			return nil, fmt.Errorf("failed to record validators: %w", err)
+		}
 	}
 
 	h.URI = rawSource
 	h.Path = dst
-	h.ResponseCode = resp.StatusCode
+	h.Entry = entry
+	h.ResponseCode = responseCode
+	h.Attempts = attempts
+	h.ResumedFrom = resumedFrom
+	h.Chunks = chunks
+	h.NotModified = notModified
+	h.Resolved = resolved
+	h.Files = 0
+	h.Skipped = nil
+	h.Checksum = ""
+	if sum != nil {
+		h.Checksum = sum.String()
+	}
 	h.Size = bytesWritten
+	if h.Sizes, err = metadata.ScanSizes(ctx, dst, metadata.LargestFiles); err != nil {
+		return nil, fmt.Errorf("failed to report sizes: %w", err)
+	}
 	h.Timestamp = time.Now().Format(time.RFC3339)
+	logging.Debug(ctx, "downloaded", logging.Source(rawSource), "bytes", bytesWritten, "attempts", attempts, "not_modified", notModified)
+	tracing.Annotate(ctx, attribute.Int("http.response.status_code", responseCode), attribute.Int("http.attempts", attempts), attribute.Int64("bytes", bytesWritten))
+	if notModified {
+		metrics.CacheHit(ctx)
+	} else {
+		metrics.Transferred(ctx, bytesWritten)
+	}
 
 	return &h.HTTPMetadata, nil
 }
 
+// setHeaders sets the User-Agent header, and the headers of the gatherer and
+// of ctx, in order of precedence.
+func (h *HTTPGatherer) setHeaders(ctx context.Context, header http.Header) {
+	header.Set("User-Agent", "Go-Gather")
+	setHeaders(header, h.Headers)
+	if h.BearerToken != "" {
+		header.Set("Authorization", "Bearer "+h.BearerToken)
+	}
+	setHeaders(header, HeadersFromContext(ctx))
+}
+
+// resolve resolves src with the Resolver of h, returning nil when src names
+// no symbolic version.
+func (h *HTTPGatherer) resolve(ctx context.Context, src *url.URL) (*url.URL, error) {
+	client, err := h.client()
+	if err != nil {
+		return nil, err
+	}
+	header := http.Header{}
+	h.setHeaders(ctx, header)
+	u, err := h.Resolver.Resolve(ctx, &client, header, src)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %w", src.Redacted(), err)
+	}
+	return u, nil
+}
+
+// client returns a copy of the client of h with the transport set,
+// throttling and caching requests to GitHub/GitLab. A transport of the
+// client's own, e.g. one sending requests through a proxy, is wrapped
+// instead of the package one.
+func (h *HTTPGatherer) client() (http.Client, error) {
+	client := h.Client
+	base := client.Transport
+	if base == nil {
+		base = Transport
+	}
+	base, err := h.TLS.transport(base)
+	if err != nil {
+		return http.Client{}, err
+	}
+	base, err = proxy.Transport(base, h.Proxy)
+	if err != nil {
+		return http.Client{}, err
+	}
+	client.Transport = provider.NewTransport(ratelimit.Transport(base, ratelimit.New(h.RateLimit)))
+	if !h.Redirects.isZero() {
+		client.CheckRedirect = h.Redirects.checkRedirect(client.CheckRedirect)
+		if len(h.Redirects.AllowedHosts) > 0 {
+			client.Transport = allowlist{base: client.Transport, policy: h.Redirects}
+		}
+	}
+	return client, nil
+}
+
+// writeFile streams body into a fresh temporary file next to dst and renames
+// it into place once the transfer completes. A failed or interrupted transfer
+// never leaves a partial file at dst, and every attempt starts from an empty
+// file rather than appending to the leftovers of a previous one.
+func writeFile(ctx context.Context, body io.Reader, dst string) (int64, error) {
+	return writeAtomic(ctx, dst, func(w io.Writer) (int64, error) {
+		return io.Copy(w, body)
+	})
+}
+
+// writeEntry saves the archive in body, named name, to a temporary directory
+// and writes only its entry to dst, in the same way as writeFile. The archive
+// is verified against sum first, if not nil.
+func writeEntry(ctx context.Context, body io.Reader, extractor expand.EntryExtractor, name, entry, dst string, sum *checksum) (int64, error) {
+	tmpDir, err := os.MkdirTemp("", "http-archive-")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	archive := filepath.Join(tmpDir, name)
+	if _, err := writeFile(ctx, body, archive); err != nil {
+		return 0, err
+	}
+	if sum != nil {
+		if err := sum.check(ctx, archive); err != nil {
+			return 0, err
+		}
+	}
+	return writeAtomic(ctx, dst, func(w io.Writer) (int64, error) {
+		n, err := extractor.ExtractEntry(ctx, archive, entry, w)
+		if err != nil {
+			return n, fmt.Errorf("failed to extract %s from %s: %w", entry, name, err)
+		}
+		return n, nil
+	})
+}
+
+// writeAtomic writes dst with write through a temporary file, see writeFile.
+func writeAtomic(ctx context.Context, dst string, write func(io.Writer) (int64, error)) (int64, error) {
+	tmp, err := os.CreateTemp(filepath.Dir(dst), "."+filepath.Base(dst)+".*.tmp")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create destination file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	hook := faults.FromContext(ctx)
+	bytesWritten, err := write(faults.Writer(hook, dst, tmp))
+	if err != nil {
+		tmp.Close()
+		return 0, fmt.Errorf("failed to write to destination file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, fmt.Errorf("failed to write to destination file: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return 0, fmt.Errorf("failed to set destination file mode: %w", err)
+	}
+	if err := faults.Check(hook, faults.Rename, dst, 0); err != nil {
+		return 0, fmt.Errorf("failed to move download into place: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), dst); err != nil {
+		return 0, fmt.Errorf("failed to move download into place: %w", err)
+	}
+	return bytesWritten, nil
+}
+
+// HandlesGetterSyntax reports that the gatherer verifies downloads against
+// their "checksum" query parameter itself.
+func (h *HTTPGatherer) HandlesGetterSyntax(part string) bool {
+	return part == gather.GetterChecksum
+}
+
+// KeepsState reports whether the gatherer keeps state for dst, which it does
+// with Conditional or Resume set.
+func (h *HTTPGatherer) KeepsState(src, dst string) bool {
+	return h.Conditional || h.Resume
+}
+
+// StateFiles returns the names of the files the gatherer keeps next to dst:
+// the validators recorded by Conditional once a download succeeds, and the
+// partial download kept by Resume when it does not.
+func (h *HTTPGatherer) StateFiles(dst string) (gathered, unfinished []string) {
+	if h.Conditional {
+		gathered = append(gathered, filepath.Base(validatorsPath(dst)))
+	}
+	if h.Resume {
+		data, state := partialPaths(dst)
+		unfinished = append(unfinished, filepath.Base(data), filepath.Base(state))
+	}
+	return gathered, unfinished
+}
+
 func (h *HTTPGatherer) Matcher(uri string) bool {
-	prefixes := []string{"http://", "https://"}
+	// Object store endpoints are served by the gatherers of the stores,
+	// see FallbackMatcher
+	if cloud.Store(uri) != "" {
+		return false
+	}
+	return isHTTP(uri)
+}
+
+// FallbackMatcher accepts the HTTPS endpoints of object stores, such as
+// "https://storage.googleapis.com/bucket/object", when no gatherer of the
+// store is registered, downloading them as any other URL.
+func (h *HTTPGatherer) FallbackMatcher(uri string) bool {
+	return isHTTP(uri)
+}
+
+// isHTTP reports whether uri is an HTTP or HTTPS URL.
+func isHTTP(uri string) bool {
+	prefixes := []string{"http://", "https://", "http::http://", "http::https://"}
 	for _, prefix := range prefixes {
 		if strings.HasPrefix(uri, prefix) {
 			return true
@@ -158,6 +583,12 @@ func (h *HTTPMetadata) Get() interface{} {
 	return h
 }
 
+// Relocate updates Path for what was gathered having moved from from to
+// to.
+func (h *HTTPMetadata) Relocate(from, to string) {
+	h.Path = metadata.RelocatePath(h.Path, from, to)
+}
+
 func (h HTTPMetadata) GetPinnedURL(u string) (string, error) {
 	if len(u) == 0 {
 		return "", fmt.Errorf("empty URL")
@@ -168,6 +599,46 @@ func (h HTTPMetadata) GetPinnedURL(u string) (string, error) {
 	return "http::" + u, nil
 }
 
+// GetSizeReport returns the sizes of the files gathered.
+func (h HTTPMetadata) GetSizeReport() *metadata.SizeReport {
+	return h.Sizes
+}
+
+// GetSummary returns the summary of the download, pinned to the checksum
+// it was verified against, if any.
+func (h HTTPMetadata) GetSummary() metadata.Summary {
+	s := metadata.NewSummary("http", h.URI, h.Path, h.Timestamp, h.Sizes)
+	if h.Sizes == nil {
+		s.Files, s.Bytes = 1, h.Size
+	}
+	s.Revision = h.Checksum
+	if h.ResponseCode != 0 {
+		s.Detail("response_code", strconv.Itoa(h.ResponseCode))
+	}
+	s.Detail("entry", h.Entry)
+	s.Detail("resolved", h.Resolved)
+	if h.NotModified {
+		s.Detail("not_modified", "true")
+	}
+	return s
+}
+
+// GetSkipped returns the entries of a directory that were left out.
+func (h HTTPMetadata) GetSkipped() []metadata.SkippedEntry {
+	return h.Skipped
+}
+
+// statusError reports an unexpected response code, matching
+// gather.ErrAuthRequired when the server refused the credentials sent, or
+// asked for some.
+func statusError(code int) error {
+	err := fmt.Errorf("received non-200 response code: %d", code)
+	if code == http.StatusUnauthorized || code == http.StatusForbidden {
+		return fmt.Errorf("%w: %w", gather.ErrAuthRequired, err)
+	}
+	return err
+}
+
 func init() {
 	gather.RegisterGatherer(&HTTPGatherer{})
 }
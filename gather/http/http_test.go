@@ -17,14 +17,23 @@
 package http
 
 import (
+	"archive/zip"
+	"bytes"
 	"context"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
+
+	"github.com/enterprise-contract/go-gather/expand"
+	_ "github.com/enterprise-contract/go-gather/expand/zip" // Register zip expander
+	"github.com/enterprise-contract/go-gather/faults"
+	"github.com/enterprise-contract/go-gather/gather"
 )
 
 func TestHTTPGatherer_Matcher(t *testing.T) {
@@ -39,6 +48,10 @@ func TestHTTPGatherer_Matcher(t *testing.T) {
 		{"https scheme", "https://example.com/file.txt", true},
 		{"no scheme", "example.com/file.txt", false},
 		{"ftp scheme", "ftp://example.com/file.txt", false},
+		{"s3 virtual hosted", "https://bucket.s3.us-east-1.amazonaws.com/file.txt", false},
+		{"gcs endpoint", "https://storage.googleapis.com/bucket/file.txt", false},
+		{"azure endpoint", "https://account.blob.core.windows.net/container/file.txt", false},
+		{"forced getter", "http::https://example.com/file.txt", true},
 	}
 
 	for _, tc := range testCases {
@@ -51,6 +64,20 @@ func TestHTTPGatherer_Matcher(t *testing.T) {
 	}
 }
 
+func TestHTTPGatherer_FallbackMatcher(t *testing.T) {
+	g := &HTTPGatherer{}
+	for _, uri := range []string{"https://storage.googleapis.com/bucket/file.txt", "https://account.blob.core.windows.net/container/file.txt?sig=x", "https://example.com/file.txt"} {
+		if !g.FallbackMatcher(uri) {
+			t.Errorf("FallbackMatcher(%q) = false, want true", uri)
+		}
+	}
+	for _, uri := range []string{"gs://bucket/file.txt", "s3://bucket/file.txt"} {
+		if g.FallbackMatcher(uri) {
+			t.Errorf("FallbackMatcher(%q) = true, want false", uri)
+		}
+	}
+}
+
 func TestHTTPGatherer_Gather_Success(t *testing.T) {
 	testData := "Hello from test server!"
 	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -99,6 +126,57 @@ func TestHTTPGatherer_Gather_Success(t *testing.T) {
 	}
 }
 
+func TestHTTPGatherer_Gather_ArchiveEntry(t *testing.T) {
+	var archive bytes.Buffer
+	zw := zip.NewWriter(&archive)
+	for name, content := range map[string]string{"policy.rego": "package main", "lib/util.rego": "package lib"} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatalf("failed to create zip entry: %v", err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatalf("failed to write zip entry: %v", err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("failed to close zip: %v", err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/bundle.zip" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write(archive.Bytes())
+	}))
+	defer server.Close()
+
+	g := NewHTTPGatherer()
+	dst := t.TempDir() + "/"
+	src := server.URL + "/bundle.zip#lib/util.rego"
+	meta, err := g.Gather(context.Background(), src, dst)
+	if err != nil {
+		t.Fatalf("Gather returned unexpected error: %v", err)
+	}
+	content, err := os.ReadFile(filepath.Join(dst, "util.rego"))
+	if err != nil || string(content) != "package lib" {
+		t.Errorf("expected util.rego to hold the entry, got %q (%v)", content, err)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "bundle.zip")); !os.IsNotExist(err) {
+		t.Error("expected the archive not to be written to the destination")
+	}
+	m := meta.(*HTTPMetadata)
+	if m.URI != src || m.Entry != "lib/util.rego" || m.Size != int64(len("package lib")) {
+		t.Errorf("unexpected metadata: %+v", m)
+	}
+
+	if _, err := g.Gather(context.Background(), server.URL+"/bundle.zip#missing.rego", t.TempDir()+"/"); !errors.Is(err, expand.ErrEntryNotFound) {
+		t.Errorf("expected ErrEntryNotFound, got %v", err)
+	}
+	if _, err := g.Gather(context.Background(), server.URL+"/file.txt#entry", t.TempDir()+"/"); err == nil {
+		t.Error("expected an error selecting an entry of a file that is not an archive")
+	}
+}
+
 func TestHTTPGatherer_Gather_NoScheme(t *testing.T) {
 	g := NewHTTPGatherer()
 	ctx := context.Background()
@@ -132,6 +210,81 @@ func TestHTTPGatherer_Gather_NoPath(t *testing.T) {
 	}
 }
 
+type countingTransport struct {
+	calls int
+}
+
+func (c *countingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	c.calls++
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestHTTPGatherer_Gather_ClientTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("data"))
+	}))
+	defer server.Close()
+
+	transport := &countingTransport{}
+	g := &HTTPGatherer{Client: http.Client{Transport: transport}}
+	for i := 0; i < 2; i++ {
+		if _, err := g.Gather(context.Background(), server.URL+"/file.txt", filepath.Join(t.TempDir(), "file.txt")); err != nil {
+			t.Fatalf("Gather returned unexpected error: %v", err)
+		}
+	}
+	if transport.calls != 2 {
+		t.Errorf("expected the client transport to send 2 requests, got %d", transport.calls)
+	}
+	if g.Client.Transport != transport {
+		t.Errorf("expected the client transport to be left in place, got %T", g.Client.Transport)
+	}
+}
+
+func TestHTTPGatherer_Gather_Proxy(t *testing.T) {
+	var requested string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = r.URL.String()
+		_, _ = w.Write([]byte("data"))
+	}))
+	defer proxy.Close()
+
+	g := NewHTTPGatherer()
+	g.Proxy = proxy.URL
+	if _, err := g.Gather(context.Background(), "http://files.invalid/file.txt", filepath.Join(t.TempDir(), "file.txt")); err != nil {
+		t.Fatalf("Gather returned unexpected error: %v", err)
+	}
+	if requested != "http://files.invalid/file.txt" {
+		t.Errorf("expected the file to be requested through the proxy, got %q", requested)
+	}
+
+	g.Proxy = "files.invalid:3128"
+	if _, err := g.Gather(context.Background(), "http://files.invalid/file.txt", filepath.Join(t.TempDir(), "file.txt")); err == nil {
+		t.Error("expected an error for a proxy without a scheme")
+	}
+}
+
+func TestHTTPGatherer_Gather_RateLimit(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(make([]byte, 1500))
+	}))
+	defer server.Close()
+
+	g := NewHTTPGatherer()
+	g.RateLimit = 1000
+	start := time.Now()
+	m, err := g.Gather(context.Background(), server.URL+"/file.bin", filepath.Join(t.TempDir(), "file.bin"))
+	if err != nil {
+		t.Fatalf("Gather returned unexpected error: %v", err)
+	}
+	if size := m.(*HTTPMetadata).Size; size != 1500 {
+		t.Errorf("expected 1500 bytes, got %d", size)
+	}
+	// A second's worth is downloaded right away, the rest is throttled
+	if elapsed := time.Since(start); elapsed < 450*time.Millisecond {
+		t.Errorf("expected the download to be throttled, took %v", elapsed)
+	}
+}
+
 func TestHTTPGatherer_Gather_Non200(t *testing.T) {
 	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		http.NotFound(w, r)
@@ -151,6 +304,21 @@ func TestHTTPGatherer_Gather_Non200(t *testing.T) {
 	if !strings.Contains(err.Error(), "received non-200 response code") {
 		t.Errorf("expected error about non-200 response, got %v", err)
 	}
+	if errors.Is(err, gather.ErrAuthRequired) {
+		t.Errorf("expected a missing file not to ask for authentication, got %v", err)
+	}
+}
+
+func TestHTTPGatherer_Gather_AuthRequired(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	_, err := NewHTTPGatherer().Gather(context.Background(), server.URL+"/file.txt", filepath.Join(t.TempDir(), "file.txt"))
+	if !errors.Is(err, gather.ErrAuthRequired) {
+		t.Errorf("expected gather.ErrAuthRequired, got %v", err)
+	}
 }
 
 func TestHTTPGatherer_Gather_EmptyDirDestination(t *testing.T) {
@@ -214,3 +382,114 @@ func TestHTTPGatherer_Gather_CanceledContext(t *testing.T) {
 		t.Errorf("expected context to be canceled, got nil")
 	}
 }
+
+// failingHandler advertises a body of size bytes but sends only the first
+// half before dropping the connection, simulating a mid-stream failure.
+func failingHandler(size int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", strconv.Itoa(size))
+		_, _ = w.Write([]byte(strings.Repeat("x", size/2)))
+	}
+}
+
+func TestHTTPGatherer_Gather_MidStreamFailureLeavesNoPartialFile(t *testing.T) {
+	server := httptest.NewServer(failingHandler(1024))
+	defer server.Close()
+
+	g := NewHTTPGatherer()
+	tempDir := t.TempDir()
+	dest := filepath.Join(tempDir, "file.txt")
+
+	_, err := g.Gather(context.Background(), server.URL+"/file.txt", dest)
+	if err == nil {
+		t.Fatal("expected an error for truncated response, got nil")
+	}
+
+	if _, err := os.Stat(dest); !os.IsNotExist(err) {
+		t.Errorf("expected no file at %s after failed download, got err=%v", dest, err)
+	}
+	entries, err := os.ReadDir(tempDir)
+	if err != nil {
+		t.Fatalf("failed to read destination directory: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("expected no leftover temp files, found %d entries", len(entries))
+	}
+}
+
+func TestHTTPGatherer_Gather_RetryAfterFailureStartsFresh(t *testing.T) {
+	testData := "complete payload"
+	var calls int
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			failingHandler(64)(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(testData))
+	})
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	g := NewHTTPGatherer()
+	dest := filepath.Join(t.TempDir(), "file.txt")
+	if err := os.WriteFile(dest, []byte("previous content"), 0600); err != nil {
+		t.Fatalf("failed to seed destination: %v", err)
+	}
+
+	ctx := context.Background()
+	if _, err := g.Gather(ctx, server.URL+"/file.txt", dest); err == nil {
+		t.Fatal("expected first attempt to fail")
+	}
+	content, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatalf("failed to read destination: %v", err)
+	}
+	if string(content) != "previous content" {
+		t.Errorf("failed attempt modified destination: %q", string(content))
+	}
+
+	if _, err := g.Gather(ctx, server.URL+"/file.txt", dest); err != nil {
+		t.Fatalf("second attempt returned error: %v", err)
+	}
+	content, err = os.ReadFile(dest)
+	if err != nil {
+		t.Fatalf("failed to read destination: %v", err)
+	}
+	if string(content) != testData {
+		t.Errorf("expected content %q, got %q", testData, string(content))
+	}
+}
+
+func TestHTTPGatherer_Gather_InjectedFaults(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("complete payload"))
+	}))
+	defer server.Close()
+
+	for name, hook := range map[string]faults.Hook{
+		"after bytes": faults.AfterBytes(4),
+		"on rename":   faults.OnRename(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			dest := filepath.Join(tempDir, "file.txt")
+			ctx := faults.WithHook(context.Background(), faults.Once(hook))
+
+			_, err := NewHTTPGatherer().Gather(ctx, server.URL+"/file.txt", dest)
+			if !errors.Is(err, faults.ErrInjected) {
+				t.Fatalf("expected an injected fault, got %v", err)
+			}
+			if entries, _ := os.ReadDir(tempDir); len(entries) != 0 {
+				t.Errorf("expected no leftover files, found %d entries", len(entries))
+			}
+
+			if _, err := NewHTTPGatherer().Gather(ctx, server.URL+"/file.txt", dest); err != nil {
+				t.Fatalf("retry returned error: %v", err)
+			}
+			if content, _ := os.ReadFile(dest); string(content) != "complete payload" {
+				t.Errorf("unexpected content after retry: %q", content)
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package http
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+var (
+	// ErrRedirectForbidden is returned when a server redirects a request in
+	// a way the RedirectPolicy of the gatherer forbids.
+	ErrRedirectForbidden = errors.New("redirect forbidden")
+	// ErrHostNotAllowed is returned for requests to hosts that are not in
+	// RedirectPolicy.AllowedHosts.
+	ErrHostNotAllowed = errors.New("host not allowed")
+)
+
+// defaultMaxRedirects is the number of redirects followed by default, as by
+// http.Client.
+const defaultMaxRedirects = 10
+
+// RedirectPolicy controls which redirects are followed, and which hosts are
+// requested, so that a redirect can't send credentials to, or fetch content
+// from, an unexpected origin. The zero policy follows up to 10 redirects
+// anywhere, as http.Client does.
+type RedirectPolicy struct {
+	// MaxRedirects is the number of redirects followed, 10 when zero.
+	// Redirects are not followed at all when negative.
+	MaxRedirects int
+	// SameHost forbids redirects to another host than the one requested.
+	SameHost bool
+	// NoDowngrade forbids redirects from HTTPS to plain HTTP.
+	NoDowngrade bool
+	// AllowedHosts, when set, are the only hosts requested, be it the host
+	// of the source or one redirected to. A host is either a name, e.g.
+	// "example.com", or a wildcard matching its subdomains, e.g.
+	// "*.example.com". Ports are ignored.
+	AllowedHosts []string
+}
+
+// isZero reports whether p follows redirects as http.Client does.
+func (p RedirectPolicy) isZero() bool {
+	return p.MaxRedirects == 0 && !p.SameHost && !p.NoDowngrade && len(p.AllowedHosts) == 0
+}
+
+// allowed reports whether host, without its port, is in AllowedHosts, or
+// whether there is no allowlist.
+func (p RedirectPolicy) allowed(host string) bool {
+	if len(p.AllowedHosts) == 0 {
+		return true
+	}
+	host = strings.ToLower(host)
+	for _, a := range p.AllowedHosts {
+		a = strings.ToLower(a)
+		if suffix, ok := strings.CutPrefix(a, "*."); ok {
+			if strings.HasSuffix(host, "."+suffix) {
+				return true
+			}
+		} else if host == a {
+			return true
+		}
+	}
+	return false
+}
+
+// checkRedirect returns a http.Client.CheckRedirect function enforcing p,
+// before next, the client's own, if any.
+func (p RedirectPolicy) checkRedirect(next func(*http.Request, []*http.Request) error) func(*http.Request, []*http.Request) error {
+	limit := p.MaxRedirects
+	if limit == 0 {
+		limit = defaultMaxRedirects
+	}
+	return func(req *http.Request, via []*http.Request) error {
+		prev, first := via[len(via)-1], via[0]
+		switch {
+		case len(via) > limit:
+			return fmt.Errorf("%w: stopped after %d redirects", ErrRedirectForbidden, max(limit, 0))
+		case p.SameHost && !strings.EqualFold(req.URL.Hostname(), first.URL.Hostname()):
+			return fmt.Errorf("%w: from %s to another host, %s", ErrRedirectForbidden, first.URL.Hostname(), req.URL.Hostname())
+		case p.NoDowngrade && prev.URL.Scheme == "https" && req.URL.Scheme != "https":
+			return fmt.Errorf("%w: from HTTPS to %s", ErrRedirectForbidden, req.URL.Redacted())
+		}
+		if next != nil {
+			return next(req, via)
+		}
+		return nil
+	}
+}
+
+// allowlist rejects requests to hosts RedirectPolicy.AllowedHosts does not
+// allow, be they the first request or one redirected to.
+type allowlist struct {
+	base   http.RoundTripper
+	policy RedirectPolicy
+}
+
+func (a allowlist) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !a.policy.allowed(req.URL.Hostname()) {
+		if req.Body != nil {
+			_ = req.Body.Close()
+		}
+		return nil, fmt.Errorf("%w: %s", ErrHostNotAllowed, req.URL.Hostname())
+	}
+	return a.base.RoundTrip(req)
+}
+
+// forbidden reports whether err is due to the RedirectPolicy, which
+// retrying can't fix.
+func forbidden(err error) bool {
+	return errors.Is(err, ErrRedirectForbidden) || errors.Is(err, ErrHostNotAllowed)
+}
@@ -0,0 +1,134 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestHTTPGatherer_Gather_Redirects(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("data"))
+	}))
+	defer target.Close()
+	// 127.0.0.1 and localhost are the same server, but different hosts
+	other := strings.Replace(target.URL, "127.0.0.1", "localhost", 1)
+
+	var requests atomic.Int32
+	redirector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		switch r.URL.Path {
+		case "/same":
+			http.Redirect(w, r, "/final/file.txt", http.StatusFound)
+		case "/twice":
+			http.Redirect(w, r, "/same", http.StatusFound)
+		case "/other":
+			http.Redirect(w, r, other+"/file.txt", http.StatusFound)
+		case "/final/file.txt":
+			_, _ = w.Write([]byte("data"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer redirector.Close()
+
+	tests := []struct {
+		name    string
+		policy  RedirectPolicy
+		path    string
+		wantErr error
+	}{
+		{name: "default", path: "/other"},
+		{name: "within limit", policy: RedirectPolicy{MaxRedirects: 2}, path: "/twice"},
+		{name: "over limit", policy: RedirectPolicy{MaxRedirects: 1}, path: "/twice", wantErr: ErrRedirectForbidden},
+		{name: "no redirects", policy: RedirectPolicy{MaxRedirects: -1}, path: "/same", wantErr: ErrRedirectForbidden},
+		{name: "same host", policy: RedirectPolicy{SameHost: true}, path: "/same"},
+		{name: "other host", policy: RedirectPolicy{SameHost: true}, path: "/other", wantErr: ErrRedirectForbidden},
+		{name: "allowed hosts", policy: RedirectPolicy{AllowedHosts: []string{"127.0.0.1", "localhost"}}, path: "/other"},
+		{name: "host not allowed", policy: RedirectPolicy{AllowedHosts: []string{"127.0.0.1"}}, path: "/other", wantErr: ErrHostNotAllowed},
+		{name: "source not allowed", policy: RedirectPolicy{AllowedHosts: []string{"*.example.com"}}, path: "/same", wantErr: ErrHostNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewHTTPGatherer()
+			g.Redirects = tt.policy
+			g.Retry = RetryPolicy{MaxAttempts: 3}
+			requests.Store(0)
+			_, err := g.Gather(context.Background(), redirector.URL+tt.path, filepath.Join(t.TempDir(), "file.txt"))
+			if !errors.Is(err, tt.wantErr) || (err != nil) != (tt.wantErr != nil) {
+				t.Fatalf("Gather() error = %v, want %v", err, tt.wantErr)
+			}
+			// Requests forbidden by the policy are not retried
+			if n := requests.Load(); tt.wantErr != nil && n > 2 {
+				t.Errorf("expected the request not to be retried, got %d requests", n)
+			}
+		})
+	}
+}
+
+func TestRedirectPolicy_checkRedirect(t *testing.T) {
+	req := func(rawURL string) *http.Request {
+		r, err := http.NewRequest("GET", rawURL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+	p := RedirectPolicy{NoDowngrade: true}
+	check := p.checkRedirect(nil)
+	if err := check(req("http://example.com/b"), []*http.Request{req("https://example.com/a")}); !errors.Is(err, ErrRedirectForbidden) {
+		t.Errorf("expected a downgrade to be forbidden, got %v", err)
+	}
+	if err := check(req("https://example.com/b"), []*http.Request{req("http://example.com/a")}); err != nil {
+		t.Errorf("expected an upgrade to be allowed, got %v", err)
+	}
+
+	// The client's own check applies too
+	own := errors.New("own check")
+	check = p.checkRedirect(func(*http.Request, []*http.Request) error { return own })
+	if err := check(req("https://example.com/b"), []*http.Request{req("https://example.com/a")}); !errors.Is(err, own) {
+		t.Errorf("expected the client's check to apply, got %v", err)
+	}
+}
+
+func TestRedirectPolicy_allowed(t *testing.T) {
+	p := RedirectPolicy{AllowedHosts: []string{"example.com", "*.Example.org"}}
+	for host, want := range map[string]bool{
+		"example.com":         true,
+		"EXAMPLE.com":         true,
+		"www.example.com":     false,
+		"cdn.example.org":     true,
+		"a.b.example.org":     true,
+		"example.org":         false,
+		"evilexample.org":     false,
+		"example.com.evil.io": false,
+	} {
+		if got := p.allowed(host); got != want {
+			t.Errorf("allowed(%q) = %v, want %v", host, got, want)
+		}
+	}
+	if !(RedirectPolicy{}).allowed("anything.example.net") {
+		t.Error("expected every host to be allowed without an allowlist")
+	}
+}
@@ -0,0 +1,317 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// maxIndexSize bounds the pointer files and indexes read by the resolvers.
+const maxIndexSize = 1 << 20
+
+// Resolver resolves a source naming a symbolic version, such as
+// "https://example.com/policy/latest/policy.tar.gz", to the URL of the
+// artifact to download. Requests it sends should go through client with
+// header, which hold the transport and headers of the gatherer.
+type Resolver interface {
+	// Resolve returns the URL to download in place of src, or nil when src
+	// names no symbolic version.
+	Resolve(ctx context.Context, client *http.Client, header http.Header, src *url.URL) (*url.URL, error)
+}
+
+// ResolverFunc is a function used as a Resolver.
+type ResolverFunc func(ctx context.Context, client *http.Client, header http.Header, src *url.URL) (*url.URL, error)
+
+// Resolve calls f.
+func (f ResolverFunc) Resolve(ctx context.Context, client *http.Client, header http.Header, src *url.URL) (*url.URL, error) {
+	return f(ctx, client, header, src)
+}
+
+// PointerFile resolves Symbol, a segment of the source path, with the first
+// line of a file next to it, e.g. "latest" in
+// "https://example.com/policy/latest/policy.tar.gz" with the "v1.2.3" read
+// from "https://example.com/policy/latest.txt". A line holding an absolute
+// URL replaces the whole source instead.
+type PointerFile struct {
+	// Symbol is the path segment to resolve, "latest" when empty.
+	Symbol string
+	// Name is the URL of the pointer file, relative to the directory
+	// holding Symbol, Symbol with a ".txt" extension when empty.
+	Name string
+}
+
+// Resolve implements Resolver.
+func (p PointerFile) Resolve(ctx context.Context, client *http.Client, header http.Header, src *url.URL) (*url.URL, error) {
+	symbol := symbolOrLatest(p.Symbol)
+	name := p.Name
+	if name == "" {
+		name = symbol + ".txt"
+	}
+	return resolveSymbol(ctx, client, header, src, symbol, name, func(data []byte) (string, error) {
+		line, _, _ := strings.Cut(string(data), "\n")
+		return line, nil
+	})
+}
+
+// JSONIndex resolves Symbol, a segment of the source path, with a version,
+// file name or URL read from a JSON index next to it. The value at Field
+// is used as it is when it is a string. When it is an array, the newest
+// version it lists is used: its elements are either version strings, or
+// objects holding the version in their Version field and, optionally, the
+// URL of the artifact in their URL field. For instance, with Field
+// "releases" and URL "url", the index
+//
+//	{"releases": [{"version": "1.9.0", "url": "..."}, {"version": "1.10.0", "url": "..."}]}
+//
+// resolves to the URL of version 1.10.0. Values that are absolute URLs
+// replace the whole source rather than Symbol.
+type JSONIndex struct {
+	// Symbol is the path segment to resolve, "latest" when empty.
+	Symbol string
+	// Index is the URL of the index, relative to the directory holding
+	// Symbol, "index.json" when empty.
+	Index string
+	// Field is the dot-separated path of the value in the index, e.g.
+	// "channels.stable". The index itself is the value when empty.
+	Field string
+	// Version is the field of array elements holding their version,
+	// "version" when empty.
+	Version string
+	// URL is the field of array elements holding the URL of their
+	// artifact. The version is used when empty or missing.
+	URL string
+}
+
+// Resolve implements Resolver.
+func (j JSONIndex) Resolve(ctx context.Context, client *http.Client, header http.Header, src *url.URL) (*url.URL, error) {
+	index := j.Index
+	if index == "" {
+		index = "index.json"
+	}
+	return resolveSymbol(ctx, client, header, src, symbolOrLatest(j.Symbol), index, j.pick)
+}
+
+// pick returns the value selected by j in the index data.
+func (j JSONIndex) pick(data []byte) (string, error) {
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return "", fmt.Errorf("invalid index: %w", err)
+	}
+	if j.Field != "" {
+		for _, key := range strings.Split(j.Field, ".") {
+			obj, ok := v.(map[string]any)
+			if !ok {
+				return "", fmt.Errorf("no %q field in the index", j.Field)
+			}
+			if v, ok = obj[key]; !ok {
+				return "", fmt.Errorf("no %q field in the index", j.Field)
+			}
+		}
+	}
+
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case []any:
+		versionField := j.Version
+		if versionField == "" {
+			versionField = "version"
+		}
+		var newest, value string
+		for _, e := range v {
+			var version, u string
+			switch e := e.(type) {
+			case string:
+				version = e
+			case map[string]any:
+				version, _ = e[versionField].(string)
+				if j.URL != "" {
+					u, _ = e[j.URL].(string)
+				}
+			}
+			if version == "" {
+				continue
+			}
+			if newest == "" || compareVersions(version, newest) > 0 {
+				newest, value = version, version
+				if u != "" {
+					value = u
+				}
+			}
+		}
+		if newest == "" {
+			return "", errors.New("no versions listed in the index")
+		}
+		return value, nil
+	}
+	return "", fmt.Errorf("the %q field of the index is neither a string nor an array", j.Field)
+}
+
+func symbolOrLatest(symbol string) string {
+	if symbol == "" {
+		return "latest"
+	}
+	return symbol
+}
+
+// resolveSymbol replaces the first segment of the path of src equal to
+// symbol with the value pick finds in the file name, relative to the
+// directory holding the segment. It returns nil when src has no such
+// segment.
+func resolveSymbol(ctx context.Context, client *http.Client, header http.Header, src *url.URL, symbol, name string, pick func([]byte) (string, error)) (*url.URL, error) {
+	segments := strings.Split(src.Path, "/")
+	i := -1
+	for n, s := range segments {
+		if s == symbol {
+			i = n
+			break
+		}
+	}
+	if i < 0 {
+		return nil, nil
+	}
+
+	ref, err := url.Parse(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid index URL %q: %w", name, err)
+	}
+	dir := &url.URL{Scheme: src.Scheme, User: src.User, Host: src.Host, Path: strings.Join(segments[:i], "/") + "/"}
+	index := dir.ResolveReference(ref)
+
+	data, err := fetchIndex(ctx, client, header, index)
+	if err != nil {
+		return nil, err
+	}
+	value, err := pick(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", index.Redacted(), err)
+	}
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, fmt.Errorf("%s: no version found", index.Redacted())
+	}
+
+	resolved := *src
+	resolved.RawPath = ""
+	if u, err := url.Parse(value); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+		// The query and fragment of the source, e.g. a checksum or an
+		// archive entry, apply to the artifact it resolves to
+		resolved.Scheme, resolved.User, resolved.Host, resolved.Path = u.Scheme, u.User, u.Host, u.Path
+		if u.RawQuery != "" {
+			resolved.RawQuery = u.RawQuery
+		}
+		return &resolved, nil
+	}
+	for _, s := range strings.Split(value, "/") {
+		if s == "" || s == "." || s == ".." {
+			return nil, fmt.Errorf("%s: invalid version %q", index.Redacted(), value)
+		}
+	}
+	segments[i] = value
+	resolved.Path = strings.Join(segments, "/")
+	return &resolved, nil
+}
+
+// fetchIndex downloads the pointer file or index at u.
+func fetchIndex(ctx context.Context, client *http.Client, header http.Header, u *url.URL) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create index request: %w", err)
+	}
+	req.Header = header.Clone()
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download index: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download index %s: received response code %d", u.Redacted(), resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxIndexSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read index: %w", err)
+	}
+	if len(data) > maxIndexSize {
+		return nil, fmt.Errorf("index %s is larger than %d bytes", u.Redacted(), maxIndexSize)
+	}
+	return data, nil
+}
+
+// compareVersions compares the versions a and b, returning a negative
+// number when a is older, a positive one when it is newer and zero when they
+// are equal. A leading "v" and "+" build metadata are ignored, runs of
+// digits compare as numbers and a pre-release, after a "-", is older than
+// its release, so that "v1.10.0" is newer than "1.9.0" and "1.0.0-rc.1".
+func compareVersions(a, b string) int {
+	a, _, _ = strings.Cut(strings.TrimPrefix(a, "v"), "+")
+	b, _, _ = strings.Cut(strings.TrimPrefix(b, "v"), "+")
+	aRelease, aPre, aIsPre := strings.Cut(a, "-")
+	bRelease, bPre, bIsPre := strings.Cut(b, "-")
+	if c := compareNatural(aRelease, bRelease); c != 0 {
+		return c
+	}
+	switch {
+	case aIsPre && !bIsPre:
+		return -1
+	case !aIsPre && bIsPre:
+		return 1
+	}
+	return compareNatural(aPre, bPre)
+}
+
+// compareNatural compares a and b with runs of digits compared as numbers.
+func compareNatural(a, b string) int {
+	for a != "" && b != "" {
+		aToken, aNum := nextToken(a)
+		bToken, bNum := nextToken(b)
+		a, b = a[len(aToken):], b[len(bToken):]
+		if aNum && bNum {
+			x, _ := strconv.ParseUint(aToken, 10, 64)
+			y, _ := strconv.ParseUint(bToken, 10, 64)
+			if x != y {
+				if x < y {
+					return -1
+				}
+				return 1
+			}
+			continue
+		}
+		if c := strings.Compare(aToken, bToken); c != 0 {
+			return c
+		}
+	}
+	return len(a) - len(b)
+}
+
+// nextToken returns the leading run of s made of digits, or of other
+// characters, and whether it is made of digits.
+func nextToken(s string) (string, bool) {
+	digit := s[0] >= '0' && s[0] <= '9'
+	n := 1
+	for n < len(s) && (s[n] >= '0' && s[n] <= '9') == digit {
+		n++
+	}
+	return s[:n], digit
+}
@@ -0,0 +1,166 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package http
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHTTPGatherer_Gather_PointerFile(t *testing.T) {
+	var auth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/policy/latest.txt":
+			auth = r.Header.Get("Authorization")
+			_, _ = w.Write([]byte("v1.2.3\n"))
+		case "/policy/v1.2.3/policy.rego":
+			_, _ = w.Write([]byte("package v123"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	g := NewHTTPGatherer()
+	g.BearerToken = "secret"
+	g.Resolver = PointerFile{}
+	dst := filepath.Join(t.TempDir(), "policy.rego")
+	m, err := g.Gather(context.Background(), server.URL+"/policy/latest/policy.rego", dst)
+	if err != nil {
+		t.Fatalf("Gather returned unexpected error: %v", err)
+	}
+	if b, _ := os.ReadFile(dst); string(b) != "package v123" {
+		t.Errorf("unexpected content %q", b)
+	}
+	meta := m.(*HTTPMetadata)
+	if meta.URI != server.URL+"/policy/latest/policy.rego" || meta.Resolved != server.URL+"/policy/v1.2.3/policy.rego" {
+		t.Errorf("unexpected metadata: %+v", meta)
+	}
+	if auth != "Bearer secret" {
+		t.Errorf("expected the pointer file request to be authenticated, got %q", auth)
+	}
+
+	// Sources without the symbol are downloaded as they are
+	m, err = g.Gather(context.Background(), server.URL+"/policy/v1.2.3/policy.rego", dst)
+	if err != nil {
+		t.Fatalf("Gather returned unexpected error: %v", err)
+	}
+	if resolved := m.(*HTTPMetadata).Resolved; resolved != "" {
+		t.Errorf("expected no resolution, got %q", resolved)
+	}
+}
+
+func TestHTTPGatherer_Gather_ResolveError(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	g := NewHTTPGatherer()
+	g.Resolver = PointerFile{}
+	_, err := g.Gather(context.Background(), server.URL+"/policy/latest/policy.rego", filepath.Join(t.TempDir(), "policy.rego"))
+	if err == nil || !strings.Contains(err.Error(), "failed to resolve") {
+		t.Errorf("expected a resolution error, got %v", err)
+	}
+}
+
+func TestResolvers(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		files := map[string]string{
+			"/a/latest.txt":    "https://cdn.example.com/a/bundle.tar.gz",
+			"/b/stable.txt":    "2.0\n",
+			"/c/latest.txt":    "../escape",
+			"/d/index.json":    `{"channels": {"stable": "v3"}}`,
+			"/e/index.json":    `["1.9.0", "v1.10.0", "1.10.0-rc.1", "1.2"]`,
+			"/f/releases.json": `{"releases": [{"version": "1.0.0", "url": "https://cdn.example.com/1.0.0.tgz"}, {"version": "1.1.0", "url": "https://cdn.example.com/1.1.0.tgz?x=1"}]}`,
+			"/g/index.json":    `{"releases": []}`,
+		}
+		if content, ok := files[r.URL.Path]; ok {
+			_, _ = w.Write([]byte(content))
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		resolver Resolver
+		src      string
+		want     string
+		wantErr  bool
+	}{
+		{name: "no symbol", resolver: PointerFile{}, src: "/a/1.0/bundle.tar.gz", want: ""},
+		{name: "absolute url", resolver: PointerFile{}, src: "/a/latest/bundle.tar.gz?checksum=sha256:00#policy.rego", want: "https://cdn.example.com/a/bundle.tar.gz?checksum=sha256:00#policy.rego"},
+		{name: "custom symbol", resolver: PointerFile{Symbol: "stable"}, src: "/b/stable/x.rego", want: server.URL + "/b/2.0/x.rego"},
+		{name: "path traversal", resolver: PointerFile{}, src: "/c/latest/x.rego", wantErr: true},
+		{name: "missing pointer", resolver: PointerFile{Name: "missing.txt"}, src: "/a/latest/x.rego", wantErr: true},
+		{name: "json field", resolver: JSONIndex{Field: "channels.stable"}, src: "/d/latest/x.rego", want: server.URL + "/d/v3/x.rego"},
+		{name: "json versions", resolver: JSONIndex{}, src: "/e/latest/x.rego", want: server.URL + "/e/v1.10.0/x.rego"},
+		{name: "json objects", resolver: JSONIndex{Index: "releases.json", Field: "releases", URL: "url"}, src: "/f/latest", want: "https://cdn.example.com/1.1.0.tgz?x=1"},
+		{name: "json missing field", resolver: JSONIndex{Field: "channels.beta"}, src: "/d/latest/x.rego", wantErr: true},
+		{name: "json no versions", resolver: JSONIndex{Field: "releases"}, src: "/g/latest/x.rego", wantErr: true},
+		{name: "func", resolver: ResolverFunc(func(ctx context.Context, client *http.Client, header http.Header, src *url.URL) (*url.URL, error) {
+			return src.JoinPath("resolved"), nil
+		}), src: "/h", want: server.URL + "/h/resolved"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, err := url.Parse(server.URL + tt.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := tt.resolver.Resolve(context.Background(), server.Client(), http.Header{}, src)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Resolve() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var gotURL string
+			if got != nil {
+				gotURL = got.String()
+			}
+			if gotURL != tt.want {
+				t.Errorf("Resolve() = %q, want %q", gotURL, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.10.0", "1.9.0", 1},
+		{"v1.2.3", "1.2.3", 0},
+		{"1.0.0", "1.0.0-rc.1", 1},
+		{"1.0.0-rc.2", "1.0.0-rc.10", -1},
+		{"1.2", "1.2.1", -1},
+		{"2024.01.15", "2023.12.31", 1},
+		{"1.0.0+build.2", "1.0.0+build.1", 0},
+	}
+	for _, tt := range tests {
+		got := compareVersions(tt.a, tt.b)
+		if (got > 0) != (tt.want > 0) || (got < 0) != (tt.want < 0) {
+			t.Errorf("compareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/enterprise-contract/go-gather/faults"
+	"github.com/enterprise-contract/go-gather/internal/multierr"
+)
+
+// partialState records what a partial download kept next to its
+// destination is a part of, so that it is only resumed from the same
+// resource.
+type partialState struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+// validator returns the value of the If-Range header resuming the download,
+// empty when the resource cannot be told apart from a changed one. Weak
+// entity tags are not allowed in If-Range.
+func (s partialState) validator() string {
+	if s.ETag != "" && !strings.HasPrefix(s.ETag, "W/") {
+		return s.ETag
+	}
+	return s.LastModified
+}
+
+// partialPaths returns the paths of the partial download of dst and of its
+// state.
+func partialPaths(dst string) (string, string) {
+	data := filepath.Join(filepath.Dir(dst), "."+filepath.Base(dst)+".partial")
+	return data, data + ".json"
+}
+
+// removePartial removes the partial download of dst, if any.
+func removePartial(dst string) {
+	data, state := partialPaths(dst)
+	os.Remove(data)
+	os.Remove(state)
+}
+
+// resumeRequest returns req asking for the rest of the partial download of
+// dst from url, and the offset it resumes from, or req itself and zero when
+// there is nothing to resume.
+func resumeRequest(req *http.Request, url, dst string) (*http.Request, int64) {
+	data, state := partialPaths(dst)
+	b, err := os.ReadFile(state)
+	if err != nil {
+		return req, 0
+	}
+	var s partialState
+	if err := json.Unmarshal(b, &s); err != nil || s.URL != url || s.validator() == "" {
+		return req, 0
+	}
+	fi, err := os.Stat(data)
+	if err != nil || fi.Size() == 0 {
+		return req, 0
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-", fi.Size()))
+	req.Header.Set("If-Range", s.validator())
+	return req, fi.Size()
+}
+
+// contentRangeStart returns the first byte of a Content-Range header value,
+// e.g. "bytes 100-199/200".
+func contentRangeStart(v string) (int64, error) {
+	r, ok := strings.CutPrefix(v, "bytes ")
+	if !ok {
+		return 0, fmt.Errorf("unsupported content range %q", v)
+	}
+	start, _, ok := strings.Cut(r, "-")
+	if !ok {
+		return 0, fmt.Errorf("invalid content range %q", v)
+	}
+	return strconv.ParseInt(start, 10, 64)
+}
+
+// errRangeMismatch is returned when a server answers a range request with
+// another range than the one asked for.
+var errRangeMismatch = errors.New("server returned another range than requested")
+
+// writeResumable writes body, the response resp to a request for url, to
+// dst through its partial download. A partial content response is appended
+// to what was downloaded before, from offset; any other one replaces it. A
+// transfer broken off leaves the partial download in place to be resumed.
+// It returns the size of dst and the offset the download was resumed from.
+func writeResumable(ctx context.Context, resp *http.Response, body io.Reader, url, dst string, offset int64) (int64, int64, error) {
+	data, state := partialPaths(dst)
+	flags := os.O_CREATE | os.O_WRONLY
+	if resp.StatusCode == http.StatusPartialContent {
+		start, err := contentRangeStart(resp.Header.Get("Content-Range"))
+		if err != nil || start != offset {
+			removePartial(dst)
+			return 0, 0, fmt.Errorf("failed to resume download at byte %d: %w", offset, multierr.Append(multierr.Errors{errRangeMismatch}, err))
+		}
+		flags |= os.O_APPEND
+	} else {
+		offset = 0
+		flags |= os.O_TRUNC
+		b, err := json.Marshal(partialState{
+			URL:          url,
+			ETag:         resp.Header.Get("ETag"),
+			LastModified: resp.Header.Get("Last-Modified"),
+		})
+		if err != nil {
+			return 0, 0, err
+		}
+		if err := os.WriteFile(state, b, 0600); err != nil {
+			return 0, 0, fmt.Errorf("failed to create destination file: %w", err)
+		}
+	}
+
+	f, err := os.OpenFile(data, flags, 0600)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to create destination file: %w", err)
+	}
+	hook := faults.FromContext(ctx)
+	n, err := io.Copy(faults.Writer(hook, dst, f), body)
+	if err != nil {
+		f.Close()
+		return 0, 0, fmt.Errorf("failed to write to destination file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return 0, 0, fmt.Errorf("failed to write to destination file: %w", err)
+	}
+	if err := os.Chmod(data, 0644); err != nil {
+		return 0, 0, fmt.Errorf("failed to set destination file mode: %w", err)
+	}
+	if err := faults.Check(hook, faults.Rename, dst, 0); err != nil {
+		return 0, 0, fmt.Errorf("failed to move download into place: %w", err)
+	}
+	if err := os.Rename(data, dst); err != nil {
+		return 0, 0, fmt.Errorf("failed to move download into place: %w", err)
+	}
+	os.Remove(state)
+	return offset + n, offset, nil
+}
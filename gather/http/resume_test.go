@@ -0,0 +1,169 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package http
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// resumableServer serves content with etag, breaking off the transfer of
+// the first breaks responses halfway. It records the Range headers of the
+// requests.
+type resumableServer struct {
+	content []byte
+	etag    string
+	breaks  int
+	ranges  []string
+}
+
+func (s *resumableServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.ranges = append(s.ranges, r.Header.Get("Range"))
+	w.Header().Set("ETag", s.etag)
+	if s.breaks > 0 {
+		s.breaks--
+		w.Header().Set("Content-Length", strconv.Itoa(len(s.content)))
+		_, _ = w.Write(s.content[:len(s.content)/2])
+		return
+	}
+	http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(s.content))
+}
+
+func TestHTTPGatherer_Gather_Resume(t *testing.T) {
+	content := []byte(strings.Repeat("0123456789", 1000))
+
+	t.Run("retry", func(t *testing.T) {
+		s := &resumableServer{content: content, etag: `"v1"`, breaks: 1}
+		server := httptest.NewServer(s)
+		defer server.Close()
+
+		g := NewHTTPGatherer()
+		g.Resume = true
+		g.Retry = RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond}
+		dest := filepath.Join(t.TempDir(), "file.bin")
+		meta, err := g.Gather(context.Background(), server.URL+"/file.bin", dest)
+		if err != nil {
+			t.Fatalf("Gather returned unexpected error: %v", err)
+		}
+		got, err := os.ReadFile(dest)
+		if err != nil || !bytes.Equal(got, content) {
+			t.Fatalf("expected the complete content, got %d bytes, %v", len(got), err)
+		}
+		m := meta.(*HTTPMetadata)
+		if m.ResumedFrom != int64(len(content)/2) || m.ResponseCode != http.StatusPartialContent || m.Size != int64(len(content)) {
+			t.Errorf("expected a download resumed from %d, got %+v", len(content)/2, m)
+		}
+		if want := "bytes=5000-"; len(s.ranges) != 2 || s.ranges[1] != want {
+			t.Errorf("expected the retry to ask for %s, got %q", want, s.ranges)
+		}
+		data, state := partialPaths(dest)
+		for _, p := range []string{data, state} {
+			if _, err := os.Stat(p); !os.IsNotExist(err) {
+				t.Errorf("expected %s to be removed, got %v", p, err)
+			}
+		}
+	})
+
+	t.Run("gather again", func(t *testing.T) {
+		s := &resumableServer{content: content, etag: `"v1"`, breaks: 1}
+		server := httptest.NewServer(s)
+		defer server.Close()
+
+		g := NewHTTPGatherer()
+		g.Resume = true
+		dest := filepath.Join(t.TempDir(), "file.bin")
+		if _, err := g.Gather(context.Background(), server.URL+"/file.bin", dest); err == nil {
+			t.Fatal("expected the first gather to fail")
+		}
+		if _, err := os.Stat(dest); !os.IsNotExist(err) {
+			t.Errorf("expected no file at the destination, got %v", err)
+		}
+		meta, err := g.Gather(context.Background(), server.URL+"/file.bin", dest)
+		if err != nil {
+			t.Fatalf("Gather returned unexpected error: %v", err)
+		}
+		got, _ := os.ReadFile(dest)
+		if !bytes.Equal(got, content) {
+			t.Errorf("expected the complete content, got %d bytes", len(got))
+		}
+		if m := meta.(*HTTPMetadata); m.ResumedFrom != int64(len(content)/2) {
+			t.Errorf("expected the download to be resumed, got %+v", m)
+		}
+	})
+
+	t.Run("changed", func(t *testing.T) {
+		s := &resumableServer{content: content, etag: `"v1"`, breaks: 1}
+		server := httptest.NewServer(s)
+		defer server.Close()
+
+		g := NewHTTPGatherer()
+		g.Resume = true
+		dest := filepath.Join(t.TempDir(), "file.bin")
+		if _, err := g.Gather(context.Background(), server.URL+"/file.bin", dest); err == nil {
+			t.Fatal("expected the first gather to fail")
+		}
+		changed := bytes.ToUpper(bytes.Repeat([]byte("abcdefghij"), 1000))
+		s.content, s.etag = changed, `"v2"`
+		meta, err := g.Gather(context.Background(), server.URL+"/file.bin", dest)
+		if err != nil {
+			t.Fatalf("Gather returned unexpected error: %v", err)
+		}
+		got, _ := os.ReadFile(dest)
+		if !bytes.Equal(got, changed) {
+			t.Errorf("expected the changed content, got %q…", got[:10])
+		}
+		if m := meta.(*HTTPMetadata); m.ResumedFrom != 0 || m.ResponseCode != http.StatusOK {
+			t.Errorf("expected the download to restart, got %+v", m)
+		}
+	})
+
+	t.Run("no validator", func(t *testing.T) {
+		s := &resumableServer{content: content, breaks: 1}
+		server := httptest.NewServer(s)
+		defer server.Close()
+
+		g := NewHTTPGatherer()
+		g.Resume = true
+		g.Retry = RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond}
+		dest := filepath.Join(t.TempDir(), "file.bin")
+		if _, err := g.Gather(context.Background(), server.URL+"/file.bin", dest); err != nil {
+			t.Fatalf("Gather returned unexpected error: %v", err)
+		}
+		if len(s.ranges) != 2 || s.ranges[1] != "" {
+			t.Errorf("expected the retry to restart, got %q", s.ranges)
+		}
+	})
+}
+
+func TestContentRangeStart(t *testing.T) {
+	if got, err := contentRangeStart("bytes 100-199/200"); err != nil || got != 100 {
+		t.Errorf("contentRangeStart() = %d, %v", got, err)
+	}
+	for _, v := range []string{"", "items 1-2/3", "bytes */200"} {
+		if _, err := contentRangeStart(v); err == nil {
+			t.Errorf("expected an error for %q", v)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package http
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/enterprise-contract/go-gather/internal/logging"
+	"github.com/enterprise-contract/go-gather/internal/metrics"
+	"github.com/enterprise-contract/go-gather/internal/provider"
+)
+
+// RetryPolicy configures how downloads failing for transient reasons are
+// retried: connection errors, including those breaking off a transfer, and
+// responses with a retryable status code. With HTTPGatherer.Resume set, a
+// retry asks for the rest of a transfer that broke off with a Range request
+// and appends it to what was downloaded before; otherwise, or when the
+// server does not honour the range, the file is downloaded from the start.
+// The zero value does not retry.
+type RetryPolicy struct {
+	// MaxAttempts is the number of times a download is attempted, the
+	// first attempt included.
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry, doubled for each
+	// retry after it. It defaults to one second.
+	InitialBackoff time.Duration
+	// MaxBackoff bounds the delay between attempts, including a longer
+	// delay asked for with a Retry-After header. It defaults to 30 seconds.
+	MaxBackoff time.Duration
+	// StatusCodes are the response codes retried. They default to 408, 429,
+	// 500, 502, 503 and 504.
+	StatusCodes []int
+}
+
+// defaultRetryStatusCodes are the status codes retried by default.
+var defaultRetryStatusCodes = []int{
+	http.StatusRequestTimeout,
+	http.StatusTooManyRequests,
+	http.StatusInternalServerError,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// jitter returns a random number in [0, 1) spreading out the retries of
+// concurrent downloads.
+var jitter = rand.Float64
+
+// retryable reports whether a response with status code should be retried.
+func (p RetryPolicy) retryable(code int) bool {
+	codes := p.StatusCodes
+	if codes == nil {
+		codes = defaultRetryStatusCodes
+	}
+	return slices.Contains(codes, code)
+}
+
+// backoff returns the delay before attempt n+1, at least after when the
+// server asked for it.
+func (p RetryPolicy) backoff(n int, after time.Duration) time.Duration {
+	initial, limit := p.InitialBackoff, p.MaxBackoff
+	if initial <= 0 {
+		initial = time.Second
+	}
+	if limit <= 0 {
+		limit = 30 * time.Second
+	}
+	wait := limit
+	if n < 32 && initial<<(n-1) < limit {
+		wait = initial << (n - 1)
+	}
+	// Equal jitter: half the delay is fixed, the other half random
+	wait = wait/2 + time.Duration(jitter()*float64(wait/2))
+	return min(max(wait, after), limit)
+}
+
+// do calls attempt until it succeeds, fails with an error it reports as not
+// retryable, or the attempts are exhausted. attempt also returns the delay
+// the server asked for, if any. do returns the number of attempts made.
+func (p RetryPolicy) do(ctx context.Context, attempt func() (retry bool, after time.Duration, err error)) (int, error) {
+	for n := 1; ; n++ {
+		retry, after, err := attempt()
+		if err == nil || !retry || n >= p.MaxAttempts || ctx.Err() != nil {
+			return n, err
+		}
+		wait := p.backoff(n, after)
+		logging.Debug(ctx, "retrying request", "attempt", n, "delay", wait, "error", err)
+		metrics.Retried(ctx)
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return n, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// retryAfter returns the delay asked for by the Retry-After header of resp,
+// zero if there is none.
+func retryAfter(resp *http.Response) time.Duration {
+	d, _ := provider.ParseRetryAfter(resp.Header.Get("Retry-After"))
+	return d
+}
+
+// bodyReader records the error reading a response body, telling a transfer
+// broken off apart from a failure to write it.
+type bodyReader struct {
+	r   io.Reader
+	err error
+}
+
+func (b *bodyReader) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	if err != nil && err != io.EOF {
+		b.err = err
+	}
+	return n, err
+}
@@ -0,0 +1,173 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicy_backoff(t *testing.T) {
+	oldJitter := jitter
+	defer func() { jitter = oldJitter }()
+	jitter = func() float64 { return 1 }
+
+	p := RetryPolicy{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second}
+	tests := []struct {
+		n     int
+		after time.Duration
+		want  time.Duration
+	}{
+		{1, 0, time.Second},
+		{2, 0, 2 * time.Second},
+		{3, 0, 4 * time.Second},
+		{4, 0, 5 * time.Second},
+		{64, 0, 5 * time.Second},
+		{1, 3 * time.Second, 3 * time.Second},
+		{1, time.Minute, 5 * time.Second},
+	}
+	for _, tt := range tests {
+		if got := p.backoff(tt.n, tt.after); got != tt.want {
+			t.Errorf("backoff(%d, %s) = %s, want %s", tt.n, tt.after, got, tt.want)
+		}
+	}
+
+	jitter = func() float64 { return 0 }
+	if got := p.backoff(2, 0); got != time.Second {
+		t.Errorf("expected half the delay without jitter, got %s", got)
+	}
+}
+
+func TestRetryPolicy_retryable(t *testing.T) {
+	if !(RetryPolicy{}).retryable(http.StatusServiceUnavailable) {
+		t.Error("expected 503 to be retried by default")
+	}
+	if (RetryPolicy{}).retryable(http.StatusNotFound) {
+		t.Error("expected 404 not to be retried by default")
+	}
+	p := RetryPolicy{StatusCodes: []int{http.StatusNotFound}}
+	if !p.retryable(http.StatusNotFound) || p.retryable(http.StatusServiceUnavailable) {
+		t.Error("expected only the configured status codes to be retried")
+	}
+}
+
+func TestHTTPGatherer_Gather_Retry(t *testing.T) {
+	testData := "complete payload"
+	tests := []struct {
+		name     string
+		failures []http.HandlerFunc
+		attempts int
+		wantErr  string
+	}{
+		{
+			name: "service unavailable",
+			failures: []http.HandlerFunc{func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}},
+			attempts: 3,
+		},
+		{
+			name:     "broken transfer",
+			failures: []http.HandlerFunc{failingHandler(1024), failingHandler(1024)},
+			attempts: 3,
+		},
+		{
+			name: "not found",
+			failures: []http.HandlerFunc{func(w http.ResponseWriter, r *http.Request) {
+				http.NotFound(w, r)
+			}},
+			attempts: 3,
+			wantErr:  "received non-200 response code: 404",
+		},
+		{
+			name: "attempts exhausted",
+			failures: []http.HandlerFunc{
+				func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusBadGateway) },
+				func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusBadGateway) },
+			},
+			attempts: 2,
+			wantErr:  "received non-200 response code: 502",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				if calls <= len(tt.failures) {
+					tt.failures[calls-1](w, r)
+					return
+				}
+				_, _ = w.Write([]byte(testData))
+			}))
+			defer server.Close()
+
+			g := NewHTTPGatherer()
+			g.Retry = RetryPolicy{MaxAttempts: tt.attempts, InitialBackoff: time.Millisecond}
+			dest := filepath.Join(t.TempDir(), "file.txt")
+			meta, err := g.Gather(context.Background(), server.URL+"/file.txt", dest)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected an error containing %q, got %v", tt.wantErr, err)
+				}
+				if _, err := os.Stat(dest); !os.IsNotExist(err) {
+					t.Errorf("expected no file at the destination, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Gather returned unexpected error: %v", err)
+			}
+			content, err := os.ReadFile(dest)
+			if err != nil || string(content) != testData {
+				t.Errorf("expected content %q, got %q, %v", testData, content, err)
+			}
+			if got := meta.(*HTTPMetadata).Attempts; got != len(tt.failures)+1 {
+				t.Errorf("expected %d attempts, got %d", len(tt.failures)+1, got)
+			}
+		})
+	}
+}
+
+func TestHTTPGatherer_Gather_RetryCanceled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	g := NewHTTPGatherer()
+	g.Retry = RetryPolicy{MaxAttempts: 5, MaxBackoff: time.Minute}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := g.Gather(ctx, server.URL+"/file.txt", filepath.Join(t.TempDir(), "file.txt"))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected the deadline to end the retries, got %v", err)
+	}
+	if time.Since(start) > 10*time.Second {
+		t.Error("expected the retries to stop when the context is done")
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package http
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// TLSOptions configure how the servers are authenticated, and how the
+// gatherer authenticates to them, e.g. for artifact servers with
+// internally-signed certificates or requiring mutual TLS.
+type TLSOptions struct {
+	// RootCAs, when set, are the only certificate authorities the servers
+	// are verified against, in place of the system roots.
+	RootCAs *x509.CertPool
+	// CACerts are PEM encoded certificates trusted in addition to the
+	// system roots, or to RootCAs when set, e.g. an internal CA bundle.
+	CACerts []byte
+	// ClientCert and ClientKey are the PEM encoded certificate, optionally
+	// followed by its intermediates, and private key presented to servers
+	// asking for a client certificate.
+	ClientCert []byte
+	ClientKey  []byte
+	// InsecureSkipVerify accepts any certificate the servers present.
+	InsecureSkipVerify bool
+}
+
+// IsZero reports whether no TLS options are set.
+func (o TLSOptions) IsZero() bool {
+	return o.RootCAs == nil && len(o.CACerts) == 0 && len(o.ClientCert) == 0 && len(o.ClientKey) == 0 && !o.InsecureSkipVerify
+}
+
+// transport returns base configured with the TLS settings of o. Only an
+// *http.Transport can be configured.
+func (o TLSOptions) transport(base http.RoundTripper) (http.RoundTripper, error) {
+	if o.IsZero() {
+		return base, nil
+	}
+	t, ok := base.(*http.Transport)
+	if !ok {
+		return nil, errors.New("TLS options need Transport to be an *http.Transport")
+	}
+	t = t.Clone()
+	if t.TLSClientConfig == nil {
+		t.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	t.TLSClientConfig.InsecureSkipVerify = o.InsecureSkipVerify
+
+	pool := o.RootCAs
+	if len(o.CACerts) > 0 {
+		if pool == nil {
+			var err error
+			if pool, err = x509.SystemCertPool(); err != nil {
+				pool = x509.NewCertPool()
+			}
+		} else {
+			pool = pool.Clone()
+		}
+		if !pool.AppendCertsFromPEM(o.CACerts) {
+			return nil, errors.New("no certificates found in CACerts")
+		}
+	}
+	if pool != nil {
+		t.TLSClientConfig.RootCAs = pool
+	}
+
+	if len(o.ClientCert) > 0 || len(o.ClientKey) > 0 {
+		cert, err := tls.X509KeyPair(o.ClientCert, o.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid client certificate: %w", err)
+		}
+		t.TLSClientConfig.Certificates = []tls.Certificate{cert}
+	}
+	return t, nil
+}
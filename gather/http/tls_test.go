@@ -0,0 +1,130 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package http
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// clientCertificate returns a self-signed client certificate and its key,
+// PEM encoded.
+func clientCertificate(t *testing.T) (*x509.Certificate, []byte, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "gatherer"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert,
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func TestHTTPGatherer_Gather_TLS(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("data"))
+	}))
+	client, certPEM, keyPEM := clientCertificate(t)
+	clients := x509.NewCertPool()
+	clients.AddCert(client)
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clients}
+	server.StartTLS()
+	defer server.Close()
+
+	caPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+
+	tests := []struct {
+		name    string
+		opts    TLSOptions
+		wantErr bool
+	}{
+		{name: "untrusted server", opts: TLSOptions{ClientCert: certPEM, ClientKey: keyPEM}, wantErr: true},
+		{name: "no client certificate", opts: TLSOptions{CACerts: caPEM}, wantErr: true},
+		{name: "ca bundle", opts: TLSOptions{CACerts: caPEM, ClientCert: certPEM, ClientKey: keyPEM}},
+		{name: "root pool", opts: TLSOptions{RootCAs: roots, ClientCert: certPEM, ClientKey: keyPEM}},
+		{name: "insecure", opts: TLSOptions{InsecureSkipVerify: true, ClientCert: certPEM, ClientKey: keyPEM}},
+		{name: "invalid bundle", opts: TLSOptions{CACerts: []byte("not a certificate")}, wantErr: true},
+		{name: "key missing", opts: TLSOptions{CACerts: caPEM, ClientCert: certPEM}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewHTTPGatherer()
+			g.TLS = tt.opts
+			_, err := g.Gather(context.Background(), server.URL+"/file.txt", filepath.Join(t.TempDir(), "file.txt"))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Gather() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTLSOptions_transport(t *testing.T) {
+	base := &http.Transport{}
+	if got, err := (TLSOptions{}).transport(base); err != nil || got != base {
+		t.Errorf("expected the base transport without options, got %v, %v", got, err)
+	}
+
+	roots := x509.NewCertPool()
+	got, err := TLSOptions{RootCAs: roots}.transport(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == base || got.(*http.Transport).TLSClientConfig.RootCAs != roots {
+		t.Error("expected a copy of the base transport trusting RootCAs")
+	}
+
+	if _, err := (TLSOptions{RootCAs: roots}).transport(http.NewFileTransport(http.Dir("."))); err == nil {
+		t.Error("expected an error for a transport that cannot be configured")
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+var (
+	// ErrVariableNotAllowed is returned when a source references a variable
+	// missing from the allowlist.
+	ErrVariableNotAllowed = errors.New("variable not allowed")
+	// ErrVariableUnset is returned when a source references a variable that
+	// is not set.
+	ErrVariableUnset = errors.New("variable not set")
+)
+
+// variableName matches the names of variables that can be interpolated.
+var variableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Interpolator expands "${VAR}" references to environment variables in
+// source URIs, so declarative lists of sources can be parameterized per
+// environment. Only the variables listed in Allowed can be referenced, and
+// referencing one that is unset is an error rather than an empty
+// expansion. "$${" stands for a literal "${"; a "$" not followed by "{" is
+// left as is.
+type Interpolator struct {
+	// Allowed lists the names of the variables sources may reference.
+	Allowed []string
+	// Lookup returns the value of a variable and whether it is set. It
+	// defaults to os.LookupEnv.
+	Lookup func(name string) (string, bool)
+}
+
+// Expand returns src with the variables it references replaced by their
+// values.
+func (i Interpolator) Expand(src string) (string, error) {
+	lookup := i.Lookup
+	if lookup == nil {
+		lookup = os.LookupEnv
+	}
+
+	var b strings.Builder
+	rest := src
+	for {
+		start := strings.Index(rest, "${")
+		if start < 0 {
+			b.WriteString(rest)
+			return b.String(), nil
+		}
+		if start > 0 && rest[start-1] == '$' {
+			// "$${" is an escaped "${"
+			b.WriteString(rest[:start-1])
+			b.WriteString("${")
+			rest = rest[start+2:]
+			continue
+		}
+		b.WriteString(rest[:start])
+
+		end := strings.IndexByte(rest[start:], '}')
+		if end < 0 {
+			return "", fmt.Errorf("unterminated variable reference in %q", src)
+		}
+		name := rest[start+2 : start+end]
+		if !variableName.MatchString(name) {
+			return "", fmt.Errorf("invalid variable name %q in %q", name, src)
+		}
+		if !i.allowed(name) {
+			return "", fmt.Errorf("%w: %s", ErrVariableNotAllowed, name)
+		}
+		value, ok := lookup(name)
+		if !ok {
+			return "", fmt.Errorf("%w: %s", ErrVariableUnset, name)
+		}
+		b.WriteString(value)
+		rest = rest[start+end+1:]
+	}
+}
+
+func (i Interpolator) allowed(name string) bool {
+	for _, a := range i.Allowed {
+		if a == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,406 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package ipfs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ipfs/go-cid"
+
+	"github.com/enterprise-contract/go-gather/expand"
+	"github.com/enterprise-contract/go-gather/fserrors"
+	"github.com/enterprise-contract/go-gather/gather"
+	"github.com/enterprise-contract/go-gather/internal/helpers"
+	"github.com/enterprise-contract/go-gather/metadata"
+)
+
+// DefaultGateway is the trustless gateway used when neither an API endpoint
+// nor a gateway is configured.
+var DefaultGateway = "https://ipfs.io"
+
+// maxBlockSize bounds the size of a single block. The IPFS network does not
+// exchange blocks larger than this.
+const maxBlockSize = 4 << 20
+
+// IPFSGatherer gathers content addressed by an ipfs://<CID>[/path] URI.
+// Content is fetched one block at a time, either from an IPFS node's RPC API
+// or from a trustless gateway, and every block is verified against the
+// digest embedded in its CID before it is used, so neither the node nor the
+// gateway needs to be trusted. Raw blocks and UnixFS files and directories
+// are supported.
+type IPFSGatherer struct {
+	IPFSMetadata
+	// APIEndpoint is the base URL of an IPFS node's RPC API, for example
+	// "http://127.0.0.1:5001". When set it takes precedence over Gateway.
+	APIEndpoint string
+	// Gateway is the base URL of a trustless gateway. DefaultGateway is used
+	// when empty.
+	Gateway string
+	Client  http.Client
+	// Username and Password, when set, are sent to the API endpoint or
+	// gateway using basic authentication.
+	Username string
+	Password string
+	// BearerToken, when set, is sent in the Authorization header instead.
+	BearerToken string
+}
+
+// fetch is a single gather by an IPFSGatherer, fetching the blocks of its
+// source. Gathers running at the same time each have their own.
+type fetch struct {
+	*IPFSGatherer
+	// verified counts the blocks verified during the gather.
+	verified int
+}
+
+type IPFSMetadata struct {
+	URI       string
+	CID       string
+	Path      string
+	Size      int64
+	Files     int
+	Timestamp string
+	// SecurityChecks records the block verifications and entry name checks
+	// performed.
+	SecurityChecks []metadata.SecurityCheck
+	// Skipped lists the directory entries that were left out, and why.
+	Skipped []metadata.SkippedEntry
+	// Sizes reports the sizes of the files gathered.
+	Sizes *metadata.SizeReport
+}
+
+func (i *IPFSGatherer) Matcher(uri string) bool {
+	return strings.HasPrefix(uri, "ipfs://")
+}
+
+// Gather fetches the content addressed by src to dst. A file is written to
+// dst, or inside it if dst is an existing directory or ends in "/"; a
+// directory is mirrored into dst.
+func (i *IPFSGatherer) Gather(ctx context.Context, src, dst string) (_ metadata.Metadata, err error) {
+	defer func() { err = fserrors.Classify(err) }()
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+
+	root, segments, err := parseURI(src)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, trace := metadata.WithSecurityTrace(ctx)
+	f := &fetch{IPFSGatherer: i}
+
+	dst, err = helpers.ExpandPath(dst)
+	if err != nil {
+		return nil, fmt.Errorf("failed to expand destination path: %w", err)
+	}
+
+	c := root
+	for _, name := range segments {
+		n, err := f.node(ctx, c)
+		if err != nil {
+			return nil, err
+		}
+		if n.kind != kindDirectory {
+			return nil, fmt.Errorf("cannot resolve %q: %s is not a directory", name, c)
+		}
+		next, ok := n.link(name)
+		if !ok {
+			return nil, fmt.Errorf("no entry named %q in %s", name, c)
+		}
+		c = next
+	}
+
+	n, err := f.node(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &IPFSMetadata{URI: src, CID: c.String()}
+	target := dst
+	if n.kind != kindDirectory && (strings.HasSuffix(dst, "/") || isDir(dst)) {
+		name := c.String()
+		if len(segments) > 0 {
+			name = segments[len(segments)-1]
+		}
+		target = filepath.Join(dst, name)
+	}
+	// Only a directory has entries that a sandbox can leave out
+	rel := "."
+	if target != dst {
+		rel = filepath.Base(target)
+	}
+	sandbox := expand.SandboxFromContext(ctx)
+	if n.kind != kindDirectory {
+		if err := sandbox.Require(trace, rel, false); err != nil {
+			return nil, err
+		}
+	}
+	if err := f.write(ctx, n, target, rel, sandbox, m); err != nil {
+		return nil, err
+	}
+
+	trace.Record(metadata.SecurityCheck{Check: "block-digest", Subject: src, Outcome: metadata.CheckPassed, Detail: fmt.Sprintf("%d blocks verified against their CID", f.verified)})
+	m.SecurityChecks = trace.Checks()
+	m.Path = target
+	if m.Sizes, err = metadata.ScanSizes(ctx, target, metadata.LargestFiles); err != nil {
+		return nil, fmt.Errorf("failed to report sizes: %w", err)
+	}
+	m.Timestamp = time.Now().Format(time.RFC3339)
+	i.IPFSMetadata = *m
+	return &i.IPFSMetadata, nil
+}
+
+// write stores the content of n at target, found at rel below the
+// destination, recursing into directories. Entries outside the sandbox are
+// left out or fail the gather.
+func (i *fetch) write(ctx context.Context, n *node, target, rel string, sandbox *expand.Sandbox, m *IPFSMetadata) error {
+	if n.kind == kindDirectory {
+		if err := os.MkdirAll(target, 0755); err != nil {
+			return fmt.Errorf("failed to create directory: %w", err)
+		}
+		for _, l := range n.links {
+			if err := validName(l.name); err != nil {
+				metadata.RecordCheck(ctx, metadata.SecurityCheck{Check: "path-sanitization", Subject: l.name, Outcome: metadata.CheckRejected, Detail: "directory entry name escapes the destination"})
+				return err
+			}
+			child, err := i.node(ctx, l.cid)
+			if err != nil {
+				return err
+			}
+			childRel := path.Join(rel, l.name)
+			if ok, err := sandbox.Check(metadata.SecurityTraceFromContext(ctx), childRel, child.kind == kindDirectory); err != nil {
+				return err
+			} else if !ok {
+				m.Skipped = append(m.Skipped, metadata.SkippedEntry{Path: childRel, Reason: metadata.SkipSandbox})
+				continue
+			}
+			if err := i.write(ctx, child, filepath.Join(target, l.name), childRel, sandbox, m); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return fmt.Errorf("failed to create destination directory: %w", err)
+	}
+	f, err := os.Create(target)
+	if err != nil {
+		return fmt.Errorf("failed to create destination file: %w", err)
+	}
+	defer f.Close()
+
+	size, err := i.writeFile(ctx, n, f)
+	if err != nil {
+		return err
+	}
+	m.Size += size
+	m.Files++
+	return nil
+}
+
+// writeFile writes the data of the file node n, followed by that of its
+// children in order, to w.
+func (i *fetch) writeFile(ctx context.Context, n *node, w io.Writer) (int64, error) {
+	if n.kind != kindFile {
+		return 0, fmt.Errorf("unexpected %s node in file", n.kind)
+	}
+	written, err := w.Write(n.data)
+	if err != nil {
+		return 0, fmt.Errorf("failed to write to destination file: %w", err)
+	}
+	total := int64(written)
+	for _, l := range n.links {
+		child, err := i.node(ctx, l.cid)
+		if err != nil {
+			return 0, err
+		}
+		size, err := i.writeFile(ctx, child, w)
+		if err != nil {
+			return 0, err
+		}
+		total += size
+	}
+	return total, nil
+}
+
+// node fetches, verifies and decodes the block identified by c.
+func (i *fetch) node(ctx context.Context, c cid.Cid) (*node, error) {
+	data, err := i.block(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	return decode(c, data)
+}
+
+// block fetches the raw block identified by c and checks that it hashes to
+// the digest in c.
+func (i *fetch) block(ctx context.Context, c cid.Cid) ([]byte, error) {
+	var req *http.Request
+	var err error
+	if i.APIEndpoint != "" {
+		u := strings.TrimSuffix(i.APIEndpoint, "/") + "/api/v0/block/get?arg=" + url.QueryEscape(c.String())
+		req, err = http.NewRequestWithContext(ctx, http.MethodPost, u, nil)
+	} else {
+		gateway := i.Gateway
+		if gateway == "" {
+			gateway = DefaultGateway
+		}
+		u := strings.TrimSuffix(gateway, "/") + "/ipfs/" + c.String() + "?format=raw"
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+		if err == nil {
+			req.Header.Set("Accept", "application/vnd.ipld.raw")
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	req.Header.Set("User-Agent", "Go-Gather")
+	if i.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+i.BearerToken)
+	} else if i.Username != "" || i.Password != "" {
+		req.SetBasicAuth(i.Username, i.Password)
+	}
+
+	resp, err := i.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch block %s: %w", c, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch block %s: received response code %d", c, resp.StatusCode)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxBlockSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read block %s: %w", c, err)
+	}
+	if len(data) > maxBlockSize {
+		return nil, fmt.Errorf("block %s exceeds the maximum block size of %d bytes", c, maxBlockSize)
+	}
+
+	sum, err := c.Prefix().Sum(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash block %s: %w", c, err)
+	}
+	if !sum.Equals(c) {
+		metadata.RecordCheck(ctx, metadata.SecurityCheck{Check: "block-digest", Subject: c.String(), Outcome: metadata.CheckRejected, Detail: "content hashes to " + sum.String()})
+		return nil, fmt.Errorf("block %s failed verification: content hashes to %s", c, sum)
+	}
+	i.verified++
+	return data, nil
+}
+
+// parseURI splits an ipfs://<CID>[/path] URI into the root CID and the path
+// segments below it.
+func parseURI(uri string) (cid.Cid, []string, error) {
+	rest := strings.TrimPrefix(uri, "ipfs://")
+	if i := strings.IndexAny(rest, "?#"); i >= 0 {
+		rest = rest[:i]
+	}
+	parts := strings.Split(rest, "/")
+	root, err := cid.Decode(parts[0])
+	if err != nil {
+		return cid.Undef, nil, fmt.Errorf("invalid CID %q: %w", parts[0], err)
+	}
+	var segments []string
+	for _, p := range parts[1:] {
+		if p == "" {
+			continue
+		}
+		p, err := url.PathUnescape(p)
+		if err != nil {
+			return cid.Undef, nil, fmt.Errorf("invalid path in %q: %w", uri, err)
+		}
+		segments = append(segments, p)
+	}
+	return root, segments, nil
+}
+
+// validName rejects directory entry names that would escape the destination.
+func validName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("illegal directory entry name: %q", name)
+	}
+	return nil
+}
+
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+func (i *IPFSMetadata) Get() interface{} {
+	return i
+}
+
+// Relocate updates Path for what was gathered having moved from from to
+// to.
+func (i *IPFSMetadata) Relocate(from, to string) {
+	i.Path = metadata.RelocatePath(i.Path, from, to)
+}
+
+// GetSecurityChecks returns the security checks performed during the gather.
+func (i IPFSMetadata) GetSecurityChecks() []metadata.SecurityCheck {
+	return i.SecurityChecks
+}
+
+// GetPinnedURL returns u unchanged, as an ipfs:// URI already pins its
+// content by digest.
+// GetSkipped returns the directory entries the gather left out.
+func (i IPFSMetadata) GetSkipped() []metadata.SkippedEntry {
+	return i.Skipped
+}
+
+// GetSizeReport returns the sizes of the files gathered.
+func (i IPFSMetadata) GetSizeReport() *metadata.SizeReport {
+	return i.Sizes
+}
+
+// GetSummary returns the summary of the gather, pinned to the CID.
+func (i IPFSMetadata) GetSummary() metadata.Summary {
+	s := metadata.NewSummary("ipfs", i.URI, i.Path, i.Timestamp, i.Sizes)
+	if i.Sizes == nil {
+		s.Files, s.Bytes = i.Files, i.Size
+	}
+	s.Revision = i.CID
+	return s
+}
+
+func (i IPFSMetadata) GetPinnedURL(u string) (string, error) {
+	if len(u) == 0 {
+		return "", fmt.Errorf("empty URL")
+	}
+	return u, nil
+}
+
+func init() {
+	gather.RegisterGatherer(&IPFSGatherer{})
+}
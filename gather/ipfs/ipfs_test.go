@@ -0,0 +1,246 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package ipfs
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/enterprise-contract/go-gather/metadata"
+)
+
+// blockstore holds test blocks keyed by CID.
+type blockstore map[string][]byte
+
+func (b blockstore) raw(t *testing.T, data string) cid.Cid {
+	t.Helper()
+	c, err := cid.NewPrefixV1(cid.Raw, multihash.SHA2_256).Sum([]byte(data))
+	require.NoError(t, err)
+	b[c.String()] = []byte(data)
+	return c
+}
+
+// pb stores a dag-pb node with the given UnixFS type, data and links.
+func (b blockstore) pb(t *testing.T, typ uint64, data string, links ...link) cid.Cid {
+	t.Helper()
+	var unixfs []byte
+	unixfs = protowire.AppendTag(unixfs, 1, protowire.VarintType)
+	unixfs = protowire.AppendVarint(unixfs, typ)
+	if data != "" {
+		unixfs = protowire.AppendTag(unixfs, 2, protowire.BytesType)
+		unixfs = protowire.AppendBytes(unixfs, []byte(data))
+	}
+
+	var node []byte
+	for _, l := range links {
+		var pbLink []byte
+		pbLink = protowire.AppendTag(pbLink, 1, protowire.BytesType)
+		pbLink = protowire.AppendBytes(pbLink, l.cid.Bytes())
+		pbLink = protowire.AppendTag(pbLink, 2, protowire.BytesType)
+		pbLink = protowire.AppendString(pbLink, l.name)
+		node = protowire.AppendTag(node, 2, protowire.BytesType)
+		node = protowire.AppendBytes(node, pbLink)
+	}
+	node = protowire.AppendTag(node, 1, protowire.BytesType)
+	node = protowire.AppendBytes(node, unixfs)
+
+	c, err := cid.NewPrefixV0(multihash.SHA2_256).Sum(node)
+	require.NoError(t, err)
+	b[c.String()] = node
+	return c
+}
+
+// gateway serves the blocks the way a trustless gateway does.
+func (b blockstore) gateway(t *testing.T) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("format") != "raw" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		data, ok := b[strings.TrimPrefix(r.URL.Path, "/ipfs/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(data)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestIPFSGatherer_Matcher(t *testing.T) {
+	g := &IPFSGatherer{}
+	assert.True(t, g.Matcher("ipfs://bafkreih5aznjvttude6c3wbvqeebb6rlx5wkbzyppv7garjiubll2ceym4"))
+	assert.False(t, g.Matcher("https://ipfs.io/ipfs/bafkreih5aznjvttude6c3wbvqeebb6rlx5wkbzyppv7garjiubll2ceym4"))
+}
+
+func TestIPFSGatherer_Gather_RawFile(t *testing.T) {
+	blocks := blockstore{}
+	c := blocks.raw(t, "package main")
+	srv := blocks.gateway(t)
+
+	dst := t.TempDir()
+	g := &IPFSGatherer{Gateway: srv.URL}
+	m, err := g.Gather(context.Background(), "ipfs://"+c.String(), dst)
+	require.NoError(t, err)
+
+	meta := m.(*IPFSMetadata)
+	assert.Equal(t, filepath.Join(dst, c.String()), meta.Path)
+	assert.Equal(t, c.String(), meta.CID)
+	assert.Equal(t, int64(12), meta.Size)
+	content, err := os.ReadFile(meta.Path)
+	require.NoError(t, err)
+	assert.Equal(t, "package main", string(content))
+}
+
+func TestIPFSGatherer_Gather_Directory(t *testing.T) {
+	blocks := blockstore{}
+	chunked := blocks.pb(t, unixfsFile, "",
+		link{cid: blocks.raw(t, "package "), name: ""},
+		link{cid: blocks.raw(t, "lib"), name: ""},
+	)
+	lib := blocks.pb(t, unixfsDirectory, "", link{cid: chunked, name: "util.rego"})
+	main := blocks.pb(t, unixfsFile, "package main")
+	root := blocks.pb(t, unixfsDirectory, "",
+		link{cid: lib, name: "lib"},
+		link{cid: main, name: "main.rego"},
+	)
+	srv := blocks.gateway(t)
+
+	dst := t.TempDir()
+	g := &IPFSGatherer{Gateway: srv.URL}
+	m, err := g.Gather(context.Background(), "ipfs://"+root.String(), dst)
+	require.NoError(t, err)
+
+	meta := m.(*IPFSMetadata)
+	assert.Equal(t, dst, meta.Path)
+	assert.Equal(t, 2, meta.Files)
+
+	content, err := os.ReadFile(filepath.Join(dst, "main.rego"))
+	require.NoError(t, err)
+	assert.Equal(t, "package main", string(content))
+	content, err = os.ReadFile(filepath.Join(dst, "lib", "util.rego"))
+	require.NoError(t, err)
+	assert.Equal(t, "package lib", string(content))
+
+	// A path below the root CID selects a single entry
+	fileDst := t.TempDir()
+	m, err = g.Gather(context.Background(), "ipfs://"+root.String()+"/lib/util.rego", fileDst)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(fileDst, "util.rego"), m.(*IPFSMetadata).Path)
+	assert.Equal(t, chunked.String(), m.(*IPFSMetadata).CID)
+}
+
+func TestIPFSGatherer_Gather_TamperedBlock(t *testing.T) {
+	blocks := blockstore{}
+	c := blocks.raw(t, "package main")
+	blocks[c.String()] = []byte("package evil")
+	srv := blocks.gateway(t)
+
+	g := &IPFSGatherer{Gateway: srv.URL}
+	_, err := g.Gather(context.Background(), "ipfs://"+c.String(), t.TempDir())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed verification")
+}
+
+func TestIPFSGatherer_Gather_IllegalName(t *testing.T) {
+	blocks := blockstore{}
+	root := blocks.pb(t, unixfsDirectory, "", link{cid: blocks.raw(t, "evil"), name: "../evil"})
+	srv := blocks.gateway(t)
+
+	dst := filepath.Join(t.TempDir(), "dst")
+	g := &IPFSGatherer{Gateway: srv.URL}
+	_, err := g.Gather(context.Background(), "ipfs://"+root.String(), dst)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "illegal directory entry name")
+	assert.NoFileExists(t, filepath.Join(filepath.Dir(dst), "evil"))
+}
+
+func TestIPFSGatherer_Gather_SecurityTrace(t *testing.T) {
+	blocks := blockstore{}
+	root := blocks.pb(t, unixfsDirectory, "",
+		link{cid: blocks.raw(t, "package a"), name: "a.rego"},
+		link{cid: blocks.raw(t, "package b"), name: "b.rego"},
+	)
+	srv := blocks.gateway(t)
+
+	g := &IPFSGatherer{Gateway: srv.URL}
+	m, err := g.Gather(context.Background(), "ipfs://"+root.String(), t.TempDir())
+	require.NoError(t, err)
+
+	checks := m.(metadata.SecurityChecker).GetSecurityChecks()
+	require.Len(t, checks, 1)
+	assert.Equal(t, "block-digest", checks[0].Check)
+	assert.Equal(t, metadata.CheckPassed, checks[0].Outcome)
+	assert.Equal(t, "3 blocks verified against their CID", checks[0].Detail)
+
+	// Rejections are recorded to a trace supplied by the caller
+	c := blocks.raw(t, "package main")
+	blocks[c.String()] = []byte("package evil")
+	ctx, trace := metadata.WithSecurityTrace(context.Background())
+	_, err = g.Gather(ctx, "ipfs://"+c.String(), t.TempDir())
+	require.Error(t, err)
+	require.Len(t, trace.Checks(), 1)
+	assert.Equal(t, metadata.CheckRejected, trace.Checks()[0].Outcome)
+	assert.Equal(t, c.String(), trace.Checks()[0].Subject)
+}
+
+func TestIPFSGatherer_Gather_APIEndpoint(t *testing.T) {
+	blocks := blockstore{}
+	c := blocks.raw(t, "package main")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/api/v0/block/get" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		data, ok := blocks[r.URL.Query().Get("arg")]
+		if !ok {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_, _ = w.Write(data)
+	}))
+	defer srv.Close()
+
+	dst := filepath.Join(t.TempDir(), "main.rego")
+	g := &IPFSGatherer{APIEndpoint: srv.URL, Gateway: "http://127.0.0.1:1", BearerToken: "token"}
+	m, err := g.Gather(context.Background(), "ipfs://"+c.String(), dst)
+	require.NoError(t, err)
+	assert.Equal(t, dst, m.(*IPFSMetadata).Path)
+}
+
+func TestIPFSGatherer_Gather_InvalidCID(t *testing.T) {
+	g := &IPFSGatherer{}
+	_, err := g.Gather(context.Background(), "ipfs://not-a-cid", t.TempDir())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid CID")
+}
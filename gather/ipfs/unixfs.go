@@ -0,0 +1,206 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package ipfs
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ipfs/go-cid"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+type kind int
+
+const (
+	kindFile kind = iota
+	kindDirectory
+)
+
+func (k kind) String() string {
+	if k == kindDirectory {
+		return "directory"
+	}
+	return "file"
+}
+
+// UnixFS data types, see https://specs.ipfs.tech/unixfs/.
+const (
+	unixfsRaw       = 0
+	unixfsDirectory = 1
+	unixfsFile      = 2
+	unixfsMetadata  = 3
+	unixfsSymlink   = 4
+	unixfsHAMTShard = 5
+)
+
+type link struct {
+	cid  cid.Cid
+	name string
+}
+
+// node is a decoded block: either (part of) a file or a directory.
+type node struct {
+	kind  kind
+	data  []byte
+	links []link
+}
+
+func (n *node) link(name string) (cid.Cid, bool) {
+	for _, l := range n.links {
+		if l.name == name {
+			return l.cid, true
+		}
+	}
+	return cid.Undef, false
+}
+
+// decode interprets a verified block according to the codec of its CID.
+func decode(c cid.Cid, data []byte) (*node, error) {
+	switch c.Type() {
+	case cid.Raw:
+		return &node{kind: kindFile, data: data}, nil
+	case cid.DagProtobuf:
+		n, err := decodeDagPB(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode block %s: %w", c, err)
+		}
+		return n, nil
+	default:
+		return nil, fmt.Errorf("unsupported codec 0x%x in %s", c.Type(), c)
+	}
+}
+
+// decodeDagPB decodes a dag-pb PBNode carrying UnixFS data.
+//
+//	message PBLink { bytes Hash = 1; string Name = 2; uint64 Tsize = 3; }
+//	message PBNode { repeated PBLink Links = 2; bytes Data = 1; }
+func decodeDagPB(b []byte) (*node, error) {
+	var links []link
+	var unixfs []byte
+	err := fields(b, func(num protowire.Number, v []byte, _ uint64) error {
+		switch num {
+		case 1:
+			unixfs = v
+		case 2:
+			l, err := decodeLink(v)
+			if err != nil {
+				return err
+			}
+			links = append(links, l)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if unixfs == nil {
+		return nil, errors.New("dag-pb node carries no UnixFS data")
+	}
+
+	// message Data { DataType Type = 1; bytes Data = 2; ... }
+	typ := uint64(unixfsRaw)
+	var data []byte
+	err = fields(unixfs, func(num protowire.Number, v []byte, x uint64) error {
+		switch num {
+		case 1:
+			typ = x
+		case 2:
+			data = v
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	switch typ {
+	case unixfsRaw, unixfsFile:
+		return &node{kind: kindFile, data: data, links: links}, nil
+	case unixfsDirectory:
+		return &node{kind: kindDirectory, links: links}, nil
+	case unixfsHAMTShard:
+		return nil, errors.New("sharded directories are not supported")
+	case unixfsSymlink:
+		return nil, errors.New("symlinks are not supported")
+	case unixfsMetadata:
+		return nil, errors.New("metadata nodes are not supported")
+	default:
+		return nil, fmt.Errorf("unknown UnixFS type %d", typ)
+	}
+}
+
+func decodeLink(b []byte) (link, error) {
+	var l link
+	err := fields(b, func(num protowire.Number, v []byte, _ uint64) error {
+		switch num {
+		case 1:
+			c, err := cid.Cast(v)
+			if err != nil {
+				return fmt.Errorf("invalid link hash: %w", err)
+			}
+			l.cid = c
+		case 2:
+			l.name = string(v)
+		}
+		return nil
+	})
+	if err != nil {
+		return link{}, err
+	}
+	if !l.cid.Defined() {
+		return link{}, errors.New("link without hash")
+	}
+	return l, nil
+}
+
+// fields calls fn for every varint and length-delimited field in the
+// protobuf message b, skipping fields of other wire types.
+func fields(b []byte, fn func(num protowire.Number, v []byte, x uint64) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+		var err error
+		switch typ {
+		case protowire.VarintType:
+			var x uint64
+			x, n = protowire.ConsumeVarint(b)
+			if n >= 0 {
+				err = fn(num, nil, x)
+			}
+		case protowire.BytesType:
+			var v []byte
+			v, n = protowire.ConsumeBytes(b)
+			if n >= 0 {
+				err = fn(num, v, 0)
+			}
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		if err != nil {
+			return err
+		}
+		b = b[n:]
+	}
+	return nil
+}
@@ -0,0 +1,452 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package oci
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"oras.land/oras-go/v2"
+	"oras.land/oras-go/v2/content"
+
+	"github.com/enterprise-contract/go-gather/gather"
+)
+
+// ErrSignatureVerification is returned when an artifact has no cosign
+// signature that verifies.
+var ErrSignatureVerification = gather.NewError("cosign signature verification failed", gather.ErrVerificationFailed)
+
+// Annotations of the layers of a cosign signature manifest.
+const (
+	cosignSignatureAnnotation   = "dev.cosignproject.cosign/signature"
+	cosignCertificateAnnotation = "dev.sigstore.cosign/certificate"
+	cosignChainAnnotation       = "dev.sigstore.cosign/chain"
+	cosignBundleAnnotation      = "dev.sigstore.cosign/bundle"
+)
+
+// Extensions of Fulcio certificates holding the OIDC issuer of the signer's
+// identity, as a raw string and as a DER encoded UTF8String.
+var (
+	fulcioIssuerV1 = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 1}
+	fulcioIssuerV2 = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 8}
+)
+
+// CosignVerification configures the verification of the cosign signatures
+// of gathered artifacts, before any of their content is written. Signatures
+// are accepted if made with one of PublicKeys, or, keyless, with a
+// certificate issued by the Fulcio CA in FulcioRoots to one of Identities.
+type CosignVerification struct {
+	// PublicKeys are PEM encoded public keys trusted to sign artifacts.
+	PublicKeys [][]byte
+	// FulcioRoots are the PEM encoded root, and intermediate, certificates
+	// of the CA issuing keyless signing certificates.
+	FulcioRoots []byte
+	// Identities are the signers keyless signatures are accepted from.
+	Identities []CosignIdentity
+	// RekorPublicKey is the PEM encoded public key of the transparency log.
+	// Keyless signatures must carry an entry of the log signed with it,
+	// which proves the signature was made while the certificate was valid.
+	// Signatures made with PublicKeys are checked against the log only if
+	// it is set.
+	RekorPublicKey []byte
+}
+
+// CosignIdentity is a keyless signer: the email address or URI the signing
+// certificate was issued to, and the OIDC issuer that vouched for it.
+type CosignIdentity struct {
+	Subject string
+	Issuer  string
+}
+
+// Enabled reports whether any signatures are trusted.
+func (c CosignVerification) Enabled() bool {
+	return len(c.PublicKeys) > 0 || len(c.FulcioRoots) > 0
+}
+
+// CosignSignature describes the signature an artifact was verified with.
+type CosignSignature struct {
+	// Tag is the tag the signature is stored under, e.g.
+	// "registry.example.com/policy:sha256-<hex>.sig".
+	Tag string
+	// KeyID is the SHA-256 fingerprint of the public key that made a
+	// signature with a key.
+	KeyID string
+	// Subject and Issuer identify the signer of a keyless signature.
+	Subject string
+	Issuer  string
+	// IntegratedTime is when the signature was recorded in the
+	// transparency log, zero if it was not checked.
+	IntegratedTime time.Time
+}
+
+// simpleSigning is the payload cosign signs.
+type simpleSigning struct {
+	Critical struct {
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+		Type string `json:"type"`
+	} `json:"critical"`
+}
+
+// rekorBundle is the transparency log entry cosign attaches to signatures.
+type rekorBundle struct {
+	SignedEntryTimestamp []byte
+	Payload              struct {
+		Body           string `json:"body"`
+		IntegratedTime int64  `json:"integratedTime"`
+		LogIndex       int64  `json:"logIndex"`
+		LogID          string `json:"logID"`
+	}
+}
+
+// hashedRekord is the body of a transparency log entry of a signature.
+type hashedRekord struct {
+	Spec struct {
+		Data struct {
+			Hash struct {
+				Algorithm string `json:"algorithm"`
+				Value     string `json:"value"`
+			} `json:"hash"`
+		} `json:"data"`
+		Signature struct {
+			Content   string `json:"content"`
+			PublicKey struct {
+				Content string `json:"content"`
+			} `json:"publicKey"`
+		} `json:"signature"`
+	} `json:"spec"`
+}
+
+// verifyCosign checks that the artifact desc in the repository repo, read
+// from target, has a cosign signature trusted by v.
+func verifyCosign(ctx context.Context, target oras.ReadOnlyTarget, repo string, desc ocispec.Descriptor, v CosignVerification) (*CosignSignature, error) {
+	tag := strings.Replace(desc.Digest.String(), ":", "-", 1) + ".sig"
+	sigDesc, err := target.Resolve(ctx, tag)
+	if err != nil {
+		return nil, fmt.Errorf("%w: no signature found for %s: %v", ErrSignatureVerification, desc.Digest, err)
+	}
+	raw, err := content.FetchAll(ctx, target, sigDesc)
+	if err != nil {
+		return nil, fmt.Errorf("fetching signature %s: %w", tag, err)
+	}
+	var manifest ocispec.Manifest
+	if err := json.Unmarshal(raw, &manifest); err != nil {
+		return nil, fmt.Errorf("parsing signature %s: %w", tag, err)
+	}
+
+	var problems []string
+	for _, layer := range manifest.Layers {
+		payload, err := content.FetchAll(ctx, target, layer)
+		if err != nil {
+			return nil, fmt.Errorf("fetching signature %s: %w", tag, err)
+		}
+		sig, err := v.verifyLayer(layer.Annotations, payload, desc.Digest)
+		if err != nil {
+			problems = append(problems, err.Error())
+			continue
+		}
+		sig.Tag = repo + ":" + tag
+		return sig, nil
+	}
+	if len(problems) == 0 {
+		problems = append(problems, "the signature manifest has no signatures")
+	}
+	return nil, fmt.Errorf("%w for %s: %s", ErrSignatureVerification, desc.Digest, strings.Join(problems, "; "))
+}
+
+// verifyLayer verifies one signature, with the annotations of its layer, of
+// the payload, which must name the artifact with digest d.
+func (v CosignVerification) verifyLayer(annotations map[string]string, payload []byte, d digest.Digest) (*CosignSignature, error) {
+	var p simpleSigning
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return nil, fmt.Errorf("invalid payload: %v", err)
+	}
+	if p.Critical.Image.DockerManifestDigest != d.String() {
+		return nil, fmt.Errorf("payload is for %s", p.Critical.Image.DockerManifestDigest)
+	}
+	sig, err := base64.StdEncoding.DecodeString(annotations[cosignSignatureAnnotation])
+	if err != nil || len(sig) == 0 {
+		return nil, errors.New("missing signature")
+	}
+
+	var result *CosignSignature
+	if certPEM := annotations[cosignCertificateAnnotation]; certPEM != "" && len(v.FulcioRoots) > 0 {
+		result, err = v.verifyKeyless(certPEM, annotations[cosignChainAnnotation], annotations[cosignBundleAnnotation], payload, sig)
+	} else {
+		result, err = v.verifyKey(annotations[cosignBundleAnnotation], payload, sig)
+	}
+	return result, err
+}
+
+// verifyKey verifies sig of payload with one of the trusted public keys.
+func (v CosignVerification) verifyKey(bundle string, payload, sig []byte) (*CosignSignature, error) {
+	for _, keyPEM := range v.PublicKeys {
+		key, err := parsePublicKey(keyPEM)
+		if err != nil {
+			return nil, err
+		}
+		if verifySignature(key, payload, sig) != nil {
+			continue
+		}
+		result := &CosignSignature{KeyID: keyID(key)}
+		if len(v.RekorPublicKey) > 0 {
+			if result.IntegratedTime, err = v.verifyBundle(bundle, payload, sig, nil, key); err != nil {
+				return nil, err
+			}
+		}
+		return result, nil
+	}
+	return nil, errors.New("not signed by a trusted key")
+}
+
+// verifyKeyless verifies sig of payload with the certificate in certPEM,
+// which must have been issued by the trusted CA to a trusted identity while
+// the transparency log entry in bundle was recorded.
+func (v CosignVerification) verifyKeyless(certPEM, chainPEM, bundle string, payload, sig []byte) (*CosignSignature, error) {
+	block, _ := pem.Decode([]byte(certPEM))
+	if block == nil {
+		return nil, errors.New("invalid signing certificate")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid signing certificate: %v", err)
+	}
+	if len(v.RekorPublicKey) == 0 {
+		return nil, errors.New("keyless signatures need the transparency log public key")
+	}
+	integrated, err := v.verifyBundle(bundle, payload, sig, cert, cert.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	roots := x509.NewCertPool()
+	intermediates := x509.NewCertPool()
+	for _, c := range parseCertificates(v.FulcioRoots) {
+		if bytes.Equal(c.RawIssuer, c.RawSubject) {
+			roots.AddCert(c)
+		} else {
+			intermediates.AddCert(c)
+		}
+	}
+	for _, c := range parseCertificates([]byte(chainPEM)) {
+		intermediates.AddCert(c)
+	}
+	_, err = cert.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   integrated,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("untrusted signing certificate: %v", err)
+	}
+	if err := verifySignature(cert.PublicKey, payload, sig); err != nil {
+		return nil, err
+	}
+
+	issuer := certificateIssuer(cert)
+	for _, subject := range certificateSubjects(cert) {
+		for _, id := range v.Identities {
+			if id.Subject == subject && id.Issuer == issuer {
+				return &CosignSignature{Subject: subject, Issuer: issuer, IntegratedTime: integrated}, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("signed by %s (%s), which is not a trusted identity", strings.Join(certificateSubjects(cert), ", "), issuer)
+}
+
+// verifyBundle verifies the transparency log entry in bundle is signed by
+// the log and records sig of payload made with cert, or with key when
+// signed without a certificate, returning when it was recorded.
+func (v CosignVerification) verifyBundle(bundle string, payload, sig []byte, cert *x509.Certificate, key crypto.PublicKey) (time.Time, error) {
+	if bundle == "" {
+		return time.Time{}, errors.New("no transparency log entry")
+	}
+	var b rekorBundle
+	if err := json.Unmarshal([]byte(bundle), &b); err != nil {
+		return time.Time{}, fmt.Errorf("invalid transparency log entry: %v", err)
+	}
+	logKey, err := parsePublicKey(v.RekorPublicKey)
+	if err != nil {
+		return time.Time{}, err
+	}
+	// The log signs the canonical JSON of the entry, with sorted keys
+	canonical, err := json.Marshal(map[string]interface{}{
+		"body":           b.Payload.Body,
+		"integratedTime": b.Payload.IntegratedTime,
+		"logIndex":       b.Payload.LogIndex,
+		"logID":          b.Payload.LogID,
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+	if err := verifySignature(logKey, canonical, b.SignedEntryTimestamp); err != nil {
+		return time.Time{}, errors.New("transparency log entry is not signed by the log")
+	}
+
+	body, err := base64.StdEncoding.DecodeString(b.Payload.Body)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid transparency log entry: %v", err)
+	}
+	var entry hashedRekord
+	if err := json.Unmarshal(body, &entry); err != nil {
+		return time.Time{}, fmt.Errorf("invalid transparency log entry: %v", err)
+	}
+	sum := sha256.Sum256(payload)
+	if entry.Spec.Data.Hash.Algorithm != "sha256" || entry.Spec.Data.Hash.Value != hex.EncodeToString(sum[:]) ||
+		entry.Spec.Signature.Content != base64.StdEncoding.EncodeToString(sig) {
+		return time.Time{}, errors.New("transparency log entry is for another signature")
+	}
+	if !recordsSigner(entry.Spec.Signature.PublicKey.Content, cert, key) {
+		return time.Time{}, errors.New("transparency log entry is for another signer")
+	}
+	return time.Unix(b.Payload.IntegratedTime, 0), nil
+}
+
+// recordsSigner reports whether content, the base64 encoded PEM certificate
+// or public key a transparency log entry records, is cert, or holds key
+// when there is no cert.
+func recordsSigner(content string, cert *x509.Certificate, key crypto.PublicKey) bool {
+	data, err := base64.StdEncoding.DecodeString(content)
+	if err != nil {
+		return false
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return false
+	}
+	if cert != nil {
+		return block.Type == "CERTIFICATE" && bytes.Equal(block.Bytes, cert.Raw)
+	}
+	var recorded crypto.PublicKey
+	if block.Type == "CERTIFICATE" {
+		c, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return false
+		}
+		recorded = c.PublicKey
+	} else if recorded, err = x509.ParsePKIXPublicKey(block.Bytes); err != nil {
+		return false
+	}
+	k, ok := key.(interface{ Equal(crypto.PublicKey) bool })
+	return ok && k.Equal(recorded)
+}
+
+// parsePublicKey parses a PEM encoded public key.
+func parsePublicKey(keyPEM []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, errors.New("invalid PEM public key")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %v", err)
+	}
+	return key, nil
+}
+
+// verifySignature verifies sig of message with key, hashing the message
+// with SHA-256 for ECDSA and RSA keys as cosign does.
+func verifySignature(key crypto.PublicKey, message, sig []byte) error {
+	sum := sha256.Sum256(message)
+	var ok bool
+	switch k := key.(type) {
+	case *ecdsa.PublicKey:
+		ok = ecdsa.VerifyASN1(k, sum[:], sig)
+	case *rsa.PublicKey:
+		ok = rsa.VerifyPKCS1v15(k, crypto.SHA256, sum[:], sig) == nil
+	case ed25519.PublicKey:
+		ok = ed25519.Verify(k, message, sig)
+	default:
+		return fmt.Errorf("unsupported public key type %T", key)
+	}
+	if !ok {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
+
+// keyID returns the SHA-256 fingerprint of key.
+func keyID(key crypto.PublicKey) string {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(der)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// parseCertificates returns the certificates in a PEM bundle, skipping any
+// that do not parse.
+func parseCertificates(data []byte) []*x509.Certificate {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return certs
+		}
+		if c, err := x509.ParseCertificate(block.Bytes); err == nil {
+			certs = append(certs, c)
+		}
+	}
+}
+
+// certificateSubjects returns the email addresses and URIs cert was issued
+// to.
+func certificateSubjects(cert *x509.Certificate) []string {
+	subjects := append([]string{}, cert.EmailAddresses...)
+	for _, u := range cert.URIs {
+		subjects = append(subjects, u.String())
+	}
+	return subjects
+}
+
+// certificateIssuer returns the OIDC issuer recorded in a Fulcio
+// certificate.
+func certificateIssuer(cert *x509.Certificate) string {
+	for _, ext := range cert.Extensions {
+		switch {
+		case ext.Id.Equal(fulcioIssuerV2):
+			var issuer string
+			if _, err := asn1.UnmarshalWithParams(ext.Value, &issuer, "utf8"); err == nil {
+				return issuer
+			}
+		case ext.Id.Equal(fulcioIssuerV1):
+			return string(ext.Value)
+		}
+	}
+	return ""
+}
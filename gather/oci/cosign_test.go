@@ -0,0 +1,422 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package oci
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"oras.land/oras-go/v2/content/memory"
+	"oras.land/oras-go/v2/registry"
+
+	"github.com/enterprise-contract/go-gather/metadata"
+)
+
+const testRepo = "127.0.0.1:5000/my-repo"
+
+// newKey returns a new ECDSA key and its PEM encoded public key.
+func newKey(t *testing.T) (*ecdsa.PrivateKey, []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+	return key, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+func sign(t *testing.T, key *ecdsa.PrivateKey, message []byte) []byte {
+	t.Helper()
+	sum := sha256.Sum256(message)
+	sig, err := ecdsa.SignASN1(rand.Reader, key, sum[:])
+	if err != nil {
+		t.Fatalf("failed to sign: %v", err)
+	}
+	return sig
+}
+
+// cosignPayload returns the payload cosign signs for the artifact d.
+func cosignPayload(d digest.Digest) []byte {
+	return []byte(fmt.Sprintf(`{"critical":{"identity":{"docker-reference":%q},"image":{"docker-manifest-digest":%q},"type":"cosign container image signature"},"optional":null}`, testRepo, d))
+}
+
+// pushArtifact pushes an artifact tagged latest and returns its descriptor.
+func pushArtifact(t *testing.T, store *memory.Store) v1.Descriptor {
+	t.Helper()
+	if err := pushTestArtifact(store, testRepo+":latest", []byte("policy data")); err != nil {
+		t.Fatalf("failed to push artifact: %v", err)
+	}
+	desc, err := store.Resolve(context.Background(), testRepo+":latest")
+	if err != nil {
+		t.Fatalf("failed to resolve artifact: %v", err)
+	}
+	return desc
+}
+
+// pushSignature stores a cosign signature manifest for d with a layer
+// holding payload and annotations.
+func pushSignature(t *testing.T, store *memory.Store, d digest.Digest, payload []byte, annotations map[string]string) {
+	t.Helper()
+	ctx := context.Background()
+	push := func(mediaType string, data []byte, annotations map[string]string) v1.Descriptor {
+		desc := v1.Descriptor{MediaType: mediaType, Digest: digest.FromBytes(data), Size: int64(len(data)), Annotations: annotations}
+		if exists, _ := store.Exists(ctx, desc); !exists {
+			if err := store.Push(ctx, desc, bytes.NewReader(data)); err != nil {
+				t.Fatalf("failed to push: %v", err)
+			}
+		}
+		return desc
+	}
+	manifest := v1.Manifest{
+		MediaType: v1.MediaTypeImageManifest,
+		Config:    push(v1.MediaTypeEmptyJSON, []byte("{}"), nil),
+		Layers:    []v1.Descriptor{push("application/vnd.dev.cosign.simplesigning.v1+json", payload, annotations)},
+	}
+	manifest.SchemaVersion = 2
+	raw, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatalf("failed to marshal manifest: %v", err)
+	}
+	desc := push(v1.MediaTypeImageManifest, raw, nil)
+	if err := store.Tag(ctx, desc, strings.Replace(d.String(), ":", "-", 1)+".sig"); err != nil {
+		t.Fatalf("failed to tag signature: %v", err)
+	}
+}
+
+func TestVerifyCosign_Key(t *testing.T) {
+	key, keyPEM := newKey(t)
+	_, otherPEM := newKey(t)
+	store := memory.New()
+	desc := pushArtifact(t, store)
+	payload := cosignPayload(desc.Digest)
+	pushSignature(t, store, desc.Digest, payload, map[string]string{
+		cosignSignatureAnnotation: base64.StdEncoding.EncodeToString(sign(t, key, payload)),
+	})
+	ctx := context.Background()
+
+	sig, err := verifyCosign(ctx, store, testRepo, desc, CosignVerification{PublicKeys: [][]byte{otherPEM, keyPEM}})
+	if err != nil {
+		t.Fatalf("verifyCosign returned an error: %v", err)
+	}
+	if sig.KeyID != keyID(&key.PublicKey) || sig.Tag != testRepo+":"+strings.Replace(desc.Digest.String(), ":", "-", 1)+".sig" {
+		t.Errorf("unexpected signature: %+v", sig)
+	}
+
+	if _, err := verifyCosign(ctx, store, testRepo, desc, CosignVerification{PublicKeys: [][]byte{otherPEM}}); !errors.Is(err, ErrSignatureVerification) {
+		t.Errorf("expected ErrSignatureVerification for an untrusted key, got %v", err)
+	}
+
+	unsigned := v1.Descriptor{Digest: digest.FromString("unsigned")}
+	if _, err := verifyCosign(ctx, store, testRepo, unsigned, CosignVerification{PublicKeys: [][]byte{keyPEM}}); !errors.Is(err, ErrSignatureVerification) {
+		t.Errorf("expected ErrSignatureVerification without a signature, got %v", err)
+	}
+}
+
+func TestVerifyCosign_PayloadForAnotherArtifact(t *testing.T) {
+	key, keyPEM := newKey(t)
+	store := memory.New()
+	desc := pushArtifact(t, store)
+	payload := cosignPayload(digest.FromString("another"))
+	pushSignature(t, store, desc.Digest, payload, map[string]string{
+		cosignSignatureAnnotation: base64.StdEncoding.EncodeToString(sign(t, key, payload)),
+	})
+
+	_, err := verifyCosign(context.Background(), store, testRepo, desc, CosignVerification{PublicKeys: [][]byte{keyPEM}})
+	if !errors.Is(err, ErrSignatureVerification) {
+		t.Errorf("expected ErrSignatureVerification, got %v", err)
+	}
+}
+
+// keylessFixture is a Fulcio-like CA, a transparency log key, and a
+// signing certificate issued to dev@example.com.
+type keylessFixture struct {
+	rootPEM    []byte
+	rekorKey   *ecdsa.PrivateKey
+	rekorPEM   []byte
+	signingKey *ecdsa.PrivateKey
+	certPEM    []byte
+	issuedAt   time.Time
+}
+
+func newKeylessFixture(t *testing.T) *keylessFixture {
+	t.Helper()
+	f := &keylessFixture{issuedAt: time.Now().Add(-time.Minute).Truncate(time.Second)}
+	caKey, _ := newKey(t)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test fulcio"},
+		NotBefore:             f.issuedAt.Add(-time.Hour),
+		NotAfter:              f.issuedAt.Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("failed to create CA: %v", err)
+	}
+	ca, _ := x509.ParseCertificate(caDER)
+	f.rootPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER})
+
+	f.signingKey, _ = newKey(t)
+	leafTemplate := &x509.Certificate{
+		SerialNumber:    big.NewInt(2),
+		NotBefore:       f.issuedAt,
+		NotAfter:        f.issuedAt.Add(10 * time.Minute),
+		KeyUsage:        x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		EmailAddresses:  []string{"dev@example.com"},
+		ExtraExtensions: []pkix.Extension{{Id: fulcioIssuerV1, Value: []byte("https://accounts.example.com")}},
+	}
+	leafDER, err := x509.CreateCertificate(rand.Reader, leafTemplate, ca, &f.signingKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatalf("failed to create signing certificate: %v", err)
+	}
+	f.certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leafDER})
+	f.rekorKey, f.rekorPEM = newKey(t)
+	return f
+}
+
+// bundle returns the transparency log entry of sig of payload made with the
+// PEM encoded certificate or key signer, recorded at integrated.
+func (f *keylessFixture) bundle(t *testing.T, payload, sig, signer []byte, integrated time.Time) string {
+	t.Helper()
+	sum := sha256.Sum256(payload)
+	body, _ := json.Marshal(map[string]interface{}{
+		"apiVersion": "0.0.1",
+		"kind":       "hashedrekord",
+		"spec": map[string]interface{}{
+			"data": map[string]interface{}{"hash": map[string]string{"algorithm": "sha256", "value": hex.EncodeToString(sum[:])}},
+			"signature": map[string]interface{}{
+				"content":   base64.StdEncoding.EncodeToString(sig),
+				"publicKey": map[string]string{"content": base64.StdEncoding.EncodeToString(signer)},
+			},
+		},
+	})
+	entry := map[string]interface{}{
+		"body":           base64.StdEncoding.EncodeToString(body),
+		"integratedTime": integrated.Unix(),
+		"logIndex":       1,
+		"logID":          "c0ffee",
+	}
+	canonical, _ := json.Marshal(entry)
+	b, _ := json.Marshal(map[string]interface{}{
+		"SignedEntryTimestamp": sign(t, f.rekorKey, canonical),
+		"Payload":              entry,
+	})
+	return string(b)
+}
+
+func TestVerifyCosign_Keyless(t *testing.T) {
+	f := newKeylessFixture(t)
+	identity := CosignIdentity{Subject: "dev@example.com", Issuer: "https://accounts.example.com"}
+	ctx := context.Background()
+
+	testCases := []struct {
+		name       string
+		integrated time.Time
+		v          CosignVerification
+		wantErr    bool
+	}{
+		{"trusted", f.issuedAt.Add(time.Minute), CosignVerification{FulcioRoots: f.rootPEM, RekorPublicKey: f.rekorPEM, Identities: []CosignIdentity{identity}}, false},
+		{"untrusted identity", f.issuedAt.Add(time.Minute), CosignVerification{FulcioRoots: f.rootPEM, RekorPublicKey: f.rekorPEM, Identities: []CosignIdentity{{Subject: "dev@example.com", Issuer: "https://other.example.com"}}}, true},
+		{"signed after the certificate expired", f.issuedAt.Add(time.Hour / 2), CosignVerification{FulcioRoots: f.rootPEM, RekorPublicKey: f.rekorPEM, Identities: []CosignIdentity{identity}}, true},
+		{"no transparency log key", f.issuedAt.Add(time.Minute), CosignVerification{FulcioRoots: f.rootPEM, Identities: []CosignIdentity{identity}}, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			store := memory.New()
+			desc := pushArtifact(t, store)
+			payload := cosignPayload(desc.Digest)
+			sig := sign(t, f.signingKey, payload)
+			pushSignature(t, store, desc.Digest, payload, map[string]string{
+				cosignSignatureAnnotation:   base64.StdEncoding.EncodeToString(sig),
+				cosignCertificateAnnotation: string(f.certPEM),
+				cosignBundleAnnotation:      f.bundle(t, payload, sig, f.certPEM, tc.integrated),
+			})
+
+			got, err := verifyCosign(ctx, store, testRepo, desc, tc.v)
+			if tc.wantErr {
+				if !errors.Is(err, ErrSignatureVerification) {
+					t.Errorf("expected ErrSignatureVerification, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("verifyCosign returned an error: %v", err)
+			}
+			if got.Subject != identity.Subject || got.Issuer != identity.Issuer || !got.IntegratedTime.Equal(tc.integrated) {
+				t.Errorf("unexpected signature: %+v", got)
+			}
+		})
+	}
+}
+
+func TestVerifyCosign_BundleForAnotherSignature(t *testing.T) {
+	f := newKeylessFixture(t)
+	store := memory.New()
+	desc := pushArtifact(t, store)
+	payload := cosignPayload(desc.Digest)
+	sig := sign(t, f.signingKey, payload)
+	other := sign(t, f.signingKey, []byte("something else"))
+	pushSignature(t, store, desc.Digest, payload, map[string]string{
+		cosignSignatureAnnotation:   base64.StdEncoding.EncodeToString(sig),
+		cosignCertificateAnnotation: string(f.certPEM),
+		cosignBundleAnnotation:      f.bundle(t, []byte("something else"), other, f.certPEM, f.issuedAt.Add(time.Minute)),
+	})
+
+	v := CosignVerification{
+		FulcioRoots:    f.rootPEM,
+		RekorPublicKey: f.rekorPEM,
+		Identities:     []CosignIdentity{{Subject: "dev@example.com", Issuer: "https://accounts.example.com"}},
+	}
+	if _, err := verifyCosign(context.Background(), store, testRepo, desc, v); !errors.Is(err, ErrSignatureVerification) {
+		t.Errorf("expected ErrSignatureVerification, got %v", err)
+	}
+}
+
+func TestVerifyCosign_BundleForAnotherSigner(t *testing.T) {
+	f := newKeylessFixture(t)
+	key, keyPEM := newKey(t)
+	_, otherPEM := newKey(t)
+	v := CosignVerification{
+		FulcioRoots:    f.rootPEM,
+		RekorPublicKey: f.rekorPEM,
+		Identities:     []CosignIdentity{{Subject: "dev@example.com", Issuer: "https://accounts.example.com"}},
+	}
+
+	testCases := []struct {
+		name        string
+		annotations func(payload []byte) map[string]string
+		v           CosignVerification
+	}{
+		{
+			name: "keyless",
+			annotations: func(payload []byte) map[string]string {
+				sig := sign(t, f.signingKey, payload)
+				return map[string]string{
+					cosignSignatureAnnotation:   base64.StdEncoding.EncodeToString(sig),
+					cosignCertificateAnnotation: string(f.certPEM),
+					cosignBundleAnnotation:      f.bundle(t, payload, sig, otherPEM, f.issuedAt.Add(time.Minute)),
+				}
+			},
+			v: v,
+		},
+		{
+			name: "key",
+			annotations: func(payload []byte) map[string]string {
+				sig := sign(t, key, payload)
+				return map[string]string{
+					cosignSignatureAnnotation: base64.StdEncoding.EncodeToString(sig),
+					cosignBundleAnnotation:    f.bundle(t, payload, sig, otherPEM, f.issuedAt.Add(time.Minute)),
+				}
+			},
+			v: CosignVerification{PublicKeys: [][]byte{keyPEM}, RekorPublicKey: f.rekorPEM},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			store := memory.New()
+			desc := pushArtifact(t, store)
+			payload := cosignPayload(desc.Digest)
+			pushSignature(t, store, desc.Digest, payload, tc.annotations(payload))
+
+			if _, err := verifyCosign(context.Background(), store, testRepo, desc, tc.v); !errors.Is(err, ErrSignatureVerification) {
+				t.Errorf("expected ErrSignatureVerification, got %v", err)
+			}
+		})
+	}
+}
+
+func TestVerifyCosign_KeyWithBundle(t *testing.T) {
+	f := newKeylessFixture(t)
+	key, keyPEM := newKey(t)
+	store := memory.New()
+	desc := pushArtifact(t, store)
+	payload := cosignPayload(desc.Digest)
+	sig := sign(t, key, payload)
+	integrated := f.issuedAt.Add(time.Minute)
+	pushSignature(t, store, desc.Digest, payload, map[string]string{
+		cosignSignatureAnnotation: base64.StdEncoding.EncodeToString(sig),
+		cosignBundleAnnotation:    f.bundle(t, payload, sig, keyPEM, integrated),
+	})
+
+	got, err := verifyCosign(context.Background(), store, testRepo, desc, CosignVerification{PublicKeys: [][]byte{keyPEM}, RekorPublicKey: f.rekorPEM})
+	if err != nil {
+		t.Fatalf("verifyCosign returned an error: %v", err)
+	}
+	if !got.IntegratedTime.Equal(integrated) {
+		t.Errorf("unexpected signature: %+v", got)
+	}
+}
+
+func TestOCIGatherer_verify(t *testing.T) {
+	key, keyPEM := newKey(t)
+	store := memory.New()
+	desc := pushArtifact(t, store)
+	payload := cosignPayload(desc.Digest)
+	pushSignature(t, store, desc.Digest, payload, map[string]string{
+		cosignSignatureAnnotation: base64.StdEncoding.EncodeToString(sign(t, key, payload)),
+	})
+	ref, err := registry.ParseReference(testRepo + ":latest")
+	if err != nil {
+		t.Fatalf("failed to parse reference: %v", err)
+	}
+
+	g := &OCIGatherer{}
+	copyRef, sig, err := g.verify(context.Background(), store, ref)
+	if err != nil || copyRef != ref.String() || sig != nil {
+		t.Errorf("expected no verification when disabled, got %q %+v %v", copyRef, sig, err)
+	}
+
+	g.Cosign.PublicKeys = [][]byte{keyPEM}
+	ctx, trace := metadata.WithSecurityTrace(context.Background())
+	copyRef, sig, err = g.verify(ctx, store, ref)
+	if err != nil {
+		t.Fatalf("verify returned an error: %v", err)
+	}
+	if checks := trace.Checks(); len(checks) != 1 || checks[0].Check != "signature" || checks[0].Outcome != metadata.CheckPassed || checks[0].Subject != copyRef {
+		t.Errorf("expected a passed signature check of %s, got %+v", copyRef, checks)
+	}
+	if want := testRepo + "@" + desc.Digest.String(); copyRef != want {
+		t.Errorf("expected the artifact to be pulled as %s, got %s", want, copyRef)
+	}
+	if sig == nil || sig.KeyID == "" {
+		t.Errorf("unexpected signature: %+v", sig)
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package oci
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"slices"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"oras.land/oras-go/v2/content"
+
+	"github.com/enterprise-contract/go-gather/metadata"
+)
+
+// mediaTypeDockerManifest is the Docker equivalent of an OCI manifest.
+const mediaTypeDockerManifest = "application/vnd.docker.distribution.manifest.v2+json"
+
+// LayerFilter selects the layers of an artifact to gather, so that a bundle
+// with mixed content, e.g. policies next to data and documentation, can be
+// gathered in part. Layers that do not match are never downloaded. The zero
+// value selects every layer.
+type LayerFilter struct {
+	// MediaTypes lists the media types of the layers to gather, e.g.
+	// "application/vnd.cncf.openpolicyagent.policy.layer.v1+rego". Empty
+	// selects layers of any media type.
+	MediaTypes []string
+	// Annotations a layer must have to be gathered. An empty value only
+	// requires the annotation to be present.
+	Annotations map[string]string
+}
+
+// IsZero reports whether f selects every layer.
+func (f LayerFilter) IsZero() bool {
+	return len(f.MediaTypes) == 0 && len(f.Annotations) == 0
+}
+
+// Matches reports whether the layer desc is selected by f.
+func (f LayerFilter) Matches(desc ocispec.Descriptor) bool {
+	if len(f.MediaTypes) > 0 && !slices.Contains(f.MediaTypes, desc.MediaType) {
+		return false
+	}
+	for k, want := range f.Annotations {
+		got, ok := desc.Annotations[k]
+		if !ok || (want != "" && got != want) {
+			return false
+		}
+	}
+	return true
+}
+
+// isManifest reports whether desc is an image manifest, as opposed to an
+// index or a blob.
+func isManifest(desc ocispec.Descriptor) bool {
+	return desc.MediaType == ocispec.MediaTypeImageManifest || desc.MediaType == mediaTypeDockerManifest
+}
+
+// fetchManifest fetches and decodes the manifest desc.
+func fetchManifest(ctx context.Context, fetcher content.Fetcher, desc ocispec.Descriptor) (*ocispec.Manifest, error) {
+	b, err := content.FetchAll(ctx, fetcher, desc)
+	if err != nil {
+		return nil, err
+	}
+	var manifest ocispec.Manifest
+	if err := json.Unmarshal(b, &manifest); err != nil {
+		return nil, fmt.Errorf("decoding manifest %s: %w", desc.Digest, err)
+	}
+	return &manifest, nil
+}
+
+// filterLayers returns a replacement for content.Successors that leaves the
+// layers f does not select out of manifests, so they are neither fetched
+// nor written. The config and subject of a manifest are always kept. Each
+// layer left out is passed to record, if not nil, as the file it names at
+// prefix, or its digest when it names none. Manifests are visited
+// concurrently, so record has to be safe for concurrent use.
+func filterLayers(f LayerFilter, prefix string, record func(metadata.SkippedEntry)) func(context.Context, content.Fetcher, ocispec.Descriptor) ([]ocispec.Descriptor, error) {
+	return func(ctx context.Context, fetcher content.Fetcher, desc ocispec.Descriptor) ([]ocispec.Descriptor, error) {
+		if !isManifest(desc) {
+			return content.Successors(ctx, fetcher, desc)
+		}
+		manifest, err := fetchManifest(ctx, fetcher, desc)
+		if err != nil {
+			return nil, err
+		}
+
+		var successors []ocispec.Descriptor
+		if manifest.Subject != nil {
+			successors = append(successors, *manifest.Subject)
+		}
+		successors = append(successors, manifest.Config)
+		for _, layer := range manifest.Layers {
+			if f.Matches(layer) {
+				successors = append(successors, layer)
+				continue
+			}
+			if record == nil {
+				continue
+			}
+			name, ok := layer.Annotations[ocispec.AnnotationTitle]
+			if !ok {
+				name = layer.Digest.String()
+			}
+			record(metadata.SkippedEntry{Path: path.Join(prefix, name), Reason: metadata.SkipFiltered, Detail: layer.MediaType})
+		}
+		return successors, nil
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package oci
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"oras.land/oras-go/v2"
+	"oras.land/oras-go/v2/content/memory"
+
+	"github.com/enterprise-contract/go-gather/metadata"
+)
+
+const regoLayer = "application/vnd.cncf.openpolicyagent.policy.layer.v1+rego"
+
+func TestLayerFilter_Matches(t *testing.T) {
+	layer := v1.Descriptor{
+		MediaType:   regoLayer,
+		Annotations: map[string]string{"kind": "policy"},
+	}
+	tests := []struct {
+		name   string
+		filter LayerFilter
+		want   bool
+	}{
+		{"zero", LayerFilter{}, true},
+		{"media type", LayerFilter{MediaTypes: []string{"text/plain", regoLayer}}, true},
+		{"other media type", LayerFilter{MediaTypes: []string{"text/plain"}}, false},
+		{"annotation", LayerFilter{Annotations: map[string]string{"kind": "policy"}}, true},
+		{"annotation present", LayerFilter{Annotations: map[string]string{"kind": ""}}, true},
+		{"annotation value", LayerFilter{Annotations: map[string]string{"kind": "data"}}, false},
+		{"annotation missing", LayerFilter{Annotations: map[string]string{"owner": ""}}, false},
+		{"both", LayerFilter{MediaTypes: []string{regoLayer}, Annotations: map[string]string{"kind": "data"}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.Matches(layer); got != tt.want {
+				t.Errorf("Matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// pushBundle pushes an artifact tagged ref to store with a Rego layer, a
+// data layer and an untitled layer.
+func pushBundle(t *testing.T, store *memory.Store, ref string) {
+	t.Helper()
+	ctx := context.Background()
+	var layers []v1.Descriptor
+	for _, l := range []struct{ name, mediaType string }{
+		{"policy/main.rego", regoLayer},
+		{"data/data.json", "application/vnd.cncf.openpolicyagent.data.layer.v1+json"},
+		{"", "application/octet-stream"},
+	} {
+		data := []byte(ref + l.mediaType + l.name)
+		desc := v1.Descriptor{MediaType: l.mediaType, Digest: digest.FromBytes(data), Size: int64(len(data))}
+		if l.name != "" {
+			desc.Annotations = map[string]string{v1.AnnotationTitle: l.name}
+		}
+		if err := store.Push(ctx, desc, bytes.NewReader(data)); err != nil {
+			t.Fatalf("failed to push layer: %v", err)
+		}
+		layers = append(layers, desc)
+	}
+	manifest, err := oras.PackManifest(ctx, store, oras.PackManifestVersion1_1, "application/vnd.test", oras.PackManifestOptions{Layers: layers})
+	if err != nil {
+		t.Fatalf("failed to pack manifest: %v", err)
+	}
+	if err := store.Tag(ctx, manifest, ref); err != nil {
+		t.Fatalf("failed to tag manifest: %v", err)
+	}
+}
+
+func TestOCIGatherer_Gather_Layers(t *testing.T) {
+	store := memory.New()
+	pushBundle(t, store, "127.0.0.1:5000/my-repo:1.0")
+	pushBundle(t, store, "127.0.0.1:5000/my-repo:latest")
+
+	oldOrasCopy := orasCopy
+	defer func() { orasCopy = oldOrasCopy }()
+	orasCopy = func(ctx context.Context, _ oras.ReadOnlyTarget, srcRef string, dst oras.Target, dstRef string, opts oras.CopyOptions) (v1.Descriptor, error) {
+		return oras.Copy(ctx, store, srcRef, dst, dstRef, opts)
+	}
+
+	g := &OCIGatherer{Layers: LayerFilter{MediaTypes: []string{regoLayer}}}
+
+	tests := []struct {
+		name   string
+		source string
+		prefix string
+	}{
+		{"single", "oci://127.0.0.1:5000/my-repo:latest", ""},
+		{"tags", "oci://127.0.0.1:5000/my-repo:{1.0,latest}", "1.0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dstDir := t.TempDir()
+			meta, err := g.Gather(context.Background(), tt.source, dstDir)
+			if err != nil {
+				t.Fatalf("Gather returned an error: %v", err)
+			}
+			root := filepath.Join(dstDir, tt.prefix)
+			if _, err := os.Stat(filepath.Join(root, "policy", "main.rego")); err != nil {
+				t.Errorf("expected policy/main.rego to be pulled: %v", err)
+			}
+			if _, err := os.Stat(filepath.Join(root, "data")); !os.IsNotExist(err) {
+				t.Errorf("expected data to be left out, got %v", err)
+			}
+
+			skipped := map[string]metadata.SkippedEntry{}
+			for _, s := range meta.(*OCIMetadata).Skipped {
+				skipped[s.Path] = s
+			}
+			s, ok := skipped[filepath.ToSlash(filepath.Join(tt.prefix, "data", "data.json"))]
+			if !ok || s.Reason != metadata.SkipFiltered || s.Detail != "application/vnd.cncf.openpolicyagent.data.layer.v1+json" {
+				t.Errorf("expected data/data.json to be reported as filtered, got %+v", meta.(*OCIMetadata).Skipped)
+			}
+			if tt.prefix == "" && len(skipped) != 2 {
+				t.Errorf("expected the data and untitled layers to be skipped, got %+v", meta.(*OCIMetadata).Skipped)
+			}
+		})
+	}
+}
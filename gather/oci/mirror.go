@@ -0,0 +1,276 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package oci
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"github.com/pelletier/go-toml/v2/unstable"
+	"oras.land/oras-go/v2/registry"
+	"oras.land/oras-go/v2/registry/remote"
+)
+
+// endpoint is a registry an artifact can be pulled from: the registry of
+// the source, or a mirror of it.
+type endpoint struct {
+	// host is the host, and optional port, of the registry.
+	host string
+	// namespace is prepended to the repository, e.g. the project of a
+	// pull-through proxy that mirrors a whole registry.
+	namespace string
+	plainHTTP bool
+	// digestOnly is set for a mirror that can serve content but not
+	// resolve tags, as containerd's "pull" capability without "resolve".
+	digestOnly bool
+}
+
+// String returns the endpoint as written in OCIGatherer.Mirrors.
+func (e endpoint) String() string {
+	return strings.TrimSuffix(e.host+"/"+e.namespace, "/")
+}
+
+// reference returns ref within the endpoint.
+func (e endpoint) reference(ref registry.Reference) registry.Reference {
+	ref.Registry = e.host
+	if e.namespace != "" {
+		ref.Repository = e.namespace + "/" + ref.Repository
+	}
+	return ref
+}
+
+// parseEndpoint parses a mirror written as "[scheme://]host[:port][/namespace]".
+func parseEndpoint(s string) (endpoint, error) {
+	var e endpoint
+	rest := s
+	if scheme, r, ok := strings.Cut(s, "://"); ok {
+		switch scheme {
+		case "http":
+			e.plainHTTP = true
+		case "https":
+		default:
+			return endpoint{}, fmt.Errorf("invalid mirror %q: unsupported scheme %q", s, scheme)
+		}
+		rest = r
+	}
+	e.host, e.namespace, _ = strings.Cut(strings.Trim(rest, "/"), "/")
+	if e.host == "" {
+		return endpoint{}, fmt.Errorf("invalid mirror %q: no host", s)
+	}
+	return e, nil
+}
+
+// hostsFile is a containerd hosts.toml file, see
+// https://github.com/containerd/containerd/blob/main/docs/hosts.md. Only
+// the settings to redirect pulls are read.
+type hostsFile struct {
+	Server string                `toml:"server"`
+	Host   map[string]hostConfig `toml:"host"`
+}
+
+type hostConfig struct {
+	Capabilities []string `toml:"capabilities"`
+	OverridePath bool     `toml:"override_path"`
+}
+
+// readHostsFile reads the mirrors of registry from the hosts.toml file in
+// dir, or in its "_default" directory when registry has none, returning
+// the mirrors in the order they are listed and the server to fall back to,
+// the zero endpoint for registry itself. No hosts.toml is not an error.
+func readHostsFile(dir, registry string) ([]endpoint, endpoint, error) {
+	var b []byte
+	var err error
+	for _, d := range []string{hostsDirName(registry), "_default"} {
+		b, err = os.ReadFile(filepath.Join(dir, d, "hosts.toml"))
+		if !errors.Is(err, fs.ErrNotExist) {
+			break
+		}
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, endpoint{}, nil
+	}
+	if err != nil {
+		return nil, endpoint{}, fmt.Errorf("reading hosts.toml: %w", err)
+	}
+
+	var f hostsFile
+	if err := toml.Unmarshal(b, &f); err != nil {
+		return nil, endpoint{}, fmt.Errorf("parsing hosts.toml for %s: %w", registry, err)
+	}
+	var mirrors []endpoint
+	for _, h := range hostOrder(b, f.Host) {
+		c := f.Host[h]
+		caps := c.Capabilities
+		if len(caps) == 0 {
+			caps = []string{"pull", "resolve"}
+		}
+		if !slices.Contains(caps, "pull") {
+			continue
+		}
+		e, err := hostEndpoint(h, c.OverridePath)
+		if err != nil {
+			return nil, endpoint{}, fmt.Errorf("hosts.toml for %s: %w", registry, err)
+		}
+		e.digestOnly = !slices.Contains(caps, "resolve")
+		mirrors = append(mirrors, e)
+	}
+	var server endpoint
+	if f.Server != "" {
+		if server, err = hostEndpoint(f.Server, false); err != nil {
+			return nil, endpoint{}, fmt.Errorf("hosts.toml for %s: %w", registry, err)
+		}
+	}
+	return mirrors, server, nil
+}
+
+// hostsDirName returns the directory containerd keeps the hosts.toml of
+// registry in, which writes the port of the registry as "_port_".
+func hostsDirName(registry string) string {
+	if host, port, ok := strings.Cut(registry, ":"); ok {
+		return host + "_" + port + "_"
+	}
+	return registry
+}
+
+// hostEndpoint converts a host of a hosts.toml file to an endpoint. As in
+// containerd, "/v2" is appended to the path of a host unless overridePath
+// is set, in which case it has to be included, and the path that follows
+// it is the namespace of the repositories.
+func hostEndpoint(h string, overridePath bool) (endpoint, error) {
+	if !strings.Contains(h, "://") {
+		h = "https://" + h
+	}
+	u, err := url.Parse(h)
+	if err != nil {
+		return endpoint{}, fmt.Errorf("invalid host %q: %w", h, err)
+	}
+	p := strings.Trim(u.Path, "/")
+	switch {
+	case !overridePath && p != "":
+		return endpoint{}, fmt.Errorf("host %q: a path is only supported with override_path", h)
+	case overridePath && p != "v2" && !strings.HasPrefix(p, "v2/"):
+		return endpoint{}, fmt.Errorf("host %q: the path has to start with /v2", h)
+	}
+	return parseEndpoint(u.Scheme + "://" + u.Host + "/" + strings.TrimPrefix(strings.TrimPrefix(p, "v2"), "/"))
+}
+
+// hostOrder returns the hosts of a hosts.toml file in the order their
+// tables appear in b, as they are tried in that order. Hosts not declared
+// as a table of their own follow in lexical order.
+func hostOrder(b []byte, hosts map[string]hostConfig) []string {
+	var order []string
+	seen := map[string]bool{}
+	p := unstable.Parser{}
+	p.Reset(b)
+	for p.NextExpression() {
+		e := p.Expression()
+		if e.Kind != unstable.Table {
+			continue
+		}
+		var key []string
+		for it := e.Key(); it.Next(); {
+			key = append(key, string(it.Node().Data))
+		}
+		if len(key) == 2 && key[0] == "host" && !seen[key[1]] {
+			seen[key[1]] = true
+			order = append(order, key[1])
+		}
+	}
+	var rest []string
+	for h := range hosts {
+		if !seen[h] {
+			rest = append(rest, h)
+		}
+	}
+	sort.Strings(rest)
+	return append(order, rest...)
+}
+
+// endpoints returns the mirrors ref is tried from, in order, followed by
+// the registry it falls back to. Mirrors are taken from o.Mirrors first,
+// then from the hosts.toml files in o.HostsDir.
+func (o *OCIGatherer) endpoints(ref registry.Reference) ([]endpoint, endpoint, error) {
+	upstream := endpoint{host: ref.Registry}
+	var mirrors []endpoint
+	for _, m := range o.Mirrors[ref.Registry] {
+		e, err := parseEndpoint(m)
+		if err != nil {
+			return nil, endpoint{}, err
+		}
+		mirrors = append(mirrors, e)
+	}
+	if o.HostsDir != "" {
+		hosts, server, err := readHostsFile(o.HostsDir, ref.Registry)
+		if err != nil {
+			return nil, endpoint{}, err
+		}
+		mirrors = append(mirrors, hosts...)
+		if server.host != "" {
+			upstream = server
+		}
+	}
+	return mirrors, upstream, nil
+}
+
+// pullSource returns the repository to pull ref from, ref within that
+// repository, and the mirror it is on, empty for the registry of ref. Each
+// mirror is tried in turn and the first that resolves ref is used, the
+// registry of ref when none does.
+func (o *OCIGatherer) pullSource(ctx context.Context, ref registry.Reference) (*remote.Repository, registry.Reference, string, error) {
+	mirrors, upstream, err := o.endpoints(ref)
+	if err != nil {
+		return nil, registry.Reference{}, "", err
+	}
+	pinned := ref.ValidateReferenceAsDigest() == nil
+	for _, m := range mirrors {
+		if m.digestOnly && !pinned {
+			continue
+		}
+		mirrored := m.reference(ref)
+		src, err := o.newRepository(mirrored.String())
+		if err != nil {
+			return nil, registry.Reference{}, "", err
+		}
+		if m.plainHTTP {
+			src.PlainHTTP = true
+		}
+		// A mirror that is unreachable or lacks the artifact is passed over
+		if _, err := src.Resolve(ctx, mirrored.Reference); err != nil {
+			continue
+		}
+		return src, mirrored, m.String(), nil
+	}
+
+	ref = upstream.reference(ref)
+	src, err := o.newRepository(ref.String())
+	if err != nil {
+		return nil, registry.Reference{}, "", err
+	}
+	if upstream.plainHTTP {
+		src.PlainHTTP = true
+	}
+	return src, ref, "", nil
+}
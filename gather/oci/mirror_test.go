@@ -0,0 +1,176 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package oci
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"oras.land/oras-go/v2"
+	"oras.land/oras-go/v2/content/memory"
+	"oras.land/oras-go/v2/registry"
+)
+
+func TestParseEndpoint(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    endpoint
+		wantErr bool
+	}{
+		{in: "mirror.example.com", want: endpoint{host: "mirror.example.com"}},
+		{in: "https://mirror.example.com:5000/", want: endpoint{host: "mirror.example.com:5000"}},
+		{in: "http://proxy.example.com/dockerhub/", want: endpoint{host: "proxy.example.com", namespace: "dockerhub", plainHTTP: true}},
+		{in: "proxy.example.com/a/b", want: endpoint{host: "proxy.example.com", namespace: "a/b"}},
+		{in: "ftp://mirror.example.com", wantErr: true},
+		{in: "https://", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := parseEndpoint(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseEndpoint() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseEndpoint() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func writeHostsFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Join(dir, name), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, name, "hosts.toml"), []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOCIGatherer_endpoints(t *testing.T) {
+	dir := t.TempDir()
+	writeHostsFile(t, dir, "registry.example.com_5000_", `
+server = "http://origin.example.com"
+
+[host."https://z.example.com"]
+  capabilities = ["pull"]
+
+[host."http://a.example.com:5000/v2/proxy"]
+  capabilities = ["pull", "resolve"]
+  override_path = true
+
+[host."https://push.example.com"]
+  capabilities = ["push"]
+`)
+	writeHostsFile(t, dir, "_default", `
+[host."https://default.example.com"]
+`)
+
+	g := &OCIGatherer{
+		Mirrors:  map[string][]string{"registry.example.com:5000": {"first.example.com"}},
+		HostsDir: dir,
+	}
+	mirrors, upstream, err := g.endpoints(registry.Reference{Registry: "registry.example.com:5000", Repository: "policy"})
+	if err != nil {
+		t.Fatalf("endpoints returned an error: %v", err)
+	}
+	want := []endpoint{
+		{host: "first.example.com"},
+		{host: "z.example.com", digestOnly: true},
+		{host: "a.example.com:5000", namespace: "proxy", plainHTTP: true},
+	}
+	if !reflect.DeepEqual(mirrors, want) {
+		t.Errorf("mirrors = %+v, want %+v", mirrors, want)
+	}
+	if want := (endpoint{host: "origin.example.com", plainHTTP: true}); upstream != want {
+		t.Errorf("upstream = %+v, want %+v", upstream, want)
+	}
+
+	mirrors, upstream, err = g.endpoints(registry.Reference{Registry: "quay.io", Repository: "policy"})
+	if err != nil {
+		t.Fatalf("endpoints returned an error: %v", err)
+	}
+	if want := []endpoint{{host: "default.example.com"}}; !reflect.DeepEqual(mirrors, want) {
+		t.Errorf("mirrors = %+v, want %+v", mirrors, want)
+	}
+	if want := (endpoint{host: "quay.io"}); upstream != want {
+		t.Errorf("upstream = %+v, want %+v", upstream, want)
+	}
+
+	writeHostsFile(t, dir, "bad.example.com", `
+[host."https://mirror.example.com/proxy"]
+`)
+	if _, _, err := g.endpoints(registry.Reference{Registry: "bad.example.com"}); err == nil || !strings.Contains(err.Error(), "override_path") {
+		t.Errorf("expected an error about override_path, got %v", err)
+	}
+}
+
+func TestOCIGatherer_Gather_Mirror(t *testing.T) {
+	const source = "registry.example.com/my-repo:latest"
+	data := []byte("mirrored data")
+	store := memory.New()
+	if err := pushTestArtifact(store, source, data); err != nil {
+		t.Fatalf("failed to push test artifact: %v", err)
+	}
+
+	// The mirror only has the artifact under the proxy namespace
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/proxy/my-repo/manifests/latest" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", v1.MediaTypeImageManifest)
+		w.Header().Set("Docker-Content-Digest", digest.FromBytes(data).String())
+		w.Header().Set("Content-Length", "13")
+	}))
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "http://")
+
+	var pulled string
+	oldOrasCopy := orasCopy
+	defer func() { orasCopy = oldOrasCopy }()
+	orasCopy = func(ctx context.Context, _ oras.ReadOnlyTarget, srcRef string, dst oras.Target, dstRef string, opts oras.CopyOptions) (v1.Descriptor, error) {
+		pulled = srcRef
+		return oras.Copy(ctx, store, source, dst, dstRef, opts)
+	}
+
+	g := &OCIGatherer{Mirrors: map[string][]string{
+		"registry.example.com": {host + "/missing", "http://" + host + "/proxy"},
+	}}
+	meta, err := g.Gather(context.Background(), "oci://"+source, t.TempDir())
+	if err != nil {
+		t.Fatalf("Gather returned an error: %v", err)
+	}
+	if want := host + "/proxy/my-repo:latest"; pulled != want {
+		t.Errorf("pulled %s, want %s", pulled, want)
+	}
+	m := meta.(*OCIMetadata)
+	if want := host + "/proxy"; m.Mirror != want {
+		t.Errorf("Mirror = %s, want %s", m.Mirror, want)
+	}
+	if want := digest.FromBytes(data).String(); m.Digest != want {
+		t.Errorf("Digest = %s, want %s", m.Digest, want)
+	}
+}
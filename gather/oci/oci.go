@@ -18,51 +18,202 @@ package oci
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"os"
+	"path"
+	"path/filepath"
 	"regexp"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"go.opentelemetry.io/otel/attribute"
 	"oras.land/oras-go/v2"
+	"oras.land/oras-go/v2/content"
 	"oras.land/oras-go/v2/content/file"
+	"oras.land/oras-go/v2/content/oci"
 	"oras.land/oras-go/v2/registry"
 	"oras.land/oras-go/v2/registry/remote"
+	"oras.land/oras-go/v2/registry/remote/auth"
+	"oras.land/oras-go/v2/registry/remote/errcode"
 
+	"github.com/enterprise-contract/go-gather/expand"
+	"github.com/enterprise-contract/go-gather/fserrors"
 	"github.com/enterprise-contract/go-gather/gather"
+	"github.com/enterprise-contract/go-gather/internal/logging"
+	"github.com/enterprise-contract/go-gather/internal/metrics"
 	r "github.com/enterprise-contract/go-gather/internal/oci/registry"
+	"github.com/enterprise-contract/go-gather/internal/proxy"
+	"github.com/enterprise-contract/go-gather/internal/ratelimit"
+	"github.com/enterprise-contract/go-gather/internal/tracing"
 	"github.com/enterprise-contract/go-gather/metadata"
 )
 
 type OCIGatherer struct {
 	OCIMetadata
+	// Credentials are sent to the registry the artifact is pulled from,
+	// the registry of the source or one of its mirrors, instead of those
+	// found in the keychain: the Docker config and its credential helpers,
+	// and the podman auth.json files.
+	Credentials Credentials
+	// Cosign, when enabled, requires the artifact to have a trusted cosign
+	// signature. It is verified before any content is written, and the
+	// artifact is then pulled by the digest that was verified.
+	Cosign CosignVerification
+	// TargetPlatform selects the manifest to gather when the source is a
+	// multi-arch manifest index, written as "os/arch[/variant]", e.g.
+	// "linux/arm64". It defaults to the platform of the host. A "platform"
+	// query parameter of the source, as in
+	// "oci::registry.example.com/policy:v1?platform=linux/arm64", overrides
+	// it.
+	TargetPlatform string
+	// Layers selects the layers to gather, leaving the others out, e.g. to
+	// gather only the Rego layers of a bundle. Every layer is gathered by
+	// default.
+	Layers LayerFilter
+	// Mirrors maps a registry, e.g. "docker.io", to mirrors of it written
+	// as "[scheme://]host[:port][/namespace]", e.g.
+	// "https://proxy.example.com/dockerhub" for a pull-through proxy that
+	// serves docker.io/library/alpine as dockerhub/library/alpine. Each
+	// mirror is tried in turn, and the registry itself when none has the
+	// artifact, so pulls can be redirected without changing the source.
+	Mirrors map[string][]string
+	// HostsDir is a directory of containerd hosts.toml files, e.g.
+	// "/etc/containerd/certs.d", read for the mirrors of a registry after
+	// those in Mirrors. The mirrors of a registry are configured in
+	// <HostsDir>/<registry>/hosts.toml, or <HostsDir>/_default/hosts.toml.
+	HostsDir string
+	// Registries configures how the registries named, as "host" or
+	// "host:port", are reached, e.g. over plain HTTP for a local registry.
+	// A mirror is configured by its own host.
+	Registries map[string]RegistryOptions
+	// Proxy is the URL of a proxy to reach the registries through, e.g.
+	// "http://proxy.example.com:3128", in place of the one of the
+	// HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables.
+	Proxy string
+	// RateLimit bounds the bandwidth of the downloads from each repository,
+	// in bytes per second. Downloads are not throttled when zero.
+	RateLimit int64
+	// PullReferrers downloads the artifacts referring to the one gathered,
+	// such as attestations and SBOMs, alongside it. Only Gather does, not
+	// GatherTags.
+	PullReferrers ReferrerOptions
+	// Hosts are the hosts, as "host" or "host:port", of registries beyond
+	// the well-known ones whose sources Matcher accepts without an "oci::"
+	// prefix, e.g. "harbor.corp.example" for
+	// "harbor.corp.example/policy:v1". The hosts listed in the
+	// EnvOCIRegistries environment variable are accepted too.
+	Hosts []string
+	// BareReferences has Matcher accept any source written as a reference
+	// to an artifact, "host/repository:tag" or "host/repository@digest",
+	// whose host has a dot or a port, e.g. "registry.corp.example/policy:v1".
+	BareReferences bool
+}
+
+// EnvOCIRegistries lists the hosts of registries, separated by commas, whose
+// sources the OCI gatherer accepts without an "oci::" prefix, as Hosts does.
+const EnvOCIRegistries = "GO_GATHER_OCI_REGISTRIES"
+
+// Credentials authenticate with a registry, either with a user name and a
+// password or token, or with a bearer token.
+type Credentials struct {
+	Username string
+	Password string
+	// Token is a registry access token sent as a bearer token, e.g. the
+	// output of "gcloud auth print-access-token".
+	Token string
+}
+
+// authError returns err matching gather.ErrAuthRequired too when the
+// registry refused the credentials sent, or asked for some.
+func authError(err error) error {
+	var resp *errcode.ErrorResponse
+	if errors.As(err, &resp) && (resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden) {
+		return fmt.Errorf("%w: %w", gather.ErrAuthRequired, err)
+	}
+	return err
 }
 
 type OCIMetadata struct {
-	Path      string
-	Digest    string
+	// URI is the source as given to Gather or GatherTags.
+	URI  string
+	Path string
+	// Digest is the digest of the manifest gathered, which the source
+	// either referenced directly, e.g. "registry.example.com/policy@sha256:…",
+	// or resolved from Tag. For a manifest index it is the manifest
+	// selected from it for Platform.
+	Digest string
+	// Tag is the tag the source referenced, empty when it was pinned to a
+	// digest.
+	Tag string
+	// Signature describes the cosign signature the artifact was verified
+	// with, nil without verification.
+	Signature *CosignSignature
+	// Index is the digest of the manifest index Digest was selected from,
+	// empty when the source was a single manifest.
+	Index string
+	// Platform is the platform Digest was selected for, as "os/arch" or
+	// "os/arch/variant".
+	Platform string
+	// Mirror is the mirror the artifact was pulled from, empty when it was
+	// pulled from the registry of the source.
+	Mirror string
+	// Referrers lists the referrers downloaded, see
+	// OCIGatherer.PullReferrers.
+	Referrers []Referrer
 	Timestamp string
+	// Tags maps each tag gathered by GatherTags, or a tag set in the source,
+	// to the digest it resolved to. Digest is empty in that case.
+	Tags map[string]string
+	// Skipped lists the layers that were left out, by the files they name,
+	// and why.
+	Skipped []metadata.SkippedEntry
+	// Sizes reports the sizes of the files gathered.
+	Sizes *metadata.SizeReport
 }
 
+// tagSet matches a reference ending in a set of tags, e.g.
+// "registry.example.com/policy:{1.0,1.1,latest}".
+var tagSet = regexp.MustCompile(`^(.+):\{([^{}]*)\}$`)
+
 var Transport http.RoundTripper = http.DefaultTransport
 
 var orasCopy = oras.Copy
 
-func (o *OCIGatherer) Gather(ctx context.Context, source, dst string) (metadata.Metadata, error) {
+func (o *OCIGatherer) Gather(ctx context.Context, source, dst string) (_ metadata.Metadata, err error) {
+	ctx, span := tracing.Start(ctx, "oci.pull", tracing.Source(source)...)
+	defer func() { tracing.End(span, err) }()
+
+	defer func() { err = fserrors.Classify(authError(err)) }()
+
 	select {
 	case <-ctx.Done():
 		return nil, ctx.Err()
 	default:
 	}
+	o.URI = source
 
 	if strings.Contains(source, "localhost") {
 		source = strings.ReplaceAll(source, "localhost", "127.0.0.1")
 	}
+	source, target, err := o.targetPlatform(source)
+	if err != nil {
+		return nil, err
+	}
 
 	// Parse the source URI
 	repo := ociURLParse(source)
 
+	// A set of tags is gathered into one subdirectory per tag
+	if m := tagSet.FindStringSubmatch(repo); m != nil {
+		return o.gatherTags(ctx, m[1], strings.Split(m[2], ","), dst, target)
+	}
+
 	// Get the artifact reference
 	ref, err := registry.ParseReference(repo)
 	if err != nil {
@@ -72,18 +223,21 @@ func (o *OCIGatherer) Gather(ctx context.Context, source, dst string) (metadata.
 	// If the reference is empty, set it to "latest"
 	if ref.Reference == "" {
 		ref.Reference = "latest"
-		repo = ref.String()
 	}
 
-	// Create the repository client
-	src, err := remote.NewRepository(repo)
+	platform, err := parsePlatform(target)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create repository client: %w", err)
+		return nil, err
 	}
 
-	// Setup the client for the repository
-	if err := r.SetupClient(src, Transport); err != nil {
-		return nil, fmt.Errorf("failed to setup repository client: %w", err)
+	src, pullRef, mirror, err := o.pullSource(ctx, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	copyRef, signature, err := o.verify(ctx, src, pullRef)
+	if err != nil {
+		return nil, err
 	}
 
 	// Create the destination directory
@@ -98,19 +252,322 @@ func (o *OCIGatherer) Gather(ctx context.Context, source, dst string) (metadata.
 	}
 	defer fileStore.Close()
 
-	// Copy the artifact to the file store
-	a, err := orasCopy(ctx, src, repo, fileStore, "", oras.DefaultCopyOptions)
+	// Copy the artifact to the file store, verifying everything pulled
+	// against its digest. An index is resolved to the manifest for the
+	// platform
+	var sel platformSelection
+	var skipped []metadata.SkippedEntry
+	opts := o.copyOptions(ctx, "", &skipped)
+	opts.MapRoot = func(ctx context.Context, src content.ReadOnlyStorage, root ocispec.Descriptor) (ocispec.Descriptor, error) {
+		return selectPlatform(ctx, src, root, platform, &sel)
+	}
+	a, err := orasCopy(ctx, verifyingTarget{src}, copyRef, fileStore, "", opts)
 	if err != nil {
 		return nil, fmt.Errorf("pulling policy: %w", err)
 	}
 
+	// A source pinned to a digest must be what was pulled, or the index it
+	// was selected from
+	pulled := a.Digest
+	if sel.platform != nil {
+		pulled = sel.index.Digest
+	}
+	var tag string
+	if ref.ValidateReferenceAsDigest() == nil {
+		if pulled.String() != ref.Reference {
+			return nil, fmt.Errorf("%w: pulled %s, the source is pinned to %s", ErrDigestMismatch, pulled, ref.Reference)
+		}
+	} else {
+		tag = ref.Reference
+	}
+
+	var referrers []Referrer
+	if o.PullReferrers.Enabled {
+		if referrers, err = o.pullReferrers(ctx, src, pullRef, a, dst); err != nil {
+			return nil, err
+		}
+	}
+
 	o.Digest = a.Digest.String()
+	o.Index, o.Platform = "", ""
+	if sel.platform != nil {
+		o.Index = sel.index.Digest.String()
+		o.Platform = formatPlatform(sel.platform)
+	}
+	o.Tag = tag
+	o.Mirror = mirror
+	o.Referrers = referrers
+	o.Tags = nil
+	o.Skipped = skipped
+	o.Signature = signature
 	o.Path = dst
+	if o.Sizes, err = metadata.ScanSizes(ctx, dst, metadata.LargestFiles); err != nil {
+		return nil, fmt.Errorf("failed to report sizes: %w", err)
+	}
 	o.Timestamp = time.Now().Format(time.RFC3339)
+	logging.Debug(ctx, "pulled artifact", logging.Source(source), "digest", o.Digest, "files", o.Sizes.Files, "bytes", o.Sizes.Bytes)
+	tracing.Annotate(ctx, attribute.String("oci.digest", o.Digest), attribute.Int("files", o.Sizes.Files), attribute.Int64("bytes", o.Sizes.Bytes))
+	metrics.Transferred(ctx, o.Sizes.Bytes)
 
 	return &o.OCIMetadata, nil
 }
 
+// GatherTags gathers several tags of the repository named by source, which
+// must not include a tag or digest, into subdirectories of dst named after
+// each tag. Blobs shared by the tags are downloaded only once.
+func (o *OCIGatherer) GatherTags(ctx context.Context, source string, tags []string, dst string) (metadata.Metadata, error) {
+	o.URI = source
+	source, target, err := o.targetPlatform(source)
+	if err != nil {
+		return nil, err
+	}
+	return o.gatherTags(ctx, source, tags, dst, target)
+}
+
+// gatherTags is GatherTags selecting the manifests of multi-arch indexes for
+// the target platform.
+func (o *OCIGatherer) gatherTags(ctx context.Context, source string, tags []string, dst, target string) (_ metadata.Metadata, err error) {
+	ctx, span := tracing.Start(ctx, "oci.pull", tracing.Source(source)...)
+	defer func() { tracing.End(span, err) }()
+
+	defer func() { err = fserrors.Classify(authError(err)) }()
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+
+	if strings.Contains(source, "localhost") {
+		source = strings.ReplaceAll(source, "localhost", "127.0.0.1")
+	}
+	repo := ociURLParse(source)
+
+	ref, err := registry.ParseReference(repo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse reference: %w", err)
+	}
+	if ref.Reference != "" {
+		return nil, fmt.Errorf("repository %q must not include a tag or digest", repo)
+	}
+
+	var refs []registry.Reference
+	seen := map[string]bool{}
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tagRef := ref
+		tagRef.Reference = tag
+		if err := tagRef.ValidateReferenceAsTag(); err != nil {
+			return nil, fmt.Errorf("invalid tag %q: %w", tag, err)
+		}
+		refs = append(refs, tagRef)
+	}
+	if len(refs) == 0 {
+		return nil, fmt.Errorf("no tags to gather from %s", repo)
+	}
+	platform, err := parsePlatform(target)
+	if err != nil {
+		return nil, err
+	}
+
+	// Every tag is pulled into a shared OCI layout first, so blobs already
+	// pulled for an earlier tag are not downloaded again
+	cacheDir, err := os.MkdirTemp("", "oci-cache-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create blob cache: %w", err)
+	}
+	defer os.RemoveAll(cacheDir)
+	cache, err := oci.New(cacheDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create blob cache: %w", err)
+	}
+
+	versions := make(map[string]string, len(refs))
+	var skipped []metadata.SkippedEntry
+	var selected *ocispec.Platform
+	var mirror string
+	for _, tagRef := range refs {
+		tag := tagRef.Reference
+		// Each tag may be found on a different mirror
+		src, pullRef, m, err := o.pullSource(ctx, tagRef)
+		if err != nil {
+			return nil, err
+		}
+		if m != "" {
+			mirror = m
+		}
+		copyRef, _, err := o.verify(ctx, src, pullRef)
+		if err != nil {
+			return nil, err
+		}
+		// The cache is tagged with the manifest selected for the platform,
+		// so the file store is populated from it alone. Layers left out by
+		// the filter are not downloaded into it either
+		var sel platformSelection
+		opts := oras.DefaultCopyOptions
+		if !o.Layers.IsZero() {
+			opts.FindSuccessors = filterLayers(o.Layers, "", nil)
+		}
+		opts.MapRoot = func(ctx context.Context, src content.ReadOnlyStorage, root ocispec.Descriptor) (ocispec.Descriptor, error) {
+			return selectPlatform(ctx, src, root, platform, &sel)
+		}
+		desc, err := orasCopy(ctx, verifyingTarget{src}, copyRef, cache, tag, opts)
+		if err != nil {
+			return nil, fmt.Errorf("pulling policy %s: %w", tagRef, err)
+		}
+		if sel.platform != nil {
+			selected = sel.platform
+		}
+
+		target := filepath.Join(dst, tag)
+		if err := os.MkdirAll(target, os.ModePerm); err != nil {
+			return nil, fmt.Errorf("failed to create directory: %w", err)
+		}
+		fileStore, err := file.New(target)
+		if err != nil {
+			return nil, fmt.Errorf("file store: %w", err)
+		}
+		_, err = oras.Copy(ctx, cache, tag, fileStore, "", o.copyOptions(ctx, tag, &skipped))
+		fileStore.Close()
+		if err != nil {
+			return nil, fmt.Errorf("extracting policy %s: %w", tagRef, err)
+		}
+		versions[tag] = desc.Digest.String()
+	}
+
+	o.Digest = ""
+	o.Tag = ""
+	o.Mirror = mirror
+	o.Referrers = nil
+	o.Signature = nil
+	o.Index, o.Platform = "", ""
+	if selected != nil {
+		o.Platform = formatPlatform(selected)
+	}
+	o.Tags = versions
+	o.Skipped = skipped
+	o.Path = dst
+	if o.Sizes, err = metadata.ScanSizes(ctx, dst, metadata.LargestFiles); err != nil {
+		return nil, fmt.Errorf("failed to report sizes: %w", err)
+	}
+	o.Timestamp = time.Now().Format(time.RFC3339)
+	logging.Debug(ctx, "pulled tags", logging.Source(source), "tags", len(o.Tags), "files", o.Sizes.Files, "bytes", o.Sizes.Bytes)
+	tracing.Annotate(ctx, attribute.Int("oci.tags", len(o.Tags)), attribute.Int("files", o.Sizes.Files), attribute.Int64("bytes", o.Sizes.Bytes))
+	metrics.Transferred(ctx, o.Sizes.Bytes)
+
+	return &o.OCIMetadata, nil
+}
+
+// copyOptions returns the options to copy an artifact to a file store at
+// the path prefix below the destination with. They leave out the layers
+// not selected by o.Layers, and check the files named by the others
+// against the sandbox carried by ctx, if any, appending those left out to
+// skipped.
+func (o *OCIGatherer) copyOptions(ctx context.Context, prefix string, skipped *[]metadata.SkippedEntry) oras.CopyOptions {
+	opts := oras.DefaultCopyOptions
+	// Layers are copied concurrently
+	var mu sync.Mutex
+	if !o.Layers.IsZero() {
+		opts.FindSuccessors = filterLayers(o.Layers, prefix, func(e metadata.SkippedEntry) {
+			mu.Lock()
+			defer mu.Unlock()
+			*skipped = append(*skipped, e)
+		})
+	}
+	sandbox := expand.SandboxFromContext(ctx)
+	if sandbox == nil {
+		return opts
+	}
+	trace := metadata.SecurityTraceFromContext(ctx)
+	opts.PreCopy = func(_ context.Context, desc ocispec.Descriptor) error {
+		name, ok := desc.Annotations[ocispec.AnnotationTitle]
+		if !ok {
+			return nil
+		}
+		// A directory layer is unpacked as a whole, so it has to lie
+		// within the allowlist rather than merely lead to it
+		rel := path.Join(prefix, name)
+		ok, err := sandbox.Check(trace, rel, false)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			mu.Lock()
+			defer mu.Unlock()
+			*skipped = append(*skipped, metadata.SkippedEntry{Path: rel, Reason: metadata.SkipSandbox})
+			return oras.SkipNode
+		}
+		return nil
+	}
+	return opts
+}
+
+// verify checks the cosign signature of the artifact ref in src when
+// verification is enabled, returning the reference to pull it with, which
+// is pinned to the digest verified, and the signature.
+func (o *OCIGatherer) verify(ctx context.Context, src oras.ReadOnlyTarget, ref registry.Reference) (string, *CosignSignature, error) {
+	if !o.Cosign.Enabled() {
+		return ref.String(), nil, nil
+	}
+	target := verifyingTarget{src}
+	desc, err := target.Resolve(ctx, ref.String())
+	if err != nil {
+		return "", nil, fmt.Errorf("resolving %s: %w", ref, err)
+	}
+	repo := ref
+	repo.Reference = ""
+	pinned := ref
+	pinned.Reference = desc.Digest.String()
+	signature, err := verifyCosign(ctx, target, repo.String(), desc, o.Cosign)
+	if err != nil {
+		metadata.RecordCheck(ctx, metadata.SecurityCheck{Check: "signature", Subject: pinned.String(), Outcome: metadata.CheckRejected, Detail: err.Error()})
+		return "", nil, err
+	}
+	metadata.RecordCheck(ctx, metadata.SecurityCheck{Check: "signature", Subject: pinned.String(), Outcome: metadata.CheckPassed, Detail: "cosign signature " + signature.Tag})
+	return pinned.String(), signature, nil
+}
+
+// newRepository returns a client for the repository named by repo.
+func (o *OCIGatherer) newRepository(repo string) (*remote.Repository, error) {
+	// Create the repository client
+	src, err := remote.NewRepository(repo)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create repository client: %w", err)
+	}
+
+	// Static credentials are only sent to the registry of the source
+	var credential auth.CredentialFunc
+	if c := o.Credentials; c != (Credentials{}) {
+		credential = auth.StaticCredential(src.Reference.Registry, auth.Credential{
+			Username:    c.Username,
+			Password:    c.Password,
+			AccessToken: c.Token,
+		})
+	}
+
+	// Setup the client for the repository, as configured for its registry
+	opts, ok := o.registryOptions(src.Reference.Registry)
+	transport, err := opts.transport(Transport)
+	if err != nil {
+		return nil, fmt.Errorf("registry %s: %w", src.Reference.Registry, err)
+	}
+	if transport, err = proxy.Transport(transport, o.Proxy); err != nil {
+		return nil, err
+	}
+	transport = ratelimit.Transport(transport, ratelimit.New(o.RateLimit))
+	if err := r.SetupClientWithCredential(src, transport, credential); err != nil {
+		return nil, fmt.Errorf("failed to setup repository client: %w", err)
+	}
+	if ok {
+		src.PlainHTTP = opts.PlainHTTP
+	}
+	return src, nil
+}
+
 func (o *OCIGatherer) Matcher(uri string) bool {
 	prefixes := []string{"oci://", "oci::"}
 	for _, prefix := range prefixes {
@@ -119,27 +576,98 @@ func (o *OCIGatherer) Matcher(uri string) bool {
 		}
 	}
 	// Check if the input matches any known OCI registry
-	return containsOCIRegistry(uri)
+	if containsOCIRegistry(uri) {
+		return true
+	}
+	return o.matchesHost(uri)
+}
+
+// referenceHost matches the host of a bare reference, which has a dot or a
+// port, e.g. "registry.example.com" or "registry:5000".
+var referenceHost = regexp.MustCompile(`^[A-Za-z0-9-]+(?:\.[A-Za-z0-9-]+)*(?::[0-9]+)?$`)
+
+// matchesHost reports whether uri is a bare reference to an artifact on one
+// of the Hosts, or any bare reference with BareReferences.
+func (o *OCIGatherer) matchesHost(uri string) bool {
+	if strings.Contains(uri, "://") || strings.Contains(uri, "::") {
+		return false
+	}
+	host, _, ok := strings.Cut(uri, "/")
+	if !ok || !referenceHost.MatchString(host) {
+		return false
+	}
+	hosts := o.Hosts
+	if env := os.Getenv(EnvOCIRegistries); env != "" {
+		hosts = append(slices.Clip(hosts), strings.Split(env, ",")...)
+	}
+	for _, h := range hosts {
+		if strings.EqualFold(strings.TrimSpace(h), host) {
+			return true
+		}
+	}
+	if !o.BareReferences || !strings.ContainsAny(host, ".:") {
+		return false
+	}
+	// Without a tag or digest, "host/path" is as likely a path as a reference
+	ref, err := registry.ParseReference(strings.SplitN(uri, "?", 2)[0])
+	return err == nil && ref.Reference != ""
 }
 
 func (o *OCIMetadata) Get() interface{} {
 	return o
 }
 
+// Relocate updates Path for what was gathered having moved from from to
+// to.
+func (o *OCIMetadata) Relocate(from, to string) {
+	o.Path = metadata.RelocatePath(o.Path, from, to)
+}
+
 func (o *OCIMetadata) GetDigest() string {
 	return o.Digest
 }
 
+// GetSkipped returns the files named by layers the gather left out.
+func (o OCIMetadata) GetSkipped() []metadata.SkippedEntry {
+	return o.Skipped
+}
+
+// GetSizeReport returns the sizes of the files gathered.
+func (o OCIMetadata) GetSizeReport() *metadata.SizeReport {
+	return o.Sizes
+}
+
+// GetSummary returns the summary of the pull, pinned to the digest of the
+// manifest. Several tags gathered at once are pinned by the details
+// "tag:<tag>" instead.
+func (o OCIMetadata) GetSummary() metadata.Summary {
+	s := metadata.NewSummary("oci", o.URI, o.Path, o.Timestamp, o.Sizes)
+	s.Revision = o.Digest
+	s.Detail("tag", o.Tag)
+	s.Detail("index", o.Index)
+	s.Detail("platform", o.Platform)
+	s.Detail("mirror", o.Mirror)
+	for tag, digest := range o.Tags {
+		s.Detail("tag:"+tag, digest)
+	}
+	return s
+}
+
 func (o OCIMetadata) GetPinnedURL(u string) (string, error) {
 	if len(u) == 0 {
 		return "", fmt.Errorf("empty URL")
 	}
+	if o.Digest == "" && len(o.Tags) > 0 {
+		return "", fmt.Errorf("several tags were gathered, pin each with its digest from Tags")
+	}
 	if o.Digest == "" {
 		return "", fmt.Errorf("image digest not set")
 	}
 	for _, scheme := range []string{"oci::", "oci://", "https://"} {
 		u = strings.TrimPrefix(u, scheme)
 	}
+	// The digest is that of the manifest selected for the platform
+	u, _, _ = strings.Cut(u, "?")
 	parts := strings.Split(u, "@")
 	if len(parts) > 1 {
 		u = parts[0]
@@ -147,25 +675,48 @@ func (o OCIMetadata) GetPinnedURL(u string) (string, error) {
 	return fmt.Sprintf("oci::%s@%s", u, o.Digest), nil
 }
 
+// ociRegistries match the hosts of known OCI registries.
+var ociRegistries = []*regexp.Regexp{
+	regexp.MustCompile("azurecr.io"),
+	regexp.MustCompile("gcr.io"),
+	regexp.MustCompile("registry.gitlab.com"),
+	regexp.MustCompile("pkg.dev"),
+	regexp.MustCompile("[0-9]{12}.dkr.ecr.[a-z0-9-]*.amazonaws.com"),
+	regexp.MustCompile("^quay.io"),
+	regexp.MustCompile(`(?:::1|127\.0\.0\.1|(?i:localhost)):\d{1,5}`), // localhost OCI registry
+}
+
 // containsOCIRegistry checks if the input string contains a known OCI registry
 func containsOCIRegistry(src string) bool {
-	matchRegistries := []*regexp.Regexp{
-		regexp.MustCompile("azurecr.io"),
-		regexp.MustCompile("gcr.io"),
-		regexp.MustCompile("registry.gitlab.com"),
-		regexp.MustCompile("pkg.dev"),
-		regexp.MustCompile("[0-9]{12}.dkr.ecr.[a-z0-9-]*.amazonaws.com"),
-		regexp.MustCompile("^quay.io"),
-		regexp.MustCompile(`(?:::1|127\.0\.0\.1|(?i:localhost)):\d{1,5}`), // localhost OCI registry
-	}
-
-	for _, matchRegistry := range matchRegistries {
+	for _, matchRegistry := range ociRegistries {
 		if matchRegistry.MatchString(src) {
 			return true
 		}
 	}
 	return false
+}
 
+// targetPlatform removes the "platform" query parameter from source, e.g.
+// "oci::registry.example.com/policy:v1?platform=linux/arm64", returning the
+// platform it names, or TargetPlatform when it has none.
+func (o *OCIGatherer) targetPlatform(source string) (string, string, error) {
+	source, query, found := strings.Cut(source, "?")
+	if !found {
+		return source, o.TargetPlatform, nil
+	}
+	q, err := url.ParseQuery(query)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid query %q: %w", query, err)
+	}
+	for k := range q {
+		if k != "platform" {
+			return "", "", fmt.Errorf("unsupported parameter %q", k)
+		}
+	}
+	if p := q.Get("platform"); p != "" {
+		return source, p, nil
+	}
+	return source, o.TargetPlatform, nil
 }
 
 func ociURLParse(source string) string {
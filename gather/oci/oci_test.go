@@ -21,6 +21,10 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
@@ -30,6 +34,11 @@ import (
 	v1 "github.com/opencontainers/image-spec/specs-go/v1"
 	"oras.land/oras-go/v2"
 	"oras.land/oras-go/v2/content/memory"
+	"oras.land/oras-go/v2/registry/remote/auth"
+	"oras.land/oras-go/v2/registry/remote/errcode"
+
+	"github.com/enterprise-contract/go-gather/expand"
+	"github.com/enterprise-contract/go-gather/gather"
 )
 
 func TestOCIGatherer_Matcher(t *testing.T) {
@@ -56,6 +65,42 @@ func TestOCIGatherer_Matcher(t *testing.T) {
 	}
 }
 
+func TestOCIGatherer_Matcher_Hosts(t *testing.T) {
+	t.Setenv(EnvOCIRegistries, "artifactory.corp.example:8443, other.example")
+	g := &OCIGatherer{Hosts: []string{"harbor.corp.example"}}
+	bare := &OCIGatherer{BareReferences: true}
+
+	tests := []struct {
+		name string
+		g    *OCIGatherer
+		uri  string
+		want bool
+	}{
+		{"host", g, "harbor.corp.example/policy:v1", true},
+		{"host without tag", g, "HARBOR.corp.example/policy", true},
+		{"host from the environment", g, "artifactory.corp.example:8443/policy@sha256:" + strings.Repeat("a", 64), true},
+		{"second host from the environment", g, "other.example/policy", true},
+		{"other host", g, "registry.corp.example/policy:v1", false},
+		{"host as a path", g, "policy/harbor.corp.example/policy:v1", false},
+		{"host with a scheme", g, "https://harbor.corp.example/policy:v1", false},
+		{"bare reference", bare, "registry.corp.example/policy:v1", true},
+		{"bare reference with a port", bare, "registry:5000/policy@sha256:" + strings.Repeat("a", 64), true},
+		{"bare reference with a query", bare, "registry.corp.example/policy:v1?platform=linux/arm64", true},
+		{"bare reference without a tag", bare, "registry.corp.example/policy", false},
+		{"bare reference without a dot", bare, "policy/rules:v1", false},
+		{"bare references off", &OCIGatherer{}, "registry.corp.example/policy:v1", false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := tc.g.Matcher(tc.uri)
+			if got != tc.want {
+				t.Errorf("Matcher(%q) = %v, want %v", tc.uri, got, tc.want)
+			}
+		})
+	}
+}
+
 func TestOCIGatherer_Gather_Success(t *testing.T) {
 	artifactRef := "127.0.0.1:5000/my-repo:latest"
 	memoryStore := memory.New()
@@ -97,6 +142,9 @@ func TestOCIGatherer_Gather_Success(t *testing.T) {
 	if ociMeta.Digest == "" {
 		t.Error("expected a Digest, got empty")
 	}
+	if ociMeta.Tag != "latest" {
+		t.Errorf("expected Tag=latest, got %q", ociMeta.Tag)
+	}
 	if ociMeta.Timestamp == "" {
 		t.Error("expected a Timestamp, got empty")
 	}
@@ -211,6 +259,154 @@ func TestOCIGatherer_Gather_ReplaceLocalhost(t *testing.T) {
 	}
 }
 
+func TestOCIGatherer_Gather_TagSet(t *testing.T) {
+	memoryStore := memory.New()
+	for _, tag := range []string{"1.0", "1.1", "latest"} {
+		ref := "127.0.0.1:5000/my-repo:" + tag
+		if err := pushTestArtifact(memoryStore, ref, []byte("data "+tag)); err != nil {
+			t.Fatalf("failed to push test artifact: %v", err)
+		}
+	}
+
+	var pulled []string
+	oldOrasCopy := orasCopy
+	defer func() { orasCopy = oldOrasCopy }()
+	orasCopy = func(ctx context.Context, srcOras oras.ReadOnlyTarget, srcRef string, dstOras oras.Target, dstRef string, opts oras.CopyOptions) (v1.Descriptor, error) {
+		pulled = append(pulled, srcRef)
+		return oras.Copy(ctx, memoryStore, srcRef, dstOras, dstRef, opts)
+	}
+
+	g := &OCIGatherer{}
+	dstDir := t.TempDir()
+	meta, err := g.Gather(context.Background(), "oci://localhost:5000/my-repo:{1.0, 1.1,latest,1.0}", dstDir)
+	if err != nil {
+		t.Fatalf("Gather returned an error: %v", err)
+	}
+
+	want := []string{
+		"127.0.0.1:5000/my-repo:1.0",
+		"127.0.0.1:5000/my-repo:1.1",
+		"127.0.0.1:5000/my-repo:latest",
+	}
+	if fmt.Sprint(pulled) != fmt.Sprint(want) {
+		t.Errorf("pulled %v, want %v", pulled, want)
+	}
+
+	ociMeta := meta.(*OCIMetadata)
+	if ociMeta.Path != dstDir {
+		t.Errorf("expected Path=%s, got %s", dstDir, ociMeta.Path)
+	}
+	if ociMeta.Digest != "" {
+		t.Errorf("expected no Digest, got %s", ociMeta.Digest)
+	}
+	for _, tag := range []string{"1.0", "1.1", "latest"} {
+		if got, want := ociMeta.Tags[tag], digest.FromBytes([]byte("data "+tag)).String(); got != want {
+			t.Errorf("Tags[%s] = %s, want %s", tag, got, want)
+		}
+		if _, err := os.Stat(filepath.Join(dstDir, tag)); err != nil {
+			t.Errorf("expected directory for tag %s: %v", tag, err)
+		}
+	}
+	if _, err := ociMeta.GetPinnedURL("oci://localhost:5000/my-repo:{1.0,1.1,latest}"); err == nil {
+		t.Error("expected GetPinnedURL to fail for several tags")
+	}
+}
+
+func TestOCIGatherer_GatherTags_Errors(t *testing.T) {
+	g := &OCIGatherer{}
+	tests := []struct {
+		name   string
+		source string
+		tags   []string
+	}{
+		{"tag in source", "localhost:5000/my-repo:latest", []string{"1.0"}},
+		{"no tags", "localhost:5000/my-repo", nil},
+		{"invalid tag", "localhost:5000/my-repo", []string{"not/a/tag"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := g.GatherTags(context.Background(), tt.source, tt.tags, t.TempDir()); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestOCIGatherer_Gather_Sandbox(t *testing.T) {
+	artifactRef := "127.0.0.1:5000/my-repo:latest"
+	memoryStore := memory.New()
+	ctx := context.Background()
+
+	var layers []v1.Descriptor
+	for _, name := range []string{"policy/main.rego", "README.md"} {
+		data := []byte(name)
+		desc := v1.Descriptor{
+			MediaType:   "application/octet-stream",
+			Digest:      digest.FromBytes(data),
+			Size:        int64(len(data)),
+			Annotations: map[string]string{v1.AnnotationTitle: name},
+		}
+		if err := memoryStore.Push(ctx, desc, bytes.NewReader(data)); err != nil {
+			t.Fatalf("failed to push layer: %v", err)
+		}
+		layers = append(layers, desc)
+	}
+	manifest, err := oras.PackManifest(ctx, memoryStore, oras.PackManifestVersion1_1, "application/vnd.test", oras.PackManifestOptions{Layers: layers})
+	if err != nil {
+		t.Fatalf("failed to pack manifest: %v", err)
+	}
+	if err := memoryStore.Tag(ctx, manifest, artifactRef); err != nil {
+		t.Fatalf("failed to tag manifest: %v", err)
+	}
+
+	oldOrasCopy := orasCopy
+	defer func() { orasCopy = oldOrasCopy }()
+	orasCopy = func(ctx context.Context, _ oras.ReadOnlyTarget, srcRef string, dstOras oras.Target, dstRef string, opts oras.CopyOptions) (v1.Descriptor, error) {
+		return oras.Copy(ctx, memoryStore, srcRef, dstOras, dstRef, opts)
+	}
+
+	strict := expand.WithSandbox(ctx, expand.Sandbox{Allow: []string{"policy"}})
+	if _, err := (&OCIGatherer{}).Gather(strict, "oci://"+artifactRef, t.TempDir()); !errors.Is(err, expand.ErrOutsideSandbox) {
+		t.Fatalf("expected ErrOutsideSandbox, got %v", err)
+	}
+
+	dstDir := t.TempDir()
+	skip := expand.WithSandbox(ctx, expand.Sandbox{Allow: []string{"policy"}, Skip: true})
+	meta, err := (&OCIGatherer{}).Gather(skip, "oci://"+artifactRef, dstDir)
+	if err != nil {
+		t.Fatalf("Gather returned an error: %v", err)
+	}
+	if skipped := meta.(*OCIMetadata).Skipped; len(skipped) != 1 || skipped[0].Path != "README.md" {
+		t.Errorf("expected README.md to be reported as skipped, got %+v", skipped)
+	}
+	if _, err := os.Stat(filepath.Join(dstDir, "policy", "main.rego")); err != nil {
+		t.Errorf("expected policy/main.rego to be pulled: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dstDir, "README.md")); !os.IsNotExist(err) {
+		t.Errorf("expected README.md to be left out, got %v", err)
+	}
+}
+
+func TestOCIGatherer_newRepository_Credentials(t *testing.T) {
+	g := &OCIGatherer{Credentials: Credentials{Username: "robot", Password: "s3cret"}}
+	repo, err := g.newRepository("quay.io/org/policy:latest")
+	if err != nil {
+		t.Fatalf("newRepository returned an error: %v", err)
+	}
+	client, ok := repo.Client.(*auth.Client)
+	if !ok {
+		t.Fatalf("expected an *auth.Client, got %T", repo.Client)
+	}
+	cred, err := client.Credential(context.Background(), "quay.io")
+	if err != nil || cred.Username != "robot" || cred.Password != "s3cret" {
+		t.Errorf("unexpected credential for the source registry: %+v (%v)", cred, err)
+	}
+	cred, err = client.Credential(context.Background(), "other.example.com")
+	if err != nil || cred != (auth.Credential{}) {
+		t.Errorf("expected no credential for another registry, got %+v (%v)", cred, err)
+	}
+}
+
 // pushTestArtifact stores data in a memory.Store under a final reference (e.g., "localhost:5000/my-repo:latest").
 func pushTestArtifact(m *memory.Store, finalRef string, data []byte) error {
 	ctx := context.Background()
@@ -269,3 +465,37 @@ func TestOCIMetadata_GetDigest(t *testing.T) {
 		t.Errorf("GetDigest() = %q, want %q", got, "sha256:123abc")
 	}
 }
+
+func TestOCIMetadata_GetSummary(t *testing.T) {
+	o := OCIMetadata{URI: "registry.example.com/policy:v1", Path: "/tmp/policy", Digest: "sha256:123abc", Tag: "v1"}
+	s := o.GetSummary()
+	if s.Type != "oci" || s.URI != o.URI || s.Path != o.Path || s.Revision != o.Digest {
+		t.Errorf("unexpected summary: %+v", s)
+	}
+	if want := map[string]string{"tag": "v1"}; !reflect.DeepEqual(s.Details, want) {
+		t.Errorf("Details = %v, want %v", s.Details, want)
+	}
+
+	// Several tags are pinned by their details
+	o = OCIMetadata{URI: "registry.example.com/policy:{v1,v2}", Tags: map[string]string{"v1": "sha256:1", "v2": "sha256:2"}}
+	s = o.GetSummary()
+	if want := map[string]string{"tag:v1": "sha256:1", "tag:v2": "sha256:2"}; s.Revision != "" || !reflect.DeepEqual(s.Details, want) {
+		t.Errorf("unexpected summary: %+v", s)
+	}
+}
+
+func TestAuthError(t *testing.T) {
+	for _, code := range []int{http.StatusUnauthorized, http.StatusForbidden} {
+		err := fmt.Errorf("pull: %w", &errcode.ErrorResponse{Method: http.MethodGet, URL: &url.URL{}, StatusCode: code})
+		if got := authError(err); !errors.Is(got, gather.ErrAuthRequired) {
+			t.Errorf("expected response code %d to match gather.ErrAuthRequired, got %v", code, got)
+		}
+	}
+	err := &errcode.ErrorResponse{Method: http.MethodGet, URL: &url.URL{}, StatusCode: http.StatusNotFound}
+	if got := authError(err); errors.Is(got, gather.ErrAuthRequired) {
+		t.Errorf("expected a missing artifact not to ask for authentication, got %v", got)
+	}
+	if authError(nil) != nil {
+		t.Error("expected no error")
+	}
+}
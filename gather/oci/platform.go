@@ -0,0 +1,101 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package oci
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"oras.land/oras-go/v2/content"
+)
+
+// ErrPlatformNotFound is returned when a manifest index has no manifest for
+// the platform requested.
+var ErrPlatformNotFound = errors.New("no manifest for the platform")
+
+// mediaTypeDockerManifestList is the Docker equivalent of an OCI index.
+const mediaTypeDockerManifestList = "application/vnd.docker.distribution.manifest.list.v2+json"
+
+// parsePlatform parses a platform written as "os/arch" or
+// "os/arch/variant", e.g. "linux/arm64". An empty string is the platform of
+// the host.
+func parsePlatform(s string) (*ocispec.Platform, error) {
+	if s == "" {
+		return &ocispec.Platform{OS: runtime.GOOS, Architecture: runtime.GOARCH}, nil
+	}
+	parts := strings.Split(s, "/")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("invalid platform %q, expected os/arch[/variant]", s)
+	}
+	p := &ocispec.Platform{OS: parts[0], Architecture: parts[1]}
+	if len(parts) == 3 {
+		p.Variant = parts[2]
+	}
+	return p, nil
+}
+
+// formatPlatform writes p in the form parsePlatform reads.
+func formatPlatform(p *ocispec.Platform) string {
+	s := p.OS + "/" + p.Architecture
+	if p.Variant != "" {
+		s += "/" + p.Variant
+	}
+	return s
+}
+
+// platformSelection records the index a manifest was selected from.
+type platformSelection struct {
+	index    ocispec.Descriptor
+	platform *ocispec.Platform
+}
+
+// selectPlatform maps root, when it is an index, to the manifest it lists
+// for p, recording the choice in sel. Other roots are returned unchanged,
+// as an artifact that is not multi-arch has nothing to choose between. The
+// variant only has to match when p names one.
+func selectPlatform(ctx context.Context, src content.ReadOnlyStorage, root ocispec.Descriptor, p *ocispec.Platform, sel *platformSelection) (ocispec.Descriptor, error) {
+	if root.MediaType != ocispec.MediaTypeImageIndex && root.MediaType != mediaTypeDockerManifestList {
+		return root, nil
+	}
+	b, err := content.FetchAll(ctx, src, root)
+	if err != nil {
+		return ocispec.Descriptor{}, fmt.Errorf("fetching index %s: %w", root.Digest, err)
+	}
+	var index ocispec.Index
+	if err := json.Unmarshal(b, &index); err != nil {
+		return ocispec.Descriptor{}, fmt.Errorf("parsing index %s: %w", root.Digest, err)
+	}
+
+	var available []string
+	for _, m := range index.Manifests {
+		if m.Platform == nil {
+			continue
+		}
+		if m.Platform.OS == p.OS && m.Platform.Architecture == p.Architecture && (p.Variant == "" || m.Platform.Variant == p.Variant) {
+			sel.index = root
+			sel.platform = m.Platform
+			return m, nil
+		}
+		available = append(available, formatPlatform(m.Platform))
+	}
+	return ocispec.Descriptor{}, fmt.Errorf("%w %s in index %s, available: %s", ErrPlatformNotFound, formatPlatform(p), root.Digest, strings.Join(available, ", "))
+}
@@ -0,0 +1,167 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package oci
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"oras.land/oras-go/v2"
+	"oras.land/oras-go/v2/content/memory"
+)
+
+func TestParsePlatform(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+		err  bool
+	}{
+		{"", runtime.GOOS + "/" + runtime.GOARCH, false},
+		{"linux/arm64", "linux/arm64", false},
+		{"linux/arm/v7", "linux/arm/v7", false},
+		{"linux", "", true},
+		{"linux//v7", "", true},
+		{"linux/arm/v7/extra", "", true},
+	}
+	for _, tt := range tests {
+		p, err := parsePlatform(tt.in)
+		if tt.err {
+			if err == nil {
+				t.Errorf("parsePlatform(%q): expected an error", tt.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("parsePlatform(%q): %v", tt.in, err)
+		}
+		if got := formatPlatform(p); got != tt.want {
+			t.Errorf("parsePlatform(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+// pushIndex pushes a manifest index tagged ref to store, listing a manifest
+// for each platform whose single layer, policy.txt, holds the platform.
+func pushIndex(t *testing.T, store *memory.Store, ref string, platforms ...string) v1.Descriptor {
+	t.Helper()
+	ctx := context.Background()
+	index := v1.Index{MediaType: v1.MediaTypeImageIndex}
+	index.SchemaVersion = 2
+	for _, name := range platforms {
+		data := []byte(name)
+		layer := v1.Descriptor{
+			MediaType:   "application/octet-stream",
+			Digest:      digest.FromBytes(data),
+			Size:        int64(len(data)),
+			Annotations: map[string]string{v1.AnnotationTitle: "policy.txt"},
+		}
+		if err := store.Push(ctx, layer, bytes.NewReader(data)); err != nil {
+			t.Fatalf("failed to push layer: %v", err)
+		}
+		manifest, err := oras.PackManifest(ctx, store, oras.PackManifestVersion1_1, "application/vnd.test", oras.PackManifestOptions{Layers: []v1.Descriptor{layer}})
+		if err != nil {
+			t.Fatalf("failed to pack manifest: %v", err)
+		}
+		p, err := parsePlatform(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		manifest.Platform = p
+		index.Manifests = append(index.Manifests, manifest)
+	}
+	b, err := json.Marshal(index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	desc := v1.Descriptor{MediaType: v1.MediaTypeImageIndex, Digest: digest.FromBytes(b), Size: int64(len(b))}
+	if err := store.Push(ctx, desc, bytes.NewReader(b)); err != nil {
+		t.Fatalf("failed to push index: %v", err)
+	}
+	if err := store.Tag(ctx, desc, ref); err != nil {
+		t.Fatalf("failed to tag index: %v", err)
+	}
+	return desc
+}
+
+func TestOCIGatherer_Gather_Platform(t *testing.T) {
+	artifactRef := "127.0.0.1:5000/my-repo:latest"
+	store := memory.New()
+	host := runtime.GOOS + "/" + runtime.GOARCH
+	index := pushIndex(t, store, artifactRef, "linux/arm/v7", "linux/arm64", host)
+
+	oldOrasCopy := orasCopy
+	defer func() { orasCopy = oldOrasCopy }()
+	orasCopy = func(ctx context.Context, _ oras.ReadOnlyTarget, srcRef string, dstOras oras.Target, dstRef string, opts oras.CopyOptions) (v1.Descriptor, error) {
+		if srcRef == "127.0.0.1:5000/my-repo@"+index.Digest.String() {
+			srcRef = artifactRef
+		}
+		return oras.Copy(ctx, store, srcRef, dstOras, dstRef, opts)
+	}
+
+	tests := []struct {
+		name     string
+		source   string
+		platform string
+		want     string
+	}{
+		{"host platform", "oci://" + artifactRef, "", host},
+		{"requested platform", "oci://" + artifactRef, "linux/arm64", "linux/arm64"},
+		{"variant", "oci://" + artifactRef, "linux/arm/v7", "linux/arm/v7"},
+		{"any variant", "oci://" + artifactRef, "linux/arm", "linux/arm/v7"},
+		{"pinned to the index", "oci://127.0.0.1:5000/my-repo@" + index.Digest.String(), "linux/arm64", "linux/arm64"},
+		{"platform parameter", "oci::" + artifactRef + "?platform=linux/arm64", "linux/arm/v7", "linux/arm64"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dst := t.TempDir()
+			g := &OCIGatherer{TargetPlatform: tt.platform}
+			meta, err := g.Gather(context.Background(), tt.source, dst)
+			if err != nil {
+				t.Fatalf("Gather returned an error: %v", err)
+			}
+			content, err := os.ReadFile(filepath.Join(dst, "policy.txt"))
+			if err != nil {
+				t.Fatalf("failed to read the gathered file: %v", err)
+			}
+			if string(content) != tt.want {
+				t.Errorf("gathered the manifest for %s, want %s", content, tt.want)
+			}
+			m := meta.(*OCIMetadata)
+			if m.Platform != tt.want || m.Index != index.Digest.String() || m.Digest == m.Index {
+				t.Errorf("unexpected metadata: platform %q, index %q, digest %q", m.Platform, m.Index, m.Digest)
+			}
+		})
+	}
+
+	_, err := (&OCIGatherer{TargetPlatform: "windows/amd64"}).Gather(context.Background(), "oci://"+artifactRef, t.TempDir())
+	if !errors.Is(err, ErrPlatformNotFound) {
+		t.Errorf("expected ErrPlatformNotFound, got %v", err)
+	}
+	_, err = (&OCIGatherer{}).Gather(context.Background(), "oci://"+artifactRef+"?arch=arm64", t.TempDir())
+	if err == nil || !strings.Contains(err.Error(), "unsupported parameter") {
+		t.Errorf("expected an unsupported parameter error, got %v", err)
+	}
+}
@@ -0,0 +1,189 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package oci
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"strings"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"oras.land/oras-go/v2"
+	"oras.land/oras-go/v2/content/file"
+	"oras.land/oras-go/v2/content/oci"
+	"oras.land/oras-go/v2/registry"
+)
+
+// ErrNothingToPush is returned when the directory to push has no files.
+var ErrNothingToPush = errors.New("no files to push")
+
+// PushOptions configure how a directory is packaged as an OCI artifact.
+// Every regular file of the directory becomes a layer titled with its path
+// relative to the directory, so that gathering the artifact recreates the
+// directory.
+type PushOptions struct {
+	// ArtifactType is the artifact type of the manifest. It defaults to
+	// "application/vnd.unknown.artifact.v1".
+	ArtifactType string
+	// MediaType is the media type of the layers. It defaults to
+	// "application/vnd.oci.image.layer.v1.tar", as the oras CLI uses.
+	MediaType string
+	// MediaTypes maps file extensions, e.g. ".rego", to the media type of
+	// the layers of files with that extension, overriding MediaType.
+	MediaTypes map[string]string
+	// Annotations are set on the manifest, e.g.
+	// "org.opencontainers.image.source".
+	Annotations map[string]string
+}
+
+// mediaType returns the media type of the layer of the file at name.
+func (opts PushOptions) mediaType(name string) string {
+	if mt, ok := opts.MediaTypes[filepath.Ext(name)]; ok {
+		return mt
+	}
+	if opts.MediaType != "" {
+		return opts.MediaType
+	}
+	return ocispec.MediaTypeImageLayer
+}
+
+// Push packages the directory dir as an OCI artifact and pushes it to
+// target, e.g. "oci://registry.example.com/policy:1.0", with the
+// credentials and registry configuration of the gatherer. A target without
+// a tag is pushed as "latest". It returns the descriptor of the manifest
+// pushed.
+func (o *OCIGatherer) Push(ctx context.Context, dir, target string, opts PushOptions) (ocispec.Descriptor, error) {
+	if strings.Contains(target, "localhost") {
+		target = strings.ReplaceAll(target, "localhost", "127.0.0.1")
+	}
+	ref, err := registry.ParseReference(ociURLParse(target))
+	if err != nil {
+		return ocispec.Descriptor{}, fmt.Errorf("failed to parse reference: %w", err)
+	}
+	if ref.Reference == "" {
+		ref.Reference = "latest"
+	}
+	if err := ref.ValidateReferenceAsTag(); err != nil {
+		return ocispec.Descriptor{}, fmt.Errorf("target %s must be tagged: %w", ref, err)
+	}
+
+	dst, err := o.newRepository(ref.String())
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+
+	store, err := pack(ctx, dir, ref.Reference, opts)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	defer store.Close()
+
+	desc, err := orasCopy(ctx, store, ref.Reference, dst, ref.Reference, oras.DefaultCopyOptions)
+	if err != nil {
+		return ocispec.Descriptor{}, fmt.Errorf("pushing %s: %w", ref, err)
+	}
+	return desc, nil
+}
+
+// Save packages the directory dir as an OCI artifact, as Push does, and
+// saves it in the OCI image layout at layoutDir, tagged tag. The layout is
+// created if it does not exist.
+func Save(ctx context.Context, dir, layoutDir, tag string, opts PushOptions) (ocispec.Descriptor, error) {
+	if tag == "" {
+		tag = "latest"
+	}
+	dst, err := oci.New(layoutDir)
+	if err != nil {
+		return ocispec.Descriptor{}, fmt.Errorf("failed to open OCI layout: %w", err)
+	}
+
+	store, err := pack(ctx, dir, tag, opts)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	defer store.Close()
+
+	desc, err := oras.Copy(ctx, store, tag, dst, tag, oras.DefaultCopyOptions)
+	if err != nil {
+		return ocispec.Descriptor{}, fmt.Errorf("saving to %s: %w", layoutDir, err)
+	}
+	return desc, nil
+}
+
+// pack returns a file store holding the artifact packaging dir, tagged tag.
+// Directories named .git are left out.
+func pack(ctx context.Context, dir, tag string, opts PushOptions) (*file.Store, error) {
+	store, err := file.New(dir)
+	if err != nil {
+		return nil, fmt.Errorf("file store: %w", err)
+	}
+
+	var layers []ocispec.Descriptor
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		desc, err := store.Add(ctx, name, opts.mediaType(name), path)
+		if err != nil {
+			return fmt.Errorf("adding %s: %w", name, err)
+		}
+		layers = append(layers, desc)
+		return nil
+	})
+	if err == nil && len(layers) == 0 {
+		err = fmt.Errorf("%w in %s", ErrNothingToPush, dir)
+	}
+	if err != nil {
+		store.Close()
+		return nil, err
+	}
+
+	artifactType := opts.ArtifactType
+	if artifactType == "" {
+		artifactType = oras.MediaTypeUnknownArtifact
+	}
+	manifest, err := oras.PackManifest(ctx, store, oras.PackManifestVersion1_1, artifactType, oras.PackManifestOptions{
+		Layers:              layers,
+		ManifestAnnotations: opts.Annotations,
+	})
+	if err != nil {
+		store.Close()
+		return nil, fmt.Errorf("failed to pack manifest: %w", err)
+	}
+	if err := store.Tag(ctx, manifest, tag); err != nil {
+		store.Close()
+		return nil, fmt.Errorf("failed to tag manifest: %w", err)
+	}
+	return store, nil
+}
@@ -0,0 +1,153 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package oci
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"oras.land/oras-go/v2"
+	"oras.land/oras-go/v2/content/memory"
+	"oras.land/oras-go/v2/content/oci"
+	"oras.land/oras-go/v2/registry/remote"
+)
+
+func writePolicyDir(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"policy/main.rego": "package main",
+		"data/data.json":   "{}",
+		".git/HEAD":        "ref: refs/heads/main",
+	} {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestOCIGatherer_Push(t *testing.T) {
+	dir := writePolicyDir(t)
+	store := memory.New()
+
+	oldOrasCopy := orasCopy
+	defer func() { orasCopy = oldOrasCopy }()
+	orasCopy = func(ctx context.Context, src oras.ReadOnlyTarget, srcRef string, dst oras.Target, dstRef string, opts oras.CopyOptions) (v1.Descriptor, error) {
+		if repo, ok := dst.(*remote.Repository); ok {
+			return oras.Copy(ctx, src, srcRef, store, repo.Reference.String(), opts)
+		}
+		return oras.Copy(ctx, store, srcRef, dst, dstRef, opts)
+	}
+
+	g := &OCIGatherer{}
+	desc, err := g.Push(context.Background(), dir, "oci://localhost:5000/my-repo", PushOptions{
+		ArtifactType: "application/vnd.test",
+		MediaTypes:   map[string]string{".rego": regoLayer},
+		Annotations:  map[string]string{"org.opencontainers.image.source": "https://example.com/policy"},
+	})
+	if err != nil {
+		t.Fatalf("Push returned an error: %v", err)
+	}
+
+	manifest, err := fetchManifest(context.Background(), store, desc)
+	if err != nil {
+		t.Fatalf("failed to fetch manifest: %v", err)
+	}
+	if manifest.ArtifactType != "application/vnd.test" {
+		t.Errorf("expected artifact type application/vnd.test, got %q", manifest.ArtifactType)
+	}
+	if manifest.Annotations["org.opencontainers.image.source"] != "https://example.com/policy" {
+		t.Errorf("expected the manifest annotations to be set, got %v", manifest.Annotations)
+	}
+	mediaTypes := map[string]string{}
+	for _, l := range manifest.Layers {
+		mediaTypes[l.Annotations[v1.AnnotationTitle]] = l.MediaType
+	}
+	want := map[string]string{"policy/main.rego": regoLayer, "data/data.json": v1.MediaTypeImageLayer}
+	if len(mediaTypes) != len(want) {
+		t.Errorf("expected layers %v, got %v", want, mediaTypes)
+	}
+	for name, mt := range want {
+		if mediaTypes[name] != mt {
+			t.Errorf("expected %s to have media type %s, got %q", name, mt, mediaTypes[name])
+		}
+	}
+
+	// Gathering the artifact recreates the directory
+	dst := t.TempDir()
+	meta, err := g.Gather(context.Background(), "oci://127.0.0.1:5000/my-repo:latest", dst)
+	if err != nil {
+		t.Fatalf("Gather returned an error: %v", err)
+	}
+	if got := meta.(*OCIMetadata).Digest; got != desc.Digest.String() {
+		t.Errorf("expected digest %s, got %s", desc.Digest, got)
+	}
+	b, err := os.ReadFile(filepath.Join(dst, "policy", "main.rego"))
+	if err != nil || string(b) != "package main" {
+		t.Errorf("expected policy/main.rego to be gathered, got %q, %v", b, err)
+	}
+}
+
+func TestOCIGatherer_Push_Errors(t *testing.T) {
+	g := &OCIGatherer{}
+	if _, err := g.Push(context.Background(), t.TempDir(), "oci://127.0.0.1:5000/my-repo:1.0", PushOptions{}); !errors.Is(err, ErrNothingToPush) {
+		t.Errorf("expected ErrNothingToPush, got %v", err)
+	}
+	digest := "oci://127.0.0.1:5000/my-repo@sha256:" + "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	if _, err := g.Push(context.Background(), writePolicyDir(t), digest, PushOptions{}); err == nil {
+		t.Error("expected an error pushing to a digest")
+	}
+}
+
+func TestSave(t *testing.T) {
+	layoutDir := t.TempDir()
+	desc, err := Save(context.Background(), writePolicyDir(t), layoutDir, "1.0", PushOptions{})
+	if err != nil {
+		t.Fatalf("Save returned an error: %v", err)
+	}
+
+	layout, err := oci.New(layoutDir)
+	if err != nil {
+		t.Fatalf("failed to open layout: %v", err)
+	}
+	resolved, err := layout.Resolve(context.Background(), "1.0")
+	if err != nil {
+		t.Fatalf("failed to resolve tag: %v", err)
+	}
+	if resolved.Digest != desc.Digest {
+		t.Errorf("expected tag 1.0 to resolve to %s, got %s", desc.Digest, resolved.Digest)
+	}
+	manifest, err := fetchManifest(context.Background(), layout, desc)
+	if err != nil {
+		t.Fatalf("failed to fetch manifest: %v", err)
+	}
+	if len(manifest.Layers) != 2 {
+		t.Errorf("expected 2 layers, .git left out, got %d", len(manifest.Layers))
+	}
+	if manifest.ArtifactType != oras.MediaTypeUnknownArtifact {
+		t.Errorf("expected the default artifact type, got %q", manifest.ArtifactType)
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package oci
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"oras.land/oras-go/v2"
+	"oras.land/oras-go/v2/content"
+	"oras.land/oras-go/v2/content/file"
+	"oras.land/oras-go/v2/registry"
+)
+
+// ReferrerOptions select the referrers of an artifact to download with it,
+// such as the attestations and SBOMs attached to an image.
+type ReferrerOptions struct {
+	// Enabled downloads the referrers of the manifest gathered, each into a
+	// directory of ReferrersDir named after its digest.
+	Enabled bool
+	// ArtifactTypes restricts the referrers downloaded to those of the
+	// given artifact types, e.g. "application/vnd.dev.sigstore.bundle+json".
+	// Every referrer is downloaded when it is empty.
+	ArtifactTypes []string
+}
+
+// Referrer describes a referrer downloaded with an artifact.
+type Referrer struct {
+	Digest       string
+	ArtifactType string
+	// Path is the directory the referrer was downloaded into.
+	Path string
+}
+
+var orasReferrers = registry.Referrers
+
+// ReferrersDir returns the directory the referrers of an artifact gathered
+// into dst are downloaded into, alongside dst rather than inside it.
+func ReferrersDir(dst string) string {
+	return filepath.Clean(dst) + ".referrers"
+}
+
+// pullReferrers downloads the referrers of desc, the manifest pulled from
+// the repository src as ref, into ReferrersDir(dst). The layers of a
+// referrer are written to files named by their title annotation, or by
+// their digest when they have none, as attestations usually do.
+func (o *OCIGatherer) pullReferrers(ctx context.Context, src oras.ReadOnlyGraphTarget, ref registry.Reference, desc ocispec.Descriptor, dst string) ([]Referrer, error) {
+	descs, err := orasReferrers(ctx, src, desc, "")
+	if err != nil {
+		return nil, fmt.Errorf("listing referrers of %s: %w", desc.Digest, err)
+	}
+
+	var referrers []Referrer
+	for _, r := range descs {
+		if len(o.PullReferrers.ArtifactTypes) > 0 && !slices.Contains(o.PullReferrers.ArtifactTypes, r.ArtifactType) {
+			continue
+		}
+		path := filepath.Join(ReferrersDir(dst), strings.Replace(r.Digest.String(), ":", "-", 1))
+		if err := os.MkdirAll(path, os.ModePerm); err != nil {
+			return nil, fmt.Errorf("failed to create directory: %w", err)
+		}
+		fileStore, err := file.New(path)
+		if err != nil {
+			return nil, fmt.Errorf("file store: %w", err)
+		}
+		opts := oras.DefaultCopyOptions
+		opts.FindSuccessors = titleLayers
+		pinned := ref
+		pinned.Reference = r.Digest.String()
+		_, err = orasCopy(ctx, verifyingTarget{src}, pinned.String(), fileStore, "", opts)
+		fileStore.Close()
+		if err != nil {
+			return nil, fmt.Errorf("pulling referrer %s: %w", r.Digest, err)
+		}
+		referrers = append(referrers, Referrer{Digest: r.Digest.String(), ArtifactType: r.ArtifactType, Path: path})
+	}
+	return referrers, nil
+}
+
+// titleLayers replaces content.Successors for copying a referrer. The
+// subject of a manifest, the artifact being gathered, is left out, and
+// layers without a title are named after their digest, so the file store
+// writes them to disk rather than keeping them in memory.
+func titleLayers(ctx context.Context, fetcher content.Fetcher, desc ocispec.Descriptor) ([]ocispec.Descriptor, error) {
+	if !isManifest(desc) {
+		return content.Successors(ctx, fetcher, desc)
+	}
+	manifest, err := fetchManifest(ctx, fetcher, desc)
+	if err != nil {
+		return nil, err
+	}
+	successors := []ocispec.Descriptor{manifest.Config}
+	for _, layer := range manifest.Layers {
+		if _, ok := layer.Annotations[ocispec.AnnotationTitle]; !ok {
+			annotations := make(map[string]string, len(layer.Annotations)+1)
+			for k, v := range layer.Annotations {
+				annotations[k] = v
+			}
+			annotations[ocispec.AnnotationTitle] = strings.Replace(layer.Digest.String(), ":", "-", 1)
+			layer.Annotations = annotations
+		}
+		successors = append(successors, layer)
+	}
+	return successors, nil
+}
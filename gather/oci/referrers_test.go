@@ -0,0 +1,105 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package oci
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"oras.land/oras-go/v2"
+	"oras.land/oras-go/v2/content"
+	"oras.land/oras-go/v2/content/memory"
+	"oras.land/oras-go/v2/registry"
+)
+
+// pushReferrer pushes an artifact of artifactType with a single untitled
+// layer holding data to store, referring to subject, and tags it with the
+// reference it is pulled by from repo.
+func pushReferrer(t *testing.T, store *memory.Store, repo string, subject v1.Descriptor, artifactType string, data []byte) v1.Descriptor {
+	t.Helper()
+	ctx := context.Background()
+	layer := v1.Descriptor{MediaType: "application/vnd.test.layer", Digest: digest.FromBytes(data), Size: int64(len(data))}
+	if err := store.Push(ctx, layer, bytes.NewReader(data)); err != nil {
+		t.Fatalf("failed to push layer: %v", err)
+	}
+	desc, err := oras.PackManifest(ctx, store, oras.PackManifestVersion1_1, artifactType, oras.PackManifestOptions{
+		Subject: &subject,
+		Layers:  []v1.Descriptor{layer},
+	})
+	if err != nil {
+		t.Fatalf("failed to pack manifest: %v", err)
+	}
+	if err := store.Tag(ctx, desc, repo+"@"+desc.Digest.String()); err != nil {
+		t.Fatalf("failed to tag referrer: %v", err)
+	}
+	return desc
+}
+
+func TestOCIGatherer_Gather_Referrers(t *testing.T) {
+	const repo = "127.0.0.1:5000/my-repo"
+	ctx := context.Background()
+	store := memory.New()
+	pushBundle(t, store, repo+":latest")
+	subject, err := store.Resolve(ctx, repo+":latest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sbom := pushReferrer(t, store, repo, subject, "application/spdx+json", []byte(`{"spdxVersion":"SPDX-2.3"}`))
+	pushReferrer(t, store, repo, subject, "application/vnd.in-toto+json", []byte(`{"_type":"https://in-toto.io/Statement/v1"}`))
+
+	oldOrasCopy, oldOrasReferrers := orasCopy, orasReferrers
+	defer func() { orasCopy, orasReferrers = oldOrasCopy, oldOrasReferrers }()
+	orasCopy = func(ctx context.Context, _ oras.ReadOnlyTarget, srcRef string, dst oras.Target, dstRef string, opts oras.CopyOptions) (v1.Descriptor, error) {
+		return oras.Copy(ctx, store, srcRef, dst, dstRef, opts)
+	}
+	orasReferrers = func(ctx context.Context, _ content.ReadOnlyGraphStorage, desc v1.Descriptor, artifactType string) ([]v1.Descriptor, error) {
+		return registry.Referrers(ctx, store, desc, artifactType)
+	}
+
+	dst := filepath.Join(t.TempDir(), "policy")
+	g := &OCIGatherer{PullReferrers: ReferrerOptions{Enabled: true, ArtifactTypes: []string{"application/spdx+json"}}}
+	meta, err := g.Gather(ctx, "oci://"+repo+":latest", dst)
+	if err != nil {
+		t.Fatalf("Gather returned an error: %v", err)
+	}
+
+	referrers := meta.(*OCIMetadata).Referrers
+	if len(referrers) != 1 || referrers[0].Digest != sbom.Digest.String() || referrers[0].ArtifactType != "application/spdx+json" {
+		t.Fatalf("expected only the SBOM to be downloaded, got %+v", referrers)
+	}
+	dir := referrers[0].Path
+	if want := filepath.Join(ReferrersDir(dst), strings.Replace(sbom.Digest.String(), ":", "-", 1)); dir != want {
+		t.Errorf("referrer downloaded into %s, want %s", dir, want)
+	}
+	layer := digest.FromBytes([]byte(`{"spdxVersion":"SPDX-2.3"}`))
+	if b, err := os.ReadFile(filepath.Join(dir, strings.Replace(layer.String(), ":", "-", 1))); err != nil || !strings.Contains(string(b), "SPDX-2.3") {
+		t.Errorf("expected the SBOM layer to be written, got %q, %v", b, err)
+	}
+	// The subject is not pulled again with the referrer
+	if _, err := os.Stat(filepath.Join(dir, "policy")); !os.IsNotExist(err) {
+		t.Errorf("expected the artifact to be left out of the referrer, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "policy", "main.rego")); err != nil {
+		t.Errorf("expected the artifact to be gathered: %v", err)
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package oci
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// RegistryOptions configure how a single registry is reached, such as a
+// local registry served over plain HTTP or with a self-signed certificate.
+type RegistryOptions struct {
+	// PlainHTTP talks to the registry over HTTP rather than HTTPS. Without
+	// options for a registry, only loopback registries are reached over
+	// HTTP.
+	PlainHTTP bool
+	// InsecureSkipVerify accepts any certificate the registry presents.
+	InsecureSkipVerify bool
+	// CACerts are PEM encoded certificates trusted for the registry in
+	// addition to the system roots, e.g. the CA of a self-signed registry.
+	CACerts []byte
+}
+
+// registryOptions returns the options for host, a registry host with an
+// optional port. Options keyed by the host alone apply to every port.
+func (o *OCIGatherer) registryOptions(host string) (RegistryOptions, bool) {
+	if opts, ok := o.Registries[host]; ok {
+		return opts, true
+	}
+	if name, _, err := net.SplitHostPort(host); err == nil {
+		opts, ok := o.Registries[name]
+		return opts, ok
+	}
+	return RegistryOptions{}, false
+}
+
+// transport returns base configured with the TLS settings of opts. Only an
+// *http.Transport can be configured.
+func (opts RegistryOptions) transport(base http.RoundTripper) (http.RoundTripper, error) {
+	if !opts.InsecureSkipVerify && len(opts.CACerts) == 0 {
+		return base, nil
+	}
+	t, ok := base.(*http.Transport)
+	if !ok {
+		return nil, errors.New("TLS options need Transport to be an *http.Transport")
+	}
+	t = t.Clone()
+	if t.TLSClientConfig == nil {
+		t.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	t.TLSClientConfig.InsecureSkipVerify = opts.InsecureSkipVerify // #nosec G402 requested for this registry
+	if len(opts.CACerts) > 0 {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(opts.CACerts) {
+			return nil, fmt.Errorf("no certificates found in CACerts")
+		}
+		t.TLSClientConfig.RootCAs = pool
+	}
+	return t, nil
+}
@@ -0,0 +1,157 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package oci
+
+import (
+	"context"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func TestOCIGatherer_registryOptions(t *testing.T) {
+	g := &OCIGatherer{Registries: map[string]RegistryOptions{
+		"registry.local":      {InsecureSkipVerify: true},
+		"registry.local:5000": {PlainHTTP: true},
+	}}
+	tests := []struct {
+		host string
+		want RegistryOptions
+		ok   bool
+	}{
+		{"registry.local:5000", RegistryOptions{PlainHTTP: true}, true},
+		{"registry.local:443", RegistryOptions{InsecureSkipVerify: true}, true},
+		{"registry.local", RegistryOptions{InsecureSkipVerify: true}, true},
+		{"quay.io", RegistryOptions{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			got, ok := g.registryOptions(tt.host)
+			if ok != tt.ok || got.PlainHTTP != tt.want.PlainHTTP || got.InsecureSkipVerify != tt.want.InsecureSkipVerify {
+				t.Errorf("registryOptions(%q) = %+v, %v, want %+v, %v", tt.host, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestOCIGatherer_newRepository_Registries(t *testing.T) {
+	data := []byte("data")
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", v1.MediaTypeImageManifest)
+		w.Header().Set("Docker-Content-Digest", digest.FromBytes(data).String())
+		w.Header().Set("Content-Length", "4")
+	}))
+	defer srv.Close()
+	host := strings.TrimPrefix(srv.URL, "https://")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+
+	tests := []struct {
+		name    string
+		opts    *RegistryOptions
+		wantErr bool
+	}{
+		// Loopback registries are reached over plain HTTP by default
+		{name: "default", wantErr: true},
+		{name: "untrusted", opts: &RegistryOptions{}, wantErr: true},
+		{name: "skip verify", opts: &RegistryOptions{InsecureSkipVerify: true}},
+		{name: "ca", opts: &RegistryOptions{CACerts: ca}},
+		{name: "plain http", opts: &RegistryOptions{PlainHTTP: true, CACerts: ca}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := &OCIGatherer{}
+			if tt.opts != nil {
+				g.Registries = map[string]RegistryOptions{host: *tt.opts}
+			}
+			repo, err := g.newRepository(host + "/policy:latest")
+			if err != nil {
+				t.Fatalf("newRepository returned an error: %v", err)
+			}
+			_, err = repo.Resolve(context.Background(), "latest")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Resolve() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	g := &OCIGatherer{Registries: map[string]RegistryOptions{host: {CACerts: []byte("not a certificate")}}}
+	if _, err := g.newRepository(host + "/policy:latest"); err == nil {
+		t.Error("expected an error for CACerts without certificates")
+	}
+}
+
+func TestOCIGatherer_newRepository_Proxy(t *testing.T) {
+	data := []byte("data")
+	var hosts []string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hosts = append(hosts, r.Host)
+		w.Header().Set("Content-Type", v1.MediaTypeImageManifest)
+		w.Header().Set("Docker-Content-Digest", digest.FromBytes(data).String())
+		w.Header().Set("Content-Length", "4")
+	}))
+	defer proxy.Close()
+
+	g := &OCIGatherer{
+		Registries: map[string]RegistryOptions{"registry.invalid": {PlainHTTP: true}},
+		Proxy:      proxy.URL,
+	}
+	repo, err := g.newRepository("registry.invalid/policy:latest")
+	if err != nil {
+		t.Fatalf("newRepository returned an error: %v", err)
+	}
+	if _, err := repo.Resolve(context.Background(), "latest"); err != nil {
+		t.Fatalf("Resolve returned an error: %v", err)
+	}
+	if len(hosts) == 0 || hosts[0] != "registry.invalid" {
+		t.Errorf("expected the registry to be reached through the proxy, got %v", hosts)
+	}
+
+	g.Proxy = "registry.invalid:3128"
+	if _, err := g.newRepository("registry.invalid/policy:latest"); err == nil {
+		t.Error("expected an error for a proxy without a scheme")
+	}
+}
+
+func TestRegistryOptions_transport(t *testing.T) {
+	custom := http.RoundTripper(roundTripperFunc(func(*http.Request) (*http.Response, error) { return nil, nil }))
+	if got, err := (RegistryOptions{PlainHTTP: true}).transport(custom); err != nil || got == nil {
+		t.Errorf("expected a transport without TLS options to be kept, got %v, %v", got, err)
+	}
+	if _, err := (RegistryOptions{InsecureSkipVerify: true}).transport(custom); err == nil {
+		t.Error("expected an error configuring TLS on a custom transport")
+	}
+	base := http.DefaultTransport.(*http.Transport)
+	got, err := (RegistryOptions{InsecureSkipVerify: true}).transport(base)
+	if err != nil {
+		t.Fatalf("transport returned an error: %v", err)
+	}
+	if got == base || !got.(*http.Transport).TLSClientConfig.InsecureSkipVerify {
+		t.Error("expected a copy of the transport skipping verification")
+	}
+	if base.TLSClientConfig != nil && base.TLSClientConfig.InsecureSkipVerify {
+		t.Error("expected the base transport to be left unchanged")
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
@@ -0,0 +1,90 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package oci
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"oras.land/oras-go/v2"
+	"oras.land/oras-go/v2/content"
+
+	"github.com/enterprise-contract/go-gather/gather"
+)
+
+// ErrDigestMismatch is returned when content pulled from a registry does not
+// match the digest it is referenced by.
+var ErrDigestMismatch = gather.NewError("digest mismatch", gather.ErrVerificationFailed)
+
+// verifyingTarget wraps a target so that every manifest and blob fetched from
+// it is checked against the digest and size of its descriptor, and digest
+// references resolve to that digest.
+type verifyingTarget struct {
+	oras.ReadOnlyTarget
+}
+
+func (t verifyingTarget) Resolve(ctx context.Context, reference string) (ocispec.Descriptor, error) {
+	desc, err := t.ReadOnlyTarget.Resolve(ctx, reference)
+	if err != nil {
+		return desc, err
+	}
+	if _, ref, ok := strings.Cut(reference, "@"); ok {
+		if want, err := digest.Parse(ref); err == nil && want != desc.Digest {
+			return ocispec.Descriptor{}, fmt.Errorf("%w: %s resolved to %s", ErrDigestMismatch, want, desc.Digest)
+		}
+	}
+	return desc, nil
+}
+
+func (t verifyingTarget) Fetch(ctx context.Context, target ocispec.Descriptor) (io.ReadCloser, error) {
+	rc, err := t.ReadOnlyTarget.Fetch(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+	return &verifyingReader{ReadCloser: rc, vr: content.NewVerifyReader(rc, target), desc: target}, nil
+}
+
+// verifyingReader reads the content of a descriptor, failing with
+// ErrDigestMismatch once as much as it describes is read if the content does
+// not match. Verifying then, rather than at EOF, reports the mismatch to
+// readers that stop after the expected size.
+type verifyingReader struct {
+	io.ReadCloser
+	vr   *content.VerifyReader
+	desc ocispec.Descriptor
+	read int64
+}
+
+func (r *verifyingReader) Read(p []byte) (int, error) {
+	n, err := r.vr.Read(p)
+	r.read += int64(n)
+	if err == nil && r.read == r.desc.Size {
+		err = r.vr.Verify()
+		if err == nil && n == 0 {
+			err = io.EOF
+		}
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
+		return n, fmt.Errorf("%w: content of %s: %v", ErrDigestMismatch, r.desc.Digest, err)
+	}
+	return n, err
+}
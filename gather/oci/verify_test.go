@@ -0,0 +1,108 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package oci
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/opencontainers/go-digest"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"oras.land/oras-go/v2"
+	"oras.land/oras-go/v2/content/memory"
+)
+
+// tamperedTarget serves data in place of every blob fetched.
+type tamperedTarget struct {
+	oras.ReadOnlyTarget
+	data []byte
+}
+
+func (t tamperedTarget) Fetch(context.Context, v1.Descriptor) (io.ReadCloser, error) {
+	return io.NopCloser(bytes.NewReader(t.data)), nil
+}
+
+func TestVerifyingTarget(t *testing.T) {
+	const ref = "127.0.0.1:5000/my-repo:latest"
+	store := memory.New()
+	if err := pushTestArtifact(store, ref, []byte("test data")); err != nil {
+		t.Fatalf("failed to push test artifact: %v", err)
+	}
+	ctx := context.Background()
+
+	if _, err := oras.Copy(ctx, verifyingTarget{store}, ref, memory.New(), "", oras.DefaultCopyOptions); err != nil {
+		t.Fatalf("copying intact content failed: %v", err)
+	}
+
+	tampered := verifyingTarget{tamperedTarget{store, []byte("fake data")}}
+	if _, err := oras.Copy(ctx, tampered, ref, memory.New(), "", oras.DefaultCopyOptions); !errors.Is(err, ErrDigestMismatch) {
+		t.Errorf("expected ErrDigestMismatch for tampered content, got %v", err)
+	}
+
+	desc, err := store.Resolve(ctx, ref)
+	if err != nil {
+		t.Fatalf("failed to resolve: %v", err)
+	}
+	other := "127.0.0.1:5000/my-repo@" + digest.FromString("other").String()
+	if err := store.Tag(ctx, desc, other); err != nil {
+		t.Fatalf("failed to tag: %v", err)
+	}
+	if _, err := (verifyingTarget{store}).Resolve(ctx, other); !errors.Is(err, ErrDigestMismatch) {
+		t.Errorf("expected ErrDigestMismatch resolving to another digest, got %v", err)
+	}
+}
+
+func TestOCIGatherer_Gather_Digest(t *testing.T) {
+	data := []byte("test data")
+	pinned := "127.0.0.1:5000/my-repo@" + digest.FromBytes(data).String()
+	wrong := "127.0.0.1:5000/my-repo@" + digest.FromString("other").String()
+	store := memory.New()
+	if err := pushTestArtifact(store, pinned, data); err != nil {
+		t.Fatalf("failed to push test artifact: %v", err)
+	}
+	desc, err := store.Resolve(context.Background(), pinned)
+	if err != nil {
+		t.Fatalf("failed to resolve: %v", err)
+	}
+	if err := store.Tag(context.Background(), desc, wrong); err != nil {
+		t.Fatalf("failed to tag: %v", err)
+	}
+
+	oldOrasCopy := orasCopy
+	defer func() { orasCopy = oldOrasCopy }()
+	orasCopy = func(ctx context.Context, srcOras oras.ReadOnlyTarget, srcRef string, dstOras oras.Target, dstRef string, opts oras.CopyOptions) (v1.Descriptor, error) {
+		return oras.Copy(ctx, store, srcRef, dstOras, dstRef, opts)
+	}
+
+	g := &OCIGatherer{}
+	meta, err := g.Gather(context.Background(), "oci::"+pinned, t.TempDir())
+	if err != nil {
+		t.Fatalf("Gather returned an error: %v", err)
+	}
+	m := meta.(*OCIMetadata)
+	if m.Digest != digest.FromBytes(data).String() || m.Tag != "" {
+		t.Errorf("unexpected metadata: %+v", m)
+	}
+
+	_, err = g.Gather(context.Background(), "oci::"+wrong, t.TempDir())
+	if !errors.Is(err, ErrDigestMismatch) {
+		t.Errorf("expected ErrDigestMismatch, got %v", err)
+	}
+}
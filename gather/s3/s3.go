@@ -0,0 +1,347 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"github.com/enterprise-contract/go-gather/expand"
+	"github.com/enterprise-contract/go-gather/fserrors"
+	"github.com/enterprise-contract/go-gather/gather"
+	"github.com/enterprise-contract/go-gather/internal/cloud"
+	"github.com/enterprise-contract/go-gather/internal/helpers"
+	"github.com/enterprise-contract/go-gather/internal/logging"
+	"github.com/enterprise-contract/go-gather/metadata"
+)
+
+// API is the subset of the S3 client used by the gatherer.
+type API interface {
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error)
+	ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
+}
+
+// S3Gatherer gathers objects, or every object under a prefix, from Amazon S3.
+// Credentials are resolved through the standard AWS chain (environment,
+// shared config and credentials files, SSO, web identity, instance roles).
+// When the chain yields none, requests are sent unsigned, which public
+// buckets accept. Presigned URLs are left to the HTTP gatherer.
+type S3Gatherer struct {
+	S3Metadata
+	// Client overrides the S3 client. When nil, a client is created from the
+	// default AWS configuration for every gather.
+	Client API
+	// Anonymous sends unsigned requests without looking for credentials,
+	// for public buckets.
+	Anonymous bool
+	// AccessKeyID and SecretAccessKey, when set, sign requests instead of
+	// the credentials of the chain.
+	AccessKeyID     string
+	SecretAccessKey string
+}
+
+type S3Metadata struct {
+	URI       string
+	Bucket    string
+	Key       string
+	Path      string
+	Size      int64
+	Objects   int
+	ETag      string
+	Timestamp string
+	// SecurityChecks records the protections applied to object keys.
+	SecurityChecks []metadata.SecurityCheck
+	// Skipped lists the objects that were left out, and why.
+	Skipped []metadata.SkippedEntry
+	// Sizes reports the sizes of the files gathered.
+	Sizes *metadata.SizeReport
+}
+
+// defaultRegion is the region of buckets whose region is neither in their
+// URI nor configured.
+const defaultRegion = "us-east-1"
+
+// newClientFunc builds an S3 client from the default AWS configuration. When
+// creds is nil the credentials of the chain are used, and requests are sent
+// unsigned if none are found.
+var newClientFunc = func(ctx context.Context, region string, creds aws.CredentialsProvider) (API, error) {
+	var opts []func(*config.LoadOptions) error
+	if region != "" {
+		opts = append(opts, config.WithRegion(region))
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Region == "" {
+		cfg.Region = defaultRegion
+	}
+	if creds == nil {
+		creds = cfg.Credentials
+		if creds == nil {
+			creds = aws.AnonymousCredentials{}
+		} else if _, err := creds.Retrieve(ctx); err != nil {
+			logging.Debug(ctx, "no AWS credentials found, sending unsigned requests", "error", err)
+			creds = aws.AnonymousCredentials{}
+		}
+	}
+	cfg.Credentials = creds
+	return s3.NewFromConfig(cfg), nil
+}
+
+// credentials returns the credentials configured for the gatherer, or nil to
+// look for them in the chain.
+func (s *S3Gatherer) credentials() aws.CredentialsProvider {
+	switch {
+	case s.Anonymous:
+		return aws.AnonymousCredentials{}
+	case s.AccessKeyID != "" || s.SecretAccessKey != "":
+		return aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: s.AccessKeyID, SecretAccessKey: s.SecretAccessKey, Source: "S3Gatherer"}, nil
+		})
+	}
+	return nil
+}
+
+func (s *S3Gatherer) Matcher(uri string) bool {
+	return cloud.IsS3URI(uri)
+}
+
+// Gather downloads the object addressed by src to dst. If src names a prefix
+// (it ends in "/" or no object exists with that key), every object under the
+// prefix is downloaded into the dst directory, preserving relative paths.
+func (s *S3Gatherer) Gather(ctx context.Context, src, dst string) (_ metadata.Metadata, err error) {
+	defer func() { err = fserrors.Classify(err) }()
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+
+	loc, err := cloud.ParseS3(src)
+	if err != nil {
+		return nil, err
+	}
+
+	dst, err = helpers.ExpandPath(dst)
+	if err != nil {
+		return nil, fmt.Errorf("failed to expand destination path: %w", err)
+	}
+
+	client := s.Client
+	if client == nil {
+		if client, err = newClientFunc(ctx, loc.Region, s.credentials()); err != nil {
+			return nil, fmt.Errorf("failed to load AWS configuration: %w", err)
+		}
+	}
+
+	m := &S3Metadata{URI: src, Bucket: loc.Bucket, Key: loc.Key}
+
+	// A key naming a single object the sandbox does not allow is only
+	// gathered as a prefix, reporting the sandbox if that finds nothing
+	sandbox := expand.SandboxFromContext(ctx)
+	var outside string
+	if loc.Key != "" && !strings.HasSuffix(loc.Key, "/") {
+		target, rel := dst, "."
+		if strings.HasSuffix(dst, "/") || isDir(dst) {
+			target = filepath.Join(dst, path.Base(loc.Key))
+			rel = path.Base(loc.Key)
+		}
+		if !sandbox.Permits(rel, false) {
+			outside = rel
+		} else {
+			size, etag, err := getObject(ctx, client, loc.Bucket, loc.Key, target)
+			if err == nil {
+				m.Path = target
+				m.Size = size
+				m.Objects = 1
+				m.ETag = etag
+				if m.Sizes, err = metadata.ScanSizes(ctx, target, metadata.LargestFiles); err != nil {
+					return nil, fmt.Errorf("failed to report sizes: %w", err)
+				}
+				m.Timestamp = time.Now().Format(time.RFC3339)
+				s.S3Metadata = *m
+				return &s.S3Metadata, nil
+			}
+			var noKey *types.NoSuchKey
+			if !errors.As(err, &noKey) {
+				return nil, err
+			}
+		}
+		// No object with that key, or one outside the sandbox, fall back
+		// to treating it as a prefix.
+		loc.Key += "/"
+	}
+
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create destination directory: %w", err)
+	}
+
+	ctx, trace := metadata.WithSecurityTrace(ctx)
+	paginator := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(loc.Bucket),
+		Prefix: aws.String(loc.Key),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list objects in s3://%s/%s: %w", loc.Bucket, loc.Key, err)
+		}
+		for _, obj := range page.Contents {
+			key := aws.ToString(obj.Key)
+			rel := strings.TrimPrefix(key, loc.Key)
+			if rel == "" || strings.HasSuffix(rel, "/") {
+				// Folder placeholder objects carry no content.
+				continue
+			}
+			target := filepath.Join(dst, filepath.FromSlash(rel)) // #nosec G305 checked below
+			if !strings.HasPrefix(target, filepath.Clean(dst)+string(os.PathSeparator)) {
+				trace.Record(metadata.SecurityCheck{Check: "path-sanitization", Subject: key, Outcome: metadata.CheckRejected, Detail: "object key escapes the destination"})
+				return nil, fmt.Errorf("illegal object key: %s", key)
+			}
+			if ok, err := sandbox.Check(trace, rel, false); err != nil {
+				return nil, err
+			} else if !ok {
+				m.Skipped = append(m.Skipped, metadata.SkippedEntry{Path: rel, Reason: metadata.SkipSandbox})
+				continue
+			}
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return nil, fmt.Errorf("failed to create directory: %w", err)
+			}
+			size, _, err := getObject(ctx, client, loc.Bucket, key, target)
+			if err != nil {
+				return nil, err
+			}
+			m.Size += size
+			m.Objects++
+		}
+	}
+
+	if m.Objects == 0 {
+		if outside != "" {
+			return nil, sandbox.Require(trace, outside, false)
+		}
+		return nil, fmt.Errorf("no objects found at s3://%s/%s", loc.Bucket, loc.Key)
+	}
+
+	trace.Record(metadata.SecurityCheck{Check: "path-sanitization", Subject: src, Outcome: metadata.CheckPassed, Detail: fmt.Sprintf("%d object keys confined to the destination", m.Objects)})
+	m.SecurityChecks = trace.Checks()
+	m.Path = dst
+	if m.Sizes, err = metadata.ScanSizes(ctx, dst, metadata.LargestFiles); err != nil {
+		return nil, fmt.Errorf("failed to report sizes: %w", err)
+	}
+	m.Timestamp = time.Now().Format(time.RFC3339)
+	s.S3Metadata = *m
+	return &s.S3Metadata, nil
+}
+
+func (s *S3Metadata) Get() interface{} {
+	return s
+}
+
+// Relocate updates Path for what was gathered having moved from from to
+// to.
+func (s *S3Metadata) Relocate(from, to string) {
+	s.Path = metadata.RelocatePath(s.Path, from, to)
+}
+
+// GetSecurityChecks returns the security checks performed during the gather.
+func (s S3Metadata) GetSecurityChecks() []metadata.SecurityCheck {
+	return s.SecurityChecks
+}
+
+// GetSkipped returns the objects the gather left out.
+func (s S3Metadata) GetSkipped() []metadata.SkippedEntry {
+	return s.Skipped
+}
+
+// GetSizeReport returns the sizes of the files gathered.
+func (s S3Metadata) GetSizeReport() *metadata.SizeReport {
+	return s.Sizes
+}
+
+// GetSummary returns the summary of the gather, pinned to the ETag of a
+// single object.
+func (s S3Metadata) GetSummary() metadata.Summary {
+	sum := metadata.NewSummary("s3", s.URI, s.Path, s.Timestamp, s.Sizes)
+	if s.Sizes == nil {
+		sum.Files, sum.Bytes = s.Objects, s.Size
+	}
+	sum.Revision = s.ETag
+	sum.Detail("bucket", s.Bucket)
+	sum.Detail("key", s.Key)
+	return sum
+}
+
+func (s S3Metadata) GetPinnedURL(u string) (string, error) {
+	if len(u) == 0 {
+		return "", fmt.Errorf("empty URL")
+	}
+	if s.Bucket == "" {
+		return "", fmt.Errorf("bucket not set")
+	}
+	return fmt.Sprintf("s3::s3://%s/%s", s.Bucket, s.Key), nil
+}
+
+// getObject downloads a single object to path, returning its size and ETag.
+func getObject(ctx context.Context, client API, bucket, key, path string) (int64, string, error) {
+	out, err := client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to get s3://%s/%s: %w", bucket, key, err)
+	}
+	defer out.Body.Close()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return 0, "", fmt.Errorf("failed to create destination directory: %w", err)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to create destination file: %w", err)
+	}
+	defer f.Close()
+
+	n, err := io.Copy(f, out.Body)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to write s3://%s/%s: %w", bucket, key, err)
+	}
+	return n, strings.Trim(aws.ToString(out.ETag), `"`), nil
+}
+
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+func init() {
+	gather.RegisterGatherer(&S3Gatherer{})
+}
@@ -0,0 +1,232 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package s3
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/enterprise-contract/go-gather/expand"
+)
+
+// fakeS3 serves objects from an in-memory bucket.
+type fakeS3 struct {
+	bucket  string
+	objects map[string]string
+}
+
+func (f *fakeS3) GetObject(ctx context.Context, in *s3.GetObjectInput, _ ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	if aws.ToString(in.Bucket) != f.bucket {
+		return nil, errors.New("no such bucket")
+	}
+	body, ok := f.objects[aws.ToString(in.Key)]
+	if !ok {
+		return nil, &types.NoSuchKey{}
+	}
+	return &s3.GetObjectOutput{
+		Body: io.NopCloser(strings.NewReader(body)),
+		ETag: aws.String(`"etag-` + aws.ToString(in.Key) + `"`),
+	}, nil
+}
+
+func (f *fakeS3) ListObjectsV2(ctx context.Context, in *s3.ListObjectsV2Input, _ ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	var keys []string
+	for k := range f.objects {
+		if strings.HasPrefix(k, aws.ToString(in.Prefix)) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	out := &s3.ListObjectsV2Output{}
+	for _, k := range keys {
+		out.Contents = append(out.Contents, types.Object{Key: aws.String(k)})
+	}
+	return out, nil
+}
+
+func newFake() *fakeS3 {
+	return &fakeS3{
+		bucket: "bucket",
+		objects: map[string]string{
+			"policies/":              "",
+			"policies/main.rego":     "package main",
+			"policies/lib/util.rego": "package lib",
+			"other/file.txt":         "other",
+		},
+	}
+}
+
+func TestS3Gatherer_Matcher(t *testing.T) {
+	g := &S3Gatherer{}
+
+	testCases := []struct {
+		uri  string
+		want bool
+	}{
+		{"s3://bucket/key", true},
+		{"s3::https://bucket.s3.amazonaws.com/key", true},
+		{"https://bucket.s3.eu-west-1.amazonaws.com/key", true},
+		{"https://example.com/key", false},
+		{"https://bucket.s3.amazonaws.com/key?X-Amz-Signature=abc", false},
+		{"oci::quay.io/org/repo", false},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.uri, func(t *testing.T) {
+			assert.Equal(t, tc.want, g.Matcher(tc.uri))
+		})
+	}
+}
+
+func TestS3Gatherer_Gather_Object(t *testing.T) {
+	g := &S3Gatherer{Client: newFake()}
+	dst := t.TempDir()
+
+	m, err := g.Gather(context.Background(), "s3://bucket/policies/main.rego", dst)
+	require.NoError(t, err)
+
+	meta := m.(*S3Metadata)
+	assert.Equal(t, filepath.Join(dst, "main.rego"), meta.Path)
+	assert.Equal(t, 1, meta.Objects)
+	assert.Equal(t, int64(len("package main")), meta.Size)
+	assert.Equal(t, "etag-policies/main.rego", meta.ETag)
+
+	content, err := os.ReadFile(meta.Path)
+	require.NoError(t, err)
+	assert.Equal(t, "package main", string(content))
+}
+
+func TestS3Gatherer_Gather_Prefix(t *testing.T) {
+	for _, src := range []string{"s3://bucket/policies/", "s3://bucket/policies"} {
+		t.Run(src, func(t *testing.T) {
+			g := &S3Gatherer{Client: newFake()}
+			dst := filepath.Join(t.TempDir(), "out")
+
+			m, err := g.Gather(context.Background(), src, dst)
+			require.NoError(t, err)
+
+			meta := m.(*S3Metadata)
+			assert.Equal(t, dst, meta.Path)
+			assert.Equal(t, 2, meta.Objects)
+
+			content, err := os.ReadFile(filepath.Join(dst, "lib", "util.rego"))
+			require.NoError(t, err)
+			assert.Equal(t, "package lib", string(content))
+			_, err = os.Stat(filepath.Join(dst, "file.txt"))
+			assert.True(t, os.IsNotExist(err))
+		})
+	}
+}
+
+func TestS3Gatherer_Gather_Sandbox(t *testing.T) {
+	g := &S3Gatherer{Client: newFake()}
+	ctx := expand.WithSandbox(context.Background(), expand.Sandbox{Allow: []string{"lib"}, Skip: true})
+
+	dst := t.TempDir()
+	m, err := g.Gather(ctx, "s3://bucket/policies/", dst)
+	require.NoError(t, err)
+	assert.Equal(t, 1, m.(*S3Metadata).Objects)
+	assert.FileExists(t, filepath.Join(dst, "lib", "util.rego"))
+	assert.NoFileExists(t, filepath.Join(dst, "main.rego"))
+
+	_, err = g.Gather(ctx, "s3://bucket/policies/main.rego", t.TempDir()+"/")
+	assert.ErrorIs(t, err, expand.ErrOutsideSandbox)
+}
+
+func TestS3Gatherer_Gather_NotFound(t *testing.T) {
+	g := &S3Gatherer{Client: newFake()}
+
+	_, err := g.Gather(context.Background(), "s3://bucket/missing", t.TempDir())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no objects found")
+}
+
+func TestS3Gatherer_Gather_ClientError(t *testing.T) {
+	orig := newClientFunc
+	defer func() { newClientFunc = orig }()
+	newClientFunc = func(ctx context.Context, region string, creds aws.CredentialsProvider) (API, error) {
+		assert.Equal(t, "us-east-2", region)
+		assert.Nil(t, creds)
+		return nil, errors.New("no credentials")
+	}
+
+	g := &S3Gatherer{}
+	_, err := g.Gather(context.Background(), "https://bucket.s3.us-east-2.amazonaws.com/key", t.TempDir())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed to load AWS configuration")
+}
+
+func TestNewClient_Anonymous(t *testing.T) {
+	// Nothing of the credential chain is there
+	dir := t.TempDir()
+	for _, env := range []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN", "AWS_PROFILE", "AWS_REGION", "AWS_DEFAULT_REGION", "AWS_WEB_IDENTITY_TOKEN_FILE", "AWS_CONTAINER_CREDENTIALS_FULL_URI", "AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"} {
+		t.Setenv(env, "")
+	}
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "credentials"))
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+
+	api, err := newClientFunc(context.Background(), "", nil)
+	require.NoError(t, err)
+	// The client drops anonymous credentials, leaving requests unsigned
+	opts := api.(*s3.Client).Options()
+	assert.Nil(t, opts.Credentials)
+	assert.Equal(t, "us-east-1", opts.Region)
+
+	// Credentials found are used
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKID")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	api, err = newClientFunc(context.Background(), "eu-west-1", nil)
+	require.NoError(t, err)
+	opts = api.(*s3.Client).Options()
+	assert.NotNil(t, opts.Credentials)
+	assert.Equal(t, "eu-west-1", opts.Region)
+
+	// Unless asked not to
+	api, err = newClientFunc(context.Background(), "", (&S3Gatherer{Anonymous: true}).credentials())
+	require.NoError(t, err)
+	assert.Nil(t, api.(*s3.Client).Options().Credentials)
+
+	// Or given others
+	api, err = newClientFunc(context.Background(), "", (&S3Gatherer{AccessKeyID: "key", SecretAccessKey: "other"}).credentials())
+	require.NoError(t, err)
+	creds, err := api.(*s3.Client).Options().Credentials.Retrieve(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "key", creds.AccessKeyID)
+	assert.Equal(t, "other", creds.SecretAccessKey)
+}
+
+func TestS3Metadata_GetPinnedURL(t *testing.T) {
+	m := S3Metadata{Bucket: "bucket", Key: "policies/main.rego"}
+	got, err := m.GetPinnedURL("https://bucket.s3.amazonaws.com/policies/main.rego")
+	require.NoError(t, err)
+	assert.Equal(t, "s3::s3://bucket/policies/main.rego", got)
+
+	_, err = m.GetPinnedURL("")
+	assert.Error(t, err)
+}
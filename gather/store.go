@@ -0,0 +1,48 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import "github.com/enterprise-contract/go-gather/internal/cloud"
+
+// Object stores sources can address, as returned by ObjectStore.
+const (
+	// StoreS3 is Amazon S3, addressed as "s3://bucket/key", "s3::…" or an
+	// HTTPS endpoint such as "https://bucket.s3.amazonaws.com/key".
+	StoreS3 = cloud.S3
+	// StoreGCS is Google Cloud Storage, addressed as "gs://bucket/object",
+	// "gcs::…" or an HTTPS endpoint such as
+	// "https://storage.googleapis.com/bucket/object".
+	StoreGCS = cloud.GCS
+	// StoreAzure is Azure Blob Storage, addressed as
+	// "azblob://container/blob", "azblob::…" or an HTTPS endpoint such as
+	// "https://account.blob.core.windows.net/container/blob".
+	StoreAzure = cloud.Azure
+)
+
+// ObjectStore returns the cloud object store uri addresses, one of StoreS3,
+// StoreGCS and StoreAzure, or an empty string if it addresses none. The
+// HTTP gatherer leaves sources addressing an object store to the gatherers
+// of the stores, gathering their HTTPS endpoints only when none accepts
+// them, see FallbackMatcher, so that the Matcher of a gatherer for a store
+// can be written as
+//
+//	func (g *GCSGatherer) Matcher(uri string) bool {
+//		return gather.ObjectStore(uri) == gather.StoreGCS
+//	}
+func ObjectStore(uri string) string {
+	return cloud.Store(uri)
+}
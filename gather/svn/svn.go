@@ -0,0 +1,261 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package svn
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/enterprise-contract/go-gather/expand"
+	"github.com/enterprise-contract/go-gather/fserrors"
+	"github.com/enterprise-contract/go-gather/gather"
+	"github.com/enterprise-contract/go-gather/internal/helpers"
+	"github.com/enterprise-contract/go-gather/metadata"
+)
+
+// Command is the Subversion client binary invoked by the gatherer.
+var Command = "svn"
+
+// exportedRevision matches the summary line printed by "svn export".
+var exportedRevision = regexp.MustCompile(`(?m)^Exported revision (\d+)\.`)
+
+// SVNGatherer exports a path of a Subversion repository, without any working
+// copy metadata, using the svn command line client. Sources take the form
+// svn::<repository URL>[?rev=<revision>], for example
+// "svn::https://svn.example.com/repo/trunk/policy?rev=1234". Without a
+// revision the youngest (HEAD) revision is exported. Credentials in the URL's
+// user info are passed to svn.
+type SVNGatherer struct {
+	SVNMetadata
+	// Username and Password are passed to svn when the URL carries no user
+	// info.
+	Username string
+	Password string
+	// InsecureSkipVerify accepts any certificate the server presents.
+	InsecureSkipVerify bool
+}
+
+type SVNMetadata struct {
+	URI string
+	// Repository is the URL that was exported, without the revision or
+	// credentials.
+	Repository string
+	// Revision is the revision that was exported.
+	Revision  string
+	Path      string
+	Timestamp string
+	// Skipped lists the files of the export that were left out, and why.
+	Skipped []metadata.SkippedEntry
+	// Sizes reports the sizes of the files gathered.
+	Sizes *metadata.SizeReport
+}
+
+func (s *SVNGatherer) Matcher(uri string) bool {
+	return strings.HasPrefix(uri, "svn::")
+}
+
+// Gather exports the repository path addressed by src to the dst directory.
+func (s *SVNGatherer) Gather(ctx context.Context, src, dst string) (_ metadata.Metadata, err error) {
+	defer func() { err = fserrors.Classify(err) }()
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+
+	repo, rev, user, password, err := parseSource(src)
+	if err != nil {
+		return nil, err
+	}
+	if user == "" && password == "" {
+		user, password = s.Username, s.Password
+	}
+
+	dst, err = helpers.ExpandPath(dst)
+	if err != nil {
+		return nil, fmt.Errorf("failed to expand destination path: %w", err)
+	}
+
+	args := []string{"export", "--force", "--non-interactive"}
+	if rev != "" {
+		args = append(args, "--revision", rev)
+	}
+	if user != "" {
+		args = append(args, "--username", user, "--password-from-stdin", "--no-auth-cache")
+	}
+	if s.InsecureSkipVerify {
+		args = append(args, "--trust-server-cert-failures=unknown-ca,cn-mismatch,expired,not-yet-valid,other")
+	}
+	// Under a sandbox the export is staged and only what it allows is
+	// copied to dst
+	sandbox := expand.SandboxFromContext(ctx)
+	exportDst := dst
+	if sandbox != nil {
+		tmpDir, err := os.MkdirTemp("", "svn-export-")
+		if err != nil {
+			return nil, fmt.Errorf("error creating temporary directory: %w", err)
+		}
+		defer os.RemoveAll(tmpDir)
+		exportDst = filepath.Join(tmpDir, "export")
+	}
+	// "--" keeps a repository URL or path starting with "-" from being read
+	// as an option
+	args = append(args, "--", repo, exportDst)
+
+	cmd := exec.CommandContext(ctx, Command, args...)
+	if user != "" {
+		cmd.Stdin = strings.NewReader(password + "\n")
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			return nil, fmt.Errorf("the %q command is required to gather from Subversion: %w", Command, err)
+		}
+		return nil, fmt.Errorf("svn export of %s failed: %w: %s", repo, err, strings.TrimSpace(stderr.String()))
+	}
+
+	if match := exportedRevision.FindStringSubmatch(stdout.String()); match != nil {
+		rev = match[1]
+	}
+
+	var skipped []metadata.SkippedEntry
+	if sandbox != nil {
+		if skipped, err = copySandboxed(ctx, exportDst, dst); err != nil {
+			return nil, err
+		}
+	}
+
+	s.URI = src
+	s.Repository = repo
+	s.Revision = rev
+	s.Path = dst
+	s.Skipped = skipped
+	if s.Sizes, err = metadata.ScanSizes(ctx, dst, metadata.LargestFiles); err != nil {
+		return nil, fmt.Errorf("failed to report sizes: %w", err)
+	}
+	s.Timestamp = time.Now().Format(time.RFC3339)
+	return &s.SVNMetadata, nil
+}
+
+// copySandboxed copies the export at src to dst, leaving out what the
+// sandbox carried by ctx does not allow and returning what it left out.
+func copySandboxed(ctx context.Context, src, dst string) ([]metadata.SkippedEntry, error) {
+	info, err := os.Stat(src)
+	if err != nil {
+		return nil, fmt.Errorf("error reading export: %w", err)
+	}
+	if !info.IsDir() {
+		if err := expand.SandboxFromContext(ctx).Require(metadata.SecurityTraceFromContext(ctx), ".", false); err != nil {
+			return nil, err
+		}
+		return nil, helpers.CopyFileContext(ctx, src, dst)
+	}
+	filter := expand.NewCopyFilter(ctx, src, expand.HiddenFiles{})
+	if err := helpers.CopyDirFilterContext(ctx, src, dst, filter.Skip); err != nil {
+		return nil, fmt.Errorf("error copying export: %w", err)
+	}
+	return filter.Skipped, filter.Err()
+}
+
+// parseSource splits an svn:: source into the repository URL, the requested
+// revision and any credentials.
+func parseSource(src string) (repo, rev, user, password string, err error) {
+	u, err := url.Parse(strings.TrimPrefix(src, "svn::"))
+	if err != nil {
+		return "", "", "", "", fmt.Errorf("failed to parse source URI: %w", err)
+	}
+	switch u.Scheme {
+	case "http", "https", "svn", "svn+ssh", "file":
+	default:
+		return "", "", "", "", fmt.Errorf("unsupported Subversion URL scheme: %q", u.Scheme)
+	}
+
+	q := u.Query()
+	rev = q.Get("rev")
+	q.Del("rev")
+	u.RawQuery = q.Encode()
+	u.Fragment = ""
+
+	if u.User != nil && u.Scheme != "svn+ssh" {
+		user = u.User.Username()
+		password, _ = u.User.Password()
+		u.User = nil
+	}
+	return u.String(), rev, user, password, nil
+}
+
+func (s *SVNMetadata) Get() interface{} {
+	return s
+}
+
+// Relocate updates Path for what was gathered having moved from from to
+// to.
+func (s *SVNMetadata) Relocate(from, to string) {
+	s.Path = metadata.RelocatePath(s.Path, from, to)
+}
+
+// GetSkipped returns the files of the export the gather left out.
+func (s SVNMetadata) GetSkipped() []metadata.SkippedEntry {
+	return s.Skipped
+}
+
+// GetSizeReport returns the sizes of the files gathered.
+func (s SVNMetadata) GetSizeReport() *metadata.SizeReport {
+	return s.Sizes
+}
+
+// GetSummary returns the summary of the export, pinned to its revision.
+func (s SVNMetadata) GetSummary() metadata.Summary {
+	sum := metadata.NewSummary("svn", s.URI, s.Path, s.Timestamp, s.Sizes)
+	sum.Revision = s.Revision
+	sum.Detail("repository", s.Repository)
+	return sum
+}
+
+// GetPinnedURL returns the source pinned to the revision that was exported.
+func (s SVNMetadata) GetPinnedURL(u string) (string, error) {
+	if len(u) == 0 {
+		return "", fmt.Errorf("empty URL")
+	}
+	if s.Repository == "" || s.Revision == "" {
+		return "", fmt.Errorf("no revision recorded")
+	}
+	pinned, err := url.Parse(s.Repository)
+	if err != nil {
+		return "", err
+	}
+	q := pinned.Query()
+	q.Set("rev", s.Revision)
+	pinned.RawQuery = q.Encode()
+	return "svn::" + pinned.String(), nil
+}
+
+func init() {
+	gather.RegisterGatherer(&SVNGatherer{})
+}
@@ -0,0 +1,167 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package gather
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/enterprise-contract/go-gather/internal/cloud"
+	"github.com/enterprise-contract/go-gather/internal/helpers"
+	"github.com/enterprise-contract/go-gather/internal/logging"
+)
+
+// ParsedURI holds the components of a source, as returned by ParseURI.
+type ParsedURI struct {
+	// Type is the kind of source: the forced gatherer of "git::…" sources,
+	// the object store of cloud storage URLs, see ObjectStore, "git" for
+	// SSH sources in the "git@host:org/repo" form, the scheme of other
+	// URLs and "file" for local paths. It is empty for references without a
+	// scheme, such as "github.com/org/repo" or "ghcr.io/org/policy:v1",
+	// which only the Matcher of a gatherer can tell apart.
+	Type string
+	// Forced is whether Type was forced with a "<type>::" prefix.
+	Forced bool
+	// Scheme is the scheme of the source, "ssh" for sources in the
+	// "git@host:org/repo" form, and empty for paths and references
+	// without one.
+	Scheme string
+	// Host is the host, and port if there is one, of the source, empty for
+	// local paths.
+	Host string
+	// Path is the path of the source, without its subdirectory, tag or
+	// digest. For local paths it is the path on disk, such as "C:\policy"
+	// for "file:///C:\policy".
+	Path string
+	// Ref is the revision of the source: the "ref" query parameter, or the
+	// tag or digest of an OCI reference, such as "v1" of
+	// "oci://ghcr.io/org/policy:v1".
+	Ref string
+	// Subdir is the "//" subdirectory of the source, see SplitSubdir.
+	Subdir string
+	// Query holds the query parameters of the source, other than "ref".
+	Query url.Values
+}
+
+// scpSource matches SSH sources in the "git@host:org/repo" form.
+var scpSource = regexp.MustCompile(`^[\w.-]+@([\w.-]+):([^/].*)$`)
+
+// ParseURI splits input into its components, following the go-getter
+// syntax the gatherers accept, so that callers needing the host or revision
+// of a source do not have to parse it themselves. It does not tell whether
+// any gatherer accepts input, GetGatherer does.
+func ParseURI(input string) (*ParsedURI, error) {
+	if strings.TrimSpace(input) == "" {
+		return nil, fmt.Errorf("invalid source: empty")
+	}
+	p := &ParsedURI{}
+	src := input
+	if i := strings.Index(src, "::"); i > 0 && !strings.ContainsAny(src[:i], "/?#:") {
+		p.Type, p.Forced, src = src[:i], true, src[i+2:]
+	}
+	src, p.Subdir = SplitSubdir(src)
+
+	var query string
+	switch {
+	case isLocalSource(src):
+		src, query, _ = strings.Cut(src, "?")
+		p.Path = helpers.LocalPath(strings.TrimPrefix(src, "file://"))
+		p.setType("file")
+	case scpSource.MatchString(src) && !strings.Contains(src, "://"):
+		m := scpSource.FindStringSubmatch(src)
+		p.Scheme, p.Host = "ssh", m[1]
+		p.Path, query, _ = strings.Cut(m[2], "?")
+		p.setType("git")
+	default:
+		// References without a scheme are parsed as if they had one, for
+		// their host to be told from their path
+		ref := src
+		if !hasScheme(src) {
+			ref = "//" + src
+		}
+		u, err := url.Parse(ref)
+		if err != nil {
+			// The *url.Error names the source, password and all
+			var urlErr *url.Error
+			if errors.As(err, &urlErr) {
+				err = urlErr.Err
+			}
+			return nil, fmt.Errorf("invalid source %q: %w", logging.Redact(input), err)
+		}
+		p.Scheme, p.Host, p.Path, query = u.Scheme, u.Host, u.Path, u.RawQuery
+		if p.Scheme == "oci" || p.Scheme == "" {
+			p.Path, p.Ref = splitReference(p.Path)
+		}
+		if store := cloud.Store(input); store != "" {
+			p.setType(store)
+		}
+		p.setType(p.Scheme)
+	}
+
+	q, err := url.ParseQuery(query)
+	if err != nil {
+		return nil, fmt.Errorf("invalid query of source %q: %w", logging.Redact(input), err)
+	}
+	if q.Has("ref") {
+		p.Ref = q.Get("ref")
+		q.Del("ref")
+	}
+	p.Query = q
+	return p, nil
+}
+
+// setType sets the type of p unless it has one already.
+func (p *ParsedURI) setType(typ string) {
+	if p.Type == "" {
+		p.Type = typ
+	}
+}
+
+// isLocalSource reports whether src is a local path, or a "file://" URL.
+func isLocalSource(src string) bool {
+	if helpers.IsWindowsPath(src) {
+		return true
+	}
+	for _, prefix := range []string{"file://", "/", "./", "../", "~"} {
+		if strings.HasPrefix(src, prefix) {
+			return true
+		}
+	}
+	return src == "." || src == ".."
+}
+
+// hasScheme reports whether src starts with a scheme, as in "https://".
+func hasScheme(src string) bool {
+	scheme, _, ok := strings.Cut(src, "://")
+	return ok && len(scheme) > 1 && !strings.ContainsAny(scheme, "/?#")
+}
+
+// splitReference splits the digest, as in "repo@sha256:…", or the tag, as
+// in "repo:v1", off the path of an OCI reference.
+func splitReference(path string) (string, string) {
+	if repo, digest, ok := strings.Cut(path, "@"); ok {
+		return repo, digest
+	}
+	slash := strings.LastIndex(path, "/")
+	if i := strings.LastIndex(path, ":"); i > slash {
+		return path[:i], path[i+1:]
+	}
+	return path, ""
+}
@@ -0,0 +1,382 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package webdav
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/enterprise-contract/go-gather/expand"
+	"github.com/enterprise-contract/go-gather/fserrors"
+	"github.com/enterprise-contract/go-gather/gather"
+	"github.com/enterprise-contract/go-gather/internal/helpers"
+	"github.com/enterprise-contract/go-gather/metadata"
+)
+
+// prefixes force a source to be gathered over WebDAV, e.g.
+// "dav::https://cloud.example.com/remote.php/dav/files/me/policies/".
+var prefixes = []string{"dav::", "webdav::"}
+
+// propfindBody requests the only properties needed to mirror a collection.
+const propfindBody = `<?xml version="1.0" encoding="utf-8"?>
+<D:propfind xmlns:D="DAV:"><D:prop><D:resourcetype/><D:getcontentlength/></D:prop></D:propfind>`
+
+// WebDAVGatherer mirrors a file, or a collection and everything below it,
+// from a WebDAV server such as Nextcloud or Artifactory. Collections are
+// enumerated with PROPFIND, one level at a time, and files fetched with GET.
+// Credentials in the URL's user info are sent using basic authentication.
+type WebDAVGatherer struct {
+	WebDAVMetadata
+	Client http.Client
+	// Username and Password are sent using basic authentication when the
+	// URL carries no user info.
+	Username string
+	Password string
+	// BearerToken, when set, is sent in the Authorization header instead.
+	BearerToken string
+}
+
+type WebDAVMetadata struct {
+	URI       string
+	Path      string
+	Size      int64
+	Files     int
+	Timestamp string
+	// SecurityChecks records the protections applied to resource paths.
+	SecurityChecks []metadata.SecurityCheck
+	// Skipped lists the resources that were left out, and why.
+	Skipped []metadata.SkippedEntry
+	// Sizes reports the sizes of the files gathered.
+	Sizes *metadata.SizeReport
+}
+
+// resource is a single entry of a PROPFIND response.
+type resource struct {
+	href       string
+	collection bool
+}
+
+type multistatus struct {
+	Responses []struct {
+		Href     string `xml:"DAV: href"`
+		Propstat []struct {
+			Prop struct {
+				ResourceType struct {
+					Collection *struct{} `xml:"DAV: collection"`
+				} `xml:"DAV: resourcetype"`
+			} `xml:"DAV: prop"`
+			Status string `xml:"DAV: status"`
+		} `xml:"DAV: propstat"`
+	} `xml:"DAV: response"`
+}
+
+func (w *WebDAVGatherer) Matcher(uri string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(uri, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Gather downloads the resource addressed by src to dst. A collection is
+// mirrored into the dst directory, preserving relative paths.
+func (w *WebDAVGatherer) Gather(ctx context.Context, src, dst string) (_ metadata.Metadata, err error) {
+	defer func() { err = fserrors.Classify(err) }()
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	default:
+	}
+
+	rawURL := src
+	for _, prefix := range prefixes {
+		rawURL = strings.TrimPrefix(rawURL, prefix)
+	}
+	base, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse source URI: %w", err)
+	}
+	if base.Scheme != "http" && base.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported WebDAV scheme: %q", base.Scheme)
+	}
+
+	dst, err = helpers.ExpandPath(dst)
+	if err != nil {
+		return nil, fmt.Errorf("failed to expand destination path: %w", err)
+	}
+
+	m := &WebDAVMetadata{URI: src}
+
+	root, children, err := w.propfind(ctx, base)
+	if err != nil {
+		return nil, err
+	}
+
+	sandbox := expand.SandboxFromContext(ctx)
+	if !root.collection {
+		target, rel := dst, "."
+		if strings.HasSuffix(dst, "/") || isDir(dst) {
+			target = filepath.Join(dst, path.Base(base.Path))
+			rel = path.Base(base.Path)
+		}
+		if err := sandbox.Require(metadata.SecurityTraceFromContext(ctx), rel, false); err != nil {
+			return nil, err
+		}
+		if m.Size, err = w.get(ctx, base, target); err != nil {
+			return nil, err
+		}
+		m.Path = target
+		m.Files = 1
+		if m.Sizes, err = metadata.ScanSizes(ctx, target, metadata.LargestFiles); err != nil {
+			return nil, fmt.Errorf("failed to report sizes: %w", err)
+		}
+		m.Timestamp = time.Now().Format(time.RFC3339)
+		w.WebDAVMetadata = *m
+		return &w.WebDAVMetadata, nil
+	}
+
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create destination directory: %w", err)
+	}
+
+	ctx, trace := metadata.WithSecurityTrace(ctx)
+	var sanitized int
+	rootPath := strings.TrimSuffix(base.Path, "/") + "/"
+	queue := children
+	for len(queue) > 0 {
+		r := queue[0]
+		queue = queue[1:]
+
+		u, err := base.Parse(r.href)
+		if err != nil {
+			return nil, fmt.Errorf("invalid href %q: %w", r.href, err)
+		}
+		u.User = base.User
+		rel := strings.TrimPrefix(u.Path, rootPath)
+		if u.Host != base.Host || rel == u.Path {
+			trace.Record(metadata.SecurityCheck{Check: "path-sanitization", Subject: u.Redacted(), Outcome: metadata.CheckRejected, Detail: "resource is outside of the requested collection"})
+			return nil, fmt.Errorf("resource %q is outside of %q", u.Path, rootPath)
+		}
+		target := filepath.Join(dst, filepath.FromSlash(rel)) // #nosec G305 checked below
+		if !strings.HasPrefix(target, filepath.Clean(dst)+string(os.PathSeparator)) {
+			trace.Record(metadata.SecurityCheck{Check: "path-sanitization", Subject: u.Path, Outcome: metadata.CheckRejected, Detail: "resource escapes the destination"})
+			return nil, fmt.Errorf("illegal resource path: %s", u.Path)
+		}
+		sanitized++
+		if ok, err := sandbox.Check(trace, rel, r.collection); err != nil {
+			return nil, err
+		} else if !ok {
+			m.Skipped = append(m.Skipped, metadata.SkippedEntry{Path: rel, Reason: metadata.SkipSandbox})
+			continue
+		}
+
+		if r.collection {
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return nil, fmt.Errorf("failed to create directory: %w", err)
+			}
+			_, more, err := w.propfind(ctx, u)
+			if err != nil {
+				return nil, err
+			}
+			queue = append(queue, more...)
+			continue
+		}
+
+		size, err := w.get(ctx, u, target)
+		if err != nil {
+			return nil, err
+		}
+		m.Size += size
+		m.Files++
+	}
+
+	trace.Record(metadata.SecurityCheck{Check: "path-sanitization", Subject: base.Redacted(), Outcome: metadata.CheckPassed, Detail: fmt.Sprintf("%d resources confined to the destination", sanitized)})
+	m.SecurityChecks = trace.Checks()
+	m.Path = dst
+	if m.Sizes, err = metadata.ScanSizes(ctx, dst, metadata.LargestFiles); err != nil {
+		return nil, fmt.Errorf("failed to report sizes: %w", err)
+	}
+	m.Timestamp = time.Now().Format(time.RFC3339)
+	w.WebDAVMetadata = *m
+	return &w.WebDAVMetadata, nil
+}
+
+// propfind lists the resource at u and, if it is a collection, its immediate
+// members.
+func (w *WebDAVGatherer) propfind(ctx context.Context, u *url.URL) (resource, []resource, error) {
+	req, err := w.newRequest(ctx, "PROPFIND", u, strings.NewReader(propfindBody))
+	if err != nil {
+		return resource{}, nil, err
+	}
+	req.Header.Set("Depth", "1")
+	req.Header.Set("Content-Type", "application/xml; charset=utf-8")
+
+	resp, err := w.Client.Do(req)
+	if err != nil {
+		return resource{}, nil, fmt.Errorf("failed to list %s: %w", u.Redacted(), err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusMultiStatus {
+		return resource{}, nil, fmt.Errorf("failed to list %s: received response code %d", u.Redacted(), resp.StatusCode)
+	}
+
+	var ms multistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+		return resource{}, nil, fmt.Errorf("failed to parse PROPFIND response: %w", err)
+	}
+
+	self := strings.TrimSuffix(u.Path, "/")
+	var root resource
+	var found bool
+	var children []resource
+	for _, r := range ms.Responses {
+		res := resource{href: r.Href}
+		for _, ps := range r.Propstat {
+			if strings.Contains(ps.Status, " 200 ") && ps.Prop.ResourceType.Collection != nil {
+				res.collection = true
+			}
+		}
+		hrefURL, err := u.Parse(r.Href)
+		if err != nil {
+			return resource{}, nil, fmt.Errorf("invalid href %q: %w", r.Href, err)
+		}
+		if strings.TrimSuffix(hrefURL.Path, "/") == self {
+			root, found = res, true
+			continue
+		}
+		children = append(children, res)
+	}
+	if !found {
+		return resource{}, nil, fmt.Errorf("PROPFIND response for %s does not describe the resource itself", u.Redacted())
+	}
+	return root, children, nil
+}
+
+// get downloads the file at u to target, returning its size.
+func (w *WebDAVGatherer) get(ctx context.Context, u *url.URL, target string) (int64, error) {
+	req, err := w.newRequest(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := w.Client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to download %s: %w", u.Redacted(), err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("failed to download %s: received response code %d", u.Redacted(), resp.StatusCode)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return 0, fmt.Errorf("failed to create destination directory: %w", err)
+	}
+	f, err := os.Create(target)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create destination file: %w", err)
+	}
+	defer f.Close()
+
+	n, err := io.Copy(f, resp.Body)
+	if err != nil {
+		return 0, fmt.Errorf("failed to write %s: %w", target, err)
+	}
+	return n, nil
+}
+
+func (w *WebDAVGatherer) newRequest(ctx context.Context, method string, u *url.URL, body io.Reader) (*http.Request, error) {
+	clean := *u
+	clean.User = nil
+	req, err := http.NewRequestWithContext(ctx, method, clean.String(), body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+	req.Header.Set("User-Agent", "Go-Gather")
+	switch {
+	case u.User != nil:
+		password, _ := u.User.Password()
+		req.SetBasicAuth(u.User.Username(), password)
+	case w.BearerToken != "":
+		req.Header.Set("Authorization", "Bearer "+w.BearerToken)
+	case w.Username != "" || w.Password != "":
+		req.SetBasicAuth(w.Username, w.Password)
+	}
+	return req, nil
+}
+
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+func (w *WebDAVMetadata) Get() interface{} {
+	return w
+}
+
+// Relocate updates Path for what was gathered having moved from from to
+// to.
+func (w *WebDAVMetadata) Relocate(from, to string) {
+	w.Path = metadata.RelocatePath(w.Path, from, to)
+}
+
+// GetSecurityChecks returns the security checks performed during the gather.
+func (w WebDAVMetadata) GetSecurityChecks() []metadata.SecurityCheck {
+	return w.SecurityChecks
+}
+
+// GetSkipped returns the resources the gather left out.
+func (w WebDAVMetadata) GetSkipped() []metadata.SkippedEntry {
+	return w.Skipped
+}
+
+// GetSizeReport returns the sizes of the files gathered.
+func (w WebDAVMetadata) GetSizeReport() *metadata.SizeReport {
+	return w.Sizes
+}
+
+// GetSummary returns the summary of the gather, which has no revision.
+func (w WebDAVMetadata) GetSummary() metadata.Summary {
+	s := metadata.NewSummary("webdav", w.URI, w.Path, w.Timestamp, w.Sizes)
+	if w.Sizes == nil {
+		s.Files, s.Bytes = w.Files, w.Size
+	}
+	return s
+}
+
+func (w WebDAVMetadata) GetPinnedURL(u string) (string, error) {
+	if len(u) == 0 {
+		return "", fmt.Errorf("empty URL")
+	}
+	for _, prefix := range prefixes {
+		u = strings.TrimPrefix(u, prefix)
+	}
+	return "dav::" + u, nil
+}
+
+func init() {
+	gather.RegisterGatherer(&WebDAVGatherer{})
+}
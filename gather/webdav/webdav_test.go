@@ -0,0 +1,187 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package webdav
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/webdav"
+
+	"github.com/enterprise-contract/go-gather/expand"
+)
+
+// newServer serves files from an in-memory WebDAV file system below /dav.
+func newServer(t *testing.T, files map[string]string) *httptest.Server {
+	t.Helper()
+	ctx := context.Background()
+	fs := webdav.NewMemFS()
+	for name, content := range files {
+		dir := ""
+		for _, part := range strings.Split(strings.Trim(path.Dir(name), "/"), "/") {
+			if part == "" {
+				continue
+			}
+			dir += "/" + part
+			if err := fs.Mkdir(ctx, dir, 0755); err != nil && !os.IsExist(err) {
+				require.NoError(t, err, "mkdir %s", dir)
+			}
+		}
+		f, err := fs.OpenFile(ctx, name, os.O_CREATE|os.O_WRONLY, 0644)
+		require.NoError(t, err)
+		_, err = f.Write([]byte(content))
+		require.NoError(t, err)
+		require.NoError(t, f.Close())
+	}
+	srv := httptest.NewServer(&webdav.Handler{
+		Prefix:     "/dav",
+		FileSystem: fs,
+		LockSystem: webdav.NewMemLS(),
+	})
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestWebDAVGatherer_Matcher(t *testing.T) {
+	w := &WebDAVGatherer{}
+	assert.True(t, w.Matcher("dav::https://example.com/dav/"))
+	assert.True(t, w.Matcher("webdav::http://example.com/dav/file.txt"))
+	assert.False(t, w.Matcher("https://example.com/dav/"))
+	assert.False(t, w.Matcher("dav://example.com/"))
+}
+
+func TestWebDAVGatherer_Gather_Collection(t *testing.T) {
+	srv := newServer(t, map[string]string{
+		"/policies/main.rego":     "package main",
+		"/policies/lib/util.rego": "package lib",
+		"/other.txt":              "other",
+	})
+
+	dst := t.TempDir()
+	w := &WebDAVGatherer{}
+	m, err := w.Gather(context.Background(), "dav::"+srv.URL+"/dav/policies/", dst)
+	require.NoError(t, err)
+
+	meta := m.(*WebDAVMetadata)
+	assert.Equal(t, dst, meta.Path)
+	assert.Equal(t, 2, meta.Files)
+	assert.Equal(t, int64(len("package main")+len("package lib")), meta.Size)
+
+	content, err := os.ReadFile(filepath.Join(dst, "main.rego"))
+	require.NoError(t, err)
+	assert.Equal(t, "package main", string(content))
+	content, err = os.ReadFile(filepath.Join(dst, "lib", "util.rego"))
+	require.NoError(t, err)
+	assert.Equal(t, "package lib", string(content))
+	assert.NoFileExists(t, filepath.Join(dst, "other.txt"))
+}
+
+func TestWebDAVGatherer_Gather_Sandbox(t *testing.T) {
+	srv := newServer(t, map[string]string{
+		"/policies/main.rego":     "package main",
+		"/policies/lib/util.rego": "package lib",
+	})
+	src := "dav::" + srv.URL + "/dav/policies/"
+
+	ctx := expand.WithSandbox(context.Background(), expand.Sandbox{Allow: []string{"lib"}})
+	_, err := (&WebDAVGatherer{}).Gather(ctx, src, t.TempDir())
+	assert.ErrorIs(t, err, expand.ErrOutsideSandbox)
+
+	dst := t.TempDir()
+	ctx = expand.WithSandbox(context.Background(), expand.Sandbox{Allow: []string{"lib"}, Skip: true})
+	m, err := (&WebDAVGatherer{}).Gather(ctx, src, dst)
+	require.NoError(t, err)
+	assert.Equal(t, 1, m.(*WebDAVMetadata).Files)
+	assert.FileExists(t, filepath.Join(dst, "lib", "util.rego"))
+	assert.NoFileExists(t, filepath.Join(dst, "main.rego"))
+
+	_, err = (&WebDAVGatherer{}).Gather(ctx, "dav::"+srv.URL+"/dav/policies/main.rego", t.TempDir()+"/")
+	assert.ErrorIs(t, err, expand.ErrOutsideSandbox)
+}
+
+func TestWebDAVGatherer_Gather_File(t *testing.T) {
+	srv := newServer(t, map[string]string{
+		"/policies/main.rego": "package main",
+	})
+
+	dst := t.TempDir()
+	w := &WebDAVGatherer{}
+	m, err := w.Gather(context.Background(), "webdav::"+srv.URL+"/dav/policies/main.rego", dst)
+	require.NoError(t, err)
+
+	meta := m.(*WebDAVMetadata)
+	assert.Equal(t, filepath.Join(dst, "main.rego"), meta.Path)
+	assert.Equal(t, 1, meta.Files)
+	content, err := os.ReadFile(meta.Path)
+	require.NoError(t, err)
+	assert.Equal(t, "package main", string(content))
+}
+
+func TestWebDAVGatherer_Gather_BasicAuth(t *testing.T) {
+	srv := newServer(t, map[string]string{
+		"/policies/main.rego": "package main",
+	})
+	handler := srv.Config.Handler
+	srv.Config.Handler = http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "me" || pass != "secret" {
+			rw.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		handler.ServeHTTP(rw, r)
+	})
+
+	w := &WebDAVGatherer{}
+	authURL := strings.Replace(srv.URL, "http://", "http://me:secret@", 1)
+	_, err := w.Gather(context.Background(), "dav::"+authURL+"/dav/policies/", t.TempDir())
+	require.NoError(t, err)
+
+	_, err = w.Gather(context.Background(), "dav::"+srv.URL+"/dav/policies/", t.TempDir())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "401")
+
+	// Credentials of the gatherer are used without any in the URL
+	w = &WebDAVGatherer{Username: "me", Password: "secret"}
+	_, err = w.Gather(context.Background(), "dav::"+srv.URL+"/dav/policies/", t.TempDir())
+	require.NoError(t, err)
+}
+
+func TestWebDAVGatherer_Gather_NotFound(t *testing.T) {
+	srv := newServer(t, map[string]string{})
+
+	w := &WebDAVGatherer{}
+	_, err := w.Gather(context.Background(), "dav::"+srv.URL+"/dav/missing/", t.TempDir())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "404")
+}
+
+func TestWebDAVMetadata_GetPinnedURL(t *testing.T) {
+	m := WebDAVMetadata{}
+	got, err := m.GetPinnedURL("webdav::https://example.com/dav/")
+	require.NoError(t, err)
+	assert.Equal(t, "dav::https://example.com/dav/", got)
+
+	_, err = m.GetPinnedURL("")
+	assert.Error(t, err)
+}
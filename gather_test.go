@@ -0,0 +1,367 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package gogather
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	gogit "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/enterprise-contract/go-gather/gather"
+	"github.com/enterprise-contract/go-gather/gather/file"
+	"github.com/enterprise-contract/go-gather/gather/git"
+	ghttp "github.com/enterprise-contract/go-gather/gather/http"
+	"github.com/enterprise-contract/go-gather/metadata"
+)
+
+func TestGather(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	require.NoError(t, os.MkdirAll(src, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "policy.rego"), []byte("package policy"), 0644))
+
+	dst := filepath.Join(dir, "dst")
+	m, err := Gather(context.Background(), "file::"+src, dst)
+	require.NoError(t, err)
+	assert.IsType(t, &file.FSMetadata{}, m)
+	assert.FileExists(t, filepath.Join(dst, "policy.rego"))
+}
+
+// partialGatherer writes part of what it gathers, and waits for the gather
+// to be cancelled.
+type partialGatherer struct{}
+
+func (partialGatherer) Matcher(uri string) bool { return uri == "partial://" }
+
+func (partialGatherer) Gather(ctx context.Context, src, dst string) (metadata.Metadata, error) {
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(dst, "partial.rego"), []byte("package"), 0644); err != nil {
+		return nil, err
+	}
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+// stateGatherer keeps a ".state.partial" file next to the destination, one
+// byte longer each gather, and fails until it holds two bytes. It then
+// writes them to the destination and records it in ".state.done".
+type stateGatherer struct{}
+
+func (stateGatherer) Matcher(uri string) bool { return uri == "state://" }
+
+func (stateGatherer) KeepsState(src, dst string) bool { return true }
+
+func (stateGatherer) StateFiles(dst string) (gathered, unfinished []string) {
+	return []string{".state.done"}, []string{".state.partial"}
+}
+
+func (stateGatherer) Gather(ctx context.Context, src, dst string) (metadata.Metadata, error) {
+	partial := filepath.Join(filepath.Dir(dst), ".state.partial")
+	b, _ := os.ReadFile(partial)
+	b = append(b, 'x')
+	if len(b) < 2 {
+		return nil, AppendErrors(nil, os.WriteFile(partial, b, 0644), errors.New("broke off")).Err()
+	}
+	if err := os.WriteFile(dst, b, 0644); err != nil {
+		return nil, err
+	}
+	if err := os.Remove(partial); err != nil {
+		return nil, err
+	}
+	return nil, os.WriteFile(filepath.Join(filepath.Dir(dst), ".state.done"), nil, 0644)
+}
+
+func TestGather_StateKeeper(t *testing.T) {
+	r := gather.NewRegistry()
+	r.RegisterGatherer(stateGatherer{})
+	dir := t.TempDir()
+	dst := filepath.Join(dir, "dst")
+
+	// What a failed gather leaves to take up from is kept
+	_, err := Gather(context.Background(), "state://", dst, WithRegistry(r))
+	assert.ErrorContains(t, err, "broke off")
+	assert.FileExists(t, filepath.Join(dir, ".state.partial"))
+	assert.NoFileExists(t, filepath.Join(dir, ".state.done"))
+	assert.NoFileExists(t, dst)
+
+	// And the next gather takes it up
+	_, err = Gather(context.Background(), "state://", dst, WithRegistry(r))
+	require.NoError(t, err)
+	b, err := os.ReadFile(dst)
+	require.NoError(t, err)
+	assert.Equal(t, "xx", string(b))
+	assert.NoFileExists(t, filepath.Join(dir, ".state.partial"))
+	assert.FileExists(t, filepath.Join(dir, ".state.done"))
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+}
+
+func TestGather_Atomic(t *testing.T) {
+	r := gather.NewRegistry()
+	r.RegisterGatherer(fakeGatherer{})
+	r.RegisterGatherer(partialGatherer{})
+	ctx := context.Background()
+	dir := t.TempDir()
+	dst := filepath.Join(dir, "dst")
+
+	// A failed or cancelled gather writes nothing to the destination
+	_, err := Gather(ctx, "fake://fail", dst, WithRegistry(r))
+	assert.Error(t, err)
+	assert.NoDirExists(t, dst)
+	_, err = Gather(ctx, "partial://", dst, WithRegistry(r), WithTimeout(10*time.Millisecond))
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.NoDirExists(t, dst)
+
+	// Nor to one that exists already
+	require.NoError(t, os.MkdirAll(dst, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dst, "keep"), nil, 0644))
+	_, err = Gather(ctx, "fake://policy", dst, WithRegistry(r), WithExpectedDigest("sha256", strings.Repeat("0", 64)))
+	assert.ErrorIs(t, err, ErrVerificationFailed)
+	assert.NoFileExists(t, filepath.Join(dst, "policy.rego"))
+	assert.FileExists(t, filepath.Join(dst, "keep"))
+
+	// Once gathered, the source is moved into place, and the staging
+	// directory removed
+	_, err = Gather(ctx, "fake://policy", dst, WithRegistry(r))
+	require.NoError(t, err)
+	assert.FileExists(t, filepath.Join(dst, "policy.rego"))
+	assert.FileExists(t, filepath.Join(dst, "keep"))
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestGather_HomeDestination(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	r := gather.NewRegistry()
+	r.RegisterGatherer(fakeGatherer{})
+
+	_, err := Gather(context.Background(), "fake://policy", "~/out", WithRegistry(r))
+	require.NoError(t, err)
+	assert.FileExists(t, filepath.Join(home, "out", "policy.rego"))
+	assert.NoDirExists(t, "~")
+	entries, err := os.ReadDir(home)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1, "the staging directory is removed")
+
+	// A trailing separator is kept
+	_, err = Gather(context.Background(), "fake://data", "~/dir/", WithRegistry(r))
+	require.NoError(t, err)
+	assert.FileExists(t, filepath.Join(home, "dir", "data.rego"))
+}
+
+func TestGather_Regather(t *testing.T) {
+	ctx := context.Background()
+	commit := func(w *gogit.Worktree, files map[string]string) {
+		t.Helper()
+		for name, content := range files {
+			if content == "" {
+				_, err := w.Remove(name)
+				require.NoError(t, err)
+				continue
+			}
+			require.NoError(t, os.WriteFile(filepath.Join(w.Filesystem.Root(), name), []byte(content), 0644))
+			_, err := w.Add(name)
+			require.NoError(t, err)
+		}
+		_, err := w.Commit("update", &gogit.CommitOptions{Author: &object.Signature{Name: "Tester", Email: "tester@example.com", When: time.Now()}})
+		require.NoError(t, err)
+	}
+
+	t.Run("git", func(t *testing.T) {
+		repoDir := t.TempDir()
+		repo, err := gogit.PlainInit(repoDir, false)
+		require.NoError(t, err)
+		w, err := repo.Worktree()
+		require.NoError(t, err)
+		commit(w, map[string]string{"main.rego": "package main", "old.rego": "package old"})
+
+		dir := t.TempDir()
+		dst := filepath.Join(dir, "policy")
+		m, err := Gather(ctx, "git::"+repoDir, dst)
+		require.NoError(t, err)
+		assert.False(t, m.(*git.GitMetadata).Updated)
+
+		// The checkout left by the first gather is updated, and files
+		// deleted upstream are removed
+		commit(w, map[string]string{"main.rego": "package main # updated", "old.rego": ""})
+		m, err = Gather(ctx, "git::"+repoDir, dst)
+		require.NoError(t, err)
+		assert.True(t, m.(*git.GitMetadata).Updated)
+		assert.Equal(t, dst, m.(*git.GitMetadata).Path)
+		b, err := os.ReadFile(filepath.Join(dst, "main.rego"))
+		require.NoError(t, err)
+		assert.Equal(t, "package main # updated", string(b))
+		assert.NoFileExists(t, filepath.Join(dst, "old.rego"))
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		assert.Len(t, entries, 1)
+	})
+
+	t.Run("http", func(t *testing.T) {
+		var conditional int
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("ETag", `"v1"`)
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				conditional++
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			_, _ = w.Write([]byte("package main"))
+		}))
+		defer srv.Close()
+		r := gather.NewRegistry()
+		r.RegisterGatherer(&ghttp.HTTPGatherer{Conditional: true})
+
+		dir := t.TempDir()
+		dst := filepath.Join(dir, "main.rego")
+		for i := 0; i < 2; i++ {
+			_, err := Gather(ctx, srv.URL+"/main.rego", dst, WithRegistry(r))
+			require.NoError(t, err)
+			b, err := os.ReadFile(dst)
+			require.NoError(t, err)
+			assert.Equal(t, "package main", string(b))
+		}
+		// The second gather revalidated the download with the validators
+		// recorded next to it by the first
+		assert.Equal(t, 1, conditional)
+		assert.FileExists(t, filepath.Join(dir, ".main.rego.cache.json"))
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		assert.Len(t, entries, 2)
+	})
+}
+
+func TestGather_Summary(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	require.NoError(t, os.MkdirAll(src, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "policy.rego"), []byte("package policy"), 0644))
+
+	m, err := Gather(context.Background(), "file::"+src, filepath.Join(dir, "dst"))
+	require.NoError(t, err)
+	s := metadata.Summarize(m)
+	assert.Equal(t, "file", s.Type)
+	assert.Equal(t, "file::"+src, s.URI)
+	assert.Equal(t, filepath.Join(dir, "dst"), s.Path)
+	assert.Equal(t, 1, s.Files)
+	assert.Equal(t, int64(len("package policy")), s.Bytes)
+	assert.NotEmpty(t, s.Timestamp)
+
+	// Sources naming an alias are summarized as the source they stand for
+	r := gather.NewRegistry()
+	r.RegisterGatherer(&file.FileGatherer{})
+	require.NoError(t, r.SetAliases(map[string]string{"policy": "file::" + src}))
+	m, err = Gather(context.Background(), "policy", filepath.Join(dir, "aliased"), WithRegistry(r))
+	require.NoError(t, err)
+	s = metadata.Summarize(m)
+	assert.Equal(t, "file", s.Type)
+	assert.Equal(t, "file::"+src, s.URI)
+	assert.Equal(t, filepath.Join(dir, "aliased"), s.Path)
+	assert.Equal(t, 1, s.Files)
+	assert.Implements(t, (*metadata.SecurityChecker)(nil), m)
+	assert.Implements(t, (*metadata.SkipReporter)(nil), m)
+	assert.NotNil(t, m.(metadata.SizeReporter).GetSizeReport())
+
+	// Single files are summarized with their source too
+	single := filepath.Join(src, "policy.rego")
+	m, err = Gather(context.Background(), "file::"+single, filepath.Join(dir, "single.rego"))
+	require.NoError(t, err)
+	s = metadata.Summarize(m)
+	assert.Equal(t, "file", s.Type)
+	assert.Equal(t, "file::"+single, s.URI)
+	assert.Equal(t, filepath.Join(dir, "single.rego"), s.Path)
+	assert.Equal(t, int64(len("package policy")), s.Bytes)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("package policy"))
+	}))
+	defer server.Close()
+	sum := sha256.Sum256([]byte("package policy"))
+	uri := server.URL + "/policy.rego?checksum=sha256:" + hex.EncodeToString(sum[:])
+
+	m, err = Gather(context.Background(), uri, filepath.Join(dir, "policy.rego"))
+	require.NoError(t, err)
+	s = metadata.Summarize(m)
+	assert.Equal(t, "http", s.Type)
+	assert.Equal(t, uri, s.URI)
+	assert.Equal(t, "sha256:"+hex.EncodeToString(sum[:]), s.Revision)
+	assert.Equal(t, int64(len("package policy")), s.Bytes)
+	assert.Equal(t, "200", s.Details["response_code"])
+}
+
+func TestGather_WithRegistry(t *testing.T) {
+	r := gather.NewRegistry()
+	r.RegisterGatherer(fakeGatherer{})
+
+	dst := filepath.Join(t.TempDir(), "dst")
+	m, err := Gather(context.Background(), "fake://policy", dst, WithRegistry(r))
+	require.NoError(t, err)
+	assert.Equal(t, fakeMetadata{}, m)
+	assert.FileExists(t, filepath.Join(dst, "policy.rego"))
+
+	// Only the gatherers of the registry are consulted
+	_, err = Gather(context.Background(), "file::"+dst, t.TempDir(), WithRegistry(r))
+	assert.ErrorContains(t, err, "no gatherer found")
+}
+
+func TestGather_Detector(t *testing.T) {
+	r := gather.NewRegistry()
+	r.RegisterGatherer(fakeGatherer{})
+	r.RegisterDetector(func(src string) (string, bool) {
+		name, ok := strings.CutPrefix(src, "corp.example/")
+		return "fake://" + name, ok
+	})
+
+	dst := filepath.Join(t.TempDir(), "dst")
+	_, err := Gather(context.Background(), "corp.example/policy", dst, WithRegistry(r))
+	require.NoError(t, err)
+	assert.FileExists(t, filepath.Join(dst, "policy.rego"))
+}
+
+func TestGather_NoGatherer(t *testing.T) {
+	_, err := Gather(context.Background(), "fake://policy", t.TempDir())
+	assert.ErrorContains(t, err, "no gatherer found for URI: fake://policy")
+
+	// Object stores without a gatherer, and presigned URLs, are gathered
+	// over HTTP, if they can be
+	_, err = Gather(context.Background(), "gs://bucket/policy.rego", t.TempDir())
+	assert.ErrorIs(t, err, ErrUnsupportedScheme)
+	for _, uri := range []string{"https://storage.googleapis.com/bucket/policy.rego", "https://account.blob.core.windows.net/container/policy.rego?sig=secret", "https://bucket.s3.amazonaws.com/policy.rego?X-Amz-Signature=secret"} {
+		g, err := gather.GetGatherer(uri)
+		require.NoError(t, err, uri)
+		assert.IsType(t, &ghttp.HTTPGatherer{}, g, uri)
+	}
+}
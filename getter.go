@@ -0,0 +1,349 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package gogather
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/enterprise-contract/go-gather/expand"
+	"github.com/enterprise-contract/go-gather/gather"
+	"github.com/enterprise-contract/go-gather/gather/file"
+	"github.com/enterprise-contract/go-gather/internal/helpers"
+	"github.com/enterprise-contract/go-gather/metadata"
+)
+
+// getterParts are the parts of the go-getter syntax of a source that its
+// gatherer leaves to Gather.
+type getterParts struct {
+	// subdir is the "//" subdirectory of the source.
+	subdir string
+	// archive is the "archive" query parameter: "false" to keep archives
+	// as they are, "true" to extract the file gathered by its extension,
+	// or the extension to extract it by, e.g. "tar.gz".
+	archive string
+	// checksum is the "checksum" query parameter, as "type:hex".
+	checksum string
+}
+
+// staged reports whether the source is gathered into a staging directory,
+// for what was gathered to be checked, extracted or narrowed to its
+// subdirectory before it is moved into the destination.
+func (p getterParts) staged() bool {
+	return p.subdir != "" || p.checksum != "" || (p.archive != "" && p.archive != "false")
+}
+
+// splitGetterSyntax splits the parts of the go-getter syntax g does not
+// honour itself off source. It returns the gatherer to gather source with,
+// a copy of g when the parts change how g gathers, as g may be shared.
+func splitGetterSyntax(g gather.Gatherer, source string) (gather.Gatherer, string, getterParts, error) {
+	handles := func(part string) bool {
+		h, ok := g.(gather.GetterSyntaxHandler)
+		return ok && h.HandlesGetterSyntax(part)
+	}
+	var p getterParts
+	if !handles(gather.GetterSubdir) {
+		source, p.subdir = gather.SplitSubdir(source)
+	}
+	source, p.archive, _ = gather.SplitParam(source, "archive")
+	if !handles(gather.GetterChecksum) {
+		source, p.checksum, _ = gather.SplitParam(source, "checksum")
+		if p.checksum != "" {
+			if err := validateDigest(strings.ToLower(p.checksum)); err != nil {
+				return nil, "", p, fmt.Errorf("invalid checksum: %w", err)
+			}
+		}
+	}
+	// Archives are extracted by the file gatherer unless asked not to
+	if f, ok := g.(*file.FileGatherer); ok && p.archive == "false" {
+		c := *f
+		c.KeepArchives = true
+		g = &c
+	}
+	return g, source, p, nil
+}
+
+// gatherStaged gathers source with g into a staging directory next to
+// destination, verifies its checksum, extracts it and narrows it to its
+// subdirectory as p asks for, checks it, and moves what is left into
+// destination, replacing what is there if replacing is set. Nothing is
+// written to destination unless every step succeeds.
+//
+// For a gather.StateKeeper, unless destination is to be replaced, what it
+// holds and the state files next to it are copied into the staging
+// directory first, for the gatherer to find what an earlier gather left,
+// and the staged tree then takes the place of destination at once. The
+// state files are moved back next to destination afterwards.
+func (o *options) gatherStaged(ctx context.Context, g gather.Gatherer, source, destination string, p getterParts, replacing bool) (_ metadata.Metadata, err error) {
+	// The parent of a destination with a trailing separator is the one
+	// before it, not the destination itself
+	parent := filepath.Dir(filepath.Clean(destination))
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create %s: %w", parent, err)
+	}
+	staging, err := os.MkdirTemp(parent, ".gather-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	defer os.RemoveAll(staging)
+
+	gathered, err := stagedPath(staging, source, destination, p)
+	if err != nil {
+		return nil, err
+	}
+	// Other gathers are merged into a copy of destination once they are
+	// checked, see place
+	k, stateful := g.(gather.StateKeeper)
+	stateful = stateful && !p.staged() && k.KeepsState(source, destination)
+	seeded := stateful && !replacing
+	if seeded {
+		if err := seed(ctx, destination, gathered); err != nil {
+			return nil, err
+		}
+	}
+	if stateful {
+		kept, unfinished := k.StateFiles(destination)
+		if seeded {
+			for _, name := range append(kept, unfinished...) {
+				if err := seed(ctx, filepath.Join(parent, name), filepath.Join(staging, name)); err != nil {
+					return nil, err
+				}
+			}
+		}
+		defer func() {
+			if err == nil {
+				unfinished = append(kept, unfinished...)
+			}
+			err = AppendErrors(nil, err, keepState(staging, parent, unfinished)).Err()
+		}()
+	}
+	m, err := g.Gather(ctx, source, gathered)
+	if err != nil {
+		return m, err
+	}
+	gathered = filepath.Clean(gathered)
+	staged := gathered
+	if p.checksum != "" {
+		want := strings.ToLower(p.checksum)
+		algorithm, _, _ := strings.Cut(want, ":")
+		got, err := digest(ctx, gathered, algorithm)
+		if err != nil {
+			return nil, err
+		}
+		if got != want {
+			return nil, fmt.Errorf("%w: %s has checksum %s, expected %s", ErrVerificationFailed, source, got, want)
+		}
+	}
+	if archive, ok := singleFile(gathered); ok && p.archive != "" && p.archive != "false" {
+		gathered = archive
+		// Expanders tell the compression of an archive by its extension too
+		if p.archive != "true" {
+			named := filepath.Join(staging, ".archive."+p.archive)
+			if err := os.Rename(gathered, named); err != nil {
+				return nil, err
+			}
+			gathered = named
+		}
+		e := expand.GetExpander(gathered)
+		if e == nil {
+			return nil, fmt.Errorf("no expander for archive %s", filepath.Base(gathered))
+		}
+		extracted := filepath.Join(staging, ".extracted")
+		if _, err := e.Expand(ctx, gathered, extracted, 0755); err != nil {
+			return nil, err
+		}
+		gathered = extracted
+	}
+	if p.subdir != "" {
+		if gathered, err = subdirectory(gathered, p.subdir); err != nil {
+			return nil, err
+		}
+	}
+	if err := o.check(ctx, gathered); err != nil {
+		return nil, err
+	}
+	placed := destination
+	if replacing || seeded {
+		err = replace(gathered, destination, staging)
+	} else {
+		placed, err = place(ctx, gathered, destination, staging)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if r, ok := m.(metadata.Relocator); ok {
+		r.Relocate(staged, placed)
+	}
+	return m, nil
+}
+
+// singleFile returns the file at path, or the only file in the directory at
+// path, where gatherers taking a destination without an extension for a
+// directory download into, and whether there is one.
+func singleFile(path string) (string, bool) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", false
+	}
+	if info.Mode().IsRegular() {
+		return path, true
+	}
+	entries, err := os.ReadDir(path)
+	if err != nil || len(entries) != 1 || !entries[0].Type().IsRegular() {
+		return "", false
+	}
+	return filepath.Join(path, entries[0].Name()), true
+}
+
+// stagedPath returns the path source is gathered into in staging. When
+// parts of its go-getter syntax are left to Gather, that is the base name of
+// its path, see stagedName. Otherwise it stands in for destination, taking
+// its base name and trailing separator, and is made a directory if
+// destination is one, as gatherers tell from these whether to gather into
+// a directory or a file.
+func stagedPath(staging, source, destination string, p getterParts) (string, error) {
+	if p.staged() {
+		return filepath.Join(staging, stagedName(source)), nil
+	}
+	name := filepath.Base(destination)
+	if name == "." || name == string(filepath.Separator) {
+		name = "destination"
+	}
+	path := filepath.Join(staging, name)
+	if info, err := os.Stat(destination); err == nil && info.IsDir() {
+		if err := os.Mkdir(path, 0755); err != nil {
+			return "", fmt.Errorf("failed to create staging directory: %w", err)
+		}
+	}
+	if strings.HasSuffix(destination, "/") || strings.HasSuffix(destination, string(filepath.Separator)) {
+		path += string(filepath.Separator)
+	}
+	return path, nil
+}
+
+// stagedName returns the name source is gathered under in the staging
+// directory: the base name of its path, for the extension of an archive
+// to tell its format.
+func stagedName(source string) string {
+	if i := strings.Index(source, "::"); i > 0 && !strings.ContainsAny(source[:i], "/?#") {
+		source = source[i+2:]
+	}
+	if i := strings.IndexAny(source, "?#"); i >= 0 {
+		source = source[:i]
+	}
+	if i := strings.Index(source, "://"); i >= 0 {
+		source = source[i+3:]
+	}
+	name := path.Base(filepath.ToSlash(source))
+	if name == "." || name == "/" || name == "" {
+		return "source"
+	}
+	return name
+}
+
+// subdirectory returns the subdirectory subdir of root, which may be a glob
+// pattern matching exactly one path, as in go-getter.
+func subdirectory(root, subdir string) (string, error) {
+	subdir = filepath.Clean(filepath.FromSlash(strings.Trim(subdir, "/")))
+	if !filepath.IsLocal(subdir) {
+		return "", fmt.Errorf("illegal subdirectory: %s", subdir)
+	}
+	matches, err := filepath.Glob(filepath.Join(root, subdir))
+	if err != nil {
+		return "", fmt.Errorf("invalid subdirectory %s: %w", subdir, err)
+	}
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("subdirectory %s not found in source", subdir)
+	case 1:
+		return matches[0], nil
+	default:
+		return "", fmt.Errorf("subdirectory %s matches %d paths, expected one", subdir, len(matches))
+	}
+}
+
+// place moves the file or directory at from into destination, and returns
+// the path it was moved to. A directory is merged with a directory that
+// already exists there in a copy of it in staging, which then takes its
+// place.
+func place(ctx context.Context, from, destination, staging string) (string, error) {
+	info, err := os.Stat(from)
+	if err != nil {
+		return "", err
+	}
+	if existing, err := os.Stat(destination); err == nil && existing.IsDir() {
+		if info.IsDir() {
+			merged := filepath.Join(staging, ".merged")
+			if err := helpers.CopyDirContext(ctx, destination, merged); err != nil {
+				return "", fmt.Errorf("failed to copy %s: %w", destination, err)
+			}
+			if err := helpers.CopyDirContext(ctx, from, merged); err != nil {
+				return "", fmt.Errorf("failed to merge into %s: %w", destination, err)
+			}
+			return destination, replace(merged, destination, staging)
+		}
+		destination = filepath.Join(destination, filepath.Base(from))
+	}
+	if err := os.Rename(from, destination); err != nil {
+		return "", fmt.Errorf("failed to move into %s: %w", destination, err)
+	}
+	return destination, nil
+}
+
+// seed copies the file or directory at path, if there is one, to staged.
+func seed(ctx context.Context, path, staged string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		// Anything the gatherer cannot gather into is left for it to report
+		return nil
+	}
+	staged = filepath.Clean(staged)
+	switch {
+	case info.IsDir():
+		err = helpers.CopyDirContext(ctx, path, staged)
+	case info.Mode().IsRegular():
+		err = helpers.CopyFileContext(ctx, path, staged)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to stage %s: %w", path, err)
+	}
+	return nil
+}
+
+// keepState moves the state files names of the gatherer from staging to
+// parent, the directory of the destination, and removes those the gatherer
+// removed from there too.
+func keepState(staging, parent string, names []string) error {
+	var errs Errors
+	for _, name := range names {
+		kept := filepath.Join(parent, name)
+		err := os.Rename(filepath.Join(staging, name), kept)
+		if errors.Is(err, fs.ErrNotExist) {
+			if err = os.Remove(kept); errors.Is(err, fs.ErrNotExist) {
+				err = nil
+			}
+		}
+		errs = AppendErrors(errs, err)
+	}
+	return errs.Err()
+}
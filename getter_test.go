@@ -0,0 +1,146 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package gogather
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/enterprise-contract/go-gather/gather/file"
+)
+
+// policyArchive writes a gzipped tarball holding main/policy.rego and
+// lib/lib.rego to path.
+func policyArchive(t *testing.T, path string) {
+	t.Helper()
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	gw := gzip.NewWriter(f)
+	tw := tar.NewWriter(gw)
+	for name, content := range map[string]string{"main/policy.rego": "package main", "lib/lib.rego": "package lib"} {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content))}))
+		_, err := tw.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gw.Close())
+	require.NoError(t, f.Close())
+}
+
+func TestGather_Subdir(t *testing.T) {
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "policy.tar.gz")
+	policyArchive(t, archive)
+
+	dst := filepath.Join(dir, "dst")
+	_, err := Gather(context.Background(), "file::"+archive+"//main", dst)
+	require.NoError(t, err)
+	assert.FileExists(t, filepath.Join(dst, "policy.rego"))
+	assert.NoDirExists(t, filepath.Join(dst, "lib"))
+
+	// Subdirectories can be matched by a glob pattern
+	dst = filepath.Join(dir, "glob")
+	_, err = Gather(context.Background(), "file::"+archive+"//l*", dst)
+	require.NoError(t, err)
+	assert.FileExists(t, filepath.Join(dst, "lib.rego"))
+
+	_, err = Gather(context.Background(), "file::"+archive+"//missing", filepath.Join(dir, "missing"))
+	assert.ErrorContains(t, err, "subdirectory missing not found in source")
+	assert.NoDirExists(t, filepath.Join(dir, "missing"))
+
+	// Nothing is left of the staging directories
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 3)
+}
+
+func TestGather_Archive(t *testing.T) {
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "policy.tar.gz")
+	policyArchive(t, archive)
+	data, err := os.ReadFile(archive)
+	require.NoError(t, err)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(data)
+	}))
+	defer server.Close()
+
+	// The HTTP gatherer downloads the file, which Gather extracts
+	dst := filepath.Join(dir, "http")
+	_, err = Gather(context.Background(), server.URL+"/download//main?archive=tar.gz", dst)
+	require.NoError(t, err)
+	assert.FileExists(t, filepath.Join(dst, "policy.rego"))
+
+	dst = filepath.Join(dir, "named")
+	_, err = Gather(context.Background(), server.URL+"/policy.tar.gz?archive=true", dst)
+	require.NoError(t, err)
+	assert.FileExists(t, filepath.Join(dst, "lib", "lib.rego"))
+
+	// The file gatherer keeps archives as they are when asked to
+	dst = filepath.Join(dir, "kept.tar.gz")
+	_, err = Gather(context.Background(), "file::"+archive+"?archive=false", dst)
+	require.NoError(t, err)
+	kept, err := os.ReadFile(dst)
+	require.NoError(t, err)
+	assert.Equal(t, data, kept)
+
+	// and extracts them again for the gathers after it
+	dst = filepath.Join(dir, "extracted")
+	_, err = Gather(context.Background(), "file::"+archive, dst)
+	require.NoError(t, err)
+	assert.FileExists(t, filepath.Join(dst, "main", "policy.rego"))
+}
+
+func TestSplitGetterSyntax_KeepArchives(t *testing.T) {
+	shared := &file.FileGatherer{}
+	g, source, _, err := splitGetterSyntax(shared, "file::policy.tar.gz?archive=false")
+	require.NoError(t, err)
+	assert.Equal(t, "file::policy.tar.gz", source)
+	assert.True(t, g.(*file.FileGatherer).KeepArchives)
+	assert.False(t, shared.KeepArchives)
+}
+
+func TestGather_Checksum(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "policy.rego")
+	require.NoError(t, os.WriteFile(src, []byte("package policy"), 0644))
+	sum := sha256.Sum256([]byte("package policy"))
+
+	dst := filepath.Join(dir, "copy.rego")
+	_, err := Gather(context.Background(), "file::"+src+"?checksum=sha256:"+hex.EncodeToString(sum[:]), dst)
+	require.NoError(t, err)
+	assert.FileExists(t, dst)
+
+	dst = filepath.Join(dir, "other.rego")
+	_, err = Gather(context.Background(), "file::"+src+"?checksum=sha256:"+hex.EncodeToString(make([]byte, 32)), dst)
+	assert.ErrorIs(t, err, ErrVerificationFailed)
+	assert.NoFileExists(t, dst)
+
+	_, err = Gather(context.Background(), "file::"+src+"?checksum=sha256:abc", dst)
+	assert.ErrorContains(t, err, "invalid checksum")
+}
@@ -0,0 +1,241 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package cloud recognizes URIs addressing cloud object storage so that they
+// can be routed to the matching gatherer rather than treated as plain HTTP
+// downloads.
+package cloud
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// S3Location identifies an object or prefix in an S3 bucket.
+type S3Location struct {
+	Bucket string
+	Key    string
+	// Region is the bucket region when it can be derived from the URI,
+	// either from the hostname or a "region" query parameter.
+	Region string
+}
+
+var (
+	// bucket.s3.amazonaws.com, bucket.s3.region.amazonaws.com and the legacy
+	// bucket.s3-region.amazonaws.com forms.
+	s3VirtualHost = regexp.MustCompile(`^(.+)\.s3(?:[.-]([a-z0-9-]+))?\.amazonaws\.com$`)
+	// s3.amazonaws.com, s3.region.amazonaws.com and s3-region.amazonaws.com.
+	s3PathHost = regexp.MustCompile(`^s3(?:[.-]([a-z0-9-]+))?\.amazonaws\.com$`)
+)
+
+// IsS3URI reports whether uri addresses S3, either through the s3:// scheme,
+// the s3:: forced prefix, or an HTTPS S3 endpoint.
+func IsS3URI(uri string) bool {
+	_, err := ParseS3(uri)
+	return err == nil
+}
+
+// ParseS3 extracts the bucket, key and region from an S3 URI. HTTPS
+// endpoints carrying "X-Amz-" query parameters, as presigned URLs do, are
+// not taken for S3 URIs unless forced with "s3::", for the signature they
+// carry to be sent as it is by a plain download.
+func ParseS3(uri string) (S3Location, error) {
+	uri, forced := strings.CutPrefix(uri, "s3::")
+
+	u, err := url.Parse(uri)
+	if err != nil {
+		return S3Location{}, fmt.Errorf("failed to parse S3 URI: %w", err)
+	}
+
+	loc := S3Location{Region: u.Query().Get("region")}
+	host := strings.ToLower(u.Hostname())
+
+	switch {
+	case u.Scheme == "s3":
+		loc.Bucket = u.Host
+		loc.Key = strings.TrimPrefix(u.Path, "/")
+	case u.Scheme != "http" && u.Scheme != "https":
+		return S3Location{}, fmt.Errorf("not an S3 URI: %s", uri)
+	case !forced && presigned(u.Query()):
+		return S3Location{}, fmt.Errorf("presigned URL, not an S3 URI: %s", u.Redacted())
+	case s3PathHost.MatchString(host):
+		bucket, key, _ := strings.Cut(strings.TrimPrefix(u.Path, "/"), "/")
+		loc.Bucket = bucket
+		loc.Key = key
+		if loc.Region == "" {
+			loc.Region = regionFromHost(s3PathHost.FindStringSubmatch(host)[1])
+		}
+	case s3VirtualHost.MatchString(host):
+		m := s3VirtualHost.FindStringSubmatch(host)
+		loc.Bucket = m[1]
+		loc.Key = strings.TrimPrefix(u.Path, "/")
+		if loc.Region == "" {
+			loc.Region = regionFromHost(m[2])
+		}
+	default:
+		return S3Location{}, fmt.Errorf("not an S3 URI: %s", uri)
+	}
+
+	if loc.Bucket == "" {
+		return S3Location{}, fmt.Errorf("no bucket in S3 URI: %s", uri)
+	}
+	return loc, nil
+}
+
+// presigned reports whether query holds the "X-Amz-" parameters of a
+// presigned URL.
+func presigned(query url.Values) bool {
+	for k := range query {
+		if len(k) > 6 && strings.EqualFold(k[:6], "x-amz-") {
+			return true
+		}
+	}
+	return false
+}
+
+// regionFromHost filters out the non-region labels that may follow "s3" in
+// an S3 hostname.
+func regionFromHost(label string) string {
+	switch label {
+	case "", "external-1", "dualstack", "accelerate":
+		return ""
+	}
+	return label
+}
+
+// Object stores addressed by URIs, as returned by Store.
+const (
+	S3    = "s3"
+	GCS   = "gcs"
+	Azure = "azblob"
+)
+
+// Store returns the object store uri addresses, one of S3, GCS and Azure,
+// or an empty string if it addresses none.
+func Store(uri string) string {
+	switch {
+	case IsS3URI(uri):
+		return S3
+	case IsGCSURI(uri):
+		return GCS
+	case IsAzureURI(uri):
+		return Azure
+	}
+	return ""
+}
+
+// GCSLocation identifies an object or prefix in a Google Cloud Storage
+// bucket.
+type GCSLocation struct {
+	Bucket string
+	Object string
+}
+
+// gcsVirtualHost matches the bucket.storage.googleapis.com form.
+var gcsVirtualHost = regexp.MustCompile(`^(.+)\.storage\.googleapis\.com$`)
+
+// IsGCSURI reports whether uri addresses Google Cloud Storage, either
+// through the gs:// scheme, the gcs:: forced prefix, or an HTTPS endpoint.
+func IsGCSURI(uri string) bool {
+	_, err := ParseGCS(uri)
+	return err == nil
+}
+
+// ParseGCS extracts the bucket and object from a Google Cloud Storage URI.
+func ParseGCS(uri string) (GCSLocation, error) {
+	uri = strings.TrimPrefix(uri, "gcs::")
+
+	u, err := url.Parse(uri)
+	if err != nil {
+		return GCSLocation{}, fmt.Errorf("failed to parse GCS URI: %w", err)
+	}
+
+	var loc GCSLocation
+	host := strings.ToLower(u.Hostname())
+	switch {
+	case u.Scheme == "gs":
+		loc.Bucket = u.Host
+		loc.Object = strings.TrimPrefix(u.Path, "/")
+	case u.Scheme != "http" && u.Scheme != "https":
+		return GCSLocation{}, fmt.Errorf("not a GCS URI: %s", uri)
+	case host == "storage.googleapis.com" || host == "storage.cloud.google.com":
+		loc.Bucket, loc.Object, _ = strings.Cut(strings.TrimPrefix(u.Path, "/"), "/")
+	case gcsVirtualHost.MatchString(host):
+		loc.Bucket = gcsVirtualHost.FindStringSubmatch(host)[1]
+		loc.Object = strings.TrimPrefix(u.Path, "/")
+	default:
+		return GCSLocation{}, fmt.Errorf("not a GCS URI: %s", uri)
+	}
+
+	if loc.Bucket == "" {
+		return GCSLocation{}, fmt.Errorf("no bucket in GCS URI: %s", uri)
+	}
+	return loc, nil
+}
+
+// AzureLocation identifies a blob or prefix in an Azure Blob Storage
+// container.
+type AzureLocation struct {
+	// Account is the storage account, empty for azblob:// URIs, which
+	// leave it to the configuration of the gatherer.
+	Account   string
+	Container string
+	Blob      string
+}
+
+// azureHost matches the account.blob.core.windows.net form.
+var azureHost = regexp.MustCompile(`^([a-z0-9]+)\.blob\.core\.windows\.net$`)
+
+// IsAzureURI reports whether uri addresses Azure Blob Storage, either
+// through the azblob:// scheme, the azblob:: forced prefix, or an HTTPS
+// endpoint.
+func IsAzureURI(uri string) bool {
+	_, err := ParseAzure(uri)
+	return err == nil
+}
+
+// ParseAzure extracts the account, container and blob from an Azure Blob
+// Storage URI.
+func ParseAzure(uri string) (AzureLocation, error) {
+	uri = strings.TrimPrefix(uri, "azblob::")
+
+	u, err := url.Parse(uri)
+	if err != nil {
+		return AzureLocation{}, fmt.Errorf("failed to parse Azure URI: %w", err)
+	}
+
+	var loc AzureLocation
+	host := strings.ToLower(u.Hostname())
+	switch {
+	case u.Scheme == "azblob":
+		loc.Container = u.Host
+		loc.Blob = strings.TrimPrefix(u.Path, "/")
+	case u.Scheme != "http" && u.Scheme != "https":
+		return AzureLocation{}, fmt.Errorf("not an Azure URI: %s", uri)
+	case azureHost.MatchString(host):
+		loc.Account = azureHost.FindStringSubmatch(host)[1]
+		loc.Container, loc.Blob, _ = strings.Cut(strings.TrimPrefix(u.Path, "/"), "/")
+	default:
+		return AzureLocation{}, fmt.Errorf("not an Azure URI: %s", uri)
+	}
+
+	if loc.Container == "" {
+		return AzureLocation{}, fmt.Errorf("no container in Azure URI: %s", uri)
+	}
+	return loc, nil
+}
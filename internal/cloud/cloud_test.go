@@ -0,0 +1,126 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package cloud
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseS3(t *testing.T) {
+	testCases := []struct {
+		name string
+		uri  string
+		want S3Location
+	}{
+		{"s3 scheme", "s3://bucket/path/to/key.tar.gz", S3Location{Bucket: "bucket", Key: "path/to/key.tar.gz"}},
+		{"s3 scheme prefix", "s3://bucket/policies/", S3Location{Bucket: "bucket", Key: "policies/"}},
+		{"forced prefix", "s3::s3://bucket/key?region=eu-west-1", S3Location{Bucket: "bucket", Key: "key", Region: "eu-west-1"}},
+		{"virtual hosted", "https://bucket.s3.amazonaws.com/key", S3Location{Bucket: "bucket", Key: "key"}},
+		{"virtual hosted region", "https://my.bucket.s3.us-east-2.amazonaws.com/dir/key", S3Location{Bucket: "my.bucket", Key: "dir/key", Region: "us-east-2"}},
+		{"virtual hosted legacy", "https://bucket.s3-eu-west-1.amazonaws.com/key", S3Location{Bucket: "bucket", Key: "key", Region: "eu-west-1"}},
+		{"path style", "https://s3.us-west-2.amazonaws.com/bucket/key", S3Location{Bucket: "bucket", Key: "key", Region: "us-west-2"}},
+		{"path style global", "https://s3.amazonaws.com/bucket/a/b", S3Location{Bucket: "bucket", Key: "a/b"}},
+		{"forced presigned", "s3::https://bucket.s3.amazonaws.com/key?X-Amz-Signature=abc", S3Location{Bucket: "bucket", Key: "key"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ParseS3(tc.uri)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+			assert.True(t, IsS3URI(tc.uri))
+		})
+	}
+}
+
+func TestParseS3_NotS3(t *testing.T) {
+	for _, uri := range []string{
+		"https://example.com/file.txt",
+		"oci://quay.io/org/repo",
+		"s3:///key",
+		"https://s3.amazonaws.com/",
+		"https://bucket.s3.amazonaws.com/key?X-Amz-Algorithm=AWS4-HMAC-SHA256&X-Amz-Signature=abc",
+		"https://s3.us-east-2.amazonaws.com/bucket/key?x-amz-credential=abc",
+	} {
+		t.Run(uri, func(t *testing.T) {
+			_, err := ParseS3(uri)
+			assert.Error(t, err)
+			assert.False(t, IsS3URI(uri))
+		})
+	}
+}
+
+func TestParseGCS(t *testing.T) {
+	testCases := []struct {
+		name string
+		uri  string
+		want GCSLocation
+	}{
+		{"gs scheme", "gs://bucket/path/to/object.tar.gz", GCSLocation{Bucket: "bucket", Object: "path/to/object.tar.gz"}},
+		{"forced prefix", "gcs::gs://bucket/policies/", GCSLocation{Bucket: "bucket", Object: "policies/"}},
+		{"path style", "https://storage.googleapis.com/bucket/a/b", GCSLocation{Bucket: "bucket", Object: "a/b"}},
+		{"console host", "https://storage.cloud.google.com/bucket/a", GCSLocation{Bucket: "bucket", Object: "a"}},
+		{"virtual hosted", "https://my.bucket.storage.googleapis.com/a", GCSLocation{Bucket: "my.bucket", Object: "a"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ParseGCS(tc.uri)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+			assert.Equal(t, GCS, Store(tc.uri))
+		})
+	}
+
+	for _, uri := range []string{"https://example.com/bucket/a", "gs:///object", "https://storage.googleapis.com/"} {
+		assert.False(t, IsGCSURI(uri), uri)
+	}
+}
+
+func TestParseAzure(t *testing.T) {
+	testCases := []struct {
+		name string
+		uri  string
+		want AzureLocation
+	}{
+		{"azblob scheme", "azblob://container/path/to/blob", AzureLocation{Container: "container", Blob: "path/to/blob"}},
+		{"forced prefix", "azblob::azblob://container/", AzureLocation{Container: "container"}},
+		{"endpoint", "https://account.blob.core.windows.net/container/a/b", AzureLocation{Account: "account", Container: "container", Blob: "a/b"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ParseAzure(tc.uri)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+			assert.Equal(t, Azure, Store(tc.uri))
+		})
+	}
+
+	for _, uri := range []string{"https://account.file.core.windows.net/share/a", "azblob:///blob", "https://account.blob.core.windows.net/"} {
+		assert.False(t, IsAzureURI(uri), uri)
+	}
+}
+
+func TestStore(t *testing.T) {
+	assert.Equal(t, S3, Store("s3://bucket/key"))
+	assert.Equal(t, "", Store("https://example.com/key"))
+	assert.Equal(t, "", Store("oci::quay.io/org/repo"))
+}
@@ -17,11 +17,16 @@
 package helpers
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
+
+	"github.com/enterprise-contract/go-gather/faults"
+	"github.com/enterprise-contract/go-gather/fserrors"
 )
 
 // CopyDir recursively copies the contents of the source directory (src)
@@ -29,13 +34,121 @@ import (
 // with the same permission bits as src. Subdirectories and files will be copied
 // recursively. If src is not a directory, an error is returned.
 //
-// Note: This function does not preserve symlinks as symlinks—it follows them
-// (via os.ReadDir’s behavior). Extended file attributes (xattrs) or other
-// metadata beyond basic permissions are not preserved.
+// Symlinks are recreated as symlinks with the same target rather than
+// followed, and the modification times of files and directories are
+// preserved. Sparse files are copied without filling in their holes where the
+// platform supports it. Extended file attributes (xattrs), ownership or other
+// metadata beyond permissions and modification times are not preserved.
 func CopyDir(src, dst string) error {
+	return CopyDirContext(context.Background(), src, dst)
+}
+
+// CopyDirContext is like CopyDir but stops, returning the context's error,
+// once ctx is cancelled. Cancellation is checked before each entry and while
+// file contents are copied.
+func CopyDirContext(ctx context.Context, src, dst string) error {
+	return CopyDirFilterContext(ctx, src, dst, nil)
+}
+
+// CopyDirFilterContext is like CopyDirContext but leaves out the entries for
+// which skip, given their slash-separated path relative to src, returns true.
+// The contents of skipped directories are left out with them. A nil skip
+// copies everything.
+func CopyDirFilterContext(ctx context.Context, src, dst string, skip func(rel string) bool) error {
+	return CopyDirOptionsContext(ctx, src, dst, CopyOptions{Skip: skip, AllowEscapingSymlinks: true})
+}
+
+// CopyDirPatternsContext is like CopyDirContext but leaves out the entries
+// excluded by p. Symlinks are matched as files, as they are not followed.
+func CopyDirPatternsContext(ctx context.Context, src, dst string, p PathFilter) error {
+	if err := p.Validate(); err != nil {
+		return err
+	}
+	if p.IsZero() {
+		return CopyDirContext(ctx, src, dst)
+	}
+	return CopyDirFilterContext(ctx, src, dst, func(rel string) bool {
+		info, err := os.Lstat(filepath.Join(src, filepath.FromSlash(rel)))
+		return p.Excludes(rel, err == nil && info.IsDir())
+	})
+}
+
+// SymlinkMode is how a copy handles symbolic links.
+type SymlinkMode string
+
+const (
+	// SymlinkPreserve recreates links with the same target, the default.
+	SymlinkPreserve SymlinkMode = "preserve"
+	// SymlinkFollow copies the files and directories links point at in
+	// their place.
+	SymlinkFollow SymlinkMode = "follow"
+	// SymlinkSkip leaves links out.
+	SymlinkSkip SymlinkMode = "skip"
+)
+
+// Validate returns an error if m is not one of the modes, or empty.
+func (m SymlinkMode) Validate() error {
+	switch m {
+	case "", SymlinkPreserve, SymlinkFollow, SymlinkSkip:
+		return nil
+	}
+	return fmt.Errorf("unknown symlink mode %q", m)
+}
+
+// CopyOptions control CopyDirOptionsContext.
+type CopyOptions struct {
+	// Skip leaves out the entries for which it returns true, given their
+	// slash-separated path relative to the source. The contents of skipped
+	// directories are left out with them.
+	Skip func(rel string) bool
+	// Symlinks is how links are copied, SymlinkPreserve when empty.
+	Symlinks SymlinkMode
+	// AllowEscapingSymlinks copies links resolving outside the source
+	// directory, rather than failing with fserrors.ErrSymlinkEscapes. Links
+	// are never checked in SymlinkSkip mode.
+	AllowEscapingSymlinks bool
+	// Link is how the contents of files are copied, LinkCopy when empty.
+	Link LinkMode
+}
+
+// CopyDirOptionsContext is like CopyDirContext, with the entries copied and
+// the handling of symlinks controlled by opts. Links to directories that are
+// followed are checked for cycles, which fail with fserrors.ErrSymlinkLoop.
+func CopyDirOptionsContext(ctx context.Context, src, dst string, opts CopyOptions) error {
+	if err := opts.Symlinks.Validate(); err != nil {
+		return err
+	}
+	if err := opts.Link.Validate(); err != nil {
+		return err
+	}
 	// Clean the paths to normalize things like trailing slashes or ./ ..
-	src = filepath.Clean(src)
-	dst = filepath.Clean(dst)
+	c := &copier{root: filepath.Clean(src), opts: opts, active: map[string]bool{}}
+	return c.copyDir(ctx, c.root, filepath.Clean(dst), "")
+}
+
+// CopySymlinkContext copies the link src, found at the slash-separated path
+// rel below the directory root being copied, to dst as opts tell, like
+// CopyDirOptionsContext would.
+func CopySymlinkContext(ctx context.Context, root, src, dst, rel string, opts CopyOptions) error {
+	if err := opts.Symlinks.Validate(); err != nil {
+		return err
+	}
+	c := &copier{root: filepath.Clean(root), opts: opts, active: map[string]bool{}}
+	return c.copySymlink(ctx, src, dst, rel)
+}
+
+// copier copies the tree at root.
+type copier struct {
+	root string
+	opts CopyOptions
+	// active holds the resolved paths of the directories being copied,
+	// to detect the cycles links being followed may lead into.
+	active map[string]bool
+}
+
+// copyDir copies src, found at the slash-separated path rel below the root
+// of the copy, to dst.
+func (c *copier) copyDir(ctx context.Context, src, dst, rel string) error {
 
 	srcInfo, err := os.Stat(src)
 	if err != nil {
@@ -44,6 +157,17 @@ func CopyDir(src, dst string) error {
 	if !srcInfo.IsDir() {
 		return fmt.Errorf("source %q is not a directory", src)
 	}
+	if c.opts.Symlinks == SymlinkFollow {
+		real, err := filepath.EvalSymlinks(src)
+		if err != nil {
+			return err
+		}
+		if c.active[real] {
+			return &fserrors.SymlinkLoopError{Path: src}
+		}
+		c.active[real] = true
+		defer delete(c.active, real)
+	}
 
 	// If the destination directory does not exist, create it using the source directory’s mode.
 	if _, err := os.Stat(dst); err != nil {
@@ -63,28 +187,162 @@ func CopyDir(src, dst string) error {
 
 	// Recursively copy each entry in the source directory
 	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		srcPath := filepath.Join(src, entry.Name())
 		dstPath := filepath.Join(dst, entry.Name())
+		entryRel := path.Join(rel, entry.Name())
+		if c.opts.Skip != nil && c.opts.Skip(entryRel) {
+			continue
+		}
 
-		if entry.IsDir() {
-			if err := CopyDir(srcPath, dstPath); err != nil {
+		if entry.Type()&os.ModeSymlink != 0 {
+			if err := c.copySymlink(ctx, srcPath, dstPath, entryRel); err != nil {
+				return err
+			}
+		} else if entry.IsDir() {
+			if err := c.copyDir(ctx, srcPath, dstPath, entryRel); err != nil {
 				return err
 			}
 		} else {
-			if err := CopyFile(srcPath, dstPath); err != nil {
+			if err := c.copyFile(ctx, srcPath, dstPath, entryRel); err != nil {
 				return err
 			}
 		}
 	}
+	// Set the modification time last, as copying the entries updates it
+	if err := os.Chtimes(dst, srcInfo.ModTime(), srcInfo.ModTime()); err != nil {
+		return fmt.Errorf("failed to set times on directory %q: %w", dst, err)
+	}
 	return nil
 }
 
+// copySymlink copies the link src at rel to dst as the options tell.
+func (c *copier) copySymlink(ctx context.Context, src, dst, rel string) error {
+	if c.opts.Symlinks == SymlinkSkip {
+		return nil
+	}
+	if !c.opts.AllowEscapingSymlinks {
+		ok, err := IsSafePath(c.root, src, 0)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			target, _ := os.Readlink(src)
+			return fmt.Errorf("%w: %s -> %s", fserrors.ErrSymlinkEscapes, rel, target)
+		}
+	}
+	if c.opts.Symlinks != SymlinkFollow {
+		return CopySymlink(src, dst)
+	}
+
+	info, err := os.Stat(src)
+	if err != nil {
+		return fmt.Errorf("failed to follow symlink %q: %w", src, err)
+	}
+	if info.IsDir() {
+		return c.copyDir(ctx, src, dst, rel)
+	}
+	// A link may replace what an earlier copy left at dst
+	if err := os.Remove(dst); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("could not replace %q: %w", dst, err)
+	}
+	return c.copyFile(ctx, src, dst, rel)
+}
+
+// copyFile copies the file src at rel to dst.
+func (c *copier) copyFile(ctx context.Context, src, dst, rel string) error {
+	if err := faults.Check(faults.FromContext(ctx), faults.Entry, rel, 0); err != nil {
+		return err
+	}
+	return CopyFileLinkContext(ctx, src, dst, c.opts.Link)
+}
+
+// LinkMode is how a copy writes the contents of files.
+type LinkMode string
+
+const (
+	// LinkCopy copies the contents of files, the default.
+	LinkCopy LinkMode = "copy"
+	// LinkHard hard links the copies to the files, so they share their
+	// contents: a change to either shows in the other.
+	LinkHard LinkMode = "hardlink"
+	// LinkReflink clones the files, so the copies share their contents
+	// until either is changed, with the FICLONE ioctl on Linux and
+	// clonefile on macOS.
+	LinkReflink LinkMode = "reflink"
+)
+
+// Validate returns an error if m is not one of the modes, or empty.
+func (m LinkMode) Validate() error {
+	switch m {
+	case "", LinkCopy, LinkHard, LinkReflink:
+		return nil
+	}
+	return fmt.Errorf("unknown link mode %q", m)
+}
+
+// CopyFileLinkContext is like CopyFileContext, but links dst to src as mode
+// tells. The contents are copied when they can't be, e.g. when src and dst
+// are on different file systems, or one not supporting reflinks, or when
+// ctx carries injected faults, which need every byte to go through a writer.
+// An existing file at dst is replaced.
+func CopyFileLinkContext(ctx context.Context, src, dst string, mode LinkMode) error {
+	if mode != "" && mode != LinkCopy && faults.FromContext(ctx) == nil {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if linkFile(src, dst, mode) == nil {
+			return nil
+		}
+	}
+	return CopyFileContext(ctx, src, dst)
+}
+
+// linkFile links dst to src as mode tells. A link at src is followed, like
+// CopyFileContext does.
+func linkFile(src, dst string, mode LinkMode) error {
+	src, err := filepath.EvalSymlinks(src)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(dst); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if mode == LinkHard {
+		return os.Link(src, dst)
+	}
+	if err := reflink(src, dst); err != nil {
+		return err
+	}
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(dst, info.Mode()); err != nil {
+		return err
+	}
+	return os.Chtimes(dst, info.ModTime(), info.ModTime())
+}
+
 // CopyFile copies a single file from src to dst. The destination file is
-// created (or truncated if it exists) with the same permission bits as the source.
+// created (or truncated if it exists) with the same permission bits and
+// modification time as the source. Holes in sparse files are preserved where
+// the platform supports detecting them. If src is a symlink it is followed.
 // If any I/O error occurs, the function returns an error.
 // Note: Extended file attributes (xattrs), ACLs, or other metadata beyond basic
-// UNIX permissions are not preserved by this approach.
+// UNIX permissions and modification times are not preserved by this approach.
 func CopyFile(src, dst string) error {
+	return CopyFileContext(context.Background(), src, dst)
+}
+
+// CopyFileContext is like CopyFile but stops, returning the context's error,
+// once ctx is cancelled.
+func CopyFileContext(ctx context.Context, src, dst string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	srcFile, err := os.Open(src)
 	if err != nil {
 		return fmt.Errorf("could not open source file %q: %w", src, err)
@@ -97,20 +355,72 @@ func CopyFile(src, dst string) error {
 	}
 	defer dstFile.Close()
 
-	// Perform the copy
-	if _, err = io.Copy(dstFile, srcFile); err != nil {
-		return fmt.Errorf("failed to copy contents from %q to %q: %w", src, dst, err)
+	srcInfo, err := srcFile.Stat()
+	if err != nil {
+		return fmt.Errorf("could not stat source file %q: %w", src, err)
 	}
 
-	srcInfo, err := os.Stat(src)
+	// Perform the copy, skipping over holes where possible. Injected
+	// faults need every byte to go through a writer
+	hook := faults.FromContext(ctx)
+	var copied bool
+	if hook == nil {
+		copied, err = copySparse(ctx, dstFile, srcFile, srcInfo.Size())
+	}
+	if err == nil && !copied {
+		_, err = io.Copy(faults.Writer(hook, dst, dstFile), NewContextReader(ctx, srcFile))
+	}
 	if err != nil {
-		return fmt.Errorf("could not stat source file %q: %w", src, err)
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		return fmt.Errorf("failed to copy contents from %q to %q: %w", src, dst, err)
 	}
 
 	// Replicate the source file’s mode (permissions) on the destination
 	if chmodErr := os.Chmod(dst, srcInfo.Mode()); chmodErr != nil {
 		return fmt.Errorf("failed to chmod destination file %q: %w", dst, chmodErr)
 	}
+	if err := os.Chtimes(dst, srcInfo.ModTime(), srcInfo.ModTime()); err != nil {
+		return fmt.Errorf("failed to set times on destination file %q: %w", dst, err)
+	}
+	return nil
+}
+
+// CopySparseContext copies the contents of src to the empty file dst,
+// leaving holes where src has them when the platform can detect them, and
+// returns the number of bytes copied. It stops, returning the context's
+// error, once ctx is cancelled.
+func CopySparseContext(ctx context.Context, dst, src *os.File) (int64, error) {
+	info, err := src.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if info.Mode().IsRegular() {
+		copied, err := copySparse(ctx, dst, src, info.Size())
+		if err != nil {
+			return 0, err
+		}
+		if copied {
+			return info.Size(), nil
+		}
+	}
+	return io.Copy(dst, NewContextReader(ctx, src))
+}
+
+// CopySymlink recreates the symlink src at dst, pointing at the same target.
+// An existing file at dst is replaced.
+func CopySymlink(src, dst string) error {
+	target, err := os.Readlink(src)
+	if err != nil {
+		return fmt.Errorf("could not read symlink %q: %w", src, err)
+	}
+	if err := os.Remove(dst); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("could not replace %q: %w", dst, err)
+	}
+	if err := os.Symlink(target, dst); err != nil {
+		return fmt.Errorf("could not create symlink %q: %w", dst, err)
+	}
 	return nil
 }
 
@@ -164,7 +474,7 @@ var PathExpanderFunc = func(path string) (string, error) {
 }
 
 func ExpandPath(path string) (string, error) {
-	return PathExpanderFunc(path)
+	return PathExpanderFunc(NormalizeWindowsPath(path))
 }
 
 // GetDirectorySize returns the total size of all regular files (in bytes)
@@ -176,6 +486,12 @@ func ExpandPath(path string) (string, error) {
 // does not handle special file types (e.g. device files, symlinks to large directories)
 // in a special manner—they’re counted or followed as normal by filepath.Walk.
 func GetDirectorySize(dir string) (int64, error) {
+	return GetDirectorySizeContext(context.Background(), dir)
+}
+
+// GetDirectorySizeContext is like GetDirectorySize but stops, returning the
+// context's error, once ctx is cancelled.
+func GetDirectorySizeContext(ctx context.Context, dir string) (int64, error) {
 	expandedDir, err := ExpandPath(dir)
 	if err != nil {
 		return 0, fmt.Errorf("failed to expand directory path %q: %w", dir, err)
@@ -187,14 +503,40 @@ func GetDirectorySize(dir string) (int64, error) {
 			// If there's an error while walking a particular file/dir, bubble that up.
 			return walkErr
 		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		// If it's a regular file, add its size to the total
 		if !info.IsDir() {
 			size += info.Size()
 		}
 		return nil
 	})
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return 0, ctxErr
+	}
 	if err != nil {
 		return 0, fmt.Errorf("failed to walk directory %q: %w", expandedDir, err)
 	}
 	return size, nil
 }
+
+// contextReader fails reads once its context is cancelled.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+// NewContextReader returns a reader that reads from r until ctx is cancelled,
+// after which every read returns the context's error. Wrapping the source of
+// a long copy makes it cancellable between reads.
+func NewContextReader(ctx context.Context, r io.Reader) io.Reader {
+	return &contextReader{ctx: ctx, r: r}
+}
+
+func (c *contextReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
@@ -18,6 +18,8 @@ package helpers
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -25,6 +27,7 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 // TestCopyFile_Success checks that CopyFile copies a file correctly.
@@ -315,6 +318,156 @@ func TestGetDirectorySize_ExpandPathError(t *testing.T) {
 	}
 }
 
+// TestCopyDir_PreservesSymlinksAndTimes checks that CopyDir recreates symlinks
+// rather than following them and keeps modification times.
+func TestCopyDir_PreservesSymlinksAndTimes(t *testing.T) {
+	srcDir := t.TempDir()
+	dstDir := filepath.Join(t.TempDir(), "dst")
+
+	if err := os.WriteFile(filepath.Join(srcDir, "file.txt"), []byte("content"), 0600); err != nil {
+		t.Fatalf("failed to create source file: %v", err)
+	}
+	if err := os.Mkdir(filepath.Join(srcDir, "sub"), 0755); err != nil {
+		t.Fatalf("failed to create source subdirectory: %v", err)
+	}
+	if err := os.Symlink("file.txt", filepath.Join(srcDir, "link.txt")); err != nil {
+		t.Fatalf("failed to create file symlink: %v", err)
+	}
+	if err := os.Symlink("sub", filepath.Join(srcDir, "linkdir")); err != nil {
+		t.Fatalf("failed to create directory symlink: %v", err)
+	}
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, p := range []string{filepath.Join(srcDir, "file.txt"), filepath.Join(srcDir, "sub"), srcDir} {
+		if err := os.Chtimes(p, mtime, mtime); err != nil {
+			t.Fatalf("failed to set times on %q: %v", p, err)
+		}
+	}
+
+	if err := CopyDir(srcDir, dstDir); err != nil {
+		t.Fatalf("CopyDir returned error: %v", err)
+	}
+
+	for link, want := range map[string]string{"link.txt": "file.txt", "linkdir": "sub"} {
+		got, err := os.Readlink(filepath.Join(dstDir, link))
+		if err != nil {
+			t.Fatalf("expected %q to be a symlink: %v", link, err)
+		}
+		if got != want {
+			t.Errorf("expected %q to point at %q, got %q", link, want, got)
+		}
+	}
+
+	for _, p := range []string{"file.txt", "sub", "."} {
+		info, err := os.Stat(filepath.Join(dstDir, p))
+		if err != nil {
+			t.Fatalf("failed to stat %q: %v", p, err)
+		}
+		if !info.ModTime().Equal(mtime) {
+			t.Errorf("expected %q to have mtime %v, got %v", p, mtime, info.ModTime())
+		}
+	}
+}
+
+// TestCopyDirContext_Cancelled checks that a cancelled context stops CopyDirContext.
+func TestCopyDirContext_Cancelled(t *testing.T) {
+	srcDir := t.TempDir()
+	dstDir := filepath.Join(t.TempDir(), "dst")
+	if err := os.WriteFile(filepath.Join(srcDir, "file.txt"), []byte("content"), 0600); err != nil {
+		t.Fatalf("failed to create source file: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := CopyDirContext(ctx, srcDir, dstDir)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dstDir, "file.txt")); !os.IsNotExist(err) {
+		t.Errorf("expected file not to be copied, stat returned %v", err)
+	}
+}
+
+func TestCopyDirFilterContext(t *testing.T) {
+	srcDir := t.TempDir()
+	dstDir := filepath.Join(t.TempDir(), "dst")
+	for _, name := range []string{"keep.txt", "sub/keep.txt", "sub/.git/config", ".skip"} {
+		p := filepath.Join(srcDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatalf("failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(p, []byte(name), 0600); err != nil {
+			t.Fatalf("failed to create source file: %v", err)
+		}
+	}
+
+	var seen []string
+	skip := func(rel string) bool {
+		seen = append(seen, rel)
+		return rel == ".skip" || rel == "sub/.git"
+	}
+	if err := CopyDirFilterContext(context.Background(), srcDir, dstDir, skip); err != nil {
+		t.Fatalf("CopyDirFilterContext returned an error: %v", err)
+	}
+	for _, name := range []string{"keep.txt", "sub/keep.txt"} {
+		if _, err := os.Stat(filepath.Join(dstDir, filepath.FromSlash(name))); err != nil {
+			t.Errorf("expected %s to be copied: %v", name, err)
+		}
+	}
+	for _, name := range []string{".skip", "sub/.git"} {
+		if _, err := os.Stat(filepath.Join(dstDir, filepath.FromSlash(name))); !os.IsNotExist(err) {
+			t.Errorf("expected %s to be skipped, stat returned %v", name, err)
+		}
+	}
+	for _, rel := range seen {
+		if rel == "sub/.git/config" {
+			t.Error("expected the contents of a skipped directory not to be visited")
+		}
+	}
+}
+
+// TestCopyFileContext_Cancelled checks that a cancelled context stops CopyFileContext.
+func TestCopyFileContext_Cancelled(t *testing.T) {
+	tempDir := t.TempDir()
+	srcFile := filepath.Join(tempDir, "src.txt")
+	if err := os.WriteFile(srcFile, []byte("content"), 0600); err != nil {
+		t.Fatalf("failed to create source file: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := CopyFileContext(ctx, srcFile, filepath.Join(tempDir, "dst.txt"))
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+// TestNewContextReader checks that reads fail once the context is cancelled.
+func TestNewContextReader(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := NewContextReader(ctx, strings.NewReader("abc"))
+
+	buf := make([]byte, 1)
+	if _, err := r.Read(buf); err != nil {
+		t.Fatalf("unexpected error before cancellation: %v", err)
+	}
+	cancel()
+	if _, err := r.Read(buf); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
+// TestGetDirectorySizeContext_Cancelled checks that a cancelled context stops the walk.
+func TestGetDirectorySizeContext_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := GetDirectorySizeContext(ctx, t.TempDir()); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
+
 // Test type checks: These are optional if you want to confirm function signatures haven't changed
 func TestHelpersFunctionsAreExpectedTypes(t *testing.T) {
 	var _ func(string, string) error = CopyDir
@@ -326,3 +479,52 @@ func TestHelpersFunctionsAreExpectedTypes(t *testing.T) {
 		t.Error("CopyDir must be a function")
 	}
 }
+
+// TestCopyFileLinkContext checks that files are hard linked or cloned, or
+// copied when they can't be.
+func TestCopyFileLinkContext(t *testing.T) {
+	tempDir := t.TempDir()
+	src := filepath.Join(tempDir, "src.txt")
+	if err := os.WriteFile(src, []byte("content"), 0640); err != nil {
+		t.Fatalf("failed to create source file: %v", err)
+	}
+	srcInfo, err := os.Stat(src)
+	if err != nil {
+		t.Fatalf("failed to stat source file: %v", err)
+	}
+
+	for _, mode := range []LinkMode{"", LinkCopy, LinkHard, LinkReflink} {
+		dst := filepath.Join(tempDir, "dst-"+string(mode))
+		// An existing file is replaced
+		if err := os.WriteFile(dst, []byte("old"), 0600); err != nil {
+			t.Fatalf("failed to create destination file: %v", err)
+		}
+		if err := CopyFileLinkContext(context.Background(), src, dst, mode); err != nil {
+			t.Fatalf("CopyFileLinkContext(%q) returned error: %v", mode, err)
+		}
+		dstInfo, err := os.Stat(dst)
+		if err != nil {
+			t.Fatalf("failed to stat destination file: %v", err)
+		}
+		if got := os.SameFile(srcInfo, dstInfo); got != (mode == LinkHard) {
+			t.Errorf("expected %q mode to share the file=%v, got %v", mode, mode == LinkHard, got)
+		}
+		if b, err := os.ReadFile(dst); err != nil || string(b) != "content" {
+			t.Errorf("expected %q mode to copy the contents, got %q, %v", mode, b, err)
+		}
+		if dstInfo.Mode() != srcInfo.Mode() || !dstInfo.ModTime().Equal(srcInfo.ModTime()) {
+			t.Errorf("expected %q mode to keep the mode and times, got %v %v", mode, dstInfo.Mode(), dstInfo.ModTime())
+		}
+	}
+
+	// A link that can't be made falls back to a copy, which reports the
+	// error
+	err = CopyFileLinkContext(context.Background(), src, filepath.Join(tempDir, "missing", "dst"), LinkHard)
+	if err == nil {
+		t.Error("expected an error copying into a missing directory")
+	}
+
+	if err := CopyDirOptionsContext(context.Background(), tempDir, t.TempDir(), CopyOptions{Link: "bogus"}); err == nil {
+		t.Error("expected an unknown link mode to be rejected")
+	}
+}
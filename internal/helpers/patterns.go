@@ -0,0 +1,165 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package helpers
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// MatchGlob reports whether the slash-separated path rel matches pattern, in
+// which a "**" segment matches any number of segments, and other segments
+// are matched as by path.Match.
+func MatchGlob(pattern, rel string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(rel, "/"), false)
+}
+
+// MayMatchGlob reports whether a directory at the slash-separated path rel
+// may hold paths matching pattern.
+func MayMatchGlob(pattern, rel string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(rel, "/"), true)
+}
+
+// ValidateGlob returns an error if pattern is malformed.
+func ValidateGlob(pattern string) error {
+	if _, err := path.Match(strings.ReplaceAll(pattern, "**", "*"), ""); err != nil {
+		return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+	return nil
+}
+
+// matchSegments matches names against patterns. With prefix, names only
+// need to match the beginning of what patterns matches.
+func matchSegments(patterns, names []string, prefix bool) bool {
+	for len(patterns) > 0 {
+		if patterns[0] == "**" {
+			// Any number of segments, including none
+			for i := 0; i <= len(names); i++ {
+				if matchSegments(patterns[1:], names[i:], prefix) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(names) == 0 {
+			return prefix
+		}
+		if ok, err := path.Match(patterns[0], names[0]); err != nil || !ok {
+			return false
+		}
+		patterns, names = patterns[1:], names[1:]
+	}
+	return len(names) == 0
+}
+
+// PathFilter selects the paths of a tree by gitignore-style patterns, see
+// expand.PathFilter, which is documented for users.
+type PathFilter struct {
+	Include []string
+	Exclude []string
+}
+
+// IsZero reports whether p selects every path.
+func (p PathFilter) IsZero() bool {
+	return len(p.Include) == 0 && len(p.Exclude) == 0
+}
+
+// Validate returns an error if any pattern of p is malformed.
+func (p PathFilter) Validate() error {
+	for _, patterns := range [][]string{p.Include, p.Exclude} {
+		for _, pattern := range patterns {
+			if pt, ok := parsePattern(pattern); ok {
+				if err := ValidateGlob(pt.glob); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Excludes reports whether the file or, with dir, the directory at the
+// slash-separated path rel, relative to the root of the tree, is left out.
+func (p PathFilter) Excludes(rel string, dir bool) bool {
+	rel = path.Clean(rel)
+	if decide(p.Exclude, rel, dir) {
+		return true
+	}
+	return !dir && len(p.Include) > 0 && !decide(p.Include, rel, dir)
+}
+
+// pattern is a parsed line of a PathFilter.
+type pattern struct {
+	glob   string
+	negate bool
+	dir    bool
+}
+
+// parsePattern parses s, reporting false for empty lines and comments.
+func parsePattern(s string) (pattern, bool) {
+	s = strings.TrimSpace(s)
+	if s == "" || strings.HasPrefix(s, "#") {
+		return pattern{}, false
+	}
+	var p pattern
+	if rest, ok := strings.CutPrefix(s, "!"); ok {
+		p.negate, s = true, rest
+	}
+	if rest, ok := strings.CutSuffix(s, "/"); ok {
+		p.dir, s = true, rest
+	}
+	if s == "" {
+		return pattern{}, false
+	}
+	if strings.Contains(s, "/") {
+		s = strings.TrimPrefix(s, "/")
+	} else {
+		s = "**/" + s
+	}
+	p.glob = s
+	return p, true
+}
+
+// decide reports whether rel is matched by patterns, either itself or
+// through the closest of its parent directories matched by any of them.
+func decide(patterns []string, rel string, dir bool) bool {
+	if len(patterns) == 0 {
+		return false
+	}
+	parsed := make([]pattern, 0, len(patterns))
+	for _, s := range patterns {
+		if p, ok := parsePattern(s); ok {
+			parsed = append(parsed, p)
+		}
+	}
+
+	matched := false
+	segments := strings.Split(rel, "/")
+	for i := range segments {
+		isDir := dir || i < len(segments)-1
+		sub := strings.Join(segments[:i+1], "/")
+		for j := len(parsed) - 1; j >= 0; j-- {
+			p := parsed[j]
+			if (!p.dir || isDir) && MatchGlob(p.glob, sub) {
+				matched = !p.negate
+				break
+			}
+		}
+	}
+	return matched
+}
@@ -0,0 +1,132 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package helpers
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		rel     string
+		match   bool
+		descend bool
+	}{
+		{"**/*.rego", "main.rego", true, true},
+		{"**/*.rego", "a/b/main.rego", true, true},
+		{"**/*.rego", "a/b/main.json", false, true},
+		{"*.rego", "a/main.rego", false, false},
+		{"lib/*/*.rego", "lib/x/y.rego", true, true},
+		{"lib/*/*.rego", "lib", false, true},
+		{"lib/*/*.rego", "other", false, false},
+		{"lib/**/test/*.rego", "lib/a/b/test/c.rego", true, true},
+		{"lib/**", "lib/a/b", true, true},
+	}
+	for _, tt := range tests {
+		if got := MatchGlob(tt.pattern, tt.rel); got != tt.match {
+			t.Errorf("MatchGlob(%q, %q) = %v, want %v", tt.pattern, tt.rel, got, tt.match)
+		}
+		if got := MayMatchGlob(tt.pattern, tt.rel); got != tt.descend {
+			t.Errorf("MayMatchGlob(%q, %q) = %v, want %v", tt.pattern, tt.rel, got, tt.descend)
+		}
+	}
+}
+
+func TestPathFilter(t *testing.T) {
+	p := PathFilter{
+		Include: []string{"*.rego", "data/", "!*_test.rego"},
+		Exclude: []string{"# comment", "", ".git/", "node_modules", "/build", "*.log", "!keep.log"},
+	}
+	tests := []struct {
+		rel      string
+		dir      bool
+		excluded bool
+	}{
+		{"main.rego", false, false},
+		{"lib/util.rego", false, false},
+		{"lib/util_test.rego", false, true},
+		{"README.md", false, true},
+		{"data/x/values.json", false, false},
+		{"data/x/values_test.rego", false, true},
+		{"lib", true, false},
+		{".git", true, true},
+		{"a/node_modules", true, true},
+		{"a/node_modules/x.rego", false, true},
+		{"build", true, true},
+		{"a/build", true, false},
+		{"a/debug.log", false, true},
+		{"a/keep.log", false, true},
+	}
+	for _, tt := range tests {
+		if got := p.Excludes(tt.rel, tt.dir); got != tt.excluded {
+			t.Errorf("Excludes(%q, %v) = %v, want %v", tt.rel, tt.dir, got, tt.excluded)
+		}
+	}
+
+	if !(PathFilter{}).IsZero() || (PathFilter{}).Excludes("anything", false) {
+		t.Error("expected the zero filter to select everything")
+	}
+	if err := (PathFilter{Exclude: []string{"[bad"}}).Validate(); err == nil {
+		t.Error("expected a malformed pattern to be rejected")
+	}
+	// Patterns with a trailing slash only match directories
+	if (PathFilter{Exclude: []string{".git/"}}).Excludes(".git", false) {
+		t.Error("expected a directory pattern not to match a file")
+	}
+	// Only the last matching pattern decides
+	if (PathFilter{Exclude: []string{"*.log", "!keep.log"}}).Excludes("keep.log", false) {
+		t.Error("expected a negated pattern to re-include the file")
+	}
+}
+
+func TestCopyDirPatternsContext(t *testing.T) {
+	src := t.TempDir()
+	for _, name := range []string{"main.rego", "node_modules/x/index.js", "lib/util.rego", "lib/notes.txt"} {
+		p := filepath.Join(src, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(name), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	dst := filepath.Join(t.TempDir(), "dst")
+
+	p := PathFilter{Include: []string{"*.rego"}, Exclude: []string{"node_modules/"}}
+	if err := CopyDirPatternsContext(context.Background(), src, dst, p); err != nil {
+		t.Fatalf("CopyDirPatternsContext returned error: %v", err)
+	}
+	for name, want := range map[string]bool{
+		"main.rego":     true,
+		"lib/util.rego": true,
+		"lib/notes.txt": false,
+		"node_modules":  false,
+	} {
+		_, err := os.Lstat(filepath.Join(dst, filepath.FromSlash(name)))
+		if got := err == nil; got != want {
+			t.Errorf("expected %s to exist=%v, got %v", name, want, err)
+		}
+	}
+
+	if err := CopyDirPatternsContext(context.Background(), src, dst, PathFilter{Include: []string{"[bad"}}); err == nil {
+		t.Error("expected a malformed pattern to be rejected")
+	}
+}
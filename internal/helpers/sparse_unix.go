@@ -0,0 +1,63 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build linux || darwin || freebsd
+
+package helpers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// copySparse copies the data regions of src to dst, leaving holes where src
+// has them, so sparse files stay sparse. It reports false without writing
+// anything if the file system cannot report holes.
+func copySparse(ctx context.Context, dst, src *os.File, size int64) (bool, error) {
+	fd := int(src.Fd())
+	var offset int64
+	for offset < size {
+		data, err := unix.Seek(fd, offset, unix.SEEK_DATA)
+		if errors.Is(err, unix.ENXIO) {
+			// No data beyond offset, the rest of the file is a hole
+			break
+		}
+		if err != nil {
+			if offset == 0 && (errors.Is(err, unix.EINVAL) || errors.Is(err, unix.ENOTSUP)) {
+				return false, nil
+			}
+			return true, err
+		}
+		hole, err := unix.Seek(fd, data, unix.SEEK_HOLE)
+		if err != nil {
+			return true, err
+		}
+		if _, err := dst.Seek(data, io.SeekStart); err != nil {
+			return true, err
+		}
+		section := io.NewSectionReader(src, data, hole-data)
+		if _, err := io.Copy(dst, NewContextReader(ctx, section)); err != nil {
+			return true, err
+		}
+		offset = hole
+	}
+	// Extend dst to the full size, creating any trailing hole
+	return true, dst.Truncate(size)
+}
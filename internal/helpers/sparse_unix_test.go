@@ -0,0 +1,86 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build linux || darwin || freebsd
+
+package helpers
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+// TestCopyFile_Sparse checks that holes in a sparse file survive a copy.
+func TestCopyFile_Sparse(t *testing.T) {
+	tempDir := t.TempDir()
+	srcFile := filepath.Join(tempDir, "sparse.img")
+	dstFile := filepath.Join(tempDir, "copy.img")
+
+	const size = 64 << 20
+	f, err := os.Create(srcFile)
+	if err != nil {
+		t.Fatalf("failed to create source file: %v", err)
+	}
+	if _, err := f.WriteAt([]byte("data"), size/2); err != nil {
+		t.Fatalf("failed to write source file: %v", err)
+	}
+	if err := f.Truncate(size); err != nil {
+		t.Fatalf("failed to extend source file: %v", err)
+	}
+	f.Close()
+
+	if allocated(t, srcFile) >= size {
+		t.Skip("file system does not support sparse files")
+	}
+
+	if err := CopyFile(srcFile, dstFile); err != nil {
+		t.Fatalf("CopyFile returned error: %v", err)
+	}
+
+	info, err := os.Stat(dstFile)
+	if err != nil {
+		t.Fatalf("failed to stat destination file: %v", err)
+	}
+	if info.Size() != size {
+		t.Fatalf("expected size %d, got %d", size, info.Size())
+	}
+	if got := allocated(t, dstFile); got >= size/2 {
+		t.Errorf("expected destination to stay sparse, %d bytes allocated", got)
+	}
+
+	got, err := os.ReadFile(dstFile)
+	if err != nil {
+		t.Fatalf("failed to read destination file: %v", err)
+	}
+	want := make([]byte, size)
+	copy(want[size/2:], "data")
+	if !bytes.Equal(got, want) {
+		t.Error("destination content differs from source")
+	}
+}
+
+// allocated returns the number of bytes allocated on disk for path.
+func allocated(t *testing.T, path string) int64 {
+	t.Helper()
+	var st syscall.Stat_t
+	if err := syscall.Stat(path, &st); err != nil {
+		t.Fatalf("failed to stat %q: %v", path, err)
+	}
+	return int64(st.Blocks) * 512
+}
@@ -0,0 +1,134 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package helpers
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/enterprise-contract/go-gather/fserrors"
+)
+
+// DefaultMaxSymlinkDepth is the number of symbolic links ResolveSymlinks
+// follows before giving up, matching the limit Linux applies.
+const DefaultMaxSymlinkDepth = 40
+
+// ResolveSymlinks returns the absolute path of path with every symbolic link
+// in it resolved, like filepath.EvalSymlinks. Unlike EvalSymlinks, trailing
+// components that do not exist yet are kept as they are, so a destination can
+// be checked before it is created, and resolution stops with a
+// *fserrors.SymlinkLoopError, naming the links followed, when a cycle is
+// detected or more than maxDepth links have to be followed. A maxDepth of
+// zero or less uses DefaultMaxSymlinkDepth.
+func ResolveSymlinks(path string, maxDepth int) (string, error) {
+	if maxDepth <= 0 {
+		maxDepth = DefaultMaxSymlinkDepth
+	}
+	sep := string(os.PathSeparator)
+	// filepath.Abs would clean the path, resolving ".." lexically rather than
+	// relative to where the preceding links point
+	abs := path
+	if !filepath.IsAbs(path) {
+		wd, err := os.Getwd()
+		if err != nil {
+			return "", fmt.Errorf("failed to make %q absolute: %w", path, err)
+		}
+		abs = wd + sep + path
+	}
+
+	resolved := filepath.VolumeName(abs) + sep
+	remaining := strings.TrimPrefix(abs, resolved)
+
+	var chain []string
+	// A link reached again with the same components left to resolve will
+	// lead to the same place again, so it is a cycle.
+	seen := map[string]bool{}
+	for remaining != "" {
+		var name string
+		name, remaining, _ = strings.Cut(remaining, sep)
+		switch name {
+		case "", ".":
+			continue
+		case "..":
+			resolved = filepath.Dir(resolved)
+			continue
+		}
+
+		next := filepath.Join(resolved, name)
+		info, err := os.Lstat(next)
+		if errors.Is(err, fs.ErrNotExist) {
+			return filepath.Join(next, remaining), nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			resolved = next
+			continue
+		}
+
+		chain = append(chain, next)
+		key := next + "\x00" + remaining
+		if seen[key] {
+			return "", &fserrors.SymlinkLoopError{Path: path, Chain: chain}
+		}
+		seen[key] = true
+		if len(chain) > maxDepth {
+			return "", &fserrors.SymlinkLoopError{Path: path, Chain: chain, MaxDepth: maxDepth}
+		}
+
+		target, err := os.Readlink(next)
+		if err != nil {
+			return "", err
+		}
+		if filepath.IsAbs(target) {
+			resolved = filepath.VolumeName(target) + sep
+			target = strings.TrimPrefix(target, resolved)
+		}
+		if remaining != "" {
+			target += sep + remaining
+		}
+		remaining = target
+	}
+	return resolved, nil
+}
+
+// IsSafePath reports whether path, once symbolic links in it and in root are
+// resolved, is root or lies below it. Symbolic links are resolved with
+// ResolveSymlinks, so a link cycle fails with fserrors.ErrSymlinkLoop rather
+// than an opaque error.
+func IsSafePath(root, path string, maxDepth int) (bool, error) {
+	resolvedRoot, err := ResolveSymlinks(root, maxDepth)
+	if err != nil {
+		return false, err
+	}
+	resolvedPath, err := ResolveSymlinks(path, maxDepth)
+	if err != nil {
+		return false, err
+	}
+	// Either path may carry the Windows long-path prefix, which filepath.Rel
+	// would take for a different volume
+	rel, err := filepath.Rel(NormalizeWindowsPath(resolvedRoot), NormalizeWindowsPath(resolvedPath))
+	if err != nil {
+		return false, nil
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(os.PathSeparator)), nil
+}
@@ -0,0 +1,249 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package helpers
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/enterprise-contract/go-gather/fserrors"
+)
+
+func symlink(t *testing.T, target, link string) {
+	t.Helper()
+	if err := os.Symlink(target, link); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+}
+
+func TestResolveSymlinks(t *testing.T) {
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "real", "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	symlink(t, "real", filepath.Join(dir, "rel"))
+	symlink(t, filepath.Join(dir, "real", "sub"), filepath.Join(dir, "abs"))
+	symlink(t, "rel/sub", filepath.Join(dir, "chain"))
+	symlink(t, "../..", filepath.Join(dir, "real", "sub", "up"))
+
+	testCases := []struct {
+		name string
+		path string
+		want string
+	}{
+		{"no links", filepath.Join(dir, "real", "sub"), filepath.Join(dir, "real", "sub")},
+		{"relative link", filepath.Join(dir, "rel", "sub"), filepath.Join(dir, "real", "sub")},
+		{"absolute link", filepath.Join(dir, "abs"), filepath.Join(dir, "real", "sub")},
+		{"chained links", filepath.Join(dir, "chain"), filepath.Join(dir, "real", "sub")},
+		{"dot dot after link", filepath.Join(dir, "abs") + string(os.PathSeparator) + "..", filepath.Join(dir, "real")},
+		{"link to parent", filepath.Join(dir, "abs", "up"), dir},
+		{"missing components", filepath.Join(dir, "rel", "new", "file"), filepath.Join(dir, "real", "new", "file")},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := ResolveSymlinks(tc.path, 0)
+			if err != nil {
+				t.Fatalf("ResolveSymlinks returned an unexpected error: %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("ResolveSymlinks(%q) = %q, want %q", tc.path, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestResolveSymlinks_Cycle(t *testing.T) {
+	dir := t.TempDir()
+	symlink(t, "b", filepath.Join(dir, "a"))
+	symlink(t, "a", filepath.Join(dir, "b"))
+
+	_, err := ResolveSymlinks(filepath.Join(dir, "a", "file"), 0)
+	if !errors.Is(err, fserrors.ErrSymlinkLoop) {
+		t.Fatalf("expected ErrSymlinkLoop, got %v", err)
+	}
+	var loopErr *fserrors.SymlinkLoopError
+	if !errors.As(err, &loopErr) {
+		t.Fatalf("expected a *fserrors.SymlinkLoopError, got %T", err)
+	}
+	if loopErr.MaxDepth != 0 || len(loopErr.Chain) != 3 {
+		t.Errorf("expected a detected cycle through a, b and a again, got %+v", loopErr)
+	}
+	if !strings.Contains(err.Error(), "cycle") {
+		t.Errorf("expected the error to mention the cycle, got %q", err)
+	}
+}
+
+func TestResolveSymlinks_MaxDepth(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "target"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	// link0 -> link1 -> link2 -> link3 -> target
+	symlink(t, "target", filepath.Join(dir, "link3"))
+	symlink(t, "link3", filepath.Join(dir, "link2"))
+	symlink(t, "link2", filepath.Join(dir, "link1"))
+	symlink(t, "link1", filepath.Join(dir, "link0"))
+
+	if _, err := ResolveSymlinks(filepath.Join(dir, "link0"), 4); err != nil {
+		t.Fatalf("expected 4 links to be followed, got %v", err)
+	}
+
+	_, err := ResolveSymlinks(filepath.Join(dir, "link0"), 3)
+	var loopErr *fserrors.SymlinkLoopError
+	if !errors.As(err, &loopErr) {
+		t.Fatalf("expected a *fserrors.SymlinkLoopError, got %v", err)
+	}
+	if loopErr.MaxDepth != 3 {
+		t.Errorf("expected the depth limit to be reported, got %+v", loopErr)
+	}
+}
+
+func TestIsSafePath(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	if err := os.Mkdir(filepath.Join(root, "dir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	symlink(t, "dir", filepath.Join(root, "inside"))
+	symlink(t, outside, filepath.Join(root, "escape"))
+	symlink(t, "loop", filepath.Join(root, "loop"))
+
+	testCases := []struct {
+		name    string
+		path    string
+		want    bool
+		wantErr bool
+	}{
+		{"root", root, true, false},
+		{"below root", filepath.Join(root, "dir", "file"), true, false},
+		{"link inside root", filepath.Join(root, "inside", "file"), true, false},
+		{"link escaping root", filepath.Join(root, "escape", "file"), false, false},
+		{"dot dot", filepath.Join(root, "..", "file"), false, false},
+		{"link loop", filepath.Join(root, "loop"), false, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := IsSafePath(root, tc.path, 0)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("IsSafePath returned error %v, want error: %v", err, tc.wantErr)
+			}
+			if tc.wantErr && !errors.Is(err, fserrors.ErrSymlinkLoop) {
+				t.Errorf("expected ErrSymlinkLoop, got %v", err)
+			}
+			if got != tc.want {
+				t.Errorf("IsSafePath(%q) = %v, want %v", tc.path, got, tc.want)
+			}
+		})
+	}
+}
+
+// symlinkTree returns a source directory with a file, a directory and links
+// to both.
+func symlinkTree(t *testing.T) string {
+	t.Helper()
+	src := filepath.Join(t.TempDir(), "src")
+	if err := os.MkdirAll(filepath.Join(src, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []string{filepath.Join(src, "file.txt"), filepath.Join(src, "sub", "inner.txt")} {
+		if err := os.WriteFile(f, []byte(filepath.Base(f)), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	symlink(t, "file.txt", filepath.Join(src, "link.txt"))
+	symlink(t, "sub", filepath.Join(src, "linkdir"))
+	return src
+}
+
+func TestCopyDirOptionsContext_Symlinks(t *testing.T) {
+	src := symlinkTree(t)
+	ctx := context.Background()
+
+	dst := filepath.Join(t.TempDir(), "follow")
+	if err := CopyDirOptionsContext(ctx, src, dst, CopyOptions{Symlinks: SymlinkFollow}); err != nil {
+		t.Fatalf("CopyDirOptionsContext returned error: %v", err)
+	}
+	for _, p := range []string{"link.txt", "linkdir", "linkdir/inner.txt"} {
+		info, err := os.Lstat(filepath.Join(dst, filepath.FromSlash(p)))
+		if err != nil || info.Mode()&os.ModeSymlink != 0 {
+			t.Errorf("expected %s to be copied in place of the link, got %v, %v", p, info, err)
+		}
+	}
+
+	dst = filepath.Join(t.TempDir(), "skip")
+	if err := CopyDirOptionsContext(ctx, src, dst, CopyOptions{Symlinks: SymlinkSkip}); err != nil {
+		t.Fatalf("CopyDirOptionsContext returned error: %v", err)
+	}
+	for p, want := range map[string]bool{"file.txt": true, "link.txt": false, "linkdir": false} {
+		_, err := os.Lstat(filepath.Join(dst, p))
+		if got := err == nil; got != want {
+			t.Errorf("expected %s to exist=%v, got %v", p, want, err)
+		}
+	}
+
+	dst = filepath.Join(t.TempDir(), "preserve")
+	if err := CopyDirOptionsContext(ctx, src, dst, CopyOptions{}); err != nil {
+		t.Fatalf("CopyDirOptionsContext returned error: %v", err)
+	}
+	if target, err := os.Readlink(filepath.Join(dst, "link.txt")); err != nil || target != "file.txt" {
+		t.Errorf("expected the link to be preserved, got %q, %v", target, err)
+	}
+
+	if err := CopyDirOptionsContext(ctx, src, dst, CopyOptions{Symlinks: "bogus"}); err == nil {
+		t.Error("expected an unknown mode to be rejected")
+	}
+}
+
+func TestCopyDirOptionsContext_EscapingSymlinks(t *testing.T) {
+	src := symlinkTree(t)
+	outside := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(outside, []byte("secret"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	symlink(t, outside, filepath.Join(src, "sub", "escape"))
+	ctx := context.Background()
+
+	for _, mode := range []SymlinkMode{SymlinkPreserve, SymlinkFollow} {
+		err := CopyDirOptionsContext(ctx, src, filepath.Join(t.TempDir(), "dst"), CopyOptions{Symlinks: mode})
+		if !errors.Is(err, fserrors.ErrSymlinkEscapes) {
+			t.Errorf("expected %s mode to reject the escaping link, got %v", mode, err)
+		}
+	}
+	if err := CopyDirOptionsContext(ctx, src, filepath.Join(t.TempDir(), "dst"), CopyOptions{Symlinks: SymlinkSkip}); err != nil {
+		t.Errorf("expected skip mode to leave the escaping link out, got %v", err)
+	}
+	if err := CopyDirOptionsContext(ctx, src, filepath.Join(t.TempDir(), "dst"), CopyOptions{AllowEscapingSymlinks: true}); err != nil {
+		t.Errorf("expected the escaping link to be allowed, got %v", err)
+	}
+}
+
+func TestCopyDirOptionsContext_FollowCycle(t *testing.T) {
+	src := symlinkTree(t)
+	symlink(t, "..", filepath.Join(src, "sub", "parent"))
+
+	err := CopyDirOptionsContext(context.Background(), src, filepath.Join(t.TempDir(), "dst"), CopyOptions{Symlinks: SymlinkFollow})
+	if !errors.Is(err, fserrors.ErrSymlinkLoop) {
+		t.Errorf("expected a symlink cycle to be reported, got %v", err)
+	}
+}
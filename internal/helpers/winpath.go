@@ -0,0 +1,75 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package helpers
+
+import (
+	"regexp"
+	"strings"
+)
+
+// windowsDrive matches a path starting with a drive letter, such as "C:\" or
+// "C:/".
+var windowsDrive = regexp.MustCompile(`^[a-zA-Z]:[\\/]`)
+
+// IsWindowsPath reports whether path is an absolute Windows path: one
+// starting with a drive letter, a UNC share ("\\server\share"), or a path
+// in the long-path or device namespaces ("\\?\", "\\.\"), or a relative one
+// using backslashes (".\", "..\"). Such paths are recognized on every
+// platform, so a source written on a Windows runner is classified the same
+// everywhere.
+func IsWindowsPath(path string) bool {
+	return windowsDrive.MatchString(path) ||
+		strings.HasPrefix(path, `\\`) ||
+		strings.HasPrefix(path, `.\`) ||
+		strings.HasPrefix(path, `..\`)
+}
+
+// NormalizeWindowsPath removes the long-path prefix from path, turning
+// "\\?\C:\dir" into "C:\dir" and "\\?\UNC\server\share" into
+// "\\server\share", so that it can be compared with paths that do not carry
+// it. The Go runtime adds the prefix back where a path needs it. Paths in
+// the device namespace, and any other path, are returned unchanged.
+func NormalizeWindowsPath(path string) string {
+	if rest, ok := strings.CutPrefix(path, `\\?\`); ok {
+		if share, ok := cutPrefixFold(rest, `UNC\`); ok {
+			return `\\` + share
+		}
+		if windowsDrive.MatchString(rest) {
+			return rest
+		}
+	}
+	return path
+}
+
+// LocalPath returns the local path named by src, which had its "file://"
+// prefix removed. A URL path naming a drive, as in "file:///C:/dir", has
+// its leading slash removed, and long paths are normalized as by
+// NormalizeWindowsPath.
+func LocalPath(src string) string {
+	if len(src) > 1 && src[0] == '/' && windowsDrive.MatchString(src[1:]) {
+		src = src[1:]
+	}
+	return NormalizeWindowsPath(src)
+}
+
+// cutPrefixFold is strings.CutPrefix ignoring case.
+func cutPrefixFold(s, prefix string) (string, bool) {
+	if len(s) < len(prefix) || !strings.EqualFold(s[:len(prefix)], prefix) {
+		return s, false
+	}
+	return s[len(prefix):], true
+}
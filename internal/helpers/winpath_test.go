@@ -0,0 +1,81 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package helpers
+
+import "testing"
+
+func TestIsWindowsPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{`C:\policy`, true},
+		{`c:/policy`, true},
+		{`\\server\share\policy`, true},
+		{`\\?\C:\policy`, true},
+		{`\\.\pipe\name`, true},
+		{`.\policy`, true},
+		{`..\policy`, true},
+		{`C:policy`, false},
+		{`/policy`, false},
+		{`policy\rules`, false},
+		{`https://example.com/policy`, false},
+	}
+	for _, tt := range tests {
+		if got := IsWindowsPath(tt.path); got != tt.want {
+			t.Errorf("IsWindowsPath(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestNormalizeWindowsPath(t *testing.T) {
+	tests := []struct {
+		path, want string
+	}{
+		{`\\?\C:\policy`, `C:\policy`},
+		{`\\?\UNC\server\share\policy`, `\\server\share\policy`},
+		{`\\?\unc\server\share`, `\\server\share`},
+		{`\\?\Volume{b75e2c83}\policy`, `\\?\Volume{b75e2c83}\policy`},
+		{`\\.\C:\policy`, `\\.\C:\policy`},
+		{`\\server\share`, `\\server\share`},
+		{`C:\policy`, `C:\policy`},
+		{`/policy`, `/policy`},
+	}
+	for _, tt := range tests {
+		if got := NormalizeWindowsPath(tt.path); got != tt.want {
+			t.Errorf("NormalizeWindowsPath(%q) = %q, want %q", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestLocalPath(t *testing.T) {
+	tests := []struct {
+		src, want string
+	}{
+		{"/C:/policy", "C:/policy"},
+		{`/c:\policy`, `c:\policy`},
+		{`\\?\C:\policy`, `C:\policy`},
+		{"/etc/policy", "/etc/policy"},
+		{"./policy", "./policy"},
+		{"/", "/"},
+	}
+	for _, tt := range tests {
+		if got := LocalPath(tt.src); got != tt.want {
+			t.Errorf("LocalPath(%q) = %q, want %q", tt.src, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package logging holds the logger the gatherers and expanders emit their
+// structured debug events to, set with gogather.SetLogger. Nothing is logged
+// until one is set.
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"net/url"
+	"strings"
+	"sync/atomic"
+)
+
+var logger atomic.Pointer[slog.Logger]
+
+// discard is the logger used until one is set.
+var discard = slog.New(discardHandler{})
+
+// Set has the events logged to l, or discarded when l is nil.
+func Set(l *slog.Logger) {
+	logger.Store(l)
+}
+
+// Logger returns the logger events are logged to.
+func Logger() *slog.Logger {
+	if l := logger.Load(); l != nil {
+		return l
+	}
+	return discard
+}
+
+// Debug logs the debug event msg with the attributes args, as
+// slog.Logger.DebugContext does.
+func Debug(ctx context.Context, msg string, args ...any) {
+	Logger().DebugContext(ctx, msg, args...)
+}
+
+// Source returns the attribute naming the source uri, see Redact.
+func Source(uri string) slog.Attr {
+	return slog.String("source", Redact(uri))
+}
+
+// publicParams are the query parameters of sources that hold no secrets,
+// which Redact leaves as they are.
+var publicParams = map[string]bool{
+	"archive":  true,
+	"checksum": true,
+	"depth":    true,
+	"ref":      true,
+}
+
+// Redact returns uri with the password of any user information, and the
+// values of its query parameters, redacted. Query parameters carry the
+// credentials of signed URLs, such as the "sig" of Azure SAS URLs or the
+// "X-Amz-Signature" of presigned S3 URLs, so only those known to be
+// public are kept, such as "ref".
+func Redact(uri string) string {
+	uri = redactQuery(uri)
+	forced, rest, ok := strings.Cut(uri, "::")
+	if !ok {
+		forced, rest = "", uri
+	}
+	u, err := url.Parse(rest)
+	if err != nil {
+		return redactPassword(uri)
+	}
+	if u.User == nil {
+		return uri
+	}
+	if ok {
+		return forced + "::" + u.Redacted()
+	}
+	return u.Redacted()
+}
+
+// redactPassword redacts the password of the user information of uri, for
+// URIs that cannot be parsed.
+func redactPassword(uri string) string {
+	i := strings.Index(uri, "://")
+	if i < 0 {
+		return uri
+	}
+	host := uri[i+3:]
+	if end := strings.IndexAny(host, "/?#"); end >= 0 {
+		host = host[:end]
+	}
+	at := strings.LastIndex(host, "@")
+	colon := strings.Index(host, ":")
+	if at < 0 || colon < 0 || colon > at {
+		return uri
+	}
+	return uri[:i+3] + host[:colon+1] + "xxxxx" + uri[i+3+at:]
+}
+
+// redactQuery returns uri with the values of its query parameters, other
+// than the publicParams, replaced.
+func redactQuery(uri string) string {
+	base, query, ok := strings.Cut(uri, "?")
+	if !ok {
+		return uri
+	}
+	query, fragment, hasFragment := strings.Cut(query, "#")
+	params := strings.Split(query, "&")
+	for i, p := range params {
+		if k, v, ok := strings.Cut(p, "="); ok && v != "" && !publicParams[strings.ToLower(k)] {
+			params[i] = k + "=xxxxx"
+		}
+	}
+	uri = base + "?" + strings.Join(params, "&")
+	if hasFragment {
+		uri += "#" + fragment
+	}
+	return uri
+}
+
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
@@ -0,0 +1,81 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package metrics reports the work of the gatherers to the recorder set with
+// gogather.WithMetricsRecorder, which travels to them in the context of the
+// gather. Nothing is reported outside of such a gather.
+package metrics
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// Recorder is gogather.MetricsRecorder.
+type Recorder interface {
+	Gathered(scheme string, bytes int64, duration time.Duration, err error)
+	Retried(scheme string)
+	CacheHit(scheme string)
+}
+
+type key struct{}
+
+// Gather is a gather reported to a Recorder.
+type Gather struct {
+	r      Recorder
+	scheme string
+	start  time.Time
+	bytes  atomic.Int64
+}
+
+// Start starts reporting a gather of a source of scheme to r, returning the
+// context the gatherer reports its work in.
+func Start(ctx context.Context, r Recorder, scheme string) (context.Context, *Gather) {
+	g := &Gather{r: r, scheme: scheme, start: time.Now()}
+	return context.WithValue(ctx, key{}, g), g
+}
+
+// Done reports the gather, which failed with err when not nil.
+func (g *Gather) Done(err error) {
+	g.r.Gathered(g.scheme, g.bytes.Load(), time.Since(g.start), err)
+}
+
+func fromContext(ctx context.Context) *Gather {
+	g, _ := ctx.Value(key{}).(*Gather)
+	return g
+}
+
+// Transferred reports that n bytes were written to the destination.
+func Transferred(ctx context.Context, n int64) {
+	if g := fromContext(ctx); g != nil {
+		g.bytes.Add(n)
+	}
+}
+
+// Retried reports that a request was retried.
+func Retried(ctx context.Context) {
+	if g := fromContext(ctx); g != nil {
+		g.r.Retried(g.scheme)
+	}
+}
+
+// CacheHit reports that what was gathered came from a cache.
+func CacheHit(ctx context.Context) {
+	if g := fromContext(ctx); g != nil {
+		g.r.CacheHit(g.scheme)
+	}
+}
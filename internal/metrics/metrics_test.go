@@ -0,0 +1,61 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package metrics
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type recorder struct {
+	bytes    int64
+	retries  int
+	hits     int
+	gathered int
+}
+
+func (r *recorder) Gathered(scheme string, bytes int64, _ time.Duration, _ error) {
+	r.gathered++
+	r.bytes = bytes
+}
+
+func (r *recorder) Retried(string) { r.retries++ }
+
+func (r *recorder) CacheHit(string) { r.hits++ }
+
+func TestGather(t *testing.T) {
+	r := &recorder{}
+	ctx, g := Start(context.Background(), r, "http")
+	Transferred(ctx, 10)
+	Transferred(ctx, 5)
+	Retried(ctx)
+	CacheHit(ctx)
+	g.Done(nil)
+
+	if r.gathered != 1 || r.bytes != 15 || r.retries != 1 || r.hits != 1 {
+		t.Errorf("recorded %+v", r)
+	}
+}
+
+func TestNotRecorded(t *testing.T) {
+	// Without a gather in the context nothing is reported, nor panics
+	ctx := context.Background()
+	Transferred(ctx, 10)
+	Retried(ctx)
+	CacheHit(ctx)
+}
@@ -0,0 +1,82 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package multierr aggregates errors. Its Errors type is exported as
+// gogather.Errors, and lives here so that every package of the module can
+// return it without importing the root package.
+package multierr
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Errors is a list of errors reported together, such as the failures of a
+// batch of operations or of the cleanup following a failure. It matches
+// every error it holds with errors.Is and errors.As.
+type Errors []error
+
+// Append returns errs with the non-nil errors of more appended. Errors
+// values among them are flattened, so that nesting does not show in the
+// message. Errors wrapped with more context are kept as they are.
+func Append(errs Errors, more ...error) Errors {
+	for _, err := range more {
+		switch err := err.(type) {
+		case nil:
+		case Errors:
+			errs = Append(errs, err...)
+		default:
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// Error returns the message of a single error unchanged. Several are listed
+// in order, after their number, separated by semicolons.
+func (e Errors) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+	return Format(fmt.Sprintf("%d errors occurred", len(e)), e)
+}
+
+func (e Errors) Unwrap() []error {
+	return e
+}
+
+// Err returns nil if e is empty, its single error if it holds one, and e
+// otherwise.
+func (e Errors) Err() error {
+	switch len(e) {
+	case 0:
+		return nil
+	case 1:
+		return e[0]
+	default:
+		return e
+	}
+}
+
+// Format formats errs after summary in the way Errors does, for error types
+// holding more specific lists.
+func Format[E error](summary string, errs []E) string {
+	msgs := make([]string, 0, len(errs))
+	for _, err := range errs {
+		msgs = append(msgs, err.Error())
+	}
+	return summary + ": " + strings.Join(msgs, "; ")
+}
@@ -0,0 +1,60 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package multierr
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAppend(t *testing.T) {
+	a, b, c := errors.New("a"), errors.New("b"), errors.New("c")
+
+	errs := Append(nil, a, nil)
+	errs = Append(errs, nil, Errors{b, c})
+	assert.Equal(t, Errors{a, b, c}, errs)
+
+	wrapped := fmt.Errorf("cleanup: %w", Errors{b, c})
+	assert.Equal(t, Errors{a, wrapped}, Append(Errors{a}, wrapped))
+}
+
+func TestErrors_Error(t *testing.T) {
+	assert.Equal(t, "a", Errors{errors.New("a")}.Error())
+	assert.Equal(t, "3 errors occurred: a; b; c", Errors{errors.New("a"), errors.New("b"), errors.New("c")}.Error())
+}
+
+func TestErrors_Is(t *testing.T) {
+	err := Append(nil, errors.New("a"), fmt.Errorf("removing: %w", fs.ErrPermission)).Err()
+	assert.ErrorIs(t, err, fs.ErrPermission)
+
+	var pathErr *fs.PathError
+	err = Append(nil, errors.New("a"), &fs.PathError{Op: "remove", Path: "x", Err: fs.ErrNotExist}).Err()
+	assert.ErrorAs(t, err, &pathErr)
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestErrors_Err(t *testing.T) {
+	a := errors.New("a")
+	assert.NoError(t, Append(nil).Err())
+	assert.NoError(t, Append(nil, nil, nil).Err())
+	assert.Same(t, a, Append(nil, nil, a).Err())
+	assert.Equal(t, Errors{a, a}, Append(nil, a, a).Err())
+}
@@ -18,6 +18,8 @@ package registry
 
 import (
 	"net/http"
+	"os"
+	"path/filepath"
 
 	"github.com/spf13/viper"
 	"oras.land/oras-go/v2/registry/remote"
@@ -30,7 +32,73 @@ import (
 
 /* This code is sourced from the open-policy-agent/conftest project. */
 
+// EnvRegistryAuthFile names a containers auth.json file, as read by podman,
+// consulted before any other credentials.
+const EnvRegistryAuthFile = "REGISTRY_AUTH_FILE"
+
+// NewKeychain returns the store registry credentials are looked up in. The
+// file named by EnvRegistryAuthFile is consulted first, then the Docker
+// config with its credential helpers, and last the auth.json files podman
+// keeps in $XDG_RUNTIME_DIR/containers and $XDG_CONFIG_HOME/containers.
+func NewKeychain() (credentials.Store, error) {
+	docker, err := credentials.NewStoreFromDocker(credentials.StoreOptions{
+		AllowPlaintextPut:        true,
+		DetectDefaultNativeStore: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var before, after []credentials.Store
+	if path := os.Getenv(EnvRegistryAuthFile); path != "" {
+		store, err := credentials.NewFileStore(path)
+		if err != nil {
+			return nil, err
+		}
+		before = append(before, store)
+	}
+	for _, path := range podmanAuthFiles() {
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		store, err := credentials.NewFileStore(path)
+		if err != nil {
+			return nil, err
+		}
+		after = append(after, store)
+	}
+
+	stores := append(append(before, docker), after...)
+	return credentials.NewStoreWithFallbacks(stores[0], stores[1:]...), nil
+}
+
+// podmanAuthFiles returns the default locations of the podman auth.json
+// files.
+func podmanAuthFiles() []string {
+	var paths []string
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		paths = append(paths, filepath.Join(dir, "containers", "auth.json"))
+	}
+	config := os.Getenv("XDG_CONFIG_HOME")
+	if config == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			config = filepath.Join(home, ".config")
+		}
+	}
+	if config != "" {
+		paths = append(paths, filepath.Join(config, "containers", "auth.json"))
+	}
+	return paths
+}
+
 func SetupClient(repository *remote.Repository, transport http.RoundTripper) error {
+	return SetupClientWithCredential(repository, transport, nil)
+}
+
+// SetupClientWithCredential sets up the client of repository like
+// SetupClient, authenticating with credential instead of the keychain if it
+// is not nil.
+func SetupClientWithCredential(repository *remote.Repository, transport http.RoundTripper, credential auth.CredentialFunc) error {
 	registry := repository.Reference.Host()
 
 	// If `--tls=false` was provided or accessing the registry via loopback with
@@ -46,17 +114,17 @@ func SetupClient(repository *remote.Repository, transport http.RoundTripper) err
 		Transport: retry.NewTransport(transport),
 	}
 
-	store, err := credentials.NewStoreFromDocker(credentials.StoreOptions{
-		AllowPlaintextPut:        true,
-		DetectDefaultNativeStore: true,
-	})
-	if err != nil {
-		return err
+	if credential == nil {
+		store, err := NewKeychain()
+		if err != nil {
+			return err
+		}
+		credential = credentials.Credential(store)
 	}
 
 	client := &auth.Client{
 		Client:     httpClient,
-		Credential: credentials.Credential(store),
+		Credential: credential,
 		Cache:      auth.NewCache(),
 	}
 	client.SetUserAgent("conftest")
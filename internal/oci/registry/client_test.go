@@ -17,6 +17,11 @@
 package registry
 
 import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
 	"strconv"
 	"testing"
 
@@ -110,3 +115,49 @@ func TestRepositoryPlainHTTP(t *testing.T) {
 		})
 	}
 }
+
+// writeAuthFile writes a Docker config style auth file at path holding the
+// given user name and password for host.
+func writeAuthFile(t *testing.T, path, host, user, password string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	encoded := base64.StdEncoding.EncodeToString([]byte(user + ":" + password))
+	content := fmt.Sprintf(`{"auths":{%q:{"auth":%q}}}`, host, encoded)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestNewKeychain(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("DOCKER_CONFIG", filepath.Join(dir, "docker"))
+	t.Setenv("XDG_RUNTIME_DIR", filepath.Join(dir, "run"))
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(dir, "config"))
+	t.Setenv(EnvRegistryAuthFile, filepath.Join(dir, "override.json"))
+
+	writeAuthFile(t, filepath.Join(dir, "docker", "config.json"), "docker.example.com", "docker", "d")
+	writeAuthFile(t, filepath.Join(dir, "run", "containers", "auth.json"), "podman.example.com", "podman", "p")
+	writeAuthFile(t, filepath.Join(dir, "config", "containers", "auth.json"), "docker.example.com", "shadowed", "s")
+	writeAuthFile(t, filepath.Join(dir, "override.json"), "override.example.com", "override", "o")
+
+	store, err := NewKeychain()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for host, want := range map[string]string{
+		"docker.example.com":   "docker",
+		"podman.example.com":   "podman",
+		"override.example.com": "override",
+		"other.example.com":    "",
+	} {
+		cred, err := store.Get(context.Background(), host)
+		if err != nil {
+			t.Fatalf("Get(%s): %v", host, err)
+		}
+		if cred.Username != want {
+			t.Errorf("Get(%s) user = %q, want %q", host, cred.Username, want)
+		}
+	}
+}
@@ -0,0 +1,485 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package provider contains an http.RoundTripper that is aware of the API
+// quotas enforced by GitHub and GitLab. It throttles outgoing requests with a
+// token bucket, honors the rate limit headers returned by the providers, and
+// revalidates previously seen responses using ETag and Last-Modified so that
+// unchanged resources do not count against the quota.
+package provider
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MaxCacheableSize is the largest response body, in bytes, kept in the
+// conditional request cache. Larger responses are streamed through untouched.
+const MaxCacheableSize = 10 * 1024 * 1024
+
+// MaxCacheSize bounds the bodies kept in the conditional request cache, in
+// bytes. The least recently used responses are evicted beyond it.
+var MaxCacheSize int64 = 64 * 1024 * 1024
+
+// identityHeaders carry the credentials of a request. Responses are cached
+// per identity, so that one caller is never served what another was.
+var identityHeaders = []string{"Authorization", "Private-Token", "Job-Token", "Cookie"}
+
+// conditionalHeaders make a request conditional or partial. Such requests
+// are the caller's to revalidate, and are neither answered from nor stored
+// in the cache.
+var conditionalHeaders = []string{"If-None-Match", "If-Modified-Since", "If-Match", "If-Unmodified-Since", "If-Range", "Range"}
+
+var (
+	// DefaultRate is the sustained number of requests per second allowed to
+	// provider hosts.
+	DefaultRate = 10.0
+	// DefaultBurst is the number of requests that may be issued back to back
+	// before DefaultRate applies.
+	DefaultBurst = 20
+	// MaxWait is the longest the transport will block waiting for an
+	// exhausted quota to reset. Beyond that the request fails immediately.
+	MaxWait = time.Minute
+	// MaxRetries is the number of times a rate limited request is retried
+	// before the rate limited response is returned.
+	MaxRetries = 3
+)
+
+// providerHosts lists hosts serving GitHub and GitLab APIs or raw content.
+var providerHosts = []string{
+	"api.github.com",
+	"raw.githubusercontent.com",
+	"codeload.github.com",
+	"gitlab.com",
+}
+
+// IsProviderURL reports whether the request targets a GitHub or GitLab API
+// (including GitHub Enterprise and self-managed GitLab API paths).
+func IsProviderURL(req *http.Request) bool {
+	host := strings.ToLower(req.URL.Hostname())
+	for _, h := range providerHosts {
+		if host == h {
+			return true
+		}
+	}
+	return strings.HasPrefix(req.URL.Path, "/api/v3/") || strings.HasPrefix(req.URL.Path, "/api/v4/")
+}
+
+// TokenBucket is a simple token bucket rate limiter safe for concurrent use.
+type TokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucket returns a TokenBucket refilling at rate tokens per second
+// and holding at most burst tokens. The bucket starts full.
+func NewTokenBucket(rate float64, burst int) *TokenBucket {
+	return &TokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// Wait blocks until a token is available or the context is done.
+func (b *TokenBucket) Wait(ctx context.Context) error {
+	for {
+		b.mu.Lock()
+		now := time.Now()
+		b.tokens += now.Sub(b.last).Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.last = now
+		if b.tokens >= 1 {
+			b.tokens--
+			b.mu.Unlock()
+			return nil
+		}
+		wait := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+		b.mu.Unlock()
+
+		if err := sleep(ctx, wait); err != nil {
+			return err
+		}
+	}
+}
+
+type cachedResponse struct {
+	key          string
+	etag         string
+	lastModified string
+	header       http.Header
+	body         []byte
+}
+
+// state is shared between transports so quotas and cached responses are
+// tracked per process rather than per gather.
+type state struct {
+	mu      sync.Mutex
+	limiter *TokenBucket
+	resets  map[string]time.Time
+	// cache maps the keys of requests to their elements in lru, which
+	// holds the cached responses, most recently used first, whose bodies
+	// add up to size bytes.
+	cache map[string]*list.Element
+	lru   *list.List
+	size  int64
+}
+
+func newState(limiter *TokenBucket) *state {
+	return &state{
+		limiter: limiter,
+		resets:  map[string]time.Time{},
+		cache:   map[string]*list.Element{},
+		lru:     list.New(),
+	}
+}
+
+var shared = newState(NewTokenBucket(DefaultRate, DefaultBurst))
+
+// Transport wraps a base RoundTripper, applying rate limiting and conditional
+// requests to provider URLs. Requests to other hosts are passed through.
+type Transport struct {
+	Base  http.RoundTripper
+	state *state
+}
+
+// NewTransport returns a Transport delegating to base. All transports
+// returned by NewTransport share a single limiter and response cache.
+func NewTransport(base http.RoundTripper) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &Transport{Base: base, state: shared}
+}
+
+// RoundTrip implements http.RoundTripper. Rate limited requests are retried
+// up to MaxRetries times, when their body, if any, can be sent again, after
+// which the rate limited response is returned.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !IsProviderURL(req) {
+		return t.Base.RoundTrip(req)
+	}
+	replayable := req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+	for retries := 0; ; retries++ {
+		resp, wait, err := t.roundTrip(req, replayable && retries < MaxRetries)
+		if err != nil || resp != nil {
+			return resp, err
+		}
+		if err := sleep(req.Context(), wait); err != nil {
+			return nil, err
+		}
+		if req, err = rewind(req); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// roundTrip sends req once. When it is rate limited and retry is set, it
+// returns no response but how long to wait before retrying it.
+func (t *Transport) roundTrip(req *http.Request, retry bool) (*http.Response, time.Duration, error) {
+	ctx := req.Context()
+	host := req.URL.Host
+	key, cacheable := cacheKey(req)
+
+	if err := t.waitForReset(ctx, host); err != nil {
+		return nil, 0, err
+	}
+	if err := t.state.limiter.Wait(ctx); err != nil {
+		return nil, 0, err
+	}
+
+	var cached *cachedResponse
+	if cacheable {
+		cached = t.lookup(key)
+	}
+	if cached != nil {
+		req = req.Clone(ctx)
+		if cached.etag != "" {
+			req.Header.Set("If-None-Match", cached.etag)
+		}
+		if cached.lastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.lastModified)
+		}
+	}
+
+	resp, err := t.Base.RoundTrip(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	t.recordLimits(host, resp)
+
+	if isRateLimited(resp) {
+		wait := retryAfter(resp, t.resetFor(host))
+		if wait > MaxWait {
+			resp.Body.Close()
+			return nil, 0, fmt.Errorf("rate limit exceeded for %s, retry after %s", host, wait.Round(time.Second))
+		}
+		if !retry {
+			return resp, 0, nil
+		}
+		resp.Body.Close()
+		// Retries are sent as the caller's request, without the
+		// validators added here
+		return nil, wait, nil
+	}
+
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		resp.Body.Close()
+		return cachedToResponse(req, cached), 0, nil
+	}
+
+	if cacheable && resp.StatusCode == http.StatusOK {
+		resp, err = t.store(key, resp)
+		return resp, 0, err
+	}
+	return resp, 0, nil
+}
+
+// rewind returns req with a fresh copy of its body, if it has one, for it
+// to be sent again.
+func rewind(req *http.Request) (*http.Request, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return req, nil
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, fmt.Errorf("failed to rewind request body: %w", err)
+	}
+	req = req.Clone(req.Context())
+	req.Body = body
+	return req, nil
+}
+
+// cacheKey returns the key of req in the cache, its URL and a digest of the
+// credentials it carries, and whether it may be answered from the cache,
+// which only plain GET requests are.
+func cacheKey(req *http.Request) (string, bool) {
+	if req.Method != http.MethodGet {
+		return "", false
+	}
+	for _, h := range conditionalHeaders {
+		if req.Header.Get(h) != "" {
+			return "", false
+		}
+	}
+	// Only a digest is kept, so that credentials are not held in memory
+	// any longer than the request
+	identity := sha256.New()
+	for _, h := range identityHeaders {
+		for _, v := range req.Header.Values(h) {
+			fmt.Fprintf(identity, "%s: %s\n", h, v)
+		}
+	}
+	if req.URL.User != nil {
+		fmt.Fprintf(identity, "user: %s\n", req.URL.User)
+	}
+	u := *req.URL
+	u.User = nil
+	return u.String() + " " + hex.EncodeToString(identity.Sum(nil)), true
+}
+
+func (t *Transport) lookup(key string) *cachedResponse {
+	t.state.mu.Lock()
+	defer t.state.mu.Unlock()
+	e, ok := t.state.cache[key]
+	if !ok {
+		return nil
+	}
+	t.state.lru.MoveToFront(e)
+	return e.Value.(*cachedResponse)
+}
+
+// store caches a successful response when it carries a validator and is small
+// enough, returning a response whose body can still be consumed by the caller.
+func (t *Transport) store(key string, resp *http.Response) (*http.Response, error) {
+	etag := resp.Header.Get("ETag")
+	lastModified := resp.Header.Get("Last-Modified")
+	if etag == "" && lastModified == "" {
+		return resp, nil
+	}
+	if resp.ContentLength < 0 || resp.ContentLength > MaxCacheableSize {
+		return resp, nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+
+	t.state.add(&cachedResponse{
+		key:          key,
+		etag:         etag,
+		lastModified: lastModified,
+		header:       resp.Header.Clone(),
+		body:         body,
+	})
+
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return resp, nil
+}
+
+// add caches c, in place of any response cached under its key, and evicts
+// the least recently used responses until the cache fits MaxCacheSize.
+func (s *state) add(c *cachedResponse) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.cache[c.key]; ok {
+		s.remove(e)
+	}
+	s.cache[c.key] = s.lru.PushFront(c)
+	s.size += int64(len(c.body))
+	for s.size > MaxCacheSize && s.lru.Len() > 0 {
+		s.remove(s.lru.Back())
+	}
+}
+
+// remove drops the response of e from the cache, for callers holding the
+// lock.
+func (s *state) remove(e *list.Element) {
+	c := s.lru.Remove(e).(*cachedResponse)
+	delete(s.cache, c.key)
+	s.size -= int64(len(c.body))
+}
+
+func (t *Transport) waitForReset(ctx context.Context, host string) error {
+	reset := t.resetFor(host)
+	if reset.IsZero() {
+		return nil
+	}
+	wait := time.Until(reset)
+	if wait <= 0 {
+		return nil
+	}
+	if wait > MaxWait {
+		return fmt.Errorf("rate limit exhausted for %s until %s", host, reset.Format(time.RFC3339))
+	}
+	return sleep(ctx, wait)
+}
+
+func (t *Transport) resetFor(host string) time.Time {
+	t.state.mu.Lock()
+	defer t.state.mu.Unlock()
+	return t.state.resets[host]
+}
+
+// recordLimits remembers when the quota for host resets if the response
+// reports that no requests remain.
+func (t *Transport) recordLimits(host string, resp *http.Response) {
+	remaining := firstHeader(resp.Header, "X-RateLimit-Remaining", "RateLimit-Remaining")
+	reset := firstHeader(resp.Header, "X-RateLimit-Reset", "RateLimit-Reset")
+
+	t.state.mu.Lock()
+	defer t.state.mu.Unlock()
+	if remaining != "0" {
+		delete(t.state.resets, host)
+		return
+	}
+	if secs, err := strconv.ParseInt(reset, 10, 64); err == nil {
+		t.state.resets[host] = time.Unix(secs, 0)
+	}
+}
+
+func isRateLimited(resp *http.Response) bool {
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return true
+	}
+	if resp.StatusCode != http.StatusForbidden {
+		return false
+	}
+	return resp.Header.Get("Retry-After") != "" ||
+		firstHeader(resp.Header, "X-RateLimit-Remaining", "RateLimit-Remaining") == "0"
+}
+
+// retryAfter returns how long to wait before retrying a rate limited
+// request, preferring Retry-After and falling back to the quota reset time.
+func retryAfter(resp *http.Response, reset time.Time) time.Duration {
+	if d, ok := ParseRetryAfter(resp.Header.Get("Retry-After")); ok {
+		return d
+	}
+	if !reset.IsZero() {
+		return time.Until(reset)
+	}
+	return time.Second
+}
+
+// ParseRetryAfter parses the value of a Retry-After header, either a number
+// of seconds or an HTTP date, into the delay it asks for.
+func ParseRetryAfter(v string) (time.Duration, bool) {
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return time.Duration(secs) * time.Second, true
+	}
+	if at, err := http.ParseTime(v); err == nil {
+		return time.Until(at), true
+	}
+	return 0, false
+}
+
+func cachedToResponse(req *http.Request, c *cachedResponse) *http.Response {
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        c.header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(c.body)),
+		ContentLength: int64(len(c.body)),
+		Request:       req,
+	}
+}
+
+func firstHeader(h http.Header, names ...string) string {
+	for _, name := range names {
+		if v := h.Get(name); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
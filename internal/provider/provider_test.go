@@ -0,0 +1,351 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package provider
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestTransport returns a Transport with isolated state that treats the
+// test server host as a provider host.
+func newTestTransport(t *testing.T) *Transport {
+	t.Helper()
+	orig := providerHosts
+	providerHosts = append([]string{"127.0.0.1"}, orig...)
+	t.Cleanup(func() { providerHosts = orig })
+
+	return &Transport{
+		Base:  http.DefaultTransport,
+		state: newState(NewTokenBucket(1000, 1000)),
+	}
+}
+
+func TestIsProviderURL(t *testing.T) {
+	testCases := []struct {
+		url  string
+		want bool
+	}{
+		{"https://api.github.com/repos/org/repo/releases", true},
+		{"https://raw.githubusercontent.com/org/repo/main/file.rego", true},
+		{"https://gitlab.com/api/v4/projects/1/repository/tags", true},
+		{"https://ghe.example.com/api/v3/repos/org/repo/tags", true},
+		{"https://gitlab.example.com/api/v4/projects/1", true},
+		{"https://example.com/file.txt", false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.url, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, tc.url, nil)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, IsProviderURL(req))
+		})
+	}
+}
+
+func TestTokenBucket_Wait(t *testing.T) {
+	b := NewTokenBucket(100, 1)
+	ctx := context.Background()
+
+	start := time.Now()
+	require.NoError(t, b.Wait(ctx))
+	require.NoError(t, b.Wait(ctx))
+	assert.GreaterOrEqual(t, time.Since(start), 5*time.Millisecond)
+}
+
+func TestTokenBucket_WaitCanceled(t *testing.T) {
+	b := NewTokenBucket(0.001, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	require.NoError(t, b.Wait(ctx))
+
+	cancel()
+	assert.ErrorIs(t, b.Wait(ctx), context.Canceled)
+}
+
+func TestTransport_ConditionalRequest(t *testing.T) {
+	var notModified atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			notModified.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		_, _ = w.Write([]byte("release data"))
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: newTestTransport(t)}
+
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(server.URL + "/releases")
+		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "release data", string(body))
+	}
+	assert.Equal(t, int32(1), notModified.Load())
+}
+
+func TestTransport_CacheIdentity(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if r.Header.Get("If-None-Match") != "" {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"`+r.Header.Get("Authorization")+`"`)
+		_, _ = w.Write([]byte("data for " + r.Header.Get("Authorization")))
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: newTestTransport(t)}
+	get := func(auth string) string {
+		req, err := http.NewRequest(http.MethodGet, server.URL+"/private", nil)
+		require.NoError(t, err)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return string(body)
+	}
+
+	assert.Equal(t, "data for Bearer a", get("Bearer a"))
+	// Another identity is not served what the first one was
+	assert.Equal(t, "data for Bearer b", get("Bearer b"))
+	assert.Equal(t, "data for ", get(""))
+	assert.Equal(t, "data for Bearer a", get("Bearer a"))
+	assert.Equal(t, int32(4), calls.Load())
+}
+
+func TestTransport_CallerConditionalRequest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		switch {
+		case r.Header.Get("If-None-Match") == `"v1"`:
+			w.WriteHeader(http.StatusNotModified)
+		case r.Header.Get("Range") == "bytes=8-":
+			w.WriteHeader(http.StatusPartialContent)
+			_, _ = w.Write([]byte("data"))
+		default:
+			_, _ = w.Write([]byte("release data"))
+		}
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: newTestTransport(t)}
+	resp, err := client.Get(server.URL + "/releases")
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	// The validators of the caller are sent as they are, and a 304 returned
+	// to it as one
+	req, err := http.NewRequest(http.MethodGet, server.URL+"/releases", nil)
+	require.NoError(t, err)
+	req.Header.Set("If-None-Match", `"v0"`)
+	resp, err = client.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	req.Header.Set("If-None-Match", `"v1"`)
+	resp, err = client.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+
+	// Nor is a range answered with the whole response cached
+	req, err = http.NewRequest(http.MethodGet, server.URL+"/releases", nil)
+	require.NoError(t, err)
+	req.Header.Set("Range", "bytes=8-")
+	resp, err = client.Do(req)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusPartialContent, resp.StatusCode)
+	assert.Equal(t, "data", string(body))
+}
+
+func TestTransport_CacheEviction(t *testing.T) {
+	orig := MaxCacheSize
+	MaxCacheSize = 10
+	t.Cleanup(func() { MaxCacheSize = orig })
+
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if r.Header.Get("If-None-Match") != "" {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		_, _ = w.Write([]byte("12345"))
+	}))
+	defer server.Close()
+
+	tr := newTestTransport(t)
+	client := &http.Client{Transport: tr}
+	for _, p := range []string{"/a", "/b", "/a", "/c"} {
+		resp, err := client.Get(server.URL + p)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+	// "/b", the least recently used, made room for "/c"
+	assert.Equal(t, 2, tr.state.lru.Len())
+	assert.Equal(t, int64(10), tr.state.size)
+	for k := range tr.state.cache {
+		assert.NotContains(t, k, "/b ")
+	}
+}
+
+func TestTransport_RetryAfterRevalidation(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch calls.Add(1) {
+		case 2:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case 3:
+			w.WriteHeader(http.StatusNotModified)
+		default:
+			w.Header().Set("ETag", `"v1"`)
+			_, _ = w.Write([]byte("release data"))
+		}
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: newTestTransport(t)}
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(server.URL + "/releases")
+		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "release data", string(body))
+	}
+	assert.Equal(t, int32(3), calls.Load())
+}
+
+func TestTransport_RetryAfter(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		_, _ = w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: newTestTransport(t)}
+	resp, err := client.Get(server.URL + "/tags")
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, int32(2), calls.Load())
+}
+
+func TestTransport_RetryLimit(t *testing.T) {
+	var calls atomic.Int32
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		b, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(b))
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer server.Close()
+	client := &http.Client{Transport: newTestTransport(t)}
+
+	// A server rate limiting every request has its response returned once
+	// the retries run out, and each retry sends the body again
+	resp, err := client.Post(server.URL+"/graphql", "application/json", strings.NewReader("query"))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, int32(MaxRetries+1), calls.Load())
+	assert.Equal(t, []string{"query", "query", "query", "query"}, bodies)
+
+	// A body that cannot be sent again is not retried
+	calls.Store(0)
+	req, err := http.NewRequest(http.MethodPost, server.URL+"/graphql", io.NopCloser(strings.NewReader("query")))
+	require.NoError(t, err)
+	require.Nil(t, req.GetBody)
+	resp, err = client.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestTransport_QuotaExhausted(t *testing.T) {
+	reset := time.Now().Add(time.Hour).Unix()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset, 10))
+		_, _ = w.Write([]byte("last one"))
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: newTestTransport(t)}
+	resp, err := client.Get(server.URL + "/first")
+	require.NoError(t, err)
+	resp.Body.Close()
+
+	_, err = client.Get(server.URL + "/second")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "rate limit exhausted")
+}
+
+func TestTransport_NonProviderPassThrough(t *testing.T) {
+	tr := NewTransport(nil)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Empty(t, r.Header.Get("If-None-Match"))
+		w.Header().Set("ETag", `"v1"`)
+		_, _ = w.Write([]byte("data"))
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: tr}
+	for i := 0; i < 2; i++ {
+		resp, err := client.Get(server.URL + "/file")
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+}
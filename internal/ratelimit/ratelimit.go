@@ -0,0 +1,185 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package ratelimit throttles the bandwidth of the network gatherers, so
+// that gathers running on shared nodes don't saturate the network.
+package ratelimit
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// maxChunk bounds the bytes read at once, so that the transfer is spread
+// evenly over time rather than in bursts.
+const maxChunk = 32 * 1024
+
+// Limiter is a token bucket allowing a number of bytes per second, with
+// bursts of up to a second's worth. It is safe for concurrent use, so that
+// the transfers sharing a Limiter share its bandwidth.
+type Limiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// New returns a Limiter allowing bytesPerSecond, or nil when it is not
+// positive. A nil Limiter allows any bandwidth.
+func New(bytesPerSecond int64) *Limiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+	rate := float64(bytesPerSecond)
+	return &Limiter{rate: rate, burst: rate, tokens: rate, last: time.Now()}
+}
+
+// chunk returns the number of bytes to read at once.
+func (l *Limiter) chunk() int {
+	if l.burst < maxChunk {
+		return max(1, int(l.burst))
+	}
+	return maxChunk
+}
+
+// WaitN blocks until n bytes can be transferred, or ctx is done.
+func (l *Limiter) WaitN(ctx context.Context, n int) error {
+	if l == nil || n <= 0 {
+		return nil
+	}
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	// The bytes are taken right away, later transfers wait for the debt
+	// to be paid back
+	l.tokens -= float64(n)
+	wait := time.Duration(-l.tokens / l.rate * float64(time.Second))
+	l.mu.Unlock()
+	if wait <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+type reader struct {
+	ctx context.Context
+	r   io.Reader
+	l   *Limiter
+}
+
+// NewReader returns a reader reading r no faster than l allows, or r itself
+// when l is nil.
+func NewReader(ctx context.Context, r io.Reader, l *Limiter) io.Reader {
+	if l == nil {
+		return r
+	}
+	return &reader{ctx: ctx, r: r, l: l}
+}
+
+func (r *reader) Read(p []byte) (int, error) {
+	if len(p) > r.l.chunk() {
+		p = p[:r.l.chunk()]
+	}
+	n, err := r.r.Read(p)
+	if werr := r.l.WaitN(r.ctx, n); werr != nil {
+		return n, werr
+	}
+	return n, err
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+type transport struct {
+	base http.RoundTripper
+	l    *Limiter
+}
+
+// Transport returns base with the bodies of its responses read no faster
+// than l allows, or base itself when l is nil.
+func Transport(base http.RoundTripper, l *Limiter) http.RoundTripper {
+	if l == nil {
+		return base
+	}
+	return &transport{base: base, l: l}
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = readCloser{NewReader(req.Context(), resp.Body, t.l), resp.Body}
+	return resp, nil
+}
+
+type limiterKey struct{}
+
+// WithLimiter returns a context carrying l, throttling the connections
+// dialed with it by Dialer.
+func WithLimiter(ctx context.Context, l *Limiter) context.Context {
+	return context.WithValue(ctx, limiterKey{}, l)
+}
+
+// FromContext returns the Limiter carried by ctx, or nil.
+func FromContext(ctx context.Context) *Limiter {
+	l, _ := ctx.Value(limiterKey{}).(*Limiter)
+	return l
+}
+
+// Dialer returns a function dialing connections with dial whose reads are
+// throttled by the Limiter carried by the context of the dial, if any. It
+// suits transports that can't be wrapped, as the connections outlive the
+// dial they are throttled for; the transport should not keep them alive.
+func Dialer(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		conn, err := dial(ctx, network, addr)
+		if err != nil {
+			return nil, err
+		}
+		l := FromContext(ctx)
+		if l == nil {
+			return conn, nil
+		}
+		return &throttledConn{Conn: conn, r: NewReader(context.WithoutCancel(ctx), conn, l)}, nil
+	}
+}
+
+// throttledConn is a connection whose reads are throttled.
+type throttledConn struct {
+	net.Conn
+	r io.Reader
+}
+
+func (c *throttledConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
@@ -0,0 +1,129 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package ratelimit
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	assert.Nil(t, New(0))
+	assert.Nil(t, New(-1))
+	assert.NotNil(t, New(1))
+
+	// A nil Limiter never waits
+	var l *Limiter
+	assert.NoError(t, l.WaitN(context.Background(), 1<<30))
+}
+
+func TestLimiter_WaitN(t *testing.T) {
+	l := New(1000)
+	start := time.Now()
+	// The first second's worth is a burst, the rest waits
+	require.NoError(t, l.WaitN(context.Background(), 1000))
+	assert.Less(t, time.Since(start), 100*time.Millisecond)
+	require.NoError(t, l.WaitN(context.Background(), 300))
+	assert.GreaterOrEqual(t, time.Since(start), 250*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.ErrorIs(t, l.WaitN(ctx, 10000), context.Canceled)
+}
+
+func TestLimiter_Shared(t *testing.T) {
+	l := New(2000)
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := io.Copy(io.Discard, NewReader(context.Background(), bytes.NewReader(make([]byte, 750)), l))
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	// 3000 bytes at 2000 bytes per second, after a burst of 2000
+	assert.GreaterOrEqual(t, time.Since(start), 450*time.Millisecond)
+}
+
+func TestNewReader(t *testing.T) {
+	r := bytes.NewReader([]byte("data"))
+	assert.Same(t, io.Reader(r), NewReader(context.Background(), r, nil))
+
+	data := bytes.Repeat([]byte("x"), 1500)
+	start := time.Now()
+	got, err := io.ReadAll(NewReader(context.Background(), bytes.NewReader(data), New(1000)))
+	require.NoError(t, err)
+	assert.Equal(t, data, got)
+	assert.GreaterOrEqual(t, time.Since(start), 450*time.Millisecond)
+}
+
+func TestTransport(t *testing.T) {
+	base := http.DefaultTransport
+	assert.Same(t, base, Transport(base, nil))
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(bytes.Repeat([]byte("x"), 1500))
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: Transport(server.Client().Transport, New(1000))}
+	start := time.Now()
+	resp, err := client.Get(server.URL)
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	assert.Len(t, body, 1500)
+	assert.GreaterOrEqual(t, time.Since(start), 450*time.Millisecond)
+}
+
+func TestDialer(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	dial := Dialer(func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return client, nil
+	})
+
+	// Without a Limiter the connection is left alone
+	conn, err := dial(context.Background(), "tcp", "example.com:443")
+	require.NoError(t, err)
+	assert.Same(t, client, conn)
+
+	conn, err = dial(WithLimiter(context.Background(), New(1000)), "tcp", "example.com:443")
+	require.NoError(t, err)
+	defer conn.Close()
+	go func() {
+		_, _ = server.Write(make([]byte, 1500))
+	}()
+	start := time.Now()
+	_, err = io.ReadFull(conn, make([]byte, 1500))
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), 450*time.Millisecond)
+}
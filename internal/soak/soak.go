@@ -0,0 +1,120 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package soak supports the long running tests that check expansions of
+// multi-gigabyte archives run in constant memory and with a bounded number
+// of open files. They are skipped unless EnvSoak is set.
+package soak
+
+import (
+	"os"
+	"runtime"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// EnvSoak enables the soak tests when set to the size, in GiB, of the
+// synthetic archives they expand, e.g. GO_GATHER_SOAK=4.
+const EnvSoak = "GO_GATHER_SOAK"
+
+// Size returns the size in bytes of the archives the soak tests expand,
+// skipping t when soak tests are not enabled.
+func Size(t testing.TB) int64 {
+	t.Helper()
+	v := os.Getenv(EnvSoak)
+	if v == "" {
+		t.Skipf("soak test, set %s to the size of the archive in GiB to run it", EnvSoak)
+	}
+	gib, err := strconv.ParseFloat(v, 64)
+	if err != nil || gib <= 0 {
+		t.Fatalf("invalid %s %q, expected a size in GiB", EnvSoak, v)
+	}
+	return int64(gib * (1 << 30))
+}
+
+// Sampler records the peak heap in use and the peak number of open files
+// of the process while it runs.
+type Sampler struct {
+	stop chan struct{}
+	done sync.WaitGroup
+
+	// BaseHeap and BaseFiles are the heap in use and the open files when
+	// the sampler was started.
+	BaseHeap, BaseFiles uint64
+	// PeakHeap and PeakFiles are the largest values seen.
+	PeakHeap, PeakFiles uint64
+}
+
+// Start starts sampling every interval until Stop is called.
+func Start(interval time.Duration) *Sampler {
+	runtime.GC()
+	s := &Sampler{stop: make(chan struct{})}
+	s.BaseHeap, s.BaseFiles = heapInUse(), openFiles()
+	s.PeakHeap, s.PeakFiles = s.BaseHeap, s.BaseFiles
+	s.done.Add(1)
+	go func() {
+		defer s.done.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.stop:
+				return
+			case <-ticker.C:
+				s.PeakHeap = max(s.PeakHeap, heapInUse())
+				s.PeakFiles = max(s.PeakFiles, openFiles())
+			}
+		}
+	}()
+	return s
+}
+
+// Stop stops sampling, after which the peaks can be read.
+func (s *Sampler) Stop() {
+	close(s.stop)
+	s.done.Wait()
+}
+
+// Check fails t if the heap grew by more than heap bytes, or more than
+// files extra files were open at once, while sampling.
+func (s *Sampler) Check(t testing.TB, heap, files uint64) {
+	t.Helper()
+	t.Logf("peak heap %d MiB over a base of %d MiB, peak open files %d over a base of %d", (s.PeakHeap-s.BaseHeap)>>20, s.BaseHeap>>20, s.PeakFiles-s.BaseFiles, s.BaseFiles)
+	if s.PeakHeap-s.BaseHeap > heap {
+		t.Errorf("the heap grew by %d bytes, more than the %d allowed", s.PeakHeap-s.BaseHeap, heap)
+	}
+	if s.PeakFiles-s.BaseFiles > files {
+		t.Errorf("%d more files were open at once, more than the %d allowed", s.PeakFiles-s.BaseFiles, files)
+	}
+}
+
+func heapInUse() uint64 {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	return m.HeapInuse
+}
+
+// openFiles returns the number of files the process has open, 0 where
+// /proc is not available.
+func openFiles() uint64 {
+	entries, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		return 0
+	}
+	return uint64(len(entries))
+}
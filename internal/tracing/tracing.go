@@ -0,0 +1,84 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package tracing starts the OpenTelemetry spans of the gatherers and
+// expanders. Spans are started with the tracer provider of the span of the
+// context they are started in, so that nothing is traced unless the caller
+// traces the operation, as gogather.WithTracerProvider does.
+package tracing
+
+import (
+	"context"
+	"net/url"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/enterprise-contract/go-gather/internal/cloud"
+	"github.com/enterprise-contract/go-gather/internal/logging"
+)
+
+// Scope is the instrumentation scope of the spans.
+const Scope = "github.com/enterprise-contract/go-gather"
+
+// Start starts the span name with the attributes attrs, as a child of the
+// span of ctx.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	tracer := trace.SpanFromContext(ctx).TracerProvider().Tracer(Scope)
+	return tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End records err on span, when not nil, and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Annotate sets the attributes attrs on the span of ctx.
+func Annotate(ctx context.Context, attrs ...attribute.KeyValue) {
+	trace.SpanFromContext(ctx).SetAttributes(attrs...)
+}
+
+// Source returns the attributes naming the source uri, with any password
+// redacted, and its type, see SourceType.
+func Source(uri string) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("source.uri", logging.Redact(uri)),
+		attribute.String("source.type", SourceType(uri)),
+	}
+}
+
+// SourceType returns the type of the source uri: the forced gatherer of
+// "git::…" sources, the object store of cloud storage URLs, e.g. "s3" for
+// "https://bucket.s3.amazonaws.com/key", the scheme of other URLs, and
+// "file" for paths.
+func SourceType(uri string) string {
+	if store := cloud.Store(uri); store != "" {
+		return store
+	}
+	if forced, _, ok := strings.Cut(uri, "::"); ok && !strings.ContainsAny(forced, "/:") {
+		return forced
+	}
+	if u, err := url.Parse(uri); err == nil && len(u.Scheme) > 1 {
+		return u.Scheme
+	}
+	return "file"
+}
@@ -0,0 +1,192 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package intoto attests gathered inputs: it renders a completed gather as
+// an in-toto Statement, whose subject is the digest of the gathered tree and
+// whose predicate records where the tree came from and how it was verified,
+// and wraps statements in DSSE envelopes signed by the caller, for SLSA
+// pipelines to consume.
+package intoto
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	gogather "github.com/enterprise-contract/go-gather"
+	"github.com/enterprise-contract/go-gather/expand"
+	"github.com/enterprise-contract/go-gather/metadata"
+)
+
+const (
+	// StatementType is the type of the statements produced.
+	StatementType = "https://in-toto.io/Statement/v1"
+	// PredicateType is the type of the Predicate recording a gather.
+	PredicateType = "https://github.com/enterprise-contract/go-gather/gather/v1"
+	// PayloadType is the DSSE payload type of signed statements.
+	PayloadType = "application/vnd.in-toto+json"
+)
+
+// Statement is an in-toto Statement about a gathered tree.
+type Statement struct {
+	Type          string    `json:"_type"`
+	Subject       []Subject `json:"subject"`
+	PredicateType string    `json:"predicateType"`
+	Predicate     Predicate `json:"predicate"`
+}
+
+// Subject is an artifact the statement is about, identified by its digests
+// keyed by algorithm, e.g. {"sha256": "<hex>"}.
+type Subject struct {
+	Name   string            `json:"name"`
+	Digest map[string]string `json:"digest"`
+}
+
+// Predicate records how a tree was gathered.
+type Predicate struct {
+	// Source is the URI the tree was gathered from.
+	Source string `json:"source"`
+	// ResolvedRef is the source pinned by the gatherer to what it resolved
+	// to, e.g. the commit of a branch or the digest of a tag, see
+	// metadata.Metadata.GetPinnedURL.
+	ResolvedRef string `json:"resolvedRef,omitempty"`
+	// GatheredAt is when the statement was made, in RFC 3339 format.
+	GatheredAt string `json:"gatheredAt"`
+	// Verification lists the security checks that passed or rejected
+	// content during the gather.
+	Verification []metadata.SecurityCheck `json:"verification,omitempty"`
+}
+
+// Options configure a statement.
+type Options struct {
+	// Name is the name of the subject, the base name of the destination by
+	// default.
+	Name string
+	// Checks are security checks recorded outside the metadata, e.g. to a
+	// metadata.SecurityTrace passed to the gather, reported besides those
+	// of a metadata.SecurityChecker.
+	Checks []metadata.SecurityCheck
+}
+
+// New returns a statement about the tree gathered from source to dst, with
+// the metadata m the gather returned.
+func New(ctx context.Context, source, dst string, m metadata.Metadata, opts Options) (*Statement, error) {
+	manifest, err := expand.ScanDir(ctx, dst)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", dst, err)
+	}
+	algorithm, digest, _ := strings.Cut(gogather.TreeDigest(manifest.Entries), ":")
+
+	name := opts.Name
+	if name == "" {
+		name = filepath.Base(filepath.Clean(dst))
+	}
+
+	p := Predicate{
+		Source:     source,
+		GatheredAt: time.Now().Format(time.RFC3339),
+	}
+	if m != nil {
+		if pinned, err := m.GetPinnedURL(source); err == nil && pinned != source {
+			p.ResolvedRef = pinned
+		}
+	}
+	checks := opts.Checks
+	if c, ok := m.(metadata.SecurityChecker); ok {
+		checks = append(c.GetSecurityChecks(), checks...)
+	}
+	for _, c := range checks {
+		// Limits merely in force attest nothing about the content
+		if c.Outcome != metadata.CheckApplied {
+			p.Verification = append(p.Verification, c)
+		}
+	}
+
+	return &Statement{
+		Type:          StatementType,
+		Subject:       []Subject{{Name: name, Digest: map[string]string{algorithm: digest}}},
+		PredicateType: PredicateType,
+		Predicate:     p,
+	}, nil
+}
+
+// Write writes the statement to w as indented JSON.
+func (s *Statement) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(s)
+}
+
+// Envelope is a DSSE envelope carrying a signed statement.
+type Envelope struct {
+	PayloadType string      `json:"payloadType"`
+	Payload     []byte      `json:"payload"`
+	Signatures  []Signature `json:"signatures"`
+}
+
+// Signature is a signature of an envelope's payload.
+type Signature struct {
+	KeyID string `json:"keyid,omitempty"`
+	Sig   []byte `json:"sig"`
+}
+
+// SignFunc signs the DSSE pre-authentication encoding of a payload, e.g.
+// with a crypto.Signer or a KMS key, and returns the signature.
+type SignFunc func(pae []byte) ([]byte, error)
+
+// Sign returns an envelope carrying s signed by sign under keyID.
+func (s *Statement) Sign(keyID string, sign SignFunc) (*Envelope, error) {
+	if sign == nil {
+		return nil, errors.New("no signing function provided")
+	}
+	payload, err := json.Marshal(s)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode statement: %w", err)
+	}
+	sig, err := sign(PAE(PayloadType, payload))
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign statement: %w", err)
+	}
+	return &Envelope{
+		PayloadType: PayloadType,
+		Payload:     payload,
+		Signatures:  []Signature{{KeyID: keyID, Sig: sig}},
+	}, nil
+}
+
+// Statement decodes the statement an envelope carries. It does not verify
+// the signatures.
+func (e *Envelope) Statement() (*Statement, error) {
+	if e.PayloadType != PayloadType {
+		return nil, fmt.Errorf("unexpected payload type %q", e.PayloadType)
+	}
+	var s Statement
+	if err := json.Unmarshal(e.Payload, &s); err != nil {
+		return nil, fmt.Errorf("failed to decode statement: %w", err)
+	}
+	return &s, nil
+}
+
+// PAE returns the DSSE pre-authentication encoding of payload, the bytes
+// that are signed and verified.
+func PAE(payloadType string, payload []byte) []byte {
+	return []byte(fmt.Sprintf("DSSEv1 %d %s %d %s", len(payloadType), payloadType, len(payload), payload))
+}
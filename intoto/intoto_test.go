@@ -0,0 +1,144 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package intoto
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	gogather "github.com/enterprise-contract/go-gather"
+	"github.com/enterprise-contract/go-gather/expand"
+	"github.com/enterprise-contract/go-gather/metadata"
+)
+
+type gatherMetadata struct {
+	checks []metadata.SecurityCheck
+}
+
+func (m gatherMetadata) Get() interface{} { return m }
+
+func (m gatherMetadata) GetPinnedURL(u string) (string, error) {
+	return "git::" + strings.TrimPrefix(u, "git::") + "?ref=0123abcd", nil
+}
+
+func (m gatherMetadata) GetSecurityChecks() []metadata.SecurityCheck { return m.checks }
+
+func gatheredTree(t *testing.T) string {
+	t.Helper()
+	dst := filepath.Join(t.TempDir(), "policy")
+	require.NoError(t, os.MkdirAll(filepath.Join(dst, "lib"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dst, "main.rego"), []byte("package main"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dst, "lib", "util.rego"), []byte("package lib"), 0644))
+	return dst
+}
+
+func TestNew(t *testing.T) {
+	ctx := context.Background()
+	dst := gatheredTree(t)
+	m := gatherMetadata{checks: []metadata.SecurityCheck{
+		{Check: "path-sanitization", Subject: "policy", Outcome: metadata.CheckPassed},
+		{Check: "size-limit", Subject: "policy", Outcome: metadata.CheckApplied},
+	}}
+	signature := metadata.SecurityCheck{Check: "signature", Subject: "0123abcd", Outcome: metadata.CheckPassed}
+
+	s, err := New(ctx, "git::https://example.com/policy.git", dst, m, Options{Checks: []metadata.SecurityCheck{signature}})
+	require.NoError(t, err)
+
+	manifest, err := expand.ScanDir(ctx, dst)
+	require.NoError(t, err)
+	assert.Equal(t, StatementType, s.Type)
+	assert.Equal(t, PredicateType, s.PredicateType)
+	require.Len(t, s.Subject, 1)
+	assert.Equal(t, "policy", s.Subject[0].Name)
+	assert.Equal(t, gogather.TreeDigest(manifest.Entries), "sha256:"+s.Subject[0].Digest["sha256"])
+	assert.Equal(t, "git::https://example.com/policy.git", s.Predicate.Source)
+	assert.Equal(t, "git::https://example.com/policy.git?ref=0123abcd", s.Predicate.ResolvedRef)
+	assert.NotEmpty(t, s.Predicate.GatheredAt)
+	assert.Equal(t, []metadata.SecurityCheck{m.checks[0], signature}, s.Predicate.Verification)
+
+	var buf bytes.Buffer
+	require.NoError(t, s.Write(&buf))
+	var decoded map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	assert.Equal(t, StatementType, decoded["_type"])
+}
+
+func TestNew_Options(t *testing.T) {
+	s, err := New(context.Background(), "https://example.com/policy.zip", gatheredTree(t), nil, Options{Name: "policies"})
+	require.NoError(t, err)
+	assert.Equal(t, "policies", s.Subject[0].Name)
+	assert.Empty(t, s.Predicate.ResolvedRef)
+	assert.Empty(t, s.Predicate.Verification)
+}
+
+func TestNew_MissingDestination(t *testing.T) {
+	_, err := New(context.Background(), "https://example.com/policy.zip", filepath.Join(t.TempDir(), "missing"), nil, Options{})
+	assert.Error(t, err)
+}
+
+func TestStatement_Sign(t *testing.T) {
+	s, err := New(context.Background(), "git::https://example.com/policy.git", gatheredTree(t), gatherMetadata{}, Options{})
+	require.NoError(t, err)
+
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	env, err := s.Sign("test-key", func(pae []byte) ([]byte, error) {
+		return ed25519.Sign(private, pae), nil
+	})
+	require.NoError(t, err)
+
+	// The envelope survives a round trip and verifies against the key
+	data, err := json.Marshal(env)
+	require.NoError(t, err)
+	var decoded Envelope
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, PayloadType, decoded.PayloadType)
+	require.Len(t, decoded.Signatures, 1)
+	assert.Equal(t, "test-key", decoded.Signatures[0].KeyID)
+	assert.True(t, ed25519.Verify(public, PAE(decoded.PayloadType, decoded.Payload), decoded.Signatures[0].Sig))
+
+	got, err := decoded.Statement()
+	require.NoError(t, err)
+	assert.Equal(t, s.Subject, got.Subject)
+	assert.Equal(t, s.Predicate, got.Predicate)
+}
+
+func TestStatement_SignError(t *testing.T) {
+	s := &Statement{Type: StatementType}
+	_, err := s.Sign("", nil)
+	assert.Error(t, err)
+
+	boom := errors.New("boom")
+	_, err = s.Sign("", func([]byte) ([]byte, error) { return nil, boom })
+	assert.ErrorIs(t, err, boom)
+}
+
+func TestPAE(t *testing.T) {
+	// The example of the DSSE specification
+	assert.Equal(t, "DSSEv1 29 http://example.com/HelloWorld 11 hello world", string(PAE("http://example.com/HelloWorld", []byte("hello world"))))
+}
@@ -0,0 +1,268 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package layout assembles the data/ and policy/ directories policy engines
+// such as OPA expect from trees gathered from several sources. The files are
+// linked into place rather than copied, and a manifest maps each of them
+// back to its source and digest, so the layout can be checked against what
+// was gathered before it is evaluated.
+package layout
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+
+	"github.com/enterprise-contract/go-gather/expand"
+	"github.com/enterprise-contract/go-gather/internal/helpers"
+	"github.com/enterprise-contract/go-gather/internal/multierr"
+)
+
+// Kind is the top-level directory of a layout the files of a source are
+// linked into.
+type Kind string
+
+const (
+	// Data holds JSON and YAML documents loaded as data.
+	Data Kind = "data"
+	// Policy holds the policy modules, e.g. Rego files.
+	Policy Kind = "policy"
+)
+
+// ManifestFile is the name of the manifest written at the root of a layout.
+const ManifestFile = ".layout.json"
+
+// Source is a tree gathered from a single source, to be linked into a
+// layout.
+type Source struct {
+	// URI is the source the tree was gathered from.
+	URI string `json:"uri"`
+	// Digest is the digest or commit the source resolved to, if known.
+	Digest string `json:"digest,omitempty"`
+	// Path is the directory the tree was gathered into.
+	Path string `json:"path"`
+	// Kind selects the directory of the layout the tree is linked into.
+	Kind Kind `json:"kind"`
+	// Prefix is the slash-separated directory below Kind the tree is
+	// linked at. It defaults to a name derived from URI, which keeps the
+	// trees of different sources apart.
+	Prefix string `json:"prefix"`
+}
+
+// Entry is a file linked into a layout.
+type Entry struct {
+	// Path is the slash-separated path of the link relative to the root of
+	// the layout, e.g. "policy/3f9a…/main.rego".
+	Path string `json:"path"`
+	// Target is the file the link points to.
+	Target string `json:"target"`
+	// Source and SourceDigest are the URI and Digest of the source the
+	// file was gathered from.
+	Source       string `json:"source"`
+	SourceDigest string `json:"sourceDigest,omitempty"`
+	Size         int64  `json:"size"`
+	// SHA256 is the hex encoded digest of the file when it was linked.
+	SHA256 string `json:"sha256"`
+}
+
+// Manifest describes a layout.
+type Manifest struct {
+	Sources []Source `json:"sources"`
+	Entries []Entry  `json:"entries"`
+}
+
+// DefaultPrefix returns the directory the tree of the source uri is linked
+// at when its Prefix is empty.
+func DefaultPrefix(uri string) string {
+	sum := sha256.Sum256([]byte(uri))
+	return hex.EncodeToString(sum[:6])
+}
+
+// Build links the regular files of every source into root, below the
+// directory of its kind and its prefix, and writes the manifest of the
+// layout to ManifestFile in root. Links are relative, so root and the
+// gathered trees can be moved together. Files that would be linked at the
+// same path, and files already present in root, are errors.
+func Build(ctx context.Context, root string, sources []Source) (*Manifest, error) {
+	root, err := helpers.ExpandPath(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to expand layout path: %w", err)
+	}
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create layout: %w", err)
+	}
+
+	m := &Manifest{}
+	linked := map[string]string{}
+	for _, s := range sources {
+		if s.Kind != Data && s.Kind != Policy {
+			return nil, fmt.Errorf("source %s: unknown kind %q", s.URI, s.Kind)
+		}
+		if s.Prefix == "" {
+			s.Prefix = DefaultPrefix(s.URI)
+		}
+		if !filepath.IsLocal(filepath.FromSlash(s.Prefix)) {
+			return nil, fmt.Errorf("source %s: prefix %q is not a relative path within the layout", s.URI, s.Prefix)
+		}
+		if s.Path, err = helpers.ExpandPath(s.Path); err != nil {
+			return nil, fmt.Errorf("source %s: failed to expand path: %w", s.URI, err)
+		}
+		if s.Path, err = filepath.Abs(s.Path); err != nil {
+			return nil, fmt.Errorf("source %s: %w", s.URI, err)
+		}
+		m.Sources = append(m.Sources, s)
+
+		err := filepath.WalkDir(s.Path, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			// Links in the tree are left out, they could point anywhere
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			rel, err := filepath.Rel(s.Path, p)
+			if err != nil {
+				return err
+			}
+			e := Entry{
+				Path:         path.Join(string(s.Kind), s.Prefix, filepath.ToSlash(rel)),
+				Target:       p,
+				Source:       s.URI,
+				SourceDigest: s.Digest,
+			}
+			if other, ok := linked[e.Path]; ok {
+				return fmt.Errorf("%s is provided by both %s and %s", e.Path, other, s.URI)
+			}
+			linked[e.Path] = s.URI
+			if e.Size, e.SHA256, err = hashFile(ctx, p); err != nil {
+				return err
+			}
+			if err := link(root, e); err != nil {
+				return err
+			}
+			m.Entries = append(m.Entries, e)
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("source %s: %w", s.URI, err)
+		}
+	}
+	sort.Slice(m.Entries, func(i, j int) bool { return m.Entries[i].Path < m.Entries[j].Path })
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode layout manifest: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(root, ManifestFile), append(data, '\n'), 0644); err != nil {
+		return nil, fmt.Errorf("failed to write layout manifest: %w", err)
+	}
+	return m, nil
+}
+
+// link creates the link for e below root.
+func link(root string, e Entry) error {
+	p := filepath.Join(root, filepath.FromSlash(e.Path))
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+	target, err := filepath.Rel(filepath.Dir(p), e.Target)
+	if err != nil {
+		target = e.Target
+	}
+	if err := os.Symlink(target, p); err != nil {
+		return fmt.Errorf("failed to link %s: %w", e.Path, err)
+	}
+	return nil
+}
+
+// ReadManifest reads the manifest of the layout at root.
+func ReadManifest(root string) (*Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(root, ManifestFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read layout manifest: %w", err)
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("failed to decode layout manifest: %w", err)
+	}
+	return &m, nil
+}
+
+// Verify checks every file of the layout at root against its manifest: the
+// link has to point to the file it was created for, and the file must be
+// unchanged. Each file that fails is reported as an expand.IntegrityError,
+// collected in a gogather.Errors, so the error matches expand.ErrIntegrity.
+func Verify(ctx context.Context, root string) error {
+	m, err := ReadManifest(root)
+	if err != nil {
+		return err
+	}
+	var errs multierr.Errors
+	for _, e := range m.Entries {
+		p := filepath.Join(root, filepath.FromSlash(e.Path))
+		target, err := os.Readlink(p)
+		if err != nil {
+			errs = append(errs, &expand.IntegrityError{Entry: e.Path, Check: "link", Expected: e.Target, Actual: err.Error(), Err: err})
+			continue
+		}
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(p), target)
+		}
+		if filepath.Clean(target) != filepath.Clean(e.Target) {
+			errs = append(errs, &expand.IntegrityError{Entry: e.Path, Check: "link", Expected: e.Target, Actual: target})
+			continue
+		}
+		_, sum, err := hashFile(ctx, p)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			errs = append(errs, &expand.IntegrityError{Entry: e.Path, Check: "sha256", Expected: e.SHA256, Actual: err.Error(), Err: err})
+			continue
+		}
+		if sum != e.SHA256 {
+			errs = append(errs, &expand.IntegrityError{Entry: e.Path, Check: "sha256", Expected: e.SHA256, Actual: sum})
+		}
+	}
+	return errs.Err()
+}
+
+// hashFile returns the size and the hex encoded SHA-256 digest of the file
+// at p.
+func hashFile(ctx context.Context, p string) (int64, string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, helpers.NewContextReader(ctx, f))
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to read %s: %w", p, err)
+	}
+	return n, hex.EncodeToString(h.Sum(nil)), nil
+}
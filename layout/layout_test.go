@@ -0,0 +1,143 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package layout
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/enterprise-contract/go-gather/expand"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBuild(t *testing.T) {
+	ctx := context.Background()
+	gathered := t.TempDir()
+	policy := filepath.Join(gathered, "policy")
+	data := filepath.Join(gathered, "data")
+	writeFile(t, filepath.Join(policy, "main.rego"), "package main")
+	writeFile(t, filepath.Join(policy, "lib", "util.rego"), "package lib")
+	writeFile(t, filepath.Join(data, "config.json"), "{}")
+	if err := os.Symlink("/etc/passwd", filepath.Join(policy, "escape")); err != nil {
+		t.Fatal(err)
+	}
+
+	root := filepath.Join(t.TempDir(), "layout")
+	m, err := Build(ctx, root, []Source{
+		{URI: "oci::quay.io/org/policy:latest", Digest: "sha256:abc", Path: policy, Kind: Policy, Prefix: "release"},
+		{URI: "git::https://example.com/data.git", Path: data, Kind: Data},
+	})
+	if err != nil {
+		t.Fatalf("Build returned an error: %v", err)
+	}
+
+	prefix := DefaultPrefix("git::https://example.com/data.git")
+	var paths []string
+	for _, e := range m.Entries {
+		paths = append(paths, e.Path)
+	}
+	want := []string{"data/" + prefix + "/config.json", "policy/release/lib/util.rego", "policy/release/main.rego"}
+	if !reflect.DeepEqual(paths, want) {
+		t.Errorf("entries = %v, want %v", paths, want)
+	}
+	e := m.Entries[2]
+	if e.Source != "oci::quay.io/org/policy:latest" || e.SourceDigest != "sha256:abc" || e.Size != 12 || e.Target != filepath.Join(policy, "main.rego") {
+		t.Errorf("unexpected entry: %+v", e)
+	}
+
+	b, err := os.ReadFile(filepath.Join(root, "policy", "release", "main.rego"))
+	if err != nil || string(b) != "package main" {
+		t.Errorf("expected the link to resolve to the policy, got %q, %v", b, err)
+	}
+	if target, err := os.Readlink(filepath.Join(root, "policy", "release", "main.rego")); err != nil || filepath.IsAbs(target) {
+		t.Errorf("expected a relative link, got %q, %v", target, err)
+	}
+
+	read, err := ReadManifest(root)
+	if err != nil {
+		t.Fatalf("ReadManifest returned an error: %v", err)
+	}
+	if !reflect.DeepEqual(read, m) {
+		t.Errorf("ReadManifest() = %+v, want %+v", read, m)
+	}
+	if err := Verify(ctx, root); err != nil {
+		t.Errorf("Verify returned an error: %v", err)
+	}
+
+	// A changed file and a link pointing elsewhere are both reported
+	writeFile(t, filepath.Join(policy, "main.rego"), "package changed")
+	util := filepath.Join(root, "policy", "release", "lib", "util.rego")
+	if err := os.Remove(util); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(data, "config.json"), util); err != nil {
+		t.Fatal(err)
+	}
+	err = Verify(ctx, root)
+	if !errors.Is(err, expand.ErrIntegrity) {
+		t.Fatalf("expected an integrity error, got %v", err)
+	}
+	if !strings.HasPrefix(err.Error(), "2 errors occurred: ") {
+		t.Errorf("expected both failures to be counted, got %v", err)
+	}
+	for _, s := range []string{`sha256 mismatch for entry "policy/release/main.rego"`, `link mismatch for entry "policy/release/lib/util.rego"`} {
+		if !strings.Contains(err.Error(), s) {
+			t.Errorf("expected %q in %v", s, err)
+		}
+	}
+}
+
+func TestBuild_Errors(t *testing.T) {
+	src := t.TempDir()
+	writeFile(t, filepath.Join(src, "main.rego"), "package main")
+
+	tests := []struct {
+		name    string
+		sources []Source
+		want    string
+	}{
+		{"unknown kind", []Source{{URI: "a", Path: src, Kind: "bundle"}}, "unknown kind"},
+		{"prefix outside", []Source{{URI: "a", Path: src, Kind: Policy, Prefix: "../escape"}}, "not a relative path"},
+		{"conflict", []Source{
+			{URI: "a", Path: src, Kind: Policy, Prefix: "p"},
+			{URI: "b", Path: src, Kind: Policy, Prefix: "p"},
+		}, "provided by both a and b"},
+		{"missing source", []Source{{URI: "a", Path: filepath.Join(src, "missing"), Kind: Data}}, "no such file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Build(context.Background(), t.TempDir(), tt.sources)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected an error containing %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
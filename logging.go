@@ -0,0 +1,31 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package gogather
+
+import (
+	"log/slog"
+
+	"github.com/enterprise-contract/go-gather/internal/logging"
+)
+
+// SetLogger has the gatherers and expanders log structured debug events to
+// l, such as the gatherer picked for each source, the requests retried and
+// the bytes transferred. The events are discarded when l is nil, the
+// default, so the library writes nothing to the output of its consumers.
+func SetLogger(l *slog.Logger) {
+	logging.Set(l)
+}
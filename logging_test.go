@@ -0,0 +1,48 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package gogather
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/enterprise-contract/go-gather/gather"
+)
+
+func TestSetLogger(t *testing.T) {
+	var out bytes.Buffer
+	SetLogger(slog.New(slog.NewTextHandler(&out, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	t.Cleanup(func() { SetLogger(nil) })
+
+	r := gather.NewRegistry()
+	r.RegisterGatherer(fakeGatherer{})
+	_, err := Gather(context.Background(), "fake://policy", filepath.Join(t.TempDir(), "dst"), WithRegistry(r))
+	require.NoError(t, err)
+	assert.Contains(t, out.String(), `msg="classified source" source=fake://policy gatherer=gogather.fakeGatherer alias=false`)
+
+	out.Reset()
+	SetLogger(nil)
+	_, err = Gather(context.Background(), "fake://policy", filepath.Join(t.TempDir(), "dst"), WithRegistry(r))
+	require.NoError(t, err)
+	assert.Empty(t, out.String())
+}
@@ -0,0 +1,45 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package metadata
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// Relocator is implemented by metadata recording the path a source was
+// gathered into, for the path to follow what was gathered when it is
+// moved, as gogather.Gather does with what it gathers into a staging
+// directory.
+type Relocator interface {
+	// Relocate has the paths within from that the metadata records
+	// point within to instead.
+	Relocate(from, to string)
+}
+
+// RelocatePath returns path moved from within from to within to, or path
+// as it is if it is not within from.
+func RelocatePath(path, from, to string) string {
+	if path == "" {
+		return path
+	}
+	rel, err := filepath.Rel(filepath.Clean(from), filepath.Clean(path))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return path
+	}
+	return filepath.Join(to, rel)
+}
@@ -0,0 +1,37 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package metadata
+
+import "testing"
+
+func TestRelocatePath(t *testing.T) {
+	tests := []struct {
+		path, from, to, want string
+	}{
+		{"/tmp/.gather-1/policy", "/tmp/.gather-1/policy", "/tmp/policy", "/tmp/policy"},
+		{"/tmp/.gather-1/policy/", "/tmp/.gather-1/policy", "/tmp/policy", "/tmp/policy"},
+		{"/tmp/.gather-1/policy/main.rego", "/tmp/.gather-1/policy", "/tmp/policy", "/tmp/policy/main.rego"},
+		{"/tmp/.gather-1/policy", "/tmp/.gather-1", "/tmp/policy", "/tmp/policy/policy"},
+		{"/tmp/other", "/tmp/.gather-1/policy", "/tmp/policy", "/tmp/other"},
+		{"", "/tmp/.gather-1/policy", "/tmp/policy", ""},
+	}
+	for _, tt := range tests {
+		if got := RelocatePath(tt.path, tt.from, tt.to); got != tt.want {
+			t.Errorf("RelocatePath(%q, %q, %q) = %q, want %q", tt.path, tt.from, tt.to, got, tt.want)
+		}
+	}
+}
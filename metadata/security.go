@@ -0,0 +1,105 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package metadata
+
+import (
+	"context"
+	"sync"
+)
+
+// Outcomes of a security check.
+const (
+	// CheckPassed means the content was inspected and found acceptable.
+	CheckPassed = "passed"
+	// CheckRejected means the check stopped the content from being used.
+	CheckRejected = "rejected"
+	// CheckApplied means a limit or policy was in force for the gather.
+	CheckApplied = "applied"
+)
+
+// SecurityCheck records a protection that was exercised while handling
+// untrusted content, such as a path being sanitized, a size limit being
+// enforced or a digest being verified.
+type SecurityCheck struct {
+	// Check names the protection, for example "path-sanitization",
+	// "size-limit", "file-count-limit", "crc32", "block-digest",
+	// "checksum" or "signature".
+	Check string `json:"check"`
+	// Subject is what the check was applied to: an archive, a file or an
+	// entry path.
+	Subject string `json:"subject,omitempty"`
+	// Outcome is one of CheckPassed, CheckRejected or CheckApplied.
+	Outcome string `json:"outcome"`
+	Detail  string `json:"detail,omitempty"`
+}
+
+// SecurityChecker is implemented by metadata that carries a trace of the
+// security checks performed during a gather.
+type SecurityChecker interface {
+	GetSecurityChecks() []SecurityCheck
+}
+
+// SecurityTrace collects security checks. It is safe for concurrent use, and
+// a nil *SecurityTrace discards everything recorded to it.
+type SecurityTrace struct {
+	mu     sync.Mutex
+	checks []SecurityCheck
+}
+
+// Record appends c to the trace.
+func (t *SecurityTrace) Record(c SecurityCheck) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.checks = append(t.checks, c)
+}
+
+// Checks returns a copy of the checks recorded so far.
+func (t *SecurityTrace) Checks() []SecurityCheck {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]SecurityCheck(nil), t.checks...)
+}
+
+type securityTraceKey struct{}
+
+// WithSecurityTrace returns a context carrying a trace that gatherers and
+// expanders record their checks to, along with the trace. If ctx already
+// carries one it is reused, so nested operations add to the same trace.
+func WithSecurityTrace(ctx context.Context) (context.Context, *SecurityTrace) {
+	if t := SecurityTraceFromContext(ctx); t != nil {
+		return ctx, t
+	}
+	t := &SecurityTrace{}
+	return context.WithValue(ctx, securityTraceKey{}, t), t
+}
+
+// SecurityTraceFromContext returns the trace carried by ctx, or nil.
+func SecurityTraceFromContext(ctx context.Context) *SecurityTrace {
+	t, _ := ctx.Value(securityTraceKey{}).(*SecurityTrace)
+	return t
+}
+
+// RecordCheck records c to the trace carried by ctx, if any.
+func RecordCheck(ctx context.Context, c SecurityCheck) {
+	SecurityTraceFromContext(ctx).Record(c)
+}
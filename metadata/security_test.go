@@ -0,0 +1,76 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package metadata
+
+import (
+	"context"
+	"sync"
+	"testing"
+)
+
+func TestRecordCheck_WithoutTrace(t *testing.T) {
+	// Recording without a trace in the context is a no-op
+	RecordCheck(context.Background(), SecurityCheck{Check: "size-limit", Outcome: CheckApplied})
+
+	var trace *SecurityTrace
+	trace.Record(SecurityCheck{Check: "size-limit", Outcome: CheckApplied})
+	if checks := trace.Checks(); checks != nil {
+		t.Errorf("expected no checks from a nil trace, got %v", checks)
+	}
+}
+
+func TestWithSecurityTrace(t *testing.T) {
+	ctx, trace := WithSecurityTrace(context.Background())
+	RecordCheck(ctx, SecurityCheck{Check: "crc32", Subject: "a.tar.gz", Outcome: CheckPassed})
+
+	// A nested operation adds to the same trace
+	nested, nestedTrace := WithSecurityTrace(ctx)
+	if nestedTrace != trace {
+		t.Fatal("expected the existing trace to be reused")
+	}
+	RecordCheck(nested, SecurityCheck{Check: "path-sanitization", Subject: "../x", Outcome: CheckRejected})
+
+	checks := trace.Checks()
+	if len(checks) != 2 {
+		t.Fatalf("expected 2 checks, got %d", len(checks))
+	}
+	if checks[0].Check != "crc32" || checks[1].Outcome != CheckRejected {
+		t.Errorf("unexpected checks: %+v", checks)
+	}
+
+	// The returned slice is a copy
+	checks[0].Check = "changed"
+	if trace.Checks()[0].Check != "crc32" {
+		t.Error("modifying the returned checks changed the trace")
+	}
+}
+
+func TestSecurityTrace_Concurrent(t *testing.T) {
+	ctx, trace := WithSecurityTrace(context.Background())
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			RecordCheck(ctx, SecurityCheck{Check: "block-digest", Outcome: CheckPassed})
+		}()
+	}
+	wg.Wait()
+	if n := len(trace.Checks()); n != 50 {
+		t.Errorf("expected 50 checks, got %d", n)
+	}
+}
@@ -0,0 +1,134 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package metadata
+
+import (
+	"context"
+	"io/fs"
+	"path/filepath"
+	"sort"
+)
+
+// LargestFiles is the number of files a SizeReport lists by default.
+const LargestFiles = 10
+
+// SizeBounds are the upper bounds, inclusive, of the buckets of a size
+// histogram. Files larger than the last bound are counted in a final bucket
+// without a bound.
+var SizeBounds = []int64{1 << 10, 10 << 10, 100 << 10, 1 << 20, 10 << 20, 100 << 20}
+
+// SizeReport summarizes the sizes of the files gathered, so that bloat in a
+// policy bundle stands out.
+type SizeReport struct {
+	Files int   `json:"files"`
+	Bytes int64 `json:"bytes"`
+	// Largest lists the largest files, largest first.
+	Largest []FileSize `json:"largest"`
+	// Histogram counts the files in each of the buckets of SizeBounds.
+	Histogram []SizeBucket `json:"histogram"`
+
+	n int
+}
+
+// FileSize is the size of a single file.
+type FileSize struct {
+	// Path is the slash-separated path of the file relative to the
+	// destination.
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+// SizeBucket counts the files up to a size.
+type SizeBucket struct {
+	// Max is the largest size counted, 0 for the final bucket, which counts
+	// every file larger than the bucket before it.
+	Max   int64 `json:"max"`
+	Files int   `json:"files"`
+	Bytes int64 `json:"bytes"`
+}
+
+// SizeReporter is implemented by metadata that reports the sizes of the
+// files gathered.
+type SizeReporter interface {
+	GetSizeReport() *SizeReport
+}
+
+// NewSizeReport returns an empty report listing up to n of the largest
+// files.
+func NewSizeReport(n int) *SizeReport {
+	r := &SizeReport{n: n, Histogram: make([]SizeBucket, len(SizeBounds)+1)}
+	for i, bound := range SizeBounds {
+		r.Histogram[i].Max = bound
+	}
+	return r
+}
+
+// Add counts a file of the given size at the slash-separated path.
+func (r *SizeReport) Add(path string, size int64) {
+	r.Files++
+	r.Bytes += size
+	i := sort.Search(len(SizeBounds), func(i int) bool { return size <= SizeBounds[i] })
+	r.Histogram[i].Files++
+	r.Histogram[i].Bytes += size
+
+	// Largest is kept sorted, so only files larger than the smallest listed
+	// need inserting
+	if r.n <= 0 || (len(r.Largest) == r.n && size <= r.Largest[r.n-1].Size) {
+		return
+	}
+	j := sort.Search(len(r.Largest), func(j int) bool { return r.Largest[j].Size < size })
+	if len(r.Largest) < r.n {
+		r.Largest = append(r.Largest, FileSize{})
+	}
+	copy(r.Largest[j+1:], r.Largest[j:])
+	r.Largest[j] = FileSize{Path: path, Size: size}
+}
+
+// ScanSizes reports the sizes of the regular files at root, which is either
+// a directory or a single file, listing up to n of the largest. The .git
+// directories of clones hold history rather than content and are left out.
+func ScanSizes(ctx context.Context, root string, n int) (*SizeReport, error) {
+	r := NewSizeReport(n)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if d.IsDir() && d.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil || rel == "." {
+			rel = filepath.Base(path)
+		}
+		r.Add(filepath.ToSlash(rel), info.Size())
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
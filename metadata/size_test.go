@@ -0,0 +1,87 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package metadata
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSizeReport_Add(t *testing.T) {
+	r := NewSizeReport(3)
+	for _, f := range []FileSize{
+		{"a", 10}, {"b", 5 << 20}, {"c", 2 << 10}, {"d", 1 << 30}, {"e", 1 << 10}, {"f", 3 << 20},
+	} {
+		r.Add(f.Path, f.Size)
+	}
+
+	if r.Files != 6 || r.Bytes != 10+5<<20+2<<10+1<<30+1<<10+3<<20 {
+		t.Errorf("unexpected totals: %d files, %d bytes", r.Files, r.Bytes)
+	}
+	if want := []FileSize{{"d", 1 << 30}, {"b", 5 << 20}, {"f", 3 << 20}}; !reflect.DeepEqual(r.Largest, want) {
+		t.Errorf("Largest = %v, want %v", r.Largest, want)
+	}
+	counts := make([]int, len(r.Histogram))
+	for i, b := range r.Histogram {
+		counts[i] = b.Files
+	}
+	// 1 KiB is counted in the first bucket, as bounds are inclusive
+	if want := []int{2, 1, 0, 0, 2, 0, 1}; !reflect.DeepEqual(counts, want) {
+		t.Errorf("histogram counts = %v, want %v", counts, want)
+	}
+	if last := r.Histogram[len(r.Histogram)-1]; last.Max != 0 || last.Bytes != 1<<30 {
+		t.Errorf("unexpected final bucket: %+v", last)
+	}
+}
+
+func TestScanSizes(t *testing.T) {
+	root := t.TempDir()
+	for name, size := range map[string]int{"policy/main.rego": 100, "data/big.json": 4096, ".git/objects/pack": 1 << 20} {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, make([]byte, size), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r, err := ScanSizes(context.Background(), root, LargestFiles)
+	if err != nil {
+		t.Fatalf("ScanSizes returned an error: %v", err)
+	}
+	if want := []FileSize{{"data/big.json", 4096}, {"policy/main.rego", 100}}; !reflect.DeepEqual(r.Largest, want) || r.Files != 2 {
+		t.Errorf("expected the files outside .git, got %+v", r)
+	}
+
+	r, err = ScanSizes(context.Background(), filepath.Join(root, "policy", "main.rego"), LargestFiles)
+	if err != nil {
+		t.Fatalf("ScanSizes returned an error: %v", err)
+	}
+	if want := []FileSize{{"main.rego", 100}}; !reflect.DeepEqual(r.Largest, want) {
+		t.Errorf("Largest = %v, want %v", r.Largest, want)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := ScanSizes(ctx, root, LargestFiles); err == nil {
+		t.Error("expected an error for a cancelled context")
+	}
+}
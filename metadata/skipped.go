@@ -0,0 +1,54 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package metadata
+
+// Reasons an entry of the source was not written to the destination.
+const (
+	// SkipHidden means the entry is a hidden file, or inside a hidden
+	// directory, that the gather was configured to leave out.
+	SkipHidden = "hidden"
+	// SkipSandbox means the entry lies outside the paths a write sandbox
+	// allows.
+	SkipSandbox = "sandbox"
+	// SkipFailed means the entry could not be written and the gather went
+	// on without it, see ContinueOnError.
+	SkipFailed = "failed"
+	// SkipFiltered means the entry was not selected by a filter of the
+	// gather, e.g. the media types of the OCI layers to gather.
+	SkipFiltered = "filtered"
+	// SkipSymlink means the entry is a symbolic link the gather was
+	// configured to leave out.
+	SkipSymlink = "symlink"
+)
+
+// SkippedEntry is an entry of the source that was deliberately left out of
+// the destination, telling it apart from one that was never in the source.
+type SkippedEntry struct {
+	// Path is the slash-separated path of the entry, relative to the
+	// destination it would have been written to.
+	Path string `json:"path"`
+	// Reason is one of SkipHidden, SkipSandbox, SkipFailed, SkipFiltered or
+	// SkipSymlink.
+	Reason string `json:"reason"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// SkipReporter is implemented by metadata that lists the entries a gather
+// left out.
+type SkipReporter interface {
+	GetSkipped() []SkippedEntry
+}
@@ -0,0 +1,82 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package metadata
+
+// Summary is the part of the metadata every gatherer returns, so that the
+// provenance of a gather can be recorded the same way whatever its source.
+type Summary struct {
+	// Type is the type of the source, e.g. "git", "oci" or "http".
+	Type string `json:"type"`
+	// URI is the source gathered.
+	URI string `json:"uri"`
+	// Path is the destination.
+	Path string `json:"path"`
+	// Revision pins what was gathered, when the source has one: the commit
+	// of a Git repository, the digest of an OCI artifact, the checksum an
+	// HTTP download was verified against, the CID of an IPFS path, the
+	// revision of an SVN export or the ETag of an S3 object.
+	Revision string `json:"revision,omitempty"`
+	// Files and Bytes count the files gathered and their total size.
+	Files int   `json:"files"`
+	Bytes int64 `json:"bytes"`
+	// Timestamp is when the gather completed, in RFC 3339 format.
+	Timestamp string `json:"timestamp"`
+	// Details holds what is particular to the transport, such as the ref
+	// of a Git repository, the tag of an OCI artifact or the response code
+	// of an HTTP download.
+	Details map[string]string `json:"details,omitempty"`
+}
+
+// Summarizer is implemented by metadata that summarizes the gather.
+type Summarizer interface {
+	GetSummary() Summary
+}
+
+// NewSummary returns the summary of a gather of uri, a source of type typ,
+// into path that completed at timestamp, counting the files and bytes in
+// sizes, if not nil.
+func NewSummary(typ, uri, path, timestamp string, sizes *SizeReport) Summary {
+	s := Summary{Type: typ, URI: uri, Path: path, Timestamp: timestamp}
+	if sizes != nil {
+		s.Files, s.Bytes = sizes.Files, sizes.Bytes
+	}
+	return s
+}
+
+// Detail sets the detail key to value, unless value is empty.
+func (s *Summary) Detail(key, value string) {
+	if value == "" {
+		return
+	}
+	if s.Details == nil {
+		s.Details = map[string]string{}
+	}
+	s.Details[key] = value
+}
+
+// Summarize returns the summary of m, or of as much of the gather as m
+// reports when it is not a Summarizer.
+func Summarize(m Metadata) Summary {
+	if s, ok := m.(Summarizer); ok {
+		return s.GetSummary()
+	}
+	var s Summary
+	if r, ok := m.(SizeReporter); ok {
+		s = NewSummary("", "", "", "", r.GetSizeReport())
+	}
+	return s
+}
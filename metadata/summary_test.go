@@ -0,0 +1,61 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package metadata
+
+import (
+	"reflect"
+	"testing"
+)
+
+type sized struct{ sizes *SizeReport }
+
+func (s sized) Get() interface{}                      { return s }
+func (s sized) GetPinnedURL(u string) (string, error) { return u, nil }
+func (s sized) GetSizeReport() *SizeReport            { return s.sizes }
+func (s sized) GetSummary() Summary                   { return Summary{Type: "sized"} }
+
+type bare struct{ sizes *SizeReport }
+
+func (b bare) Get() interface{}                      { return b }
+func (b bare) GetPinnedURL(u string) (string, error) { return u, nil }
+func (b bare) GetSizeReport() *SizeReport            { return b.sizes }
+
+func TestSummary_Detail(t *testing.T) {
+	var s Summary
+	s.Detail("ref", "main")
+	s.Detail("tag", "")
+	if want := map[string]string{"ref": "main"}; !reflect.DeepEqual(s.Details, want) {
+		t.Errorf("Details = %v, want %v", s.Details, want)
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	r := NewSizeReport(0)
+	r.Add("a", 10)
+	r.Add("b", 5)
+
+	if s := Summarize(sized{r}); s.Type != "sized" {
+		t.Errorf("Summarize did not use GetSummary: %+v", s)
+	}
+	// Metadata that is no Summarizer is summarized from its size report
+	if s := Summarize(bare{r}); s.Files != 2 || s.Bytes != 15 {
+		t.Errorf("unexpected summary: %+v", s)
+	}
+	if s := Summarize(bare{}); !reflect.DeepEqual(s, Summary{}) {
+		t.Errorf("unexpected summary: %+v", s)
+	}
+}
@@ -0,0 +1,34 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package gogather
+
+import "time"
+
+// MetricsRecorder records the gathers made WithMetricsRecorder, for example
+// as Prometheus counters and histograms. Sources are told apart by scheme:
+// the forced gatherer of "git::…" sources, the scheme of URLs, and "file"
+// for paths. The methods may be called concurrently.
+type MetricsRecorder interface {
+	// Gathered records a gather that wrote bytes to the destination and
+	// took duration, failing with err when not nil.
+	Gathered(scheme string, bytes int64, duration time.Duration, err error)
+	// Retried records a request retried during a gather.
+	Retried(scheme string)
+	// CacheHit records a gather served from a cache, such as a git clone
+	// cache or a file not modified since it was last downloaded.
+	CacheHit(scheme string)
+}
@@ -0,0 +1,104 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package gogather
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/enterprise-contract/go-gather/gather"
+	ghttp "github.com/enterprise-contract/go-gather/gather/http"
+)
+
+type gathered struct {
+	scheme string
+	bytes  int64
+	err    error
+}
+
+type fakeMetrics struct {
+	mu        sync.Mutex
+	gathered  []gathered
+	retries   map[string]int
+	cacheHits map[string]int
+}
+
+func (m *fakeMetrics) Gathered(scheme string, bytes int64, _ time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.gathered = append(m.gathered, gathered{scheme, bytes, err})
+}
+
+func (m *fakeMetrics) Retried(scheme string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.retries == nil {
+		m.retries = map[string]int{}
+	}
+	m.retries[scheme]++
+}
+
+func (m *fakeMetrics) CacheHit(scheme string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.cacheHits == nil {
+		m.cacheHits = map[string]int{}
+	}
+	m.cacheHits[scheme]++
+}
+
+func TestGather_WithMetricsRecorder(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_, _ = w.Write([]byte("package policy"))
+	}))
+	defer server.Close()
+
+	r := gather.NewRegistry()
+	r.RegisterGatherer(&ghttp.HTTPGatherer{Retry: ghttp.RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond}})
+	m := &fakeMetrics{}
+	dst := filepath.Join(t.TempDir(), "policy.rego")
+	_, err := Gather(context.Background(), server.URL+"/policy.rego", dst, WithRegistry(r), WithMetricsRecorder(m))
+	require.NoError(t, err)
+
+	assert.Equal(t, []gathered{{"http", int64(len("package policy")), nil}}, m.gathered)
+	assert.Equal(t, map[string]int{"http": 1}, m.retries)
+	assert.Nil(t, m.cacheHits)
+}
+
+func TestGather_WithMetricsRecorder_Error(t *testing.T) {
+	m := &fakeMetrics{}
+	_, err := Gather(context.Background(), "fake://policy", t.TempDir(), WithRegistry(gather.NewRegistry()), WithMetricsRecorder(m))
+	require.Error(t, err)
+
+	require.Len(t, m.gathered, 1)
+	assert.Equal(t, "fake", m.gathered[0].scheme)
+	assert.ErrorIs(t, m.gathered[0].err, ErrUnsupportedScheme)
+}
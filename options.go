@@ -0,0 +1,316 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package gogather
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+	"oras.land/oras-go/v2/registry"
+
+	"github.com/enterprise-contract/go-gather/gather"
+	"github.com/enterprise-contract/go-gather/gather/file"
+	"github.com/enterprise-contract/go-gather/gather/git"
+	ghttp "github.com/enterprise-contract/go-gather/gather/http"
+	"github.com/enterprise-contract/go-gather/gather/ipfs"
+	"github.com/enterprise-contract/go-gather/gather/oci"
+	"github.com/enterprise-contract/go-gather/gather/s3"
+	"github.com/enterprise-contract/go-gather/gather/svn"
+	"github.com/enterprise-contract/go-gather/gather/webdav"
+)
+
+// Option configures Gather. Options apply to every gatherer that has a use
+// for them and are ignored by the others, as noted on each.
+type Option func(*options)
+
+// ErrUnsupportedOption is matched via errors.Is by the error of Gather when
+// an option was given that the gatherer of the source cannot apply.
+var ErrUnsupportedOption = errors.New("option not supported by the gatherer")
+
+// options are the settings of Gather.
+type options struct {
+	registry *gather.Registry
+	timeout  time.Duration
+	maxSize  int64
+	username string
+	password string
+	token    string
+	insecure bool
+	depth    int
+	tracer   trace.TracerProvider
+	metrics  MetricsRecorder
+	// digest is the expected digest of the destination, as "algorithm:hex"
+	digest   string
+	conflict ConflictPolicy
+}
+
+// WithRegistry has Gather pick the gatherer of the source from r rather
+// than from the default registry.
+func WithRegistry(r *gather.Registry) Option {
+	return func(o *options) {
+		o.registry = r
+	}
+}
+
+// WithTimeout fails the gather once it takes longer than d.
+func WithTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.timeout = d
+	}
+}
+
+// WithMaxSize fails the gather if what it gathered adds up to more than n
+// bytes, leaving the destination as it was. The file gatherer also stops
+// extracting archives once a file exceeds n bytes.
+func WithMaxSize(n int64) Option {
+	return func(o *options) {
+		o.maxSize = n
+	}
+}
+
+// WithExpectedDigest fails the gather if what it gathered does not have the
+// digest hex of the given algorithm, leaving the destination as it was. A
+// file is digested as it is, with "sha256" or "sha512", and a directory by
+// the digest of its tree, see TreeDigest, which is always "sha256". The
+// gather fails with ErrVerificationFailed on a mismatch.
+func WithExpectedDigest(algorithm, hex string) Option {
+	return func(o *options) {
+		o.digest = strings.ToLower(algorithm) + ":" + strings.ToLower(hex)
+	}
+}
+
+// WithConflictPolicy sets what Gather does when the destination exists
+// already, other than as an empty directory, for every gatherer. Without
+// it, what was gathered is merged into the destination, as with
+// ConflictMerge.
+func WithConflictPolicy(p ConflictPolicy) Option {
+	return func(o *options) {
+		o.conflict = p
+	}
+}
+
+// WithAuth authenticates as username with password: to git and Subversion
+// servers and OCI registries, to HTTP, WebDAV and IPFS servers with basic
+// authentication, and to S3 with username as the access key ID and password
+// as the secret access key. Gathers of local files fail with
+// ErrUnsupportedOption.
+func WithAuth(username, password string) Option {
+	return func(o *options) {
+		o.username, o.password = username, password
+	}
+}
+
+// WithToken authenticates to the git, OCI, HTTP, WebDAV and IPFS servers
+// with token, an access token the git gatherer sends as a password and the
+// others as a bearer token. Gathers from Subversion, S3 and local files fail
+// with ErrUnsupportedOption.
+func WithToken(token string) Option {
+	return func(o *options) {
+		o.token = token
+	}
+}
+
+// WithInsecure accepts any certificate the git, Subversion, HTTP, WebDAV or
+// IPFS server or OCI registry presents. It is meant for tests and
+// self-signed development servers. Gathers from S3 and local files fail
+// with ErrUnsupportedOption.
+func WithInsecure() Option {
+	return func(o *options) {
+		o.insecure = true
+	}
+}
+
+// WithDepth has the git gatherer clone the given number of commits only.
+func WithDepth(depth int) Option {
+	return func(o *options) {
+		o.depth = depth
+	}
+}
+
+// WithTracerProvider traces the gather with OpenTelemetry spans of tp: a
+// span for the gather, with spans for the clone, download or pull and the
+// expansion of archives within it. Spans are named after the operations and
+// carry attributes such as the type of the source and the bytes gathered.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(o *options) {
+		o.tracer = tp
+	}
+}
+
+// WithMetricsRecorder records the gather to r: the bytes written, how long
+// it took, whether it failed, and the retries and cache hits within it.
+func WithMetricsRecorder(r MetricsRecorder) Option {
+	return func(o *options) {
+		o.metrics = r
+	}
+}
+
+// configure returns a copy of g, the gatherer of source, with the options
+// applied, so that the gatherers of the registry, which every gather
+// shares, are left alone. Gatherers of other types are returned as is. It
+// fails with ErrUnsupportedOption if WithAuth, WithToken or WithInsecure
+// were given and the gatherer has no use for them.
+func (o *options) configure(g gather.Gatherer, source string) (gather.Gatherer, error) {
+	auth := o.username != "" || o.password != ""
+	switch g := g.(type) {
+	case *git.GitGatherer:
+		c := *g
+		if o.depth > 0 {
+			c.Depth = o.depth
+		}
+		if auth {
+			c.Credentials = git.Credentials{Username: o.username, Password: o.password}
+		}
+		if o.token != "" {
+			c.Credentials = git.Credentials{Password: o.token}
+		}
+		if o.insecure {
+			c.InsecureSkipTLS = true
+		}
+		return &c, nil
+	case *oci.OCIGatherer:
+		c := *g
+		if auth || o.token != "" {
+			c.Credentials = oci.Credentials{Username: o.username, Password: o.password, Token: o.token}
+		}
+		if o.insecure {
+			s, err := ParseOCISource(source)
+			if err != nil {
+				return nil, fmt.Errorf("%w: WithInsecure needs the registry of %s: %w", ErrUnsupportedOption, source, err)
+			}
+			// Validated already, so the reference parses
+			ref, _ := registry.ParseReference(s.Ref)
+			opts := c.Registries[ref.Registry]
+			opts.InsecureSkipVerify = true
+			c.Registries = maps.Clone(c.Registries)
+			if c.Registries == nil {
+				c.Registries = map[string]oci.RegistryOptions{}
+			}
+			c.Registries[ref.Registry] = opts
+		}
+		return &c, nil
+	case *ghttp.HTTPGatherer:
+		c := *g
+		if auth {
+			c.Headers = c.Headers.Clone()
+			if c.Headers == nil {
+				c.Headers = http.Header{}
+			}
+			c.Headers.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(o.username+":"+o.password)))
+		}
+		if o.token != "" {
+			c.BearerToken = o.token
+		}
+		if o.insecure {
+			c.TLS.InsecureSkipVerify = true
+		}
+		return &c, nil
+	case *webdav.WebDAVGatherer:
+		c := *g
+		if auth {
+			c.Username, c.Password = o.username, o.password
+		}
+		if o.token != "" {
+			c.BearerToken = o.token
+		}
+		if o.insecure {
+			t, err := insecureTransport(c.Client.Transport)
+			if err != nil {
+				return nil, err
+			}
+			c.Client.Transport = t
+		}
+		return &c, nil
+	case *ipfs.IPFSGatherer:
+		c := *g
+		if auth {
+			c.Username, c.Password = o.username, o.password
+		}
+		if o.token != "" {
+			c.BearerToken = o.token
+		}
+		if o.insecure {
+			t, err := insecureTransport(c.Client.Transport)
+			if err != nil {
+				return nil, err
+			}
+			c.Client.Transport = t
+		}
+		return &c, nil
+	case *svn.SVNGatherer:
+		if o.token != "" {
+			return nil, fmt.Errorf("%w: Subversion takes no access tokens, use WithAuth", ErrUnsupportedOption)
+		}
+		c := *g
+		if auth {
+			c.Username, c.Password = o.username, o.password
+		}
+		if o.insecure {
+			c.InsecureSkipVerify = true
+		}
+		return &c, nil
+	case *s3.S3Gatherer:
+		if o.token != "" || o.insecure {
+			return nil, fmt.Errorf("%w: S3 takes neither WithToken nor WithInsecure, use WithAuth with an access key", ErrUnsupportedOption)
+		}
+		c := *g
+		if auth {
+			c.AccessKeyID, c.SecretAccessKey = o.username, o.password
+			c.Anonymous = false
+		}
+		return &c, nil
+	case *file.FileGatherer:
+		if auth || o.token != "" || o.insecure {
+			break
+		}
+		c := *g
+		if o.maxSize > 0 && (c.Limits.FileSize == 0 || c.Limits.FileSize > o.maxSize) {
+			c.Limits.FileSize = o.maxSize
+		}
+		return &c, nil
+	}
+	if auth || o.token != "" || o.insecure {
+		return nil, fmt.Errorf("%w: %T takes neither WithAuth, WithToken nor WithInsecure", ErrUnsupportedOption, g)
+	}
+	return g, nil
+}
+
+// insecureTransport returns a copy of base, or of http.DefaultTransport when
+// nil, that accepts any certificate. Only an *http.Transport can be
+// configured.
+func insecureTransport(base http.RoundTripper) (http.RoundTripper, error) {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	t, ok := base.(*http.Transport)
+	if !ok {
+		return nil, fmt.Errorf("%w: WithInsecure needs the client transport to be an *http.Transport", ErrUnsupportedOption)
+	}
+	t = t.Clone()
+	if t.TLSClientConfig == nil {
+		t.TLSClientConfig = &tls.Config{}
+	}
+	t.TLSClientConfig.InsecureSkipVerify = true // #nosec G402 -- opted into with WithInsecure
+	return t, nil
+}
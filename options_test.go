@@ -0,0 +1,345 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package gogather
+
+import (
+	"context"
+	"crypto/sha512"
+	"encoding/hex"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/enterprise-contract/go-gather/gather"
+	"github.com/enterprise-contract/go-gather/gather/file"
+	"github.com/enterprise-contract/go-gather/gather/git"
+	ghttp "github.com/enterprise-contract/go-gather/gather/http"
+	"github.com/enterprise-contract/go-gather/gather/ipfs"
+	"github.com/enterprise-contract/go-gather/gather/oci"
+	"github.com/enterprise-contract/go-gather/gather/s3"
+	"github.com/enterprise-contract/go-gather/gather/svn"
+	"github.com/enterprise-contract/go-gather/gather/webdav"
+	"github.com/enterprise-contract/go-gather/metadata"
+)
+
+func configured(opts ...Option) *options {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return &o
+}
+
+// configure applies opts to g, the gatherer of source, failing t if they do
+// not apply.
+func configure[T gather.Gatherer](t *testing.T, g T, source string, opts ...Option) T {
+	t.Helper()
+	c, err := configured(opts...).configure(g, source)
+	require.NoError(t, err)
+	return c.(T)
+}
+
+func TestOptions_configure_Git(t *testing.T) {
+	g := &git.GitGatherer{Depth: 5}
+	c := configure(t, g, "git::https://example.com/repo", WithDepth(1), WithAuth("robot", "secret"))
+	assert.Equal(t, 1, c.Depth)
+	assert.Equal(t, git.Credentials{Username: "robot", Password: "secret"}, c.Credentials)
+	assert.Equal(t, 5, g.Depth, "the gatherer of the registry must be left alone")
+
+	c = configure(t, g, "git::https://example.com/repo", WithToken("token"), WithInsecure())
+	assert.Equal(t, git.Credentials{Password: "token"}, c.Credentials)
+	assert.Equal(t, 5, c.Depth)
+	assert.True(t, c.InsecureSkipTLS)
+	assert.False(t, g.InsecureSkipTLS)
+}
+
+func TestOptions_configure_OCI(t *testing.T) {
+	g := &oci.OCIGatherer{Registries: map[string]oci.RegistryOptions{"quay.io": {PlainHTTP: true}}}
+	c := configure(t, g, "oci::quay.io/org/policy:latest", WithInsecure(), WithToken("token"))
+	assert.Equal(t, oci.Credentials{Token: "token"}, c.Credentials)
+	assert.Equal(t, oci.RegistryOptions{PlainHTTP: true, InsecureSkipVerify: true}, c.Registries["quay.io"])
+	assert.Equal(t, oci.RegistryOptions{PlainHTTP: true}, g.Registries["quay.io"])
+
+	c = configure(t, &oci.OCIGatherer{}, "oci://localhost:5000/policy:latest", WithInsecure())
+	assert.Equal(t, map[string]oci.RegistryOptions{"localhost:5000": {InsecureSkipVerify: true}}, c.Registries)
+
+	// A source whose registry cannot be told is not gathered securely
+	_, err := configured(WithInsecure()).configure(&oci.OCIGatherer{}, "oci::Not A Reference")
+	assert.ErrorIs(t, err, ErrUnsupportedOption)
+	assert.ErrorIs(t, err, ErrInvalidSource)
+}
+
+func TestOptions_configure_HTTP(t *testing.T) {
+	g := &ghttp.HTTPGatherer{}
+	c := configure(t, g, "https://example.com/file", WithAuth("robot", "secret"), WithInsecure())
+	assert.Equal(t, "Basic cm9ib3Q6c2VjcmV0", c.Headers.Get("Authorization"))
+	assert.True(t, c.TLS.InsecureSkipVerify)
+	assert.Nil(t, g.Headers)
+	assert.False(t, g.TLS.InsecureSkipVerify)
+
+	c = configure(t, g, "https://example.com/file", WithToken("token"))
+	assert.Equal(t, "token", c.BearerToken)
+}
+
+func TestOptions_configure_File(t *testing.T) {
+	g := &file.FileGatherer{}
+	c := configure(t, g, "file::archive.tar", WithMaxSize(10))
+	assert.Equal(t, int64(10), c.Limits.FileSize)
+	assert.Zero(t, g.Limits.FileSize)
+
+	// Lower limits of the gatherer are kept
+	g.Limits.FileSize = 5
+	c = configure(t, g, "file::archive.tar", WithMaxSize(10))
+	assert.Equal(t, int64(5), c.Limits.FileSize)
+
+	_, err := configured(WithAuth("robot", "secret")).configure(g, "file::archive.tar")
+	assert.ErrorIs(t, err, ErrUnsupportedOption)
+}
+
+func TestOptions_configure_WebDAV(t *testing.T) {
+	g := &webdav.WebDAVGatherer{}
+	c := configure(t, g, "dav::https://example.com/dav/", WithAuth("robot", "secret"), WithInsecure())
+	assert.Equal(t, "robot", c.Username)
+	assert.Equal(t, "secret", c.Password)
+	require.IsType(t, &http.Transport{}, c.Client.Transport)
+	assert.True(t, c.Client.Transport.(*http.Transport).TLSClientConfig.InsecureSkipVerify)
+	assert.Nil(t, g.Client.Transport)
+
+	c = configure(t, g, "dav::https://example.com/dav/", WithToken("token"))
+	assert.Equal(t, "token", c.BearerToken)
+
+	// Only an *http.Transport can be made insecure
+	g.Client.Transport = roundTripper(nil)
+	_, err := configured(WithInsecure()).configure(g, "dav::https://example.com/dav/")
+	assert.ErrorIs(t, err, ErrUnsupportedOption)
+}
+
+// roundTripper is an http.RoundTripper other than an *http.Transport.
+type roundTripper func(*http.Request) (*http.Response, error)
+
+func (f roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestOptions_configure_IPFS(t *testing.T) {
+	g := &ipfs.IPFSGatherer{}
+	c := configure(t, g, "ipfs://bafkqaaa", WithToken("token"), WithInsecure())
+	assert.Equal(t, "token", c.BearerToken)
+	require.IsType(t, &http.Transport{}, c.Client.Transport)
+	assert.True(t, c.Client.Transport.(*http.Transport).TLSClientConfig.InsecureSkipVerify)
+
+	c = configure(t, g, "ipfs://bafkqaaa", WithAuth("robot", "secret"))
+	assert.Equal(t, "robot", c.Username)
+	assert.Equal(t, "secret", c.Password)
+	assert.Empty(t, g.Username)
+}
+
+func TestOptions_configure_SVN(t *testing.T) {
+	g := &svn.SVNGatherer{}
+	c := configure(t, g, "svn::https://svn.example.com/repo", WithAuth("robot", "secret"), WithInsecure())
+	assert.Equal(t, "robot", c.Username)
+	assert.Equal(t, "secret", c.Password)
+	assert.True(t, c.InsecureSkipVerify)
+	assert.False(t, g.InsecureSkipVerify)
+
+	_, err := configured(WithToken("token")).configure(g, "svn::https://svn.example.com/repo")
+	assert.ErrorIs(t, err, ErrUnsupportedOption)
+}
+
+func TestOptions_configure_S3(t *testing.T) {
+	g := &s3.S3Gatherer{Anonymous: true}
+	c := configure(t, g, "s3://bucket/key", WithAuth("AKID", "secret"))
+	assert.Equal(t, "AKID", c.AccessKeyID)
+	assert.Equal(t, "secret", c.SecretAccessKey)
+	assert.False(t, c.Anonymous)
+	assert.True(t, g.Anonymous)
+
+	for _, opt := range []Option{WithToken("token"), WithInsecure()} {
+		_, err := configured(opt).configure(g, "s3://bucket/key")
+		assert.ErrorIs(t, err, ErrUnsupportedOption)
+	}
+}
+
+func TestOptions_configure_Other(t *testing.T) {
+	g := fakeGatherer{}
+	assert.Equal(t, g, configure(t, gather.Gatherer(g), "fake://policy", WithDepth(1)))
+
+	_, err := configured(WithInsecure()).configure(g, "fake://policy")
+	assert.ErrorIs(t, err, ErrUnsupportedOption)
+}
+
+// slowGatherer gathers nothing, until its context is done.
+type slowGatherer struct{}
+
+func (slowGatherer) Matcher(uri string) bool { return uri == "slow://" }
+
+func (slowGatherer) Gather(ctx context.Context, src, dst string) (metadata.Metadata, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestGather_WithTimeout(t *testing.T) {
+	r := gather.NewRegistry()
+	r.RegisterGatherer(slowGatherer{})
+	_, err := Gather(context.Background(), "slow://", t.TempDir(), WithRegistry(r), WithTimeout(10*time.Millisecond))
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestGather_WithMaxSize(t *testing.T) {
+	r := gather.NewRegistry()
+	r.RegisterGatherer(fakeGatherer{})
+	ctx := context.Background()
+
+	dst := filepath.Join(t.TempDir(), "dst")
+	_, err := Gather(ctx, "fake://policy", dst, WithRegistry(r), WithMaxSize(1024))
+	require.NoError(t, err)
+
+	dst = filepath.Join(t.TempDir(), "dst")
+	_, err = Gather(ctx, "fake://policy", dst, WithRegistry(r), WithMaxSize(4))
+	assert.ErrorIs(t, err, ErrSizeLimitExceeded)
+	assert.ErrorContains(t, err, "more than the limit of 4")
+	assert.NoDirExists(t, dst)
+
+	// A destination that existed before is left in place
+	dst = t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dst, "keep"), nil, 0644))
+	_, err = Gather(ctx, "fake://policy", dst, WithRegistry(r), WithMaxSize(4))
+	assert.Error(t, err)
+	assert.FileExists(t, filepath.Join(dst, "keep"))
+}
+
+func TestGather_WithExpectedDigest(t *testing.T) {
+	r := gather.NewRegistry()
+	r.RegisterGatherer(fakeGatherer{})
+	ctx := context.Background()
+
+	// A directory is verified by its tree digest
+	dst := filepath.Join(t.TempDir(), "dst")
+	_, err := Gather(ctx, "fake://policy", dst, WithRegistry(r))
+	require.NoError(t, err)
+	tree, err := digest(ctx, dst, "sha256")
+	require.NoError(t, err)
+
+	dst = filepath.Join(t.TempDir(), "dst")
+	_, err = Gather(ctx, "fake://policy", dst, WithRegistry(r), WithExpectedDigest("SHA256", strings.ToUpper(strings.TrimPrefix(tree, "sha256:"))))
+	require.NoError(t, err)
+
+	dst = filepath.Join(t.TempDir(), "dst")
+	_, err = Gather(ctx, "fake://other", dst, WithRegistry(r), WithExpectedDigest("sha256", strings.TrimPrefix(tree, "sha256:")))
+	assert.ErrorIs(t, err, ErrVerificationFailed)
+	assert.NoDirExists(t, dst)
+
+	_, err = Gather(ctx, "fake://policy", dst, WithRegistry(r), WithExpectedDigest("sha512", strings.Repeat("0", 128)))
+	assert.ErrorContains(t, err, "directories can only be verified with a sha256 digest")
+
+	// A file is verified by its own digest
+	dir := t.TempDir()
+	src := filepath.Join(dir, "policy.rego")
+	require.NoError(t, os.WriteFile(src, []byte("package policy"), 0644))
+	sum := sha512.Sum512([]byte("package policy"))
+	_, err = Gather(ctx, "file::"+src, filepath.Join(dir, "copy.rego"), WithExpectedDigest("sha512", hex.EncodeToString(sum[:])))
+	require.NoError(t, err)
+	_, err = Gather(ctx, "file::"+src, filepath.Join(dir, "other.rego"), WithExpectedDigest("sha256", strings.Repeat("0", 64)))
+	assert.ErrorIs(t, err, ErrVerificationFailed)
+	assert.NoFileExists(t, filepath.Join(dir, "other.rego"))
+}
+
+func TestGather_WithExpectedDigest_Invalid(t *testing.T) {
+	r := gather.NewRegistry()
+	r.RegisterGatherer(fakeGatherer{})
+	dst := filepath.Join(t.TempDir(), "dst")
+
+	_, err := Gather(context.Background(), "fake://policy", dst, WithRegistry(r), WithExpectedDigest("md5", strings.Repeat("0", 32)))
+	assert.ErrorContains(t, err, `unsupported digest algorithm "md5"`)
+	_, err = Gather(context.Background(), "fake://policy", dst, WithRegistry(r), WithExpectedDigest("sha256", "abc"))
+	assert.ErrorContains(t, err, `invalid sha256 digest "abc"`)
+	// Nothing is gathered with an invalid digest
+	assert.NoDirExists(t, dst)
+}
+
+func TestGather_WithConflictPolicy(t *testing.T) {
+	r := gather.NewRegistry()
+	r.RegisterGatherer(fakeGatherer{})
+	ctx := context.Background()
+	existing := func(t *testing.T) string {
+		dst := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dst, "old.rego"), []byte("package old"), 0644))
+		require.NoError(t, os.WriteFile(filepath.Join(dst, "common.json"), []byte("[]"), 0644))
+		return dst
+	}
+	content := func(t *testing.T, path string) string {
+		b, err := os.ReadFile(path)
+		require.NoError(t, err)
+		return string(b)
+	}
+
+	t.Run("fail", func(t *testing.T) {
+		dst := existing(t)
+		_, err := Gather(ctx, "fake://policy", dst, WithRegistry(r), WithConflictPolicy(ConflictFail))
+		assert.ErrorIs(t, err, ErrDestinationExists)
+		assert.NoFileExists(t, filepath.Join(dst, "policy.rego"))
+
+		// An empty directory is not in the way
+		_, err = Gather(ctx, "fake://policy", t.TempDir(), WithRegistry(r), WithConflictPolicy(ConflictFail))
+		assert.NoError(t, err)
+	})
+
+	t.Run("skip", func(t *testing.T) {
+		dst := existing(t)
+		m, err := Gather(ctx, "fake://policy", dst, WithRegistry(r), WithConflictPolicy(ConflictSkipIfExists))
+		require.NoError(t, err)
+		assert.Equal(t, &SkippedMetadata{URI: "fake://policy", Path: dst}, m)
+		assert.NoFileExists(t, filepath.Join(dst, "policy.rego"))
+	})
+
+	t.Run("overwrite", func(t *testing.T) {
+		dst := existing(t)
+		_, err := Gather(ctx, "fake://policy", dst, WithRegistry(r), WithConflictPolicy(ConflictOverwrite))
+		require.NoError(t, err)
+		assert.FileExists(t, filepath.Join(dst, "policy.rego"))
+		assert.NoFileExists(t, filepath.Join(dst, "old.rego"))
+		assert.Equal(t, "{}", content(t, filepath.Join(dst, "common.json")))
+
+		// A failed gather leaves the destination as it was
+		dst = existing(t)
+		_, err = Gather(ctx, "fake://fail", dst, WithRegistry(r), WithConflictPolicy(ConflictOverwrite))
+		assert.Error(t, err)
+		assert.FileExists(t, filepath.Join(dst, "old.rego"))
+		assert.NoFileExists(t, filepath.Join(dst, "fail.rego"))
+		assert.Equal(t, "[]", content(t, filepath.Join(dst, "common.json")))
+	})
+
+	t.Run("merge", func(t *testing.T) {
+		dst := existing(t)
+		_, err := Gather(ctx, "fake://policy", dst, WithRegistry(r), WithConflictPolicy(ConflictMerge))
+		require.NoError(t, err)
+		assert.FileExists(t, filepath.Join(dst, "policy.rego"))
+		assert.FileExists(t, filepath.Join(dst, "old.rego"))
+		assert.Equal(t, "{}", content(t, filepath.Join(dst, "common.json")))
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := Gather(ctx, "fake://policy", t.TempDir(), WithRegistry(r), WithConflictPolicy("replace"))
+		assert.ErrorContains(t, err, `unknown conflict policy "replace"`)
+	})
+}
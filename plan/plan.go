@@ -0,0 +1,322 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package plan works out what gathering a source into a destination would do
+// to the files already there, without writing anything. It is intended for
+// gathers into shared directories, where a caller wants to review which files
+// would be created, overwritten or deleted before committing to it.
+package plan
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/enterprise-contract/go-gather/expand"
+	_ "github.com/enterprise-contract/go-gather/expand/tar"
+	_ "github.com/enterprise-contract/go-gather/expand/zip"
+	"github.com/enterprise-contract/go-gather/internal/helpers"
+)
+
+// Action is the effect a gather would have on a single destination path.
+type Action string
+
+const (
+	// Create writes a file or directory that does not exist yet.
+	Create Action = "create"
+	// Overwrite replaces an existing file whose contents differ.
+	Overwrite Action = "overwrite"
+	// Skip leaves an existing, identical file or directory untouched.
+	Skip Action = "skip"
+	// Delete removes a file that is not part of the source. It is only
+	// planned when Options.SyncDelete is set.
+	Delete Action = "delete"
+)
+
+// Change is a planned action on one path.
+type Change struct {
+	// Path is the slash-separated path relative to Plan.Destination.
+	Path   string
+	Action Action
+	// Size is the size of the file that would be written, or of the file that
+	// would be deleted. It is zero for directories.
+	Size int64
+	Dir  bool
+}
+
+// Plan lists the changes a gather would make to Destination, ordered by path.
+type Plan struct {
+	Destination string
+	Changes     []Change
+}
+
+// Options control how a plan is computed.
+type Options struct {
+	// SyncDelete plans the deletion of files in the destination that are not
+	// part of the source, as a gather that mirrors the source exactly would.
+	SyncDelete bool
+}
+
+// Count returns the number of changes with the given action.
+func (p *Plan) Count(a Action) int {
+	n := 0
+	for _, c := range p.Changes {
+		if c.Action == a {
+			n++
+		}
+	}
+	return n
+}
+
+// HasChanges reports whether applying the plan would modify the destination.
+func (p *Plan) HasChanges() bool {
+	return len(p.Changes) > p.Count(Skip)
+}
+
+// String renders the plan one change per line, followed by a summary, in the
+// spirit of "terraform plan".
+func (p *Plan) String() string {
+	var b strings.Builder
+	symbols := map[Action]string{Create: "+", Overwrite: "~", Skip: "=", Delete: "-"}
+	for _, c := range p.Changes {
+		path := c.Path
+		if c.Dir {
+			path += "/"
+		}
+		fmt.Fprintf(&b, "%s %-9s %s\n", symbols[c.Action], c.Action, path)
+	}
+	fmt.Fprintf(&b, "Plan: %d to create, %d to overwrite, %d to delete, %d unchanged.\n",
+		p.Count(Create), p.Count(Overwrite), p.Count(Delete), p.Count(Skip))
+	return b.String()
+}
+
+// Compute inspects src and the current state of dst and returns the changes
+// gathering src into dst would make. Only local sources can be inspected
+// without downloading them: directories, tar and zip archives, which are
+// listed rather than extracted, and plain files.
+func Compute(ctx context.Context, src, dst string, opts Options) (*Plan, error) {
+	local, ok := localPath(src)
+	if !ok {
+		return nil, fmt.Errorf("cannot plan gathering %q: only local sources can be inspected without downloading them", src)
+	}
+	local, err := helpers.ExpandPath(local)
+	if err != nil {
+		return nil, fmt.Errorf("failed to expand source path: %w", err)
+	}
+	for _, prefix := range []string{"file://", "file::"} {
+		dst = strings.TrimPrefix(dst, prefix)
+	}
+	dst, err = helpers.ExpandPath(dst)
+	if err != nil {
+		return nil, fmt.Errorf("failed to expand destination path: %w", err)
+	}
+
+	info, err := os.Stat(local)
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect source: %w", err)
+	}
+
+	var entries []expand.ManifestEntry
+	root := dst
+	switch {
+	case info.IsDir():
+		entries, err = walk(ctx, local)
+	case isArchive(local):
+		entries, err = list(ctx, local)
+	default:
+		// A plain file is written to dst itself.
+		root = filepath.Dir(dst)
+		var sum string
+		sum, err = digest(ctx, local)
+		entries = []expand.ManifestEntry{{Path: filepath.Base(dst), Size: info.Size(), Mode: info.Mode(), SHA256: sum}}
+		// Nothing besides the file itself belongs to the source.
+		opts.SyncDelete = false
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return compare(ctx, root, entries, opts)
+}
+
+// compare matches the source entries against what is present under root.
+func compare(ctx context.Context, root string, entries []expand.ManifestEntry, opts Options) (*Plan, error) {
+	p := &Plan{Destination: root}
+	wanted := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		wanted[e.Path] = true
+		isDir := e.Mode.IsDir()
+		c := Change{Path: e.Path, Action: Create, Dir: isDir}
+		if !isDir {
+			c.Size = e.Size
+		}
+
+		existing, err := os.Lstat(filepath.Join(root, filepath.FromSlash(e.Path)))
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+		case err != nil:
+			return nil, fmt.Errorf("failed to inspect destination: %w", err)
+		case isDir && existing.IsDir():
+			c.Action = Skip
+		case isDir || !existing.Mode().IsRegular():
+			c.Action = Overwrite
+		case existing.Size() != e.Size:
+			c.Action = Overwrite
+		default:
+			sum, err := digest(ctx, filepath.Join(root, filepath.FromSlash(e.Path)))
+			if err != nil {
+				return nil, err
+			}
+			c.Action = Overwrite
+			if sum == e.SHA256 {
+				c.Action = Skip
+			}
+		}
+		p.Changes = append(p.Changes, c)
+	}
+
+	if opts.SyncDelete {
+		deletions, err := stale(ctx, root, wanted)
+		if err != nil {
+			return nil, err
+		}
+		p.Changes = append(p.Changes, deletions...)
+	}
+
+	sort.SliceStable(p.Changes, func(i, j int) bool {
+		return p.Changes[i].Path < p.Changes[j].Path
+	})
+	return p, nil
+}
+
+// stale returns a Delete change for everything under root that is not wanted.
+// A directory that is not wanted is deleted along with its contents, which
+// are not listed separately.
+func stale(ctx context.Context, root string, wanted map[string]bool) ([]Change, error) {
+	var changes []Change
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == root && errors.Is(err, fs.ErrNotExist) {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if path == root {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if wanted[rel] {
+			return nil
+		}
+		c := Change{Path: rel, Action: Delete, Dir: d.IsDir()}
+		if !d.IsDir() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			c.Size = info.Size()
+		}
+		changes = append(changes, c)
+		if d.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect destination: %w", err)
+	}
+	return changes, nil
+}
+
+// walk lists the files and directories of a source directory.
+func walk(ctx context.Context, src string) ([]expand.ManifestEntry, error) {
+	m, err := expand.ScanDir(ctx, src)
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect source directory: %w", err)
+	}
+	return m.Entries, nil
+}
+
+// list enumerates the entries of an archive using the registered expander.
+func list(ctx context.Context, src string) ([]expand.ManifestEntry, error) {
+	e := expand.GetExpander(src)
+	lister, ok := e.(expand.Lister)
+	if !ok {
+		return nil, fmt.Errorf("cannot plan gathering %q: the archive format cannot be listed", src)
+	}
+	entries, err := lister.List(ctx, src)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list archive: %w", err)
+	}
+	return entries, nil
+}
+
+// isArchive reports whether src would be expanded rather than copied.
+func isArchive(src string) bool {
+	compressed, err := expand.IsCompressedFile(src)
+	if err != nil {
+		return false
+	}
+	tarFile, err := expand.IsTarFile(src)
+	if err != nil {
+		return false
+	}
+	return compressed || tarFile
+}
+
+// localPath returns the filesystem path of src if it is a local source.
+func localPath(src string) (string, bool) {
+	for _, prefix := range []string{"file://", "file::"} {
+		if strings.HasPrefix(src, prefix) {
+			return strings.TrimPrefix(src, prefix), true
+		}
+	}
+	if strings.Contains(src, "::") || strings.Contains(src, "://") {
+		return "", false
+	}
+	return src, true
+}
+
+func digest(ctx context.Context, path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, helpers.NewContextReader(ctx, f)); err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,185 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package plan
+
+import (
+	"archive/tar"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func actions(p *Plan) map[string]Action {
+	m := make(map[string]Action, len(p.Changes))
+	for _, c := range p.Changes {
+		m[c.Path] = c.Action
+	}
+	return m
+}
+
+func TestCompute_Directory(t *testing.T) {
+	src := t.TempDir()
+	dst := t.TempDir()
+	writeFile(t, filepath.Join(src, "same.txt"), "same")
+	writeFile(t, filepath.Join(src, "changed.txt"), "new")
+	writeFile(t, filepath.Join(src, "sub", "new.txt"), "new")
+	writeFile(t, filepath.Join(dst, "same.txt"), "same")
+	writeFile(t, filepath.Join(dst, "changed.txt"), "old")
+	writeFile(t, filepath.Join(dst, "extra.txt"), "extra")
+	writeFile(t, filepath.Join(dst, "olddir", "x.txt"), "x")
+
+	tests := []struct {
+		name string
+		opts Options
+		want map[string]Action
+	}{
+		{
+			name: "without SyncDelete",
+			want: map[string]Action{
+				"same.txt":    Skip,
+				"changed.txt": Overwrite,
+				"sub":         Create,
+				"sub/new.txt": Create,
+			},
+		},
+		{
+			name: "with SyncDelete",
+			opts: Options{SyncDelete: true},
+			want: map[string]Action{
+				"same.txt":    Skip,
+				"changed.txt": Overwrite,
+				"sub":         Create,
+				"sub/new.txt": Create,
+				"extra.txt":   Delete,
+				"olddir":      Delete,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := Compute(context.Background(), "file::"+src, dst, tt.opts)
+			if err != nil {
+				t.Fatalf("Compute returned an unexpected error: %v", err)
+			}
+			got := actions(p)
+			if len(got) != len(tt.want) {
+				t.Errorf("expected %d changes, got %v", len(tt.want), got)
+			}
+			for path, a := range tt.want {
+				if got[path] != a {
+					t.Errorf("%s: expected %s, got %s", path, a, got[path])
+				}
+			}
+			if !p.HasChanges() {
+				t.Error("expected the plan to have changes")
+			}
+		})
+	}
+
+	// Planning must not touch the destination.
+	if _, err := os.Stat(filepath.Join(dst, "sub")); !os.IsNotExist(err) {
+		t.Error("Compute wrote to the destination")
+	}
+}
+
+func TestCompute_Archive(t *testing.T) {
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "bundle.tar")
+	f, err := os.Create(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tw := tar.NewWriter(f)
+	for name, content := range map[string]string{"a.txt": "a", "b.txt": "b"} {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: int64(len(content))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tw.Close()
+	f.Close()
+
+	dst := filepath.Join(dir, "out")
+	writeFile(t, filepath.Join(dst, "a.txt"), "a")
+
+	p, err := Compute(context.Background(), archive, dst, Options{})
+	if err != nil {
+		t.Fatalf("Compute returned an unexpected error: %v", err)
+	}
+	got := actions(p)
+	if got["a.txt"] != Skip || got["b.txt"] != Create || len(got) != 2 {
+		t.Errorf("unexpected plan: %v", got)
+	}
+}
+
+func TestCompute_File(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src.txt")
+	dst := filepath.Join(dir, "dst.txt")
+	writeFile(t, src, "content")
+
+	p, err := Compute(context.Background(), src, dst, Options{SyncDelete: true})
+	if err != nil {
+		t.Fatalf("Compute returned an unexpected error: %v", err)
+	}
+	if len(p.Changes) != 1 || p.Changes[0].Path != "dst.txt" || p.Changes[0].Action != Create {
+		t.Fatalf("unexpected plan: %+v", p.Changes)
+	}
+
+	writeFile(t, dst, "content")
+	p, err = Compute(context.Background(), src, dst, Options{})
+	if err != nil {
+		t.Fatalf("Compute returned an unexpected error: %v", err)
+	}
+	if p.HasChanges() {
+		t.Errorf("expected no changes, got %+v", p.Changes)
+	}
+}
+
+func TestCompute_RemoteSource(t *testing.T) {
+	_, err := Compute(context.Background(), "https://example.com/policy.tar.gz", t.TempDir(), Options{})
+	if err == nil || !strings.Contains(err.Error(), "only local sources") {
+		t.Errorf("expected an error for a remote source, got %v", err)
+	}
+}
+
+func TestPlan_String(t *testing.T) {
+	p := &Plan{Changes: []Change{
+		{Path: "a.txt", Action: Create},
+		{Path: "dir", Action: Delete, Dir: true},
+	}}
+	s := p.String()
+	for _, want := range []string{"+ create    a.txt", "- delete    dir/", "Plan: 1 to create, 0 to overwrite, 1 to delete, 0 unchanged."} {
+		if !strings.Contains(s, want) {
+			t.Errorf("expected %q in:\n%s", want, s)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package reconcile
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	gogather "github.com/enterprise-contract/go-gather"
+	"github.com/enterprise-contract/go-gather/expand"
+)
+
+// PruneReport describes what pruning removed and left in place.
+type PruneReport struct {
+	// Pruned names the trees whose records were removed.
+	Pruned []string
+	// Removed and Retained list the slash-separated paths, relative to the
+	// root, of the recorded entries that were removed, and of those left as
+	// they changed since being recorded, hold unrecorded files or are within
+	// a kept tree.
+	Removed  []string
+	Retained []string
+}
+
+// Prune removes the trees recorded in root that are not named in keep, as
+// the names of Source, e.g. those of sources removed from a declarative set.
+// Only the entries listed in the records of the pruned trees are removed, and
+// only when unchanged since being recorded, so files added by users, files
+// they modified and the trees of other sources are left untouched.
+// Directories are removed once emptied.
+func Prune(ctx context.Context, root string, keep []string) (*PruneReport, error) {
+	current, err := ReadState(root)
+	if err != nil {
+		return nil, err
+	}
+	kept := make([]string, 0, len(keep))
+	for _, name := range keep {
+		kept = append(kept, clean(name))
+	}
+
+	names := make([]string, 0, len(current.Records))
+	for name := range current.Records {
+		if !within(name, kept) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	report := &PruneReport{}
+	var errs gogather.Errors
+	for _, name := range names {
+		if err := ctx.Err(); err != nil {
+			return report, gogather.AppendErrors(errs, err).Err()
+		}
+		if err := prune(ctx, root, name, current.Records[name], kept, report); err != nil {
+			errs = gogather.AppendErrors(errs, fmt.Errorf("prune %s: %w", name, err))
+		}
+	}
+	return report, errs.Err()
+}
+
+// within reports whether the slash-separated path rel is one of names, or
+// within one of them.
+func within(rel string, names []string) bool {
+	for _, name := range names {
+		if rel == name || strings.HasPrefix(rel, name+"/") || name == "." {
+			return true
+		}
+	}
+	return false
+}
+
+// prune removes the unchanged entries recorded in r from the tree name in
+// root, but for those within the kept trees, followed by the record.
+func prune(ctx context.Context, root, name string, r *gogather.Record, kept []string, report *PruneReport) error {
+	dst := filepath.Join(root, filepath.FromSlash(name))
+	found := map[string]expand.ManifestEntry{}
+	if _, err := os.Lstat(dst); err == nil {
+		current, err := expand.ScanDir(ctx, dst)
+		if err != nil {
+			return fmt.Errorf("failed to list %s: %w", dst, err)
+		}
+		for _, e := range current.Entries {
+			found[e.Path] = e
+		}
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	// Entries are removed in reverse order, which has those within a
+	// directory removed before it
+	entries := append([]expand.ManifestEntry(nil), r.Entries...)
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path > entries[j].Path })
+	var errs gogather.Errors
+	for _, want := range entries {
+		rel := name + "/" + want.Path
+		got, ok := found[want.Path]
+		switch {
+		case !ok:
+			// Already gone
+			continue
+		case within(rel, kept) || got.Mode.Type() != want.Mode.Type() || got.Size != want.Size || got.SHA256 != want.SHA256 || got.Target != want.Target:
+			report.Retained = append(report.Retained, rel)
+			continue
+		}
+		p := filepath.Join(dst, filepath.FromSlash(want.Path))
+		if got.Mode.IsDir() {
+			if empty, err := isEmpty(p); err != nil || !empty {
+				report.Retained = append(report.Retained, rel)
+				errs = gogather.AppendErrors(errs, err)
+				continue
+			}
+		}
+		if err := os.Remove(p); err != nil {
+			errs = gogather.AppendErrors(errs, err)
+			continue
+		}
+		report.Removed = append(report.Removed, rel)
+	}
+	if err := errs.Err(); err != nil {
+		return err
+	}
+
+	if empty, err := isEmpty(dst); err == nil && empty {
+		if err := os.Remove(dst); err != nil {
+			return err
+		}
+	}
+	if err := os.Remove(gogather.RecordPath(dst)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	report.Pruned = append(report.Pruned, name)
+	return nil
+}
+
+// isEmpty reports whether the directory dir has no entries.
+func isEmpty(dir string) (bool, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return false, err
+	}
+	return len(entries) == 0, nil
+}
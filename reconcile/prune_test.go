@@ -0,0 +1,120 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package reconcile
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/enterprise-contract/go-gather/gather"
+	"github.com/enterprise-contract/go-gather/gather/file"
+)
+
+func TestPrune(t *testing.T) {
+	sources := t.TempDir()
+	writeFile(t, filepath.Join(sources, "a", "main.rego"), "package a")
+	writeFile(t, filepath.Join(sources, "a", "lib", "util.rego"), "package util")
+	writeFile(t, filepath.Join(sources, "a", "lib", "data.json"), "{}")
+	writeFile(t, filepath.Join(sources, "b", "main.rego"), "package b")
+	writeFile(t, filepath.Join(sources, "c", "main.rego"), "package c")
+	registry := gather.NewRegistry()
+	registry.RegisterGatherer(&file.FileGatherer{})
+	root := filepath.Join(t.TempDir(), "root")
+	reconcile(t, root, []Source{
+		{Name: "a", URI: filepath.Join(sources, "a")},
+		{Name: "b", URI: filepath.Join(sources, "b")},
+		{Name: "c", URI: filepath.Join(sources, "c")},
+	}, Options{Registry: registry})
+
+	// A user file within a, another one modified, and one next to the trees
+	writeFile(t, filepath.Join(root, "a", "lib", "notes.txt"), "mine")
+	writeFile(t, filepath.Join(root, "a", "lib", "data.json"), `{"edited": true}`)
+	writeFile(t, filepath.Join(root, "README"), "mine")
+
+	report, err := Prune(context.Background(), root, []string{"b"})
+	if err != nil {
+		t.Fatalf("Prune returned unexpected error: %v", err)
+	}
+	if got := strings.Join(report.Pruned, ","); got != "a,c" {
+		t.Errorf("expected a and c to be pruned, got %v", report.Pruned)
+	}
+	if got := strings.Join(report.Removed, ","); got != "a/main.rego,a/lib/util.rego,c/main.rego" {
+		t.Errorf("unexpected removed entries: %v", report.Removed)
+	}
+	if got := strings.Join(report.Retained, ","); got != "a/lib/data.json,a/lib" {
+		t.Errorf("unexpected retained entries: %v", report.Retained)
+	}
+
+	for name, want := range map[string]bool{
+		"a/main.rego":     false,
+		"a/lib/util.rego": false,
+		"a/lib/notes.txt": true,
+		"a/lib/data.json": true,
+		"a.gather.json":   false,
+		"b/main.rego":     true,
+		"b.gather.json":   true,
+		"c":               false,
+		"c.gather.json":   false,
+		"README":          true,
+	} {
+		_, err := os.Lstat(filepath.Join(root, filepath.FromSlash(name)))
+		if got := err == nil; got != want {
+			t.Errorf("expected %s to exist=%v, got %v", name, want, err)
+		}
+	}
+
+	// Pruning again leaves the remaining files alone
+	report, err = Prune(context.Background(), root, []string{"b"})
+	if err != nil {
+		t.Fatalf("Prune returned unexpected error: %v", err)
+	}
+	if len(report.Pruned) != 0 || len(report.Removed) != 0 {
+		t.Errorf("expected nothing to be pruned, got %+v", report)
+	}
+}
+
+func TestPruneKeptWithin(t *testing.T) {
+	sources := t.TempDir()
+	writeFile(t, filepath.Join(sources, "outer", "main.rego"), "package outer")
+	writeFile(t, filepath.Join(sources, "outer", "inner", "main.rego"), "package inner")
+	registry := gather.NewRegistry()
+	registry.RegisterGatherer(&file.FileGatherer{})
+	root := filepath.Join(t.TempDir(), "root")
+	reconcile(t, root, []Source{{Name: "outer", URI: filepath.Join(sources, "outer")}}, Options{Registry: registry})
+
+	// Files within a kept name are left, even when recorded for another tree
+	report, err := Prune(context.Background(), root, []string{"outer/inner"})
+	if err != nil {
+		t.Fatalf("Prune returned unexpected error: %v", err)
+	}
+	if got := strings.Join(report.Removed, ","); got != "outer/main.rego" {
+		t.Errorf("unexpected removed entries: %v", report.Removed)
+	}
+	if _, err := os.Stat(filepath.Join(root, "outer", "inner", "main.rego")); err != nil {
+		t.Errorf("expected the kept file to be left: %v", err)
+	}
+}
+
+func TestPruneMissingRoot(t *testing.T) {
+	report, err := Prune(context.Background(), filepath.Join(t.TempDir(), "missing"), nil)
+	if err != nil || len(report.Pruned) != 0 {
+		t.Errorf("expected nothing to prune, got %+v, %v", report, err)
+	}
+}
@@ -0,0 +1,330 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package reconcile brings a directory of gathered trees in line with a
+// desired set of sources, for controllers reconciling resources that declare
+// them. Compute works out the minimal work from the records stored alongside
+// the trees, see gogather.WriteRecord, reporting the trees that drifted from
+// their records, and Apply carries it out.
+package reconcile
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	gogather "github.com/enterprise-contract/go-gather"
+	"github.com/enterprise-contract/go-gather/gather"
+)
+
+// Action is what reconciling does to the tree of a single source.
+type Action string
+
+const (
+	// Gather gathers a source that has no tree yet.
+	Gather Action = "gather"
+	// Repin gathers a tree again from the source that replaced the one it
+	// was gathered from, e.g. a new tag or digest.
+	Repin Action = "repin"
+	// Repair gathers a tree again as it drifted from its record.
+	Repair Action = "repair"
+	// Keep leaves a tree as it is.
+	Keep Action = "keep"
+	// Delete removes a tree whose source is no longer desired, and its
+	// record, leaving the files not attributable to it, see Prune.
+	Delete Action = "delete"
+)
+
+// stagingPrefix prefixes the temporary directories Apply gathers into.
+const stagingPrefix = ".reconcile-"
+
+// Source is a desired source.
+type Source struct {
+	// Name is the slash-separated path of its tree relative to the root.
+	Name string
+	// URI is the source to gather.
+	URI string
+}
+
+// State is the trees recorded in a root directory.
+type State struct {
+	Root string
+	// Records maps the slash-separated names of the trees to their
+	// records.
+	Records map[string]*gogather.Record
+}
+
+// Step is the planned action on the tree of a single source.
+type Step struct {
+	Name   string
+	Action Action
+	// Source is the desired URI, empty for Delete.
+	Source string
+	// Current is the record of the tree, nil for Gather.
+	Current *gogather.Record
+	// Drift describes how the tree differs from its record, for Repair.
+	Drift *gogather.VerifyReport
+}
+
+// Plan lists the steps reconciling Root, ordered by name.
+type Plan struct {
+	Root  string
+	Steps []Step
+}
+
+// Count returns the number of steps with the given action.
+func (p *Plan) Count(a Action) int {
+	n := 0
+	for _, s := range p.Steps {
+		if s.Action == a {
+			n++
+		}
+	}
+	return n
+}
+
+// HasChanges reports whether applying the plan would modify the root.
+func (p *Plan) HasChanges() bool {
+	return len(p.Steps) > p.Count(Keep)
+}
+
+// Drifted returns the steps of the trees that drifted from their records.
+func (p *Plan) Drifted() []Step {
+	var drifted []Step
+	for _, s := range p.Steps {
+		if s.Drift != nil {
+			drifted = append(drifted, s)
+		}
+	}
+	return drifted
+}
+
+// String renders the plan one step per line, followed by a summary.
+func (p *Plan) String() string {
+	var b strings.Builder
+	symbols := map[Action]string{Gather: "+", Repin: "~", Repair: "!", Keep: "=", Delete: "-"}
+	for _, s := range p.Steps {
+		source := s.Source
+		if s.Action == Delete {
+			source = s.Current.Source
+		}
+		fmt.Fprintf(&b, "%s %-6s %s (%s)\n", symbols[s.Action], s.Action, s.Name, source)
+	}
+	fmt.Fprintf(&b, "Plan: %d to gather, %d to repin, %d to repair, %d to delete, %d unchanged.\n",
+		p.Count(Gather), p.Count(Repin), p.Count(Repair), p.Count(Delete), p.Count(Keep))
+	return b.String()
+}
+
+// ReadState reads the records of the trees in root. Trees are not descended
+// into, so a tree within another one is not found.
+func ReadState(root string) (*State, error) {
+	s := &State{Root: root, Records: map[string]*gogather.Record{}}
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if p == root && errors.Is(err, fs.ErrNotExist) {
+				return filepath.SkipAll
+			}
+			return err
+		}
+		if p == root {
+			return nil
+		}
+		if d.IsDir() {
+			if strings.HasPrefix(d.Name(), stagingPrefix) {
+				return filepath.SkipDir
+			}
+			if _, err := os.Lstat(gogather.RecordPath(p)); err == nil {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		dst, ok := strings.CutSuffix(p, gogather.RecordSuffix)
+		if !ok {
+			return nil
+		}
+		r, err := gogather.ReadRecord(dst)
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, dst)
+		if err != nil {
+			return err
+		}
+		s.Records[filepath.ToSlash(rel)] = r
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read state of %s: %w", root, err)
+	}
+	return s, nil
+}
+
+// Compute returns the steps bringing the trees of current in line with
+// desired: the sources without a tree are gathered, trees gathered from
+// another source are gathered again, as are those that drifted from their
+// records, and trees of sources no longer desired are deleted.
+func Compute(ctx context.Context, desired []Source, current *State) (*Plan, error) {
+	if err := validate(desired); err != nil {
+		return nil, err
+	}
+
+	p := &Plan{Root: current.Root}
+	wanted := map[string]bool{}
+	for _, src := range desired {
+		name := clean(src.Name)
+		wanted[name] = true
+		step := Step{Name: name, Source: src.URI, Current: current.Records[name]}
+		switch {
+		case step.Current == nil:
+			step.Action = Gather
+		case step.Current.Source != src.URI:
+			step.Action = Repin
+		default:
+			report, err := gogather.VerifyDestination(ctx, filepath.Join(current.Root, filepath.FromSlash(name)))
+			if err != nil {
+				return nil, fmt.Errorf("failed to verify %s: %w", name, err)
+			}
+			step.Action = Keep
+			if !report.OK() {
+				step.Action, step.Drift = Repair, report
+			}
+		}
+		p.Steps = append(p.Steps, step)
+	}
+	for name, r := range current.Records {
+		if !wanted[name] {
+			p.Steps = append(p.Steps, Step{Name: name, Action: Delete, Current: r})
+		}
+	}
+	sort.Slice(p.Steps, func(i, j int) bool { return p.Steps[i].Name < p.Steps[j].Name })
+	return p, nil
+}
+
+// clean returns the slash-separated form of name.
+func clean(name string) string {
+	return filepath.ToSlash(filepath.Clean(filepath.FromSlash(name)))
+}
+
+// validate checks that the desired sources have distinct names, none of
+// which is within another.
+func validate(desired []Source) error {
+	names := make([]string, 0, len(desired))
+	for _, src := range desired {
+		if src.URI == "" {
+			return fmt.Errorf("no URI for %q", src.Name)
+		}
+		if !filepath.IsLocal(filepath.FromSlash(src.Name)) || strings.HasPrefix(clean(src.Name), stagingPrefix) {
+			return fmt.Errorf("invalid name %q: not a local path", src.Name)
+		}
+		names = append(names, clean(src.Name))
+	}
+	sort.Strings(names)
+	for i := 1; i < len(names); i++ {
+		if names[i] == names[i-1] || strings.HasPrefix(names[i], names[i-1]+"/") {
+			return fmt.Errorf("the names %q and %q overlap", names[i-1], names[i])
+		}
+	}
+	return nil
+}
+
+// Options control how a plan is applied.
+type Options struct {
+	// Registry picks the gatherer of each source. The default registry is
+	// used when nil.
+	Registry *gather.Registry
+}
+
+// Apply carries out the steps of p. Trees are gathered into a temporary
+// directory in the root and moved into place once gathered, so a failed
+// gather leaves the tree it was to replace as it was. Steps are carried out
+// past failures, which are returned together as gogather.Errors.
+func Apply(ctx context.Context, p *Plan, opts Options) error {
+	var kept []string
+	for _, s := range p.Steps {
+		if s.Action != Delete {
+			kept = append(kept, s.Name)
+		}
+	}
+
+	var errs gogather.Errors
+	for _, s := range p.Steps {
+		if err := ctx.Err(); err != nil {
+			return gogather.AppendErrors(errs, err).Err()
+		}
+		dst := filepath.Join(p.Root, filepath.FromSlash(s.Name))
+		var err error
+		switch s.Action {
+		case Gather, Repin, Repair:
+			err = replace(ctx, p.Root, dst, s.Source, opts)
+		case Delete:
+			err = prune(ctx, p.Root, s.Name, s.Current, kept, &PruneReport{})
+		}
+		if err != nil {
+			errs = gogather.AppendErrors(errs, fmt.Errorf("%s %s: %w", s.Action, s.Name, err))
+		}
+	}
+	return errs.Err()
+}
+
+// replace gathers src into a staging directory in root, and moves the tree
+// to dst, replacing the tree there, if any, with its record.
+func replace(ctx context.Context, root, dst, src string, opts Options) (err error) {
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return err
+	}
+	staging, err := os.MkdirTemp(root, stagingPrefix)
+	if err != nil {
+		return fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	defer func() {
+		err = gogather.AppendErrors(nil, err, os.RemoveAll(staging)).Err()
+	}()
+
+	// gogather.Gather honours the go-getter syntax of src, and the trailing
+	// separator has gatherers of single files write them into the directory
+	tree := filepath.Join(staging, "tree")
+	m, err := gogather.Gather(ctx, src, tree+string(filepath.Separator), gogather.WithRegistry(opts.Registry))
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	old := filepath.Join(staging, "old")
+	if err := os.Rename(dst, old); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to move %s aside: %w", dst, err)
+	}
+	if err := os.Rename(tree, dst); err != nil {
+		// Put the tree that was there back
+		return gogather.AppendErrors(gogather.Errors{fmt.Errorf("failed to move tree into place: %w", err)}, restore(old, dst)).Err()
+	}
+	_, err = gogather.WriteProvenance(ctx, src, dst, m)
+	return err
+}
+
+// restore moves the tree at old back to dst, if there was one.
+func restore(old, dst string) error {
+	if _, err := os.Lstat(old); err != nil {
+		return nil
+	}
+	return os.Rename(old, dst)
+}
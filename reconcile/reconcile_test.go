@@ -0,0 +1,247 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package reconcile
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	gogather "github.com/enterprise-contract/go-gather"
+	"github.com/enterprise-contract/go-gather/gather"
+	"github.com/enterprise-contract/go-gather/gather/file"
+)
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func actions(p *Plan) map[string]Action {
+	m := make(map[string]Action, len(p.Steps))
+	for _, s := range p.Steps {
+		m[s.Name] = s.Action
+	}
+	return m
+}
+
+func reconcile(t *testing.T, root string, desired []Source, opts Options) *Plan {
+	t.Helper()
+	state, err := ReadState(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := Compute(context.Background(), desired, state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Apply(context.Background(), p, opts); err != nil {
+		t.Fatalf("Apply returned unexpected error: %v", err)
+	}
+	return p
+}
+
+func TestReconcile(t *testing.T) {
+	sources := t.TempDir()
+	for _, name := range []string{"v1", "v2", "data"} {
+		writeFile(t, filepath.Join(sources, name, "main.rego"), "package "+name)
+	}
+	registry := gather.NewRegistry()
+	registry.RegisterGatherer(&file.FileGatherer{})
+	opts := Options{Registry: registry}
+	root := filepath.Join(t.TempDir(), "root")
+
+	// Everything is gathered at first
+	desired := []Source{
+		{Name: "policy/main", URI: filepath.Join(sources, "v1")},
+		{Name: "data", URI: filepath.Join(sources, "data")},
+	}
+	p := reconcile(t, root, desired, opts)
+	if got := actions(p); got["policy/main"] != Gather || got["data"] != Gather {
+		t.Errorf("unexpected plan: %v", got)
+	}
+	if b, err := os.ReadFile(filepath.Join(root, "policy", "main", "main.rego")); err != nil || string(b) != "package v1" {
+		t.Fatalf("expected the source to be gathered, got %q, %v", b, err)
+	}
+
+	// Then nothing is left to do
+	state, err := ReadState(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Records) != 2 {
+		t.Errorf("expected 2 records, got %v", state.Records)
+	}
+	p, err = Compute(context.Background(), desired, state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.HasChanges() {
+		t.Errorf("expected no changes, got:\n%s", p)
+	}
+
+	// A new source is repinned, a drifted tree repaired and a source no
+	// longer desired deleted
+	writeFile(t, filepath.Join(root, "data", "main.rego"), "tampered")
+	desired = []Source{
+		{Name: "policy/main", URI: filepath.Join(sources, "v2")},
+		{Name: "data", URI: filepath.Join(sources, "data")},
+		{Name: "other", URI: filepath.Join(sources, "v1")},
+	}
+	state, err = ReadState(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state.Records["stale"] = state.Records["data"]
+	if err := os.MkdirAll(filepath.Join(root, "stale"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	p, err = Compute(context.Background(), desired, state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]Action{"policy/main": Repin, "data": Repair, "other": Gather, "stale": Delete}
+	if got := actions(p); len(got) != len(want) || got["policy/main"] != Repin || got["data"] != Repair || got["other"] != Gather || got["stale"] != Delete {
+		t.Errorf("unexpected plan: %v", got)
+	}
+	if drifted := p.Drifted(); len(drifted) != 1 || drifted[0].Drift.Modified[0] != "main.rego" {
+		t.Errorf("unexpected drift: %+v", drifted)
+	}
+	if !strings.Contains(p.String(), "Plan: 1 to gather, 1 to repin, 1 to repair, 1 to delete, 0 unchanged.") {
+		t.Errorf("unexpected plan rendering:\n%s", p)
+	}
+	if err := Apply(context.Background(), p, opts); err != nil {
+		t.Fatalf("Apply returned unexpected error: %v", err)
+	}
+	for path, content := range map[string]string{"policy/main/main.rego": "package v2", "data/main.rego": "package data", "other/main.rego": "package v1"} {
+		if b, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(path))); err != nil || string(b) != content {
+			t.Errorf("expected %s to hold %q, got %q, %v", path, content, b, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, "stale")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected the stale tree to be deleted, got %v", err)
+	}
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), stagingPrefix) {
+			t.Errorf("expected the staging directory %s to be removed", e.Name())
+		}
+	}
+}
+
+func TestApply_Failure(t *testing.T) {
+	sources := t.TempDir()
+	writeFile(t, filepath.Join(sources, "v1", "main.rego"), "package v1")
+	registry := gather.NewRegistry()
+	registry.RegisterGatherer(&file.FileGatherer{})
+	opts := Options{Registry: registry}
+	root := t.TempDir()
+	reconcile(t, root, []Source{{Name: "policy", URI: filepath.Join(sources, "v1")}}, opts)
+
+	// A failed gather keeps the tree it was to replace, and the other
+	// steps are carried out
+	state, err := ReadState(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := Compute(context.Background(), []Source{
+		{Name: "policy", URI: filepath.Join(sources, "missing")},
+		{Name: "other", URI: filepath.Join(sources, "v1")},
+	}, state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = Apply(context.Background(), p, opts)
+	if err == nil || !strings.Contains(err.Error(), "repin policy") {
+		t.Fatalf("expected the repin to fail, got %v", err)
+	}
+	if b, err := os.ReadFile(filepath.Join(root, "policy", "main.rego")); err != nil || string(b) != "package v1" {
+		t.Errorf("expected the tree to be kept, got %q, %v", b, err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "other", "main.rego")); err != nil {
+		t.Errorf("expected the other source to be gathered: %v", err)
+	}
+}
+
+func TestApply_GetterSyntax(t *testing.T) {
+	sources := t.TempDir()
+	writeFile(t, filepath.Join(sources, "repo", "policy", "main.rego"), "package main")
+	writeFile(t, filepath.Join(sources, "repo", "README.md"), "# policy")
+	registry := gather.NewRegistry()
+	registry.RegisterGatherer(&file.FileGatherer{})
+	root := t.TempDir()
+
+	// Only the subdirectory is gathered
+	reconcile(t, root, []Source{{Name: "policy", URI: "file::" + filepath.Join(sources, "repo") + "//policy"}}, Options{Registry: registry})
+	if _, err := os.Stat(filepath.Join(root, "policy", "main.rego")); err != nil {
+		t.Errorf("expected the subdirectory to be gathered: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "policy", "README.md")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected only the subdirectory to be gathered, got %v", err)
+	}
+
+	// And checksums are verified
+	state, err := ReadState(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := Compute(context.Background(), []Source{
+		{Name: "readme", URI: "file::" + filepath.Join(sources, "repo", "README.md") + "?checksum=sha256:" + strings.Repeat("0", 64)},
+	}, state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Apply(context.Background(), p, Options{Registry: registry}); !errors.Is(err, gogather.ErrVerificationFailed) {
+		t.Errorf("expected the checksum to be verified, got %v", err)
+	}
+}
+
+func TestCompute_Invalid(t *testing.T) {
+	state := &State{Root: t.TempDir()}
+	for _, desired := range [][]Source{
+		{{Name: "a", URI: "/a"}, {Name: "a/", URI: "/b"}},
+		{{Name: "a", URI: "/a"}, {Name: "a/b", URI: "/b"}},
+		{{Name: "../a", URI: "/a"}},
+		{{Name: ".reconcile-x", URI: "/a"}},
+		{{Name: "a"}},
+	} {
+		if _, err := Compute(context.Background(), desired, state); err == nil {
+			t.Errorf("expected an error for %v", desired)
+		}
+	}
+}
+
+func TestReadState_Missing(t *testing.T) {
+	state, err := ReadState(filepath.Join(t.TempDir(), "missing"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Records) != 0 {
+		t.Errorf("expected no records, got %v", state.Records)
+	}
+}
@@ -0,0 +1,218 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package gogather provides entry points that span the individual gatherers
+// and expanders.
+package gogather
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"time"
+
+	"github.com/enterprise-contract/go-gather/expand"
+	"github.com/enterprise-contract/go-gather/metadata"
+)
+
+// RecordSuffix is appended to a destination to name the file its record is
+// stored in, alongside rather than inside the gathered tree.
+const RecordSuffix = ".gather.json"
+
+// modulePath is the path of the go-gather module.
+const modulePath = "github.com/enterprise-contract/go-gather"
+
+// Record is the manifest and provenance stored for a gathered tree, which
+// VerifyDestination checks the tree against. It is stored as canonical
+// JSON, with sorted keys and no insignificant whitespace, so that the same
+// record always has the same bytes for attestations to sign.
+type Record struct {
+	// Source is the URI the tree was gathered from.
+	Source string `json:"source"`
+	// Type is the type of the source, e.g. "git" or "oci".
+	Type string `json:"type,omitempty"`
+	// Digest is the digest or commit the source resolved to.
+	Digest string `json:"digest,omitempty"`
+	// Pinned is the source pinned to what it resolved to, as returned by
+	// the GetPinnedURL method of the metadata of the gather.
+	Pinned string `json:"pinned,omitempty"`
+	// Signatures reference the signatures verified for the source, e.g. the
+	// cosign signature tag "sha256-<hex>.sig" of an image.
+	Signatures []string `json:"signatures,omitempty"`
+	// Tool is the version of go-gather that stored the record, as
+	// "go-gather@<version>".
+	Tool      string `json:"tool,omitempty"`
+	Timestamp string `json:"timestamp"`
+	// TreeDigest is the digest of Entries, see TreeDigest.
+	TreeDigest string                 `json:"treeDigest"`
+	Entries    []expand.ManifestEntry `json:"entries"`
+}
+
+// PinnedURL returns src pinned by the metadata m of its gather, or an empty
+// string when m can't pin it any further.
+func PinnedURL(m metadata.Metadata, src string) string {
+	if m == nil {
+		return ""
+	}
+	if pinned, err := m.GetPinnedURL(src); err == nil && pinned != src {
+		return pinned
+	}
+	return ""
+}
+
+// NewRecord returns the record of the gather of src described by its
+// metadata m: the type of the source, what it resolved to, how it is pinned
+// and when it was gathered. See metadata.Summary.
+func NewRecord(src string, m metadata.Metadata) Record {
+	s := metadata.Summarize(m)
+	return Record{
+		Source:    src,
+		Type:      s.Type,
+		Digest:    s.Revision,
+		Pinned:    PinnedURL(m, src),
+		Timestamp: s.Timestamp,
+	}
+}
+
+// WriteProvenance stores the record of the gather of src into dst, described
+// by its metadata m, alongside dst. See NewRecord and WriteRecord.
+func WriteProvenance(ctx context.Context, src, dst string, m metadata.Metadata) (*Record, error) {
+	return WriteRecord(ctx, dst, NewRecord(src, m))
+}
+
+// RecordPath returns the path of the record stored for dst.
+func RecordPath(dst string) string {
+	return filepath.Clean(dst) + RecordSuffix
+}
+
+// WriteRecord lists the tree at dst into the entries of r, and stores r
+// alongside dst. The Source, Digest and Signatures are taken from r as given.
+func WriteRecord(ctx context.Context, dst string, r Record) (*Record, error) {
+	m, err := expand.ScanDir(ctx, dst)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", dst, err)
+	}
+	r.Entries = m.Entries
+	r.TreeDigest = TreeDigest(r.Entries)
+	if err := storeRecord(dst, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// storeRecord stores r alongside dst as it is, but for its timestamp, set to
+// the current time when empty, and its tool, set to this version of
+// go-gather when empty.
+func storeRecord(dst string, r *Record) error {
+	if r.Timestamp == "" {
+		r.Timestamp = time.Now().Format(time.RFC3339)
+	}
+	if r.Tool == "" {
+		r.Tool = "go-gather@" + version()
+	}
+	data, err := canonicalJSON(r)
+	if err != nil {
+		return fmt.Errorf("failed to encode record: %w", err)
+	}
+	if err := os.WriteFile(RecordPath(dst), data, 0644); err != nil {
+		return fmt.Errorf("failed to write record: %w", err)
+	}
+	return nil
+}
+
+// ReadRecord reads the record stored for dst.
+func ReadRecord(dst string) (*Record, error) {
+	data, err := os.ReadFile(RecordPath(dst))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read record: %w", err)
+	}
+	var r Record
+	if err := json.Unmarshal(data, &r); err != nil {
+		return nil, fmt.Errorf("failed to decode record %s: %w", RecordPath(dst), err)
+	}
+	return &r, nil
+}
+
+// TreeDigest returns a digest of entries covering their paths, types,
+// contents and the targets of symbolic links, but not their permissions,
+// which depend on the umask applied.
+func TreeDigest(entries []expand.ManifestEntry) string {
+	h := sha256.New()
+	for _, e := range entries {
+		// The target is only added for links, for the digests of trees
+		// without any to stay as they were
+		if e.Target != "" {
+			fmt.Fprintf(h, "%s\x00%s\x00%s\x00%s\n", e.Path, e.Mode.Type(), e.SHA256, e.Target)
+			continue
+		}
+		fmt.Fprintf(h, "%s\x00%s\x00%s\n", e.Path, e.Mode.Type(), e.SHA256)
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil))
+}
+
+// canonicalJSON encodes v as JSON with the keys of objects sorted and without
+// insignificant whitespace or escaped HTML characters, followed by a newline.
+func canonicalJSON(v any) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	// Objects decoded into maps are encoded with their keys sorted, and
+	// numbers decoded as json.Number are encoded as they were
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var tree any
+	if err := dec.Decode(&tree); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(tree); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// version returns the version of the go-gather module built into the
+// binary, "(devel)" when it is unknown, e.g. in its own tests.
+func version() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "(devel)"
+	}
+	if info.Main.Path == modulePath {
+		return info.Main.Version
+	}
+	for _, dep := range info.Deps {
+		if dep.Path != modulePath {
+			continue
+		}
+		if dep.Replace != nil {
+			dep = dep.Replace
+		}
+		if dep.Version != "" {
+			return dep.Version
+		}
+	}
+	return "(devel)"
+}
@@ -21,7 +21,11 @@ import (
 	_ "github.com/enterprise-contract/go-gather/gather/file"
 	_ "github.com/enterprise-contract/go-gather/gather/git"
 	_ "github.com/enterprise-contract/go-gather/gather/http"
+	_ "github.com/enterprise-contract/go-gather/gather/ipfs"
 	_ "github.com/enterprise-contract/go-gather/gather/oci"
+	_ "github.com/enterprise-contract/go-gather/gather/s3"
+	_ "github.com/enterprise-contract/go-gather/gather/svn"
+	_ "github.com/enterprise-contract/go-gather/gather/webdav"
 )
 
 func GetGatherer(uri string) (gather.Gatherer, error) {
@@ -0,0 +1,227 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+// Package sarif reports the security checks of a gather in the Static
+// Analysis Results Interchange Format (SARIF) 2.1.0, so that path traversal
+// attempts, oversized archives, failed signatures and the like show up in
+// code scanning dashboards. Each check rejecting content becomes a result
+// located at the file, entry or artifact it rejected.
+package sarif
+
+import (
+	"encoding/json"
+	"io"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/enterprise-contract/go-gather/metadata"
+)
+
+const (
+	// Version is the version of SARIF reported.
+	Version = "2.1.0"
+	// Schema is the JSON schema of the SARIF version reported.
+	Schema = "https://json.schemastore.org/sarif-2.1.0.json"
+	// ToolName is the name of the tool reported.
+	ToolName = "go-gather"
+	// srcRoot is the base URI id of the locations, standing for the source
+	// gathered.
+	srcRoot = "SRCROOT"
+)
+
+// rules describe the checks gatherers and expanders record.
+var rules = map[string]string{
+	"path-sanitization": "Paths must stay within the destination",
+	"size-limit":        "Content must not exceed the configured size limit",
+	"file-count-limit":  "Archives must not hold more files than configured",
+	"crc32":             "Archive entries must match their CRC-32 checksum",
+	"block-digest":      "Blocks must match the digest they are addressed by",
+	"write-sandbox":     "Writes must stay within the sandbox",
+	"checksum":          "Downloads must match the checksum they are given with",
+	"signature":         "Content must be signed by a trusted key",
+}
+
+// Options configure a report.
+type Options struct {
+	// Source is the source gathered, reported as the base the locations of
+	// the results are relative to.
+	Source string
+	// ToolVersion is the version of the tool reported, if known.
+	ToolVersion string
+	// IncludePassed also reports the checks that passed, as results of kind
+	// "pass", to show what was checked as well as what was found.
+	IncludePassed bool
+}
+
+// Log is a SARIF log.
+type Log struct {
+	Version string `json:"version"`
+	Schema  string `json:"$schema"`
+	Runs    []Run  `json:"runs"`
+}
+
+// Run is a run of a tool.
+type Run struct {
+	Tool               Tool                        `json:"tool"`
+	OriginalURIBaseIDs map[string]ArtifactLocation `json:"originalUriBaseIds,omitempty"`
+	Results            []Result                    `json:"results"`
+}
+
+// Tool describes the tool that produced a run.
+type Tool struct {
+	Driver Driver `json:"driver"`
+}
+
+// Driver is the component of a tool defining its rules.
+type Driver struct {
+	Name           string `json:"name"`
+	Version        string `json:"version,omitempty"`
+	InformationURI string `json:"informationUri,omitempty"`
+	Rules          []Rule `json:"rules,omitempty"`
+}
+
+// Rule describes a check.
+type Rule struct {
+	ID               string  `json:"id"`
+	ShortDescription Message `json:"shortDescription"`
+}
+
+// Result is a check applied to one location.
+type Result struct {
+	RuleID    string     `json:"ruleId"`
+	Kind      string     `json:"kind,omitempty"`
+	Level     string     `json:"level,omitempty"`
+	Message   Message    `json:"message"`
+	Locations []Location `json:"locations,omitempty"`
+}
+
+// Message is a text message.
+type Message struct {
+	Text string `json:"text"`
+}
+
+// Location is where a result was found.
+type Location struct {
+	PhysicalLocation PhysicalLocation `json:"physicalLocation"`
+}
+
+// PhysicalLocation is a location in an artifact.
+type PhysicalLocation struct {
+	ArtifactLocation ArtifactLocation `json:"artifactLocation"`
+}
+
+// ArtifactLocation names an artifact, relative to the base URI with
+// URIBaseID if it is set.
+type ArtifactLocation struct {
+	URI       string `json:"uri"`
+	URIBaseID string `json:"uriBaseId,omitempty"`
+}
+
+// New returns a report of checks. Checks that were only applied, such as
+// limits in force, are left out, and so are those that passed unless
+// opts.IncludePassed is set.
+func New(checks []metadata.SecurityCheck, opts Options) *Log {
+	run := Run{
+		Tool: Tool{Driver: Driver{
+			Name:           ToolName,
+			Version:        opts.ToolVersion,
+			InformationURI: "https://github.com/enterprise-contract/go-gather",
+		}},
+		Results: []Result{},
+	}
+	if opts.Source != "" {
+		// Base URIs must end in a slash
+		base := strings.TrimSuffix(opts.Source, "/") + "/"
+		run.OriginalURIBaseIDs = map[string]ArtifactLocation{srcRoot: {URI: base}}
+	}
+
+	used := map[string]bool{}
+	for _, c := range checks {
+		var kind, level string
+		switch c.Outcome {
+		case metadata.CheckRejected:
+			kind, level = "fail", "error"
+		case metadata.CheckPassed:
+			if !opts.IncludePassed {
+				continue
+			}
+			kind, level = "pass", "none"
+		default:
+			continue
+		}
+		used[c.Check] = true
+		r := Result{
+			RuleID:  c.Check,
+			Kind:    kind,
+			Level:   level,
+			Message: Message{Text: message(c)},
+		}
+		if c.Subject != "" {
+			r.Locations = []Location{{PhysicalLocation: PhysicalLocation{ArtifactLocation: location(c.Subject, opts.Source != "")}}}
+		}
+		run.Results = append(run.Results, r)
+	}
+
+	for id := range used {
+		description, ok := rules[id]
+		if !ok {
+			description = id
+		}
+		run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, Rule{ID: id, ShortDescription: Message{Text: description}})
+	}
+	sort.Slice(run.Tool.Driver.Rules, func(i, j int) bool {
+		return run.Tool.Driver.Rules[i].ID < run.Tool.Driver.Rules[j].ID
+	})
+
+	return &Log{Version: Version, Schema: Schema, Runs: []Run{run}}
+}
+
+// location returns the location of subject. URLs and absolute paths stand
+// alone, other paths are relative to the source when there is one.
+func location(subject string, relative bool) ArtifactLocation {
+	if u, err := url.Parse(subject); err == nil && len(u.Scheme) > 1 {
+		return ArtifactLocation{URI: subject}
+	}
+	if filepath.IsAbs(subject) {
+		return ArtifactLocation{URI: (&url.URL{Scheme: "file", Path: filepath.ToSlash(subject)}).String()}
+	}
+	loc := ArtifactLocation{URI: filepath.ToSlash(subject)}
+	if relative {
+		loc.URIBaseID = srcRoot
+	}
+	return loc
+}
+
+// message returns the text of the result of c.
+func message(c metadata.SecurityCheck) string {
+	text := c.Check + " " + c.Outcome
+	if c.Subject != "" {
+		text += ": " + c.Subject
+	}
+	if c.Detail != "" {
+		text += " (" + c.Detail + ")"
+	}
+	return text
+}
+
+// Write writes l to w as indented JSON.
+func (l *Log) Write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(l)
+}
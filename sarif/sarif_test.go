@@ -0,0 +1,90 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package sarif
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/enterprise-contract/go-gather/metadata"
+)
+
+var checks = []metadata.SecurityCheck{
+	{Check: "size-limit", Subject: "/tmp/bundle.tar", Outcome: metadata.CheckApplied, Detail: "1024 bytes"},
+	{Check: "path-sanitization", Subject: "../../etc/passwd", Outcome: metadata.CheckRejected, Detail: "entry escapes the destination"},
+	{Check: "crc32", Subject: "/tmp/bundle.zip", Outcome: metadata.CheckPassed},
+	{Check: "signature", Subject: "https://registry.example.com/policy", Outcome: metadata.CheckRejected, Detail: "no signature found"},
+}
+
+func TestNew(t *testing.T) {
+	log := New(checks, Options{Source: "https://example.com/bundle.tar", ToolVersion: "1.0.0"})
+	require.Len(t, log.Runs, 1)
+	run := log.Runs[0]
+
+	assert.Equal(t, "1.0.0", run.Tool.Driver.Version)
+	assert.Equal(t, []Rule{
+		{ID: "path-sanitization", ShortDescription: Message{Text: "Paths must stay within the destination"}},
+		{ID: "signature", ShortDescription: Message{Text: "Content must be signed by a trusted key"}},
+	}, run.Tool.Driver.Rules)
+	assert.Equal(t, "https://example.com/bundle.tar/", run.OriginalURIBaseIDs[srcRoot].URI)
+	assert.Equal(t, []Result{
+		{
+			RuleID:    "path-sanitization",
+			Kind:      "fail",
+			Level:     "error",
+			Message:   Message{Text: "path-sanitization rejected: ../../etc/passwd (entry escapes the destination)"},
+			Locations: []Location{{PhysicalLocation: PhysicalLocation{ArtifactLocation: ArtifactLocation{URI: "../../etc/passwd", URIBaseID: srcRoot}}}},
+		},
+		{
+			RuleID:    "signature",
+			Kind:      "fail",
+			Level:     "error",
+			Message:   Message{Text: "signature rejected: https://registry.example.com/policy (no signature found)"},
+			Locations: []Location{{PhysicalLocation: PhysicalLocation{ArtifactLocation: ArtifactLocation{URI: "https://registry.example.com/policy"}}}},
+		},
+	}, run.Results)
+}
+
+func TestNew_IncludePassed(t *testing.T) {
+	run := New(checks, Options{IncludePassed: true}).Runs[0]
+	require.Len(t, run.Results, 3)
+	passed := run.Results[1]
+	assert.Equal(t, "crc32", passed.RuleID)
+	assert.Equal(t, "pass", passed.Kind)
+	assert.Equal(t, "none", passed.Level)
+	assert.Equal(t, "file:///tmp/bundle.zip", passed.Locations[0].PhysicalLocation.ArtifactLocation.URI)
+	assert.Nil(t, run.OriginalURIBaseIDs)
+	assert.Len(t, run.Tool.Driver.Rules, 3)
+}
+
+func TestLog_Write(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, New(nil, Options{}).Write(&buf))
+
+	var got map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &got))
+	assert.Equal(t, Version, got["version"])
+	assert.Equal(t, Schema, got["$schema"])
+	runs := got["runs"].([]any)
+	require.Len(t, runs, 1)
+	// An empty run still lists its results, as SARIF requires
+	assert.Equal(t, []any{}, runs[0].(map[string]any)["results"])
+}
@@ -0,0 +1,317 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package gogather
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"oras.land/oras-go/v2/registry"
+)
+
+// ErrInvalidSource is matched via errors.Is by the errors of the Validate
+// methods and the Parse functions of the source types.
+var ErrInvalidSource = errors.New("invalid source")
+
+// GitSource is a git repository to gather, rendered by String as a URI the
+// git gatherer accepts, e.g.
+//
+//	git::https://github.com/org/repo.git//policy/lib?ref=v1.2.0
+type GitSource struct {
+	// Repo is the repository, e.g. "https://github.com/org/repo.git",
+	// "github.com/org/repo", "git@github.com:org/repo.git" or
+	// "file:///srv/repo".
+	Repo string
+	// Ref is the branch, tag or commit to check out, the default branch
+	// when empty.
+	Ref string
+	// Subpath is the slash-separated directory of the repository to
+	// gather, all of it when empty.
+	Subpath string
+	// Depth limits the history cloned to as many commits, all of it when
+	// zero.
+	Depth int
+}
+
+// ParseGitSource parses a URI of a git source, as rendered by
+// GitSource.String, with or without the "git::" prefix.
+func ParseGitSource(uri string) (GitSource, error) {
+	rest, query, _ := strings.Cut(strings.TrimPrefix(uri, "git::"), "?")
+	var s GitSource
+	scheme, repo := splitScheme(rest)
+	repo, s.Subpath, _ = strings.Cut(repo, "//")
+	s.Repo = scheme + repo
+
+	q, err := url.ParseQuery(query)
+	if err != nil {
+		return GitSource{}, fmt.Errorf("%w: %s: %w", ErrInvalidSource, uri, err)
+	}
+	for k := range q {
+		switch k {
+		case "ref":
+			s.Ref = q.Get(k)
+		case "depth":
+			if s.Depth, err = strconv.Atoi(q.Get(k)); err != nil {
+				return GitSource{}, fmt.Errorf("%w: %s: invalid depth %q", ErrInvalidSource, uri, q.Get(k))
+			}
+		default:
+			return GitSource{}, fmt.Errorf("%w: %s: unsupported parameter %q", ErrInvalidSource, uri, k)
+		}
+	}
+	if err := s.Validate(); err != nil {
+		return GitSource{}, err
+	}
+	return s, nil
+}
+
+// Validate returns an error if s can't be rendered as a URI naming it.
+func (s GitSource) Validate() error {
+	_, repo := splitScheme(s.Repo)
+	switch {
+	case s.Repo == "":
+		return fmt.Errorf("%w: no git repository", ErrInvalidSource)
+	case strings.ContainsAny(s.Repo, "?#") || strings.Contains(repo, "//"):
+		return fmt.Errorf("%w: git repository %q must not contain \"?\", \"#\" or \"//\"", ErrInvalidSource, s.Repo)
+	case strings.ContainsAny(s.Ref, " ~^:?*[\\") || strings.Contains(s.Ref, "..") || strings.Contains(s.Ref, "//"):
+		return fmt.Errorf("%w: invalid git ref %q", ErrInvalidSource, s.Ref)
+	case s.Subpath != "" && (!fs.ValidPath(cleanSubpath(s.Subpath)) || cleanSubpath(s.Subpath) == "."):
+		return fmt.Errorf("%w: invalid subpath %q", ErrInvalidSource, s.Subpath)
+	case s.Depth < 0:
+		return fmt.Errorf("%w: negative depth %d", ErrInvalidSource, s.Depth)
+	}
+	return nil
+}
+
+// String returns the canonical URI of s.
+func (s GitSource) String() string {
+	var b strings.Builder
+	b.WriteString("git::" + s.Repo)
+	if s.Subpath != "" {
+		b.WriteString("//" + cleanSubpath(s.Subpath))
+	}
+	var params []string
+	if s.Ref != "" {
+		params = append(params, "ref="+queryEscape(s.Ref))
+	}
+	if s.Depth > 0 {
+		params = append(params, "depth="+strconv.Itoa(s.Depth))
+	}
+	if len(params) > 0 {
+		b.WriteString("?" + strings.Join(params, "&"))
+	}
+	return b.String()
+}
+
+// cleanSubpath returns subpath without leading and trailing slashes, cleaned.
+// Subpaths leading out of the repository are kept as they are, to be
+// rejected.
+func cleanSubpath(subpath string) string {
+	return path.Clean(strings.Trim(subpath, "/"))
+}
+
+// OCISource is an artifact in an OCI registry to gather, rendered by String
+// as a URI the OCI gatherer accepts, e.g.
+//
+//	oci::registry.example.com/policy:v1?platform=linux/arm64
+type OCISource struct {
+	// Ref is the reference of the artifact, e.g.
+	// "registry.example.com/policy:v1" or
+	// "registry.example.com/policy@sha256:…".
+	Ref string
+	// Platform selects the manifest of a multi-arch index, written as
+	// "os/arch[/variant]", that of the host when empty.
+	Platform string
+}
+
+// ParseOCISource parses a URI of an OCI source, as rendered by
+// OCISource.String, with or without the "oci::" or "oci://" prefix.
+func ParseOCISource(uri string) (OCISource, error) {
+	rest := strings.TrimPrefix(strings.TrimPrefix(uri, "oci::"), "oci://")
+	var s OCISource
+	var query string
+	s.Ref, query, _ = strings.Cut(rest, "?")
+	q, err := url.ParseQuery(query)
+	if err != nil {
+		return OCISource{}, fmt.Errorf("%w: %s: %w", ErrInvalidSource, uri, err)
+	}
+	for k := range q {
+		if k != "platform" {
+			return OCISource{}, fmt.Errorf("%w: %s: unsupported parameter %q", ErrInvalidSource, uri, k)
+		}
+		s.Platform = q.Get(k)
+	}
+	if err := s.Validate(); err != nil {
+		return OCISource{}, err
+	}
+	return s, nil
+}
+
+// Validate returns an error if s can't be rendered as a URI naming it.
+func (s OCISource) Validate() error {
+	if s.Ref == "" {
+		return fmt.Errorf("%w: no OCI reference", ErrInvalidSource)
+	}
+	if strings.Contains(s.Ref, "://") || strings.Contains(s.Ref, "::") {
+		return fmt.Errorf("%w: OCI reference %q must not have a scheme", ErrInvalidSource, s.Ref)
+	}
+	if _, err := registry.ParseReference(s.Ref); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidSource, err)
+	}
+	if s.Platform != "" {
+		parts := strings.Split(s.Platform, "/")
+		if len(parts) < 2 || len(parts) > 3 || strings.Contains(s.Platform, "//") || strings.HasSuffix(s.Platform, "/") {
+			return fmt.Errorf("%w: invalid platform %q, expected os/arch[/variant]", ErrInvalidSource, s.Platform)
+		}
+	}
+	return nil
+}
+
+// String returns the canonical URI of s.
+func (s OCISource) String() string {
+	if s.Platform == "" {
+		return "oci::" + s.Ref
+	}
+	return "oci::" + s.Ref + "?platform=" + queryEscape(s.Platform)
+}
+
+// HTTPSource is a file to download over HTTP, rendered by String as a URI
+// the HTTP gatherer accepts, e.g.
+//
+//	https://example.com/policy.tar.gz?checksum=sha256:…
+type HTTPSource struct {
+	// URL is the http or https URL of the file.
+	URL string
+	// Checksum is the expected digest of the file, verified once
+	// downloaded, as "type:hex" with type one of md5, sha1, sha256 and
+	// sha512, as a bare hex digest whose type is told by its length, or as
+	// "file:<url>" naming a checksum file listing the digest. Nothing is
+	// verified when empty.
+	Checksum string
+}
+
+// checksumSizes are the lengths of the hex digests of the checksum types.
+var checksumSizes = map[string]int{"md5": 32, "sha1": 40, "sha256": 64, "sha512": 128}
+
+// ParseHTTPSource parses a URI of an HTTP source, as rendered by
+// HTTPSource.String, with or without the "http::" prefix.
+func ParseHTTPSource(uri string) (HTTPSource, error) {
+	u, err := url.Parse(strings.TrimPrefix(uri, "http::"))
+	if err != nil {
+		return HTTPSource{}, fmt.Errorf("%w: %w", ErrInvalidSource, err)
+	}
+	var s HTTPSource
+	var kept []string
+	for _, p := range strings.Split(u.RawQuery, "&") {
+		k, v, _ := strings.Cut(p, "=")
+		if k != "checksum" {
+			kept = append(kept, p)
+			continue
+		}
+		if s.Checksum, err = url.QueryUnescape(v); err != nil {
+			return HTTPSource{}, fmt.Errorf("%w: invalid checksum parameter: %w", ErrInvalidSource, err)
+		}
+	}
+	u.RawQuery = strings.Join(kept, "&")
+	s.URL = u.String()
+	if err := s.Validate(); err != nil {
+		return HTTPSource{}, err
+	}
+	return s, nil
+}
+
+// Validate returns an error if s can't be rendered as a URI naming it.
+func (s HTTPSource) Validate() error {
+	if err := validateHTTPURL(s.URL); err != nil {
+		return err
+	}
+	if u, _ := url.Parse(s.URL); u.Query().Has("checksum") {
+		return fmt.Errorf("%w: %s already has a checksum parameter", ErrInvalidSource, s.URL)
+	}
+	if s.Checksum == "" {
+		return nil
+	}
+	kind, digest, ok := strings.Cut(s.Checksum, ":")
+	if !ok {
+		kind, digest = "", s.Checksum
+	}
+	if kind == "file" {
+		return validateHTTPURL(digest)
+	}
+	if _, err := hex.DecodeString(digest); err != nil {
+		return fmt.Errorf("%w: invalid checksum %q: %w", ErrInvalidSource, s.Checksum, err)
+	}
+	for k, size := range checksumSizes {
+		if (kind == "" || kind == k) && len(digest) == size {
+			return nil
+		}
+	}
+	if _, known := checksumSizes[kind]; kind != "" && !known {
+		return fmt.Errorf("%w: invalid checksum %q: unsupported type %q", ErrInvalidSource, s.Checksum, kind)
+	}
+	return fmt.Errorf("%w: invalid checksum %q: unexpected digest length", ErrInvalidSource, s.Checksum)
+}
+
+// String returns the canonical URI of s.
+func (s HTTPSource) String() string {
+	if s.Checksum == "" {
+		return s.URL
+	}
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		return s.URL
+	}
+	param := "checksum=" + queryEscape(s.Checksum)
+	if u.RawQuery == "" {
+		u.RawQuery = param
+	} else {
+		u.RawQuery += "&" + param
+	}
+	return u.String()
+}
+
+// validateHTTPURL returns an error unless rawURL is an absolute http or
+// https URL.
+func validateHTTPURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidSource, err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%w: %q is not an http or https URL", ErrInvalidSource, rawURL)
+	}
+	return nil
+}
+
+// splitScheme splits the "scheme://" prefix off s, if any.
+func splitScheme(s string) (string, string) {
+	if i := strings.Index(s, "://"); i >= 0 {
+		return s[:i+3], s[i+3:]
+	}
+	return "", s
+}
+
+// queryEscape escapes s as a query parameter value, leaving the slashes and
+// colons of refs, platforms and checksums readable.
+func queryEscape(s string) string {
+	return strings.NewReplacer("%2F", "/", "%3A", ":").Replace(url.QueryEscape(s))
+}
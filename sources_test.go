@@ -0,0 +1,138 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package gogather
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGitSource(t *testing.T) {
+	tests := []struct {
+		source GitSource
+		uri    string
+	}{
+		{GitSource{Repo: "https://github.com/org/repo.git"}, "git::https://github.com/org/repo.git"},
+		{GitSource{Repo: "github.com/org/repo", Ref: "refs/tags/v1.0", Subpath: "/policy/lib/"}, "git::github.com/org/repo//policy/lib?ref=refs/tags/v1.0"},
+		{GitSource{Repo: "git@github.com:org/repo.git", Ref: "main", Depth: 1}, "git::git@github.com:org/repo.git?ref=main&depth=1"},
+		{GitSource{Repo: "file:///srv/repo", Subpath: "a/b", Ref: "feature/x+y"}, "git::file:///srv/repo//a/b?ref=feature/x%2By"},
+	}
+	for _, tt := range tests {
+		require.NoError(t, tt.source.Validate())
+		assert.Equal(t, tt.uri, tt.source.String())
+
+		parsed, err := ParseGitSource(tt.uri)
+		require.NoError(t, err)
+		want := tt.source
+		if want.Subpath != "" {
+			want.Subpath = strings.Trim(want.Subpath, "/")
+		}
+		assert.Equal(t, want, parsed)
+	}
+
+	for _, invalid := range []GitSource{
+		{},
+		{Repo: "https://github.com/org//repo"},
+		{Repo: "https://github.com/org/repo?x=1"},
+		{Repo: "github.com/org/repo", Ref: "bad ref"},
+		{Repo: "github.com/org/repo", Ref: "a..b"},
+		{Repo: "github.com/org/repo", Subpath: "../escape"},
+		{Repo: "github.com/org/repo", Subpath: "/"},
+		{Repo: "github.com/org/repo", Depth: -1},
+	} {
+		assert.ErrorIs(t, invalid.Validate(), ErrInvalidSource, "%+v", invalid)
+	}
+	for _, invalid := range []string{"git::github.com/org/repo?branch=main", "git::github.com/org/repo?depth=x", "git::github.com/org/repo//../x"} {
+		_, err := ParseGitSource(invalid)
+		assert.ErrorIs(t, err, ErrInvalidSource, invalid)
+	}
+}
+
+func TestOCISource(t *testing.T) {
+	tests := []struct {
+		source OCISource
+		uri    string
+	}{
+		{OCISource{Ref: "registry.example.com/policy:v1"}, "oci::registry.example.com/policy:v1"},
+		{OCISource{Ref: "registry.example.com/policy@sha256:" + strings.Repeat("a", 64), Platform: "linux/arm/v7"}, "oci::registry.example.com/policy@sha256:" + strings.Repeat("a", 64) + "?platform=linux/arm/v7"},
+	}
+	for _, tt := range tests {
+		require.NoError(t, tt.source.Validate())
+		assert.Equal(t, tt.uri, tt.source.String())
+
+		parsed, err := ParseOCISource(tt.uri)
+		require.NoError(t, err)
+		assert.Equal(t, tt.source, parsed)
+	}
+
+	parsed, err := ParseOCISource("oci://registry.example.com/policy:v1")
+	require.NoError(t, err)
+	assert.Equal(t, OCISource{Ref: "registry.example.com/policy:v1"}, parsed)
+
+	for _, invalid := range []OCISource{
+		{},
+		{Ref: "oci://registry.example.com/policy"},
+		{Ref: "registry.example.com/Policy:v1"},
+		{Ref: "registry.example.com/policy", Platform: "linux"},
+		{Ref: "registry.example.com/policy", Platform: "linux/arm/v7/x"},
+	} {
+		assert.ErrorIs(t, invalid.Validate(), ErrInvalidSource, "%+v", invalid)
+	}
+	_, err = ParseOCISource("oci::registry.example.com/policy?arch=arm64")
+	assert.ErrorIs(t, err, ErrInvalidSource)
+}
+
+func TestHTTPSource(t *testing.T) {
+	digest := strings.Repeat("ab", 32)
+	tests := []struct {
+		source HTTPSource
+		uri    string
+	}{
+		{HTTPSource{URL: "https://example.com/policy.tar.gz"}, "https://example.com/policy.tar.gz"},
+		{HTTPSource{URL: "https://example.com/policy.tar.gz", Checksum: "sha256:" + digest}, "https://example.com/policy.tar.gz?checksum=sha256:" + digest},
+		{HTTPSource{URL: "http://example.com/p?v=1", Checksum: digest}, "http://example.com/p?v=1&checksum=" + digest},
+		{HTTPSource{URL: "https://example.com/p", Checksum: "file:https://example.com/SHA256SUMS?a=b&c=d"}, "https://example.com/p?checksum=file:https://example.com/SHA256SUMS%3Fa%3Db%26c%3Dd"},
+	}
+	for _, tt := range tests {
+		require.NoError(t, tt.source.Validate())
+		assert.Equal(t, tt.uri, tt.source.String())
+
+		parsed, err := ParseHTTPSource(tt.uri)
+		require.NoError(t, err)
+		assert.Equal(t, tt.source, parsed)
+	}
+
+	parsed, err := ParseHTTPSource("http::https://example.com/p")
+	require.NoError(t, err)
+	assert.Equal(t, HTTPSource{URL: "https://example.com/p"}, parsed)
+
+	for _, invalid := range []HTTPSource{
+		{},
+		{URL: "ftp://example.com/p"},
+		{URL: "/relative"},
+		{URL: "https://example.com/p?checksum=md5:00", Checksum: digest},
+		{URL: "https://example.com/p", Checksum: "sha256:zz"},
+		{URL: "https://example.com/p", Checksum: "sha256:" + digest[:40]},
+		{URL: "https://example.com/p", Checksum: "crc32:" + digest},
+		{URL: "https://example.com/p", Checksum: "file:SHA256SUMS"},
+	} {
+		assert.ErrorIs(t, invalid.Validate(), ErrInvalidSource, "%+v", invalid)
+	}
+}
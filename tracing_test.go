@@ -0,0 +1,115 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package gogather
+
+import (
+	"archive/tar"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/enterprise-contract/go-gather/gather"
+)
+
+func newRecorder() (*tracetest.SpanRecorder, *sdktrace.TracerProvider) {
+	sr := tracetest.NewSpanRecorder()
+	return sr, sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+}
+
+// attrs returns the attributes of span by key.
+func attrs(span sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	m := map[attribute.Key]attribute.Value{}
+	for _, kv := range span.Attributes() {
+		m[kv.Key] = kv.Value
+	}
+	return m
+}
+
+func TestGather_WithTracerProvider(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("package policy"))
+	}))
+	defer server.Close()
+
+	sr, tp := newRecorder()
+	dst := filepath.Join(t.TempDir(), "policy.rego")
+	_, err := Gather(context.Background(), server.URL+"/policy.rego", dst, WithTracerProvider(tp))
+	require.NoError(t, err)
+
+	spans := sr.Ended()
+	require.Len(t, spans, 2)
+	download, root := spans[0], spans[1]
+	assert.Equal(t, "gather", root.Name())
+	assert.Equal(t, "http", attrs(root)["source.type"].AsString())
+	assert.Equal(t, "*http.HTTPGatherer", attrs(root)["gatherer"].AsString())
+	assert.Equal(t, "http.download", download.Name())
+	assert.Equal(t, root.SpanContext().SpanID(), download.Parent().SpanID())
+	assert.Equal(t, int64(len("package policy")), attrs(download)["bytes"].AsInt64())
+	assert.Equal(t, int64(http.StatusOK), attrs(download)["http.response.status_code"].AsInt64())
+}
+
+func TestGather_WithTracerProvider_Expand(t *testing.T) {
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "policy.tar")
+	f, err := os.Create(archive)
+	require.NoError(t, err)
+	tw := tar.NewWriter(f)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "policy.rego", Mode: 0644, Size: 14}))
+	_, err = tw.Write([]byte("package policy"))
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+	require.NoError(t, f.Close())
+
+	sr, tp := newRecorder()
+	_, err = Gather(context.Background(), "file::"+archive, filepath.Join(dir, "dst"), WithTracerProvider(tp))
+	require.NoError(t, err)
+
+	spans := sr.Ended()
+	require.Len(t, spans, 2)
+	assert.Equal(t, "expand", spans[0].Name())
+	assert.Equal(t, "tar", attrs(spans[0])["expand.format"].AsString())
+	assert.Equal(t, int64(14), attrs(spans[0])["bytes"].AsInt64())
+	assert.Equal(t, "file", attrs(spans[1])["source.type"].AsString())
+}
+
+func TestGather_WithTracerProvider_Error(t *testing.T) {
+	sr, tp := newRecorder()
+	_, err := Gather(context.Background(), "fake://policy", t.TempDir(), WithRegistry(gather.NewRegistry()), WithTracerProvider(tp))
+	require.Error(t, err)
+
+	spans := sr.Ended()
+	require.Len(t, spans, 1)
+	assert.Equal(t, codes.Error, spans[0].Status().Code)
+}
+
+func TestGather_NotTraced(t *testing.T) {
+	// Nothing is traced without a tracer provider
+	r := gather.NewRegistry()
+	r.RegisterGatherer(fakeGatherer{})
+	_, err := Gather(context.Background(), "fake://policy", filepath.Join(t.TempDir(), "dst"), WithRegistry(r))
+	require.NoError(t, err)
+}
@@ -0,0 +1,114 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package gogather
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/enterprise-contract/go-gather/expand"
+)
+
+// cosignSignatureTag matches the tag cosign stores an image's signature
+// under, derived from the image digest.
+var cosignSignatureTag = regexp.MustCompile(`(?:^|:)(sha256)-([0-9a-f]{64})\.sig$`)
+
+// VerifyReport is the result of checking a gathered tree against its record.
+type VerifyReport struct {
+	Destination string
+	Source      string
+	Digest      string
+	Signatures  []string
+	// Verified is the number of recorded entries that are unchanged.
+	Verified int
+	// Missing, Modified and Added list the slash-separated paths of
+	// recorded entries that are gone or changed, and of unrecorded ones.
+	Missing  []string
+	Modified []string
+	Added    []string
+	// Problems describes inconsistencies in the record itself.
+	Problems []string
+}
+
+// OK reports whether the tree and its record are unchanged.
+func (r *VerifyReport) OK() bool {
+	return len(r.Missing) == 0 && len(r.Modified) == 0 && len(r.Added) == 0 && len(r.Problems) == 0
+}
+
+// VerifyDestination checks the tree at dst against the record stored for it
+// by WriteRecord. Drift is described by the report, an error is only
+// returned if the record or the tree cannot be read.
+func VerifyDestination(ctx context.Context, dst string) (*VerifyReport, error) {
+	record, err := ReadRecord(dst)
+	if err != nil {
+		return nil, err
+	}
+	current, err := expand.ScanDir(ctx, dst)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", dst, err)
+	}
+
+	report := &VerifyReport{
+		Destination: dst,
+		Source:      record.Source,
+		Digest:      record.Digest,
+		Signatures:  record.Signatures,
+	}
+
+	// The recorded entries must still be those the record was written with
+	if TreeDigest(record.Entries) != record.TreeDigest {
+		report.Problems = append(report.Problems, "the recorded entries do not match the recorded tree digest")
+	}
+	if record.Source == "" {
+		report.Problems = append(report.Problems, "the record does not name a source")
+	}
+	for _, sig := range record.Signatures {
+		m := cosignSignatureTag.FindStringSubmatch(sig)
+		if m == nil {
+			continue
+		}
+		if want := m[1] + ":" + m[2]; !strings.HasSuffix(record.Digest, want) {
+			report.Problems = append(report.Problems, fmt.Sprintf("signature %s does not belong to digest %s", sig, record.Digest))
+		}
+	}
+
+	found := make(map[string]expand.ManifestEntry, len(current.Entries))
+	for _, e := range current.Entries {
+		found[e.Path] = e
+	}
+	for _, want := range record.Entries {
+		got, ok := found[want.Path]
+		delete(found, want.Path)
+		switch {
+		case !ok:
+			report.Missing = append(report.Missing, want.Path)
+		case got.Mode.Type() != want.Mode.Type() || got.Size != want.Size || got.SHA256 != want.SHA256 || got.Target != want.Target:
+			report.Modified = append(report.Modified, want.Path)
+		default:
+			report.Verified++
+		}
+	}
+	// Unrecorded entries are reported in the order they were found
+	for _, e := range current.Entries {
+		if _, ok := found[e.Path]; ok {
+			report.Added = append(report.Added, e.Path)
+		}
+	}
+	return report, nil
+}
@@ -0,0 +1,189 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package gogather
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/enterprise-contract/go-gather/expand"
+	"github.com/enterprise-contract/go-gather/metadata"
+)
+
+// gatheredTree writes a small tree and its record, returning its path.
+func gatheredTree(t *testing.T, r Record) string {
+	t.Helper()
+	dst := filepath.Join(t.TempDir(), "policy")
+	require.NoError(t, os.MkdirAll(filepath.Join(dst, "lib"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(dst, "main.rego"), []byte("package main"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dst, "lib", "lib.rego"), []byte("package lib"), 0644))
+	_, err := WriteRecord(context.Background(), dst, r)
+	require.NoError(t, err)
+	return dst
+}
+
+func TestWriteRecord(t *testing.T) {
+	dst := gatheredTree(t, Record{Source: "git::example.com/org/repo.git", Digest: "abc"})
+
+	r, err := ReadRecord(dst)
+	require.NoError(t, err)
+	assert.Equal(t, "git::example.com/org/repo.git", r.Source)
+	assert.Equal(t, "abc", r.Digest)
+	assert.NotEmpty(t, r.Timestamp)
+	assert.Equal(t, TreeDigest(r.Entries), r.TreeDigest)
+
+	var paths []string
+	for _, e := range r.Entries {
+		paths = append(paths, e.Path)
+	}
+	assert.Equal(t, []string{"lib", "lib/lib.rego", "main.rego"}, paths)
+
+	_, err = os.Stat(filepath.Join(dst, "policy"+RecordSuffix))
+	assert.True(t, os.IsNotExist(err), "the record must not be stored inside the tree")
+	_, err = os.Stat(dst + RecordSuffix)
+	assert.NoError(t, err)
+}
+
+func TestWriteProvenance(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	require.NoError(t, os.MkdirAll(src, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "policy.rego"), []byte("package policy"), 0644))
+	dst := filepath.Join(dir, "dst")
+	m, err := Gather(context.Background(), "file::"+src, dst)
+	require.NoError(t, err)
+
+	r, err := WriteProvenance(context.Background(), "file::"+src, dst, m)
+	require.NoError(t, err)
+	assert.Equal(t, "file::"+src, r.Source)
+	assert.Equal(t, "file", r.Type)
+	assert.Equal(t, "go-gather@(devel)", r.Tool)
+	assert.Equal(t, metadata.Summarize(m).Timestamp, r.Timestamp)
+
+	// The record is stored as canonical JSON
+	data, err := os.ReadFile(RecordPath(dst))
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(data), `{"entries":[{"mode":`), string(data))
+	assert.NotContains(t, string(data), "\n  ")
+	canonical, err := canonicalJSON(r)
+	require.NoError(t, err)
+	assert.Equal(t, string(canonical), string(data))
+
+	stored, err := ReadRecord(dst)
+	require.NoError(t, err)
+	assert.Equal(t, r, stored)
+}
+
+func TestTreeDigest(t *testing.T) {
+	// Trees without links keep the digests they had before link targets
+	// were covered
+	entries := []expand.ManifestEntry{{Path: "main.rego", SHA256: strings.Repeat("a", 64)}}
+	sum := sha256.Sum256([]byte("main.rego\x00----------\x00" + strings.Repeat("a", 64) + "\n"))
+	assert.Equal(t, "sha256:"+hex.EncodeToString(sum[:]), TreeDigest(entries))
+
+	link := []expand.ManifestEntry{{Path: "link.rego", Mode: os.ModeSymlink, Target: "main.rego"}}
+	retargeted := []expand.ManifestEntry{{Path: "link.rego", Mode: os.ModeSymlink, Target: "../evil.rego"}}
+	assert.NotEqual(t, TreeDigest(link), TreeDigest(retargeted))
+}
+
+func TestCanonicalJSON(t *testing.T) {
+	data, err := canonicalJSON(map[string]any{"b": "<a&b>", "a": []any{int64(1) << 60, 1.5}})
+	require.NoError(t, err)
+	assert.Equal(t, `{"a":[1152921504606846976,1.5],"b":"<a&b>"}`+"\n", string(data))
+}
+
+func TestVerifyDestination(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("a", 64)
+	record := Record{
+		Source:     "oci::registry.example.com/policy:latest",
+		Digest:     digest,
+		Signatures: []string{"registry.example.com/policy:sha256-" + strings.Repeat("a", 64) + ".sig"},
+	}
+
+	t.Run("unchanged", func(t *testing.T) {
+		dst := gatheredTree(t, record)
+		report, err := VerifyDestination(context.Background(), dst)
+		require.NoError(t, err)
+		assert.True(t, report.OK(), "%+v", report)
+		assert.Equal(t, 3, report.Verified)
+		assert.Equal(t, record.Source, report.Source)
+		assert.Equal(t, digest, report.Digest)
+	})
+
+	t.Run("drift", func(t *testing.T) {
+		dst := gatheredTree(t, record)
+		require.NoError(t, os.WriteFile(filepath.Join(dst, "main.rego"), []byte("package changed"), 0644))
+		require.NoError(t, os.Remove(filepath.Join(dst, "lib", "lib.rego")))
+		require.NoError(t, os.WriteFile(filepath.Join(dst, "extra.rego"), []byte("package extra"), 0644))
+
+		report, err := VerifyDestination(context.Background(), dst)
+		require.NoError(t, err)
+		assert.False(t, report.OK())
+		assert.Equal(t, 1, report.Verified)
+		assert.Equal(t, []string{"main.rego"}, report.Modified)
+		assert.Equal(t, []string{"lib/lib.rego"}, report.Missing)
+		assert.Equal(t, []string{"extra.rego"}, report.Added)
+		assert.Empty(t, report.Problems)
+	})
+
+	t.Run("retargeted link", func(t *testing.T) {
+		dst := filepath.Join(t.TempDir(), "policy")
+		require.NoError(t, os.MkdirAll(dst, 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(dst, "main.rego"), []byte("package main"), 0644))
+		require.NoError(t, os.Symlink("main.rego", filepath.Join(dst, "link.rego")))
+		_, err := WriteRecord(context.Background(), dst, record)
+		require.NoError(t, err)
+
+		require.NoError(t, os.Remove(filepath.Join(dst, "link.rego")))
+		require.NoError(t, os.Symlink("../evil.rego", filepath.Join(dst, "link.rego")))
+		report, err := VerifyDestination(context.Background(), dst)
+		require.NoError(t, err)
+		assert.False(t, report.OK())
+		assert.Equal(t, []string{"link.rego"}, report.Modified)
+	})
+
+	t.Run("tampered record", func(t *testing.T) {
+		dst := gatheredTree(t, record)
+		r, err := ReadRecord(dst)
+		require.NoError(t, err)
+		r.Entries = r.Entries[1:]
+		r.Signatures = []string{"registry.example.com/policy:sha256-" + strings.Repeat("b", 64) + ".sig"}
+		data, err := json.Marshal(r)
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(RecordPath(dst), data, 0644))
+
+		report, err := VerifyDestination(context.Background(), dst)
+		require.NoError(t, err)
+		assert.False(t, report.OK())
+		assert.Len(t, report.Problems, 2)
+		assert.Equal(t, []string{"lib"}, report.Added)
+	})
+
+	t.Run("no record", func(t *testing.T) {
+		_, err := VerifyDestination(context.Background(), t.TempDir())
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,286 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package gogather
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/enterprise-contract/go-gather/gather"
+	"github.com/enterprise-contract/go-gather/layout"
+	"github.com/enterprise-contract/go-gather/metadata"
+)
+
+// ErrWorkspaceClosed is returned by gathers into a closed Workspace.
+var ErrWorkspaceClosed = errors.New("workspace is closed")
+
+// Workspace is a temporary directory many sources are gathered into, one
+// directory each, which keeps track of what was gathered where and removes
+// it all when closed. It is safe for concurrent use.
+type Workspace struct {
+	// Registry picks the gatherer of each source. The default registry,
+	// which holds the built-in gatherers, is used when nil.
+	Registry *gather.Registry
+	// Dedup stores the contents of the files gathered once, in a
+	// content-addressed blob store within the workspace, and hard links the
+	// files of every tree to them, so that files shared by several sources
+	// take space once. A source gathered before, named by its URI or the URI
+	// it was pinned to, is then linked into place from the blob store
+	// rather than gathered again. As a change to a file changes every tree
+	// sharing its contents, the trees must be treated as read-only.
+	Dedup bool
+
+	root string
+	mu   sync.Mutex
+	// names maps the names gathered into, or being gathered into, to their
+	// entries, nil until the gather completes.
+	names   map[string]*WorkspaceEntry
+	closed  bool
+	running sync.WaitGroup
+}
+
+// WorkspaceEntry describes a source gathered into a Workspace.
+type WorkspaceEntry struct {
+	// Name is the directory of the workspace the source was gathered into.
+	Name string `json:"name"`
+	// Source is the URI gathered, and Pinned the URI pinned to what it
+	// resolved to, when the gatherer could pin it.
+	Source string `json:"source"`
+	Pinned string `json:"pinned,omitempty"`
+	// Path is the absolute path of the directory.
+	Path string `json:"path"`
+	// TreeDigest is the digest of the tree gathered, see TreeDigest.
+	TreeDigest string `json:"treeDigest"`
+	Timestamp  string `json:"timestamp"`
+	// Linked is the number of files whose contents were in the blob store
+	// already, see Workspace.Dedup.
+	Linked int `json:"linked,omitempty"`
+	// ReusedFrom names the entry the tree was linked into place from,
+	// rather than gathered, see Workspace.Dedup.
+	ReusedFrom string `json:"reusedFrom,omitempty"`
+	// Metadata is what the gatherer returned.
+	Metadata metadata.Metadata `json:"-"`
+}
+
+// WorkspaceManifest lists the sources gathered into a Workspace.
+type WorkspaceManifest struct {
+	Root string `json:"root"`
+	// Entries are ordered by name.
+	Entries []WorkspaceEntry `json:"entries"`
+}
+
+// NewWorkspace creates a workspace in a new temporary directory in dir, or in
+// the default directory for temporary files when dir is empty. The caller
+// must Close it.
+func NewWorkspace(dir string) (*Workspace, error) {
+	root, err := os.MkdirTemp(dir, "go-gather-workspace-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create workspace: %w", err)
+	}
+	return &Workspace{root: root, names: map[string]*WorkspaceEntry{}}, nil
+}
+
+// Root returns the directory of the workspace.
+func (w *Workspace) Root() string {
+	return w.root
+}
+
+// Gather gathers src into the directory name of the workspace, a local,
+// relative path, or a name derived from src when empty, and records it
+// alongside the directory, see WriteRecord. Each name can be gathered into
+// once, and not into the directory of another; a failed gather removes what
+// it wrote and frees its name.
+func (w *Workspace) Gather(ctx context.Context, src, name string) (*WorkspaceEntry, error) {
+	if name == "" {
+		name = layout.DefaultPrefix(src)
+	}
+	if !filepath.IsLocal(name) {
+		return nil, fmt.Errorf("invalid workspace name %q: not a local path", name)
+	}
+	name = filepath.Clean(name)
+	if nested(blobsDir, name) {
+		return nil, fmt.Errorf("invalid workspace name %q: reserved for the blob store", name)
+	}
+
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil, ErrWorkspaceClosed
+	}
+	for used := range w.names {
+		if nested(used, name) || nested(name, used) {
+			w.mu.Unlock()
+			return nil, fmt.Errorf("%w: %s overlaps %s, gathered into the workspace already", ErrDestinationExists, name, used)
+		}
+	}
+	var reuse *WorkspaceEntry
+	if w.Dedup {
+		reuse = w.find(src)
+	}
+	w.names[name] = nil
+	w.running.Add(1)
+	w.mu.Unlock()
+	defer w.running.Done()
+
+	entry, err := w.gather(ctx, src, name, reuse)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err != nil {
+		delete(w.names, name)
+		return nil, err
+	}
+	w.names[name] = entry
+	copied := *entry
+	return &copied, nil
+}
+
+// find returns the entry gathered from src, or pinned to it, if any, for
+// callers holding the lock.
+func (w *Workspace) find(src string) *WorkspaceEntry {
+	for _, e := range w.names {
+		if e != nil && (e.Source == src || e.Pinned == src) {
+			return e
+		}
+	}
+	return nil
+}
+
+// gather gathers src into name, or links the tree of reuse into place when
+// not nil and its contents are all stored, removing what it wrote if it
+// fails.
+func (w *Workspace) gather(ctx context.Context, src, name string, reuse *WorkspaceEntry) (_ *WorkspaceEntry, err error) {
+	dst := filepath.Join(w.root, name)
+	defer func() {
+		if err != nil {
+			err = AppendErrors(Errors{err}, os.RemoveAll(dst), os.RemoveAll(RecordPath(dst))).Err()
+		}
+	}()
+
+	if reuse != nil {
+		if record, err := ReadRecord(reuse.Path); err == nil && w.materializable(record) {
+			if err := w.materialize(ctx, record, dst); err != nil {
+				return nil, err
+			}
+			record.Source, record.Timestamp = src, ""
+			if err := storeRecord(dst, record); err != nil {
+				return nil, err
+			}
+			return &WorkspaceEntry{
+				Name:       filepath.ToSlash(name),
+				Source:     src,
+				Pinned:     reuse.Pinned,
+				Path:       dst,
+				TreeDigest: record.TreeDigest,
+				Timestamp:  record.Timestamp,
+				Linked:     len(record.Entries),
+				ReusedFrom: reuse.Name,
+				Metadata:   reuse.Metadata,
+			}, nil
+		}
+	}
+
+	// Gather honours the go-getter syntax of src, and the trailing separator
+	// has gatherers of single files write them into the directory
+	m, err := Gather(ctx, src, dst+string(filepath.Separator), WithRegistry(w.Registry))
+	if err != nil {
+		return nil, err
+	}
+	record, err := WriteProvenance(ctx, src, dst, m)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &WorkspaceEntry{
+		Name:       filepath.ToSlash(name),
+		Source:     src,
+		Pinned:     record.Pinned,
+		Path:       dst,
+		TreeDigest: record.TreeDigest,
+		Timestamp:  record.Timestamp,
+		Metadata:   m,
+	}
+	if w.Dedup {
+		if entry.Linked, err = w.dedup(ctx, dst, record.Entries); err != nil {
+			return nil, err
+		}
+	}
+	return entry, nil
+}
+
+// nested reports whether the path b is a or is within it.
+func nested(a, b string) bool {
+	return a == b || strings.HasPrefix(b, a+string(filepath.Separator))
+}
+
+// Entries returns the sources gathered into the workspace so far, ordered
+// by name.
+func (w *Workspace) Entries() []WorkspaceEntry {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	entries := make([]WorkspaceEntry, 0, len(w.names))
+	for _, e := range w.names {
+		if e != nil {
+			entries = append(entries, *e)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	return entries
+}
+
+// Manifest returns the manifest of the sources gathered into the workspace
+// so far.
+func (w *Workspace) Manifest() *WorkspaceManifest {
+	return &WorkspaceManifest{Root: w.root, Entries: w.Entries()}
+}
+
+// WriteManifest writes the manifest of the workspace to out as JSON.
+func (w *Workspace) WriteManifest(out io.Writer) error {
+	data, err := json.MarshalIndent(w.Manifest(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode workspace manifest: %w", err)
+	}
+	_, err = out.Write(append(data, '\n'))
+	return err
+}
+
+// Close waits for the gathers in progress and removes the workspace with
+// everything gathered into it. Later gathers fail with ErrWorkspaceClosed.
+// Closing a closed workspace does nothing.
+func (w *Workspace) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	w.mu.Unlock()
+
+	w.running.Wait()
+	if err := os.RemoveAll(w.root); err != nil {
+		return fmt.Errorf("failed to remove workspace: %w", err)
+	}
+	return nil
+}
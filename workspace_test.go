@@ -0,0 +1,220 @@
+// Copyright The Enterprise Contract Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package gogather
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/enterprise-contract/go-gather/gather"
+	"github.com/enterprise-contract/go-gather/gather/file"
+	"github.com/enterprise-contract/go-gather/metadata"
+)
+
+// fakeMetadata pins sources to "pinned+<source>".
+type fakeMetadata struct{}
+
+func (fakeMetadata) Get() any { return nil }
+
+func (fakeMetadata) GetPinnedURL(u string) (string, error) { return "pinned+" + u, nil }
+
+// fakeGatherer writes a file named after the source, and a file common to
+// every source, for "fake://" sources, and fails for "fake://fail" once it
+// wrote them.
+type fakeGatherer struct{}
+
+func (fakeGatherer) Matcher(uri string) bool { return strings.HasPrefix(uri, "fake://") }
+
+func (fakeGatherer) Gather(ctx context.Context, src, dst string) (metadata.Metadata, error) {
+	name := strings.TrimPrefix(src, "fake://")
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(dst, name+".rego"), []byte("package "+name), 0644); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(dst, "common.json"), []byte("{}"), 0644); err != nil {
+		return nil, err
+	}
+	if name == "fail" {
+		return nil, errors.New("gather failed")
+	}
+	return fakeMetadata{}, nil
+}
+
+func newTestWorkspace(t *testing.T) *Workspace {
+	t.Helper()
+	w, err := NewWorkspace(t.TempDir())
+	require.NoError(t, err)
+	w.Registry = gather.NewRegistry()
+	w.Registry.RegisterGatherer(fakeGatherer{})
+	t.Cleanup(func() { _ = w.Close() })
+	return w
+}
+
+func TestWorkspace_Gather(t *testing.T) {
+	ctx := context.Background()
+	w := newTestWorkspace(t)
+
+	e, err := w.Gather(ctx, "fake://main", "policy/main")
+	require.NoError(t, err)
+	assert.Equal(t, "policy/main", e.Name)
+	assert.Equal(t, filepath.Join(w.Root(), "policy", "main"), e.Path)
+	assert.Equal(t, "pinned+fake://main", e.Pinned)
+	assert.FileExists(t, filepath.Join(e.Path, "main.rego"))
+
+	// The record written lets the tree be verified
+	report, err := VerifyDestination(ctx, e.Path)
+	require.NoError(t, err)
+	assert.True(t, report.OK())
+	assert.Equal(t, "fake://main", report.Source)
+
+	// Unnamed sources are gathered into a directory derived from them
+	e, err = w.Gather(ctx, "fake://data", "")
+	require.NoError(t, err)
+	assert.FileExists(t, filepath.Join(w.Root(), e.Name, "data.rego"))
+
+	var out bytes.Buffer
+	require.NoError(t, w.WriteManifest(&out))
+	var manifest WorkspaceManifest
+	require.NoError(t, json.Unmarshal(out.Bytes(), &manifest))
+	assert.Equal(t, w.Root(), manifest.Root)
+	require.Len(t, manifest.Entries, 2)
+	assert.Equal(t, "policy/main", manifest.Entries[1].Name)
+	assert.Equal(t, "fake://data", manifest.Entries[0].Source)
+	assert.NotEmpty(t, manifest.Entries[0].TreeDigest)
+}
+
+func TestWorkspace_Gather_Errors(t *testing.T) {
+	ctx := context.Background()
+	w := newTestWorkspace(t)
+
+	_, err := w.Gather(ctx, "fake://main", "policy")
+	require.NoError(t, err)
+
+	for _, name := range []string{"policy", "policy/nested"} {
+		_, err = w.Gather(ctx, "fake://other", name)
+		assert.ErrorIs(t, err, ErrDestinationExists, name)
+	}
+	for _, name := range []string{"../escape", "/absolute"} {
+		_, err = w.Gather(ctx, "fake://other", name)
+		assert.Error(t, err, name)
+	}
+	_, err = w.Gather(ctx, "unknown://source", "unknown")
+	assert.ErrorIs(t, err, ErrUnsupportedScheme)
+	assert.ErrorContains(t, err, "no gatherer found")
+
+	// A failed gather leaves nothing behind and frees its name
+	_, err = w.Gather(ctx, "fake://fail", "failed")
+	assert.ErrorContains(t, err, "gather failed")
+	assert.NoDirExists(t, filepath.Join(w.Root(), "failed"))
+	_, err = w.Gather(ctx, "fake://retry", "failed")
+	assert.NoError(t, err)
+
+	assert.Len(t, w.Entries(), 2)
+}
+
+func TestWorkspace_Gather_GetterSyntax(t *testing.T) {
+	ctx := context.Background()
+	w := newTestWorkspace(t)
+	w.Registry.RegisterGatherer(&file.FileGatherer{})
+	src := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(src, "policy"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "policy", "main.rego"), []byte("package main"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "README.md"), []byte("# policy"), 0644))
+
+	// Only the subdirectory is gathered
+	e, err := w.Gather(ctx, "file::"+src+"//policy", "policy")
+	require.NoError(t, err)
+	assert.FileExists(t, filepath.Join(e.Path, "main.rego"))
+	assert.NoFileExists(t, filepath.Join(e.Path, "README.md"))
+
+	// And checksums are verified
+	_, err = w.Gather(ctx, "file::"+filepath.Join(src, "README.md")+"?checksum=sha256:"+strings.Repeat("0", 64), "readme")
+	assert.ErrorIs(t, err, ErrVerificationFailed)
+	assert.NoDirExists(t, filepath.Join(w.Root(), "readme"))
+}
+
+func TestWorkspace_Gather_Dedup(t *testing.T) {
+	ctx := context.Background()
+	w := newTestWorkspace(t)
+	w.Dedup = true
+
+	a, err := w.Gather(ctx, "fake://a", "a")
+	require.NoError(t, err)
+	assert.Equal(t, 0, a.Linked)
+	b, err := w.Gather(ctx, "fake://b", "b")
+	require.NoError(t, err)
+	assert.Equal(t, 1, b.Linked)
+
+	sameFile := func(a, b string) bool {
+		ai, err := os.Stat(a)
+		require.NoError(t, err)
+		bi, err := os.Stat(b)
+		require.NoError(t, err)
+		return os.SameFile(ai, bi)
+	}
+	assert.True(t, sameFile(filepath.Join(a.Path, "common.json"), filepath.Join(b.Path, "common.json")))
+	assert.False(t, sameFile(filepath.Join(a.Path, "a.rego"), filepath.Join(b.Path, "b.rego")))
+
+	// A source gathered before is linked into place, even when named by
+	// the URI it was pinned to, which no gatherer matches
+	c, err := w.Gather(ctx, "pinned+fake://a", "c")
+	require.NoError(t, err)
+	assert.Equal(t, "a", c.ReusedFrom)
+	assert.Equal(t, a.TreeDigest, c.TreeDigest)
+	assert.True(t, sameFile(filepath.Join(a.Path, "a.rego"), filepath.Join(c.Path, "a.rego")))
+	report, err := VerifyDestination(ctx, c.Path)
+	require.NoError(t, err)
+	assert.True(t, report.OK())
+
+	_, err = w.Gather(ctx, "fake://d", ".blobs/d")
+	assert.ErrorContains(t, err, "reserved")
+}
+
+func TestWorkspace_Close(t *testing.T) {
+	ctx := context.Background()
+	w := newTestWorkspace(t)
+
+	var wg sync.WaitGroup
+	for _, name := range []string{"a", "b", "c", "d"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := w.Gather(ctx, "fake://"+name, name)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+	assert.Len(t, w.Entries(), 4)
+
+	require.NoError(t, w.Close())
+	assert.NoDirExists(t, w.Root())
+	_, err := w.Gather(ctx, "fake://late", "late")
+	assert.ErrorIs(t, err, ErrWorkspaceClosed)
+	assert.NoError(t, w.Close())
+}